@@ -0,0 +1,183 @@
+package roi
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"image/png"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// AnnotationStroke는 리뷰어가 이미지 위에 그린 하나의 선이다.
+// 좌표는 이미지의 너비와 높이에 대한 0에서 1 사이의 비율이어서
+// 원본 이미지의 해상도와 관계없이 다시 그릴 수 있다.
+type AnnotationStroke struct {
+	Color  string       `json:"color"`
+	Width  float64      `json:"width"`
+	Points [][2]float64 `json:"points"`
+}
+
+// Annotation은 리뷰에 첨부된 그림이다.
+// 선들의 벡터 정보와 함께, 원본 이미지 위에 선을 그려 합친 PNG 이미지가 저장된다.
+type Annotation struct {
+	Project string
+	// ReviewID는 그림이 첨부된 리뷰의 아이디이다. Review.ID 참고.
+	ReviewID string
+	// Source는 그림을 그린 원본 이미지나 영상의 경로이다.
+	Source string
+	// Frame은 그림을 그린 영상의 프레임 번호이다. 단일 이미지에 그렸다면 0이다.
+	Frame   int
+	Strokes []AnnotationStroke
+}
+
+var CreateTableIfNotExistsAnnotationsStmt = `CREATE TABLE IF NOT EXISTS annotations (
+	uniqid UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+	project STRING NOT NULL CHECK (length(project) > 0) CHECK (project NOT LIKE '% %'),
+	review_id STRING NOT NULL CHECK (length(review_id) > 0),
+	source STRING NOT NULL,
+	frame INT NOT NULL,
+	strokes STRING NOT NULL,
+	UNIQUE(project, review_id)
+)`
+
+var AnnotationTableKeys = []string{
+	"project",
+	"review_id",
+	"source",
+	"frame",
+	"strokes",
+}
+
+var AnnotationTableIndices = dbIndices(AnnotationTableKeys)
+
+// checkAnnotationStrokes는 선들이 그려질 수 있는 값을 가지는지 검사한다.
+func checkAnnotationStrokes(strokes []AnnotationStroke) error {
+	if len(strokes) == 0 {
+		return errorf(ErrInvalid, "annotation has no strokes")
+	}
+	for _, s := range strokes {
+		if s.Width <= 0 {
+			return errorf(ErrInvalid, "invalid stroke width: %v", s.Width)
+		}
+		if len(s.Points) == 0 {
+			return errorf(ErrInvalid, "stroke has no points")
+		}
+		for _, p := range s.Points {
+			if p[0] < 0 || p[0] > 1 || p[1] < 0 || p[1] > 1 {
+				return errorf(ErrInvalid, "stroke point out of range: %v", p)
+			}
+		}
+	}
+	return nil
+}
+
+// AnnotationImageURLPath는 리뷰 그림 이미지를 /annotation/ 아래에서 찾을 수 있는 경로를 반환한다.
+// 리뷰 아이디가 형식에 맞지 않으면 빈 문자열을 반환한다.
+//
+// 예)
+// 	AnnotationImageURLPath("TEST", "CG_0010.fx.v001.r1") => "TEST/CG_0010/fx/v001/CG_0010.fx.v001.r1.png"
+//
+func AnnotationImageURLPath(prj, reviewID string) string {
+	ids := strings.Split(reviewID, ".")
+	if len(ids) != 4 {
+		return ""
+	}
+	return fmt.Sprintf("%s/%s/%s/%s/%s.png", prj, ids[0], ids[1], ids[2], reviewID)
+}
+
+// annotationImageFile은 리뷰 그림 이미지가 저장되는 파일 경로이다.
+func annotationImageFile(prj, reviewID string) string {
+	return filepath.Join(UserDataDir, "annotation", filepath.FromSlash(AnnotationImageURLPath(prj, reviewID)))
+}
+
+// AddAnnotatedReview는 그림이 첨부된 리뷰를 버전에 추가한다.
+// img는 원본 이미지 위에 선을 그려 합친 PNG 이미지이다.
+// 리뷰가 추가되지 못하면 그림 이미지도 저장되지 않는다.
+func AddAnnotatedReview(db *sql.DB, r *Review, a *Annotation, img []byte) error {
+	return AddAnnotatedReviewContext(context.Background(), db, r, a, img)
+}
+
+// AddAnnotatedReviewContext는 ctx를 받는 AddAnnotatedReview이다.
+func AddAnnotatedReviewContext(ctx context.Context, db *sql.DB, r *Review, a *Annotation, img []byte) error {
+	if r == nil {
+		return errorf(ErrInvalid, "nil review")
+	}
+	if a == nil {
+		return errorf(ErrInvalid, "nil annotation")
+	}
+	if err := checkAnnotationStrokes(a.Strokes); err != nil {
+		return err
+	}
+	if _, err := png.DecodeConfig(bytes.NewReader(img)); err != nil {
+		return errorf(ErrInvalid, "invalid annotation image: %w", err)
+	}
+	strokes, err := json.Marshal(a.Strokes)
+	if err != nil {
+		return err
+	}
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("could not begin a transaction: %w", err)
+	}
+	defer tx.Rollback() // 트랜잭션이 완료되지 않았을 때만 실행됨
+	if err := addReview(ctx, tx, r); err != nil {
+		return err
+	}
+	a.Project = r.ProjectID
+	a.ReviewID = r.ID
+	keystr := strings.Join(AnnotationTableKeys, ", ")
+	idxstr := strings.Join(AnnotationTableIndices, ", ")
+	stmt := fmt.Sprintf("INSERT INTO annotations (%s) VALUES (%s)", keystr, idxstr)
+	if _, err := dbExec(ctx, tx, stmt, a.Project, a.ReviewID, a.Source, a.Frame, string(strokes)); err != nil {
+		return fmt.Errorf("could not insert annotation: %w", err)
+	}
+	f := annotationImageFile(r.ProjectID, r.ID)
+	if err := os.MkdirAll(filepath.Dir(f), 0755); err != nil {
+		return err
+	}
+	if err := ioutil.WriteFile(f, img, 0644); err != nil {
+		return err
+	}
+	if err := tx.Commit(); err != nil {
+		os.Remove(f)
+		return err
+	}
+	return nil
+}
+
+// VersionAnnotations는 버전의 리뷰에 첨부된 그림들을 리뷰 아이디를 키로 하는 맵으로 반환한다.
+func VersionAnnotations(db *sql.DB, prj, shot, task string, version int) (map[string]*Annotation, error) {
+	return VersionAnnotationsContext(context.Background(), db, prj, shot, task, version)
+}
+
+// VersionAnnotationsContext는 ctx를 받는 VersionAnnotations이다.
+func VersionAnnotationsContext(ctx context.Context, db *sql.DB, prj, shot, task string, version int) (map[string]*Annotation, error) {
+	keystr := strings.Join(AnnotationTableKeys, ", ")
+	stmt := fmt.Sprintf("SELECT %s FROM annotations WHERE project=$1 AND review_id LIKE $2", keystr)
+	rows, err := dbQuery(ctx, db, stmt, prj, escapeLike(versionSearchTarget(shot, task, version)+".")+"%")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	as := make(map[string]*Annotation)
+	for rows.Next() {
+		a := &Annotation{}
+		var strokes string
+		if err := rows.Scan(&a.Project, &a.ReviewID, &a.Source, &a.Frame, &strokes); err != nil {
+			return nil, err
+		}
+		if err := json.Unmarshal([]byte(strokes), &a.Strokes); err != nil {
+			return nil, fmt.Errorf("could not decode annotation strokes of %s: %w", a.ReviewID, err)
+		}
+		as[a.ReviewID] = a
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return as, nil
+}
@@ -0,0 +1,122 @@
+package roi
+
+import (
+	"bytes"
+	"image"
+	"image/png"
+	"io/ioutil"
+	"os"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestCheckAnnotationStrokes(t *testing.T) {
+	cases := []struct {
+		strokes []AnnotationStroke
+		ok      bool
+	}{
+		{strokes: nil, ok: false},
+		{strokes: []AnnotationStroke{{Color: "#FF0000", Width: 0.01, Points: [][2]float64{{0, 0}, {1, 1}}}}, ok: true},
+		{strokes: []AnnotationStroke{{Color: "#FF0000", Width: 0, Points: [][2]float64{{0, 0}}}}, ok: false},
+		{strokes: []AnnotationStroke{{Color: "#FF0000", Width: 0.01}}, ok: false},
+		{strokes: []AnnotationStroke{{Color: "#FF0000", Width: 0.01, Points: [][2]float64{{0.5, 1.5}}}}, ok: false},
+	}
+	for _, c := range cases {
+		err := checkAnnotationStrokes(c.strokes)
+		if (err == nil) != c.ok {
+			t.Fatalf("checkAnnotationStrokes(%v): got err %v, want ok %v", c.strokes, err, c.ok)
+		}
+	}
+}
+
+func TestAnnotationImageURLPath(t *testing.T) {
+	cases := []struct {
+		prj      string
+		reviewID string
+		want     string
+	}{
+		{prj: "TEST", reviewID: "CG_0010.fx_fire.v001.r1", want: "TEST/CG_0010/fx_fire/v001/CG_0010.fx_fire.v001.r1.png"},
+		{prj: "TEST", reviewID: "CG_0010.fx_fire.v001", want: ""},
+	}
+	for _, c := range cases {
+		got := AnnotationImageURLPath(c.prj, c.reviewID)
+		if got != c.want {
+			t.Fatalf("AnnotationImageURLPath(%q, %q): got %q, want %q", c.prj, c.reviewID, got, c.want)
+		}
+	}
+}
+
+func TestAnnotation(t *testing.T) {
+	db, err := testDB()
+	if err != nil {
+		t.Fatalf("could not connect to database: %v", err)
+	}
+	dir, err := ioutil.TempDir("", "roi-annotation-")
+	if err != nil {
+		t.Fatalf("could not create temp dir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+	userDataDir := UserDataDir
+	UserDataDir = dir
+	defer func() { UserDataDir = userDataDir }()
+
+	err = AddProject(db, testProject)
+	if err != nil {
+		t.Fatalf("could not add project: %v", err)
+	}
+	err = AddShot(db, testProject.Project, testShotA)
+	if err != nil {
+		t.Fatalf("could not add shot: %v", err)
+	}
+	err = AddTask(db, testProject.Project, testShotA.Shot, testTaskA)
+	if err != nil {
+		t.Fatalf("could not add task: %v", err)
+	}
+	v := &Version{Created: time.Now()}
+	err = AddVersion(db, testProject.Project, testShotA.Shot, testTaskA.Task, v)
+	if err != nil {
+		t.Fatalf("could not add version: %v", err)
+	}
+	buf := &bytes.Buffer{}
+	err = png.Encode(buf, image.NewRGBA(image.Rect(0, 0, 4, 4)))
+	if err != nil {
+		t.Fatalf("could not encode png: %v", err)
+	}
+	r := &Review{
+		ProjectID: testProject.Project,
+		OutputID:  versionSearchTarget(testShotA.Shot, testTaskA.Task, v.Version),
+		UserID:    "supervisor",
+		Msg:       "불꽃을 더 크게",
+		Time:      time.Now(),
+	}
+	a := &Annotation{
+		Source:  "/show/TEST/CG_0010/fx_fire.mov",
+		Frame:   12,
+		Strokes: []AnnotationStroke{{Color: "#FF0000", Width: 0.01, Points: [][2]float64{{0.1, 0.2}, {0.3, 0.4}}}},
+	}
+	err = AddAnnotatedReview(db, r, a, []byte("not a png"))
+	checkErrorKind(t, err, ErrInvalid)
+	err = AddAnnotatedReview(db, r, a, buf.Bytes())
+	if err != nil {
+		t.Fatalf("could not add annotated review: %v", err)
+	}
+	if _, err := os.Stat(annotationImageFile(r.ProjectID, r.ID)); err != nil {
+		t.Fatalf("annotation image not saved: %v", err)
+	}
+	as, err := VersionAnnotations(db, testProject.Project, testShotA.Shot, testTaskA.Task, v.Version)
+	if err != nil {
+		t.Fatalf("could not get version annotations: %v", err)
+	}
+	got := as[r.ID]
+	if got == nil {
+		t.Fatalf("annotation of review %s not found", r.ID)
+	}
+	if !reflect.DeepEqual(got, a) {
+		t.Fatalf("annotation: got %v, want %v", got, a)
+	}
+	err = DeleteProject(db, testProject.Project)
+	if err != nil {
+		t.Fatalf("could not delete project: %v", err)
+	}
+}
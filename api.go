@@ -4,4 +4,8 @@ package roi
 type APIResponse struct {
 	Msg string `json:"msg"`
 	Err string `json:"err"`
+	// Fields는 입력 검증에 실패한 필드별 에러 메시지이다. 키는 질의의 필드 이름이다.
+	Fields map[string]string `json:"fields,omitempty"`
+	// Data는 질의 결과로 돌려줄 데이터가 있을 때 사용한다.
+	Data interface{} `json:"data,omitempty"`
 }
@@ -0,0 +1,620 @@
+package roi
+
+import (
+	"archive/zip"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// ProjectArchiveVersion은 프로젝트 묶음 형식의 버전이다.
+// 형식이 바뀌어 예전 묶음을 그대로 풀 수 없게 되면 올려야 한다.
+const ProjectArchiveVersion = 1
+
+var CreateTableIfNotExistsArchivedProjectsStmt = `CREATE TABLE IF NOT EXISTS archived_projects (
+	uniqid UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+	project STRING NOT NULL UNIQUE CHECK (length(project) > 0) CHECK (project NOT LIKE '% %'),
+	archived TIMESTAMPTZ NOT NULL,
+	bundle STRING NOT NULL
+)`
+
+// ArchivedProject는 보관된 프로젝트의 기록이다.
+// 보관된 프로젝트의 데이터는 db에 남아 있지만 프로젝트 목록과 검색에서 숨겨진다.
+type ArchivedProject struct {
+	Project  string
+	Archived time.Time
+	// Bundle은 프로젝트를 보관할 때 만든 묶음 파일의 경로이다.
+	Bundle string
+}
+
+// ArchiveDir는 ArchiveProject가 묶음 파일을 만들 수 있는 디렉토리이다.
+// 사용자가 서버의 아무 곳에나 파일을 만들지 못하도록 묶음 파일은 이 디렉토리 아래에만 만든다.
+// 비어 있으면 묶음 파일을 만들 수 없다.
+var ArchiveDir string
+
+// archiveBundlePath는 묶음 파일 경로가 ArchiveDir 아래에 있는지 검사하고 그 절대 경로를 반환한다.
+// 상대 경로는 ArchiveDir를 기준으로 한다. 묶음 파일이 들어갈 디렉토리는 이미 있어야 하며,
+// 심볼릭 링크를 통해 ArchiveDir 밖으로 나가는 경로는 허락되지 않는다.
+func archiveBundlePath(bundle string) (string, error) {
+	if ArchiveDir == "" {
+		return "", errorf(ErrInvalid, "archive dir not configured")
+	}
+	dir, err := filepath.Abs(ArchiveDir)
+	if err != nil {
+		return "", err
+	}
+	pth := bundle
+	if !filepath.IsAbs(pth) {
+		pth = filepath.Join(dir, pth)
+	}
+	pth = filepath.Clean(pth)
+	if pth == dir || !inDir(dir, pth) {
+		return "", errorf(ErrInvalid, "bundle path is not in archive dir: %s", bundle)
+	}
+	rdir, err := filepath.EvalSymlinks(dir)
+	if err != nil {
+		return "", fmt.Errorf("could not find archive dir: %w", err)
+	}
+	rparent, err := filepath.EvalSymlinks(filepath.Dir(pth))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return "", errorf(ErrInvalid, "bundle directory not exist: %s", filepath.Dir(pth))
+		}
+		return "", err
+	}
+	if !inDir(rdir, rparent) {
+		return "", errorf(ErrInvalid, "bundle path is not in archive dir: %s", bundle)
+	}
+	return pth, nil
+}
+
+// archiveTable은 프로젝트 묶음에 포함되는 테이블이다.
+type archiveTable struct {
+	name string
+	// where는 테이블에서 프로젝트에 속한 열을 고르는 조건이며 $1은 프로젝트이다.
+	where string
+	// shared가 참이면 다른 프로젝트와 함께 쓰는 데이터여서, 풀 때 이미 있는 열은 그대로 둔다.
+	shared bool
+}
+
+// archiveTables는 프로젝트 묶음에 포함되는 테이블들이다.
+// 프로젝트 데이터를 담는 테이블이 추가되면 여기에도 추가해야 한다.
+var archiveTables = []archiveTable{
+	{name: "projects", where: "project=$1"},
+	{name: "project_paths", where: "project=$1"},
+	{name: "project_tags", where: "project=$1"},
+	{name: "shots", where: "project=$1"},
+	{name: "shot_aliases", where: "project=$1"},
+	{name: "tasks", where: "project=$1"},
+	{name: "versions", where: "project=$1"},
+	{name: "version_files", where: "project=$1"},
+	{name: "ingest_quarantine", where: "project=$1"},
+	{name: "playlists", where: "project=$1"},
+	{name: "playlist_items", where: "project=$1"},
+	{name: "reviews", where: "project_id=$1"},
+	{name: "annotations", where: "project=$1"},
+	{name: "review_sessions", where: "project=$1"},
+	{name: "review_session_items", where: "project=$1"},
+	{name: "deliveries", where: "project=$1"},
+	{name: "delivery_items", where: "project=$1"},
+	{name: "vendors", where: "vendor IN (SELECT vendor FROM vendor_tasks WHERE project=$1)", shared: true},
+	{name: "vendor_tasks", where: "project=$1"},
+	{name: "notifications", where: "project=$1"},
+	{name: "search_words", where: "project=$1"},
+	{name: "saved_searches", where: "project=$1", shared: true},
+	{name: "trash", where: "project=$1"},
+}
+
+// archiveUserDataKinds는 UserDataDir 아래에서 <종류>/<프로젝트> 디렉토리에
+// 프로젝트의 파일을 저장하는 종류들이다.
+var archiveUserDataKinds = []string{"thumbnail", "version-thumbnail", "annotation"}
+
+// projectArchive는 묶음의 project.json에 기록되는 내용이다.
+type projectArchive struct {
+	Version  int
+	Project  string
+	Archived time.Time
+	Tables   []*archivedRows
+}
+
+// archivedRows는 한 테이블에서 프로젝트에 속한 열들이다.
+// 값은 Types에 기록된 db 타입에 따라 JSON으로 표현된다.
+type archivedRows struct {
+	Table   string
+	Columns []string
+	Types   []string
+	Rows    [][]interface{}
+}
+
+// archiveScanDest는 db 타입에 맞는 Scan 대상을 반환한다.
+func archiveScanDest(typ string) interface{} {
+	switch typ {
+	case "TIMESTAMPTZ", "TIMESTAMP":
+		return new(time.Time)
+	case "INT8", "INT4", "INT2":
+		return new(int64)
+	case "FLOAT8", "FLOAT4":
+		return new(float64)
+	case "BOOL":
+		return new(bool)
+	case "_TEXT", "_VARCHAR":
+		return new(pq.StringArray)
+	}
+	return new(string)
+}
+
+// archiveDBValue는 JSON에서 읽은 값을 db 타입에 맞는 값으로 바꾼다.
+func archiveDBValue(typ string, v interface{}) (interface{}, error) {
+	switch typ {
+	case "TIMESTAMPTZ", "TIMESTAMP":
+		s, ok := v.(string)
+		if !ok {
+			return nil, errorf(ErrInvalid, "invalid time value: %v", v)
+		}
+		return time.Parse(time.RFC3339Nano, s)
+	case "INT8", "INT4", "INT2":
+		n, ok := v.(json.Number)
+		if !ok {
+			return nil, errorf(ErrInvalid, "invalid int value: %v", v)
+		}
+		return n.Int64()
+	case "FLOAT8", "FLOAT4":
+		n, ok := v.(json.Number)
+		if !ok {
+			return nil, errorf(ErrInvalid, "invalid float value: %v", v)
+		}
+		return n.Float64()
+	case "_TEXT", "_VARCHAR":
+		vs, ok := v.([]interface{})
+		if !ok && v != nil {
+			return nil, errorf(ErrInvalid, "invalid array value: %v", v)
+		}
+		ss := make([]string, len(vs))
+		for i, e := range vs {
+			s, ok := e.(string)
+			if !ok {
+				return nil, errorf(ErrInvalid, "invalid array element: %v", e)
+			}
+			ss[i] = s
+		}
+		return pq.Array(ss), nil
+	}
+	return v, nil
+}
+
+// dumpArchiveTable은 테이블에서 where 조건에 맞는 열들을 읽는다.
+func dumpArchiveTable(ctx context.Context, q sqlQueryer, table, where string, args ...interface{}) (*archivedRows, error) {
+	rows, err := dbQuery(ctx, q, fmt.Sprintf("SELECT * FROM %s WHERE %s", table, where), args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	cols, err := rows.ColumnTypes()
+	if err != nil {
+		return nil, err
+	}
+	a := &archivedRows{Table: table, Rows: make([][]interface{}, 0)}
+	for _, c := range cols {
+		a.Columns = append(a.Columns, c.Name())
+		a.Types = append(a.Types, c.DatabaseTypeName())
+	}
+	for rows.Next() {
+		dest := make([]interface{}, len(cols))
+		for i := range dest {
+			dest[i] = archiveScanDest(a.Types[i])
+		}
+		if err := rows.Scan(dest...); err != nil {
+			return nil, fmt.Errorf("could not read %s: %w", table, err)
+		}
+		row := make([]interface{}, len(dest))
+		for i, d := range dest {
+			switch d := d.(type) {
+			case *time.Time:
+				row[i] = d.Format(time.RFC3339Nano)
+			case *pq.StringArray:
+				row[i] = []string(*d)
+			case *int64:
+				row[i] = *d
+			case *float64:
+				row[i] = *d
+			case *bool:
+				row[i] = *d
+			case *string:
+				row[i] = *d
+			}
+		}
+		a.Rows = append(a.Rows, row)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return a, nil
+}
+
+// WriteProjectArchive는 프로젝트의 모든 데이터와 썸네일 등 사용자 데이터 파일을
+// 다른 로이에서도 풀 수 있는 zip 묶음으로 w에 쓴다.
+// 묶음에는 db 데이터를 담은 project.json과 userdata/ 아래의 파일들이 들어간다.
+func WriteProjectArchive(db *sql.DB, w io.Writer, prj string) error {
+	return WriteProjectArchiveContext(context.Background(), db, w, prj)
+}
+
+// WriteProjectArchiveContext는 ctx를 받는 WriteProjectArchive이다.
+func WriteProjectArchiveContext(ctx context.Context, db *sql.DB, w io.Writer, prj string) error {
+	exist, err := ProjectExistContext(ctx, db, prj)
+	if err != nil {
+		return err
+	}
+	if !exist {
+		return errorf(ErrNotFound, "project not exist: %s", prj)
+	}
+	a := &projectArchive{
+		Version:  ProjectArchiveVersion,
+		Project:  prj,
+		Archived: time.Now(),
+	}
+	for _, t := range archiveTables {
+		rows, err := dumpArchiveTable(ctx, db, t.name, t.where, prj)
+		if err != nil {
+			return err
+		}
+		a.Tables = append(a.Tables, rows)
+	}
+	zw := zip.NewWriter(w)
+	f, err := zw.Create("project.json")
+	if err != nil {
+		return err
+	}
+	enc := json.NewEncoder(f)
+	enc.SetIndent("", "\t")
+	if err := enc.Encode(a); err != nil {
+		return err
+	}
+	for _, kind := range archiveUserDataKinds {
+		root := filepath.Join(UserDataDir, kind, prj)
+		err := filepath.Walk(root, func(p string, fi os.FileInfo, err error) error {
+			if err != nil {
+				if os.IsNotExist(err) && p == root {
+					return nil
+				}
+				return err
+			}
+			if fi.IsDir() {
+				return nil
+			}
+			rel, err := filepath.Rel(UserDataDir, p)
+			if err != nil {
+				return err
+			}
+			zf, err := zw.Create(path.Join("userdata", filepath.ToSlash(rel)))
+			if err != nil {
+				return err
+			}
+			src, err := os.Open(p)
+			if err != nil {
+				return err
+			}
+			defer src.Close()
+			_, err = io.Copy(zf, src)
+			return err
+		})
+		if err != nil {
+			return fmt.Errorf("could not archive %s files: %w", kind, err)
+		}
+	}
+	return zw.Close()
+}
+
+// ArchiveProject는 프로젝트를 bundle 경로의 묶음 파일로 내보낸 뒤 보관된 프로젝트로 기록한다.
+// bundle은 ArchiveDir 아래의 경로여야 하며, 상대 경로는 ArchiveDir를 기준으로 한다.
+// 보관된 프로젝트는 AllProjects와 검색에서 숨겨지며 UnarchiveProject로 되돌릴 수 있다.
+// 묶음 파일이 이미 있다면 덮어쓰지 않고 에러를 반환한다.
+func ArchiveProject(db *sql.DB, prj, bundle string) error {
+	return ArchiveProjectContext(context.Background(), db, prj, bundle)
+}
+
+// ArchiveProjectContext는 ctx를 받는 ArchiveProject이다.
+func ArchiveProjectContext(ctx context.Context, db *sql.DB, prj, bundle string) error {
+	archived, err := ProjectArchivedContext(ctx, db, prj)
+	if err != nil {
+		return err
+	}
+	if archived {
+		return errorf(ErrExists, "project already archived: %s", prj)
+	}
+	bundle, err = archiveBundlePath(bundle)
+	if err != nil {
+		return err
+	}
+	f, err := os.OpenFile(bundle, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644)
+	if err != nil {
+		return err
+	}
+	err = WriteProjectArchiveContext(ctx, db, f, prj)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		os.Remove(bundle)
+		return err
+	}
+	_, err = dbExec(ctx, db, "INSERT INTO archived_projects (project, archived, bundle) VALUES ($1, $2, $3)", prj, time.Now(), bundle)
+	if err != nil {
+		os.Remove(bundle)
+		return fmt.Errorf("could not insert data into 'archived_projects' table: %w", err)
+	}
+	return nil
+}
+
+// UnarchiveProject는 보관된 프로젝트를 다시 프로젝트 목록과 검색에 보이게 한다.
+// 묶음 파일은 지우지 않는다.
+func UnarchiveProject(db *sql.DB, prj string) error {
+	return UnarchiveProjectContext(context.Background(), db, prj)
+}
+
+// UnarchiveProjectContext는 ctx를 받는 UnarchiveProject이다.
+func UnarchiveProjectContext(ctx context.Context, db *sql.DB, prj string) error {
+	if _, err := dbExec(ctx, db, "DELETE FROM archived_projects WHERE project=$1", prj); err != nil {
+		return fmt.Errorf("could not delete data from 'archived_projects' table: %w", err)
+	}
+	return nil
+}
+
+// ProjectArchived는 프로젝트가 보관되었는지를 반환한다.
+func ProjectArchived(db *sql.DB, prj string) (bool, error) {
+	return ProjectArchivedContext(context.Background(), db, prj)
+}
+
+// ProjectArchivedContext는 ctx를 받는 ProjectArchived이다.
+func ProjectArchivedContext(ctx context.Context, db *sql.DB, prj string) (bool, error) {
+	rows, err := dbQuery(ctx, db, "SELECT project FROM archived_projects WHERE project=$1 LIMIT 1", prj)
+	if err != nil {
+		return false, err
+	}
+	defer rows.Close()
+	return rows.Next(), nil
+}
+
+// ArchivedProjects는 보관된 프로젝트들을 최근에 보관된 순서로 반환한다.
+func ArchivedProjects(db *sql.DB) ([]*ArchivedProject, error) {
+	return ArchivedProjectsContext(context.Background(), db)
+}
+
+// ArchivedProjectsContext는 ctx를 받는 ArchivedProjects이다.
+func ArchivedProjectsContext(ctx context.Context, db *sql.DB) ([]*ArchivedProject, error) {
+	rows, err := dbQuery(ctx, db, "SELECT project, archived, bundle FROM archived_projects ORDER BY archived DESC")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	as := make([]*ArchivedProject, 0)
+	for rows.Next() {
+		a := &ArchivedProject{}
+		if err := rows.Scan(&a.Project, &a.Archived, &a.Bundle); err != nil {
+			return nil, err
+		}
+		as = append(as, a)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return as, nil
+}
+
+// readProjectArchive는 zip 묶음에서 project.json을 읽는다.
+func readProjectArchive(zr *zip.Reader) (*projectArchive, error) {
+	for _, zf := range zr.File {
+		if zf.Name != "project.json" {
+			continue
+		}
+		f, err := zf.Open()
+		if err != nil {
+			return nil, err
+		}
+		defer f.Close()
+		dec := json.NewDecoder(f)
+		dec.UseNumber()
+		a := &projectArchive{}
+		if err := dec.Decode(a); err != nil {
+			return nil, fmt.Errorf("could not decode project.json: %w", err)
+		}
+		if a.Version != ProjectArchiveVersion {
+			return nil, errorf(ErrInvalid, "unsupported project archive version: %d", a.Version)
+		}
+		if !IsValidProject(a.Project) {
+			return nil, errorf(ErrInvalid, "invalid project in archive: %s", a.Project)
+		}
+		return a, nil
+	}
+	return nil, errorf(ErrInvalid, "project.json not found in archive")
+}
+
+// restoreArchivedRows는 트랜잭션 안에서 묶음의 한 테이블 열들을 db에 넣는다.
+// 다른 프로젝트의 열이 섞여 있다면 에러를 반환한다.
+func restoreArchivedRows(ctx context.Context, tx *sql.Tx, prj string, rows *archivedRows) error {
+	var t *archiveTable
+	for i := range archiveTables {
+		if archiveTables[i].name == rows.Table {
+			t = &archiveTables[i]
+			break
+		}
+	}
+	if t == nil {
+		return errorf(ErrInvalid, "unknown table in archive: %s", rows.Table)
+	}
+	return insertArchivedRows(ctx, tx, rows, prj, t.shared)
+}
+
+// reValidColumn은 묶음에 기록된 열 이름으로 적절한지 검사한다.
+// 열 이름은 구문에 그대로 들어가기 때문에 반드시 검사해야 한다.
+var reValidColumn = regexp.MustCompile(`^[a-z_][a-z0-9_]*$`)
+
+// archiveProjectColumn은 열들 중 프로젝트를 나타내는 열의 위치를 반환한다. 없으면 -1을 반환한다.
+func archiveProjectColumn(table string, columns []string) int {
+	for i, c := range columns {
+		if c == "project" || (table == "reviews" && c == "project_id") {
+			return i
+		}
+	}
+	return -1
+}
+
+// insertArchivedRows는 트랜잭션 안에서 묶음의 한 테이블 열들을 db에 넣는다.
+// prj가 비어 있지 않으면 다른 프로젝트의 열이 섞여 있을 때 에러를 반환하며,
+// ignoreConflict가 참이면 이미 있는 열은 그대로 둔다.
+func insertArchivedRows(ctx context.Context, tx *sql.Tx, rows *archivedRows, prj string, ignoreConflict bool) error {
+	if len(rows.Columns) != len(rows.Types) {
+		return errorf(ErrInvalid, "invalid columns of %s in archive", rows.Table)
+	}
+	for _, c := range rows.Columns {
+		if !reValidColumn.MatchString(c) {
+			return errorf(ErrInvalid, "invalid column of %s in archive: %s", rows.Table, c)
+		}
+	}
+	prjCol := archiveProjectColumn(rows.Table, rows.Columns)
+	stmt := fmt.Sprintf("INSERT INTO %s (%s) VALUES (%s)", rows.Table, strings.Join(rows.Columns, ", "), strings.Join(dbIndices(rows.Columns), ", "))
+	if ignoreConflict {
+		stmt += " ON CONFLICT DO NOTHING"
+	}
+	for _, row := range rows.Rows {
+		if len(row) != len(rows.Columns) {
+			return errorf(ErrInvalid, "invalid row of %s in archive", rows.Table)
+		}
+		if prj != "" && prjCol >= 0 && row[prjCol] != prj {
+			return errorf(ErrInvalid, "%s row of other project in archive: %v", rows.Table, row[prjCol])
+		}
+		vals := make([]interface{}, len(row))
+		for i, v := range row {
+			val, err := archiveDBValue(rows.Types[i], v)
+			if err != nil {
+				return errorf(ErrInvalid, "invalid %s.%s in archive: %w", rows.Table, rows.Columns[i], err)
+			}
+			vals[i] = val
+		}
+		if _, err := dbExec(ctx, tx, stmt, vals...); err != nil {
+			return fmt.Errorf("could not restore %s: %w", rows.Table, err)
+		}
+	}
+	return nil
+}
+
+// restoreUserData는 묶음의 userdata/ 아래 파일들을 UserDataDir 아래에 푼다.
+// 프로젝트의 사용자 데이터 디렉토리 밖으로 나가는 파일은 풀지 않고 에러를 반환한다.
+func restoreUserData(zr *zip.Reader, prj string) error {
+	for _, zf := range zr.File {
+		if !strings.HasPrefix(zf.Name, "userdata/") || strings.HasSuffix(zf.Name, "/") {
+			continue
+		}
+		rel := path.Clean(strings.TrimPrefix(zf.Name, "userdata/"))
+		ok := false
+		for _, kind := range archiveUserDataKinds {
+			if strings.HasPrefix(rel, kind+"/"+prj+"/") {
+				ok = true
+				break
+			}
+		}
+		if !ok {
+			return errorf(ErrInvalid, "invalid file in archive: %s", zf.Name)
+		}
+		dst := filepath.Join(UserDataDir, filepath.FromSlash(rel))
+		if err := os.MkdirAll(filepath.Dir(dst), 0755); err != nil {
+			return err
+		}
+		src, err := zf.Open()
+		if err != nil {
+			return err
+		}
+		f, err := os.Create(dst)
+		if err != nil {
+			src.Close()
+			return err
+		}
+		_, err = io.Copy(f, src)
+		src.Close()
+		if cerr := f.Close(); err == nil {
+			err = cerr
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// RestoreProject는 ArchiveProject나 WriteProjectArchive로 만든 묶음 파일에서 프로젝트를 db에 되살리고
+// 되살린 프로젝트 이름을 반환한다. 같은 로이뿐 아니라 다른 로이에서 만든 묶음도 되살릴 수 있다.
+// 같은 이름의 프로젝트가 이미 있다면 에러를 반환한다. 보관된 채 db에 남아 있는 프로젝트는
+// UnarchiveProject로 되돌리거나 DeleteProject로 지운 후 되살려야 한다.
+// 만일 처리 중간에 에러가 나면 db에는 아무것도 추가하지 않고 에러를 반환한다.
+func RestoreProject(db *sql.DB, bundle string) (string, error) {
+	return RestoreProjectContext(context.Background(), db, bundle)
+}
+
+// RestoreProjectContext는 ctx를 받는 RestoreProject이다.
+func RestoreProjectContext(ctx context.Context, db *sql.DB, bundle string) (string, error) {
+	zr, err := zip.OpenReader(bundle)
+	if err != nil {
+		return "", err
+	}
+	defer zr.Close()
+	return restoreProject(ctx, db, &zr.Reader)
+}
+
+// RestoreProjectFrom은 RestoreProject와 같지만 파일 대신 r에서 size 크기의 묶음을 읽는다.
+// 사용자가 올린 묶음 파일에서 프로젝트를 되살릴 때 사용한다.
+func RestoreProjectFrom(db *sql.DB, r io.ReaderAt, size int64) (string, error) {
+	return RestoreProjectFromContext(context.Background(), db, r, size)
+}
+
+// RestoreProjectFromContext는 ctx를 받는 RestoreProjectFrom이다.
+func RestoreProjectFromContext(ctx context.Context, db *sql.DB, r io.ReaderAt, size int64) (string, error) {
+	zr, err := zip.NewReader(r, size)
+	if err != nil {
+		return "", errorf(ErrInvalid, "invalid project bundle: %w", err)
+	}
+	return restoreProject(ctx, db, zr)
+}
+
+// restoreProject는 묶음에서 프로젝트를 db에 되살리고 되살린 프로젝트 이름을 반환한다.
+func restoreProject(ctx context.Context, db *sql.DB, zr *zip.Reader) (string, error) {
+	a, err := readProjectArchive(zr)
+	if err != nil {
+		return "", err
+	}
+	exist, err := ProjectExistContext(ctx, db, a.Project)
+	if err != nil {
+		return "", err
+	}
+	if exist {
+		return "", errorf(ErrExists, "project already exist: %s", a.Project)
+	}
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return "", fmt.Errorf("could not begin a transaction: %w", err)
+	}
+	defer tx.Rollback() // 트랜잭션이 완료되지 않았을 때만 실행됨
+	for _, rows := range a.Tables {
+		if err := restoreArchivedRows(ctx, tx, a.Project, rows); err != nil {
+			return "", err
+		}
+	}
+	if _, err := dbExec(ctx, tx, "DELETE FROM archived_projects WHERE project=$1", a.Project); err != nil {
+		return "", fmt.Errorf("could not delete data from 'archived_projects' table: %w", err)
+	}
+	if err := restoreUserData(zr, a.Project); err != nil {
+		return "", fmt.Errorf("could not restore user data: %w", err)
+	}
+	if err := tx.Commit(); err != nil {
+		return "", err
+	}
+	return a.Project, nil
+}
@@ -0,0 +1,198 @@
+package roi
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+func TestArchiveDBValue(t *testing.T) {
+	tm := time.Date(2020, 10, 19, 13, 30, 0, 0, time.UTC)
+	row := []interface{}{tm.Format(time.RFC3339Nano), int64(3), true, []string{"a", "b"}, "CG_0010"}
+	types := []string{"TIMESTAMPTZ", "INT8", "BOOL", "_TEXT", "TEXT"}
+	data, err := json.Marshal(row)
+	if err != nil {
+		t.Fatal(err)
+	}
+	dec := json.NewDecoder(strings.NewReader(string(data)))
+	dec.UseNumber()
+	var got []interface{}
+	if err := dec.Decode(&got); err != nil {
+		t.Fatal(err)
+	}
+	want := []interface{}{tm, int64(3), true, pq.Array([]string{"a", "b"}), "CG_0010"}
+	for i := range got {
+		v, err := archiveDBValue(types[i], got[i])
+		if err != nil {
+			t.Fatalf("archiveDBValue(%s, %v): %v", types[i], got[i], err)
+		}
+		if !reflect.DeepEqual(v, want[i]) {
+			t.Fatalf("archiveDBValue(%s, %v): got %v, want %v", types[i], got[i], v, want[i])
+		}
+	}
+	if _, err := archiveDBValue("INT8", "3"); err == nil {
+		t.Fatalf("string should not be converted to int")
+	}
+}
+
+func TestArchiveBundlePath(t *testing.T) {
+	dir, err := ioutil.TempDir("", "roi-archive-")
+	if err != nil {
+		t.Fatalf("could not create temp dir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+	outside, err := ioutil.TempDir("", "roi-outside-")
+	if err != nil {
+		t.Fatalf("could not create temp dir: %v", err)
+	}
+	defer os.RemoveAll(outside)
+	if err := os.Symlink(outside, filepath.Join(dir, "link")); err != nil {
+		t.Fatal(err)
+	}
+	archiveDir := ArchiveDir
+	defer func() { ArchiveDir = archiveDir }()
+
+	ArchiveDir = ""
+	_, err = archiveBundlePath(filepath.Join(dir, "TEST.roi.zip"))
+	checkErrorKind(t, err, ErrInvalid)
+
+	ArchiveDir = dir
+	cases := []struct {
+		bundle string
+		want   string
+		kind   error
+	}{
+		{"TEST.roi.zip", filepath.Join(dir, "TEST.roi.zip"), nil},
+		{filepath.Join(dir, "TEST.roi.zip"), filepath.Join(dir, "TEST.roi.zip"), nil},
+		{filepath.Join(outside, "TEST.roi.zip"), "", ErrInvalid},
+		{"../TEST.roi.zip", "", ErrInvalid},
+		{".", "", ErrInvalid},
+		{"link/TEST.roi.zip", "", ErrInvalid},
+		{"nodir/TEST.roi.zip", "", ErrInvalid},
+	}
+	for _, c := range cases {
+		got, err := archiveBundlePath(c.bundle)
+		if c.kind != nil {
+			checkErrorKind(t, err, c.kind)
+			continue
+		}
+		if err != nil {
+			t.Fatalf("%s: %v", c.bundle, err)
+		}
+		if got != c.want {
+			t.Fatalf("%s: got %s, want %s", c.bundle, got, c.want)
+		}
+	}
+}
+
+func TestArchiveProject(t *testing.T) {
+	db, err := testDB()
+	if err != nil {
+		t.Fatalf("could not connect to database: %v", err)
+	}
+	dir, err := ioutil.TempDir("", "roi-archive-")
+	if err != nil {
+		t.Fatalf("could not create temp dir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+	userDataDir := UserDataDir
+	UserDataDir = filepath.Join(dir, "roi-userdata")
+	defer func() { UserDataDir = userDataDir }()
+	archiveDir := ArchiveDir
+	ArchiveDir = dir
+	defer func() { ArchiveDir = archiveDir }()
+
+	err = AddProject(db, testProject)
+	if err != nil {
+		t.Fatalf("could not add project: %v", err)
+	}
+	err = AddShot(db, testProject.Project, testShotA)
+	if err != nil {
+		t.Fatalf("could not add shot: %v", err)
+	}
+	err = AddTask(db, testProject.Project, testShotA.Shot, testTaskA)
+	if err != nil {
+		t.Fatalf("could not add task: %v", err)
+	}
+	thumb := ThumbnailFile(testProject.Project, testShotA.Shot, "small")
+	if err := os.MkdirAll(filepath.Dir(thumb), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(thumb, []byte("png"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	bundle := filepath.Join(dir, testProject.Project+".roi.zip")
+	err = ArchiveProject(db, testProject.Project, bundle)
+	if err != nil {
+		t.Fatalf("could not archive project: %v", err)
+	}
+	prjs, err := AllProjects(db)
+	if err != nil {
+		t.Fatalf("could not get projects: %v", err)
+	}
+	for _, p := range prjs {
+		if p.Project == testProject.Project {
+			t.Fatalf("archived project should be hidden from projects")
+		}
+	}
+	found, err := FullTextSearch(db, testShotA.Shot, "", 0)
+	if err != nil {
+		t.Fatalf("could not search: %v", err)
+	}
+	if len(found) != 0 {
+		t.Fatalf("archived project should be hidden from search: %v", found)
+	}
+	// 보관된 프로젝트는 db에 남아 있으므로 바로 되살릴 수 없다.
+	_, err = RestoreProject(db, bundle)
+	if err == nil {
+		t.Fatalf("project should not be restored over existing one")
+	}
+
+	err = DeleteProject(db, testProject.Project)
+	if err != nil {
+		t.Fatalf("could not delete project: %v", err)
+	}
+	if _, err := os.Stat(thumb); !os.IsNotExist(err) {
+		t.Fatalf("thumbnail should be deleted with project: %v", err)
+	}
+	prj, err := RestoreProject(db, bundle)
+	if err != nil {
+		t.Fatalf("could not restore project: %v", err)
+	}
+	if prj != testProject.Project {
+		t.Fatalf("restored project: got %s, want %s", prj, testProject.Project)
+	}
+	p, err := GetProject(db, prj)
+	if err != nil {
+		t.Fatalf("could not get restored project: %v", err)
+	}
+	if !reflect.DeepEqual(p, testProject) {
+		t.Fatalf("restored project: got %v, want %v", p, testProject)
+	}
+	task, err := GetTask(db, prj, testShotA.Shot, testTaskA.Task)
+	if err != nil {
+		t.Fatalf("could not get restored task: %v", err)
+	}
+	if task == nil || task.Assignee != testTaskA.Assignee {
+		t.Fatalf("unexpected restored task: %v", task)
+	}
+	data, err := ioutil.ReadFile(thumb)
+	if err != nil {
+		t.Fatalf("thumbnail not restored: %v", err)
+	}
+	if string(data) != "png" {
+		t.Fatalf("restored thumbnail content differs: %q", data)
+	}
+	err = DeleteProject(db, prj)
+	if err != nil {
+		t.Fatalf("could not delete project: %v", err)
+	}
+}
@@ -0,0 +1,567 @@
+package roi
+
+import (
+	"archive/zip"
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// BackupVersion은 백업 파일 형식의 버전이다.
+// 형식이 바뀌어 예전 백업을 그대로 되살릴 수 없게 되면 올려야 한다.
+const BackupVersion = 1
+
+// backupTables는 전체 백업에 포함되는 테이블들이다.
+// 되살릴 때 이 순서대로 열을 넣고, 역순으로 기존 열을 지운다.
+// InitDB에서 만드는 테이블이 추가되면 여기에도 추가해야 한다.
+// 단, 로그인 세션을 담는 sessions 테이블은 되살리면 이미 로그아웃한 세션이 살아나므로 포함하지 않는다.
+var backupTables = []string{
+	"projects",
+	"shots",
+	"shot_aliases",
+	"tasks",
+	"versions",
+	"project_paths",
+	"project_tags",
+	"project_templates",
+	"archived_projects",
+	"version_files",
+	"ingest_quarantine",
+	"playlists",
+	"playlist_items",
+	"reviews",
+	"annotations",
+	"review_sessions",
+	"review_session_items",
+	"deliveries",
+	"delivery_items",
+	"vendors",
+	"vendor_tasks",
+	"notifications",
+	"trash",
+	"users",
+	"search_words",
+	"saved_searches",
+	"dashboards",
+}
+
+// BackupManifest는 백업 파일의 manifest.json에 기록되는 내용이다.
+type BackupManifest struct {
+	Version       int
+	SchemaVersion int
+	Created       time.Time
+	// Project가 비어 있지 않으면 해당 프로젝트만 백업한 것이다.
+	Project string
+	Files   []*BackupFile
+}
+
+// BackupFile은 백업 파일에 들어 있는 파일 하나의 기록이다.
+// 되살리기 전에 크기와 체크섬으로 백업 파일이 손상되지 않았는지 검사한다.
+type BackupFile struct {
+	Name   string
+	Size   int64
+	SHA256 string
+}
+
+// backupTableFile은 백업 파일 안에서 테이블 데이터를 담는 파일의 이름이다.
+func backupTableFile(table string) string {
+	return "tables/" + table + ".json"
+}
+
+// addBackupFile은 zip에 name 파일을 만들어 write로 내용을 쓰고 그 기록을 반환한다.
+func addBackupFile(zw *zip.Writer, name string, write func(w io.Writer) error) (*BackupFile, error) {
+	f, err := zw.Create(name)
+	if err != nil {
+		return nil, err
+	}
+	h := sha256.New()
+	c := &countWriter{}
+	if err := write(io.MultiWriter(f, h, c)); err != nil {
+		return nil, err
+	}
+	return &BackupFile{Name: name, Size: c.n, SHA256: hex.EncodeToString(h.Sum(nil))}, nil
+}
+
+// countWriter는 쓰인 바이트 수를 센다.
+type countWriter struct {
+	n int64
+}
+
+func (c *countWriter) Write(p []byte) (int, error) {
+	c.n += int64(len(p))
+	return len(p), nil
+}
+
+// WriteBackup은 로이의 모든 db 테이블과 UserDataDir의 파일들을 백업 파일로 w에 쓴다.
+// prj가 비어 있지 않으면 해당 프로젝트의 데이터와 파일만 백업한다.
+// db 데이터는 한 트랜잭션 안에서 읽으므로 한 시점의 상태가 기록된다.
+// 사용자 데이터 파일은 트랜잭션과 상관없이 그 뒤에 복사된다.
+func WriteBackup(db *sql.DB, w io.Writer, prj string) error {
+	return WriteBackupContext(context.Background(), db, w, prj)
+}
+
+// WriteBackupContext는 ctx를 받는 WriteBackup이다.
+func WriteBackupContext(ctx context.Context, db *sql.DB, w io.Writer, prj string) error {
+	if prj != "" {
+		exist, err := ProjectExistContext(ctx, db, prj)
+		if err != nil {
+			return err
+		}
+		if !exist {
+			return errorf(ErrNotFound, "project not exist: %s", prj)
+		}
+	}
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("could not begin a transaction: %w", err)
+	}
+	defer tx.Rollback() // 읽기만 하므로 항상 되돌린다
+	m := &BackupManifest{
+		Version:       BackupVersion,
+		SchemaVersion: SchemaVersion,
+		Created:       time.Now(),
+		Project:       prj,
+	}
+	zw := zip.NewWriter(w)
+	writeTable := func(table, where string, args ...interface{}) error {
+		rows, err := dumpArchiveTable(ctx, tx, table, where, args...)
+		if err != nil {
+			return err
+		}
+		bf, err := addBackupFile(zw, backupTableFile(table), func(w io.Writer) error {
+			return json.NewEncoder(w).Encode(rows)
+		})
+		if err != nil {
+			return fmt.Errorf("could not backup %s: %w", table, err)
+		}
+		m.Files = append(m.Files, bf)
+		return nil
+	}
+	if prj == "" {
+		for _, t := range backupTables {
+			if err := writeTable(t, "TRUE"); err != nil {
+				return err
+			}
+		}
+	} else {
+		for _, t := range archiveTables {
+			if err := writeTable(t.name, t.where, prj); err != nil {
+				return err
+			}
+		}
+	}
+	roots := []string{UserDataDir}
+	if prj != "" {
+		roots = nil
+		for _, kind := range archiveUserDataKinds {
+			roots = append(roots, filepath.Join(UserDataDir, kind, prj))
+		}
+	}
+	for _, root := range roots {
+		err := filepath.Walk(root, func(p string, fi os.FileInfo, err error) error {
+			if err != nil {
+				if os.IsNotExist(err) && p == root {
+					return nil
+				}
+				return err
+			}
+			if fi.IsDir() {
+				return nil
+			}
+			rel, err := filepath.Rel(UserDataDir, p)
+			if err != nil {
+				return err
+			}
+			bf, err := addBackupFile(zw, path.Join("userdata", filepath.ToSlash(rel)), func(w io.Writer) error {
+				src, err := os.Open(p)
+				if err != nil {
+					return err
+				}
+				defer src.Close()
+				_, err = io.Copy(w, src)
+				return err
+			})
+			if err != nil {
+				return err
+			}
+			m.Files = append(m.Files, bf)
+			return nil
+		})
+		if err != nil {
+			return fmt.Errorf("could not backup user data: %w", err)
+		}
+	}
+	f, err := zw.Create("manifest.json")
+	if err != nil {
+		return err
+	}
+	enc := json.NewEncoder(f)
+	enc.SetIndent("", "\t")
+	if err := enc.Encode(m); err != nil {
+		return err
+	}
+	return zw.Close()
+}
+
+// Backup은 WriteBackup으로 file 경로에 백업 파일을 만든다.
+// 파일이 이미 있다면 덮어쓰지 않고 에러를 반환한다.
+func Backup(db *sql.DB, file, prj string) error {
+	return BackupContext(context.Background(), db, file, prj)
+}
+
+// BackupContext는 ctx를 받는 Backup이다.
+func BackupContext(ctx context.Context, db *sql.DB, file, prj string) error {
+	f, err := os.OpenFile(file, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644)
+	if err != nil {
+		return err
+	}
+	err = WriteBackupContext(ctx, db, f, prj)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		os.Remove(file)
+		return err
+	}
+	return nil
+}
+
+// readBackupManifest는 백업 파일에서 manifest.json을 읽는다.
+func readBackupManifest(zr *zip.Reader) (*BackupManifest, error) {
+	for _, zf := range zr.File {
+		if zf.Name != "manifest.json" {
+			continue
+		}
+		f, err := zf.Open()
+		if err != nil {
+			return nil, err
+		}
+		defer f.Close()
+		m := &BackupManifest{}
+		if err := json.NewDecoder(f).Decode(m); err != nil {
+			return nil, fmt.Errorf("could not decode manifest.json: %w", err)
+		}
+		if m.Version != BackupVersion {
+			return nil, errorf(ErrInvalid, "unsupported backup version: %d", m.Version)
+		}
+		if m.Project != "" && !IsValidProject(m.Project) {
+			return nil, errorf(ErrInvalid, "invalid project in backup: %s", m.Project)
+		}
+		return m, nil
+	}
+	return nil, errorf(ErrInvalid, "manifest.json not found in backup")
+}
+
+// verifyBackup은 백업 파일의 모든 파일이 manifest.json의 기록과 일치하는지 검사한다.
+// 기록되지 않은 파일이 있거나, 기록된 파일이 없거나, 크기나 체크섬이 다르면 에러를 반환한다.
+func verifyBackup(zr *zip.Reader) (*BackupManifest, error) {
+	m, err := readBackupManifest(zr)
+	if err != nil {
+		return nil, err
+	}
+	files := make(map[string]*BackupFile)
+	for _, bf := range m.Files {
+		if _, ok := files[bf.Name]; ok {
+			return nil, errorf(ErrInvalid, "duplicated file in manifest: %s", bf.Name)
+		}
+		files[bf.Name] = bf
+	}
+	seen := make(map[string]bool)
+	for _, zf := range zr.File {
+		if zf.Name == "manifest.json" || strings.HasSuffix(zf.Name, "/") {
+			continue
+		}
+		bf, ok := files[zf.Name]
+		if !ok {
+			return nil, errorf(ErrInvalid, "file not in manifest: %s", zf.Name)
+		}
+		if seen[zf.Name] {
+			return nil, errorf(ErrInvalid, "duplicated file in backup: %s", zf.Name)
+		}
+		seen[zf.Name] = true
+		f, err := zf.Open()
+		if err != nil {
+			return nil, err
+		}
+		h := sha256.New()
+		n, err := io.Copy(h, f)
+		f.Close()
+		if err != nil {
+			return nil, fmt.Errorf("could not read %s: %w", zf.Name, err)
+		}
+		if n != bf.Size || hex.EncodeToString(h.Sum(nil)) != bf.SHA256 {
+			return nil, errorf(ErrInvalid, "corrupted file in backup: %s", zf.Name)
+		}
+	}
+	for _, bf := range m.Files {
+		if !seen[bf.Name] {
+			return nil, errorf(ErrInvalid, "missing file in backup: %s", bf.Name)
+		}
+	}
+	return m, nil
+}
+
+// VerifyBackup은 백업 파일이 손상되지 않았는지 검사하고 그 manifest를 반환한다.
+func VerifyBackup(file string) (*BackupManifest, error) {
+	zr, err := zip.OpenReader(file)
+	if err != nil {
+		return nil, err
+	}
+	defer zr.Close()
+	return verifyBackup(&zr.Reader)
+}
+
+// readBackupTable은 백업 파일에서 테이블 데이터를 읽는다. 테이블이 백업에 없다면 nil을 반환한다.
+func readBackupTable(zr *zip.Reader, table string) (*archivedRows, error) {
+	name := backupTableFile(table)
+	for _, zf := range zr.File {
+		if zf.Name != name {
+			continue
+		}
+		f, err := zf.Open()
+		if err != nil {
+			return nil, err
+		}
+		defer f.Close()
+		dec := json.NewDecoder(f)
+		dec.UseNumber()
+		rows := &archivedRows{}
+		if err := dec.Decode(rows); err != nil {
+			return nil, errorf(ErrInvalid, "could not decode %s: %w", name, err)
+		}
+		if rows.Table != table {
+			return nil, errorf(ErrInvalid, "unexpected table in %s: %s", name, rows.Table)
+		}
+		return rows, nil
+	}
+	return nil, nil
+}
+
+// filterProjectRows는 전체 백업의 테이블 데이터에서 해당 프로젝트의 열만 남긴다.
+// 프로젝트 열이 없는 테이블은 그대로 둔다.
+func filterProjectRows(rows *archivedRows, prj string) {
+	prjCol := archiveProjectColumn(rows.Table, rows.Columns)
+	if prjCol < 0 {
+		return
+	}
+	filtered := make([][]interface{}, 0)
+	for _, row := range rows.Rows {
+		if prjCol < len(row) && row[prjCol] == prj {
+			filtered = append(filtered, row)
+		}
+	}
+	rows.Rows = filtered
+}
+
+// extractBackupUserData는 백업 파일의 userdata/ 아래 파일들을 dir 아래에 푼다.
+// prj가 비어 있지 않으면 해당 프로젝트의 사용자 데이터 파일만 푼다.
+// dir 밖으로 나가는 파일이 있으면 에러를 반환한다.
+func extractBackupUserData(zr *zip.Reader, dir, prj string) error {
+	for _, zf := range zr.File {
+		if !strings.HasPrefix(zf.Name, "userdata/") || strings.HasSuffix(zf.Name, "/") {
+			continue
+		}
+		rel := path.Clean(strings.TrimPrefix(zf.Name, "userdata/"))
+		if rel == ".." || strings.HasPrefix(rel, "../") || path.IsAbs(rel) {
+			return errorf(ErrInvalid, "invalid file in backup: %s", zf.Name)
+		}
+		if prj != "" {
+			ok := false
+			for _, kind := range archiveUserDataKinds {
+				if strings.HasPrefix(rel, kind+"/"+prj+"/") {
+					ok = true
+					break
+				}
+			}
+			if !ok {
+				continue
+			}
+		}
+		dst := filepath.Join(dir, filepath.FromSlash(rel))
+		if err := os.MkdirAll(filepath.Dir(dst), 0755); err != nil {
+			return err
+		}
+		src, err := zf.Open()
+		if err != nil {
+			return err
+		}
+		f, err := os.Create(dst)
+		if err != nil {
+			src.Close()
+			return err
+		}
+		_, err = io.Copy(f, src)
+		src.Close()
+		if cerr := f.Close(); err == nil {
+			err = cerr
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// swapUserData는 임시 디렉토리 tmp에 풀어둔 사용자 데이터 파일로 UserDataDir의 파일들을 바꾼다.
+// prj가 비어 있으면 UserDataDir 전체를, 아니면 해당 프로젝트의 디렉토리들만 바꾼다.
+func swapUserData(tmp, prj string) error {
+	if prj == "" {
+		old := UserDataDir + ".old"
+		if err := os.RemoveAll(old); err != nil {
+			return err
+		}
+		if err := os.Rename(UserDataDir, old); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		if err := os.Rename(tmp, UserDataDir); err != nil {
+			os.Rename(old, UserDataDir)
+			return err
+		}
+		return os.RemoveAll(old)
+	}
+	for _, kind := range archiveUserDataKinds {
+		dst := filepath.Join(UserDataDir, kind, prj)
+		if err := os.RemoveAll(dst); err != nil {
+			return err
+		}
+		src := filepath.Join(tmp, kind, prj)
+		if _, err := os.Stat(src); os.IsNotExist(err) {
+			continue
+		}
+		if err := os.MkdirAll(filepath.Dir(dst), 0755); err != nil {
+			return err
+		}
+		if err := os.Rename(src, dst); err != nil {
+			return err
+		}
+	}
+	return os.RemoveAll(tmp)
+}
+
+// RestoreBackup은 Backup이나 WriteBackup으로 만든 백업 파일로 db와 사용자 데이터 파일을 되돌리고
+// 백업 파일의 manifest를 반환한다.
+// prj가 비어 있으면 백업된 범위 전체를, 아니면 해당 프로젝트만 되돌린다.
+// 전체를 되돌릴 때는 모든 테이블과 UserDataDir이 백업 시점의 상태로 바뀌며,
+// 프로젝트를 되돌릴 때는 그 프로젝트의 기존 데이터를 지운 뒤 백업의 데이터를 넣는다.
+//
+// 되돌리기 전에 백업 파일의 손상 여부를 검사하며, 지금보다 새로운 스키마에서 만든 백업은 되살리지 않는다.
+// 만일 처리 중간에 에러가 나면 db와 사용자 데이터 파일은 바꾸지 않고 에러를 반환한다.
+func RestoreBackup(db *sql.DB, file, prj string) (*BackupManifest, error) {
+	return RestoreBackupContext(context.Background(), db, file, prj)
+}
+
+// RestoreBackupContext는 ctx를 받는 RestoreBackup이다.
+func RestoreBackupContext(ctx context.Context, db *sql.DB, file, prj string) (*BackupManifest, error) {
+	zr, err := zip.OpenReader(file)
+	if err != nil {
+		return nil, err
+	}
+	defer zr.Close()
+	m, err := verifyBackup(&zr.Reader)
+	if err != nil {
+		return nil, err
+	}
+	if m.SchemaVersion > SchemaVersion {
+		return nil, errorf(ErrInvalid, "backup is made from newer schema version: %d (current %d)", m.SchemaVersion, SchemaVersion)
+	}
+	if prj == "" {
+		prj = m.Project
+	}
+	if m.Project != "" && m.Project != prj {
+		return nil, errorf(ErrNotFound, "backup of project %s does not have project %s", m.Project, prj)
+	}
+	if prj != "" && !IsValidProject(prj) {
+		return nil, errorf(ErrInvalid, "invalid project: %s", prj)
+	}
+	tmp := UserDataDir + ".restore"
+	if err := os.RemoveAll(tmp); err != nil {
+		return nil, err
+	}
+	if err := os.MkdirAll(tmp, 0755); err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(tmp) // 중간에 실패했을 때 남은 임시 파일을 지운다
+	if err := extractBackupUserData(&zr.Reader, tmp, prj); err != nil {
+		return nil, fmt.Errorf("could not extract user data: %w", err)
+	}
+
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, fmt.Errorf("could not begin a transaction: %w", err)
+	}
+	defer tx.Rollback() // 트랜잭션이 완료되지 않았을 때만 실행됨
+	for _, zf := range zr.File {
+		if !strings.HasPrefix(zf.Name, "tables/") {
+			continue
+		}
+		table := strings.TrimSuffix(strings.TrimPrefix(zf.Name, "tables/"), ".json")
+		known := false
+		for _, t := range backupTables {
+			if t == table {
+				known = true
+				break
+			}
+		}
+		if !known {
+			return nil, errorf(ErrInvalid, "unknown table in backup: %s", table)
+		}
+	}
+	if prj == "" {
+		for i := len(backupTables) - 1; i >= 0; i-- {
+			t := backupTables[i]
+			if _, err := dbExec(ctx, tx, "DELETE FROM "+t); err != nil {
+				return nil, fmt.Errorf("could not delete data from '%s' table: %w", t, err)
+			}
+		}
+		for _, t := range backupTables {
+			rows, err := readBackupTable(&zr.Reader, t)
+			if err != nil {
+				return nil, err
+			}
+			if rows == nil {
+				continue
+			}
+			if err := insertArchivedRows(ctx, tx, rows, "", false); err != nil {
+				return nil, err
+			}
+		}
+	} else {
+		if err := deleteProject(ctx, tx, prj); err != nil {
+			return nil, err
+		}
+		for _, t := range archiveTables {
+			rows, err := readBackupTable(&zr.Reader, t.name)
+			if err != nil {
+				return nil, err
+			}
+			if rows == nil {
+				continue
+			}
+			if m.Project == "" {
+				filterProjectRows(rows, prj)
+			}
+			if t.name == "projects" && len(rows.Rows) == 0 {
+				return nil, errorf(ErrNotFound, "project not exist in backup: %s", prj)
+			}
+			if err := restoreArchivedRows(ctx, tx, prj, rows); err != nil {
+				return nil, err
+			}
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	if err := swapUserData(tmp, prj); err != nil {
+		return nil, fmt.Errorf("db restored, but could not restore user data: %w", err)
+	}
+	return m, nil
+}
@@ -0,0 +1,169 @@
+package roi
+
+import (
+	"archive/zip"
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+// writeTestBackup은 files의 내용을 담은 백업 파일을 만든다.
+// corrupt에 있는 파일은 manifest에 기록한 뒤 내용을 바꿔 쓴다.
+func writeTestBackup(t *testing.T, files map[string]string, corrupt string) *zip.Reader {
+	buf := &bytes.Buffer{}
+	zw := zip.NewWriter(buf)
+	m := &BackupManifest{Version: BackupVersion, SchemaVersion: SchemaVersion, Created: time.Now()}
+	for name, content := range files {
+		sum := sha256.Sum256([]byte(content))
+		m.Files = append(m.Files, &BackupFile{Name: name, Size: int64(len(content)), SHA256: hex.EncodeToString(sum[:])})
+		if name == corrupt {
+			content += "!"
+		}
+		f, err := zw.Create(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := io.WriteString(f, content); err != nil {
+			t.Fatal(err)
+		}
+	}
+	f, err := zw.Create("manifest.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := json.NewEncoder(f).Encode(m); err != nil {
+		t.Fatal(err)
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	zr, err := zip.NewReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return zr
+}
+
+func TestVerifyBackup(t *testing.T) {
+	files := map[string]string{
+		"tables/projects.json":                `{"Table":"projects"}`,
+		"userdata/thumbnail/TEST/CG_0010.png": "png",
+	}
+	if _, err := verifyBackup(writeTestBackup(t, files, "")); err != nil {
+		t.Fatalf("could not verify backup: %v", err)
+	}
+	if _, err := verifyBackup(writeTestBackup(t, files, "userdata/thumbnail/TEST/CG_0010.png")); err == nil {
+		t.Fatalf("corrupted backup should not be verified")
+	}
+}
+
+func TestFilterProjectRows(t *testing.T) {
+	rows := &archivedRows{
+		Table:   "reviews",
+		Columns: []string{"id", "project_id"},
+		Types:   []string{"TEXT", "TEXT"},
+		Rows: [][]interface{}{
+			{"CG_0010.fx.v001.r1", "TEST"},
+			{"CG_0010.fx.v001.r1", "OTHER"},
+		},
+	}
+	filterProjectRows(rows, "TEST")
+	want := [][]interface{}{{"CG_0010.fx.v001.r1", "TEST"}}
+	if !reflect.DeepEqual(rows.Rows, want) {
+		t.Fatalf("got %v, want %v", rows.Rows, want)
+	}
+}
+
+func TestBackup(t *testing.T) {
+	db, err := testDB()
+	if err != nil {
+		t.Fatalf("could not connect to database: %v", err)
+	}
+	dir, err := ioutil.TempDir("", "roi-backup-")
+	if err != nil {
+		t.Fatalf("could not create temp dir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+	userDataDir := UserDataDir
+	UserDataDir = filepath.Join(dir, "roi-userdata")
+	defer func() { UserDataDir = userDataDir }()
+
+	prj := testProject.Project
+	err = AddProject(db, testProject)
+	if err != nil {
+		t.Fatalf("could not add project: %v", err)
+	}
+	err = AddShot(db, prj, testShotA)
+	if err != nil {
+		t.Fatalf("could not add shot: %v", err)
+	}
+	err = AddTask(db, prj, testShotA.Shot, testTaskA)
+	if err != nil {
+		t.Fatalf("could not add task: %v", err)
+	}
+	thumb := ThumbnailFile(prj, testShotA.Shot, "small")
+	if err := os.MkdirAll(filepath.Dir(thumb), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(thumb, []byte("png"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	file := filepath.Join(dir, "roi.backup.zip")
+	err = Backup(db, file, prj)
+	if err != nil {
+		t.Fatalf("could not backup: %v", err)
+	}
+	m, err := VerifyBackup(file)
+	if err != nil {
+		t.Fatalf("could not verify backup: %v", err)
+	}
+	if m.Project != prj || m.SchemaVersion != SchemaVersion {
+		t.Fatalf("unexpected backup manifest: %v", m)
+	}
+
+	// 백업 뒤의 변경은 되살릴 때 모두 사라진다.
+	err = DeleteTask(db, prj, testShotA.Shot, testTaskA.Task)
+	if err != nil {
+		t.Fatalf("could not delete task: %v", err)
+	}
+	if err := ioutil.WriteFile(thumb, []byte("jpg"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	_, err = RestoreBackup(db, file, "")
+	if err != nil {
+		t.Fatalf("could not restore backup: %v", err)
+	}
+	task, err := GetTask(db, prj, testShotA.Shot, testTaskA.Task)
+	if err != nil {
+		t.Fatalf("could not get restored task: %v", err)
+	}
+	if task == nil || task.Assignee != testTaskA.Assignee {
+		t.Fatalf("unexpected restored task: %v", task)
+	}
+	data, err := ioutil.ReadFile(thumb)
+	if err != nil {
+		t.Fatalf("thumbnail not restored: %v", err)
+	}
+	if string(data) != "png" {
+		t.Fatalf("restored thumbnail content differs: %q", data)
+	}
+	_, err = RestoreBackup(db, file, "OTHER")
+	if err == nil || !strings.Contains(err.Error(), "does not have project") {
+		t.Fatalf("project backup should not restore other project: %v", err)
+	}
+
+	err = DeleteProject(db, prj)
+	if err != nil {
+		t.Fatalf("could not delete project: %v", err)
+	}
+}
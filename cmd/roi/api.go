@@ -4,7 +4,6 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
-	"log"
 	"net/http"
 	"strconv"
 	"strings"
@@ -21,13 +20,6 @@ func apiOK(w http.ResponseWriter, msg string) {
 	w.Write(resp)
 }
 
-// apiInternalServerError는 내부적인 이유로 api 질의의 처리에 실패했을 때
-// 이를 질의자에게 알린다. (이유는 알리지 않는다.)
-func apiInternalServerError(w http.ResponseWriter) {
-	resp, _ := json.Marshal(roi.APIResponse{Err: "internal error"})
-	http.Error(w, string(resp), http.StatusInternalServerError)
-}
-
 // apiBadRequest는 api 질의에 문제가 있었을 때
 // 그 문제를 apiReponse.Err에 담아 반환한다.
 func apiBadRequest(w http.ResponseWriter, err error) {
@@ -35,18 +27,41 @@ func apiBadRequest(w http.ResponseWriter, err error) {
 		// err 가 nil이어서는 안되지만, 패닉을 일으키는 것보다는 낫다.
 		err = errors.New("error not explained")
 	}
+	resp, _ := json.Marshal(roi.APIResponse{Err: err.Error(), Fields: roi.FieldErrors(err)})
+	http.Error(w, string(resp), http.StatusBadRequest)
+}
+
+// apiUnauthorized는 api 질의에 사용자를 확인할 수 있는 토큰이 없을 때
+// 그 문제를 apiReponse.Err에 담아 반환한다.
+func apiUnauthorized(w http.ResponseWriter, err error) {
+	resp, _ := json.Marshal(roi.APIResponse{Err: err.Error()})
+	http.Error(w, string(resp), http.StatusUnauthorized)
+}
+
+// apiNotFound는 api 질의가 가리키는 항목이 없을 때
+// 그 문제를 apiReponse.Err에 담아 반환한다.
+func apiNotFound(w http.ResponseWriter, err error) {
 	resp, _ := json.Marshal(roi.APIResponse{Err: err.Error()})
-	http.Error(w, string(resp), http.StatusInternalServerError)
+	http.Error(w, string(resp), http.StatusNotFound)
+}
+
+// apiConflict는 api 질의로 추가하려는 항목이 이미 있을 때
+// 그 문제를 apiReponse.Err에 담아 반환한다.
+func apiConflict(w http.ResponseWriter, err error) {
+	resp, _ := json.Marshal(roi.APIResponse{Err: err.Error()})
+	http.Error(w, string(resp), http.StatusConflict)
 }
 
 // addProjectApiHander는 사용자가 api를 통해 프로젝트를 생성할수 있도록 한다.
+// template이 주어지면 해당 프로젝트 템플릿의 설정을, clone_from이 주어지면 해당 프로젝트의 설정을 가져오며,
+// with_shots가 참이면 clone_from 프로젝트의 샷과 태스크도 복사한다.
 // 결과는 roi.APIResponse의 json 형식으로 반환된다.
 func addProjectApiHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
 	w.Header().Set("Content-Type", "application/json")
 	db, err := roi.DB()
 	if err != nil {
-		log.Printf("could not connect to db: %v", err)
-		apiInternalServerError(w)
+		handleError(w, r, fmt.Errorf("could not connect to db: %w", err))
 		return
 	}
 
@@ -55,14 +70,13 @@ func addProjectApiHandler(w http.ResponseWriter, r *http.Request) {
 		apiBadRequest(w, fmt.Errorf("'id' not specified"))
 		return
 	}
-	exist, err := roi.ProjectExist(db, prj)
+	exist, err := roi.ProjectExistContext(ctx, db, prj)
 	if err != nil {
-		log.Printf("could not check project %q exist: %v", prj, err)
-		apiInternalServerError(w)
+		handleError(w, r, fmt.Errorf("could not check project %q exist: %w", prj, err))
 		return
 	}
 	if exist {
-		apiBadRequest(w, fmt.Errorf("project '%s' already exists", prj))
+		apiConflict(w, fmt.Errorf("project '%s' already exists", prj))
 		return
 	}
 	tasks := fields(r.Form.Get("default_tasks"), ",")
@@ -70,10 +84,38 @@ func addProjectApiHandler(w http.ResponseWriter, r *http.Request) {
 		Project:      prj,
 		DefaultTasks: tasks,
 	}
-	err = roi.AddProject(db, p)
+	tmpl := r.PostFormValue("template")
+	src := r.PostFormValue("clone_from")
+	if tmpl != "" && src != "" {
+		apiBadRequest(w, fmt.Errorf("'template' and 'clone_from' cannot be specified together"))
+		return
+	}
+	if tmpl != "" {
+		t, err := roi.GetProjectTemplateContext(ctx, db, tmpl)
+		if err != nil {
+			handleError(w, r, fmt.Errorf("could not get project template %q: %w", tmpl, err))
+			return
+		}
+		if t == nil {
+			apiNotFound(w, fmt.Errorf("project template '%s' not exists", tmpl))
+			return
+		}
+	}
+	if src != "" {
+		exist, err := roi.ProjectExistContext(ctx, db, src)
+		if err != nil {
+			handleError(w, r, fmt.Errorf("could not check project %q exist: %w", src, err))
+			return
+		}
+		if !exist {
+			apiNotFound(w, fmt.Errorf("project '%s' not exists", src))
+			return
+		}
+	}
+	withShots, _ := strconv.ParseBool(r.PostFormValue("with_shots"))
+	err = addProjectFrom(ctx, db, p, tmpl, src, withShots)
 	if err != nil {
-		log.Printf("could not add project: %v", err)
-		apiInternalServerError(w)
+		handleError(w, r, fmt.Errorf("could not add project: %w", err))
 		return
 	}
 	apiOK(w, fmt.Sprintf("successfully add a project: '%s'", prj))
@@ -82,11 +124,11 @@ func addProjectApiHandler(w http.ResponseWriter, r *http.Request) {
 // addShotApiHander는 사용자가 api를 통해 샷을 생성할수 있도록 한다.
 // 결과는 roi.APIResponse의 json 형식으로 반환된다.
 func addShotApiHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
 	w.Header().Set("Content-Type", "application/json")
 	db, err := roi.DB()
 	if err != nil {
-		log.Printf("could not connect to db: %v", err)
-		apiInternalServerError(w)
+		handleError(w, r, fmt.Errorf("could not connect to db: %w", err))
 		return
 	}
 
@@ -95,14 +137,13 @@ func addShotApiHandler(w http.ResponseWriter, r *http.Request) {
 		apiBadRequest(w, fmt.Errorf("'project' not specified"))
 		return
 	}
-	exist, err := roi.ProjectExist(db, prj)
+	exist, err := roi.ProjectExistContext(ctx, db, prj)
 	if err != nil {
-		log.Printf("could not check project %q exist: %v", prj, err)
-		apiInternalServerError(w)
+		handleError(w, r, fmt.Errorf("could not check project %q exist: %w", prj, err))
 		return
 	}
 	if !exist {
-		apiBadRequest(w, fmt.Errorf("project '%s' not exists", prj))
+		apiNotFound(w, fmt.Errorf("project '%s' not exists", prj))
 		return
 	}
 
@@ -115,14 +156,13 @@ func addShotApiHandler(w http.ResponseWriter, r *http.Request) {
 		apiBadRequest(w, fmt.Errorf("shot id '%s' is not valid", shot))
 		return
 	}
-	exist, err = roi.ShotExist(db, prj, shot)
+	exist, err = roi.ShotExistContext(ctx, db, prj, shot)
 	if err != nil {
-		log.Printf("could not check shot '%s' exist: %v", shot, err)
-		apiInternalServerError(w)
+		handleError(w, r, fmt.Errorf("could not check shot '%s' exist: %w", shot, err))
 		return
 	}
 	if exist {
-		apiBadRequest(w, fmt.Errorf("shot '%s' already exists", shot))
+		apiConflict(w, fmt.Errorf("shot '%s' already exists", shot))
 		return
 	}
 
@@ -158,10 +198,9 @@ func addShotApiHandler(w http.ResponseWriter, r *http.Request) {
 	}
 	tasks := fields(r.Form.Get("working_tasks"), ",")
 	if len(tasks) == 0 {
-		p, err := roi.GetProject(db, prj)
+		p, err := roi.GetProjectContext(ctx, db, prj)
 		if err != nil {
-			log.Printf("could not get project: %v", err)
-			apiInternalServerError(w)
+			handleError(w, r, fmt.Errorf("could not get project: %w", err))
 			return
 		}
 		tasks = p.DefaultTasks
@@ -176,13 +215,12 @@ func addShotApiHandler(w http.ResponseWriter, r *http.Request) {
 		TimecodeIn:    r.PostFormValue("timecode_in"),
 		TimecodeOut:   r.PostFormValue("timecode_out"),
 		Duration:      duration,
-		Tags:          strings.Split(r.PostFormValue("tags"), ","),
+		Tags:          fields(r.PostFormValue("tags"), ","),
 		WorkingTasks:  tasks,
 	}
-	err = roi.AddShot(db, prj, s)
+	err = roi.AddShotContext(ctx, db, prj, s)
 	if err != nil {
-		log.Printf("could not add shot: %v", err)
-		apiInternalServerError(w)
+		handleError(w, r, fmt.Errorf("could not add shot: %w", err))
 		return
 	}
 	for _, task := range tasks {
@@ -193,12 +231,479 @@ func addShotApiHandler(w http.ResponseWriter, r *http.Request) {
 			Status:  roi.TaskNotSet,
 			DueDate: time.Time{},
 		}
-		err := roi.AddTask(db, prj, shot, t)
+		err := roi.AddTaskContext(ctx, db, prj, shot, t)
 		if err != nil {
-			log.Printf("could not add task for shot: %v", err)
-			apiInternalServerError(w)
+			handleError(w, r, fmt.Errorf("could not add task for shot: %w", err))
 			return
 		}
 	}
 	apiOK(w, fmt.Sprintf("successfully add a shot: '%s'", shot))
 }
+
+// apiOKWithData는 api 질의가 잘 처리되었을 때
+// 그 응답과 질의 결과 데이터를 roi.APIResponse에 담아 반환한다.
+func apiOKWithData(w http.ResponseWriter, msg string, data interface{}) {
+	w.WriteHeader(http.StatusOK)
+	resp, _ := json.Marshal(roi.APIResponse{Msg: msg, Data: data})
+	w.Write(resp)
+}
+
+// apiUser는 api 토큰으로 확인된 요청한 사용자의 아이디를 반환한다.
+// withSession이 토큰이 없는 api 질의를 거부하므로 api 핸들러에서는 항상 사용자가 있다.
+func apiUser(r *http.Request) (string, error) {
+	s, err := currentSession(r)
+	if err != nil {
+		return "", err
+	}
+	if s == nil {
+		return "", fmt.Errorf("api request without a session")
+	}
+	return s.User, nil
+}
+
+// addSavedSearchApiHandler는 사용자가 api를 통해 검색 조건을 저장할수 있도록 한다.
+// 검색은 api 토큰의 사용자 이름으로 저장된다.
+// 결과는 roi.APIResponse의 json 형식으로 반환된다.
+func addSavedSearchApiHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	w.Header().Set("Content-Type", "application/json")
+	db, err := roi.DB()
+	if err != nil {
+		handleError(w, r, fmt.Errorf("could not connect to db: %w", err))
+		return
+	}
+	user, err := apiUser(r)
+	if err != nil {
+		handleError(w, r, fmt.Errorf("could not get user: %w", err))
+		return
+	}
+	r.ParseForm()
+	s, err := savedSearchFromForm(user, r.PostForm)
+	if err != nil {
+		apiBadRequest(w, err)
+		return
+	}
+	if !roi.IsValidSavedSearchName(s.Name) {
+		apiBadRequest(w, fmt.Errorf("invalid search name '%s'", s.Name))
+		return
+	}
+	exist, err := roi.ProjectExistContext(ctx, db, s.Project)
+	if err != nil {
+		handleError(w, r, fmt.Errorf("could not check project %q exist: %w", s.Project, err))
+		return
+	}
+	if !exist {
+		apiNotFound(w, fmt.Errorf("project '%s' not exists", s.Project))
+		return
+	}
+	exist, err = roi.SavedSearchExistContext(ctx, db, user, s.Name)
+	if err != nil {
+		handleError(w, r, fmt.Errorf("could not check saved search %q exist: %w", s.ID(), err))
+		return
+	}
+	if exist {
+		apiConflict(w, fmt.Errorf("saved search '%s' already exists", s.ID()))
+		return
+	}
+	err = roi.AddSavedSearchContext(ctx, db, s)
+	if err != nil {
+		handleError(w, r, fmt.Errorf("could not add saved search: %w", err))
+		return
+	}
+	apiOK(w, fmt.Sprintf("successfully add a saved search: '%s'", s.ID()))
+}
+
+// savedSearchShotsApiHandler는 사용자가 api를 통해 저장된 검색으로 샷을 검색할수 있도록 한다.
+// 다른 사용자의 검색은 공유된 것만 사용할 수 있다.
+// 검색된 샷은 roi.APIResponse.Data에 담겨 json 형식으로 반환된다.
+func savedSearchShotsApiHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	w.Header().Set("Content-Type", "application/json")
+	db, err := roi.DB()
+	if err != nil {
+		handleError(w, r, fmt.Errorf("could not connect to db: %w", err))
+		return
+	}
+	user, err := apiUser(r)
+	if err != nil {
+		handleError(w, r, fmt.Errorf("could not get user: %w", err))
+		return
+	}
+	id := r.FormValue("id")
+	owner, name := roi.SplitSavedSearchID(id)
+	if owner == "" {
+		apiBadRequest(w, fmt.Errorf("invalid saved search id '%s'", id))
+		return
+	}
+	s, err := roi.GetSavedSearchContext(ctx, db, owner, name)
+	if err != nil {
+		handleError(w, r, fmt.Errorf("could not get saved search %q: %w", id, err))
+		return
+	}
+	if s == nil || !canUseSavedSearch(s, user) {
+		apiNotFound(w, fmt.Errorf("saved search '%s' not exists", id))
+		return
+	}
+	shots, err := roi.SavedSearchShotsContext(ctx, db, s, user)
+	if err != nil {
+		handleError(w, r, fmt.Errorf("could not search shots with %q: %w", id, err))
+		return
+	}
+	apiOKWithData(w, fmt.Sprintf("found %d shots with '%s'", len(shots), id), shots)
+}
+
+// dashboardApiHandler는 사용자가 api를 통해 대시보드의 검색별 샷 갯수를 얻을수 있도록 한다.
+// 결과는 roi.APIResponse.Data에 저장된 검색 아이디와 샷 갯수의 목록으로 반환된다.
+// 대시보드의 검색 중 요청한 사용자의 것이 아니면서 공유되지 않은 검색은 빠진다.
+func dashboardApiHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	w.Header().Set("Content-Type", "application/json")
+	db, err := roi.DB()
+	if err != nil {
+		handleError(w, r, fmt.Errorf("could not connect to db: %w", err))
+		return
+	}
+	user, err := apiUser(r)
+	if err != nil {
+		handleError(w, r, fmt.Errorf("could not get user: %w", err))
+		return
+	}
+	id := r.FormValue("id")
+	owner, name := roi.SplitSavedSearchID(id)
+	if owner == "" {
+		apiBadRequest(w, fmt.Errorf("invalid dashboard id '%s'", id))
+		return
+	}
+	d, err := roi.GetDashboardContext(ctx, db, owner, name)
+	if err != nil {
+		handleError(w, r, fmt.Errorf("could not get dashboard %q: %w", id, err))
+		return
+	}
+	if d == nil {
+		apiNotFound(w, fmt.Errorf("dashboard '%s' not exists", id))
+		return
+	}
+	type count struct {
+		Search   string `json:"search"`
+		Project  string `json:"project"`
+		NumShots int    `json:"num_shots"`
+	}
+	counts := make([]count, 0, len(d.Searches))
+	for _, sid := range d.Searches {
+		su, sn := roi.SplitSavedSearchID(sid)
+		s, err := roi.GetSavedSearchContext(ctx, db, su, sn)
+		if err != nil {
+			handleError(w, r, fmt.Errorf("could not get saved search %q: %w", sid, err))
+			return
+		}
+		if s == nil || !canUseSavedSearch(s, user) {
+			// 지워졌거나 더 이상 공유되지 않는 검색이다.
+			continue
+		}
+		shots, err := roi.SavedSearchShotsContext(ctx, db, s, user)
+		if err != nil {
+			handleError(w, r, fmt.Errorf("could not search shots with %q: %w", sid, err))
+			return
+		}
+		counts = append(counts, count{Search: sid, Project: s.Project, NumShots: len(shots)})
+	}
+	apiOKWithData(w, fmt.Sprintf("dashboard '%s'", id), counts)
+}
+
+// findApiHandler는 사용자가 api를 통해 전체 텍스트 검색을 할수 있도록 한다.
+// 검색 결과는 점수가 높은 순서로 roi.APIResponse.Data에 담겨 반환된다.
+func findApiHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	w.Header().Set("Content-Type", "application/json")
+	db, err := roi.DB()
+	if err != nil {
+		handleError(w, r, fmt.Errorf("could not connect to db: %w", err))
+		return
+	}
+	query := r.FormValue("q")
+	if strings.TrimSpace(query) == "" {
+		apiBadRequest(w, fmt.Errorf("'q' not specified"))
+		return
+	}
+	results, err := roi.FullTextSearchContext(ctx, db, query, r.FormValue("project"), atoi(r.FormValue("limit")))
+	if err != nil {
+		handleError(w, r, fmt.Errorf("could not search %q: %w", query, err))
+		return
+	}
+	apiOKWithData(w, fmt.Sprintf("found %d results", len(results)), results)
+}
+
+// uploadThumbnailApiHandler는 사용자가 api를 통해 샷의 썸네일을 등록할수 있도록 한다.
+// 썸네일 파일은 multipart 폼의 "thumbnail" 필드로 받는다.
+// 결과는 roi.APIResponse의 json 형식으로 반환되며, Data에는 생성된 썸네일 크기들이 담긴다.
+func uploadThumbnailApiHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	w.Header().Set("Content-Type", "application/json")
+	db, err := roi.DB()
+	if err != nil {
+		handleError(w, r, fmt.Errorf("could not connect to db: %w", err))
+		return
+	}
+	r.Body = http.MaxBytesReader(w, r.Body, maxThumbnailUploadSize)
+	if err := r.ParseMultipartForm(32 << 20); err != nil {
+		apiBadRequest(w, fmt.Errorf("could not parse form: %v", err))
+		return
+	}
+	prj := r.FormValue("project")
+	shot := r.FormValue("shot")
+	exist, err := roi.ShotExistContext(ctx, db, prj, shot)
+	if err != nil {
+		handleError(w, r, fmt.Errorf("could not check shot '%s' exist: %w", prj+"."+shot, err))
+		return
+	}
+	if !exist {
+		apiNotFound(w, fmt.Errorf("shot '%s' not exists", prj+"."+shot))
+		return
+	}
+	if err := saveThumbnailUpload(r, prj, shot); err != nil {
+		apiBadRequest(w, err)
+		return
+	}
+	sizes, err := roi.ShotThumbnailSizes(prj, shot)
+	if err != nil {
+		handleError(w, r, fmt.Errorf("could not get thumbnail sizes of '%s': %w", prj+"."+shot, err))
+		return
+	}
+	apiOKWithData(w, fmt.Sprintf("successfully add a thumbnail: '%s'", prj+"."+shot), sizes)
+}
+
+// renameShotApiHandler는 사용자가 api를 통해 샷의 이름을 바꿀수 있도록 한다.
+// project, shot, new_shot이 필요하며, 예전 이름은 별칭으로 남아 /api/v1/shot/resolve로 찾을 수 있다.
+// 결과는 roi.APIResponse의 json 형식으로 반환된다.
+func renameShotApiHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	w.Header().Set("Content-Type", "application/json")
+	db, err := roi.DB()
+	if err != nil {
+		handleError(w, r, fmt.Errorf("could not connect to db: %w", err))
+		return
+	}
+	prj := r.PostFormValue("project")
+	shot := r.PostFormValue("shot")
+	newShot := r.PostFormValue("new_shot")
+	if err := roi.RenameShotContext(ctx, db, prj, shot, newShot); err != nil {
+		handleError(w, r, err)
+		return
+	}
+	apiOK(w, fmt.Sprintf("successfully renamed a shot: '%s' -> '%s'", prj+"."+shot, prj+"."+newShot))
+}
+
+// splitShotApiHandler는 사용자가 api를 통해 샷을 나누어 새 샷을 만들수 있도록 한다.
+// project, shot, new_shot이 필요하며, tasks는 쉼표로 구분된 새 샷으로 복사할 태스크들이다.
+// tasks가 없으면 샷의 모든 작업 태스크를 복사한다.
+// 결과는 roi.APIResponse의 json 형식으로 반환된다.
+func splitShotApiHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	w.Header().Set("Content-Type", "application/json")
+	db, err := roi.DB()
+	if err != nil {
+		handleError(w, r, fmt.Errorf("could not connect to db: %w", err))
+		return
+	}
+	prj := r.PostFormValue("project")
+	shot := r.PostFormValue("shot")
+	newShot := r.PostFormValue("new_shot")
+	tasks := fields(r.PostFormValue("tasks"), ",")
+	if err := roi.SplitShotContext(ctx, db, prj, shot, newShot, tasks); err != nil {
+		handleError(w, r, err)
+		return
+	}
+	apiOK(w, fmt.Sprintf("successfully split a shot: '%s' -> '%s'", prj+"."+shot, prj+"."+newShot))
+}
+
+// mergeShotApiHandler는 사용자가 api를 통해 샷을 다른 샷에 합칠수 있도록 한다.
+// project, shot, into가 필요하며 shot이 into 샷에 합쳐진다.
+// 결과는 roi.APIResponse의 json 형식으로 반환된다.
+func mergeShotApiHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	w.Header().Set("Content-Type", "application/json")
+	db, err := roi.DB()
+	if err != nil {
+		handleError(w, r, fmt.Errorf("could not connect to db: %w", err))
+		return
+	}
+	prj := r.PostFormValue("project")
+	shot := r.PostFormValue("shot")
+	into := r.PostFormValue("into")
+	if err := roi.MergeShotContext(ctx, db, prj, shot, into); err != nil {
+		handleError(w, r, err)
+		return
+	}
+	apiOK(w, fmt.Sprintf("successfully merged a shot: '%s' -> '%s'", prj+"."+shot, prj+"."+into))
+}
+
+// resolveShotApiHandler는 사용자가 api를 통해 샷의 현재 이름을 얻을수 있도록 한다.
+// 이름이 바뀌거나 다른 샷에 합쳐진 샷의 예전 이름을 주면 현재 샷의 이름을,
+// 존재하는 샷의 이름을 주면 그 이름을 roi.APIResponse.Data에 담아 반환한다.
+func resolveShotApiHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	w.Header().Set("Content-Type", "application/json")
+	db, err := roi.DB()
+	if err != nil {
+		handleError(w, r, fmt.Errorf("could not connect to db: %w", err))
+		return
+	}
+	prj := r.FormValue("project")
+	shot := r.FormValue("shot")
+	exist, err := roi.ShotExistContext(ctx, db, prj, shot)
+	if err != nil {
+		handleError(w, r, fmt.Errorf("could not check shot '%s' exist: %w", prj+"."+shot, err))
+		return
+	}
+	if exist {
+		apiOKWithData(w, fmt.Sprintf("shot exists: '%s'", prj+"."+shot), shot)
+		return
+	}
+	cur, err := roi.ResolveShotAliasContext(ctx, db, prj, shot)
+	if err != nil {
+		handleError(w, r, fmt.Errorf("could not resolve shot alias '%s': %w", prj+"."+shot, err))
+		return
+	}
+	if cur == "" {
+		apiNotFound(w, fmt.Errorf("shot '%s' not exists", prj+"."+shot))
+		return
+	}
+	apiOKWithData(w, fmt.Sprintf("shot '%s' is now '%s'", prj+"."+shot, prj+"."+cur), cur)
+}
+
+// pathApiHandler는 사용자가 api를 통해 프로젝트 경로 템플릿에 따른 경로를 얻을수 있도록 한다.
+// project, kind(work, render, mov, plate)가 필요하며 템플릿에 따라 shot, task, version이 필요하다.
+// 경로는 roi.APIResponse.Data에 담겨 json 형식으로 반환된다.
+func pathApiHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	w.Header().Set("Content-Type", "application/json")
+	db, err := roi.DB()
+	if err != nil {
+		handleError(w, r, fmt.Errorf("could not connect to db: %w", err))
+		return
+	}
+	r.ParseForm()
+	prj := r.Form.Get("project")
+	if prj == "" {
+		apiBadRequest(w, fmt.Errorf("'project' not specified"))
+		return
+	}
+	kind := r.Form.Get("kind")
+	if kind == "" {
+		apiBadRequest(w, fmt.Errorf("'kind' not specified"))
+		return
+	}
+	version := 0
+	if v := r.Form.Get("version"); v != "" {
+		version, err = strconv.Atoi(v)
+		if err != nil {
+			apiBadRequest(w, fmt.Errorf("could not convert version to int: %s", v))
+			return
+		}
+	}
+	pth, err := roi.ResolvePathContext(ctx, db, roi.PathKind(kind), prj, r.Form.Get("shot"), r.Form.Get("task"), version)
+	if err != nil {
+		handleError(w, r, err)
+		return
+	}
+	apiOKWithData(w, fmt.Sprintf("resolved %s path", kind), pth)
+}
+
+// nextVersionApiHandler는 사용자가 api를 통해 태스크에 다음으로 추가될 버전 번호를 얻을수 있도록 한다.
+// 버전 번호는 roi.APIResponse.Data에 담겨 json 형식으로 반환된다.
+func nextVersionApiHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	w.Header().Set("Content-Type", "application/json")
+	db, err := roi.DB()
+	if err != nil {
+		handleError(w, r, fmt.Errorf("could not connect to db: %w", err))
+		return
+	}
+	r.ParseForm()
+	prj := r.Form.Get("project")
+	shot := r.Form.Get("shot")
+	task := r.Form.Get("task")
+	if prj == "" || shot == "" || task == "" {
+		apiBadRequest(w, fmt.Errorf("'project', 'shot' and 'task' should be specified"))
+		return
+	}
+	exist, err := roi.TaskExistContext(ctx, db, prj, shot, task)
+	if err != nil {
+		handleError(w, r, fmt.Errorf("could not check task exist: %w", err))
+		return
+	}
+	if !exist {
+		apiNotFound(w, fmt.Errorf("task '%s.%s.%s' not exists", prj, shot, task))
+		return
+	}
+	v, err := roi.NextVersionContext(ctx, db, prj, shot, task)
+	if err != nil {
+		handleError(w, r, fmt.Errorf("could not get next version: %w", err))
+		return
+	}
+	apiOKWithData(w, fmt.Sprintf("next version is v%03d", v), v)
+}
+
+// addVersionApiHandler는 사용자가 api를 통해 버전을 추가할수 있도록 한다.
+// version을 지정하면 다음 버전 번호가 그와 같을 때만 추가한다.
+// output_files와 images는 쉼표로 구분된 여러 경로를 받는다.
+// checksums에 경로별 체크섬을 json 객체로 보내면 서버에서 계산한 값과 비교해
+// 하나라도 다를 때는 버전을 추가하지 않는다.
+// 추가된 버전 번호는 roi.APIResponse.Data에 담겨 json 형식으로 반환된다.
+func addVersionApiHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	w.Header().Set("Content-Type", "application/json")
+	db, err := roi.DB()
+	if err != nil {
+		handleError(w, r, fmt.Errorf("could not connect to db: %w", err))
+		return
+	}
+	r.ParseForm()
+	prj := r.PostFormValue("project")
+	shot := r.PostFormValue("shot")
+	task := r.PostFormValue("task")
+	if prj == "" || shot == "" || task == "" {
+		apiBadRequest(w, fmt.Errorf("'project', 'shot' and 'task' should be specified"))
+		return
+	}
+	exist, err := roi.TaskExistContext(ctx, db, prj, shot, task)
+	if err != nil {
+		handleError(w, r, fmt.Errorf("could not check task exist: %w", err))
+		return
+	}
+	if !exist {
+		apiNotFound(w, fmt.Errorf("task '%s.%s.%s' not exists", prj, shot, task))
+		return
+	}
+	expected := 0
+	if v := r.PostFormValue("version"); v != "" {
+		expected, err = strconv.Atoi(v)
+		if err != nil {
+			apiBadRequest(w, fmt.Errorf("could not convert version to int: %s", v))
+			return
+		}
+	}
+	v := &roi.Version{
+		Project:     prj,
+		Shot:        shot,
+		Task:        task,
+		OutputFiles: fields(r.PostFormValue("output_files"), ","),
+		Images:      fields(r.PostFormValue("images"), ","),
+		Mov:         r.PostFormValue("mov"),
+		WorkFile:    r.PostFormValue("work_file"),
+		Created:     time.Now(),
+	}
+	var sums map[string]string
+	if s := r.PostFormValue("checksums"); s != "" {
+		if err := json.Unmarshal([]byte(s), &sums); err != nil {
+			apiBadRequest(w, fmt.Errorf("could not decode checksums: %v", err))
+			return
+		}
+	}
+	err = roi.AddVerifiedVersionContext(ctx, db, prj, shot, task, expected, v, sums)
+	if err != nil {
+		handleError(w, r, fmt.Errorf("could not add version: %w", err))
+		return
+	}
+	apiOKWithData(w, fmt.Sprintf("successfully add a version: '%s.%s.%s.v%03d'", prj, shot, task, v.Version), v.Version)
+}
@@ -0,0 +1,275 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// config는 로이 서버의 설정이다.
+// 기본값 위에 설정 파일, 환경변수, 명령줄 플래그의 순서로 덮어쓴다.
+// 설정의 상대 경로는 로이를 실행한 디렉토리를 기준으로 한다.
+type config struct {
+	// DBAddr는 로이가 roiuser로 접속할 DB 주소이다.
+	DBAddr string
+	// DBRootAddr는 로이 DB와 테이블을 생성할 때 접속할 root 유저의 DB 주소이다.
+	DBRootAddr string
+	// DBMaxOpenConns는 DB에 동시에 열 수 있는 최대 연결 수이다. 0이면 제한하지 않는다.
+	DBMaxOpenConns int
+	// DBMaxIdleConns는 쉬는 동안 유지하는 최대 DB 연결 수이다.
+	DBMaxIdleConns int
+	// DBConnMaxLifetime은 DB 연결 하나를 재사용할 수 있는 최대 기간이다. 0이면 제한하지 않는다.
+	DBConnMaxLifetime duration
+
+	// HTTPS는 https 포트를 열 주소이다. 보안상의 이유로 http는 제공하지 않는다.
+	HTTPS string
+	// Cert와 Key는 https 인증서와 키 파일이다.
+	Cert string
+	Key  string
+	// CookieHashFile과 CookieBlockFile은 세션 쿠키를 서명하고 암호화하는 키를 담은 파일이다.
+	// -init을 실행하면 생성된다.
+	CookieHashFile  string
+	CookieBlockFile string
+
+	// UserDataDir은 썸네일 등 사용자가 올린 파일이 저장되는 디렉토리이다.
+	UserDataDir string
+	// TemplateDir은 html 템플릿이 있는 디렉토리이다.
+	TemplateDir string
+	// StaticDir은 /static/ 아래로 제공할 파일들이 있는 디렉토리이다.
+	StaticDir string
+	// StorageRoots는 로이가 사용자에게 미디어 파일을 보여줄 수 있는 루트 디렉토리들이다.
+	StorageRoots []string
+	// DeliveryRoots는 납품 폴더를 만들 수 있는 루트 디렉토리들이다.
+	DeliveryRoots []string
+	// ArchiveDir는 프로젝트를 보관할 때 묶음 파일을 만들 수 있는 디렉토리이다.
+	// 비어 있으면 프로젝트를 보관할 수 없다.
+	ArchiveDir string
+
+	// Dev는 개발 모드인지를 나타낸다. 개발 모드에서는 페이지를 보일 때마다 템플릿을 다시 읽는다.
+	Dev bool
+	// SessionLifetime은 로그인 후 세션이 유지되는 기간이다.
+	SessionLifetime duration
+	// SessionIdleTimeout은 쓰이지 않는 세션이 만료되기까지의 기간이다.
+	// 0이면 쓰이지 않아도 SessionLifetime 동안 유지된다.
+	SessionIdleTimeout duration
+	// RequestTimeout은 요청 하나를 처리하는 동안의 DB 작업에 주어지는 시간이다.
+	// 시간이 지나면 진행중인 DB 작업이 취소된다. 0이면 제한하지 않는다.
+	RequestTimeout duration
+
+	// Watch는 버전을 자동으로 추가할 감시 폴더들이다. ex) TEST=/delivery/TEST,OTHER=/delivery/OTHER
+	Watch string
+	// WatchInterval은 감시 폴더를 검사하는 주기이다.
+	WatchInterval duration
+	// VerifyInterval은 버전 파일을 주기적으로 검사하는 주기이다. 0이면 검사하지 않는다.
+	VerifyInterval duration
+	// TrashRetention은 휴지통의 항목이 자동으로 완전히 지워지기 전까지 보관되는 기간이다.
+	// 0이면 자동으로 지우지 않는다.
+	TrashRetention duration
+}
+
+// defaultConfig는 설정 파일이나 환경변수로 바꾸지 않았을 때의 설정을 반환한다.
+func defaultConfig() *config {
+	return &config{
+		DBAddr:             "postgresql://roiuser@localhost:26257/roi?sslmode=disable",
+		DBRootAddr:         "postgresql://root@localhost:26257/roi?sslmode=disable",
+		DBMaxIdleConns:     10,
+		HTTPS:              ":443",
+		Cert:               "cert/cert.pem",
+		Key:                "cert/key.pem",
+		CookieHashFile:     "cert/cookie.hash",
+		CookieBlockFile:    "cert/cookie.block",
+		UserDataDir:        "roi-userdata",
+		TemplateDir:        "tmpl",
+		StaticDir:          "static",
+		SessionLifetime:    duration(30 * 24 * time.Hour),
+		SessionIdleTimeout: duration(7 * 24 * time.Hour),
+		WatchInterval:      duration(time.Minute),
+		TrashRetention:     duration(30 * 24 * time.Hour),
+	}
+}
+
+// duration은 설정 파일에서 "30m", "720h"와 같은 문자열로 쓰는 시간 간격이다.
+type duration time.Duration
+
+func (d duration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(time.Duration(d).String())
+}
+
+func (d *duration) UnmarshalJSON(b []byte) error {
+	var s string
+	if err := json.Unmarshal(b, &s); err != nil {
+		return fmt.Errorf("duration should be a string like \"30m\": %s", b)
+	}
+	v, err := time.ParseDuration(s)
+	if err != nil {
+		return err
+	}
+	*d = duration(v)
+	return nil
+}
+
+// readConfigFile은 JSON 설정 파일을 읽어 c에 덮어쓴다.
+// 파일에 적히지 않은 설정은 그대로 두며, 모르는 설정이 있으면 에러를 반환한다.
+func readConfigFile(c *config, file string) error {
+	data, err := ioutil.ReadFile(file)
+	if err != nil {
+		return err
+	}
+	return parseConfig(c, data)
+}
+
+// parseConfig는 JSON 설정을 c에 덮어쓴다.
+func parseConfig(c *config, data []byte) error {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(c); err != nil {
+		return fmt.Errorf("invalid config: %v", err)
+	}
+	return nil
+}
+
+// configEnv는 설정 하나를 덮어쓰는 환경변수이다.
+type configEnv struct {
+	name string
+	// ptr은 덮어쓸 설정을 가리킨다.
+	ptr interface{}
+}
+
+// envs는 설정을 덮어쓰는 환경변수들을 반환한다.
+func (c *config) envs() []configEnv {
+	return []configEnv{
+		{"ROI_DB_ADDR", &c.DBAddr},
+		{"ROI_DB_ROOT_ADDR", &c.DBRootAddr},
+		{"ROI_DB_MAX_OPEN_CONNS", &c.DBMaxOpenConns},
+		{"ROI_DB_MAX_IDLE_CONNS", &c.DBMaxIdleConns},
+		{"ROI_DB_CONN_MAX_LIFETIME", &c.DBConnMaxLifetime},
+		{"ROI_HTTPS", &c.HTTPS},
+		{"ROI_CERT", &c.Cert},
+		{"ROI_KEY", &c.Key},
+		{"ROI_COOKIE_HASH_FILE", &c.CookieHashFile},
+		{"ROI_COOKIE_BLOCK_FILE", &c.CookieBlockFile},
+		{"ROI_USERDATA_DIR", &c.UserDataDir},
+		{"ROI_TEMPLATE_DIR", &c.TemplateDir},
+		{"ROI_STATIC_DIR", &c.StaticDir},
+		{"ROI_STORAGE_ROOTS", &c.StorageRoots},
+		{"ROI_DELIVERY_ROOTS", &c.DeliveryRoots},
+		{"ROI_ARCHIVE_DIR", &c.ArchiveDir},
+		{"ROI_DEV", &c.Dev},
+		{"ROI_SESSION_LIFETIME", &c.SessionLifetime},
+		{"ROI_SESSION_IDLE_TIMEOUT", &c.SessionIdleTimeout},
+		{"ROI_REQUEST_TIMEOUT", &c.RequestTimeout},
+		{"ROI_WATCH", &c.Watch},
+		{"ROI_WATCH_INTERVAL", &c.WatchInterval},
+		{"ROI_VERIFY_INTERVAL", &c.VerifyInterval},
+		{"ROI_TRASH_RETENTION", &c.TrashRetention},
+	}
+}
+
+// applyConfigEnv는 lookup으로 찾은 환경변수들로 c를 덮어쓴다.
+// 디렉토리 목록인 ROI_STORAGE_ROOTS는 운영체제의 경로 목록 구분자로 나눈다.
+func applyConfigEnv(c *config, lookup func(string) (string, bool)) error {
+	for _, e := range c.envs() {
+		v, ok := lookup(e.name)
+		if !ok {
+			continue
+		}
+		switch p := e.ptr.(type) {
+		case *string:
+			*p = v
+		case *[]string:
+			*p = filepath.SplitList(v)
+		case *int:
+			n, err := strconv.Atoi(v)
+			if err != nil {
+				return fmt.Errorf("invalid %s: %v", e.name, err)
+			}
+			*p = n
+		case *bool:
+			b, err := strconv.ParseBool(v)
+			if err != nil {
+				return fmt.Errorf("invalid %s: %v", e.name, err)
+			}
+			*p = b
+		case *duration:
+			d, err := time.ParseDuration(v)
+			if err != nil {
+				return fmt.Errorf("invalid %s: %v", e.name, err)
+			}
+			*p = duration(d)
+		default:
+			panic(fmt.Sprintf("unhandled config type of %s: %T", e.name, e.ptr))
+		}
+	}
+	return nil
+}
+
+// loadConfig는 설정 파일과 환경변수를 읽어 c에 덮어쓴다.
+// file이 비어 있으면 ROI_CONFIG 환경변수의 파일을, 그것도 없으면 roi.json을 읽는다.
+// 따로 지정하지 않은 roi.json이 없는 것은 에러가 아니다.
+func loadConfig(c *config, file string) error {
+	mustExist := true
+	if file == "" {
+		file = os.Getenv("ROI_CONFIG")
+	}
+	if file == "" {
+		file = "roi.json"
+		mustExist = false
+	}
+	err := readConfigFile(c, file)
+	if err != nil && (mustExist || !os.IsNotExist(err)) {
+		return fmt.Errorf("could not read config file %s: %v", file, err)
+	}
+	return applyConfigEnv(c, os.LookupEnv)
+}
+
+// printConfig는 c를 설정 파일 형식으로 w에 쓴다.
+// DB 주소에 비밀번호가 있다면 가려서 쓴다.
+func printConfig(w io.Writer, c *config) error {
+	p := *c
+	p.DBAddr = maskDBPassword(p.DBAddr)
+	p.DBRootAddr = maskDBPassword(p.DBRootAddr)
+	data, err := json.MarshalIndent(p, "", "\t")
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(w, "%s\n", data)
+	return err
+}
+
+// maskDBPassword는 DB 주소에 들어 있는 비밀번호를 가린 주소를 반환한다.
+func maskDBPassword(addr string) string {
+	u, err := url.Parse(addr)
+	if err != nil || u.User == nil {
+		return addr
+	}
+	if _, ok := u.User.Password(); !ok {
+		return addr
+	}
+	u.User = url.UserPassword(u.User.Username(), "xxxxx")
+	return u.String()
+}
+
+// pathListFlag는 운영체제의 경로 목록 구분자로 나뉜 디렉토리들을 받는 플래그이다.
+type pathListFlag struct {
+	p *[]string
+}
+
+func (f pathListFlag) String() string {
+	if f.p == nil {
+		return ""
+	}
+	return strings.Join(*f.p, string(filepath.ListSeparator))
+}
+
+func (f pathListFlag) Set(v string) error {
+	*f.p = filepath.SplitList(v)
+	return nil
+}
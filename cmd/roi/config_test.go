@@ -0,0 +1,67 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestConfigOverride(t *testing.T) {
+	c := defaultConfig()
+	err := parseConfig(c, []byte(`{"HTTPS": ":8443", "TrashRetention": "48h", "Dev": true}`))
+	if err != nil {
+		t.Fatalf("could not parse config: %v", err)
+	}
+	env := map[string]string{
+		"ROI_HTTPS":             ":9443",
+		"ROI_STORAGE_ROOTS":     "/show:/backup",
+		"ROI_DB_MAX_OPEN_CONNS": "20",
+	}
+	err = applyConfigEnv(c, func(k string) (string, bool) {
+		v, ok := env[k]
+		return v, ok
+	})
+	if err != nil {
+		t.Fatalf("could not apply env: %v", err)
+	}
+	if c.HTTPS != ":9443" {
+		t.Fatalf("env should override config file: got %s", c.HTTPS)
+	}
+	if time.Duration(c.TrashRetention) != 48*time.Hour {
+		t.Fatalf("TrashRetention: got %v, want 48h", time.Duration(c.TrashRetention))
+	}
+	if c.DBMaxOpenConns != 20 {
+		t.Fatalf("DBMaxOpenConns: got %d, want 20", c.DBMaxOpenConns)
+	}
+	if !c.Dev {
+		t.Fatalf("Dev should be set from config file")
+	}
+	if len(c.StorageRoots) != 2 || c.StorageRoots[0] != "/show" || c.StorageRoots[1] != "/backup" {
+		t.Fatalf("StorageRoots: got %v", c.StorageRoots)
+	}
+	if c.UserDataDir != "roi-userdata" {
+		t.Fatalf("unspecified config should be left as default: got %s", c.UserDataDir)
+	}
+
+	if err := parseConfig(c, []byte(`{"HTTP": ":80"}`)); err == nil {
+		t.Fatalf("unknown config should be an error")
+	}
+	if err := parseConfig(c, []byte(`{"WatchInterval": 60}`)); err == nil {
+		t.Fatalf("duration should be a string")
+	}
+}
+
+func TestMaskDBPassword(t *testing.T) {
+	cases := []struct {
+		addr string
+		want string
+	}{
+		{"postgresql://roiuser@localhost:26257/roi?sslmode=disable", "postgresql://roiuser@localhost:26257/roi?sslmode=disable"},
+		{"postgresql://roiuser:secret@db:26257/roi", "postgresql://roiuser:xxxxx@db:26257/roi"},
+	}
+	for _, c := range cases {
+		got := maskDBPassword(c.addr)
+		if got != c.want {
+			t.Fatalf("maskDBPassword(%q): got %q, want %q", c.addr, got, c.want)
+		}
+	}
+}
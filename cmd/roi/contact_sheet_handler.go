@@ -0,0 +1,107 @@
+package main
+
+import (
+	"fmt"
+	"image/png"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/studio2l/roi"
+)
+
+// contactSheetHandler는 /contact-sheet/<project> 페이지로 사용자가 접속했을때
+// 샷 또는 시퀀스의 컨택트 시트 페이지를 반환한다.
+// 샷은 shot, 시퀀스는 seq 질의로 받으며 둘 다 없으면 프로젝트의 모든 샷을 보인다.
+// format 질의가 png라면 페이지 대신 컨택트 시트 이미지를 내려받게 한다.
+func contactSheetHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	db, err := roi.DB()
+	if err != nil {
+		handleError(w, r, fmt.Errorf("could not connect to database: %w", err))
+		return
+	}
+	session, err := getSession(r)
+	if err != nil {
+		httpError(w, r, "could not get session", http.StatusUnauthorized)
+		clearSession(w)
+		return
+	}
+	prj := r.URL.Path[len("/contact-sheet/"):]
+	if prj == "" {
+		httpError(w, r, "need project", http.StatusBadRequest)
+		return
+	}
+	exist, err := roi.ProjectExistContext(ctx, db, prj)
+	if err != nil {
+		handleError(w, r, fmt.Errorf("could not check project '%s' exist: %w", prj, err))
+		return
+	}
+	if !exist {
+		httpError(w, r, fmt.Sprintf("project '%s' not exist", prj), http.StatusNotFound)
+		return
+	}
+	r.ParseForm()
+	shot := r.Form.Get("shot")
+	seq := r.Form.Get("seq")
+	shots, err := roi.SearchShotsContext(ctx, db, prj, shot, "", "", "", "", time.Time{})
+	if err != nil {
+		handleError(w, r, fmt.Errorf("could not search shots: %w", err))
+		return
+	}
+	if seq != "" {
+		seqShots := make([]*roi.Shot, 0, len(shots))
+		for _, s := range shots {
+			if roi.ShotSequence(s.Shot) == seq {
+				seqShots = append(seqShots, s)
+			}
+		}
+		shots = seqShots
+	}
+	sheet, err := roi.NewContactSheetContext(ctx, db, prj, shots)
+	if err != nil {
+		handleError(w, r, fmt.Errorf("could not make contact sheet: %w", err))
+		return
+	}
+	name := prj
+	if shot != "" {
+		name += "_" + shot
+	} else if seq != "" {
+		name += "_" + seq
+	}
+	if r.Form.Get("format") == "png" {
+		img, err := sheet.Image()
+		if err != nil {
+			handleError(w, r, fmt.Errorf("could not make contact sheet image: %w", err))
+			return
+		}
+		w.Header().Set("Content-Type", "image/png")
+		w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", name+"_contact_sheet.png"))
+		if err := png.Encode(w, img); err != nil {
+			log.Printf("could not write contact sheet image: %v", err)
+		}
+		return
+	}
+	recipt := struct {
+		LoggedInUser string
+		Project      string
+		Shot         string
+		Sequence     string
+		Name         string
+		Sheet        *roi.ContactSheet
+	}{
+		LoggedInUser: session["userid"],
+		Project:      prj,
+		Shot:         shot,
+		Sequence:     roi.ShotSequence(shot),
+		Name:         name,
+		Sheet:        sheet,
+	}
+	if seq != "" {
+		recipt.Sequence = seq
+	}
+	err = executeTemplate(w, r, "contact-sheet.html", recipt)
+	if err != nil {
+		handleError(w, r, err)
+	}
+}
@@ -0,0 +1,192 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/studio2l/roi"
+)
+
+// dashboardItem은 대시보드에 보여질 저장된 검색 하나와 그 검색 결과의 요약이다.
+type dashboardItem struct {
+	Search   *roi.SavedSearch
+	NumShots int
+}
+
+// dashboardHandler는 /dashboard/ 하위 페이지로 사용자가 접속했을때 페이지를 반환한다.
+// /dashboard/ 는 사용자의 대시보드 목록을, /dashboard/<user>/<name> 은 해당 대시보드를 보여준다.
+func dashboardHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	db, err := roi.DB()
+	if err != nil {
+		handleError(w, r, fmt.Errorf("could not connect to database: %w", err))
+		return
+	}
+	session, err := getSession(r)
+	if err != nil {
+		httpError(w, r, "could not get session", http.StatusUnauthorized)
+		clearSession(w)
+		return
+	}
+	if session == nil || session["userid"] == "" {
+		http.Redirect(w, r, "/login", http.StatusSeeOther)
+		return
+	}
+	user := session["userid"]
+	dashboards, err := roi.UserDashboardsContext(ctx, db, user)
+	if err != nil {
+		handleError(w, r, fmt.Errorf("could not get dashboards of user '%s': %w", user, err))
+		return
+	}
+	searches, err := roi.UserSavedSearchesContext(ctx, db, user, "")
+	if err != nil {
+		handleError(w, r, fmt.Errorf("could not get saved searches of user '%s': %w", user, err))
+		return
+	}
+	pth := r.URL.Path[len("/dashboard/"):]
+	if pth == "" && len(dashboards) != 0 {
+		d := dashboards[0]
+		http.Redirect(w, r, "/dashboard/"+d.User+"/"+url.PathEscape(d.Name), http.StatusSeeOther)
+		return
+	}
+	var d *roi.Dashboard
+	items := make([]dashboardItem, 0)
+	if pth != "" {
+		owner, name := roi.SplitSavedSearchID(pth)
+		if owner == "" {
+			http.NotFound(w, r)
+			return
+		}
+		d, err = roi.GetDashboardContext(ctx, db, owner, name)
+		if err != nil {
+			handleError(w, r, fmt.Errorf("could not get dashboard '%s': %w", pth, err))
+			return
+		}
+		if d == nil {
+			httpError(w, r, fmt.Sprintf("dashboard '%s' not exist", pth), http.StatusNotFound)
+			return
+		}
+		for _, id := range d.Searches {
+			su, sn := roi.SplitSavedSearchID(id)
+			s, err := roi.GetSavedSearchContext(ctx, db, su, sn)
+			if err != nil {
+				handleError(w, r, fmt.Errorf("could not get saved search '%s': %w", id, err))
+				return
+			}
+			if s == nil || !canUseSavedSearch(s, user) {
+				// 지워졌거나 더 이상 공유되지 않는 검색이다.
+				continue
+			}
+			shots, err := roi.SavedSearchShotsContext(ctx, db, s, user)
+			if err != nil {
+				handleError(w, r, fmt.Errorf("could not search shots with '%s': %w", id, err))
+				return
+			}
+			items = append(items, dashboardItem{Search: s, NumShots: len(shots)})
+		}
+	}
+	recipt := struct {
+		LoggedInUser  string
+		Dashboards    []*roi.Dashboard
+		Dashboard     *roi.Dashboard
+		Items         []dashboardItem
+		SavedSearches []*roi.SavedSearch
+	}{
+		LoggedInUser:  user,
+		Dashboards:    dashboards,
+		Dashboard:     d,
+		Items:         items,
+		SavedSearches: searches,
+	}
+	err = executeTemplate(w, r, "dashboard.html", recipt)
+	if err != nil {
+		handleError(w, r, err)
+	}
+}
+
+// addDashboardHandler는 사용자가 POST로 대시보드 이름과 저장된 검색들을 보내면
+// 사용자의 대시보드를 만든다. 같은 이름의 대시보드가 있다면 그 검색들을 수정한다.
+func addDashboardHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	if r.Method != "POST" {
+		httpError(w, r, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	db, err := roi.DB()
+	if err != nil {
+		handleError(w, r, fmt.Errorf("could not connect to database: %w", err))
+		return
+	}
+	session, err := getSession(r)
+	if err != nil {
+		httpError(w, r, "could not get session", http.StatusUnauthorized)
+		clearSession(w)
+		return
+	}
+	user := session["userid"]
+	if user == "" {
+		httpError(w, r, "need to login", http.StatusUnauthorized)
+		return
+	}
+	r.ParseForm()
+	name := strings.TrimSpace(r.Form.Get("name"))
+	if !roi.IsValidSavedSearchName(name) {
+		httpError(w, r, fmt.Sprintf("invalid dashboard name '%s'", name), http.StatusBadRequest)
+		return
+	}
+	searches := r.Form["searches"]
+	d, err := roi.GetDashboardContext(ctx, db, user, name)
+	if err != nil {
+		handleError(w, r, fmt.Errorf("could not get dashboard '%s/%s': %w", user, name, err))
+		return
+	}
+	if d != nil {
+		err = roi.UpdateDashboardContext(ctx, db, user, name, searches)
+	} else {
+		err = roi.AddDashboardContext(ctx, db, &roi.Dashboard{User: user, Name: name, Searches: searches})
+	}
+	if err != nil {
+		handleError(w, r, fmt.Errorf("could not save dashboard '%s/%s': %w", user, name, err))
+		return
+	}
+	http.Redirect(w, r, "/dashboard/"+user+"/"+url.PathEscape(name), http.StatusSeeOther)
+}
+
+// deleteDashboardHandler는 사용자가 POST로 보낸 이름의 대시보드를 지운다.
+func deleteDashboardHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	if r.Method != "POST" {
+		httpError(w, r, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	db, err := roi.DB()
+	if err != nil {
+		handleError(w, r, fmt.Errorf("could not connect to database: %w", err))
+		return
+	}
+	session, err := getSession(r)
+	if err != nil {
+		httpError(w, r, "could not get session", http.StatusUnauthorized)
+		clearSession(w)
+		return
+	}
+	user := session["userid"]
+	if user == "" {
+		httpError(w, r, "need to login", http.StatusUnauthorized)
+		return
+	}
+	r.ParseForm()
+	name := r.Form.Get("name")
+	if name == "" {
+		httpError(w, r, "need 'name'", http.StatusBadRequest)
+		return
+	}
+	err = roi.DeleteDashboardContext(ctx, db, user, name)
+	if err != nil {
+		handleError(w, r, fmt.Errorf("could not delete dashboard '%s/%s': %w", user, name, err))
+		return
+	}
+	http.Redirect(w, r, "/dashboard/", http.StatusSeeOther)
+}
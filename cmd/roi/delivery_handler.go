@@ -0,0 +1,246 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/studio2l/roi"
+)
+
+// deliveriesHandler는 /deliveries/<project> 페이지로 사용자가 접속했을때
+// 프로젝트의 납품 목록과 새 납품을 만드는 폼을 보여준다.
+// 폼의 기본값은 마지막 납품에서 사용한 폴더와 이름 템플릿을 따른다.
+func deliveriesHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	db, err := roi.DB()
+	if err != nil {
+		handleError(w, r, fmt.Errorf("could not connect to database: %w", err))
+		return
+	}
+	session, err := getSession(r)
+	if err != nil {
+		httpError(w, r, "could not get session", http.StatusUnauthorized)
+		clearSession(w)
+		return
+	}
+	prj := r.URL.Path[len("/deliveries/"):]
+	exist, err := roi.ProjectExistContext(ctx, db, prj)
+	if err != nil {
+		handleError(w, r, fmt.Errorf("could not check project '%s' exist: %w", prj, err))
+		return
+	}
+	if !exist {
+		httpError(w, r, fmt.Sprintf("project '%s' not exist", prj), http.StatusNotFound)
+		return
+	}
+	ds, err := roi.ProjectDeliveriesContext(ctx, db, prj)
+	if err != nil {
+		handleError(w, r, fmt.Errorf("could not get deliveries: %w", err))
+		return
+	}
+	ss, err := roi.UserSavedSearchesContext(ctx, db, session["userid"], prj)
+	if err != nil {
+		handleError(w, r, fmt.Errorf("could not get saved searches: %w", err))
+		return
+	}
+	name := time.Now().Format("20060102")
+	dir := ""
+	naming := roi.DefaultDeliveryNaming
+	if len(ds) != 0 {
+		dir = filepath.Join(filepath.Dir(ds[0].Dir), name)
+		naming = ds[0].Naming
+	}
+	recipt := struct {
+		LoggedInUser     string
+		Project          string
+		Deliveries       []*roi.Delivery
+		SavedSearches    []*roi.SavedSearch
+		AllDeliveryModes []roi.DeliveryMode
+		Name             string
+		Dir              string
+		Naming           string
+		Shots            string
+	}{
+		LoggedInUser:     session["userid"],
+		Project:          prj,
+		Deliveries:       ds,
+		SavedSearches:    ss,
+		AllDeliveryModes: roi.AllDeliveryModes,
+		Name:             name,
+		Dir:              dir,
+		Naming:           naming,
+		Shots:            r.FormValue("shots"),
+	}
+	err = executeTemplate(w, r, "deliveries.html", recipt)
+	if err != nil {
+		handleError(w, r, err)
+	}
+}
+
+// addDeliveryHandler는 사용자가 POST로 보낸 샷들 또는 저장된 검색의 샷들을 납품한다.
+// 각 샷에서 승인된 태스크의 마지막 버전 파일들이 납품 폴더로 옮겨진다.
+func addDeliveryHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	if r.Method != "POST" {
+		httpError(w, r, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	db, err := roi.DB()
+	if err != nil {
+		handleError(w, r, fmt.Errorf("could not connect to database: %w", err))
+		return
+	}
+	session, err := getSession(r)
+	if err != nil || session["userid"] == "" {
+		httpError(w, r, "could not get session", http.StatusUnauthorized)
+		clearSession(w)
+		return
+	}
+	r.ParseForm()
+	prj := r.Form.Get("project")
+	name := strings.TrimSpace(r.Form.Get("name"))
+	if !roi.IsValidDeliveryName(name) {
+		httpError(w, r, fmt.Sprintf("invalid delivery name '%s'", name), http.StatusBadRequest)
+		return
+	}
+	exist, err := roi.ProjectExistContext(ctx, db, prj)
+	if err != nil {
+		handleError(w, r, fmt.Errorf("could not check project '%s' exist: %w", prj, err))
+		return
+	}
+	if !exist {
+		httpError(w, r, fmt.Sprintf("project '%s' not exist", prj), http.StatusNotFound)
+		return
+	}
+	exist, err = roi.DeliveryExistContext(ctx, db, prj, name)
+	if err != nil {
+		handleError(w, r, fmt.Errorf("could not check delivery '%s' exist: %w", name, err))
+		return
+	}
+	if exist {
+		httpError(w, r, fmt.Sprintf("delivery '%s' already exist", name), http.StatusConflict)
+		return
+	}
+	shots := fields(strings.Replace(r.Form.Get("shots"), "\n", ",", -1), ",")
+	if id := r.Form.Get("saved_search"); id != "" {
+		user, sname := roi.SplitSavedSearchID(id)
+		s, err := roi.GetSavedSearchContext(ctx, db, user, sname)
+		if err != nil {
+			handleError(w, r, fmt.Errorf("could not get saved search '%s': %w", id, err))
+			return
+		}
+		if s == nil || s.Project != prj || !canUseSavedSearch(s, session["userid"]) {
+			httpError(w, r, fmt.Sprintf("saved search '%s' not exist", id), http.StatusNotFound)
+			return
+		}
+		ss, err := roi.SavedSearchShotsContext(ctx, db, s, session["userid"])
+		if err != nil {
+			handleError(w, r, fmt.Errorf("could not search shots of saved search '%s': %w", id, err))
+			return
+		}
+		for _, s := range ss {
+			shots = append(shots, s.Shot)
+		}
+	}
+	if len(shots) == 0 {
+		httpError(w, r, "need shots to deliver", http.StatusBadRequest)
+		return
+	}
+	naming := strings.TrimSpace(r.Form.Get("naming"))
+	if naming == "" {
+		naming = roi.DefaultDeliveryNaming
+	}
+	items, err := roi.PlanDeliveryContext(ctx, db, prj, shots, naming)
+	if err != nil {
+		httpError(w, r, fmt.Sprintf("could not plan delivery: %v", err), http.StatusBadRequest)
+		return
+	}
+	d := &roi.Delivery{
+		Project: prj,
+		Name:    name,
+		Dir:     strings.TrimSpace(r.Form.Get("dir")),
+		Naming:  naming,
+		Mode:    roi.DeliveryMode(r.Form.Get("mode")),
+		Sender:  session["userid"],
+		Created: time.Now(),
+		Items:   items,
+	}
+	err = roi.AddDeliveryContext(ctx, db, d)
+	if err != nil {
+		handleError(w, r, fmt.Errorf("could not add delivery: %w", err))
+		return
+	}
+	http.Redirect(w, r, "/delivery/"+prj+"/"+url.PathEscape(name), http.StatusSeeOther)
+}
+
+// deliveryHandler는 /delivery/<project>/<name> 페이지로 사용자가 접속했을때
+// 납품된 파일들을 보여준다.
+// format 질의가 csv, xlsx 중 하나라면 페이지 대신 해당 형식의 납품 목록을 내려받게 한다.
+func deliveryHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	db, err := roi.DB()
+	if err != nil {
+		handleError(w, r, fmt.Errorf("could not connect to database: %w", err))
+		return
+	}
+	session, err := getSession(r)
+	if err != nil {
+		httpError(w, r, "could not get session", http.StatusUnauthorized)
+		clearSession(w)
+		return
+	}
+	ids := strings.SplitN(r.URL.Path[len("/delivery/"):], "/", 2)
+	if len(ids) != 2 || ids[0] == "" || ids[1] == "" {
+		http.NotFound(w, r)
+		return
+	}
+	prj, name := ids[0], ids[1]
+	d, err := roi.GetDeliveryContext(ctx, db, prj, name)
+	if err != nil {
+		handleError(w, r, fmt.Errorf("could not get delivery '%s/%s': %w", prj, name, err))
+		return
+	}
+	if d == nil {
+		httpError(w, r, fmt.Sprintf("delivery '%s/%s' not exist", prj, name), http.StatusNotFound)
+		return
+	}
+	format := r.FormValue("format")
+	if format != "" {
+		fname := prj + "_" + d.Name + "_manifest"
+		switch format {
+		case "csv":
+			w.Header().Set("Content-Type", "text/csv; charset=utf-8")
+			w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", fname+".csv"))
+			err = roi.WriteDeliveryCSV(w, d)
+		case "xlsx":
+			w.Header().Set("Content-Type", "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet")
+			w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", fname+".xlsx"))
+			err = roi.WriteDeliveryXLSX(w, d)
+		default:
+			httpError(w, r, fmt.Sprintf("unknown format '%s'", format), http.StatusBadRequest)
+			return
+		}
+		if err != nil {
+			log.Printf("could not export delivery manifest: %v", err)
+		}
+		return
+	}
+	recipt := struct {
+		LoggedInUser string
+		Project      string
+		Delivery     *roi.Delivery
+	}{
+		LoggedInUser: session["userid"],
+		Project:      prj,
+		Delivery:     d,
+	}
+	err = executeTemplate(w, r, "delivery.html", recipt)
+	if err != nil {
+		handleError(w, r, err)
+	}
+}
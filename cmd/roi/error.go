@@ -0,0 +1,94 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"runtime/debug"
+	"strings"
+
+	"github.com/studio2l/roi"
+)
+
+// httpStatus는 에러의 종류에 맞는 http 상태 코드를 반환한다.
+// 종류를 알 수 없는 에러는 내부 에러로 본다.
+func httpStatus(err error) int {
+	switch {
+	case errors.Is(err, roi.ErrInvalid):
+		return http.StatusBadRequest
+	case errors.Is(err, roi.ErrNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, roi.ErrExists), errors.Is(err, roi.ErrConflict):
+		return http.StatusConflict
+	}
+	return http.StatusInternalServerError
+}
+
+// handleError는 err를 종류에 맞는 http 상태 코드로 사용자에게 알린다.
+// 내부 에러는 로그를 남기고, 사용자에게는 이유를 알리지 않는다.
+// api 질의라면 roi.APIResponse로, 아니라면 에러 페이지로 응답한다.
+func handleError(w http.ResponseWriter, r *http.Request, err error) {
+	status := httpStatus(err)
+	msg := err.Error()
+	if status == http.StatusInternalServerError {
+		log.Printf("%s %s: %v", r.Method, r.URL.Path, err)
+		msg = "internal error"
+	}
+	if strings.HasPrefix(r.URL.Path, "/api/") {
+		resp, _ := json.Marshal(roi.APIResponse{Err: msg, Fields: roi.FieldErrors(err)})
+		http.Error(w, string(resp), status)
+		return
+	}
+	httpError(w, r, msg, status)
+}
+
+// httpError는 http.Error 대신 쓰이며, 메시지를 에러 페이지에 담아 응답한다.
+// 자바스크립트의 fetch처럼 html을 받지 않는 요청이거나 에러 페이지를 그릴 수 없을 때는 http.Error로 응답한다.
+func httpError(w http.ResponseWriter, r *http.Request, msg string, status int) {
+	if templates == nil || !strings.Contains(r.Header.Get("Accept"), "text/html") {
+		http.Error(w, msg, status)
+		return
+	}
+	session, _ := getSession(r)
+	recipt := struct {
+		LoggedInUser string
+		Status       int
+		StatusText   string
+		Msg          string
+	}{
+		LoggedInUser: session["userid"],
+		Status:       status,
+		StatusText:   http.StatusText(status),
+		Msg:          msg,
+	}
+	buf, err := renderTemplate(r, "error.html", recipt)
+	if err != nil {
+		http.Error(w, msg, status)
+		return
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.WriteHeader(status)
+	buf.WriteTo(w)
+}
+
+// withRecovery는 h를 실행하다 패닉이 일어나면 서버를 멈추는 대신
+// 로그를 남기고 사용자에게 내부 에러를 알리는 핸들러를 반환한다.
+func withRecovery(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		defer func() {
+			v := recover()
+			if v == nil {
+				return
+			}
+			if v == http.ErrAbortHandler {
+				// 응답을 중단하려는 의도적인 패닉이다.
+				panic(v)
+			}
+			handleError(w, r, fmt.Errorf("panic: %v\n%s", v, debug.Stack()))
+		}()
+		h.ServeHTTP(w, r)
+	})
+}
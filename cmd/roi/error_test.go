@@ -0,0 +1,93 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/studio2l/roi"
+)
+
+func TestHTTPStatus(t *testing.T) {
+	cases := []struct {
+		err  error
+		want int
+	}{
+		{&roi.Error{Kind: roi.ErrInvalid, Err: errors.New("invalid shot id")}, http.StatusBadRequest},
+		{&roi.ValidationError{}, http.StatusBadRequest},
+		{&roi.Error{Kind: roi.ErrNotFound, Err: errors.New("shot not exist")}, http.StatusNotFound},
+		{&roi.Error{Kind: roi.ErrExists, Err: errors.New("shot already exist")}, http.StatusConflict},
+		{&roi.Error{Kind: roi.ErrConflict, Err: errors.New("review session already published")}, http.StatusConflict},
+		{errors.New("connection refused"), http.StatusInternalServerError},
+	}
+	for _, c := range cases {
+		got := httpStatus(fmt.Errorf("could not do it: %w", c.err))
+		if got != c.want {
+			t.Fatalf("%v: got %d, want %d", c.err, got, c.want)
+		}
+	}
+}
+
+func TestHandleError(t *testing.T) {
+	parseTemplate()
+	defer func() { templates = nil }()
+
+	notFound := &roi.Error{Kind: roi.ErrNotFound, Err: errors.New("shot not exist: TEST.CG_0010")}
+	r := httptest.NewRequest("GET", "/update-shot", nil)
+	r.Header.Set("Accept", "text/html")
+	w := httptest.NewRecorder()
+	handleError(w, r, notFound)
+	if w.Code != http.StatusNotFound {
+		t.Fatalf("got status %d, want %d", w.Code, http.StatusNotFound)
+	}
+	if !strings.Contains(w.Body.String(), "Not Found") || !strings.Contains(w.Body.String(), "shot not exist: TEST.CG_0010") {
+		t.Fatalf("error page should show the status and message: %s", w.Body.String())
+	}
+
+	// html을 받지 않는 자바스크립트의 요청에는 메시지만 보낸다.
+	w = httptest.NewRecorder()
+	handleError(w, httptest.NewRequest("POST", "/update-task", nil), notFound)
+	if w.Code != http.StatusNotFound || strings.TrimSpace(w.Body.String()) != notFound.Error() {
+		t.Fatalf("got %d %q, want %d %q", w.Code, w.Body.String(), http.StatusNotFound, notFound.Error())
+	}
+
+	// 내부 에러의 이유는 사용자에게 알리지 않는다.
+	w = httptest.NewRecorder()
+	handleError(w, r, errors.New("pq: password authentication failed"))
+	if w.Code != http.StatusInternalServerError {
+		t.Fatalf("got status %d, want %d", w.Code, http.StatusInternalServerError)
+	}
+	if strings.Contains(w.Body.String(), "password") {
+		t.Fatalf("internal error should not be shown: %s", w.Body.String())
+	}
+
+	// api 질의에는 json으로 응답한다.
+	w = httptest.NewRecorder()
+	handleError(w, httptest.NewRequest("POST", "/api/v1/shot/rename", nil), notFound)
+	if w.Code != http.StatusNotFound {
+		t.Fatalf("got status %d, want %d", w.Code, http.StatusNotFound)
+	}
+	resp := roi.APIResponse{}
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("api error should be json: %v", err)
+	}
+	if resp.Err != notFound.Error() {
+		t.Fatalf("got %q, want %q", resp.Err, notFound.Error())
+	}
+}
+
+func TestWithRecovery(t *testing.T) {
+	h := withRecovery(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var s *roi.Shot
+		_ = s.Shot // nil 포인터 참조로 인한 패닉
+	}))
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest("GET", "/shot/TEST/CG_0010", nil))
+	if w.Code != http.StatusInternalServerError {
+		t.Fatalf("got status %d, want %d", w.Code, http.StatusInternalServerError)
+	}
+}
@@ -0,0 +1,52 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+
+	"github.com/studio2l/roi"
+)
+
+// findHandler는 /find 페이지로 사용자가 접속했을때 전체 텍스트 검색 결과 페이지를 반환한다.
+// 검색어는 q, 검색을 한정할 프로젝트는 project 질의로 받는다.
+func findHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	db, err := roi.DB()
+	if err != nil {
+		handleError(w, r, fmt.Errorf("could not connect to database: %w", err))
+		return
+	}
+	session, err := getSession(r)
+	if err != nil {
+		log.Print(fmt.Sprintf("could not get session: %s", err))
+		clearSession(w)
+	}
+	r.ParseForm()
+	query := strings.TrimSpace(r.Form.Get("q"))
+	prj := r.Form.Get("project")
+	results := make([]*roi.SearchResult, 0)
+	if query != "" {
+		results, err = roi.FullTextSearchContext(ctx, db, query, prj, 200)
+		if err != nil {
+			handleError(w, r, fmt.Errorf("could not search '%s': %w", query, err))
+			return
+		}
+	}
+	recipt := struct {
+		LoggedInUser string
+		Query        string
+		Project      string
+		Results      []*roi.SearchResult
+	}{
+		LoggedInUser: session["userid"],
+		Query:        query,
+		Project:      prj,
+		Results:      results,
+	}
+	err = executeTemplate(w, r, "find.html", recipt)
+	if err != nil {
+		handleError(w, r, err)
+	}
+}
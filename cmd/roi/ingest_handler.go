@@ -0,0 +1,86 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/studio2l/roi"
+)
+
+// quarantineHandler는 /quarantine/<project> 페이지로 사용자가 접속했을때
+// 와치 폴더에서 인제스트 되지 못하고 격리된 파일 목록 페이지를 반환한다.
+func quarantineHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	db, err := roi.DB()
+	if err != nil {
+		handleError(w, r, fmt.Errorf("could not connect to database: %w", err))
+		return
+	}
+	session, err := getSession(r)
+	if err != nil {
+		httpError(w, r, "could not get session", http.StatusUnauthorized)
+		clearSession(w)
+		return
+	}
+	prj := r.URL.Path[len("/quarantine/"):]
+	exist, err := roi.ProjectExistContext(ctx, db, prj)
+	if err != nil {
+		handleError(w, r, fmt.Errorf("could not check project '%s' exist: %w", prj, err))
+		return
+	}
+	if !exist {
+		httpError(w, r, fmt.Sprintf("project '%s' not exist", prj), http.StatusNotFound)
+		return
+	}
+	files, err := roi.QuarantinedFilesContext(ctx, db, prj)
+	if err != nil {
+		handleError(w, r, fmt.Errorf("could not get quarantined files: %w", err))
+		return
+	}
+	recipt := struct {
+		LoggedInUser string
+		Project      string
+		Files        []*roi.QuarantinedFile
+	}{
+		LoggedInUser: session["userid"],
+		Project:      prj,
+		Files:        files,
+	}
+	err = executeTemplate(w, r, "quarantine.html", recipt)
+	if err != nil {
+		handleError(w, r, err)
+	}
+}
+
+// deleteQuarantinedHandler는 격리된 파일을 목록에서 지운다.
+// 파일 자체는 지우지 않으며, 여전히 와치 폴더에 있다면 다음 검사 때 다시 처리된다.
+func deleteQuarantinedHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	if r.Method != "POST" {
+		httpError(w, r, "need POST", http.StatusBadRequest)
+		return
+	}
+	db, err := roi.DB()
+	if err != nil {
+		handleError(w, r, fmt.Errorf("could not connect to database: %w", err))
+		return
+	}
+	session, err := getSession(r)
+	if err != nil || session["userid"] == "" {
+		httpError(w, r, "could not get session", http.StatusUnauthorized)
+		clearSession(w)
+		return
+	}
+	prj := r.FormValue("project")
+	pth := r.FormValue("path")
+	if prj == "" || pth == "" {
+		httpError(w, r, "need 'project' and 'path'", http.StatusBadRequest)
+		return
+	}
+	err = roi.DeleteQuarantinedFileContext(ctx, db, prj, pth)
+	if err != nil {
+		handleError(w, r, fmt.Errorf("could not delete quarantined file: %w", err))
+		return
+	}
+	http.Redirect(w, r, "/quarantine/"+prj, http.StatusSeeOther)
+}
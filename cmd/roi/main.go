@@ -1,13 +1,17 @@
 package main
 
 import (
+	"context"
 	"flag"
 	"fmt"
 	"io/ioutil"
 	"log"
 	"net/http"
+	"os"
 	"os/exec"
+	"path/filepath"
 	"strings"
+	"time"
 
 	"github.com/gorilla/securecookie"
 
@@ -17,28 +21,78 @@ import (
 // dev는 현재 개발모드인지를 나타낸다.
 var dev bool
 
-func main() {
-	dev = true
+// trashRetention은 휴지통의 항목이 자동으로 완전히 지워지기 전까지 보관되는 기간이다.
+// 0이면 자동으로 지우지 않는다.
+var trashRetention time.Duration
 
+func main() {
 	var (
-		init  bool
-		https string
-		cert  string
-		key   string
+		configFile    string
+		printConf     bool
+		init          bool
+		reindex       bool
+		verify        bool
+		backup        string
+		restore       string
+		backupProject string
 	)
+	cfg := defaultConfig()
+	flag.StringVar(&configFile, "config", "", "config file to read. if not specified, ROI_CONFIG environment variable or roi.json if exists.")
+	flag.BoolVar(&printConf, "print-config", false, "print effective config from default, config file, environment variables and flags, then exit.")
 	flag.BoolVar(&init, "init", false, "setup roi.")
-	flag.StringVar(&https, "https", ":443", "address to open https port. it doesn't offer http for security reason.")
-	flag.StringVar(&cert, "cert", "cert/cert.pem", "https cert file. default one for testing will created by -init.")
-	flag.StringVar(&key, "key", "cert/key.pem", "https key file. default one for testing will created by -init.")
+	flag.BoolVar(&reindex, "reindex", false, "rebuild full text search index from all shots and versions, then exit.")
+	flag.BoolVar(&verify, "verify", false, "verify recorded version files are not missing or modified, then exit.")
+	flag.DurationVar((*time.Duration)(&cfg.VerifyInterval), "verify-interval", time.Duration(cfg.VerifyInterval), "verify recorded version files periodically while running. 0 means no periodic verification.")
+	flag.StringVar(&backup, "backup", "", "write a backup of db and user data files to the file, then exit.")
+	flag.StringVar(&restore, "restore", "", "verify the backup file, and restore db and user data files from it, then exit. current data will be replaced.")
+	flag.StringVar(&backupProject, "backup-project", "", "limit -backup or -restore to the project.")
+	flag.StringVar(&cfg.HTTPS, "https", cfg.HTTPS, "address to open https port. it doesn't offer http for security reason.")
+	flag.StringVar(&cfg.Cert, "cert", cfg.Cert, "https cert file. default one for testing will created here by -init.")
+	flag.StringVar(&cfg.Key, "key", cfg.Key, "https key file. default one for testing will created here by -init.")
+	flag.Var(pathListFlag{&cfg.StorageRoots}, "storage-roots", "directories, separated by os path list separator, that roi could serve version media files from.")
+	flag.Var(pathListFlag{&cfg.DeliveryRoots}, "delivery-roots", "directories, separated by os path list separator, that deliveries could be written under.")
+	flag.StringVar(&cfg.ArchiveDir, "archive-dir", cfg.ArchiveDir, "directory that project bundles are written to when projects are archived.")
+	flag.StringVar(&cfg.Watch, "watch", cfg.Watch, "watch folders to ingest versions from. comma separated project=dir pairs. ex) TEST=/delivery/TEST")
+	flag.DurationVar((*time.Duration)(&cfg.WatchInterval), "watch-interval", time.Duration(cfg.WatchInterval), "interval to scan watch folders. files modified within the interval are not ingested yet.")
+	flag.DurationVar((*time.Duration)(&cfg.TrashRetention), "trash-retention", time.Duration(cfg.TrashRetention), "how long deleted shots, tasks and versions are kept in trash before purged automatically. 0 means keep forever.")
+	flag.BoolVar(&cfg.Dev, "dev", cfg.Dev, "run in development mode. templates are reloaded on every request.")
 	flag.Parse()
+	if err := loadConfig(cfg, configFile); err != nil {
+		log.Fatal(err)
+	}
+	// 설정 파일과 환경변수가 플래그로 지정한 값을 덮어썼으므로
+	// 플래그를 다시 파싱해 명령줄에서 지정한 값이 우선하게 한다.
+	flag.CommandLine.Parse(os.Args[1:])
+
+	if printConf {
+		if err := printConfig(os.Stdout, cfg); err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
 
-	hashFile := "cert/cookie.hash"
-	blockFile := "cert/cookie.block"
+	roi.DBAddr = cfg.DBAddr
+	roi.DBRootAddr = cfg.DBRootAddr
+	roi.DBMaxOpenConns = cfg.DBMaxOpenConns
+	roi.DBMaxIdleConns = cfg.DBMaxIdleConns
+	roi.DBConnMaxLifetime = time.Duration(cfg.DBConnMaxLifetime)
+	roi.UserDataDir = cfg.UserDataDir
+	roi.StorageRoots = cfg.StorageRoots
+	roi.DeliveryRoots = cfg.DeliveryRoots
+	roi.ArchiveDir = cfg.ArchiveDir
+	dev = cfg.Dev
+	trashRetention = time.Duration(cfg.TrashRetention)
+	templateDir = cfg.TemplateDir
+	sessionLifetime = time.Duration(cfg.SessionLifetime)
+	sessionIdleTimeout = time.Duration(cfg.SessionIdleTimeout)
+
+	hashFile := cfg.CookieHashFile
+	blockFile := cfg.CookieBlockFile
 
 	if init {
-		// 기본 Self Signed Certificate는 항상 정해진 위치에 생성되어야 한다.
-		cert := "cert/cert.pem"
-		key := "cert/key.pem"
+		// 기본 Self Signed Certificate는 설정된 인증서와 키 파일 위치에 생성한다.
+		cert := cfg.Cert
+		key := cfg.Key
 		// 해당 위치에 이미 파일이 생성되어 있다면 건너 뛴다.
 		// 사용자가 직접 추가한 인증서 파일을 덮어쓰는 위험을 없애기 위함이다.
 		exist, err := anyFileExist(cert, key)
@@ -49,9 +103,7 @@ func main() {
 			log.Print("already have certificate file. will not create.")
 		} else {
 			// cert와 key가 없다. 인증서 생성.
-			c := exec.Command("sh", "generate-self-signed-cert.sh")
-			c.Dir = "cert"
-			_, err := c.CombinedOutput()
+			err := generateCert(cert, key)
 			if err != nil {
 				log.Fatal("error generating certificate files: ", err)
 			}
@@ -75,6 +127,87 @@ func main() {
 		log.Fatalf("could not initialize database: %v", err)
 	}
 
+	if reindex {
+		db, err := roi.DB()
+		if err != nil {
+			log.Fatalf("could not connect to database: %v", err)
+		}
+		if err := roi.ReindexSearch(db); err != nil {
+			log.Fatalf("could not rebuild search index: %v", err)
+		}
+		return
+	}
+
+	if verify {
+		db, err := roi.DB()
+		if err != nil {
+			log.Fatalf("could not connect to database: %v", err)
+		}
+		bad, err := roi.VerifyVersionFiles(db, "")
+		if err != nil {
+			log.Fatalf("could not verify version files: %v", err)
+		}
+		for _, f := range bad {
+			fmt.Printf("%s\t%s.%s.%s.v%03d\t%s\n", f.Status, f.Project, f.Shot, f.Task, f.Version, f.Path)
+		}
+		if len(bad) != 0 {
+			os.Exit(1)
+		}
+		return
+	}
+
+	if backup != "" {
+		db, err := roi.DB()
+		if err != nil {
+			log.Fatalf("could not connect to database: %v", err)
+		}
+		if err := roi.Backup(db, backup, backupProject); err != nil {
+			log.Fatalf("could not backup: %v", err)
+		}
+		return
+	}
+
+	if restore != "" {
+		db, err := roi.DB()
+		if err != nil {
+			log.Fatalf("could not connect to database: %v", err)
+		}
+		m, err := roi.RestoreBackup(db, restore, backupProject)
+		if err != nil {
+			log.Fatalf("could not restore: %v", err)
+		}
+		log.Printf("restored from backup created at %s", m.Created.Format(time.RFC3339))
+		return
+	}
+
+	if cfg.VerifyInterval > 0 {
+		go verifyVersionFilesEvery(time.Duration(cfg.VerifyInterval))
+	}
+
+	if trashRetention > 0 {
+		go purgeExpiredTrashEvery(time.Hour, trashRetention)
+	}
+
+	go deleteExpiredSessionsEvery(time.Hour)
+
+	if cfg.Watch != "" {
+		dirs, err := parseWatchDirs(cfg.Watch)
+		if err != nil {
+			log.Fatalf("invalid watch config: %v", err)
+		}
+		go ingestWatchDirsEvery(dirs, time.Duration(cfg.WatchInterval))
+	}
+
+	// 서버가 쓸 DB 핸들러를 미리 열어 접속할 수 있는지 확인한다.
+	// 핸들러들은 roi.DB()로 이 핸들러를 공유한다.
+	db, err := roi.DB()
+	if err != nil {
+		log.Fatalf("could not connect to database: %v", err)
+	}
+	if err := db.Ping(); err != nil {
+		log.Fatalf("could not connect to database: %v", err)
+	}
+
 	parseTemplate()
 
 	hashKey, err := ioutil.ReadFile(hashFile)
@@ -89,41 +222,113 @@ func main() {
 		hashKey,
 		blockKey,
 	)
+	cookieHandler.MaxAge(int(sessionLifetime / time.Second))
 
 	mux := http.NewServeMux()
 	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
 		if r.URL.Path != "/" {
 			// 정의되지 않은 페이지로의 이동을 차단
-			http.Error(w, "page not found", http.StatusNotFound)
+			httpError(w, r, "page not found", http.StatusNotFound)
 			return
 		}
 		rootHandler(w, r)
 	})
 	mux.HandleFunc("/login/", loginHandler)
 	mux.HandleFunc("/logout/", logoutHandler)
+	mux.HandleFunc("/logout-all", logoutAllHandler)
 	mux.HandleFunc("/settings/profile", profileHandler)
 	mux.HandleFunc("/update-password", updatePasswordHandler)
+	mux.HandleFunc("/settings/api-token", apiTokenHandler)
 	mux.HandleFunc("/signup", signupHandler)
 	mux.HandleFunc("/projects", projectsHandler)
 	mux.HandleFunc("/add-project", addProjectHandler)
 	mux.HandleFunc("/update-project", updateProjectHandler)
+	mux.HandleFunc("/archive-project", archiveProjectHandler)
+	mux.HandleFunc("/archived-projects", archivedProjectsHandler)
+	mux.HandleFunc("/unarchive-project", unarchiveProjectHandler)
+	mux.HandleFunc("/restore-project", restoreProjectHandler)
+	mux.HandleFunc("/project-archive/", projectArchiveHandler)
+	mux.HandleFunc("/project-templates", projectTemplatesHandler)
+	mux.HandleFunc("/add-project-template", addProjectTemplateHandler)
+	mux.HandleFunc("/delete-project-template", deleteProjectTemplateHandler)
 	mux.HandleFunc("/search/", searchHandler)
+	mux.HandleFunc("/find", findHandler)
+	mux.HandleFunc("/saved-search/", savedSearchHandler)
+	mux.HandleFunc("/add-saved-search", addSavedSearchHandler)
+	mux.HandleFunc("/delete-saved-search", deleteSavedSearchHandler)
+	mux.HandleFunc("/dashboard/", dashboardHandler)
+	mux.HandleFunc("/add-dashboard", addDashboardHandler)
+	mux.HandleFunc("/delete-dashboard", deleteDashboardHandler)
 	mux.HandleFunc("/add-shot/", addShotHandler)
 	mux.HandleFunc("/update-shot", updateShotHandler)
+	mux.HandleFunc("/rename-shot", editShotHandler)
+	mux.HandleFunc("/split-shot", editShotHandler)
+	mux.HandleFunc("/merge-shot", editShotHandler)
+	mux.HandleFunc("/upload-thumbnail", uploadThumbnailHandler)
 	mux.HandleFunc("/update-task", updateTaskHandler)
 	mux.HandleFunc("/version/", versionHandler)
 	mux.HandleFunc("/add-version", addVersionHandler)
 	mux.HandleFunc("/update-version", updateVersionHandler)
+	mux.HandleFunc("/add-review", addReviewHandler)
+	mux.HandleFunc("/contact-sheet/", contactSheetHandler)
+	mux.HandleFunc("/media", mediaHandler)
+	mux.HandleFunc("/frames", framesHandler)
+	mux.HandleFunc("/playlists/", playlistsHandler)
+	mux.HandleFunc("/playlist/", playlistHandler)
+	mux.HandleFunc("/add-playlist", addPlaylistHandler)
+	mux.HandleFunc("/update-playlist", updatePlaylistHandler)
+	mux.HandleFunc("/add-to-playlist", addToPlaylistHandler)
+	mux.HandleFunc("/delete-playlist", deletePlaylistHandler)
+	mux.HandleFunc("/review-session/", reviewSessionHandler)
+	mux.HandleFunc("/start-review-session", startReviewSessionHandler)
+	mux.HandleFunc("/set-review-verdict", setReviewVerdictHandler)
+	mux.HandleFunc("/publish-review-session", publishReviewSessionHandler)
+	mux.HandleFunc("/notifications", notificationsHandler)
+	mux.HandleFunc("/clear-notifications", clearNotificationsHandler)
+	mux.HandleFunc("/deliveries/", deliveriesHandler)
+	mux.HandleFunc("/delivery/", deliveryHandler)
+	mux.HandleFunc("/add-delivery", addDeliveryHandler)
+	mux.HandleFunc("/vendors", vendorsHandler)
+	mux.HandleFunc("/add-vendor", addVendorHandler)
+	mux.HandleFunc("/update-vendor", updateVendorHandler)
+	mux.HandleFunc("/vendor-tasks/", vendorTasksHandler)
+	mux.HandleFunc("/assign-vendor-task", assignVendorTaskHandler)
+	mux.HandleFunc("/send-vendor-package", sendVendorPackageHandler)
+	mux.HandleFunc("/ingest-vendor-return", ingestVendorReturnHandler)
+	mux.HandleFunc("/trash/", trashHandler)
+	mux.HandleFunc("/trash-shot", trashItemHandler)
+	mux.HandleFunc("/trash-task", trashItemHandler)
+	mux.HandleFunc("/trash-version", trashItemHandler)
+	mux.HandleFunc("/restore-trash", restoreTrashHandler)
+	mux.HandleFunc("/purge-trash", purgeTrashHandler)
+	mux.HandleFunc("/quarantine/", quarantineHandler)
+	mux.HandleFunc("/delete-quarantined", deleteQuarantinedHandler)
 	mux.HandleFunc("/api/v1/project/add", addProjectApiHandler)
 	mux.HandleFunc("/api/v1/shot/add", addShotApiHandler)
-	fs := http.FileServer(http.Dir("static"))
+	mux.HandleFunc("/api/v1/shot/rename", renameShotApiHandler)
+	mux.HandleFunc("/api/v1/shot/split", splitShotApiHandler)
+	mux.HandleFunc("/api/v1/shot/merge", mergeShotApiHandler)
+	mux.HandleFunc("/api/v1/shot/resolve", resolveShotApiHandler)
+	mux.HandleFunc("/api/v1/shot/thumbnail", uploadThumbnailApiHandler)
+	mux.HandleFunc("/api/v1/find", findApiHandler)
+	mux.HandleFunc("/api/v1/path", pathApiHandler)
+	mux.HandleFunc("/api/v1/version/next", nextVersionApiHandler)
+	mux.HandleFunc("/api/v1/version/add", addVersionApiHandler)
+	mux.HandleFunc("/api/v1/saved-search/add", addSavedSearchApiHandler)
+	mux.HandleFunc("/api/v1/saved-search/shots", savedSearchShotsApiHandler)
+	mux.HandleFunc("/api/v1/dashboard/get", dashboardApiHandler)
+	fs := http.FileServer(http.Dir(cfg.StaticDir))
 	mux.Handle("/static/", http.StripPrefix("/static/", fs))
-	thumbfs := http.FileServer(http.Dir("roi-userdata/thumbnail"))
+	thumbfs := http.FileServer(http.Dir(filepath.Join(roi.UserDataDir, "thumbnail")))
 	mux.Handle("/thumbnail/", http.StripPrefix("/thumbnail/", thumbfs))
+	vthumbfs := http.FileServer(http.Dir(filepath.Join(roi.UserDataDir, "version-thumbnail")))
+	mux.Handle("/version-thumbnail/", http.StripPrefix("/version-thumbnail/", vthumbfs))
+	annofs := http.FileServer(http.Dir(filepath.Join(roi.UserDataDir, "annotation")))
+	mux.Handle("/annotation/", http.StripPrefix("/annotation/", annofs))
 
 	// Show https binding information
 	addrToShow := "https://"
-	addrs := strings.Split(https, ":")
+	addrs := strings.Split(cfg.HTTPS, ":")
 	if len(addrs) == 2 {
 		if addrs[0] == "" {
 			addrToShow += "localhost"
@@ -139,5 +344,159 @@ func main() {
 	fmt.Println()
 
 	// Bind
-	log.Fatal(http.ListenAndServeTLS(https, cert, key, mux))
+	log.Fatal(http.ListenAndServeTLS(cfg.HTTPS, cfg.Cert, cfg.Key, withRecovery(withRequestTimeout(withSession(mux), time.Duration(cfg.RequestTimeout)))))
+}
+
+// verifyVersionFilesEvery는 주기적으로 모든 버전 파일을 검사해
+// 없거나 수정된 파일이 있으면 로그로 남긴다.
+func verifyVersionFilesEvery(d time.Duration) {
+	for range time.Tick(d) {
+		db, err := roi.DB()
+		if err != nil {
+			log.Printf("could not connect to database: %v", err)
+			continue
+		}
+		bad, err := roi.VerifyVersionFiles(db, "")
+		if err != nil {
+			log.Printf("could not verify version files: %v", err)
+			continue
+		}
+		for _, f := range bad {
+			log.Printf("version file %s: %s.%s.%s.v%03d: %s", f.Status, f.Project, f.Shot, f.Task, f.Version, f.Path)
+		}
+	}
+}
+
+// purgeExpiredTrashEvery는 주기적으로 retention보다 오래 휴지통에 있던 항목들을 완전히 지운다.
+func purgeExpiredTrashEvery(d, retention time.Duration) {
+	for range time.Tick(d) {
+		db, err := roi.DB()
+		if err != nil {
+			log.Printf("could not connect to database: %v", err)
+			continue
+		}
+		n, err := roi.PurgeExpiredTrash(db, time.Now().Add(-retention))
+		if err != nil {
+			log.Printf("could not purge expired trash: %v", err)
+		}
+		if n != 0 {
+			log.Printf("purged %d expired trash items", n)
+		}
+	}
+}
+
+// deleteExpiredSessionsEvery는 d 간격으로 만료되었거나 오래 쓰이지 않은 세션들을 DB에서 지운다.
+func deleteExpiredSessionsEvery(d time.Duration) {
+	for range time.Tick(d) {
+		db, err := roi.DB()
+		if err != nil {
+			log.Printf("could not connect to database: %v", err)
+			continue
+		}
+		// sessionIdleTimeout이 0이면 세션이 쓰이지 않아도 만료되지 않으므로 만료된 세션만 지운다.
+		idleBefore := time.Time{}
+		if sessionIdleTimeout > 0 {
+			idleBefore = time.Now().Add(-sessionIdleTimeout)
+		}
+		n, err := roi.DeleteExpiredSessions(db, idleBefore)
+		if err != nil {
+			log.Printf("could not delete expired sessions: %v", err)
+		}
+		if n != 0 {
+			log.Printf("deleted %d expired sessions", n)
+		}
+	}
+}
+
+// parseWatchDirs는 -watch 플래그 값을 프로젝트와 와치 폴더의 맵으로 바꾼다.
+// 값은 쉼표로 구분된 project=dir 쌍이다.
+func parseWatchDirs(watch string) (map[string]string, error) {
+	dirs := make(map[string]string)
+	for _, w := range fields(watch, ",") {
+		kv := strings.SplitN(w, "=", 2)
+		if len(kv) != 2 || kv[1] == "" {
+			return nil, fmt.Errorf("should be project=dir form: %s", w)
+		}
+		if !roi.IsValidProject(kv[0]) {
+			return nil, fmt.Errorf("invalid project: %s", kv[0])
+		}
+		dirs[kv[0]] = kv[1]
+	}
+	return dirs, nil
+}
+
+// ingestWatchDirsEvery는 주기적으로 와치 폴더들의 파일을 각 프로젝트의 버전으로 등록한다.
+// 검사 주기 안에 수정된 파일은 아직 쓰여지고 있다고 보고 다음 검사 때 등록한다.
+func ingestWatchDirsEvery(dirs map[string]string, d time.Duration) {
+	for range time.Tick(d) {
+		db, err := roi.DB()
+		if err != nil {
+			log.Printf("could not connect to database: %v", err)
+			continue
+		}
+		for prj, dir := range dirs {
+			items, err := roi.Ingest(db, prj, dir, d)
+			if err != nil {
+				log.Printf("could not ingest %s: %v", dir, err)
+				continue
+			}
+			for _, it := range items {
+				log.Printf("ingested %s.%s.%s.v%03d: %s", prj, it.Shot, it.Task, it.Version, it.Path)
+			}
+		}
+	}
+}
+
+// withRequestTimeout은 요청의 컨텍스트에 d 만큼의 제한 시간을 두어 h를 실행하는 핸들러를 반환한다.
+// 시간이 지나면 해당 요청에서 진행중인 DB 작업이 취소된다. d가 0이면 h를 그대로 반환한다.
+func withRequestTimeout(h http.Handler, d time.Duration) http.Handler {
+	if d <= 0 {
+		return h
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx, cancel := context.WithTimeout(r.Context(), d)
+		defer cancel()
+		h.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// generateCert는 cert/generate-self-signed-cert.sh로 테스트용 인증서와 키를 만들어
+// cert, key 경로에 저장한다. 필요하다면 상위 디렉토리를 만든다.
+func generateCert(cert, key string) error {
+	script, err := filepath.Abs("cert/generate-self-signed-cert.sh")
+	if err != nil {
+		return err
+	}
+	tmpd, err := ioutil.TempDir("", "roi-cert-")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(tmpd)
+	c := exec.Command("sh", script)
+	c.Dir = tmpd
+	out, err := c.CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("%v: %s", err, strings.TrimSpace(string(out)))
+	}
+	gen := []struct {
+		src  string
+		dst  string
+		perm os.FileMode
+	}{
+		{"cert.pem", cert, 0644},
+		{"key.pem", key, 0600},
+	}
+	for _, g := range gen {
+		data, err := ioutil.ReadFile(filepath.Join(tmpd, g.src))
+		if err != nil {
+			return err
+		}
+		if err := os.MkdirAll(filepath.Dir(g.dst), 0755); err != nil {
+			return err
+		}
+		if err := ioutil.WriteFile(g.dst, data, g.perm); err != nil {
+			return err
+		}
+	}
+	return nil
 }
@@ -0,0 +1,132 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+
+	"github.com/studio2l/roi"
+)
+
+// mediaHandler는 /media 로 사용자가 접속했을때 path 질의로 받은 미디어 파일을 반환한다.
+// 로그인한 사용자에게만, roi.StorageRoots 아래의 파일만 제공한다.
+// Range 요청을 지원하기 때문에 브라우저에서 영상을 탐색할 수 있다.
+func mediaHandler(w http.ResponseWriter, r *http.Request) {
+	session, err := getSession(r)
+	if err != nil {
+		httpError(w, r, "could not get session", http.StatusUnauthorized)
+		clearSession(w)
+		return
+	}
+	if session["userid"] == "" {
+		httpError(w, r, "need login", http.StatusUnauthorized)
+		return
+	}
+	pth := r.FormValue("path")
+	if pth == "" {
+		httpError(w, r, "need 'path'", http.StatusBadRequest)
+		return
+	}
+	rpth, err := roi.ResolveMediaPath(pth)
+	if err != nil {
+		log.Printf("could not serve media: %v", err)
+		httpError(w, r, "media not found", http.StatusNotFound)
+		return
+	}
+	f, err := os.Open(rpth)
+	if err != nil {
+		log.Printf("could not open media: %v", err)
+		httpError(w, r, "media not found", http.StatusNotFound)
+		return
+	}
+	defer f.Close()
+	fi, err := f.Stat()
+	if err != nil {
+		handleError(w, r, fmt.Errorf("could not get media file info: %w", err))
+		return
+	}
+	if fi.IsDir() {
+		httpError(w, r, "media not found", http.StatusNotFound)
+		return
+	}
+	// ServeContent가 파일 이름으로 Content-Type을 정하고 Range 요청을 처리한다.
+	http.ServeContent(w, r, filepath.Base(rpth), fi.ModTime(), f)
+}
+
+// framesHandler는 /frames 로 사용자가 접속했을때 path 질의로 받은
+// 이미지 시퀀스의 프레임을 하나씩 볼 수 있는 페이지를 반환한다.
+// 보일 프레임 번호는 frame 질의로 받으며, 없으면 첫 프레임을 보인다.
+func framesHandler(w http.ResponseWriter, r *http.Request) {
+	session, err := getSession(r)
+	if err != nil {
+		httpError(w, r, "could not get session", http.StatusUnauthorized)
+		clearSession(w)
+		return
+	}
+	if session["userid"] == "" {
+		httpError(w, r, "need login", http.StatusUnauthorized)
+		return
+	}
+	r.ParseForm()
+	pth := r.Form.Get("path")
+	if !roi.IsImageSequence(pth) {
+		httpError(w, r, fmt.Sprintf("not an image sequence: %s", pth), http.StatusBadRequest)
+		return
+	}
+	// 시퀀스가 있는 디렉토리도 저장소 루트 안에 있어야 한다.
+	if _, err := roi.ResolveMediaPath(filepath.Dir(pth)); err != nil {
+		log.Printf("could not serve image sequence: %v", err)
+		httpError(w, r, "image sequence not found", http.StatusNotFound)
+		return
+	}
+	frames, err := roi.ImageSequenceFrames(pth)
+	if err != nil {
+		log.Printf("could not get image sequence frames: %v", err)
+		httpError(w, r, "image sequence not found", http.StatusNotFound)
+		return
+	}
+	if len(frames) == 0 {
+		httpError(w, r, "image sequence has no frame", http.StatusNotFound)
+		return
+	}
+	cur := 0
+	if f := r.Form.Get("frame"); f != "" {
+		n, err := strconv.Atoi(f)
+		if err != nil {
+			httpError(w, r, "'frame' is not a number", http.StatusBadRequest)
+			return
+		}
+		for i := range frames {
+			if frames[i].Frame == n {
+				cur = i
+				break
+			}
+		}
+	}
+	recipt := struct {
+		LoggedInUser string
+		Path         string
+		Frames       []roi.SequenceFrame
+		Current      roi.SequenceFrame
+		Prev         *roi.SequenceFrame
+		Next         *roi.SequenceFrame
+	}{
+		LoggedInUser: session["userid"],
+		Path:         pth,
+		Frames:       frames,
+		Current:      frames[cur],
+	}
+	if cur > 0 {
+		recipt.Prev = &frames[cur-1]
+	}
+	if cur < len(frames)-1 {
+		recipt.Next = &frames[cur+1]
+	}
+	err = executeTemplate(w, r, "frames.html", recipt)
+	if err != nil {
+		handleError(w, r, err)
+	}
+}
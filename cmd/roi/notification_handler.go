@@ -0,0 +1,70 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/studio2l/roi"
+)
+
+// notificationsHandler는 /notifications 페이지로 사용자가 접속했을때 사용자의 알림을 보여준다.
+func notificationsHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	db, err := roi.DB()
+	if err != nil {
+		handleError(w, r, fmt.Errorf("could not connect to database: %w", err))
+		return
+	}
+	session, err := getSession(r)
+	if err != nil {
+		httpError(w, r, "could not get session", http.StatusUnauthorized)
+		clearSession(w)
+		return
+	}
+	if session == nil || session["userid"] == "" {
+		http.Redirect(w, r, "/login", http.StatusSeeOther)
+		return
+	}
+	ns, err := roi.UserNotificationsContext(ctx, db, session["userid"])
+	if err != nil {
+		handleError(w, r, fmt.Errorf("could not get notifications: %w", err))
+		return
+	}
+	recipt := struct {
+		LoggedInUser  string
+		Notifications []*roi.Notification
+	}{
+		LoggedInUser:  session["userid"],
+		Notifications: ns,
+	}
+	err = executeTemplate(w, r, "notifications.html", recipt)
+	if err != nil {
+		handleError(w, r, err)
+	}
+}
+
+// clearNotificationsHandler는 사용자의 알림을 모두 지운다.
+func clearNotificationsHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	if r.Method != "POST" {
+		httpError(w, r, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	db, err := roi.DB()
+	if err != nil {
+		handleError(w, r, fmt.Errorf("could not connect to database: %w", err))
+		return
+	}
+	session, err := getSession(r)
+	if err != nil || session["userid"] == "" {
+		httpError(w, r, "could not get session", http.StatusUnauthorized)
+		clearSession(w)
+		return
+	}
+	err = roi.ClearNotificationsContext(ctx, db, session["userid"])
+	if err != nil {
+		handleError(w, r, fmt.Errorf("could not clear notifications: %w", err))
+		return
+	}
+	http.Redirect(w, r, "/notifications", http.StatusSeeOther)
+}
@@ -0,0 +1,437 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/studio2l/roi"
+)
+
+// playlistsHandler는 /playlists/<project> 페이지로 사용자가 접속했을때
+// 프로젝트의 플레이리스트 목록과 새 플레이리스트를 만드는 폼을 보여준다.
+func playlistsHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	db, err := roi.DB()
+	if err != nil {
+		handleError(w, r, fmt.Errorf("could not connect to database: %w", err))
+		return
+	}
+	session, err := getSession(r)
+	if err != nil {
+		httpError(w, r, "could not get session", http.StatusUnauthorized)
+		clearSession(w)
+		return
+	}
+	prj := r.URL.Path[len("/playlists/"):]
+	exist, err := roi.ProjectExistContext(ctx, db, prj)
+	if err != nil {
+		handleError(w, r, fmt.Errorf("could not check project '%s' exist: %w", prj, err))
+		return
+	}
+	if !exist {
+		httpError(w, r, fmt.Sprintf("project '%s' not exist", prj), http.StatusNotFound)
+		return
+	}
+	ps, err := roi.ProjectPlaylistsContext(ctx, db, prj)
+	if err != nil {
+		handleError(w, r, fmt.Errorf("could not get playlists: %w", err))
+		return
+	}
+	recipt := struct {
+		LoggedInUser string
+		Project      string
+		Playlists    []*roi.Playlist
+		Today        time.Time
+	}{
+		LoggedInUser: session["userid"],
+		Project:      prj,
+		Playlists:    ps,
+		Today:        today(),
+	}
+	err = executeTemplate(w, r, "playlists.html", recipt)
+	if err != nil {
+		handleError(w, r, err)
+	}
+}
+
+// today는 오늘 0시의 시간을 반환한다.
+func today() time.Time {
+	y, m, d := time.Now().Date()
+	return time.Date(y, m, d, 0, 0, 0, 0, time.Local)
+}
+
+// playlistItemID는 플레이리스트 항목을 폼에서 주고받기 위한 아이디이다.
+// 예) CG_0010/fx/3
+func playlistItemID(shot, task string, version int) string {
+	return shot + "/" + task + "/" + strconv.Itoa(version)
+}
+
+// playlistItemFromID는 플레이리스트 항목 아이디를 항목으로 바꾼다.
+func playlistItemFromID(id string) (*roi.PlaylistItem, error) {
+	ids := strings.Split(id, "/")
+	if len(ids) != 3 {
+		return nil, fmt.Errorf("invalid playlist item id: %s", id)
+	}
+	v, err := strconv.Atoi(ids[2])
+	if err != nil {
+		return nil, fmt.Errorf("invalid version in playlist item id: %s", id)
+	}
+	return &roi.PlaylistItem{Shot: ids[0], Task: ids[1], Version: v}, nil
+}
+
+// playlistItemsFromForm은 폼의 item 값들을 플레이리스트 항목으로 바꾼다.
+func playlistItemsFromForm(form url.Values) ([]*roi.PlaylistItem, error) {
+	items := make([]*roi.PlaylistItem, 0)
+	for _, id := range form["item"] {
+		it, err := playlistItemFromID(id)
+		if err != nil {
+			return nil, err
+		}
+		items = append(items, it)
+	}
+	return items, nil
+}
+
+// addPlaylistHandler는 사용자가 POST로 보낸 이름과 날짜로 플레이리스트를 만든다.
+// from_ask_confirm이 on이면 어제부터 컨펌요청된 버전들로 플레이리스트를 채운다.
+func addPlaylistHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	if r.Method != "POST" {
+		httpError(w, r, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	db, err := roi.DB()
+	if err != nil {
+		handleError(w, r, fmt.Errorf("could not connect to database: %w", err))
+		return
+	}
+	session, err := getSession(r)
+	if err != nil || session["userid"] == "" {
+		httpError(w, r, "could not get session", http.StatusUnauthorized)
+		clearSession(w)
+		return
+	}
+	r.ParseForm()
+	prj := r.Form.Get("project")
+	name := strings.TrimSpace(r.Form.Get("name"))
+	if !roi.IsValidPlaylistName(name) {
+		httpError(w, r, fmt.Sprintf("invalid playlist name '%s'", name), http.StatusBadRequest)
+		return
+	}
+	tforms, err := parseTimeForms(r.Form, "date")
+	if err != nil {
+		httpError(w, r, err.Error(), http.StatusBadRequest)
+		return
+	}
+	exist, err := roi.ProjectExistContext(ctx, db, prj)
+	if err != nil {
+		handleError(w, r, fmt.Errorf("could not check project '%s' exist: %w", prj, err))
+		return
+	}
+	if !exist {
+		httpError(w, r, fmt.Sprintf("project '%s' not exist", prj), http.StatusNotFound)
+		return
+	}
+	exist, err = roi.PlaylistExistContext(ctx, db, prj, name)
+	if err != nil {
+		handleError(w, r, fmt.Errorf("could not check playlist '%s' exist: %w", name, err))
+		return
+	}
+	if exist {
+		httpError(w, r, fmt.Sprintf("playlist '%s' already exist", name), http.StatusConflict)
+		return
+	}
+	p := &roi.Playlist{
+		Project: prj,
+		Name:    name,
+		Date:    tforms["date"],
+		Items:   make([]*roi.PlaylistItem, 0),
+	}
+	if p.Date.IsZero() {
+		p.Date = today()
+	}
+	if r.Form.Get("from_ask_confirm") == "on" {
+		vs, err := roi.AskConfirmVersionsContext(ctx, db, prj, today().AddDate(0, 0, -1))
+		if err != nil {
+			handleError(w, r, fmt.Errorf("could not get ask-confirm versions: %w", err))
+			return
+		}
+		for _, v := range vs {
+			p.Items = append(p.Items, &roi.PlaylistItem{Shot: v.Shot, Task: v.Task, Version: v.Version})
+		}
+	}
+	err = roi.AddPlaylistContext(ctx, db, p)
+	if err != nil {
+		handleError(w, r, fmt.Errorf("could not add playlist: %w", err))
+		return
+	}
+	http.Redirect(w, r, "/playlist/"+prj+"/"+url.PathEscape(name), http.StatusSeeOther)
+}
+
+// addToPlaylistHandler는 /search/ 페이지에서 선택한 버전들을 플레이리스트에 추가한다.
+// 해당 이름의 플레이리스트가 없다면 오늘 날짜로 새로 만든다.
+func addToPlaylistHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	if r.Method != "POST" {
+		httpError(w, r, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	db, err := roi.DB()
+	if err != nil {
+		handleError(w, r, fmt.Errorf("could not connect to database: %w", err))
+		return
+	}
+	session, err := getSession(r)
+	if err != nil || session["userid"] == "" {
+		httpError(w, r, "could not get session", http.StatusUnauthorized)
+		clearSession(w)
+		return
+	}
+	r.ParseForm()
+	prj := r.Form.Get("project")
+	name := strings.TrimSpace(r.Form.Get("playlist"))
+	if !roi.IsValidPlaylistName(name) {
+		httpError(w, r, fmt.Sprintf("invalid playlist name '%s'", name), http.StatusBadRequest)
+		return
+	}
+	items, err := playlistItemsFromForm(r.Form)
+	if err != nil {
+		httpError(w, r, err.Error(), http.StatusBadRequest)
+		return
+	}
+	exist, err := roi.ProjectExistContext(ctx, db, prj)
+	if err != nil {
+		handleError(w, r, fmt.Errorf("could not check project '%s' exist: %w", prj, err))
+		return
+	}
+	if !exist {
+		httpError(w, r, fmt.Sprintf("project '%s' not exist", prj), http.StatusNotFound)
+		return
+	}
+	exist, err = roi.PlaylistExistContext(ctx, db, prj, name)
+	if err != nil {
+		handleError(w, r, fmt.Errorf("could not check playlist '%s' exist: %w", name, err))
+		return
+	}
+	if exist {
+		err = roi.AddPlaylistItemsContext(ctx, db, prj, name, items)
+	} else {
+		err = roi.AddPlaylistContext(ctx, db, &roi.Playlist{Project: prj, Name: name, Date: today(), Items: items})
+	}
+	if err != nil {
+		handleError(w, r, fmt.Errorf("could not add items to playlist '%s': %w", name, err))
+		return
+	}
+	http.Redirect(w, r, "/playlist/"+prj+"/"+url.PathEscape(name), http.StatusSeeOther)
+}
+
+// playlistHandler는 /playlist/<project>/<name> 페이지로 사용자가 접속했을때
+// 플레이리스트의 항목들을 보여준다.
+// format 질의가 csv, edl, otio 중 하나라면 페이지 대신 해당 형식의 파일을 내려받게 한다.
+func playlistHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	db, err := roi.DB()
+	if err != nil {
+		handleError(w, r, fmt.Errorf("could not connect to database: %w", err))
+		return
+	}
+	session, err := getSession(r)
+	if err != nil {
+		httpError(w, r, "could not get session", http.StatusUnauthorized)
+		clearSession(w)
+		return
+	}
+	ids := strings.SplitN(r.URL.Path[len("/playlist/"):], "/", 2)
+	if len(ids) != 2 || ids[0] == "" || ids[1] == "" {
+		http.NotFound(w, r)
+		return
+	}
+	prj, name := ids[0], ids[1]
+	p, err := roi.GetPlaylistContext(ctx, db, prj, name)
+	if err != nil {
+		handleError(w, r, fmt.Errorf("could not get playlist '%s/%s': %w", prj, name, err))
+		return
+	}
+	if p == nil {
+		httpError(w, r, fmt.Sprintf("playlist '%s/%s' not exist", prj, name), http.StatusNotFound)
+		return
+	}
+	format := r.FormValue("format")
+	if format != "" {
+		clips, err := roi.PlaylistClipsContext(ctx, db, p)
+		if err != nil {
+			handleError(w, r, fmt.Errorf("could not get playlist clips: %w", err))
+			return
+		}
+		fname := prj + "_" + stringFromDate(p.Date) + "_" + p.Name
+		switch format {
+		case "csv":
+			w.Header().Set("Content-Type", "text/csv; charset=utf-8")
+			w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", fname+".csv"))
+			err = roi.WritePlaylistCSV(w, clips)
+		case "edl":
+			w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+			w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", fname+".edl"))
+			err = roi.WritePlaylistEDL(w, fname, clips)
+		case "otio":
+			w.Header().Set("Content-Type", "application/json")
+			w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", fname+".otio"))
+			err = roi.WritePlaylistOTIO(w, prj, fname, clips)
+		default:
+			httpError(w, r, fmt.Sprintf("unknown format '%s'", format), http.StatusBadRequest)
+			return
+		}
+		if err != nil {
+			log.Printf("could not export playlist: %v", err)
+		}
+		return
+	}
+	type item struct {
+		*roi.PlaylistItem
+		ID string
+	}
+	items := make([]item, len(p.Items))
+	for i, it := range p.Items {
+		items[i] = item{PlaylistItem: it, ID: playlistItemID(it.Shot, it.Task, it.Version)}
+	}
+	recipt := struct {
+		LoggedInUser string
+		Project      string
+		Playlist     *roi.Playlist
+		Items        []item
+	}{
+		LoggedInUser: session["userid"],
+		Project:      prj,
+		Playlist:     p,
+		Items:        items,
+	}
+	err = executeTemplate(w, r, "playlist.html", recipt)
+	if err != nil {
+		handleError(w, r, err)
+	}
+}
+
+// updatePlaylistHandler는 플레이리스트 페이지에서 수정한 날짜, 순서, 노트를 저장한다.
+// 폼의 item, order, note 값은 같은 순서로 항목마다 하나씩 있어야 하며,
+// remove 값에 들어있는 항목은 플레이리스트에서 빠진다.
+func updatePlaylistHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	if r.Method != "POST" {
+		httpError(w, r, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	db, err := roi.DB()
+	if err != nil {
+		handleError(w, r, fmt.Errorf("could not connect to database: %w", err))
+		return
+	}
+	session, err := getSession(r)
+	if err != nil || session["userid"] == "" {
+		httpError(w, r, "could not get session", http.StatusUnauthorized)
+		clearSession(w)
+		return
+	}
+	r.ParseForm()
+	prj := r.Form.Get("project")
+	name := r.Form.Get("name")
+	tforms, err := parseTimeForms(r.Form, "date")
+	if err != nil {
+		httpError(w, r, err.Error(), http.StatusBadRequest)
+		return
+	}
+	items, err := playlistItemsFromForm(r.Form)
+	if err != nil {
+		httpError(w, r, err.Error(), http.StatusBadRequest)
+		return
+	}
+	orders := r.Form["order"]
+	notes := r.Form["note"]
+	if len(orders) != len(items) || len(notes) != len(items) {
+		httpError(w, r, "item, order, note should have same length", http.StatusBadRequest)
+		return
+	}
+	remove := make(map[string]bool)
+	for _, id := range r.Form["remove"] {
+		remove[id] = true
+	}
+	type orderedItem struct {
+		order int
+		item  *roi.PlaylistItem
+	}
+	ois := make([]orderedItem, 0, len(items))
+	for i, it := range items {
+		if remove[r.Form["item"][i]] {
+			continue
+		}
+		o, err := strconv.Atoi(orders[i])
+		if err != nil {
+			httpError(w, r, fmt.Sprintf("invalid order '%s'", orders[i]), http.StatusBadRequest)
+			return
+		}
+		it.Note = notes[i]
+		ois = append(ois, orderedItem{order: o, item: it})
+	}
+	sort.SliceStable(ois, func(i, j int) bool {
+		return ois[i].order < ois[j].order
+	})
+	upd := roi.UpdatePlaylistParam{
+		Date:  tforms["date"],
+		Items: make([]*roi.PlaylistItem, len(ois)),
+	}
+	for i, oi := range ois {
+		upd.Items[i] = oi.item
+	}
+	exist, err := roi.PlaylistExistContext(ctx, db, prj, name)
+	if err != nil {
+		handleError(w, r, fmt.Errorf("could not check playlist '%s' exist: %w", name, err))
+		return
+	}
+	if !exist {
+		httpError(w, r, fmt.Sprintf("playlist '%s/%s' not exist", prj, name), http.StatusNotFound)
+		return
+	}
+	err = roi.UpdatePlaylistContext(ctx, db, prj, name, upd)
+	if err != nil {
+		handleError(w, r, fmt.Errorf("could not update playlist: %w", err))
+		return
+	}
+	http.Redirect(w, r, "/playlist/"+prj+"/"+url.PathEscape(name), http.StatusSeeOther)
+}
+
+// deletePlaylistHandler는 사용자가 POST로 보낸 플레이리스트를 지운다.
+func deletePlaylistHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	if r.Method != "POST" {
+		httpError(w, r, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	db, err := roi.DB()
+	if err != nil {
+		handleError(w, r, fmt.Errorf("could not connect to database: %w", err))
+		return
+	}
+	session, err := getSession(r)
+	if err != nil || session["userid"] == "" {
+		httpError(w, r, "could not get session", http.StatusUnauthorized)
+		clearSession(w)
+		return
+	}
+	prj := r.FormValue("project")
+	name := r.FormValue("name")
+	if prj == "" || name == "" {
+		httpError(w, r, "need 'project' and 'name'", http.StatusBadRequest)
+		return
+	}
+	err = roi.DeletePlaylistContext(ctx, db, prj, name)
+	if err != nil {
+		handleError(w, r, fmt.Errorf("could not delete playlist: %w", err))
+		return
+	}
+	http.Redirect(w, r, "/playlists/"+prj, http.StatusSeeOther)
+}
@@ -1,23 +1,27 @@
 package main
 
 import (
+	"context"
+	"database/sql"
 	"fmt"
 	"log"
 	"net/http"
+	"net/url"
+	"strings"
 
 	"github.com/studio2l/roi"
 )
 
 // projectsHandler는 /project 페이지로 사용자가 접속했을때 페이지를 반환한다.
 func projectsHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
 	db, err := roi.DB()
 	if err != nil {
-		log.Printf("could not connect to database: %v", err)
-		http.Error(w, "internal error", http.StatusInternalServerError)
+		handleError(w, r, fmt.Errorf("could not connect to database: %w", err))
 		return
 	}
 
-	prjs, err := roi.AllProjects(db)
+	prjs, err := roi.AllProjectsContext(ctx, db)
 	if err != nil {
 		log.Print(fmt.Sprintf("error while getting projects: %s", err))
 		return
@@ -36,55 +40,56 @@ func projectsHandler(w http.ResponseWriter, r *http.Request) {
 		LoggedInUser: session["userid"],
 		Projects:     prjs,
 	}
-	err = executeTemplate(w, "projects.html", recipt)
+	err = executeTemplate(w, r, "projects.html", recipt)
 	if err != nil {
-		log.Fatal(err)
+		handleError(w, r, err)
 	}
 }
 
 // addProjectHandler는 /add-project 페이지로 사용자가 접속했을때 페이지를 반환한다.
 // 만일 POST로 프로젝트 정보가 오면 프로젝트를 생성한다.
 func addProjectHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
 	db, err := roi.DB()
 	if err != nil {
-		log.Printf("could not connect to database: %v", err)
-		http.Error(w, "internal error", http.StatusInternalServerError)
+		handleError(w, r, fmt.Errorf("could not connect to database: %w", err))
 		return
 	}
 	session, err := getSession(r)
 	if err != nil {
-		http.Error(w, "could not get session", http.StatusUnauthorized)
+		httpError(w, r, "could not get session", http.StatusUnauthorized)
 		clearSession(w)
 		return
 	}
-	u, err := roi.GetUser(db, session["userid"])
+	u, err := roi.GetUserContext(ctx, db, session["userid"])
 	if err != nil {
-		http.Error(w, "could not get user information", http.StatusInternalServerError)
+		httpError(w, r, "could not get user information", http.StatusInternalServerError)
 		clearSession(w)
 		return
 	}
 	if u == nil {
-		http.Error(w, "user not exist", http.StatusBadRequest)
+		httpError(w, r, "user not exist", http.StatusBadRequest)
 		clearSession(w)
 		return
 	}
 	if u.Role != "admin" {
 		// 할일: admin이 아닌 사람은 프로젝트를 생성할 수 없도록 하기
 	}
+	var errs map[string]string
 	if r.Method == "POST" {
 		r.ParseForm()
 		id := r.Form.Get("id")
 		if id == "" {
-			http.Error(w, "need project 'id'", http.StatusBadRequest)
+			httpError(w, r, "need project 'id'", http.StatusBadRequest)
 			return
 		}
-		exist, err := roi.ProjectExist(db, id)
+		exist, err := roi.ProjectExistContext(ctx, db, id)
 		if err != nil {
-			http.Error(w, "internal error", http.StatusInternalServerError)
+			handleError(w, r, err)
 			return
 		}
 		if exist {
-			http.Error(w, fmt.Sprintf("project '%s' exist", id), http.StatusBadRequest)
+			httpError(w, r, fmt.Sprintf("project '%s' exist", id), http.StatusConflict)
 			return
 		}
 		timeForms, err := parseTimeForms(r.Form,
@@ -95,7 +100,7 @@ func addProjectHandler(w http.ResponseWriter, r *http.Request) {
 			"vfx_due_date",
 		)
 		if err != nil {
-			http.Error(w, err.Error(), http.StatusBadRequest)
+			httpError(w, r, err.Error(), http.StatusBadRequest)
 			return
 		}
 		p := &roi.Project{
@@ -117,43 +122,90 @@ func addProjectHandler(w http.ResponseWriter, r *http.Request) {
 			ViewLUT:       r.Form.Get("view_lut"),
 			DefaultTasks:  fields(r.Form.Get("default_tasks"), ","),
 		}
-		err = roi.AddProject(db, p)
-		if err != nil {
-			http.Error(w, fmt.Sprintf("could not add project '%s'", p), http.StatusInternalServerError)
+		err = addProjectFrom(ctx, db, p, r.Form.Get("template"), r.Form.Get("clone_from"), r.Form.Get("with_shots") != "")
+		if err == nil {
+			http.Redirect(w, r, "/projects", http.StatusSeeOther)
+			return
+		}
+		// 입력이 적절하지 않으면 에러 메시지와 함께 폼을 다시 보인다.
+		errs = formErrors(w, err)
+		if errs == nil {
+			handleError(w, r, fmt.Errorf("could not add project '%s': %w", id, err))
 			return
 		}
-		http.Redirect(w, r, "/projects", http.StatusSeeOther)
+	}
+	tmpls, err := roi.AllProjectTemplatesContext(ctx, db)
+	if err != nil {
+		handleError(w, r, fmt.Errorf("could not get project templates: %w", err))
+		return
+	}
+	prjs, err := roi.AllProjectsContext(ctx, db)
+	if err != nil {
+		handleError(w, r, fmt.Errorf("could not get projects: %w", err))
 		return
 	}
 	recipt := struct {
 		LoggedInUser string
+		Templates    []*roi.ProjectTemplate
+		Projects     []*roi.Project
+		// Form과 Errors는 입력이 적절하지 않아 폼을 다시 보일 때 사용한다.
+		Form   url.Values
+		Errors map[string]string
 	}{
 		LoggedInUser: session["userid"],
+		Templates:    tmpls,
+		Projects:     prjs,
+		Form:         r.Form,
+		Errors:       errs,
 	}
-	err = executeTemplate(w, "add-project.html", recipt)
+	err = executeTemplate(w, r, "add-project.html", recipt)
 	if err != nil {
-		log.Fatal(err)
+		handleError(w, r, err)
+	}
+}
+
+// addProjectFrom은 프로젝트를 추가한다.
+// tmpl이 비어있지 않으면 해당 프로젝트 템플릿의 설정을, src가 비어있지 않으면 해당 프로젝트의 설정을 적용한다.
+// withShots는 src 프로젝트의 샷과 태스크까지 복사할지 여부이다.
+// tmpl과 src는 함께 지정될 수 없다.
+func addProjectFrom(ctx context.Context, db *sql.DB, p *roi.Project, tmpl, src string, withShots bool) error {
+	if tmpl != "" && src != "" {
+		return fmt.Errorf("cannot use template and clone source together")
+	}
+	if tmpl != "" {
+		t, err := roi.GetProjectTemplateContext(ctx, db, tmpl)
+		if err != nil {
+			return err
+		}
+		if t == nil {
+			return fmt.Errorf("project template not exist: %s", tmpl)
+		}
+		return roi.AddProjectFromTemplateContext(ctx, db, p, t)
+	}
+	if src != "" {
+		return roi.CloneProjectContext(ctx, db, src, p, withShots)
 	}
+	return roi.AddProjectContext(ctx, db, p)
 }
 
 // updateProjectHandler는 /update-project 페이지로 사용자가 접속했을때 페이지를 반환한다.
 // 만일 POST로 프로젝트 정보가 오면 프로젝트 정보를 수정한다.
 func updateProjectHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
 	db, err := roi.DB()
 	if err != nil {
-		log.Printf("could not connect to database: %v", err)
-		http.Error(w, "internal error", http.StatusInternalServerError)
+		handleError(w, r, fmt.Errorf("could not connect to database: %w", err))
 		return
 	}
 	session, err := getSession(r)
 	if err != nil {
-		http.Error(w, "could not get session", http.StatusUnauthorized)
+		httpError(w, r, "could not get session", http.StatusUnauthorized)
 		clearSession(w)
 		return
 	}
-	u, err := roi.GetUser(db, session["userid"])
+	u, err := roi.GetUserContext(ctx, db, session["userid"])
 	if err != nil {
-		http.Error(w, "could not get user information", http.StatusInternalServerError)
+		httpError(w, r, "could not get user information", http.StatusInternalServerError)
 		clearSession(w)
 		return
 	}
@@ -165,16 +217,16 @@ func updateProjectHandler(w http.ResponseWriter, r *http.Request) {
 	r.ParseForm()
 	id := r.Form.Get("id")
 	if id == "" {
-		http.Error(w, "need project 'id'", http.StatusBadRequest)
+		httpError(w, r, "need project 'id'", http.StatusBadRequest)
 		return
 	}
-	exist, err := roi.ProjectExist(db, id)
+	exist, err := roi.ProjectExistContext(ctx, db, id)
 	if err != nil {
-		http.Error(w, "internal error", http.StatusInternalServerError)
+		handleError(w, r, err)
 		return
 	}
 	if !exist {
-		http.Error(w, fmt.Sprintf("project '%s' not exist", id), http.StatusBadRequest)
+		httpError(w, r, fmt.Sprintf("project '%s' not exist", id), http.StatusNotFound)
 		return
 	}
 	timeForms, err := parseTimeForms(r.Form,
@@ -185,9 +237,10 @@ func updateProjectHandler(w http.ResponseWriter, r *http.Request) {
 		"vfx_due_date",
 	)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusBadRequest)
+		httpError(w, r, err.Error(), http.StatusBadRequest)
 		return
 	}
+	var errs map[string]string
 	if r.Method == "POST" {
 		upd := roi.UpdateProjectParam{
 			Name:          r.Form.Get("name"),
@@ -207,33 +260,349 @@ func updateProjectHandler(w http.ResponseWriter, r *http.Request) {
 			ViewLUT:       r.Form.Get("view_lut"),
 			DefaultTasks:  fields(r.Form.Get("default_tasks"), ","),
 		}
-		err = roi.UpdateProject(db, id, upd)
-		if err != nil {
-			log.Println(err)
-			http.Error(w, fmt.Sprintf("could not add project '%s'", id), http.StatusInternalServerError)
+		paths := &roi.ProjectPaths{
+			Project:      id,
+			Work:         r.Form.Get("path_work"),
+			Render:       r.Form.Get("path_render"),
+			Mov:          r.Form.Get("path_mov"),
+			Plate:        r.Form.Get("path_plate"),
+			CreateDirs:   r.Form.Get("create_dirs") != "",
+			IngestNaming: r.Form.Get("ingest_naming"),
+		}
+		err = roi.UpdateProjectContext(ctx, db, id, upd)
+		if err == nil {
+			err = roi.SetProjectPathsContext(ctx, db, paths)
+		}
+		if err == nil {
+			err = roi.SetProjectTagsContext(ctx, db, id, fields(r.Form.Get("tags"), ","))
+		}
+		if err == nil {
+			http.Redirect(w, r, "/projects", http.StatusSeeOther)
+			return
+		}
+		// 입력이 적절하지 않으면 에러 메시지와 함께 폼을 다시 보인다.
+		errs = formErrors(w, err)
+		if errs == nil {
+			handleError(w, r, fmt.Errorf("could not update project '%s': %w", id, err))
 			return
 		}
-		http.Redirect(w, r, "/projects", http.StatusSeeOther)
-		return
 	}
-	p, err := roi.GetProject(db, id)
+	p, err := roi.GetProjectContext(ctx, db, id)
 	if err != nil {
-		http.Error(w, fmt.Sprintf("could not get project: %s", id), http.StatusInternalServerError)
+		httpError(w, r, fmt.Sprintf("could not get project: %s", id), http.StatusInternalServerError)
 		return
 	}
 	if p == nil {
-		http.Error(w, fmt.Sprintf("could not get project: %s", id), http.StatusBadRequest)
+		httpError(w, r, fmt.Sprintf("could not get project: %s", id), http.StatusBadRequest)
+		return
+	}
+	paths, err := roi.GetProjectPathsContext(ctx, db, id)
+	if err != nil {
+		handleError(w, r, fmt.Errorf("could not get project paths: %w", err))
+		return
+	}
+	if paths == nil {
+		paths = &roi.ProjectPaths{Project: id}
+	}
+	tags, err := roi.GetProjectTagsContext(ctx, db, id)
+	if err != nil {
+		handleError(w, r, fmt.Errorf("could not get project tags: %w", err))
 		return
 	}
 	recipt := struct {
 		LoggedInUser string
 		Project      *roi.Project
+		Paths        *roi.ProjectPaths
+		Tags         []string
+		// Form과 Errors는 입력이 적절하지 않아 폼을 다시 보일 때 사용한다.
+		Form   url.Values
+		Errors map[string]string
 	}{
 		LoggedInUser: session["userid"],
 		Project:      p,
+		Paths:        paths,
+		Tags:         tags,
+		Form:         r.Form,
+		Errors:       errs,
+	}
+	err = executeTemplate(w, r, "update-project.html", recipt)
+	if err != nil {
+		handleError(w, r, err)
+	}
+}
+
+// projectTemplatesHandler는 /project-templates 페이지로 사용자가 접속했을때
+// 프로젝트 템플릿 목록과 기존 프로젝트를 템플릿으로 저장하는 폼을 보여준다.
+func projectTemplatesHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	db, err := roi.DB()
+	if err != nil {
+		handleError(w, r, fmt.Errorf("could not connect to database: %w", err))
+		return
+	}
+	session, err := getSession(r)
+	if err != nil {
+		httpError(w, r, "could not get session", http.StatusUnauthorized)
+		clearSession(w)
+		return
+	}
+	tmpls, err := roi.AllProjectTemplatesContext(ctx, db)
+	if err != nil {
+		handleError(w, r, fmt.Errorf("could not get project templates: %w", err))
+		return
+	}
+	prjs, err := roi.AllProjectsContext(ctx, db)
+	if err != nil {
+		handleError(w, r, fmt.Errorf("could not get projects: %w", err))
+		return
+	}
+	recipt := struct {
+		LoggedInUser string
+		Templates    []*roi.ProjectTemplate
+		Projects     []*roi.Project
+	}{
+		LoggedInUser: session["userid"],
+		Templates:    tmpls,
+		Projects:     prjs,
+	}
+	err = executeTemplate(w, r, "project-templates.html", recipt)
+	if err != nil {
+		handleError(w, r, err)
+	}
+}
+
+// addProjectTemplateHandler는 사용자가 POST로 보낸 프로젝트의 설정을 프로젝트 템플릿으로 저장한다.
+// 같은 이름의 템플릿이 있다면 덮어쓴다.
+func addProjectTemplateHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	if r.Method != "POST" {
+		httpError(w, r, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	db, err := roi.DB()
+	if err != nil {
+		handleError(w, r, fmt.Errorf("could not connect to database: %w", err))
+		return
+	}
+	session, err := getSession(r)
+	if err != nil || session["userid"] == "" {
+		httpError(w, r, "could not get session", http.StatusUnauthorized)
+		clearSession(w)
+		return
+	}
+	r.ParseForm()
+	prj := r.Form.Get("project")
+	name := r.Form.Get("name")
+	if !roi.IsValidProjectTemplate(name) {
+		httpError(w, r, fmt.Sprintf("invalid project template name '%s'", name), http.StatusBadRequest)
+		return
+	}
+	t, err := roi.ProjectTemplateFromProjectContext(ctx, db, prj, name)
+	if err != nil {
+		httpError(w, r, fmt.Sprintf("could not make project template: %v", err), http.StatusBadRequest)
+		return
+	}
+	t.Description = r.Form.Get("description")
+	err = roi.AddProjectTemplateContext(ctx, db, t)
+	if err != nil {
+		handleError(w, r, fmt.Errorf("could not add project template '%s': %w", name, err))
+		return
+	}
+	http.Redirect(w, r, "/project-templates", http.StatusSeeOther)
+}
+
+// deleteProjectTemplateHandler는 사용자가 POST로 보낸 이름의 프로젝트 템플릿을 지운다.
+func deleteProjectTemplateHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	if r.Method != "POST" {
+		httpError(w, r, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	db, err := roi.DB()
+	if err != nil {
+		handleError(w, r, fmt.Errorf("could not connect to database: %w", err))
+		return
+	}
+	session, err := getSession(r)
+	if err != nil || session["userid"] == "" {
+		httpError(w, r, "could not get session", http.StatusUnauthorized)
+		clearSession(w)
+		return
+	}
+	r.ParseForm()
+	name := r.Form.Get("name")
+	err = roi.DeleteProjectTemplateContext(ctx, db, name)
+	if err != nil {
+		handleError(w, r, fmt.Errorf("could not delete project template '%s': %w", name, err))
+		return
+	}
+	http.Redirect(w, r, "/project-templates", http.StatusSeeOther)
+}
+
+// archiveProjectHandler는 사용자가 POST로 보낸 프로젝트를 묶음 파일로 내보내고 보관한다.
+// 보관된 프로젝트는 프로젝트 목록과 검색에서 숨겨진다.
+func archiveProjectHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	if r.Method != "POST" {
+		httpError(w, r, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	db, err := roi.DB()
+	if err != nil {
+		handleError(w, r, fmt.Errorf("could not connect to database: %w", err))
+		return
+	}
+	session, err := getSession(r)
+	if err != nil || session["userid"] == "" {
+		httpError(w, r, "could not get session", http.StatusUnauthorized)
+		clearSession(w)
+		return
+	}
+	r.ParseForm()
+	prj := r.Form.Get("project")
+	bundle := strings.TrimSpace(r.Form.Get("bundle"))
+	if bundle == "" {
+		httpError(w, r, "need 'bundle' path", http.StatusBadRequest)
+		return
+	}
+	err = roi.ArchiveProjectContext(ctx, db, prj, bundle)
+	if err != nil {
+		handleError(w, r, fmt.Errorf("could not archive project '%s': %w", prj, err))
+		return
+	}
+	http.Redirect(w, r, "/archived-projects", http.StatusSeeOther)
+}
+
+// archivedProjectsHandler는 /archived-projects 페이지로 사용자가 접속했을때
+// 보관된 프로젝트 목록과 묶음 파일에서 프로젝트를 되살리는 폼을 보여준다.
+func archivedProjectsHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	db, err := roi.DB()
+	if err != nil {
+		handleError(w, r, fmt.Errorf("could not connect to database: %w", err))
+		return
+	}
+	session, err := getSession(r)
+	if err != nil {
+		httpError(w, r, "could not get session", http.StatusUnauthorized)
+		clearSession(w)
+		return
+	}
+	as, err := roi.ArchivedProjectsContext(ctx, db)
+	if err != nil {
+		handleError(w, r, fmt.Errorf("could not get archived projects: %w", err))
+		return
+	}
+	recipt := struct {
+		LoggedInUser string
+		Archived     []*roi.ArchivedProject
+	}{
+		LoggedInUser: session["userid"],
+		Archived:     as,
+	}
+	err = executeTemplate(w, r, "archived-projects.html", recipt)
+	if err != nil {
+		handleError(w, r, err)
+	}
+}
+
+// unarchiveProjectHandler는 사용자가 POST로 보낸 보관된 프로젝트를 다시 보이게 한다.
+func unarchiveProjectHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	if r.Method != "POST" {
+		httpError(w, r, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	db, err := roi.DB()
+	if err != nil {
+		handleError(w, r, fmt.Errorf("could not connect to database: %w", err))
+		return
+	}
+	session, err := getSession(r)
+	if err != nil || session["userid"] == "" {
+		httpError(w, r, "could not get session", http.StatusUnauthorized)
+		clearSession(w)
+		return
+	}
+	r.ParseForm()
+	prj := r.Form.Get("project")
+	err = roi.UnarchiveProjectContext(ctx, db, prj)
+	if err != nil {
+		handleError(w, r, fmt.Errorf("could not unarchive project '%s': %w", prj, err))
+		return
+	}
+	http.Redirect(w, r, "/projects", http.StatusSeeOther)
+}
+
+// maxBundleUploadSize는 업로드 받을 수 있는 프로젝트 묶음 파일의 최대 크기이다.
+const maxBundleUploadSize = 4 << 30
+
+// restoreProjectHandler는 사용자가 올린 묶음 파일에서 프로젝트를 되살린다.
+func restoreProjectHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	if r.Method != "POST" {
+		httpError(w, r, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	db, err := roi.DB()
+	if err != nil {
+		handleError(w, r, fmt.Errorf("could not connect to database: %w", err))
+		return
+	}
+	session, err := getSession(r)
+	if err != nil || session["userid"] == "" {
+		httpError(w, r, "could not get session", http.StatusUnauthorized)
+		clearSession(w)
+		return
+	}
+	r.Body = http.MaxBytesReader(w, r.Body, maxBundleUploadSize)
+	if err := r.ParseMultipartForm(32 << 20); err != nil {
+		httpError(w, r, fmt.Sprintf("could not parse form: %v", err), http.StatusBadRequest)
+		return
+	}
+	f, fh, err := r.FormFile("bundle")
+	if err != nil {
+		httpError(w, r, "need 'bundle' file", http.StatusBadRequest)
+		return
+	}
+	defer f.Close()
+	prj, err := roi.RestoreProjectFromContext(ctx, db, f, fh.Size)
+	if err != nil {
+		handleError(w, r, fmt.Errorf("could not restore project from %s: %w", fh.Filename, err))
+		return
+	}
+	http.Redirect(w, r, "/search/"+prj, http.StatusSeeOther)
+}
+
+// projectArchiveHandler는 /project-archive/<project> 로 사용자가 접속했을때
+// 프로젝트의 묶음 파일을 내려받게 한다. 프로젝트를 보관된 것으로 기록하지는 않는다.
+func projectArchiveHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	db, err := roi.DB()
+	if err != nil {
+		handleError(w, r, fmt.Errorf("could not connect to database: %w", err))
+		return
+	}
+	session, err := getSession(r)
+	if err != nil || session["userid"] == "" {
+		httpError(w, r, "could not get session", http.StatusUnauthorized)
+		clearSession(w)
+		return
+	}
+	prj := r.URL.Path[len("/project-archive/"):]
+	exist, err := roi.ProjectExistContext(ctx, db, prj)
+	if err != nil {
+		handleError(w, r, fmt.Errorf("could not check project '%s' exist: %w", prj, err))
+		return
+	}
+	if !exist {
+		httpError(w, r, fmt.Sprintf("project '%s' not exist", prj), http.StatusNotFound)
+		return
 	}
-	err = executeTemplate(w, "update-project.html", recipt)
+	w.Header().Set("Content-Type", "application/zip")
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", prj+".roi.zip"))
+	err = roi.WriteProjectArchiveContext(ctx, db, w, prj)
 	if err != nil {
-		log.Fatal(err)
+		log.Printf("could not write project archive of '%s': %v", prj, err)
 	}
 }
@@ -0,0 +1,115 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/studio2l/roi"
+)
+
+// maxAnnotationUploadSize는 리뷰 그림과 함께 받을 수 있는 요청의 최대 크기이다.
+// 원본 해상도의 4K 프레임 위에 그림을 합친 PNG 이미지를 받을 수 있어야 한다.
+const maxAnnotationUploadSize = 128 << 20
+
+// addReviewHandler는 버전 페이지에서 사용자가 남긴 리뷰를 추가한다.
+// 폼은 multipart 형식이어야 한다.
+// strokes가 비어있지 않다면 리뷰어가 이미지나 영상 프레임 위에 그린 그림이 함께 저장된다.
+// 이때 image 파일에는 원본 위에 그림을 합친 PNG 이미지가 들어있어야 한다.
+func addReviewHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	if r.Method != "POST" {
+		httpError(w, r, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	db, err := roi.DB()
+	if err != nil {
+		handleError(w, r, fmt.Errorf("could not connect to database: %w", err))
+		return
+	}
+	session, err := getSession(r)
+	if err != nil || session["userid"] == "" {
+		httpError(w, r, "could not get session", http.StatusUnauthorized)
+		clearSession(w)
+		return
+	}
+	r.Body = http.MaxBytesReader(w, r.Body, maxAnnotationUploadSize)
+	if err := r.ParseMultipartForm(32 << 20); err != nil {
+		httpError(w, r, fmt.Sprintf("could not parse form: %v", err), http.StatusBadRequest)
+		return
+	}
+	prj := r.Form.Get("project")
+	shot := r.Form.Get("shot")
+	task := r.Form.Get("task")
+	version, err := strconv.Atoi(r.Form.Get("version"))
+	if err != nil || version <= 0 {
+		httpError(w, r, fmt.Sprintf("bad version '%s'", r.Form.Get("version")), http.StatusBadRequest)
+		return
+	}
+	exist, err := roi.VersionExistContext(ctx, db, prj, shot, task, version)
+	if err != nil {
+		handleError(w, r, fmt.Errorf("could not check version exist: %w", err))
+		return
+	}
+	if !exist {
+		httpError(w, r, fmt.Sprintf("version '%s.%s.%s.v%03d' not exist", prj, shot, task, version), http.StatusNotFound)
+		return
+	}
+	rv := &roi.Review{
+		ProjectID: prj,
+		OutputID:  fmt.Sprintf("%s.%s.v%03d", shot, task, version),
+		UserID:    session["userid"],
+		Msg:       strings.TrimSpace(r.Form.Get("msg")),
+		Time:      time.Now(),
+	}
+	strokes := r.Form.Get("strokes")
+	if strokes == "" {
+		if rv.Msg == "" {
+			httpError(w, r, "need review message or annotation", http.StatusBadRequest)
+			return
+		}
+		err = roi.AddReviewContext(ctx, db, rv)
+	} else {
+		a := &roi.Annotation{Source: r.Form.Get("source")}
+		if f := r.Form.Get("frame"); f != "" {
+			a.Frame, err = strconv.Atoi(f)
+			if err != nil {
+				httpError(w, r, fmt.Sprintf("bad frame '%s'", f), http.StatusBadRequest)
+				return
+			}
+		}
+		if err := json.Unmarshal([]byte(strokes), &a.Strokes); err != nil {
+			httpError(w, r, fmt.Sprintf("could not decode strokes: %v", err), http.StatusBadRequest)
+			return
+		}
+		img, err := formFileData(r, "image")
+		if err != nil {
+			httpError(w, r, err.Error(), http.StatusBadRequest)
+			return
+		}
+		err = roi.AddAnnotatedReviewContext(ctx, db, rv, a, img)
+	}
+	if err != nil {
+		handleError(w, r, fmt.Errorf("could not add review: %w", err))
+		return
+	}
+	http.Redirect(w, r, fmt.Sprintf("/version/%s/%s/%s/%d", prj, shot, task, version), http.StatusSeeOther)
+}
+
+// formFileData는 multipart 폼으로 올라온 파일의 내용을 읽는다.
+func formFileData(r *http.Request, name string) ([]byte, error) {
+	f, _, err := r.FormFile(name)
+	if err != nil {
+		return nil, fmt.Errorf("could not get %s file from form: %v", name, err)
+	}
+	defer f.Close()
+	data, err := ioutil.ReadAll(f)
+	if err != nil {
+		return nil, fmt.Errorf("could not read %s file: %v", name, err)
+	}
+	return data, nil
+}
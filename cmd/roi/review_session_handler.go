@@ -0,0 +1,238 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/studio2l/roi"
+)
+
+// reviewSessionURL은 리뷰 세션에서 i번째 항목을 보는 페이지의 주소이다.
+func reviewSessionURL(prj, playlist string, i int) string {
+	return fmt.Sprintf("/review-session/%s/%s?i=%d", prj, url.PathEscape(playlist), i)
+}
+
+// reviewSessionHandler는 /review-session/<project>/<playlist> 페이지로 사용자가 접속했을때
+// 플레이리스트의 i번째 버전과 판정 폼을 보여준다.
+// i가 없으면 아직 판정하지 않은 첫번째 버전을 보여준다.
+func reviewSessionHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	db, err := roi.DB()
+	if err != nil {
+		handleError(w, r, fmt.Errorf("could not connect to database: %w", err))
+		return
+	}
+	session, err := getSession(r)
+	if err != nil {
+		httpError(w, r, "could not get session", http.StatusUnauthorized)
+		clearSession(w)
+		return
+	}
+	ids := strings.SplitN(r.URL.Path[len("/review-session/"):], "/", 2)
+	if len(ids) != 2 || ids[0] == "" || ids[1] == "" {
+		http.NotFound(w, r)
+		return
+	}
+	prj, name := ids[0], ids[1]
+	p, err := roi.GetPlaylistContext(ctx, db, prj, name)
+	if err != nil {
+		handleError(w, r, fmt.Errorf("could not get playlist '%s/%s': %w", prj, name, err))
+		return
+	}
+	if p == nil {
+		httpError(w, r, fmt.Sprintf("playlist '%s/%s' not exist", prj, name), http.StatusNotFound)
+		return
+	}
+	rs, err := roi.GetReviewSessionContext(ctx, db, prj, name)
+	if err != nil {
+		handleError(w, r, fmt.Errorf("could not get review session '%s/%s': %w", prj, name, err))
+		return
+	}
+	if rs == nil {
+		http.Redirect(w, r, "/playlist/"+prj+"/"+url.PathEscape(name), http.StatusSeeOther)
+		return
+	}
+	verdicts, err := roi.ReviewSessionItemsContext(ctx, db, prj, name)
+	if err != nil {
+		handleError(w, r, fmt.Errorf("could not get review session items: %w", err))
+		return
+	}
+	vm := make(map[string]*roi.ReviewSessionItem)
+	for _, v := range verdicts {
+		vm[playlistItemID(v.Shot, v.Task, v.Version)] = v
+	}
+	// 플레이리스트 순서대로 판정을 채운다. 아직 판정하지 않은 버전은 VerdictNone이다.
+	items := make([]*roi.ReviewSessionItem, len(p.Items))
+	cur := -1
+	for i, it := range p.Items {
+		v := vm[playlistItemID(it.Shot, it.Task, it.Version)]
+		if v == nil {
+			v = &roi.ReviewSessionItem{Shot: it.Shot, Task: it.Task, Version: it.Version, Note: it.Note}
+		}
+		items[i] = v
+		if cur < 0 && v.Verdict == roi.VerdictNone {
+			cur = i
+		}
+	}
+	if cur < 0 {
+		cur = 0
+	}
+	if is := r.FormValue("i"); is != "" {
+		cur, err = strconv.Atoi(is)
+		if err != nil || cur < 0 || cur >= len(items) {
+			httpError(w, r, fmt.Sprintf("invalid item index '%s'", is), http.StatusBadRequest)
+			return
+		}
+	}
+	var current *roi.ReviewSessionItem
+	var version *roi.Version
+	if len(items) != 0 {
+		current = items[cur]
+		version, err = roi.GetVersionContext(ctx, db, prj, current.Shot, current.Task, current.Version)
+		if err != nil {
+			handleError(w, r, fmt.Errorf("could not get version: %w", err))
+			return
+		}
+	}
+	recipt := struct {
+		LoggedInUser      string
+		Project           string
+		Playlist          *roi.Playlist
+		Session           *roi.ReviewSession
+		Items             []*roi.ReviewSessionItem
+		Index             int
+		Current           *roi.ReviewSessionItem
+		Version           *roi.Version
+		AllReviewVerdicts []roi.ReviewVerdict
+	}{
+		LoggedInUser:      session["userid"],
+		Project:           prj,
+		Playlist:          p,
+		Session:           rs,
+		Items:             items,
+		Index:             cur,
+		Current:           current,
+		Version:           version,
+		AllReviewVerdicts: roi.AllReviewVerdicts,
+	}
+	err = executeTemplate(w, r, "review-session.html", recipt)
+	if err != nil {
+		handleError(w, r, err)
+	}
+}
+
+// startReviewSessionHandler는 플레이리스트의 리뷰 세션을 시작하고 세션 페이지로 이동한다.
+// 이미 시작된 세션이 있다면 그 세션을 이어서 진행한다.
+func startReviewSessionHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	if r.Method != "POST" {
+		httpError(w, r, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	db, err := roi.DB()
+	if err != nil {
+		handleError(w, r, fmt.Errorf("could not connect to database: %w", err))
+		return
+	}
+	session, err := getSession(r)
+	if err != nil || session["userid"] == "" {
+		httpError(w, r, "could not get session", http.StatusUnauthorized)
+		clearSession(w)
+		return
+	}
+	prj := r.FormValue("project")
+	name := r.FormValue("playlist")
+	exist, err := roi.PlaylistExistContext(ctx, db, prj, name)
+	if err != nil {
+		handleError(w, r, fmt.Errorf("could not check playlist '%s/%s' exist: %w", prj, name, err))
+		return
+	}
+	if !exist {
+		httpError(w, r, fmt.Sprintf("playlist '%s/%s' not exist", prj, name), http.StatusNotFound)
+		return
+	}
+	_, err = roi.StartReviewSessionContext(ctx, db, prj, name, session["userid"])
+	if err != nil {
+		handleError(w, r, fmt.Errorf("could not start review session: %w", err))
+		return
+	}
+	http.Redirect(w, r, "/review-session/"+prj+"/"+url.PathEscape(name), http.StatusSeeOther)
+}
+
+// setReviewVerdictHandler는 리뷰 세션에서 한 버전의 판정과 노트를 기록하고
+// 다음 버전으로 이동한다.
+func setReviewVerdictHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	if r.Method != "POST" {
+		httpError(w, r, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	db, err := roi.DB()
+	if err != nil {
+		handleError(w, r, fmt.Errorf("could not connect to database: %w", err))
+		return
+	}
+	session, err := getSession(r)
+	if err != nil || session["userid"] == "" {
+		httpError(w, r, "could not get session", http.StatusUnauthorized)
+		clearSession(w)
+		return
+	}
+	r.ParseForm()
+	prj := r.Form.Get("project")
+	name := r.Form.Get("playlist")
+	it, err := playlistItemFromID(r.Form.Get("item"))
+	if err != nil {
+		httpError(w, r, err.Error(), http.StatusBadRequest)
+		return
+	}
+	next, err := strconv.Atoi(r.Form.Get("next"))
+	if err != nil {
+		httpError(w, r, fmt.Sprintf("invalid next index '%s'", r.Form.Get("next")), http.StatusBadRequest)
+		return
+	}
+	ri := &roi.ReviewSessionItem{
+		Shot:    it.Shot,
+		Task:    it.Task,
+		Version: it.Version,
+		Verdict: roi.ReviewVerdict(r.Form.Get("verdict")),
+		Note:    r.Form.Get("note"),
+	}
+	err = roi.SetReviewVerdictContext(ctx, db, prj, name, ri)
+	if err != nil {
+		handleError(w, r, err)
+		return
+	}
+	http.Redirect(w, r, reviewSessionURL(prj, name, next), http.StatusSeeOther)
+}
+
+// publishReviewSessionHandler는 리뷰 세션의 판정들을 리뷰와 태스크 상태로 반영한다.
+func publishReviewSessionHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	if r.Method != "POST" {
+		httpError(w, r, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	db, err := roi.DB()
+	if err != nil {
+		handleError(w, r, fmt.Errorf("could not connect to database: %w", err))
+		return
+	}
+	session, err := getSession(r)
+	if err != nil || session["userid"] == "" {
+		httpError(w, r, "could not get session", http.StatusUnauthorized)
+		clearSession(w)
+		return
+	}
+	prj := r.FormValue("project")
+	name := r.FormValue("playlist")
+	err = roi.PublishReviewSessionContext(ctx, db, prj, name)
+	if err != nil {
+		handleError(w, r, fmt.Errorf("could not publish review session '%s/%s': %w", prj, name, err))
+		return
+	}
+	http.Redirect(w, r, "/review-session/"+prj+"/"+url.PathEscape(name), http.StatusSeeOther)
+}
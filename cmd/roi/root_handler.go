@@ -13,6 +13,7 @@ import (
 
 // rootHandler는 루트 페이지로 사용자가 접근했을때 그 사용자에게 필요한 정보를 맞춤식으로 제공한다.
 func rootHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
 	session, err := getSession(r)
 	if err != nil {
 		log.Print(fmt.Sprintf("could not get session: %s", err))
@@ -25,14 +26,12 @@ func rootHandler(w http.ResponseWriter, r *http.Request) {
 	user := session["userid"]
 	db, err := roi.DB()
 	if err != nil {
-		log.Printf("could not connect to database: %v", err)
-		http.Error(w, "internal error", http.StatusInternalServerError)
+		handleError(w, r, fmt.Errorf("could not connect to database: %w", err))
 		return
 	}
-	tasks, err := roi.UserTasks(db, user)
+	tasks, err := roi.UserTasksContext(ctx, db, user)
 	if err != nil {
-		log.Printf("could not get user tasks: %v", err)
-		http.Error(w, "internal error", http.StatusInternalServerError)
+		handleError(w, r, fmt.Errorf("could not get user tasks: %w", err))
 		return
 	}
 	// 태스크를 미리 아이디 기준으로 정렬해 두면 아래에서 사용되는
@@ -87,8 +86,8 @@ func rootHandler(w http.ResponseWriter, r *http.Request) {
 		TasksOfDay:    tasksOfDay,
 		AllTaskStatus: roi.AllTaskStatus,
 	}
-	err = executeTemplate(w, "index.html", recipt)
+	err = executeTemplate(w, r, "index.html", recipt)
 	if err != nil {
-		log.Fatal(err)
+		handleError(w, r, err)
 	}
 }
@@ -0,0 +1,207 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/studio2l/roi"
+)
+
+// savedSearchHandler는 /saved-search/<user>/<name> 으로 사용자가 접근했을때
+// 저장된 검색 조건으로 /search/ 페이지를 보여준다.
+// 같은 검색에 항상 같은 주소로 접근할 수 있도록 하기 위함이다.
+func savedSearchHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	db, err := roi.DB()
+	if err != nil {
+		handleError(w, r, fmt.Errorf("could not connect to database: %w", err))
+		return
+	}
+	session, err := getSession(r)
+	if err != nil {
+		httpError(w, r, "could not get session", http.StatusUnauthorized)
+		clearSession(w)
+		return
+	}
+	if session == nil || session["userid"] == "" {
+		http.Redirect(w, r, "/login", http.StatusSeeOther)
+		return
+	}
+	id := r.URL.Path[len("/saved-search/"):]
+	user, name := roi.SplitSavedSearchID(id)
+	if user == "" {
+		http.NotFound(w, r)
+		return
+	}
+	s, err := roi.GetSavedSearchContext(ctx, db, user, name)
+	if err != nil {
+		handleError(w, r, fmt.Errorf("could not get saved search '%s': %w", id, err))
+		return
+	}
+	if s == nil || !canUseSavedSearch(s, session["userid"]) {
+		httpError(w, r, fmt.Sprintf("saved search '%s' not exist", id), http.StatusNotFound)
+		return
+	}
+	http.Redirect(w, r, "/search/"+s.Project+"?"+s.Query(), http.StatusSeeOther)
+}
+
+// canUseSavedSearch는 사용자가 저장된 검색을 볼 수 있는지를 반환한다.
+// 자신의 검색이거나 공유된 검색만 볼 수 있다.
+func canUseSavedSearch(s *roi.SavedSearch, user string) bool {
+	return s.User == user || s.Shared
+}
+
+// taskDueDaysForm은 폼의 task_due_days를 읽는다. 값이 없다면 0을 반환한다.
+func taskDueDaysForm(form url.Values) (int, error) {
+	v := form.Get("task_due_days")
+	if v == "" {
+		return 0, nil
+	}
+	days, err := strconv.Atoi(v)
+	if err != nil || days < 0 {
+		return 0, fmt.Errorf("invalid task due days '%s'", v)
+	}
+	return days, nil
+}
+
+// savedSearchFromForm은 /search/ 페이지의 검색 폼과 같은 형식의 폼에서 검색 조건을 읽는다.
+// 마감일은 검색하는 날부터의 날 수인 task_due_days로만 저장된다.
+func savedSearchFromForm(user string, form url.Values) (*roi.SavedSearch, error) {
+	days, err := taskDueDaysForm(form)
+	if err != nil {
+		return nil, err
+	}
+	s := &roi.SavedSearch{
+		User:        user,
+		Name:        strings.TrimSpace(form.Get("name")),
+		Project:     form.Get("project"),
+		Shared:      form.Get("shared") == "on" || form.Get("shared") == "true",
+		Shot:        form.Get("shot"),
+		Tag:         form.Get("tag"),
+		Status:      form.Get("status"),
+		Assignee:    form.Get("assignee"),
+		TaskStatus:  form.Get("task_status"),
+		TaskDueDays: days,
+	}
+	return s, nil
+}
+
+// addSavedSearchHandler는 사용자가 /search/ 페이지의 검색 조건을 POST로 보내면
+// 그 조건을 사용자의 검색으로 저장한다. 같은 이름의 검색이 있다면 덮어쓴다.
+func addSavedSearchHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	if r.Method != "POST" {
+		httpError(w, r, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	db, err := roi.DB()
+	if err != nil {
+		handleError(w, r, fmt.Errorf("could not connect to database: %w", err))
+		return
+	}
+	session, err := getSession(r)
+	if err != nil {
+		httpError(w, r, "could not get session", http.StatusUnauthorized)
+		clearSession(w)
+		return
+	}
+	user := session["userid"]
+	if user == "" {
+		httpError(w, r, "need to login", http.StatusUnauthorized)
+		return
+	}
+	r.ParseForm()
+	s, err := savedSearchFromForm(user, r.Form)
+	if err != nil {
+		httpError(w, r, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if !roi.IsValidSavedSearchName(s.Name) {
+		httpError(w, r, fmt.Sprintf("invalid search name '%s'", s.Name), http.StatusBadRequest)
+		return
+	}
+	exist, err := roi.ProjectExistContext(ctx, db, s.Project)
+	if err != nil {
+		handleError(w, r, fmt.Errorf("could not check project '%s' exist: %w", s.Project, err))
+		return
+	}
+	if !exist {
+		httpError(w, r, fmt.Sprintf("project '%s' not exist", s.Project), http.StatusNotFound)
+		return
+	}
+	exist, err = roi.SavedSearchExistContext(ctx, db, user, s.Name)
+	if err != nil {
+		handleError(w, r, fmt.Errorf("could not check saved search '%s' exist: %w", s.ID(), err))
+		return
+	}
+	if exist {
+		upd := roi.UpdateSavedSearchParam{
+			Project:     s.Project,
+			Shared:      s.Shared,
+			Shot:        s.Shot,
+			Tag:         s.Tag,
+			Status:      s.Status,
+			Assignee:    s.Assignee,
+			TaskStatus:  s.TaskStatus,
+			TaskDueDays: s.TaskDueDays,
+		}
+		err = roi.UpdateSavedSearchContext(ctx, db, user, s.Name, upd)
+	} else {
+		err = roi.AddSavedSearchContext(ctx, db, s)
+	}
+	if err != nil {
+		handleError(w, r, fmt.Errorf("could not save search '%s': %w", s.ID(), err))
+		return
+	}
+	http.Redirect(w, r, "/saved-search/"+user+"/"+url.PathEscape(s.Name), http.StatusSeeOther)
+}
+
+// deleteSavedSearchHandler는 사용자가 POST로 보낸 이름의 저장된 검색을 지운다.
+// 사용자는 자신이 저장한 검색만 지울 수 있다.
+func deleteSavedSearchHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	if r.Method != "POST" {
+		httpError(w, r, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	db, err := roi.DB()
+	if err != nil {
+		handleError(w, r, fmt.Errorf("could not connect to database: %w", err))
+		return
+	}
+	session, err := getSession(r)
+	if err != nil {
+		httpError(w, r, "could not get session", http.StatusUnauthorized)
+		clearSession(w)
+		return
+	}
+	user := session["userid"]
+	if user == "" {
+		httpError(w, r, "need to login", http.StatusUnauthorized)
+		return
+	}
+	r.ParseForm()
+	name := r.Form.Get("name")
+	if name == "" {
+		httpError(w, r, "need 'name'", http.StatusBadRequest)
+		return
+	}
+	s, err := roi.GetSavedSearchContext(ctx, db, user, name)
+	if err != nil {
+		handleError(w, r, fmt.Errorf("could not get saved search '%s/%s': %w", user, name, err))
+		return
+	}
+	if s == nil {
+		httpError(w, r, fmt.Sprintf("saved search '%s' not exist", name), http.StatusNotFound)
+		return
+	}
+	err = roi.DeleteSavedSearchContext(ctx, db, user, name)
+	if err != nil {
+		handleError(w, r, fmt.Errorf("could not delete saved search '%s': %w", s.ID(), err))
+		return
+	}
+	http.Redirect(w, r, "/search/"+s.Project, http.StatusSeeOther)
+}
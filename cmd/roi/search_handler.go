@@ -4,7 +4,6 @@ import (
 	"fmt"
 	"log"
 	"net/http"
-	"os"
 	"time"
 
 	"github.com/studio2l/roi"
@@ -12,18 +11,19 @@ import (
 
 // searchHandler는 /search/ 하위 페이지로 사용자가 접속했을때 페이지를 반환한다.
 func searchHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
 	prj := r.URL.Path[len("/search/"):]
 
 	db, err := roi.DB()
 	if err != nil {
-		log.Printf("could not connect to database: %v", err)
-		http.Error(w, "internal error", http.StatusInternalServerError)
+		handleError(w, r, fmt.Errorf("could not connect to database: %w", err))
 		return
 	}
 
-	ps, err := roi.AllProjects(db)
+	ps, err := roi.AllProjectsContext(ctx, db)
 	if err != nil {
-		log.Printf("could not get project list: %v", err)
+		handleError(w, r, fmt.Errorf("could not get project list: %w", err))
+		return
 	}
 	prjs := make([]string, len(ps))
 	for i, p := range ps {
@@ -41,13 +41,13 @@ func searchHandler(w http.ResponseWriter, r *http.Request) {
 		}
 	}
 	if !found {
-		fmt.Fprintf(os.Stderr, "not found project %s\n", prj)
+		httpError(w, r, fmt.Sprintf("project '%s' not exist", prj), http.StatusNotFound)
 		return
-		// http.Error(w, fmt.Sprintf("not found project: %s", id), http.StatusNotFound)
 	}
 
 	if err := r.ParseForm(); err != nil {
-		log.Fatal(err)
+		httpError(w, r, err.Error(), http.StatusBadRequest)
+		return
 	}
 	shotFilter := r.Form.Get("shot")
 	tagFilter := r.Form.Get("tag")
@@ -56,20 +56,39 @@ func searchHandler(w http.ResponseWriter, r *http.Request) {
 	taskStatusFilter := r.Form.Get("task_status")
 	tforms, err := parseTimeForms(r.Form, "task_due_date")
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusBadRequest)
+		httpError(w, r, err.Error(), http.StatusBadRequest)
 		return
 	}
 	taskDueDateFilter := tforms["task_due_date"]
-	shots, err := roi.SearchShots(db, prj, shotFilter, tagFilter, statusFilter, assigneeFilter, taskStatusFilter, taskDueDateFilter)
+	taskDueDaysFilter, err := taskDueDaysForm(r.Form)
+	if err != nil {
+		httpError(w, r, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	session, err := getSession(r)
+	if err != nil {
+		log.Print(fmt.Sprintf("could not get session: %s", err))
+		clearSession(w)
+	}
+	// 담당자가 roi.AssigneeMe라면 지금 검색하는 사용자의 태스크를 찾는다.
+	// 저장된 검색의 조건이 여는 사람에 맞게 바뀌도록 필터에는 그대로 둔다.
+	assignee := roi.ResolveAssignee(assigneeFilter, session["userid"])
+	var shots []*roi.Shot
+	if taskDueDaysFilter != 0 {
+		shots, err = roi.SearchShotsDueWithinContext(ctx, db, prj, shotFilter, tagFilter, statusFilter, assignee, taskStatusFilter, taskDueDaysFilter)
+	} else {
+		shots, err = roi.SearchShotsContext(ctx, db, prj, shotFilter, tagFilter, statusFilter, assignee, taskStatusFilter, taskDueDateFilter)
+	}
 	if err != nil {
-		log.Fatal(err)
+		handleError(w, r, fmt.Errorf("could not search shots: %w", err))
+		return
 	}
 	tasks := make(map[string]map[string]*roi.Task)
 	for _, s := range shots {
-		ts, err := roi.ShotTasks(db, prj, s.Shot)
+		ts, err := roi.ShotTasksContext(ctx, db, prj, s.Shot)
 		if err != nil {
-			log.Printf("could not get all tasks of shot '%s'", s.Shot)
-			http.Error(w, "internal error", http.StatusInternalServerError)
+			handleError(w, r, fmt.Errorf("could not get all tasks of shot '%s': %w", s.Shot, err))
 			return
 		}
 		tm := make(map[string]*roi.Task)
@@ -79,10 +98,15 @@ func searchHandler(w http.ResponseWriter, r *http.Request) {
 		tasks[s.Shot] = tm
 	}
 
-	session, err := getSession(r)
+	savedSearches, err := roi.UserSavedSearchesContext(ctx, db, session["userid"], prj)
 	if err != nil {
-		log.Print(fmt.Sprintf("could not get session: %s", err))
-		clearSession(w)
+		handleError(w, r, fmt.Errorf("could not get saved searches: %w", err))
+		return
+	}
+	playlists, err := roi.ProjectPlaylistsContext(ctx, db, prj)
+	if err != nil {
+		handleError(w, r, fmt.Errorf("could not get playlists: %w", err))
+		return
 	}
 
 	recipt := struct {
@@ -99,6 +123,9 @@ func searchHandler(w http.ResponseWriter, r *http.Request) {
 		FilterAssignee    string
 		FilterTaskStatus  string
 		FilterTaskDueDate time.Time
+		FilterTaskDueDays int
+		SavedSearches     []*roi.SavedSearch
+		Playlists         []*roi.Playlist
 	}{
 		LoggedInUser:      session["userid"],
 		Projects:          prjs,
@@ -113,9 +140,12 @@ func searchHandler(w http.ResponseWriter, r *http.Request) {
 		FilterAssignee:    assigneeFilter,
 		FilterTaskStatus:  taskStatusFilter,
 		FilterTaskDueDate: taskDueDateFilter,
+		FilterTaskDueDays: taskDueDaysFilter,
+		SavedSearches:     savedSearches,
+		Playlists:         playlists,
 	}
-	err = executeTemplate(w, "search.html", recipt)
+	err = executeTemplate(w, r, "search.html", recipt)
 	if err != nil {
-		log.Fatal(err)
+		handleError(w, r, err)
 	}
 }
@@ -1,50 +1,334 @@
 package main
 
 import (
+	"context"
+	"crypto/subtle"
+	"encoding/base64"
+	"fmt"
+	"mime"
+	"net"
 	"net/http"
+	"strings"
+	"sync"
+	"time"
 
 	"github.com/gorilla/securecookie"
+	"github.com/studio2l/roi"
 )
 
-// cookieHandler는 클라이언트 브라우저 세션에 암호화된 쿠키를 저장을 돕는다.
+// 로그인한 사용자의 세션은 roi.Session으로 DB에 저장되며, 브라우저의 쿠키에는 세션 토큰만 담긴다.
+// 세션이 있는 사용자의 POST 요청은 세션의 CSRF 토큰을 함께 보내야 한다.
+// 로그인, 가입 폼처럼 세션이 없는 사용자의 POST 요청은 csrf 쿠키에 담아 둔 세션 전 CSRF 토큰을 함께 보내야 한다.
+// 템플릿의 폼에서는 csrf-field.html로, 자바스크립트에서는 X-CSRF-Token 헤더로 보낸다.
+// api 질의는 쿠키 대신 Authorization 헤더에 사용자가 발급받은 api 토큰을 담아 보낸다.
+// api 토큰 역시 roi.Session이므로 세션 목록에서 확인하고 지울 수 있다.
+
+// cookieHandler는 클라이언트 브라우저에 저장하는 세션 쿠키를 서명하고 암호화한다.
 var cookieHandler *securecookie.SecureCookie
 
-// setSession은 클라이언트 브라우저에 세션을 저장한다.
-func setSession(w http.ResponseWriter, session map[string]string) error {
-	encoded, err := cookieHandler.Encode("session", session)
+// sessionLifetime은 로그인 후 세션이 유지되는 기간이다.
+var sessionLifetime = 30 * 24 * time.Hour
+
+// sessionIdleTimeout은 쓰이지 않는 세션이 만료되기까지의 기간이다. 0이면 쓰이지 않아도 만료되지 않는다.
+var sessionIdleTimeout = 7 * 24 * time.Hour
+
+// sessionTouchInterval은 세션의 마지막 사용 시간을 DB에 다시 기록하기까지의 최소 간격이다.
+// 요청마다 DB에 쓰지 않기 위함이다.
+const sessionTouchInterval = time.Minute
+
+// sessionKey는 요청의 컨텍스트에 requestSession을 담을 때 쓰는 키이다.
+type sessionKey struct{}
+
+// requestSession은 한 요청의 세션을 처음 필요할 때 한번만 불러오도록 한다.
+type requestSession struct {
+	once    sync.Once
+	session *roi.Session
+	err     error
+
+	// w는 세션 전 CSRF 토큰 쿠키를 저장할 응답이다.
+	w http.ResponseWriter
+	// preCSRFToken은 세션이 없는 사용자에게 보인 세션 전 CSRF 토큰이다.
+	preCSRFToken string
+}
+
+// withSession은 요청의 컨텍스트에 세션을 불러올 자리를 만든 뒤 h를 실행하는 핸들러를 반환한다.
+// POST 요청의 CSRF 토큰이 세션의 것과, 세션이 없다면 세션 전 CSRF 토큰과 다르면 h를 실행하지 않고 거부한다.
+// api 질의는 api 토큰이 없거나 유효하지 않으면 거부한다.
+// api 토큰은 브라우저가 다른 사이트의 요청에 스스로 담아 보내지 않으므로 api 질의의 CSRF 토큰은 검사하지 않는다.
+func withSession(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		r = r.WithContext(context.WithValue(r.Context(), sessionKey{}, &requestSession{w: w}))
+		if isAPIRequest(r) {
+			s, err := currentSession(r)
+			if err != nil {
+				handleError(w, r, fmt.Errorf("could not get session: %w", err))
+				return
+			}
+			if s == nil {
+				apiUnauthorized(w, fmt.Errorf("valid api token needed in Authorization header"))
+				return
+			}
+		} else if r.Method == "POST" {
+			s, err := currentSession(r)
+			if err != nil {
+				handleError(w, r, fmt.Errorf("could not get session: %w", err))
+				return
+			}
+			want := preCSRFToken(r)
+			if s != nil {
+				want = s.CSRFToken
+			}
+			if !validCSRFToken(r, want) {
+				httpError(w, r, "invalid csrf token. please reload the page and try again.", http.StatusForbidden)
+				return
+			}
+		}
+		h.ServeHTTP(w, r)
+	})
+}
+
+// currentSession은 요청한 사용자의 세션을 반환한다. 로그인하지 않았다면 nil을 반환한다.
+func currentSession(r *http.Request) (*roi.Session, error) {
+	rs, ok := r.Context().Value(sessionKey{}).(*requestSession)
+	if !ok {
+		return loadSession(r)
+	}
+	rs.once.Do(func() {
+		rs.session, rs.err = loadSession(r)
+	})
+	return rs.session, rs.err
+}
+
+// isAPIRequest는 요청이 api 질의인지를 반환한다.
+func isAPIRequest(r *http.Request) bool {
+	return strings.HasPrefix(r.URL.Path, "/api/")
+}
+
+// sessionToken은 요청에 담긴 세션 토큰을 반환한다. 토큰이 없다면 빈 문자열을 반환한다.
+// api 질의는 Authorization 헤더의 Bearer 토큰을, 그 외의 요청은 세션 쿠키를 사용한다.
+// api 질의에 담긴 쿠키는 사용하지 않는다.
+func sessionToken(r *http.Request) string {
+	if isAPIRequest(r) {
+		auth := r.Header.Get("Authorization")
+		if !strings.HasPrefix(auth, "Bearer ") {
+			return ""
+		}
+		return strings.TrimSpace(auth[len("Bearer "):])
+	}
+	c, _ := r.Cookie("session")
+	if c == nil || cookieHandler == nil {
+		return ""
+	}
+	var token string
+	if err := cookieHandler.Decode("session", c.Value, &token); err != nil {
+		// 변조되었거나 예전 형식의 쿠키이다. 다시 로그인해야 한다.
+		return ""
+	}
+	return token
+}
+
+// loadSession은 요청의 세션 토큰으로 DB에 저장된 세션을 찾는다.
+// 토큰이 없거나, 세션이 지워졌거나, 만료되었거나, 오래 쓰이지 않았다면 nil을 반환한다.
+func loadSession(r *http.Request) (*roi.Session, error) {
+	token := sessionToken(r)
+	if token == "" {
+		return nil, nil
+	}
+	ctx := r.Context()
+	db, err := roi.DB()
+	if err != nil {
+		return nil, err
+	}
+	s, err := roi.GetSessionContext(ctx, db, token)
+	if err != nil || s == nil {
+		return nil, err
+	}
+	now := time.Now()
+	if sessionIdleTimeout > 0 && now.Sub(s.LastSeen) > sessionIdleTimeout {
+		if err := roi.DeleteSessionContext(ctx, db, s.ID); err != nil {
+			return nil, err
+		}
+		return nil, nil
+	}
+	if now.Sub(s.LastSeen) > sessionTouchInterval {
+		if err := roi.TouchSessionContext(ctx, db, s.ID, now); err != nil {
+			return nil, err
+		}
+		s.LastSeen = now
+	}
+	return s, nil
+}
+
+// validCSRFToken은 요청에 담긴 CSRF 토큰이 want와 같은지 확인한다. want가 비어 있으면 항상 false이다.
+// 토큰은 X-CSRF-Token 헤더나 csrf_token 폼 값으로 받는다.
+// 파일을 올리는 multipart 폼은 핸들러가 크기를 제한하며 읽어야 하므로 주소의 csrf_token 값으로 받는다.
+func validCSRFToken(r *http.Request, want string) bool {
+	if want == "" {
+		return false
+	}
+	token := r.Header.Get("X-CSRF-Token")
+	if token == "" {
+		mt, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+		if mt == "multipart/form-data" {
+			token = r.URL.Query().Get("csrf_token")
+		} else {
+			token = r.PostFormValue("csrf_token")
+		}
+	}
+	return token != "" && subtle.ConstantTimeCompare([]byte(token), []byte(want)) == 1
+}
+
+// csrfToken은 요청한 사용자의 세션의 CSRF 토큰을 반환한다.
+// 로그인하지 않았다면 세션 전 CSRF 토큰을 반환하며, 토큰이 없다면 새로 만들어 쿠키에 저장한다.
+// 쿠키를 저장해야 하므로 응답을 쓰기 전에 불러야 한다.
+func csrfToken(r *http.Request) string {
+	s, _ := currentSession(r)
+	if s != nil {
+		return s.CSRFToken
+	}
+	rs, ok := r.Context().Value(sessionKey{}).(*requestSession)
+	if !ok {
+		return ""
+	}
+	if rs.preCSRFToken != "" {
+		return rs.preCSRFToken
+	}
+	token := preCSRFToken(r)
+	if token == "" {
+		if cookieHandler == nil {
+			return ""
+		}
+		token = base64.RawURLEncoding.EncodeToString(securecookie.GenerateRandomKey(32))
+		encoded, err := cookieHandler.Encode("csrf", token)
+		if err != nil {
+			return ""
+		}
+		http.SetCookie(rs.w, preCSRFCookie(encoded, 0))
+	}
+	rs.preCSRFToken = token
+	return token
+}
+
+// preCSRFToken은 요청의 csrf 쿠키에 담긴 세션 전 CSRF 토큰을 반환한다.
+// 쿠키가 없거나 변조되었다면 빈 문자열을 반환한다.
+func preCSRFToken(r *http.Request) string {
+	c, _ := r.Cookie("csrf")
+	if c == nil || cookieHandler == nil {
+		return ""
+	}
+	var token string
+	if err := cookieHandler.Decode("csrf", c.Value, &token); err != nil {
+		return ""
+	}
+	return token
+}
+
+// preCSRFCookie는 세션 전 CSRF 토큰을 담는 쿠키를 만든다.
+// 다른 사이트에서 시작된 어떤 요청에도 담기지 않으며, maxAge가 0이면 브라우저를 닫을 때 지워진다.
+func preCSRFCookie(value string, maxAge int) *http.Cookie {
+	return &http.Cookie{
+		Name:     "csrf",
+		Value:    value,
+		Path:     "/",
+		MaxAge:   maxAge,
+		HttpOnly: true,
+		Secure:   true,
+		SameSite: http.SameSiteStrictMode,
+	}
+}
+
+// getSession은 요청한 사용자의 세션 정보를 불러온다.
+// 로그인하지 않았다면 nil을 반환한다.
+func getSession(r *http.Request) (map[string]string, error) {
+	s, err := currentSession(r)
+	if err != nil || s == nil {
+		return nil, err
+	}
+	return map[string]string{"userid": s.User}, nil
+}
+
+// startSession은 사용자의 새 세션을 만들고 클라이언트 브라우저에 세션 쿠키를 저장한다.
+func startSession(w http.ResponseWriter, r *http.Request, user string) error {
+	db, err := roi.DB()
 	if err != nil {
 		return err
 	}
-	c := &http.Cookie{
-		Name:  "session",
-		Value: encoded,
-		Path:  "/",
+	s := &roi.Session{
+		User:      user,
+		UserAgent: r.UserAgent(),
+		Addr:      remoteHost(r),
+		Expires:   time.Now().Add(sessionLifetime),
 	}
-	http.SetCookie(w, c)
+	token, err := roi.AddSessionContext(r.Context(), db, s)
+	if err != nil {
+		return err
+	}
+	encoded, err := cookieHandler.Encode("session", token)
+	if err != nil {
+		return err
+	}
+	http.SetCookie(w, sessionCookie(encoded, int(sessionLifetime/time.Second)))
 	return nil
 }
 
-// getSession은 클라이언트 브라우저에 저장되어 있던 세션을 불러온다.
-func getSession(r *http.Request) (map[string]string, error) {
-	c, _ := r.Cookie("session")
-	if c == nil {
-		return nil, nil
+// apiTokenUserAgent는 api 토큰으로 만든 세션의 UserAgent이다.
+// 사용자가 세션 목록에서 api 토큰을 구별할 수 있게 한다.
+const apiTokenUserAgent = "roi api token"
+
+// issueAPIToken은 사용자의 api 질의에 쓸 새 세션을 만들고 그 토큰을 반환한다.
+// 토큰은 DB에 저장되지 않으므로 다시 확인할 수 없다.
+func issueAPIToken(r *http.Request, user string) (string, error) {
+	db, err := roi.DB()
+	if err != nil {
+		return "", err
+	}
+	s := &roi.Session{
+		User:      user,
+		UserAgent: apiTokenUserAgent,
+		Addr:      remoteHost(r),
+		Expires:   time.Now().Add(sessionLifetime),
 	}
-	value := make(map[string]string)
-	err := cookieHandler.Decode("session", c.Value, &value)
+	return roi.AddSessionContext(r.Context(), db, s)
+}
+
+// endSession은 요청한 사용자의 세션을 DB와 클라이언트 브라우저에서 지운다.
+func endSession(w http.ResponseWriter, r *http.Request) error {
+	clearSession(w)
+	s, err := currentSession(r)
+	if err != nil || s == nil {
+		return err
+	}
+	db, err := roi.DB()
 	if err != nil {
-		return nil, err
+		return err
 	}
-	return value, nil
+	return roi.DeleteSessionContext(r.Context(), db, s.ID)
 }
 
-// clearSession은 클라이언트 브라우저에 저장되어 있던 세션을 지운다.
+// clearSession은 클라이언트 브라우저에 저장되어 있던 세션 쿠키를 지운다.
 func clearSession(w http.ResponseWriter) {
-	c := &http.Cookie{
-		Name:   "session",
-		Value:  "",
-		Path:   "/",
-		MaxAge: -1,
+	http.SetCookie(w, sessionCookie("", -1))
+}
+
+// sessionCookie는 세션 쿠키를 만든다.
+// 쿠키는 자바스크립트로 읽을 수 없고, https로만 전송되며, 다른 사이트에서 보내는 POST 요청에는 담기지 않는다.
+func sessionCookie(value string, maxAge int) *http.Cookie {
+	return &http.Cookie{
+		Name:     "session",
+		Value:    value,
+		Path:     "/",
+		MaxAge:   maxAge,
+		HttpOnly: true,
+		Secure:   true,
+		SameSite: http.SameSiteLaxMode,
+	}
+}
+
+// remoteHost는 요청한 클라이언트의 주소에서 포트를 뺀 호스트를 반환한다.
+func remoteHost(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
 	}
-	http.SetCookie(w, c)
+	return host
 }
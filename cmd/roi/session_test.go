@@ -0,0 +1,171 @@
+package main
+
+import (
+	"bytes"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/gorilla/securecookie"
+	"github.com/studio2l/roi"
+)
+
+func TestValidCSRFToken(t *testing.T) {
+	s := &roi.Session{CSRFToken: "csrf-token"}
+	form := func(v url.Values) *http.Request {
+		r := httptest.NewRequest("POST", "/update-shot", strings.NewReader(v.Encode()))
+		r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		return r
+	}
+	header := func(token string) *http.Request {
+		r := httptest.NewRequest("POST", "/update-task", nil)
+		r.Header.Set("X-CSRF-Token", token)
+		return r
+	}
+	// multipart 폼은 본문이 아닌 주소의 토큰만 확인한다.
+	multipartForm := func(target string) *http.Request {
+		body := &bytes.Buffer{}
+		mw := multipart.NewWriter(body)
+		mw.WriteField("csrf_token", "csrf-token")
+		mw.Close()
+		r := httptest.NewRequest("POST", target, body)
+		r.Header.Set("Content-Type", mw.FormDataContentType())
+		return r
+	}
+	cases := []struct {
+		label string
+		r     *http.Request
+		want  bool
+	}{
+		{"form", form(url.Values{"csrf_token": {"csrf-token"}}), true},
+		{"wrong form", form(url.Values{"csrf_token": {"other-token"}}), false},
+		{"missing", form(url.Values{"shot": {"CG_0010"}}), false},
+		{"header", header("csrf-token"), true},
+		{"wrong header", header("other-token"), false},
+		{"multipart body", multipartForm("/upload-thumbnail"), false},
+		{"multipart query", multipartForm("/upload-thumbnail?csrf_token=csrf-token"), true},
+	}
+	for _, c := range cases {
+		got := validCSRFToken(c.r, s.CSRFToken)
+		if got != c.want {
+			t.Fatalf("%s: got %v, want %v", c.label, got, c.want)
+		}
+	}
+}
+
+func TestSessionCookie(t *testing.T) {
+	c := sessionCookie("value", 60)
+	if !c.HttpOnly || !c.Secure || c.SameSite != http.SameSiteLaxMode {
+		t.Fatalf("session cookie should be http only, secure and same site: %v", c)
+	}
+	if c := sessionCookie("", -1); c.MaxAge >= 0 {
+		t.Fatalf("cleared session cookie should expire immediately: %v", c)
+	}
+}
+
+func TestSessionToken(t *testing.T) {
+	orgHandler := cookieHandler
+	cookieHandler = securecookie.New(securecookie.GenerateRandomKey(64), securecookie.GenerateRandomKey(32))
+	defer func() { cookieHandler = orgHandler }()
+	encoded, err := cookieHandler.Encode("session", "cookie-token")
+	if err != nil {
+		t.Fatal(err)
+	}
+	req := func(target, auth string, cookie bool) *http.Request {
+		r := httptest.NewRequest("GET", target, nil)
+		if auth != "" {
+			r.Header.Set("Authorization", auth)
+		}
+		if cookie {
+			r.AddCookie(sessionCookie(encoded, 60))
+		}
+		return r
+	}
+	cases := []struct {
+		label string
+		r     *http.Request
+		want  string
+	}{
+		{"cookie", req("/shots/TEST", "", true), "cookie-token"},
+		{"header on page", req("/shots/TEST", "Bearer api-token", false), ""},
+		{"api header", req("/api/v1/path", "Bearer api-token", false), "api-token"},
+		{"api cookie", req("/api/v1/path", "", true), ""},
+		{"api basic auth", req("/api/v1/path", "Basic api-token", false), ""},
+	}
+	for _, c := range cases {
+		got := sessionToken(c.r)
+		if got != c.want {
+			t.Fatalf("%s: got %q, want %q", c.label, got, c.want)
+		}
+	}
+}
+
+func TestWithSessionRejectsAPIWithoutToken(t *testing.T) {
+	called := false
+	h := withSession(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		called = true
+	}))
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest("POST", "/api/v1/version/add", nil))
+	if called {
+		t.Fatalf("api request without token should not be handled")
+	}
+	if w.Code != http.StatusUnauthorized {
+		t.Fatalf("status: got %d, want %d", w.Code, http.StatusUnauthorized)
+	}
+}
+
+func TestWithSessionPreSessionCSRF(t *testing.T) {
+	orgHandler := cookieHandler
+	cookieHandler = securecookie.New(securecookie.GenerateRandomKey(64), securecookie.GenerateRandomKey(32))
+	defer func() { cookieHandler = orgHandler }()
+
+	// 로그인 페이지를 보일 때 세션 전 CSRF 토큰이 쿠키에 저장된다.
+	var token string
+	h := withSession(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		token = csrfToken(r)
+	}))
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest("GET", "/login", nil))
+	if token == "" {
+		t.Fatalf("pre-session csrf token should be made for a user without session")
+	}
+	cookies := w.Result().Cookies()
+	if len(cookies) != 1 || cookies[0].Name != "csrf" {
+		t.Fatalf("pre-session csrf cookie should be set: %v", cookies)
+	}
+
+	called := false
+	h = withSession(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		called = true
+	}))
+	post := func(form url.Values, cookie bool) *http.Request {
+		r := httptest.NewRequest("POST", "/login", strings.NewReader(form.Encode()))
+		r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		if cookie {
+			r.AddCookie(cookies[0])
+		}
+		return r
+	}
+	cases := []struct {
+		label string
+		r     *http.Request
+		want  bool
+	}{
+		{"no token", post(url.Values{"id": {"kybin"}}, true), false},
+		{"no cookie", post(url.Values{"csrf_token": {token}}, false), false},
+		{"wrong token", post(url.Values{"csrf_token": {"other-token"}}, true), false},
+		{"valid", post(url.Values{"csrf_token": {token}}, true), true},
+	}
+	for _, c := range cases {
+		called = false
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, c.r)
+		if called != c.want {
+			t.Fatalf("%s: handled %v, want %v", c.label, called, c.want)
+		}
+	}
+}
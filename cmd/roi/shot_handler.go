@@ -2,34 +2,39 @@ package main
 
 import (
 	"fmt"
-	"log"
+	"io"
+	"io/ioutil"
 	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
 	"time"
 
 	"github.com/studio2l/roi"
 )
 
 func addShotHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
 	db, err := roi.DB()
 	if err != nil {
-		log.Printf("could not connect to database: %v", err)
-		http.Error(w, "internal error", http.StatusInternalServerError)
+		handleError(w, r, fmt.Errorf("could not connect to database: %w", err))
 		return
 	}
 	session, err := getSession(r)
 	if err != nil {
-		http.Error(w, "could not get session", http.StatusUnauthorized)
+		httpError(w, r, "could not get session", http.StatusUnauthorized)
 		clearSession(w)
 		return
 	}
-	u, err := roi.GetUser(db, session["userid"])
+	u, err := roi.GetUserContext(ctx, db, session["userid"])
 	if err != nil {
-		http.Error(w, "could not get user information", http.StatusInternalServerError)
+		httpError(w, r, "could not get user information", http.StatusInternalServerError)
 		clearSession(w)
 		return
 	}
 	if u == nil {
-		http.Error(w, "user not exist", http.StatusBadRequest)
+		httpError(w, r, "user not exist", http.StatusBadRequest)
 		clearSession(w)
 		return
 	}
@@ -47,8 +52,7 @@ func addShotHandler(w http.ResponseWriter, r *http.Request) {
 		// 관련 이슈: #143
 		prjRows, err := db.Query("SELECT project FROM projects")
 		if err != nil {
-			log.Print("could not select the first project:", err)
-			http.Error(w, "internal error", http.StatusInternalServerError)
+			handleError(w, r, fmt.Errorf("could not select the first project: %w", err))
 			return
 		}
 		defer prjRows.Close()
@@ -57,38 +61,36 @@ func addShotHandler(w http.ResponseWriter, r *http.Request) {
 			return
 		}
 		if err := prjRows.Scan(&prj); err != nil {
-			log.Printf("could not scan a row of project '%s': %v", prj, err)
-			http.Error(w, err.Error(), http.StatusInternalServerError)
+			handleError(w, r, fmt.Errorf("could not scan a row of project '%s': %w", prj, err))
 			return
 		}
 		http.Redirect(w, r, "/add-shot/?project="+prj, http.StatusSeeOther)
 		return
 	}
-	p, err := roi.GetProject(db, prj)
+	p, err := roi.GetProjectContext(ctx, db, prj)
 	if err != nil {
-		log.Printf("could not get project '%s': %v", prj, err)
-		http.Error(w, "internal error", http.StatusInternalServerError)
+		handleError(w, r, fmt.Errorf("could not get project '%s': %w", prj, err))
 		return
 	}
 	if p == nil {
 		msg := fmt.Sprintf("project '%s' not exist", prj)
-		http.Error(w, msg, http.StatusBadRequest)
+		httpError(w, r, msg, http.StatusNotFound)
 		return
 	}
+	var errs map[string]string
 	if r.Method == "POST" {
 		shot := r.Form.Get("shot")
 		if shot == "" {
-			http.Error(w, "need 'shot'", http.StatusBadRequest)
+			httpError(w, r, "need 'shot'", http.StatusBadRequest)
 			return
 		}
-		exist, err := roi.ShotExist(db, prj, shot)
+		exist, err := roi.ShotExistContext(ctx, db, prj, shot)
 		if err != nil {
-			log.Printf("could not check shot '%s' exist", shot)
-			http.Error(w, "internal error", http.StatusInternalServerError)
+			handleError(w, r, fmt.Errorf("could not check shot '%s' exist: %w", shot, err))
 			return
 		}
 		if exist {
-			http.Error(w, "shot '%s' already exist", http.StatusBadRequest)
+			httpError(w, r, fmt.Sprintf("shot '%s' already exist", shot), http.StatusConflict)
 			return
 		}
 		tasks := fields(r.Form.Get("working_tasks"), ",")
@@ -105,59 +107,74 @@ func addShotHandler(w http.ResponseWriter, r *http.Request) {
 			Tags:          fields(r.Form.Get("tags"), ","),
 			WorkingTasks:  tasks,
 		}
-		err = roi.AddShot(db, prj, s)
-		if err != nil {
-			log.Printf("could not add shot '%s': %v", prj+"."+shot, err)
-			http.Error(w, "internal error", http.StatusInternalServerError)
+		err = roi.AddShotContext(ctx, db, prj, s)
+		if err == nil {
+			for _, task := range tasks {
+				t := &roi.Task{
+					Project: prj,
+					Shot:    shot,
+					Task:    task,
+					Status:  roi.TaskNotSet,
+					DueDate: time.Time{},
+				}
+				roi.AddTaskContext(ctx, db, prj, shot, t)
+			}
+			http.Redirect(w, r, fmt.Sprintf("/shot/%s/%s", prj, shot), http.StatusSeeOther)
 			return
 		}
-		for _, task := range tasks {
-			t := &roi.Task{
-				Project: prj,
-				Shot:    shot,
-				Task:    task,
-				Status:  roi.TaskNotSet,
-				DueDate: time.Time{},
-			}
-			roi.AddTask(db, prj, shot, t)
+		// 입력이 적절하지 않으면 에러 메시지와 함께 폼을 다시 보인다.
+		errs = formErrors(w, err)
+		if errs == nil {
+			handleError(w, r, fmt.Errorf("could not add shot '%s': %w", prj+"."+shot, err))
+			return
 		}
-		http.Redirect(w, r, fmt.Sprintf("/shot/%s/%s", prj, shot), http.StatusSeeOther)
+	}
+	tags, err := roi.GetProjectTagsContext(ctx, db, prj)
+	if err != nil {
+		handleError(w, r, fmt.Errorf("could not get tags of project '%s': %w", prj, err))
 		return
 	}
 	recipt := struct {
 		LoggedInUser string
 		Project      *roi.Project
+		ProjectTags  []string
+		// Form과 Errors는 입력이 적절하지 않아 폼을 다시 보일 때 사용한다.
+		Form   url.Values
+		Errors map[string]string
 	}{
 		LoggedInUser: session["userid"],
 		Project:      p,
+		ProjectTags:  tags,
+		Form:         r.Form,
+		Errors:       errs,
 	}
-	err = executeTemplate(w, "add-shot.html", recipt)
+	err = executeTemplate(w, r, "add-shot.html", recipt)
 	if err != nil {
-		log.Fatal(err)
+		handleError(w, r, err)
 	}
 }
 
 func updateShotHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
 	db, err := roi.DB()
 	if err != nil {
-		log.Printf("could not connect to database: %v", err)
-		http.Error(w, "internal error", http.StatusInternalServerError)
+		handleError(w, r, fmt.Errorf("could not connect to database: %w", err))
 		return
 	}
 	session, err := getSession(r)
 	if err != nil {
-		http.Error(w, "could not get session", http.StatusUnauthorized)
+		httpError(w, r, "could not get session", http.StatusUnauthorized)
 		clearSession(w)
 		return
 	}
-	u, err := roi.GetUser(db, session["userid"])
+	u, err := roi.GetUserContext(ctx, db, session["userid"])
 	if err != nil {
-		http.Error(w, "could not get user information", http.StatusInternalServerError)
+		httpError(w, r, "could not get user information", http.StatusInternalServerError)
 		clearSession(w)
 		return
 	}
 	if u == nil {
-		http.Error(w, "user not exist", http.StatusBadRequest)
+		httpError(w, r, "user not exist", http.StatusBadRequest)
 		clearSession(w)
 		return
 	}
@@ -169,39 +186,38 @@ func updateShotHandler(w http.ResponseWriter, r *http.Request) {
 	r.ParseForm()
 	prj := r.Form.Get("project")
 	if prj == "" {
-		http.Error(w, "need 'project'", http.StatusBadRequest)
+		httpError(w, r, "need 'project'", http.StatusBadRequest)
 		return
 	}
-	exist, err := roi.ProjectExist(db, prj)
+	exist, err := roi.ProjectExistContext(ctx, db, prj)
 	if err != nil {
-		log.Print(err)
-		http.Error(w, "internal error", http.StatusInternalServerError)
+		handleError(w, r, err)
 		return
 	}
 	if !exist {
-		http.Error(w, fmt.Sprintf("project '%s' not exist", prj), http.StatusBadRequest)
+		httpError(w, r, fmt.Sprintf("project '%s' not exist", prj), http.StatusNotFound)
 		return
 	}
 	shot := r.Form.Get("shot")
 	if shot == "" {
-		http.Error(w, "need 'shot'", http.StatusBadRequest)
+		httpError(w, r, "need 'shot'", http.StatusBadRequest)
 		return
 	}
+	var errs map[string]string
 	if r.Method == "POST" {
-		exist, err = roi.ShotExist(db, prj, shot)
+		exist, err = roi.ShotExistContext(ctx, db, prj, shot)
 		if err != nil {
-			log.Print(err)
-			http.Error(w, "internal error", http.StatusInternalServerError)
+			handleError(w, r, err)
 			return
 		}
 		if !exist {
-			http.Error(w, fmt.Sprintf("shot '%s' not exist", shot), http.StatusBadRequest)
+			httpError(w, r, fmt.Sprintf("shot '%s' not exist", shot), http.StatusNotFound)
 			return
 		}
 		tasks := fields(r.Form.Get("working_tasks"), ",")
 		tforms, err := parseTimeForms(r.Form, "due_date")
 		if err != nil {
-			http.Error(w, err.Error(), http.StatusBadRequest)
+			httpError(w, r, err.Error(), http.StatusBadRequest)
 		}
 		upd := roi.UpdateShotParam{
 			Status:        roi.ShotStatus(r.Form.Get("status")),
@@ -215,75 +231,247 @@ func updateShotHandler(w http.ResponseWriter, r *http.Request) {
 			WorkingTasks:  tasks,
 			DueDate:       tforms["due_date"],
 		}
-		err = roi.UpdateShot(db, prj, shot, upd)
-		if err != nil {
-			log.Print(err)
-			http.Error(w, fmt.Sprintf("could not update shot '%s'", shot), http.StatusInternalServerError)
-			return
-		}
-		// 샷에 등록된 태스크 중 기존에 없었던 태스크가 있다면 생성한다.
-		for _, task := range tasks {
-			t := &roi.Task{
-				Project: prj,
-				Shot:    shot,
-				Task:    task,
-				Status:  roi.TaskNotSet,
-				DueDate: time.Time{},
-			}
-			tid := prj + "." + shot + "." + task
-			exist, err := roi.TaskExist(db, prj, shot, task)
-			if err != nil {
-				log.Printf("could not check task '%s' exist: %v", tid, err)
-				http.Error(w, "internal error", http.StatusInternalServerError)
-				return
-			}
-			if !exist {
-				err := roi.AddTask(db, prj, shot, t)
+		err = roi.UpdateShotContext(ctx, db, prj, shot, upd)
+		if err == nil {
+			// 샷에 등록된 태스크 중 기존에 없었던 태스크가 있다면 생성한다.
+			for _, task := range tasks {
+				t := &roi.Task{
+					Project: prj,
+					Shot:    shot,
+					Task:    task,
+					Status:  roi.TaskNotSet,
+					DueDate: time.Time{},
+				}
+				tid := prj + "." + shot + "." + task
+				exist, err := roi.TaskExistContext(ctx, db, prj, shot, task)
 				if err != nil {
-					log.Printf("could not add task '%s': %v", tid, err)
-					http.Error(w, "internal error", http.StatusInternalServerError)
+					handleError(w, r, fmt.Errorf("could not check task '%s' exist: %w", tid, err))
 					return
 				}
+				if !exist {
+					err := roi.AddTaskContext(ctx, db, prj, shot, t)
+					if err != nil {
+						handleError(w, r, fmt.Errorf("could not add task '%s': %w", tid, err))
+						return
+					}
+				}
 			}
+			http.Redirect(w, r, r.RequestURI, http.StatusSeeOther)
+			return
+		}
+		// 입력이 적절하지 않으면 에러 메시지와 함께 폼을 다시 보인다.
+		errs = formErrors(w, err)
+		if errs == nil {
+			handleError(w, r, fmt.Errorf("could not update shot '%s': %w", shot, err))
+			return
 		}
-		http.Redirect(w, r, r.RequestURI, http.StatusSeeOther)
-		return
 	}
-	s, err := roi.GetShot(db, prj, shot)
+	s, err := roi.GetShotContext(ctx, db, prj, shot)
 	if err != nil {
-		log.Print(err)
-		http.Error(w, "internal error", http.StatusInternalServerError)
+		handleError(w, r, err)
 		return
 	}
 	if s == nil {
-		http.Error(w, fmt.Sprintf("shot '%s' not exist", shot), http.StatusBadRequest)
+		// 이름이 바뀌거나 합쳐진 샷의 예전 이름이라면 현재 샷으로 이동한다.
+		cur, err := roi.ResolveShotAliasContext(ctx, db, prj, shot)
+		if err != nil {
+			handleError(w, r, fmt.Errorf("could not resolve shot alias '%s': %w", prj+"."+shot, err))
+			return
+		}
+		if cur != "" {
+			http.Redirect(w, r, "/update-shot?project="+url.QueryEscape(prj)+"&shot="+url.QueryEscape(cur), http.StatusSeeOther)
+			return
+		}
+		httpError(w, r, fmt.Sprintf("shot '%s' not exist", shot), http.StatusNotFound)
 		return
 	}
-	ts, err := roi.ShotTasks(db, prj, shot)
+	ts, err := roi.ShotTasksContext(ctx, db, prj, shot)
 	if err != nil {
-		log.Printf("could not get all tasks of shot '%s': %v", prj+"."+shot, err)
-		http.Error(w, "internal error", http.StatusInternalServerError)
+		handleError(w, r, fmt.Errorf("could not get all tasks of shot '%s': %w", prj+"."+shot, err))
 		return
 	}
 	tm := make(map[string]*roi.Task)
 	for _, t := range ts {
 		tm[t.Task] = t
 	}
+	last, err := roi.LastShotDeliveryContext(ctx, db, prj, shot)
+	if err != nil {
+		handleError(w, r, fmt.Errorf("could not get last delivery of shot '%s': %w", prj+"."+shot, err))
+		return
+	}
+	vts, err := roi.ShotVendorTasksContext(ctx, db, prj, shot)
+	if err != nil {
+		handleError(w, r, fmt.Errorf("could not get vendor tasks of shot '%s': %w", prj+"."+shot, err))
+		return
+	}
+	vs, err := roi.AllVendorsContext(ctx, db)
+	if err != nil {
+		handleError(w, r, fmt.Errorf("could not get vendors: %w", err))
+		return
+	}
+	tags, err := roi.GetProjectTagsContext(ctx, db, prj)
+	if err != nil {
+		handleError(w, r, fmt.Errorf("could not get tags of project '%s': %w", prj, err))
+		return
+	}
+	aliases, err := roi.ShotAliasesContext(ctx, db, prj, shot)
+	if err != nil {
+		handleError(w, r, fmt.Errorf("could not get aliases of shot '%s': %w", prj+"."+shot, err))
+		return
+	}
 	recipt := struct {
 		LoggedInUser  string
 		Shot          *roi.Shot
 		AllShotStatus []roi.ShotStatus
 		Tasks         map[string]*roi.Task
 		AllTaskStatus []roi.TaskStatus
+		LastDelivery  *roi.Delivery
+		VendorTasks   map[string]*roi.VendorTask
+		Vendors       []*roi.Vendor
+		ProjectTags   []string
+		Aliases       []*roi.ShotAlias
+		// Form과 Errors는 입력이 적절하지 않아 폼을 다시 보일 때 사용한다.
+		Form   url.Values
+		Errors map[string]string
 	}{
 		LoggedInUser:  session["userid"],
 		Shot:          s,
 		AllShotStatus: roi.AllShotStatus,
 		Tasks:         tm,
 		AllTaskStatus: roi.AllTaskStatus,
+		LastDelivery:  last,
+		VendorTasks:   vts,
+		Vendors:       vs,
+		ProjectTags:   tags,
+		Aliases:       aliases,
+		Form:          r.Form,
+		Errors:        errs,
+	}
+	err = executeTemplate(w, r, "update-shot.html", recipt)
+	if err != nil {
+		handleError(w, r, err)
+	}
+}
+
+// editShotHandler는 /rename-shot, /split-shot, /merge-shot으로 POST된 정보로
+// 샷의 이름을 바꾸거나, 샷을 나누거나, 다른 샷에 합친 뒤 결과 샷의 수정 페이지로 이동한다.
+func editShotHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	if r.Method != "POST" {
+		httpError(w, r, "need POST", http.StatusBadRequest)
+		return
+	}
+	db, err := roi.DB()
+	if err != nil {
+		handleError(w, r, fmt.Errorf("could not connect to database: %w", err))
+		return
+	}
+	session, err := getSession(r)
+	if err != nil || session["userid"] == "" {
+		httpError(w, r, "could not get session", http.StatusUnauthorized)
+		clearSession(w)
+		return
+	}
+	r.ParseForm()
+	prj := r.Form.Get("project")
+	shot := r.Form.Get("shot")
+	if prj == "" || shot == "" {
+		httpError(w, r, "need 'project' and 'shot'", http.StatusBadRequest)
+		return
+	}
+	var result string
+	switch r.URL.Path {
+	case "/rename-shot":
+		result = strings.TrimSpace(r.Form.Get("new_shot"))
+		err = roi.RenameShotContext(ctx, db, prj, shot, result)
+	case "/split-shot":
+		result = strings.TrimSpace(r.Form.Get("new_shot"))
+		err = roi.SplitShotContext(ctx, db, prj, shot, result, fields(r.Form.Get("tasks"), ","))
+	case "/merge-shot":
+		result = strings.TrimSpace(r.Form.Get("into"))
+		err = roi.MergeShotContext(ctx, db, prj, shot, result)
+	default:
+		httpError(w, r, "page not found", http.StatusNotFound)
+		return
 	}
-	err = executeTemplate(w, "update-shot.html", recipt)
 	if err != nil {
-		log.Fatal(err)
+		handleError(w, r, fmt.Errorf("could not edit shot '%s' (%s): %w", prj+"."+shot, r.URL.Path, err))
+		return
+	}
+	http.Redirect(w, r, "/update-shot?project="+url.QueryEscape(prj)+"&shot="+url.QueryEscape(result), http.StatusSeeOther)
+}
+
+// maxThumbnailUploadSize는 업로드 받을 수 있는 썸네일 원본 파일의 최대 크기이다.
+const maxThumbnailUploadSize = 256 << 20
+
+// saveThumbnailUpload는 multipart 폼의 "thumbnail" 파일을 받아 특정 샷의 썸네일로 등록한다.
+// 원본 파일은 확장자를 유지한 임시 파일로 저장된 후 roi.AddThumbnail로 처리된다.
+func saveThumbnailUpload(r *http.Request, prj, shot string) error {
+	f, fh, err := r.FormFile("thumbnail")
+	if err != nil {
+		return fmt.Errorf("could not get thumbnail file from form: %v", err)
+	}
+	defer f.Close()
+	tmpd, err := ioutil.TempDir("", "roi-upload-")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(tmpd)
+	tmpf := filepath.Join(tmpd, "upload"+strings.ToLower(filepath.Ext(fh.Filename)))
+	to, err := os.Create(tmpf)
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(to, f)
+	to.Close()
+	if err != nil {
+		return err
+	}
+	return roi.AddThumbnail(prj, shot, tmpf)
+}
+
+// uploadThumbnailHandler는 사용자가 샷 수정 페이지에서 썸네일 파일을 올렸을 때
+// 이를 샷의 썸네일로 등록하고 샷 수정 페이지로 돌아간다.
+func uploadThumbnailHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	if r.Method != "POST" {
+		httpError(w, r, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	db, err := roi.DB()
+	if err != nil {
+		handleError(w, r, fmt.Errorf("could not connect to database: %w", err))
+		return
+	}
+	session, err := getSession(r)
+	if err != nil {
+		httpError(w, r, "could not get session", http.StatusUnauthorized)
+		clearSession(w)
+		return
+	}
+	if session == nil || session["userid"] == "" {
+		httpError(w, r, "need to login", http.StatusUnauthorized)
+		return
+	}
+	r.Body = http.MaxBytesReader(w, r.Body, maxThumbnailUploadSize)
+	if err := r.ParseMultipartForm(32 << 20); err != nil {
+		httpError(w, r, fmt.Sprintf("could not parse form: %v", err), http.StatusBadRequest)
+		return
+	}
+	prj := r.Form.Get("project")
+	shot := r.Form.Get("shot")
+	exist, err := roi.ShotExistContext(ctx, db, prj, shot)
+	if err != nil {
+		handleError(w, r, fmt.Errorf("could not check shot '%s' exist: %w", prj+"."+shot, err))
+		return
+	}
+	if !exist {
+		httpError(w, r, fmt.Sprintf("shot '%s' not exist", prj+"."+shot), http.StatusNotFound)
+		return
+	}
+	if err := saveThumbnailUpload(r, prj, shot); err != nil {
+		httpError(w, r, fmt.Sprintf("could not add thumbnail: %v", err), http.StatusBadRequest)
+		return
 	}
+	http.Redirect(w, r, fmt.Sprintf("/update-shot?project=%s&shot=%s", prj, shot), http.StatusSeeOther)
 }
@@ -0,0 +1,131 @@
+// 버전 페이지에서 이미지나 멈춘 영상 프레임 위에 리뷰 그림을 그린다.
+//
+// .annotate-button 버튼을 누르면 data-target 아이디를 가진 이미지나 영상의
+// 현재 화면을 캔버스에 옮기고, 그 위에 마우스로 선을 그릴 수 있게 한다.
+// 리뷰 폼을 보낼 때 선들의 정보(0에서 1 사이의 비율 좌표)와
+// 원본 위에 선을 그려 합친 PNG 이미지가 파일로 함께 전송된다.
+(function() {
+    var form = document.getElementById("review-form");
+    var area = document.getElementById("annotate-area");
+    var canvas = document.getElementById("annotate-canvas");
+    if (!form || !area || !canvas) {
+        return;
+    }
+    var ctx = canvas.getContext("2d");
+    var color = "#FF3333";
+    var width = 0.004; // 캔버스 너비에 대한 비율
+    var background = null;
+    var strokes = [];
+    var drawing = null;
+
+    function redraw() {
+        ctx.drawImage(background, 0, 0, canvas.width, canvas.height);
+        strokes.forEach(function(s) {
+            ctx.strokeStyle = s.color;
+            ctx.lineWidth = s.width * canvas.width;
+            ctx.lineCap = "round";
+            ctx.lineJoin = "round";
+            ctx.beginPath();
+            s.points.forEach(function(p, i) {
+                var x = p[0] * canvas.width;
+                var y = p[1] * canvas.height;
+                if (i == 0) {
+                    ctx.moveTo(x, y);
+                    ctx.lineTo(x, y);
+                } else {
+                    ctx.lineTo(x, y);
+                }
+            });
+            ctx.stroke();
+        });
+    }
+
+    function point(e) {
+        var r = canvas.getBoundingClientRect();
+        var x = (e.clientX - r.left) / r.width;
+        var y = (e.clientY - r.top) / r.height;
+        return [Math.min(Math.max(x, 0), 1), Math.min(Math.max(y, 0), 1)];
+    }
+
+    function start(btn) {
+        var media = document.getElementById(btn.dataset.target);
+        var w, h;
+        if (media.tagName == "VIDEO") {
+            media.pause();
+            w = media.videoWidth;
+            h = media.videoHeight;
+            form.elements["frame"].value = Math.round(media.currentTime * Number(form.dataset.fps));
+        } else {
+            w = media.naturalWidth;
+            h = media.naturalHeight;
+            form.elements["frame"].value = 0;
+        }
+        if (!w || !h) {
+            alert("이미지를 아직 불러오지 못했습니다.");
+            return;
+        }
+        canvas.width = w;
+        canvas.height = h;
+        // 화면에서 보이는 캔버스는 원본 미디어와 같은 크기로 한다.
+        canvas.style.width = media.clientWidth + "px";
+        // 영상은 계속 재생될 수 있으므로 현재 화면을 따로 복사해 둔다.
+        background = document.createElement("canvas");
+        background.width = w;
+        background.height = h;
+        background.getContext("2d").drawImage(media, 0, 0, w, h);
+        strokes = [];
+        form.elements["source"].value = btn.dataset.source;
+        area.style.display = "";
+        redraw();
+        area.scrollIntoView();
+    }
+
+    document.querySelectorAll(".annotate-button").forEach(function(btn) {
+        btn.addEventListener("click", function() {
+            start(btn);
+        });
+    });
+
+    canvas.addEventListener("mousedown", function(e) {
+        drawing = {color: color, width: width, points: [point(e)]};
+        strokes.push(drawing);
+        redraw();
+    });
+    canvas.addEventListener("mousemove", function(e) {
+        if (!drawing) {
+            return;
+        }
+        drawing.points.push(point(e));
+        redraw();
+    });
+    window.addEventListener("mouseup", function() {
+        drawing = null;
+    });
+
+    document.getElementById("annotate-undo").addEventListener("click", function() {
+        strokes.pop();
+        redraw();
+    });
+    document.getElementById("annotate-cancel").addEventListener("click", function() {
+        strokes = [];
+        area.style.display = "none";
+    });
+
+    form.addEventListener("submit", function(e) {
+        if (strokes.length == 0) {
+            form.elements["strokes"].value = "";
+            form.elements["image"].value = "";
+            return;
+        }
+        // PNG 이미지는 비동기로 만들어지므로 만들어진 뒤에 폼을 보낸다.
+        e.preventDefault();
+        redraw();
+        form.elements["strokes"].value = JSON.stringify(strokes);
+        canvas.toBlob(function(blob) {
+            var files = new DataTransfer();
+            files.items.add(new File([blob], "annotation.png", {type: "image/png"}));
+            form.elements["image"].files = files.files;
+            form.submit();
+        }, "image/png");
+    });
+})();
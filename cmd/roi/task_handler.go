@@ -2,33 +2,33 @@ package main
 
 import (
 	"fmt"
-	"log"
 	"net/http"
+	"net/url"
 
 	"github.com/studio2l/roi"
 )
 
 func updateTaskHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
 	db, err := roi.DB()
 	if err != nil {
-		log.Printf("could not connect to database: %v", err)
-		http.Error(w, "internal error", http.StatusInternalServerError)
+		handleError(w, r, fmt.Errorf("could not connect to database: %w", err))
 		return
 	}
 	session, err := getSession(r)
 	if err != nil {
-		http.Error(w, "could not get session", http.StatusUnauthorized)
+		httpError(w, r, "could not get session", http.StatusUnauthorized)
 		clearSession(w)
 		return
 	}
-	u, err := roi.GetUser(db, session["userid"])
+	u, err := roi.GetUserContext(ctx, db, session["userid"])
 	if err != nil {
-		http.Error(w, "could not get user information", http.StatusInternalServerError)
+		httpError(w, r, "could not get user information", http.StatusInternalServerError)
 		clearSession(w)
 		return
 	}
 	if u == nil {
-		http.Error(w, "user not exist", http.StatusBadRequest)
+		httpError(w, r, "user not exist", http.StatusBadRequest)
 		clearSession(w)
 		return
 	}
@@ -40,69 +40,70 @@ func updateTaskHandler(w http.ResponseWriter, r *http.Request) {
 	r.ParseForm()
 	prj := r.Form.Get("project")
 	if prj == "" {
-		http.Error(w, "need 'project'", http.StatusBadRequest)
+		httpError(w, r, "need 'project'", http.StatusBadRequest)
 		return
 	}
-	exist, err := roi.ProjectExist(db, prj)
+	exist, err := roi.ProjectExistContext(ctx, db, prj)
 	if err != nil {
-		log.Print(err)
-		http.Error(w, "internal error", http.StatusInternalServerError)
+		handleError(w, r, err)
 		return
 	}
 	if !exist {
-		http.Error(w, fmt.Sprintf("project '%s' not exist", prj), http.StatusBadRequest)
+		httpError(w, r, fmt.Sprintf("project '%s' not exist", prj), http.StatusNotFound)
 		return
 	}
 	shot := r.Form.Get("shot")
 	if shot == "" {
-		http.Error(w, "need 'shot'", http.StatusBadRequest)
+		httpError(w, r, "need 'shot'", http.StatusBadRequest)
 		return
 	}
 	task := r.Form.Get("task")
 	if task == "" {
-		http.Error(w, "need 'task'", http.StatusBadRequest)
+		httpError(w, r, "need 'task'", http.StatusBadRequest)
 		return
 	}
 	taskID := prj + "." + shot + "." + task
+	var errs map[string]string
 	if r.Method == "POST" {
-		exist, err = roi.TaskExist(db, prj, shot, task)
+		exist, err = roi.TaskExistContext(ctx, db, prj, shot, task)
 		if err != nil {
-			log.Printf("could not check task '%s' exist: %v", taskID, err)
-			http.Error(w, "internal error", http.StatusInternalServerError)
+			handleError(w, r, fmt.Errorf("could not check task '%s' exist: %w", taskID, err))
 			return
 		}
 		if !exist {
-			http.Error(w, fmt.Sprintf("task '%s' not exist", taskID), http.StatusBadRequest)
+			httpError(w, r, fmt.Sprintf("task '%s' not exist", taskID), http.StatusNotFound)
 			return
 		}
 		tforms, err := parseTimeForms(r.Form, "due_date")
 		if err != nil {
-			http.Error(w, err.Error(), http.StatusBadRequest)
+			httpError(w, r, err.Error(), http.StatusBadRequest)
 		}
 		upd := roi.UpdateTaskParam{
 			Status:   roi.TaskStatus(r.Form.Get("status")),
 			Assignee: r.Form.Get("assignee"),
 			DueDate:  tforms["due_date"],
 		}
-		err = roi.UpdateTask(db, prj, shot, task, upd)
-		if err != nil {
-			log.Printf("could not update task '%s': %v", taskID, err)
-			http.Error(w, "internal error", http.StatusInternalServerError)
+		err = roi.UpdateTaskContext(ctx, db, prj, shot, task, upd)
+		if err == nil {
+			// 수정 페이지로 돌아간다.
+			r.Method = "GET"
+			http.Redirect(w, r, r.RequestURI, http.StatusSeeOther)
+			return
+		}
+		// 입력이 적절하지 않으면 에러 메시지와 함께 폼을 다시 보인다.
+		errs = formErrors(w, err)
+		if errs == nil {
+			handleError(w, r, fmt.Errorf("could not update task '%s': %w", taskID, err))
 			return
 		}
-		// 수정 페이지로 돌아간다.
-		r.Method = "GET"
-		http.Redirect(w, r, r.RequestURI, http.StatusSeeOther)
-		return
 	}
-	t, err := roi.GetTask(db, prj, shot, task)
+	t, err := roi.GetTaskContext(ctx, db, prj, shot, task)
 	if err != nil {
-		log.Printf("could not get task '%s': %v", taskID, err)
-		http.Error(w, "internal error", http.StatusInternalServerError)
+		handleError(w, r, fmt.Errorf("could not get task '%s': %w", taskID, err))
 		return
 	}
 	if t == nil {
-		http.Error(w, fmt.Sprintf("task '%s' not exist", taskID), http.StatusBadRequest)
+		httpError(w, r, fmt.Sprintf("task '%s' not exist", taskID), http.StatusNotFound)
 		return
 	}
 	vers := make([]int, t.LastOutputVersion)
@@ -114,14 +115,19 @@ func updateTaskHandler(w http.ResponseWriter, r *http.Request) {
 		Task          *roi.Task
 		AllTaskStatus []roi.TaskStatus
 		Versions      []int // 역순
+		// Form과 Errors는 입력이 적절하지 않아 폼을 다시 보일 때 사용한다.
+		Form   url.Values
+		Errors map[string]string
 	}{
 		LoggedInUser:  session["userid"],
 		Task:          t,
 		AllTaskStatus: roi.AllTaskStatus,
 		Versions:      vers,
+		Form:          r.Form,
+		Errors:        errs,
 	}
-	err = executeTemplate(w, "update-task.html", recipt)
+	err = executeTemplate(w, r, "update-task.html", recipt)
 	if err != nil {
-		log.Fatal(err)
+		handleError(w, r, err)
 	}
 }
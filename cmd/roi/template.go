@@ -1,60 +1,116 @@
 package main
 
 import (
+	"bytes"
 	"fmt"
 	"html/template"
 	"net/http"
 	"net/url"
-	"os"
+	"path/filepath"
 	"strings"
 	"time"
+
+	"github.com/studio2l/roi"
 )
 
+// templateDir은 html 템플릿들이 있는 디렉토리이다.
+var templateDir = "tmpl"
+
 // templates에는 사용자에게 보일 페이지의 템플릿이 담긴다.
 var templates *template.Template
 
 // executeTemplate은 템플릿과 정보를 이용하여 w에 응답한다.
 // templates.ExecuteTemplate 대신 이 함수를 쓰는 이유는 개발모드일 때
 // 재 컴파일 없이 업데이트된 템플릿을 사용할 수 있기 때문이다.
-func executeTemplate(w http.ResponseWriter, name string, data interface{}) error {
+// 템플릿을 모두 그린 뒤에 응답하므로, 에러가 나면 w에는 아무것도 쓰이지 않는다.
+func executeTemplate(w http.ResponseWriter, r *http.Request, name string, data interface{}) error {
+	buf, err := renderTemplate(r, name, data)
+	if err != nil {
+		return err
+	}
+	_, err = buf.WriteTo(w)
+	return err
+}
+
+// renderTemplate은 요청 r에 대한 응답으로 템플릿을 그린다.
+// 템플릿 안의 csrfToken은 요청한 사용자의 세션의 CSRF 토큰을 반환한다.
+func renderTemplate(r *http.Request, name string, data interface{}) (*bytes.Buffer, error) {
 	if dev {
 		parseTemplate()
 	}
-	return templates.ExecuteTemplate(w, name, data)
+	// html/template은 실행한 템플릿을 복제할 수 없으므로 templates는 직접 실행하지 않는다.
+	t, err := templates.Clone()
+	if err != nil {
+		return nil, err
+	}
+	t.Funcs(template.FuncMap{
+		"csrfToken": func() string { return csrfToken(r) },
+	})
+	buf := new(bytes.Buffer)
+	err = t.ExecuteTemplate(buf, name, data)
+	if err != nil {
+		return nil, err
+	}
+	return buf, nil
 }
 
-// parseTemplate은 tmpl 디렉토리 안의 html파일들을 파싱하여 http 응답에 사용될 수 있도록 한다.
+// parseTemplate은 templateDir 디렉토리 안의 html파일들을 파싱하여 http 응답에 사용될 수 있도록 한다.
 func parseTemplate() {
 	templates = template.Must(template.New("").Funcs(template.FuncMap{
-		"hasThumbnail":        hasThumbnail,
+		"thumbnailURL":        thumbnailURL,
+		"versionThumbnailURL": versionThumbnailURL,
+		"mediaURL":            mediaURL,
+		"annotationURL":       annotationURL,
+		"isImageSequence":     roi.IsImageSequence,
 		"stringFromTime":      stringFromTime,
 		"stringFromDate":      stringFromDate,
 		"shortStringFromDate": shortStringFromDate,
 		"isSunday":            isSunday,
 		"dayColorInTimeline":  dayColorInTimeline,
 		"mod":                 func(i, m int) int { return i % m },
+		"add":                 func(a, b int) int { return a + b },
 		"sub":                 func(a, b int) int { return a - b },
 		"join":                strings.Join,
-	}).ParseGlob("tmpl/*.html"))
+		// csrfToken은 renderTemplate에서 요청마다 바뀐다.
+		"csrfToken": func() string { return "" },
+	}).ParseGlob(filepath.Join(templateDir, "*.html")))
 }
 
 // 아래는 템플릿 안에서 사용되는 함수들이다.
 //
 
-// hasThumbnail은 해당 특정 프로젝트 샷에 썸네일이 있는지 검사한다.
-//
-// 주의: 만일 썸네일 파일 검사시 에러가 나면 이 함수는 썸네일이 있다고 판단한다.
-// 이 함수는 템플릿 안에서 쓰이기 때문에 프론트 엔드에서 한번 더 검사하게
-// 만들기 위해서이다.
-func hasThumbnail(prj, shot string) bool {
-	_, err := os.Stat(fmt.Sprintf("roi-userdata/thumbnail/%s/%s.png", prj, shot))
-	if err != nil {
-		if os.IsNotExist(err) {
-			return false
-		}
-		return true // 함수 주석 참고
+// thumbnailURL은 특정 프로젝트 샷의 해당 크기 썸네일 주소를 반환한다.
+// 썸네일이 없다면 빈 문자열을 반환한다. roi.ThumbnailURLPath 참고.
+func thumbnailURL(prj, shot, size string) string {
+	pth := roi.ThumbnailURLPath(prj, shot, size)
+	if pth == "" {
+		return ""
 	}
-	return true
+	return "/thumbnail/" + pth
+}
+
+// versionThumbnailURL은 버전을 대표하는 썸네일 주소를 반환한다.
+// 썸네일이 아직 만들어지지 않았다면 빈 문자열을 반환한다. roi.VersionThumbnailURLPath 참고.
+func versionThumbnailURL(prj, shot, task string, version int) string {
+	pth := roi.VersionThumbnailURLPath(prj, shot, task, version)
+	if pth == "" {
+		return ""
+	}
+	return "/version-thumbnail/" + pth
+}
+
+// annotationURL은 리뷰에 첨부된 그림 이미지의 주소를 반환한다. roi.AnnotationImageURLPath 참고.
+func annotationURL(prj, reviewID string) string {
+	pth := roi.AnnotationImageURLPath(prj, reviewID)
+	if pth == "" {
+		return ""
+	}
+	return "/annotation/" + pth
+}
+
+// mediaURL은 파일 서버 상의 미디어 파일을 roi를 통해 볼 수 있는 주소를 반환한다.
+func mediaURL(pth string) string {
+	return "/media?path=" + url.QueryEscape(pth)
 }
 
 // isSunday는 해당일이 일요일인지를 검사한다.
@@ -111,6 +167,17 @@ func parseTimeForms(form url.Values, keys ...string) (map[string]time.Time, erro
 	return tforms, nil
 }
 
+// formErrors는 err가 입력 검증 에러라면 폼에 보일 필드별 에러 메시지를 반환한다.
+// 메시지가 있다면 응답 상태를 400으로 정하므로, 호출한 쪽은 이어서 폼 페이지를 다시 보여야 한다.
+// 입력 검증 에러가 아니라면 nil을 반환한다.
+func formErrors(w http.ResponseWriter, err error) map[string]string {
+	errs := roi.FieldErrors(err)
+	if errs != nil {
+		w.WriteHeader(http.StatusBadRequest)
+	}
+	return errs
+}
+
 // dayColorInTimeline은 해당 일의 태스크 갯수를 받아 이를 UI 색상으로 표현한다.
 func dayColorInTimeline(i int) string {
 	switch i {
@@ -0,0 +1,200 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/studio2l/roi"
+)
+
+// trashHandler는 /trash/<project> 페이지로 사용자가 접속했을때
+// 프로젝트 휴지통의 항목들과 되살리기, 완전히 지우기 버튼이 있는 페이지를 반환한다.
+func trashHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	db, err := roi.DB()
+	if err != nil {
+		handleError(w, r, fmt.Errorf("could not connect to database: %w", err))
+		return
+	}
+	session, err := getSession(r)
+	if err != nil {
+		httpError(w, r, "could not get session", http.StatusUnauthorized)
+		clearSession(w)
+		return
+	}
+	prj := r.URL.Path[len("/trash/"):]
+	exist, err := roi.ProjectExistContext(ctx, db, prj)
+	if err != nil {
+		handleError(w, r, fmt.Errorf("could not check project '%s' exist: %w", prj, err))
+		return
+	}
+	if !exist {
+		httpError(w, r, fmt.Sprintf("project '%s' not exist", prj), http.StatusNotFound)
+		return
+	}
+	items, err := roi.ProjectTrashContext(ctx, db, prj)
+	if err != nil {
+		handleError(w, r, fmt.Errorf("could not get trash of project '%s': %w", prj, err))
+		return
+	}
+	var expire time.Time
+	retention := ""
+	if trashRetention > 0 {
+		expire = time.Now().Add(-trashRetention)
+		retention = trashRetention.String()
+		if trashRetention%(24*time.Hour) == 0 {
+			retention = fmt.Sprintf("%d일", trashRetention/(24*time.Hour))
+		}
+	}
+	recipt := struct {
+		LoggedInUser string
+		Project      string
+		Items        []*roi.TrashItem
+		Retention    string
+		Expire       time.Time
+	}{
+		LoggedInUser: session["userid"],
+		Project:      prj,
+		Items:        items,
+		Retention:    retention,
+		Expire:       expire,
+	}
+	err = executeTemplate(w, r, "trash.html", recipt)
+	if err != nil {
+		handleError(w, r, err)
+	}
+}
+
+// trashItemHandler는 /trash-shot, /trash-task, /trash-version으로 POST된
+// 샷, 태스크, 또는 버전을 휴지통으로 옮긴 뒤 프로젝트 휴지통 페이지로 이동한다.
+func trashItemHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	if r.Method != "POST" {
+		httpError(w, r, "need POST", http.StatusBadRequest)
+		return
+	}
+	db, err := roi.DB()
+	if err != nil {
+		handleError(w, r, fmt.Errorf("could not connect to database: %w", err))
+		return
+	}
+	session, err := getSession(r)
+	if err != nil || session["userid"] == "" {
+		httpError(w, r, "could not get session", http.StatusUnauthorized)
+		clearSession(w)
+		return
+	}
+	user := session["userid"]
+	r.ParseForm()
+	prj := r.Form.Get("project")
+	shot := r.Form.Get("shot")
+	if prj == "" || shot == "" {
+		httpError(w, r, "need 'project' and 'shot'", http.StatusBadRequest)
+		return
+	}
+	switch r.URL.Path {
+	case "/trash-shot":
+		err = roi.TrashShotContext(ctx, db, prj, shot, user)
+	case "/trash-task":
+		task := r.Form.Get("task")
+		if task == "" {
+			httpError(w, r, "need 'task'", http.StatusBadRequest)
+			return
+		}
+		err = roi.TrashTaskContext(ctx, db, prj, shot, task, user)
+	case "/trash-version":
+		task := r.Form.Get("task")
+		if task == "" {
+			httpError(w, r, "need 'task'", http.StatusBadRequest)
+			return
+		}
+		version, verr := strconv.Atoi(r.Form.Get("version"))
+		if verr != nil || version <= 0 {
+			httpError(w, r, fmt.Sprintf("bad version '%s'", r.Form.Get("version")), http.StatusBadRequest)
+			return
+		}
+		err = roi.TrashVersionContext(ctx, db, prj, shot, task, version, user)
+	default:
+		httpError(w, r, "page not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		handleError(w, r, fmt.Errorf("could not move to trash: %w", err))
+		return
+	}
+	http.Redirect(w, r, "/trash/"+prj, http.StatusSeeOther)
+}
+
+// restoreTrashHandler는 POST된 아이디의 휴지통 항목을 원래 자리로 되살린다.
+func restoreTrashHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	if r.Method != "POST" {
+		httpError(w, r, "need POST", http.StatusBadRequest)
+		return
+	}
+	db, err := roi.DB()
+	if err != nil {
+		handleError(w, r, fmt.Errorf("could not connect to database: %w", err))
+		return
+	}
+	session, err := getSession(r)
+	if err != nil || session["userid"] == "" {
+		httpError(w, r, "could not get session", http.StatusUnauthorized)
+		clearSession(w)
+		return
+	}
+	id := r.FormValue("id")
+	t, err := roi.GetTrashItemContext(ctx, db, id)
+	if err != nil {
+		handleError(w, r, fmt.Errorf("could not get trash item '%s': %w", id, err))
+		return
+	}
+	if t == nil {
+		httpError(w, r, fmt.Sprintf("trash item '%s' not exist", id), http.StatusNotFound)
+		return
+	}
+	err = roi.RestoreTrashContext(ctx, db, id)
+	if err != nil {
+		handleError(w, r, fmt.Errorf("could not restore trash item '%s': %w", id, err))
+		return
+	}
+	http.Redirect(w, r, "/trash/"+t.Project, http.StatusSeeOther)
+}
+
+// purgeTrashHandler는 POST된 아이디의 휴지통 항목을 완전히 지운다.
+func purgeTrashHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	if r.Method != "POST" {
+		httpError(w, r, "need POST", http.StatusBadRequest)
+		return
+	}
+	db, err := roi.DB()
+	if err != nil {
+		handleError(w, r, fmt.Errorf("could not connect to database: %w", err))
+		return
+	}
+	session, err := getSession(r)
+	if err != nil || session["userid"] == "" {
+		httpError(w, r, "could not get session", http.StatusUnauthorized)
+		clearSession(w)
+		return
+	}
+	id := r.FormValue("id")
+	t, err := roi.GetTrashItemContext(ctx, db, id)
+	if err != nil {
+		handleError(w, r, fmt.Errorf("could not get trash item '%s': %w", id, err))
+		return
+	}
+	if t == nil {
+		httpError(w, r, fmt.Sprintf("trash item '%s' not exist", id), http.StatusNotFound)
+		return
+	}
+	err = roi.PurgeTrashContext(ctx, db, id)
+	if err != nil {
+		handleError(w, r, fmt.Errorf("could not purge trash item '%s': %w", id, err))
+		return
+	}
+	http.Redirect(w, r, "/trash/"+t.Project, http.StatusSeeOther)
+}
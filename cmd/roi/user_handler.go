@@ -4,45 +4,43 @@ import (
 	"fmt"
 	"log"
 	"net/http"
+	"net/url"
 
 	"github.com/studio2l/roi"
 )
 
 // loginHandler는 /login 페이지로 사용자가 접속했을때 로그인 페이지를 반환한다.
 func loginHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
 	if r.Method == "POST" {
 		r.ParseForm()
 		id := r.Form.Get("id")
 		if id == "" {
-			http.Error(w, "id field emtpy", http.StatusBadRequest)
+			httpError(w, r, "id field emtpy", http.StatusBadRequest)
 			return
 		}
 		pw := r.Form.Get("password")
 		if pw == "" {
-			http.Error(w, "password field emtpy", http.StatusBadRequest)
+			httpError(w, r, "password field emtpy", http.StatusBadRequest)
 			return
 		}
 		db, err := roi.DB()
 		if err != nil {
-			log.Printf("could not connect to database: %v", err)
-			http.Error(w, "internal error", http.StatusInternalServerError)
+			handleError(w, r, fmt.Errorf("could not connect to database: %w", err))
 			return
 		}
-		match, err := roi.UserPasswordMatch(db, id, pw)
+		match, err := roi.UserPasswordMatchContext(ctx, db, id, pw)
 		if err != nil {
-			http.Error(w, err.Error(), http.StatusInternalServerError)
+			handleError(w, r, err)
 			return
 		}
 		if !match {
-			http.Error(w, "entered password is not correct", http.StatusBadRequest)
+			httpError(w, r, "entered password is not correct", http.StatusBadRequest)
 			return
 		}
-		session := map[string]string{
-			"userid": id,
-		}
-		err = setSession(w, session)
+		err = startSession(w, r, id)
 		if err != nil {
-			http.Error(w, fmt.Sprintf("could not set session: %s", err), http.StatusInternalServerError)
+			handleError(w, r, fmt.Errorf("could not start session: %w", err))
 			return
 		}
 		http.Redirect(w, r, "/", http.StatusSeeOther)
@@ -58,63 +56,100 @@ func loginHandler(w http.ResponseWriter, r *http.Request) {
 	}{
 		LoggedInUser: session["userid"],
 	}
-	err = executeTemplate(w, "login.html", recipt)
+	err = executeTemplate(w, r, "login.html", recipt)
 	if err != nil {
-		log.Fatal(err)
+		handleError(w, r, err)
 	}
 }
 
 // logoutHandler는 /logout 페이지로 사용자가 접속했을때 사용자를 로그아웃 시킨다.
 func logoutHandler(w http.ResponseWriter, r *http.Request) {
-	clearSession(w)
+	err := endSession(w, r)
+	if err != nil {
+		handleError(w, r, fmt.Errorf("could not end session: %w", err))
+		return
+	}
 	http.Redirect(w, r, "/", http.StatusSeeOther)
 }
 
+// logoutAllHandler는 사용자의 모든 세션을 지워, 사용자를 모든 곳에서 로그아웃 시킨다.
+func logoutAllHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	if r.Method != "POST" {
+		httpError(w, r, "need POST method", http.StatusMethodNotAllowed)
+		return
+	}
+	session, err := getSession(r)
+	if err != nil {
+		httpError(w, r, "could not get session", http.StatusUnauthorized)
+		clearSession(w)
+		return
+	}
+	if session["userid"] == "" {
+		http.Redirect(w, r, "/login/", http.StatusSeeOther)
+		return
+	}
+	db, err := roi.DB()
+	if err != nil {
+		handleError(w, r, fmt.Errorf("could not connect to database: %w", err))
+		return
+	}
+	err = roi.DeleteUserSessionsContext(ctx, db, session["userid"])
+	if err != nil {
+		handleError(w, r, fmt.Errorf("could not delete sessions of user '%s': %w", session["userid"], err))
+		return
+	}
+	clearSession(w)
+	http.Redirect(w, r, "/login/", http.StatusSeeOther)
+}
+
 // signupHandler는 /signup 페이지로 사용자가 접속했을때 가입 페이지를 반환한다.
 func signupHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	var errs map[string]string
 	if r.Method == "POST" {
 		r.ParseForm()
 		id := r.Form.Get("id")
 		if id == "" {
-			http.Error(w, "id field emtpy", http.StatusBadRequest)
+			httpError(w, r, "id field emtpy", http.StatusBadRequest)
 			return
 		}
 		pw := r.Form.Get("password")
 		if pw == "" {
-			http.Error(w, "password field emtpy", http.StatusBadRequest)
+			httpError(w, r, "password field emtpy", http.StatusBadRequest)
 			return
 		}
 		if len(pw) < 8 {
-			http.Error(w, "password too short", http.StatusBadRequest)
+			httpError(w, r, "password too short", http.StatusBadRequest)
 			return
 		}
 		// 할일: password에 대한 컨펌은 프론트 엔드에서 하여야 함
 		pwc := r.Form.Get("password_confirm")
 		if pw != pwc {
-			http.Error(w, "passwords are not matched", http.StatusBadRequest)
+			httpError(w, r, "passwords are not matched", http.StatusBadRequest)
 			return
 		}
 		db, err := roi.DB()
 		if err != nil {
-			log.Printf("could not connect to database: %v", err)
-			http.Error(w, "internal error", http.StatusInternalServerError)
+			handleError(w, r, fmt.Errorf("could not connect to database: %w", err))
 			return
 		}
-		err = roi.AddUser(db, id, pw)
-		if err != nil {
-			http.Error(w, fmt.Sprintf("could not add user: %s", err), http.StatusBadRequest)
+		err = roi.AddUserContext(ctx, db, id, pw)
+		if err == nil {
+			err = startSession(w, r, id)
+			if err != nil {
+				handleError(w, r, fmt.Errorf("could not start session: %w", err))
+				return
+			}
+			http.Redirect(w, r, "/", http.StatusSeeOther)
 			return
 		}
-		session := map[string]string{
-			"userid": id,
-		}
-		err = setSession(w, session)
-		if err != nil {
-			http.Error(w, fmt.Sprintf("could not set session: %s", err), http.StatusInternalServerError)
+		// 입력이 적절하지 않으면 에러 메시지와 함께 폼을 다시 보인다.
+		errs = formErrors(w, err)
+		if errs == nil {
+			httpError(w, r, fmt.Sprintf("could not add user: %s", err), http.StatusBadRequest)
 			return
 		}
-		http.Redirect(w, r, "/", http.StatusSeeOther)
-		return
 	}
 	session, err := getSession(r)
 	if err != nil {
@@ -123,17 +158,23 @@ func signupHandler(w http.ResponseWriter, r *http.Request) {
 	}
 	recipt := struct {
 		LoggedInUser string
+		// Form과 Errors는 입력이 적절하지 않아 폼을 다시 보일 때 사용한다.
+		Form   url.Values
+		Errors map[string]string
 	}{
 		LoggedInUser: session["userid"],
+		Form:         r.Form,
+		Errors:       errs,
 	}
-	err = executeTemplate(w, "signup.html", recipt)
+	err = executeTemplate(w, r, "signup.html", recipt)
 	if err != nil {
-		log.Fatal(err)
+		handleError(w, r, err)
 	}
 }
 
 // profileHandler는 /profile 페이지로 사용자가 접속했을 때 사용자 프로필 페이지를 반환한다.
 func profileHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
 	session, err := getSession(r)
 	if err != nil {
 		log.Print(fmt.Sprintf("could not get session: %s", err))
@@ -141,12 +182,16 @@ func profileHandler(w http.ResponseWriter, r *http.Request) {
 		http.Redirect(w, r, "/login/", http.StatusSeeOther)
 		return
 	}
+	if session["userid"] == "" {
+		http.Redirect(w, r, "/login/", http.StatusSeeOther)
+		return
+	}
 	db, err := roi.DB()
 	if err != nil {
-		log.Printf("could not connect to database: %v", err)
-		http.Error(w, "internal error", http.StatusInternalServerError)
+		handleError(w, r, fmt.Errorf("could not connect to database: %w", err))
 		return
 	}
+	var errs map[string]string
 	if r.Method == "POST" {
 		r.ParseForm()
 		upd := roi.UpdateUserParam{
@@ -158,82 +203,148 @@ func profileHandler(w http.ResponseWriter, r *http.Request) {
 			PhoneNumber: r.Form.Get("phone_number"),
 			EntryDate:   r.Form.Get("entry_date"),
 		}
-		err = roi.UpdateUser(db, session["userid"], upd)
-		if err != nil {
-			http.Error(w, fmt.Sprintf("could not set user: %s", err), http.StatusInternalServerError)
+		err = roi.UpdateUserContext(ctx, db, session["userid"], upd)
+		if err == nil {
+			http.Redirect(w, r, "/settings/profile", http.StatusSeeOther)
+			return
+		}
+		// 입력이 적절하지 않으면 에러 메시지와 함께 폼을 다시 보인다.
+		errs = formErrors(w, err)
+		if errs == nil {
+			httpError(w, r, fmt.Sprintf("could not set user: %s", err), http.StatusInternalServerError)
 			return
 		}
-		http.Redirect(w, r, "/settings/profile", http.StatusSeeOther)
+	}
+	u, err := roi.GetUserContext(ctx, db, session["userid"])
+	if err != nil {
+		httpError(w, r, fmt.Sprintf("could not get user: %s", err.Error()), http.StatusInternalServerError)
+		return
+	}
+	sessions, err := roi.UserSessionsContext(ctx, db, session["userid"])
+	if err != nil {
+		handleError(w, r, fmt.Errorf("could not get sessions of user '%s': %w", session["userid"], err))
 		return
 	}
-	u, err := roi.GetUser(db, session["userid"])
+	cur, err := currentSession(r)
 	if err != nil {
-		http.Error(w, fmt.Sprintf("could not get user: %s", err.Error()), http.StatusInternalServerError)
+		handleError(w, r, fmt.Errorf("could not get session: %w", err))
 		return
 	}
-	fmt.Println(u)
 	recipt := struct {
 		LoggedInUser string
 		User         *roi.User
+		// Form과 Errors는 입력이 적절하지 않아 폼을 다시 보일 때 사용한다.
+		Form   url.Values
+		Errors map[string]string
+		// Sessions는 사용자가 로그인되어 있는 세션들이다.
+		Sessions []*roi.Session
+		// CurrentSession은 지금 사용중인 세션의 아이디이다.
+		CurrentSession string
+	}{
+		LoggedInUser:   session["userid"],
+		User:           u,
+		Form:           r.Form,
+		Errors:         errs,
+		Sessions:       sessions,
+		CurrentSession: cur.ID,
+	}
+	err = executeTemplate(w, r, "profile.html", recipt)
+	if err != nil {
+		handleError(w, r, err)
+	}
+}
+
+// apiTokenHandler는 /settings/api-token 으로 사용자가 요청하면
+// roipub 같은 도구가 api 질의에 쓸 새 api 토큰을 발급해 한번만 보여준다.
+func apiTokenHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "POST" {
+		httpError(w, r, "need POST method", http.StatusMethodNotAllowed)
+		return
+	}
+	session, err := getSession(r)
+	if err != nil {
+		httpError(w, r, "could not get session", http.StatusUnauthorized)
+		clearSession(w)
+		return
+	}
+	if session["userid"] == "" {
+		http.Redirect(w, r, "/login/", http.StatusSeeOther)
+		return
+	}
+	token, err := issueAPIToken(r, session["userid"])
+	if err != nil {
+		handleError(w, r, fmt.Errorf("could not issue api token: %w", err))
+		return
+	}
+	recipt := struct {
+		LoggedInUser string
+		Token        string
 	}{
 		LoggedInUser: session["userid"],
-		User:         u,
+		Token:        token,
 	}
-	err = executeTemplate(w, "profile.html", recipt)
+	err = executeTemplate(w, r, "api-token.html", recipt)
 	if err != nil {
-		log.Fatal(err)
+		handleError(w, r, err)
 	}
 }
 
 // updatePasswordHandler는 /update-password 페이지로 사용자가 패스워드 변경과 관련된 정보를 보내면
 // 사용자 패스워드를 변경한다.
 func updatePasswordHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
 	session, err := getSession(r)
 	if err != nil {
-		http.Error(w, fmt.Sprintf("could not get session: %s", err), http.StatusInternalServerError)
+		httpError(w, r, fmt.Sprintf("could not get session: %s", err), http.StatusInternalServerError)
 		clearSession(w)
 		return
 	}
 	r.ParseForm()
 	oldpw := r.Form.Get("old_password")
 	if oldpw == "" {
-		http.Error(w, "old password field emtpy", http.StatusBadRequest)
+		httpError(w, r, "old password field emtpy", http.StatusBadRequest)
 		return
 	}
 	newpw := r.Form.Get("new_password")
 	if newpw == "" {
-		http.Error(w, "new password field emtpy", http.StatusBadRequest)
+		httpError(w, r, "new password field emtpy", http.StatusBadRequest)
 		return
 	}
 	if len(newpw) < 8 {
-		http.Error(w, "new password too short", http.StatusBadRequest)
+		httpError(w, r, "new password too short", http.StatusBadRequest)
 		return
 	}
 	// 할일: password에 대한 컨펌은 프론트 엔드에서 하여야 함
 	newpwc := r.Form.Get("new_password_confirm")
 	if newpw != newpwc {
-		http.Error(w, "passwords are not matched", http.StatusBadRequest)
+		httpError(w, r, "passwords are not matched", http.StatusBadRequest)
 		return
 	}
 	db, err := roi.DB()
 	if err != nil {
-		log.Printf("could not connect to database: %v", err)
-		http.Error(w, "internal error", http.StatusInternalServerError)
+		handleError(w, r, fmt.Errorf("could not connect to database: %w", err))
 		return
 	}
 	id := session["userid"]
-	match, err := roi.UserPasswordMatch(db, id, oldpw)
+	match, err := roi.UserPasswordMatchContext(ctx, db, id, oldpw)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		handleError(w, r, err)
 		return
 	}
 	if !match {
-		http.Error(w, "entered password is not correct", http.StatusBadRequest)
+		httpError(w, r, "entered password is not correct", http.StatusBadRequest)
+		return
+	}
+	err = roi.UpdateUserPasswordContext(ctx, db, id, newpw)
+	if err != nil {
+		handleError(w, r, fmt.Errorf("could not change user password: %w", err))
 		return
 	}
-	err = roi.UpdateUserPassword(db, id, newpw)
+	// 패스워드를 바꾸면 이 세션을 포함한 사용자의 모든 세션과 api 토큰이 지워진다.
+	// 이 세션만 새로 시작한다.
+	err = startSession(w, r, id)
 	if err != nil {
-		http.Error(w, fmt.Sprintf("could not change user password: %s", err), http.StatusInternalServerError)
+		handleError(w, r, fmt.Errorf("could not start session: %w", err))
 		return
 	}
 	http.Redirect(w, r, "/settings/profile", http.StatusSeeOther)
@@ -0,0 +1,370 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/studio2l/roi"
+)
+
+// vendorsHandler는 /vendors 페이지로 사용자가 접속했을때
+// 외주 업체 목록과 새 업체를 등록하는 폼을 보여준다.
+func vendorsHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	db, err := roi.DB()
+	if err != nil {
+		handleError(w, r, fmt.Errorf("could not connect to database: %w", err))
+		return
+	}
+	session, err := getSession(r)
+	if err != nil {
+		httpError(w, r, "could not get session", http.StatusUnauthorized)
+		clearSession(w)
+		return
+	}
+	vs, err := roi.AllVendorsContext(ctx, db)
+	if err != nil {
+		handleError(w, r, fmt.Errorf("could not get vendors: %w", err))
+		return
+	}
+	recipt := struct {
+		LoggedInUser string
+		Vendors      []*roi.Vendor
+	}{
+		LoggedInUser: session["userid"],
+		Vendors:      vs,
+	}
+	err = executeTemplate(w, r, "vendors.html", recipt)
+	if err != nil {
+		handleError(w, r, err)
+	}
+}
+
+// addVendorHandler는 사용자가 POST로 보낸 정보로 외주 업체를 등록한다.
+func addVendorHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	if r.Method != "POST" {
+		httpError(w, r, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	db, err := roi.DB()
+	if err != nil {
+		handleError(w, r, fmt.Errorf("could not connect to database: %w", err))
+		return
+	}
+	session, err := getSession(r)
+	if err != nil || session["userid"] == "" {
+		httpError(w, r, "could not get session", http.StatusUnauthorized)
+		clearSession(w)
+		return
+	}
+	r.ParseForm()
+	id := strings.TrimSpace(r.Form.Get("vendor"))
+	if !roi.IsValidVendor(id) {
+		httpError(w, r, fmt.Sprintf("invalid vendor id '%s'", id), http.StatusBadRequest)
+		return
+	}
+	exist, err := roi.VendorExistContext(ctx, db, id)
+	if err != nil {
+		handleError(w, r, fmt.Errorf("could not check vendor '%s' exist: %w", id, err))
+		return
+	}
+	if exist {
+		httpError(w, r, fmt.Sprintf("vendor '%s' already exist", id), http.StatusConflict)
+		return
+	}
+	v := &roi.Vendor{
+		Vendor:  id,
+		Name:    r.Form.Get("name"),
+		Contact: r.Form.Get("contact"),
+		Notes:   r.Form.Get("notes"),
+	}
+	err = roi.AddVendorContext(ctx, db, v)
+	if err != nil {
+		handleError(w, r, fmt.Errorf("could not add vendor: %w", err))
+		return
+	}
+	http.Redirect(w, r, "/vendors", http.StatusSeeOther)
+}
+
+// updateVendorHandler는 /update-vendor 페이지로 사용자가 접속했을때 업체 정보 수정 폼을 보여준다.
+// 만일 POST로 업체 정보가 오면 업체 정보를 수정한다.
+func updateVendorHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	db, err := roi.DB()
+	if err != nil {
+		handleError(w, r, fmt.Errorf("could not connect to database: %w", err))
+		return
+	}
+	session, err := getSession(r)
+	if err != nil || session["userid"] == "" {
+		httpError(w, r, "could not get session", http.StatusUnauthorized)
+		clearSession(w)
+		return
+	}
+	r.ParseForm()
+	id := r.Form.Get("vendor")
+	v, err := roi.GetVendorContext(ctx, db, id)
+	if err != nil {
+		handleError(w, r, fmt.Errorf("could not get vendor '%s': %w", id, err))
+		return
+	}
+	if v == nil {
+		httpError(w, r, fmt.Sprintf("vendor '%s' not exist", id), http.StatusNotFound)
+		return
+	}
+	if r.Method == "POST" {
+		upd := roi.UpdateVendorParam{
+			Name:    r.Form.Get("name"),
+			Contact: r.Form.Get("contact"),
+			Notes:   r.Form.Get("notes"),
+		}
+		err = roi.UpdateVendorContext(ctx, db, id, upd)
+		if err != nil {
+			handleError(w, r, fmt.Errorf("could not update vendor '%s': %w", id, err))
+			return
+		}
+		http.Redirect(w, r, "/vendors", http.StatusSeeOther)
+		return
+	}
+	recipt := struct {
+		LoggedInUser string
+		Vendor       *roi.Vendor
+	}{
+		LoggedInUser: session["userid"],
+		Vendor:       v,
+	}
+	err = executeTemplate(w, r, "update-vendor.html", recipt)
+	if err != nil {
+		handleError(w, r, err)
+	}
+}
+
+// vendorTasksHandler는 /vendor-tasks/<project> 페이지로 사용자가 접속했을때
+// 프로젝트의 외주 업체별 작업량과 외주 태스크 목록, 패키지 보내기와 받은 버전 인제스트 폼을 보여준다.
+func vendorTasksHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	db, err := roi.DB()
+	if err != nil {
+		handleError(w, r, fmt.Errorf("could not connect to database: %w", err))
+		return
+	}
+	session, err := getSession(r)
+	if err != nil {
+		httpError(w, r, "could not get session", http.StatusUnauthorized)
+		clearSession(w)
+		return
+	}
+	prj := r.URL.Path[len("/vendor-tasks/"):]
+	exist, err := roi.ProjectExistContext(ctx, db, prj)
+	if err != nil {
+		handleError(w, r, fmt.Errorf("could not check project '%s' exist: %w", prj, err))
+		return
+	}
+	if !exist {
+		httpError(w, r, fmt.Sprintf("project '%s' not exist", prj), http.StatusNotFound)
+		return
+	}
+	vendor := r.FormValue("vendor")
+	ts, err := roi.ProjectVendorTasksContext(ctx, db, prj, vendor)
+	if err != nil {
+		handleError(w, r, fmt.Errorf("could not get vendor tasks: %w", err))
+		return
+	}
+	now := time.Now()
+	ws, err := roi.ProjectVendorWorkloadsContext(ctx, db, prj, now)
+	if err != nil {
+		handleError(w, r, fmt.Errorf("could not get vendor workloads: %w", err))
+		return
+	}
+	recipt := struct {
+		LoggedInUser     string
+		Project          string
+		Vendor           string
+		Workloads        []*roi.VendorWorkload
+		Tasks            []*roi.VendorTask
+		Now              time.Time
+		AllDeliveryModes []roi.DeliveryMode
+		PackageName      string
+		PackageNaming    string
+	}{
+		LoggedInUser:     session["userid"],
+		Project:          prj,
+		Vendor:           vendor,
+		Workloads:        ws,
+		Tasks:            ts,
+		Now:              now,
+		AllDeliveryModes: roi.AllDeliveryModes,
+		PackageName:      vendor + "_" + now.Format("20060102"),
+		PackageNaming:    roi.DefaultVendorPackageNaming,
+	}
+	err = executeTemplate(w, r, "vendor-tasks.html", recipt)
+	if err != nil {
+		handleError(w, r, err)
+	}
+}
+
+// assignVendorTaskHandler는 샷 페이지에서 보낸 정보로 태스크를 외주 업체에 배정한다.
+// vendor가 빈 문자열이면 배정을 취소한다.
+func assignVendorTaskHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	if r.Method != "POST" {
+		httpError(w, r, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	db, err := roi.DB()
+	if err != nil {
+		handleError(w, r, fmt.Errorf("could not connect to database: %w", err))
+		return
+	}
+	session, err := getSession(r)
+	if err != nil || session["userid"] == "" {
+		httpError(w, r, "could not get session", http.StatusUnauthorized)
+		clearSession(w)
+		return
+	}
+	r.ParseForm()
+	prj := r.Form.Get("project")
+	shot := r.Form.Get("shot")
+	task := r.Form.Get("task")
+	vendor := strings.TrimSpace(r.Form.Get("vendor"))
+	if vendor == "" {
+		err = roi.UnassignVendorTaskContext(ctx, db, prj, shot, task)
+	} else {
+		tforms, err := parseTimeForms(r.Form, "due_date")
+		if err != nil {
+			httpError(w, r, err.Error(), http.StatusBadRequest)
+			return
+		}
+		var cost int64
+		if c := strings.TrimSpace(r.Form.Get("cost")); c != "" {
+			cost, err = strconv.ParseInt(c, 10, 64)
+			if err != nil {
+				httpError(w, r, fmt.Sprintf("invalid cost '%s'", c), http.StatusBadRequest)
+				return
+			}
+		}
+		t := &roi.VendorTask{
+			Project: prj,
+			Shot:    shot,
+			Task:    task,
+			Vendor:  vendor,
+			Artist:  strings.TrimSpace(r.Form.Get("artist")),
+			DueDate: tforms["due_date"],
+			Cost:    cost,
+		}
+		err = roi.AssignVendorTaskContext(ctx, db, t)
+	}
+	if err != nil {
+		handleError(w, r, fmt.Errorf("could not assign vendor task: %w", err))
+		return
+	}
+	http.Redirect(w, r, "/update-shot?project="+prj+"&shot="+shot, http.StatusSeeOther)
+}
+
+// sendVendorPackageHandler는 외주 업체에 배정된 태스크들의 플레이트를 패키지로 만들어 보낸다.
+// 패키지는 업체가 기록된 납품으로 남는다.
+func sendVendorPackageHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	if r.Method != "POST" {
+		httpError(w, r, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	db, err := roi.DB()
+	if err != nil {
+		handleError(w, r, fmt.Errorf("could not connect to database: %w", err))
+		return
+	}
+	session, err := getSession(r)
+	if err != nil || session["userid"] == "" {
+		httpError(w, r, "could not get session", http.StatusUnauthorized)
+		clearSession(w)
+		return
+	}
+	r.ParseForm()
+	prj := r.Form.Get("project")
+	vendor := r.Form.Get("vendor")
+	name := strings.TrimSpace(r.Form.Get("name"))
+	if !roi.IsValidDeliveryName(name) {
+		httpError(w, r, fmt.Sprintf("invalid package name '%s'", name), http.StatusBadRequest)
+		return
+	}
+	exist, err := roi.VendorExistContext(ctx, db, vendor)
+	if err != nil {
+		handleError(w, r, fmt.Errorf("could not check vendor '%s' exist: %w", vendor, err))
+		return
+	}
+	if !exist {
+		httpError(w, r, fmt.Sprintf("vendor '%s' not exist", vendor), http.StatusNotFound)
+		return
+	}
+	naming := strings.TrimSpace(r.Form.Get("naming"))
+	if naming == "" {
+		naming = roi.DefaultVendorPackageNaming
+	}
+	items, err := roi.PlanVendorPackageContext(ctx, db, prj, vendor, naming)
+	if err != nil {
+		httpError(w, r, fmt.Sprintf("could not plan vendor package: %v", err), http.StatusBadRequest)
+		return
+	}
+	d := &roi.Delivery{
+		Project: prj,
+		Name:    name,
+		Dir:     strings.TrimSpace(r.Form.Get("dir")),
+		Naming:  naming,
+		Mode:    roi.DeliveryMode(r.Form.Get("mode")),
+		Vendor:  vendor,
+		Sender:  session["userid"],
+		Created: time.Now(),
+		Items:   items,
+	}
+	err = roi.AddDeliveryContext(ctx, db, d)
+	if err != nil {
+		handleError(w, r, fmt.Errorf("could not send vendor package: %w", err))
+		return
+	}
+	http.Redirect(w, r, "/delivery/"+prj+"/"+url.PathEscape(name), http.StatusSeeOther)
+}
+
+// ingestVendorReturnHandler는 외주 업체에서 받은 폴더의 파일들을 버전으로 등록한다.
+// 등록되지 못한 파일은 인제스트 격리 목록에서 확인할 수 있다.
+func ingestVendorReturnHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	if r.Method != "POST" {
+		httpError(w, r, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	db, err := roi.DB()
+	if err != nil {
+		handleError(w, r, fmt.Errorf("could not connect to database: %w", err))
+		return
+	}
+	session, err := getSession(r)
+	if err != nil || session["userid"] == "" {
+		httpError(w, r, "could not get session", http.StatusUnauthorized)
+		clearSession(w)
+		return
+	}
+	r.ParseForm()
+	prj := r.Form.Get("project")
+	vendor := r.Form.Get("vendor")
+	dir := strings.TrimSpace(r.Form.Get("dir"))
+	if dir == "" {
+		httpError(w, r, "need 'dir'", http.StatusBadRequest)
+		return
+	}
+	items, err := roi.IngestVendorReturnContext(ctx, db, prj, vendor, dir)
+	if err != nil {
+		handleError(w, r, fmt.Errorf("could not ingest vendor return %s: %w", dir, err))
+		return
+	}
+	for _, it := range items {
+		log.Printf("ingested %s.%s.%s.v%03d from vendor %s: %s", prj, it.Shot, it.Task, it.Version, vendor, it.Path)
+	}
+	http.Redirect(w, r, "/vendor-tasks/"+prj+"?vendor="+url.QueryEscape(vendor), http.StatusSeeOther)
+}
@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"log"
 	"net/http"
+	"net/url"
 	"strconv"
 	"strings"
 
@@ -12,15 +13,15 @@ import (
 
 // versionHandler는 /version/ 으로 사용자가 접근했을때 버전 정보가 담긴 페이지를 반환한다.
 func versionHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
 	db, err := roi.DB()
 	if err != nil {
-		log.Printf("could not connect to database: %v", err)
-		http.Error(w, "internal error", http.StatusInternalServerError)
+		handleError(w, r, fmt.Errorf("could not connect to database: %w", err))
 		return
 	}
 	session, err := getSession(r)
 	if err != nil {
-		http.Error(w, "could not get session", http.StatusUnauthorized)
+		httpError(w, r, "could not get session", http.StatusUnauthorized)
 		clearSession(w)
 		return
 	}
@@ -37,68 +38,118 @@ func versionHandler(w http.ResponseWriter, r *http.Request) {
 	vstring := pths[3]
 	if vstring == "" {
 		msg := fmt.Sprintf("'version' field empty")
-		http.Error(w, msg, http.StatusBadRequest)
+		httpError(w, r, msg, http.StatusBadRequest)
 		return
 	}
 	version, err := strconv.Atoi(vstring)
 	if err != nil || version <= 0 {
 		msg := fmt.Sprintf("bad version '%s'", pths[3])
-		http.Error(w, msg, http.StatusBadRequest)
+		httpError(w, r, msg, http.StatusBadRequest)
 		return
 	}
 	id := prj + "." + shot + "." + task + fmt.Sprintf(".v%03d", version)
 
-	exist, err := roi.VersionExist(db, prj, shot, task, version)
+	exist, err := roi.VersionExistContext(ctx, db, prj, shot, task, version)
 	if err != nil {
-		log.Printf("could not check version exist '%s': %v", id, err)
-		http.Error(w, "internal error", http.StatusInternalServerError)
+		handleError(w, r, fmt.Errorf("could not check version exist '%s': %w", id, err))
 		return
 	}
 	if !exist {
+		// 이름이 바뀐 샷의 예전 이름이라면 현재 샷의 같은 버전으로 이동한다.
+		// 다른 샷에 합쳐지며 버전 번호가 바뀌었다면 현재 샷의 수정 페이지로 이동한다.
+		cur, err := roi.ResolveShotAliasContext(ctx, db, prj, shot)
+		if err != nil {
+			handleError(w, r, fmt.Errorf("could not resolve shot alias '%s': %w", prj+"."+shot, err))
+			return
+		}
+		if cur != "" {
+			exist, err := roi.VersionExistContext(ctx, db, prj, cur, task, version)
+			if err != nil {
+				handleError(w, r, fmt.Errorf("could not check version exist '%s': %w", id, err))
+				return
+			}
+			if exist {
+				http.Redirect(w, r, fmt.Sprintf("/version/%s/%s/%s/%d", prj, cur, task, version), http.StatusSeeOther)
+				return
+			}
+			http.Redirect(w, r, "/update-shot?project="+prj+"&shot="+cur, http.StatusSeeOther)
+			return
+		}
 		e := fmt.Sprintf("version '%s' not exist", id)
-		http.Error(w, e, http.StatusBadRequest)
+		httpError(w, r, e, http.StatusBadRequest)
+		return
+	}
+	v, err := roi.GetVersionContext(ctx, db, prj, shot, task, version)
+	if err != nil {
+		handleError(w, r, fmt.Errorf("could not get version '%s': %w", id, err))
+		return
+	}
+	// 썸네일을 만들지 못하더라도 버전 페이지는 보여야 한다.
+	thumbs, err := roi.VersionThumbnails(v)
+	if err != nil {
+		log.Printf("could not make version thumbnails '%s': %v", id, err)
+	}
+	files, err := roi.VersionFilesContext(ctx, db, prj, shot, task, version)
+	if err != nil {
+		handleError(w, r, fmt.Errorf("could not get version files '%s': %w", id, err))
+		return
+	}
+	reviews, err := roi.VersionReviewsContext(ctx, db, prj, shot, task, version)
+	if err != nil {
+		handleError(w, r, fmt.Errorf("could not get version reviews '%s': %w", id, err))
 		return
 	}
-	v, err := roi.GetVersion(db, prj, shot, task, version)
+	annos, err := roi.VersionAnnotationsContext(ctx, db, prj, shot, task, version)
 	if err != nil {
-		log.Printf("could not get version '%s': %v", id, err)
-		http.Error(w, "internal error", http.StatusInternalServerError)
+		handleError(w, r, fmt.Errorf("could not get version annotations '%s': %w", id, err))
 		return
 	}
 	recipt := struct {
 		LoggedInUser string
 		Version      *roi.Version
+		Thumbnails   []roi.VersionThumbnail
+		Files        []*roi.VersionFile
+		Integrity    roi.FileStatus
+		Reviews      []*roi.Review
+		Annotations  map[string]*roi.Annotation
+		FPS          int
 	}{
 		LoggedInUser: session["userid"],
 		Version:      v,
-	}
-	err = executeTemplate(w, "version.html", recipt)
+		Thumbnails:   thumbs,
+		Files:        files,
+		Integrity:    roi.VersionIntegrity(files),
+		Reviews:      reviews,
+		Annotations:  annos,
+		FPS:          roi.PlaylistFPS,
+	}
+	err = executeTemplate(w, r, "version.html", recipt)
 	if err != nil {
-		log.Fatal(err)
+		handleError(w, r, err)
 	}
 }
 
 func addVersionHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
 	db, err := roi.DB()
 	if err != nil {
-		log.Printf("could not connect to database: %v", err)
-		http.Error(w, "internal error", http.StatusInternalServerError)
+		handleError(w, r, fmt.Errorf("could not connect to database: %w", err))
 		return
 	}
 	session, err := getSession(r)
 	if err != nil {
-		http.Error(w, "could not get session", http.StatusUnauthorized)
+		httpError(w, r, "could not get session", http.StatusUnauthorized)
 		clearSession(w)
 		return
 	}
-	u, err := roi.GetUser(db, session["userid"])
+	u, err := roi.GetUserContext(ctx, db, session["userid"])
 	if err != nil {
-		http.Error(w, "could not get user information", http.StatusInternalServerError)
+		httpError(w, r, "could not get user information", http.StatusInternalServerError)
 		clearSession(w)
 		return
 	}
 	if u == nil {
-		http.Error(w, "user not exist", http.StatusBadRequest)
+		httpError(w, r, "user not exist", http.StatusBadRequest)
 		clearSession(w)
 		return
 	}
@@ -110,27 +161,26 @@ func addVersionHandler(w http.ResponseWriter, r *http.Request) {
 	r.ParseForm()
 	prj := r.Form.Get("project")
 	if prj == "" {
-		http.Error(w, "need 'project'", http.StatusBadRequest)
+		httpError(w, r, "need 'project'", http.StatusBadRequest)
 		return
 	}
-	exist, err := roi.ProjectExist(db, prj)
+	exist, err := roi.ProjectExistContext(ctx, db, prj)
 	if err != nil {
-		log.Print(err)
-		http.Error(w, "internal error", http.StatusInternalServerError)
+		handleError(w, r, err)
 		return
 	}
 	if !exist {
-		http.Error(w, fmt.Sprintf("project '%s' not exist", prj), http.StatusBadRequest)
+		httpError(w, r, fmt.Sprintf("project '%s' not exist", prj), http.StatusNotFound)
 		return
 	}
 	shot := r.Form.Get("shot")
 	if shot == "" {
-		http.Error(w, "need 'shot'", http.StatusBadRequest)
+		httpError(w, r, "need 'shot'", http.StatusBadRequest)
 		return
 	}
 	task := r.Form.Get("task")
 	if task == "" {
-		http.Error(w, "need 'task'", http.StatusBadRequest)
+		httpError(w, r, "need 'task'", http.StatusBadRequest)
 		return
 	}
 	// addVersion은 새 버전을 추가하는 역할만 하고 값을 넣는 역할은 하지 않는다.
@@ -138,34 +188,33 @@ func addVersionHandler(w http.ResponseWriter, r *http.Request) {
 	version := r.Form.Get("version")
 	if version != "" {
 		// 버전은 db에 기록된 마지막 버전을 기준으로 하지 여기서 받아들이지 않는다.
-		http.Error(w, "'version' should not be specified", http.StatusBadRequest)
+		httpError(w, r, "'version' should not be specified", http.StatusBadRequest)
 		return
 	}
 	if r.Form.Get("files") != "" {
-		http.Error(w, "does not accept 'files'", http.StatusBadRequest)
+		httpError(w, r, "does not accept 'files'", http.StatusBadRequest)
 		return
 	}
 	if r.Form.Get("mov") != "" {
-		http.Error(w, "does not accept 'mov'", http.StatusBadRequest)
+		httpError(w, r, "does not accept 'mov'", http.StatusBadRequest)
 		return
 	}
 	if r.Form.Get("work_file") != "" {
-		http.Error(w, "does not accept 'work_file'", http.StatusBadRequest)
+		httpError(w, r, "does not accept 'work_file'", http.StatusBadRequest)
 		return
 	}
 	if r.Form.Get("created") != "" {
-		http.Error(w, "does not accept 'created'", http.StatusBadRequest)
+		httpError(w, r, "does not accept 'created'", http.StatusBadRequest)
 		return
 	}
 	taskID := fmt.Sprintf("%s.%s.%s", prj, shot, task)
-	t, err := roi.GetTask(db, prj, shot, task)
+	t, err := roi.GetTaskContext(ctx, db, prj, shot, task)
 	if err != nil {
-		log.Printf("could not get task '%s': %v", taskID, err)
-		http.Error(w, "internal error", http.StatusInternalServerError)
+		handleError(w, r, fmt.Errorf("could not get task '%s': %w", taskID, err))
 		return
 	}
 	if t == nil {
-		http.Error(w, fmt.Sprintf("task '%s' not exist", taskID), http.StatusBadRequest)
+		httpError(w, r, fmt.Sprintf("task '%s' not exist", taskID), http.StatusNotFound)
 		return
 	}
 	o := &roi.Version{
@@ -173,10 +222,9 @@ func addVersionHandler(w http.ResponseWriter, r *http.Request) {
 		Shot:    shot,
 		Task:    task,
 	}
-	err = roi.AddVersion(db, prj, shot, task, o)
+	err = roi.AddVersionContext(ctx, db, prj, shot, task, o)
 	if err != nil {
-		log.Printf("could not add version to task '%s': %v", taskID, err)
-		http.Error(w, "internal error", http.StatusInternalServerError)
+		handleError(w, r, fmt.Errorf("could not add version to task '%s': %w", taskID, err))
 		return
 	}
 	http.Redirect(w, r, "/search/"+prj, http.StatusSeeOther)
@@ -184,26 +232,26 @@ func addVersionHandler(w http.ResponseWriter, r *http.Request) {
 }
 
 func updateVersionHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
 	db, err := roi.DB()
 	if err != nil {
-		log.Printf("could not connect to database: %v", err)
-		http.Error(w, "internal error", http.StatusInternalServerError)
+		handleError(w, r, fmt.Errorf("could not connect to database: %w", err))
 		return
 	}
 	session, err := getSession(r)
 	if err != nil {
-		http.Error(w, "could not get session", http.StatusUnauthorized)
+		httpError(w, r, "could not get session", http.StatusUnauthorized)
 		clearSession(w)
 		return
 	}
-	u, err := roi.GetUser(db, session["userid"])
+	u, err := roi.GetUserContext(ctx, db, session["userid"])
 	if err != nil {
-		http.Error(w, "could not get user information", http.StatusInternalServerError)
+		httpError(w, r, "could not get user information", http.StatusInternalServerError)
 		clearSession(w)
 		return
 	}
 	if u == nil {
-		http.Error(w, "user not exist", http.StatusBadRequest)
+		httpError(w, r, "user not exist", http.StatusBadRequest)
 		clearSession(w)
 		return
 	}
@@ -215,67 +263,65 @@ func updateVersionHandler(w http.ResponseWriter, r *http.Request) {
 	r.ParseForm()
 	prj := r.Form.Get("project")
 	if prj == "" {
-		http.Error(w, "need 'project'", http.StatusBadRequest)
+		httpError(w, r, "need 'project'", http.StatusBadRequest)
 		return
 	}
-	exist, err := roi.ProjectExist(db, prj)
+	exist, err := roi.ProjectExistContext(ctx, db, prj)
 	if err != nil {
-		log.Print(err)
-		http.Error(w, "internal error", http.StatusInternalServerError)
+		handleError(w, r, err)
 		return
 	}
 	if !exist {
-		http.Error(w, fmt.Sprintf("project '%s' not exist", prj), http.StatusBadRequest)
+		httpError(w, r, fmt.Sprintf("project '%s' not exist", prj), http.StatusNotFound)
 		return
 	}
 	shot := r.Form.Get("shot")
 	if shot == "" {
-		http.Error(w, "need 'shot'", http.StatusBadRequest)
+		httpError(w, r, "need 'shot'", http.StatusBadRequest)
 		return
 	}
 	task := r.Form.Get("task")
 	if task == "" {
-		http.Error(w, "need 'task'", http.StatusBadRequest)
+		httpError(w, r, "need 'task'", http.StatusBadRequest)
 		return
 	}
 	v := r.Form.Get("version")
 	if v == "" {
-		http.Error(w, "need 'version'", http.StatusBadRequest)
+		httpError(w, r, "need 'version'", http.StatusBadRequest)
 		return
 	}
 	version, err := strconv.Atoi(v)
 	if err != nil {
-		http.Error(w, "'version' is not a number", http.StatusBadRequest)
+		httpError(w, r, "'version' is not a number", http.StatusBadRequest)
 		return
 	}
 	taskID := fmt.Sprintf("%s.%s.%s", prj, shot, task)
-	t, err := roi.GetTask(db, prj, shot, task)
+	t, err := roi.GetTaskContext(ctx, db, prj, shot, task)
 	if err != nil {
-		log.Printf("could not get task '%s': %v", taskID, err)
-		http.Error(w, "internal error", http.StatusInternalServerError)
+		handleError(w, r, fmt.Errorf("could not get task '%s': %w", taskID, err))
 		return
 	}
 	if t == nil {
-		http.Error(w, fmt.Sprintf("task '%s' not exist", taskID), http.StatusBadRequest)
+		httpError(w, r, fmt.Sprintf("task '%s' not exist", taskID), http.StatusNotFound)
 		return
 	}
 	versionID := fmt.Sprintf("%s.%s.%s.v%v03d", prj, shot, task, version)
+	var errs map[string]string
 	if r.Method == "POST" {
-		exist, err := roi.VersionExist(db, prj, shot, task, version)
+		exist, err := roi.VersionExistContext(ctx, db, prj, shot, task, version)
 		if err != nil {
-			log.Printf("could not check version '%s' exist: %v", versionID, err)
-			http.Error(w, "internal error", http.StatusInternalServerError)
+			handleError(w, r, fmt.Errorf("could not check version '%s' exist: %w", versionID, err))
 			return
 		}
 		if !exist {
-			http.Error(w, "version '%s' not exist", http.StatusBadRequest)
+			httpError(w, r, fmt.Sprintf("version '%s' not exist", versionID), http.StatusNotFound)
 			return
 		}
 		timeForms, err := parseTimeForms(r.Form,
 			"created",
 		)
 		if err != nil {
-			http.Error(w, err.Error(), http.StatusBadRequest)
+			httpError(w, r, err.Error(), http.StatusBadRequest)
 			return
 		}
 		u := roi.UpdateVersionParam{
@@ -285,30 +331,56 @@ func updateVersionHandler(w http.ResponseWriter, r *http.Request) {
 			WorkFile:    r.Form.Get("work_file"),
 			Created:     timeForms["created"],
 		}
-		roi.UpdateVersion(db, prj, shot, task, version, u)
-		http.Redirect(w, r, "/search/"+prj, http.StatusSeeOther)
-		return
+		err = roi.UpdateVersionContext(ctx, db, prj, shot, task, version, u)
+		if err == nil {
+			// 버전 이미지가 바뀌었을 수 있으므로 썸네일을 새로 만든다.
+			err = roi.DeleteVersionThumbnails(prj, shot, task, version)
+			if err != nil {
+				log.Printf("could not delete version thumbnails '%s': %v", versionID, err)
+			}
+			nv, err := roi.GetVersionContext(ctx, db, prj, shot, task, version)
+			if err != nil {
+				handleError(w, r, fmt.Errorf("could not get version '%s': %w", versionID, err))
+				return
+			}
+			_, err = roi.VersionThumbnails(nv)
+			if err != nil {
+				log.Printf("could not make version thumbnails '%s': %v", versionID, err)
+			}
+			http.Redirect(w, r, "/search/"+prj, http.StatusSeeOther)
+			return
+		}
+		// 입력이 적절하지 않으면 에러 메시지와 함께 폼을 다시 보인다.
+		errs = formErrors(w, err)
+		if errs == nil {
+			handleError(w, r, fmt.Errorf("could not update version '%s': %w", versionID, err))
+			return
+		}
 	}
-	o, err := roi.GetVersion(db, prj, shot, task, version)
+	o, err := roi.GetVersionContext(ctx, db, prj, shot, task, version)
 	if err != nil {
-		log.Printf("could not get version '%s': %v", versionID, err)
-		http.Error(w, "internal error", http.StatusInternalServerError)
+		handleError(w, r, fmt.Errorf("could not get version '%s': %w", versionID, err))
 		return
 	}
 	if o == nil {
-		http.Error(w, fmt.Sprintf("version '%s' not exist", versionID), http.StatusBadRequest)
+		httpError(w, r, fmt.Sprintf("version '%s' not exist", versionID), http.StatusNotFound)
 		return
 	}
 	recipt := struct {
 		LoggedInUser string
 		Version      *roi.Version
+		// Form과 Errors는 입력이 적절하지 않아 폼을 다시 보일 때 사용한다.
+		Form   url.Values
+		Errors map[string]string
 	}{
 		LoggedInUser: session["userid"],
 		Version:      o,
+		Form:         r.Form,
+		Errors:       errs,
 	}
-	err = executeTemplate(w, "update-version.html", recipt)
+	err = executeTemplate(w, r, "update-version.html", recipt)
 	if err != nil {
-		log.Fatal(err)
+		handleError(w, r, err)
 	}
 	return
 }
@@ -0,0 +1,370 @@
+// roipub은 DCC 툴에서 만든 결과물을 로이에 새 버전으로 등록한다.
+//
+// 예)
+// 	roipub -project TEST -shot CG_0010 -task fx -mov /tmp/fx.mov -work /tmp/fx.hip /tmp/fx.abc
+//
+// Nuke, Houdini, Maya의 쉘프 스크립트에서 실행하기 쉽도록
+// 결과는 표준 출력에, 에러는 표준 에러에 쓰고 실패하면 0이 아닌 값으로 종료한다.
+package main
+
+import (
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/hex"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/studio2l/roi"
+)
+
+func main() {
+	var (
+		addr     string
+		token    string
+		prj      string
+		shot     string
+		task     string
+		mov      string
+		work     string
+		images   string
+		cp       bool
+		caFile   string
+		insecure bool
+	)
+	flag.StringVar(&addr, "addr", "https://localhost", "로이 서버 주소")
+	flag.StringVar(&token, "token", os.Getenv("ROI_TOKEN"), "로이 프로필 페이지에서 발급받은 api 토큰, 지정하지 않으면 ROI_TOKEN 환경변수를 사용한다.")
+	flag.StringVar(&prj, "project", "", "프로젝트")
+	flag.StringVar(&shot, "shot", "", "샷")
+	flag.StringVar(&task, "task", "", "태스크")
+	flag.StringVar(&mov, "mov", "", "결과물을 영상으로 볼 수 있는 파일")
+	flag.StringVar(&work, "work", "", "결과물을 만든 작업 파일")
+	flag.StringVar(&images, "images", "", "결과물을 확인할 수 있는 이미지, 쉼표로 구분한다. 이미지 시퀀스는 #### 나 %04d 형식으로 쓴다.")
+	flag.BoolVar(&cp, "copy", false, "파일들을 프로젝트 경로 템플릿의 위치로 복사한 뒤 등록한다.")
+	flag.StringVar(&caFile, "ca", "", "서버 인증서를 확인할 CA 인증서 파일, 자체 서명 인증서를 쓸 때 지정한다.")
+	flag.BoolVar(&insecure, "insecure", false, "서버 인증서를 확인하지 않는다. 테스트 용도로만 사용한다.")
+	flag.Parse()
+
+	if prj == "" || shot == "" || task == "" {
+		flag.PrintDefaults()
+		fmt.Fprintln(os.Stderr, "프로젝트, 샷, 태스크를 입력하세요.")
+		os.Exit(1)
+	}
+	if token == "" {
+		fmt.Fprintln(os.Stderr, "api 토큰을 입력하세요.")
+		os.Exit(1)
+	}
+	outputs := flag.Args()
+	imgs := fields(images, ",")
+
+	// 실제로 존재하는 파일만 등록할 수 있다.
+	for _, f := range outputs {
+		checkFileExist(f)
+	}
+	for _, f := range imgs {
+		checkFileExist(f)
+	}
+	if mov != "" {
+		checkFileExist(mov)
+	}
+	if work != "" {
+		checkFileExist(work)
+	}
+
+	tlsConfig := &tls.Config{
+		InsecureSkipVerify: insecure,
+	}
+	if caFile != "" {
+		pem, err := ioutil.ReadFile(caFile)
+		if err != nil {
+			fatalf("could not read ca file: %v", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			fatalf("could not find certificates in ca file: %s", caFile)
+		}
+		tlsConfig.RootCAs = pool
+	}
+	http.DefaultTransport.(*http.Transport).TLSClientConfig = tlsConfig
+	c := &client{addr: strings.TrimSuffix(addr, "/"), token: token}
+	id := url.Values{
+		"project": []string{prj},
+		"shot":    []string{shot},
+		"task":    []string{task},
+	}
+
+	var version int
+	if err := c.get("/api/v1/version/next", id, &version); err != nil {
+		fatalf("could not get next version: %v", err)
+	}
+
+	if cp {
+		// 결과물과 이미지는 렌더 경로에 함께 둔다.
+		if len(outputs) != 0 || len(imgs) != 0 {
+			dir, err := c.path(id, roi.PathRender, version)
+			if err != nil {
+				fatalf("could not resolve render path: %v", err)
+			}
+			outputs, err = copyFiles(outputs, dir)
+			if err != nil {
+				fatalf("could not copy output files: %v", err)
+			}
+			imgs, err = copyFiles(imgs, dir)
+			if err != nil {
+				fatalf("could not copy images: %v", err)
+			}
+		}
+		if mov != "" {
+			dir, err := c.path(id, roi.PathMov, version)
+			if err != nil {
+				fatalf("could not resolve mov path: %v", err)
+			}
+			mov, err = copyFile(mov, dir)
+			if err != nil {
+				fatalf("could not copy mov: %v", err)
+			}
+		}
+		if work != "" {
+			dir, err := c.path(id, roi.PathWork, version)
+			if err != nil {
+				fatalf("could not resolve work path: %v", err)
+			}
+			work, err = copyFile(work, dir)
+			if err != nil {
+				fatalf("could not copy work file: %v", err)
+			}
+		}
+	}
+
+	// 등록될 파일의 체크섬을 함께 보내 서버에서 같은 파일을 보고 있는지 확인하게 한다.
+	files := make([]string, 0)
+	files = append(files, outputs...)
+	for _, img := range imgs {
+		files = append(files, expandImage(img)...)
+	}
+	if mov != "" {
+		files = append(files, mov)
+	}
+	if work != "" {
+		files = append(files, work)
+	}
+	sums := make(map[string]string)
+	for _, f := range files {
+		sum, err := roi.FileChecksum(f)
+		if err != nil {
+			fatalf("could not compute checksum: %v", err)
+		}
+		sums[f] = sum
+	}
+	sumsJSON, err := json.Marshal(sums)
+	if err != nil {
+		fatalf("could not encode checksums: %v", err)
+	}
+
+	form := url.Values{}
+	for k, v := range id {
+		form[k] = v
+	}
+	form.Set("version", strconv.Itoa(version))
+	form.Set("output_files", strings.Join(outputs, ","))
+	form.Set("images", strings.Join(imgs, ","))
+	form.Set("mov", mov)
+	form.Set("work_file", work)
+	form.Set("checksums", string(sumsJSON))
+	if err := c.post("/api/v1/version/add", form, &version); err != nil {
+		fatalf("could not add version: %v", err)
+	}
+	fmt.Printf("%s.%s.%s.v%03d\n", prj, shot, task, version)
+	for _, f := range files {
+		fmt.Printf("%s  %s\n", sums[f], f)
+	}
+}
+
+// fatalf는 에러 메시지를 표준 에러에 쓰고 프로그램을 종료한다.
+func fatalf(format string, a ...interface{}) {
+	fmt.Fprintf(os.Stderr, format+"\n", a...)
+	os.Exit(1)
+}
+
+// fields는 문자열을 sep로 나누고 각 항목의 앞뒤 공백을 지운다. 빈 항목은 제외한다.
+func fields(s, sep string) []string {
+	fs := make([]string, 0)
+	for _, f := range strings.Split(s, sep) {
+		f = strings.TrimSpace(f)
+		if f != "" {
+			fs = append(fs, f)
+		}
+	}
+	return fs
+}
+
+// checkFileExist는 파일이 존재하지 않으면 프로그램을 종료한다.
+// 이미지 시퀀스는 적어도 한 프레임이 존재해야 한다.
+func checkFileExist(f string) {
+	if !filepath.IsAbs(f) {
+		fatalf("file path should be an absolute path: %s", f)
+	}
+	if roi.IsImageSequence(f) {
+		frames, err := roi.ImageSequenceFrames(f)
+		if err != nil || len(frames) == 0 {
+			fatalf("image sequence not exist: %s", f)
+		}
+		return
+	}
+	fi, err := os.Stat(f)
+	if err != nil {
+		fatalf("file not exist: %s", f)
+	}
+	if fi.IsDir() {
+		fatalf("file is a directory: %s", f)
+	}
+}
+
+// expandImage는 이미지 시퀀스라면 각 프레임의 경로를, 아니면 그 경로만 반환한다.
+func expandImage(img string) []string {
+	if !roi.IsImageSequence(img) {
+		return []string{img}
+	}
+	frames, _ := roi.ImageSequenceFrames(img)
+	pths := make([]string, len(frames))
+	for i, f := range frames {
+		pths[i] = f.Path
+	}
+	return pths
+}
+
+// client는 로이 서버의 api를 호출한다.
+type client struct {
+	addr string
+	// token은 api 질의의 Authorization 헤더에 담아 보내는 api 토큰이다.
+	token string
+}
+
+// get은 api를 GET으로 호출하고 응답 데이터를 data에 담는다.
+func (c *client) get(pth string, q url.Values, data interface{}) error {
+	req, err := http.NewRequest("GET", c.addr+pth+"?"+q.Encode(), nil)
+	if err != nil {
+		return err
+	}
+	return c.do(req, data)
+}
+
+// post는 api를 POST로 호출하고 응답 데이터를 data에 담는다.
+func (c *client) post(pth string, form url.Values, data interface{}) error {
+	req, err := http.NewRequest("POST", c.addr+pth, strings.NewReader(form.Encode()))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	return c.do(req, data)
+}
+
+// do는 요청에 api 토큰을 담아 보내고 응답 데이터를 data에 담는다.
+func (c *client) do(req *http.Request, data interface{}) error {
+	req.Header.Set("Authorization", "Bearer "+c.token)
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	return decodeAPIResponse(resp, data)
+}
+
+// path는 프로젝트 경로 템플릿에 따른 해당 종류의 경로를 얻는다.
+func (c *client) path(id url.Values, kind roi.PathKind, version int) (string, error) {
+	q := url.Values{}
+	for k, v := range id {
+		q[k] = v
+	}
+	q.Set("kind", string(kind))
+	q.Set("version", strconv.Itoa(version))
+	var pth string
+	if err := c.get("/api/v1/path", q, &pth); err != nil {
+		return "", err
+	}
+	return pth, nil
+}
+
+// decodeAPIResponse는 roi.APIResponse를 읽어 에러가 있으면 반환하고,
+// 없으면 응답 데이터를 data에 담는다.
+func decodeAPIResponse(resp *http.Response, data interface{}) error {
+	defer resp.Body.Close()
+	var raw json.RawMessage
+	apiResp := roi.APIResponse{Data: &raw}
+	if err := json.NewDecoder(resp.Body).Decode(&apiResp); err != nil {
+		return fmt.Errorf("could not decode response (%s): %v", resp.Status, err)
+	}
+	if apiResp.Err != "" {
+		return fmt.Errorf("%s", apiResp.Err)
+	}
+	if data == nil || len(raw) == 0 {
+		return nil
+	}
+	return json.Unmarshal(raw, data)
+}
+
+// copyFiles는 파일들을 dir 아래로 복사하고 복사된 경로를 반환한다.
+// 이미지 시퀀스는 모든 프레임을 복사하고 새 위치의 시퀀스 경로를 반환한다.
+func copyFiles(files []string, dir string) ([]string, error) {
+	copied := make([]string, 0, len(files))
+	for _, f := range files {
+		if roi.IsImageSequence(f) {
+			for _, frame := range expandImage(f) {
+				if _, err := copyFile(frame, dir); err != nil {
+					return nil, err
+				}
+			}
+			copied = append(copied, filepath.Join(dir, filepath.Base(f)))
+			continue
+		}
+		dst, err := copyFile(f, dir)
+		if err != nil {
+			return nil, err
+		}
+		copied = append(copied, dst)
+	}
+	return copied, nil
+}
+
+// copyFile은 파일을 dir 아래로 복사하고 복사된 경로를 반환한다.
+// 복사 후 체크섬을 비교해 파일이 온전히 복사되었는지 확인한다.
+// 같은 이름의 파일이 이미 있으면 덮어쓰지 않고 에러를 반환한다.
+func copyFile(src, dir string) (string, error) {
+	dst := filepath.Join(dir, filepath.Base(src))
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return "", err
+	}
+	r, err := os.Open(src)
+	if err != nil {
+		return "", err
+	}
+	defer r.Close()
+	w, err := os.OpenFile(dst, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644)
+	if err != nil {
+		return "", err
+	}
+	srch := sha256.New()
+	if _, err := io.Copy(w, io.TeeReader(r, srch)); err != nil {
+		w.Close()
+		return "", err
+	}
+	if err := w.Close(); err != nil {
+		return "", err
+	}
+	dstSum, err := roi.FileChecksum(dst)
+	if err != nil {
+		return "", err
+	}
+	if dstSum != hex.EncodeToString(srch.Sum(nil)) {
+		return "", fmt.Errorf("checksum mismatch after copy: %s", dst)
+	}
+	return dst, nil
+}
@@ -22,9 +22,11 @@ func main() {
 	var (
 		prj   string
 		sheet string
+		token string
 	)
 	flag.StringVar(&prj, "prj", "", "샷을 추가할 프로젝트, 없으면 엑셀 파일이름을 따른다.")
 	flag.StringVar(&sheet, "sheet", "Sheet1", "엑셀 시트명")
+	flag.StringVar(&token, "token", os.Getenv("ROI_TOKEN"), "로이 프로필 페이지에서 발급받은 api 토큰, 지정하지 않으면 ROI_TOKEN 환경변수를 사용한다.")
 	flag.Parse()
 
 	if len(flag.Args()) != 1 {
@@ -61,7 +63,7 @@ func main() {
 	http.DefaultTransport.(*http.Transport).TLSClientConfig = &tls.Config{
 		InsecureSkipVerify: true,
 	}
-	_, err = http.PostForm("https://localhost/api/v1/project/add", url.Values{
+	_, err = postForm("https://localhost/api/v1/project/add", token, url.Values{
 		"project":       []string{"test"},
 		"default_tasks": []string{"fx, lit"},
 	})
@@ -78,7 +80,7 @@ func main() {
 		}
 		formData.Set("project", prj)
 		formData.Set("shot", formData.Get("shot"))
-		resp, err := http.PostForm("https://localhost/api/v1/shot/add", formData)
+		resp, err := postForm("https://localhost/api/v1/shot/add", token, formData)
 		if err != nil {
 			log.Fatal(err)
 		}
@@ -98,3 +100,14 @@ func main() {
 		fmt.Println(string(b))
 	}
 }
+
+// postForm은 api 토큰을 담아 폼을 POST로 보낸다.
+func postForm(addr, token string, form url.Values) (*http.Response, error) {
+	req, err := http.NewRequest("POST", addr, strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Authorization", "Bearer "+token)
+	return http.DefaultClient.Do(req)
+}
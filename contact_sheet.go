@@ -0,0 +1,144 @@
+package roi
+
+import (
+	"context"
+	"database/sql"
+	"image"
+	"image/color"
+	"image/draw"
+	"log"
+	"strings"
+)
+
+// ShotSequence는 샷 이름에서 시퀀스 이름을 반환한다.
+// 시퀀스는 샷 이름의 마지막 언더바(_) 앞 부분이다.
+// 언더바가 없다면 빈 문자열을 반환한다.
+//
+// 예)
+// 	ShotSequence("CG_0010") => "CG"
+// 	ShotSequence("EP01_SC01_0010") => "EP01_SC01"
+//
+func ShotSequence(shot string) string {
+	i := strings.LastIndex(shot, "_")
+	if i < 0 {
+		return ""
+	}
+	return shot[:i]
+}
+
+// ContactSheetTile은 컨택트 시트의 한 칸으로, 한 태스크의 마지막 버전을 나타낸다.
+type ContactSheetTile struct {
+	Shot    string
+	Task    string
+	Version int
+	// Thumbnail은 버전 썸네일이다. 썸네일을 만들 수 없었다면 nil이다.
+	Thumbnail *VersionThumbnail
+}
+
+// ContactSheetRow는 컨택트 시트에서 한 샷의 줄이다.
+type ContactSheetRow struct {
+	Shot string
+	// Tiles는 ContactSheet.Tasks와 같은 순서와 길이를 가진다.
+	// 샷에 해당 태스크가 없거나 버전이 없으면 그 자리는 nil이다.
+	Tiles []*ContactSheetTile
+}
+
+// ContactSheet는 여러 샷의 각 태스크 마지막 버전 썸네일을 한 눈에 보기 위한 표이다.
+type ContactSheet struct {
+	Project string
+	// Tasks는 컨택트 시트의 열이 되는 태스크 이름이다.
+	// 샷의 WorkingTasks에서 처음 나온 순서대로 정렬된다.
+	Tasks []string
+	Rows  []*ContactSheetRow
+}
+
+// NewContactSheet는 샷들의 작업중인 태스크별 마지막 버전으로 컨택트 시트를 만든다.
+// 필요하다면 버전 썸네일을 함께 만든다. 썸네일을 만들지 못한 칸은 로그를 남기고 비워둔다.
+func NewContactSheet(db *sql.DB, prj string, shots []*Shot) (*ContactSheet, error) {
+	return NewContactSheetContext(context.Background(), db, prj, shots)
+}
+
+// NewContactSheetContext는 ctx를 받는 NewContactSheet이다.
+func NewContactSheetContext(ctx context.Context, db *sql.DB, prj string, shots []*Shot) (*ContactSheet, error) {
+	c := &ContactSheet{
+		Project: prj,
+		Tasks:   make([]string, 0),
+		Rows:    make([]*ContactSheetRow, 0, len(shots)),
+	}
+	taskIdx := make(map[string]int)
+	for _, s := range shots {
+		for _, t := range s.WorkingTasks {
+			if _, ok := taskIdx[t]; !ok {
+				taskIdx[t] = len(c.Tasks)
+				c.Tasks = append(c.Tasks, t)
+			}
+		}
+	}
+	for _, s := range shots {
+		row := &ContactSheetRow{Shot: s.Shot, Tiles: make([]*ContactSheetTile, len(c.Tasks))}
+		for _, task := range s.WorkingTasks {
+			t, err := GetTaskContext(ctx, db, prj, s.Shot, task)
+			if err != nil {
+				return nil, err
+			}
+			if t == nil || t.LastOutputVersion == 0 {
+				continue
+			}
+			tile := &ContactSheetTile{Shot: s.Shot, Task: task, Version: t.LastOutputVersion}
+			v, err := GetVersionContext(ctx, db, prj, s.Shot, task, t.LastOutputVersion)
+			if err != nil {
+				return nil, err
+			}
+			if v != nil {
+				// 한 칸의 썸네일을 만들지 못했다고 컨택트 시트 전체를 보이지 못해서는 안된다.
+				ths, err := VersionThumbnails(v)
+				if err != nil {
+					log.Printf("could not make version thumbnails of %s.%s.%s.v%03d: %v", prj, s.Shot, task, v.Version, err)
+				}
+				for i := range ths {
+					// 가운데 썸네일이 있다면 그것을, 아니면 첫번째 썸네일을 사용한다.
+					if tile.Thumbnail == nil || ths[i].Name == "middle" {
+						tile.Thumbnail = &ths[i]
+					}
+				}
+			}
+			row.Tiles[taskIdx[task]] = tile
+		}
+		c.Rows = append(c.Rows, row)
+	}
+	return c, nil
+}
+
+// contactSheetGap은 컨택트 시트 이미지에서 칸 사이의 간격이다.
+const contactSheetGap = 4
+
+// Image는 컨택트 시트를 한 장의 이미지로 만든다.
+// 각 칸은 VersionThumbnailSize 크기이며, 썸네일이 없는 칸은 어둡게 칠해진다.
+func (c *ContactSheet) Image() (image.Image, error) {
+	tw, th := VersionThumbnailSize.Width, VersionThumbnailSize.Height
+	w := len(c.Tasks)*(tw+contactSheetGap) + contactSheetGap
+	h := len(c.Rows)*(th+contactSheetGap) + contactSheetGap
+	img := image.NewRGBA(image.Rect(0, 0, w, h))
+	draw.Draw(img, img.Bounds(), image.NewUniform(color.RGBA{27, 28, 29, 255}), image.ZP, draw.Src)
+	empty := image.NewUniform(color.RGBA{70, 70, 70, 255})
+	for y, row := range c.Rows {
+		for x, tile := range row.Tiles {
+			min := image.Pt(contactSheetGap+x*(tw+contactSheetGap), contactSheetGap+y*(th+contactSheetGap))
+			cell := image.Rectangle{Min: min, Max: min.Add(image.Pt(tw, th))}
+			if tile == nil || tile.Thumbnail == nil {
+				draw.Draw(img, cell, empty, image.ZP, draw.Src)
+				continue
+			}
+			thumb, err := decodeImageFile(tile.Thumbnail.File)
+			if err != nil {
+				return nil, err
+			}
+			// 썸네일의 비율이 칸과 다를 수 있으므로 가운데에 놓는다.
+			b := thumb.Bounds()
+			off := image.Pt((tw-b.Dx())/2, (th-b.Dy())/2)
+			draw.Draw(img, cell, empty, image.ZP, draw.Src)
+			draw.Draw(img, b.Sub(b.Min).Add(min).Add(off), thumb, b.Min, draw.Src)
+		}
+	}
+	return img, nil
+}
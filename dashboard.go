@@ -0,0 +1,175 @@
+package roi
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+
+	"github.com/lib/pq"
+)
+
+// Dashboard는 여러 저장된 검색을 한 페이지에 모아 보여주는 사용자의 대시보드이다.
+type Dashboard struct {
+	// User는 대시보드를 만든 사용자의 아이디이다.
+	User string
+	// Name은 사용자 내에서 고유한 대시보드 이름이다.
+	Name string
+	// Searches는 대시보드에 표시할 저장된 검색의 아이디(SavedSearch.ID)이다.
+	// 대시보드에는 이 순서대로 보여져야 한다.
+	Searches []string
+}
+
+var CreateTableIfNotExistsDashboardsStmt = `CREATE TABLE IF NOT EXISTS dashboards (
+	uniqid UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+	user_id STRING NOT NULL CHECK (length(user_id) > 0) CHECK (user_id NOT LIKE '% %'),
+	name STRING NOT NULL CHECK (length(name) > 0),
+	searches STRING[] NOT NULL,
+	UNIQUE(user_id, name)
+)`
+
+var DashboardTableKeys = []string{
+	"user_id",
+	"name",
+	"searches",
+}
+
+var DashboardTableIndices = dbIndices(DashboardTableKeys)
+
+func (d *Dashboard) dbValues() []interface{} {
+	if d == nil {
+		d = &Dashboard{}
+	}
+	if d.Searches == nil {
+		d.Searches = make([]string, 0)
+	}
+	return []interface{}{
+		d.User,
+		d.Name,
+		pq.Array(d.Searches),
+	}
+}
+
+// AddDashboard는 db에 사용자의 대시보드를 추가한다.
+func AddDashboard(db *sql.DB, d *Dashboard) error {
+	return AddDashboardContext(context.Background(), db, d)
+}
+
+// AddDashboardContext는 ctx를 받는 AddDashboard이다.
+func AddDashboardContext(ctx context.Context, db *sql.DB, d *Dashboard) error {
+	if d == nil {
+		return errorf(ErrInvalid, "nil Dashboard is invalid")
+	}
+	if d.User == "" {
+		return errorf(ErrInvalid, "user not specified")
+	}
+	// 대시보드 이름 또한 URL 경로에 사용된다.
+	v := &validator{}
+	v.check(IsValidSavedSearchName(d.Name), "name", "invalid dashboard name: '%s'", d.Name)
+	if err := v.err(); err != nil {
+		return err
+	}
+	keystr := strings.Join(DashboardTableKeys, ", ")
+	idxstr := strings.Join(DashboardTableIndices, ", ")
+	stmt := fmt.Sprintf("INSERT INTO dashboards (%s) VALUES (%s)", keystr, idxstr)
+	if _, err := dbExec(ctx, db, stmt, d.dbValues()...); err != nil {
+		return err
+	}
+	return nil
+}
+
+// UpdateDashboard는 대시보드에 표시할 저장된 검색들을 수정한다.
+func UpdateDashboard(db *sql.DB, user, name string, searches []string) error {
+	return UpdateDashboardContext(context.Background(), db, user, name, searches)
+}
+
+// UpdateDashboardContext는 ctx를 받는 UpdateDashboard이다.
+func UpdateDashboardContext(ctx context.Context, db *sql.DB, user, name string, searches []string) error {
+	if user == "" {
+		return errorf(ErrInvalid, "user not specified")
+	}
+	if name == "" {
+		return errorf(ErrInvalid, "dashboard name not specified")
+	}
+	if searches == nil {
+		searches = make([]string, 0)
+	}
+	stmt := "UPDATE dashboards SET searches=$1 WHERE user_id=$2 AND name=$3"
+	if _, err := dbExec(ctx, db, stmt, pq.Array(searches), user, name); err != nil {
+		return err
+	}
+	return nil
+}
+
+// dashboardFromRows는 테이블의 한 열에서 대시보드를 받아온다.
+func dashboardFromRows(rows *sql.Rows) (*Dashboard, error) {
+	d := &Dashboard{}
+	err := rows.Scan(&d.User, &d.Name, pq.Array(&d.Searches))
+	if err != nil {
+		return nil, err
+	}
+	return d, nil
+}
+
+// GetDashboard는 db에서 해당 사용자의 대시보드를 찾는다.
+// 만일 그 이름의 대시보드가 없다면 nil이 반환된다.
+func GetDashboard(db *sql.DB, user, name string) (*Dashboard, error) {
+	return GetDashboardContext(context.Background(), db, user, name)
+}
+
+// GetDashboardContext는 ctx를 받는 GetDashboard이다.
+func GetDashboardContext(ctx context.Context, db *sql.DB, user, name string) (*Dashboard, error) {
+	keystr := strings.Join(DashboardTableKeys, ", ")
+	stmt := fmt.Sprintf("SELECT %s FROM dashboards WHERE user_id=$1 AND name=$2 LIMIT 1", keystr)
+	rows, err := dbQuery(ctx, db, stmt, user, name)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	if !rows.Next() {
+		return nil, rows.Err()
+	}
+	return dashboardFromRows(rows)
+}
+
+// UserDashboards는 해당 사용자의 대시보드를 모두 반환한다.
+func UserDashboards(db *sql.DB, user string) ([]*Dashboard, error) {
+	return UserDashboardsContext(context.Background(), db, user)
+}
+
+// UserDashboardsContext는 ctx를 받는 UserDashboards이다.
+func UserDashboardsContext(ctx context.Context, db *sql.DB, user string) ([]*Dashboard, error) {
+	keystr := strings.Join(DashboardTableKeys, ", ")
+	stmt := fmt.Sprintf("SELECT %s FROM dashboards WHERE user_id=$1 ORDER BY name", keystr)
+	rows, err := dbQuery(ctx, db, stmt, user)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	ds := make([]*Dashboard, 0)
+	for rows.Next() {
+		d, err := dashboardFromRows(rows)
+		if err != nil {
+			return nil, err
+		}
+		ds = append(ds, d)
+	}
+	if rows.Err() != nil {
+		return nil, rows.Err()
+	}
+	return ds, nil
+}
+
+// DeleteDashboard는 db에서 해당 사용자의 대시보드를 지운다.
+// 대시보드가 가리키는 저장된 검색은 지우지 않는다.
+func DeleteDashboard(db *sql.DB, user, name string) error {
+	return DeleteDashboardContext(context.Background(), db, user, name)
+}
+
+// DeleteDashboardContext는 ctx를 받는 DeleteDashboard이다.
+func DeleteDashboardContext(ctx context.Context, db *sql.DB, user, name string) error {
+	if _, err := dbExec(ctx, db, "DELETE FROM dashboards WHERE user_id=$1 AND name=$2", user, name); err != nil {
+		return fmt.Errorf("could not delete data from 'dashboards' table: %w", err)
+	}
+	return nil
+}
@@ -6,23 +6,46 @@ import (
 	_ "image/jpeg"
 	"log"
 	"strconv"
+	"sync"
+	"time"
 )
 
+// SchemaVersion은 로이 db 스키마의 버전이다.
+// 테이블이나 열이 추가, 변경되면 올려야 하며, 백업 파일에 기록되어
+// 더 새로운 스키마에서 만든 백업을 되살리지 않도록 하는데 쓰인다.
+const SchemaVersion = 2
+
+// DBAddr는 로이가 DB 유저인 roiuser로 접속할 DB 주소이다.
+var DBAddr = "postgresql://roiuser@localhost:26257/roi?sslmode=disable"
+
+// DBRootAddr는 InitDB가 로이 DB와 DB 유저를 생성할 때 접속할 root 유저의 DB 주소이다.
+var DBRootAddr = "postgresql://root@localhost:26257/roi?sslmode=disable"
+
+// DBMaxOpenConns는 DB 핸들러가 동시에 열 수 있는 최대 연결 수이다. 0이면 제한하지 않는다.
+var DBMaxOpenConns = 0
+
+// DBMaxIdleConns는 DB 핸들러가 쉬는 동안 유지하는 최대 연결 수이다.
+var DBMaxIdleConns = 10
+
+// DBConnMaxLifetime은 DB 연결 하나를 재사용할 수 있는 최대 기간이다. 0이면 제한하지 않는다.
+var DBConnMaxLifetime time.Duration
+
 // InitDB는 로이 DB 및 DB유저를 생성한다.
 // 여러번 실행해도 문제되지 않는다.
 // 실패하면 진행된 프로세스를 취소하고 에러를 반환한다.
 func InitDB() error {
-	return initDB("postgresql://root@localhost:26257/roi?sslmode=disable")
+	return initDB(DBRootAddr)
 }
 
 func initDB(addr string) error {
 	db, err := sql.Open("postgres", addr)
 	if err != nil {
-		return fmt.Errorf("could not the database with root user: %v", err)
+		return fmt.Errorf("could not the database with root user: %w", err)
 	}
+	defer db.Close()
 	tx, err := db.Begin()
 	if err != nil {
-		return fmt.Errorf("could not begin a transaction: %v", err)
+		return fmt.Errorf("could not begin a transaction: %w", err)
 	}
 	defer tx.Rollback() // 트랜잭션이 완료되지 않았을 때만 실행됨
 
@@ -37,30 +60,121 @@ func initDB(addr string) error {
 		log.Fatal("could not grant 'roi' to 'roiuser': ", err)
 	}
 	if _, err := tx.Exec(CreateTableIfNotExistsProjectsStmt); err != nil {
-		return fmt.Errorf("could not create 'projects' table: %v", err)
+		return fmt.Errorf("could not create 'projects' table: %w", err)
 	}
 	if _, err := tx.Exec(CreateTableIfNotExistsShotsStmt); err != nil {
-		return fmt.Errorf("could not create 'shots' table: %v", err)
+		return fmt.Errorf("could not create 'shots' table: %w", err)
+	}
+	if _, err := tx.Exec(CreateTableIfNotExistsShotAliasesStmt); err != nil {
+		return fmt.Errorf("could not create 'shot_aliases' table: %w", err)
 	}
 	if _, err := tx.Exec(CreateTableIfNotExistsTasksStmt); err != nil {
-		return fmt.Errorf("could not create 'tasks' table: %v", err)
+		return fmt.Errorf("could not create 'tasks' table: %w", err)
 	}
 	if _, err := tx.Exec(CreateTableIfNotExistsVersionsStmt); err != nil {
-		return fmt.Errorf("could not create 'versions' table: %v", err)
+		return fmt.Errorf("could not create 'versions' table: %w", err)
+	}
+	if _, err := tx.Exec(CreateTableIfNotExistsProjectPathsStmt); err != nil {
+		return fmt.Errorf("could not create 'project_paths' table: %w", err)
+	}
+	if _, err := tx.Exec(CreateTableIfNotExistsProjectTagsStmt); err != nil {
+		return fmt.Errorf("could not create 'project_tags' table: %w", err)
+	}
+	if _, err := tx.Exec(CreateTableIfNotExistsProjectTemplatesStmt); err != nil {
+		return fmt.Errorf("could not create 'project_templates' table: %w", err)
+	}
+	if _, err := tx.Exec(CreateTableIfNotExistsArchivedProjectsStmt); err != nil {
+		return fmt.Errorf("could not create 'archived_projects' table: %w", err)
+	}
+	if _, err := tx.Exec(CreateTableIfNotExistsVersionFilesStmt); err != nil {
+		return fmt.Errorf("could not create 'version_files' table: %w", err)
+	}
+	if _, err := tx.Exec(CreateTableIfNotExistsIngestQuarantineStmt); err != nil {
+		return fmt.Errorf("could not create 'ingest_quarantine' table: %w", err)
+	}
+	if _, err := tx.Exec(CreateTableIfNotExistsPlaylistsStmt); err != nil {
+		return fmt.Errorf("could not create 'playlists' table: %w", err)
+	}
+	if _, err := tx.Exec(CreateTableIfNotExistsPlaylistItemsStmt); err != nil {
+		return fmt.Errorf("could not create 'playlist_items' table: %w", err)
+	}
+	if _, err := tx.Exec(CreateTableIfNotExistsReviewsStmt); err != nil {
+		return fmt.Errorf("could not create 'reviews' table: %w", err)
+	}
+	if _, err := tx.Exec(CreateTableIfNotExistsAnnotationsStmt); err != nil {
+		return fmt.Errorf("could not create 'annotations' table: %w", err)
+	}
+	if _, err := tx.Exec(CreateTableIfNotExistsReviewSessionsStmt); err != nil {
+		return fmt.Errorf("could not create 'review_sessions' table: %w", err)
+	}
+	if _, err := tx.Exec(CreateTableIfNotExistsReviewSessionItemsStmt); err != nil {
+		return fmt.Errorf("could not create 'review_session_items' table: %w", err)
+	}
+	if _, err := tx.Exec(CreateTableIfNotExistsDeliveriesStmt); err != nil {
+		return fmt.Errorf("could not create 'deliveries' table: %w", err)
+	}
+	if _, err := tx.Exec(CreateTableIfNotExistsDeliveryItemsStmt); err != nil {
+		return fmt.Errorf("could not create 'delivery_items' table: %w", err)
+	}
+	if _, err := tx.Exec(CreateTableIfNotExistsVendorsStmt); err != nil {
+		return fmt.Errorf("could not create 'vendors' table: %w", err)
+	}
+	if _, err := tx.Exec(CreateTableIfNotExistsVendorTasksStmt); err != nil {
+		return fmt.Errorf("could not create 'vendor_tasks' table: %w", err)
+	}
+	if _, err := tx.Exec(CreateTableIfNotExistsNotificationsStmt); err != nil {
+		return fmt.Errorf("could not create 'notifications' table: %w", err)
+	}
+	if _, err := tx.Exec(CreateTableIfNotExistsTrashStmt); err != nil {
+		return fmt.Errorf("could not create 'trash' table: %w", err)
 	}
 	if _, err := tx.Exec(CreateTableIfNotExistsUsersStmt); err != nil {
-		return fmt.Errorf("could not create 'users' table: %v", err)
+		return fmt.Errorf("could not create 'users' table: %w", err)
+	}
+	if _, err := tx.Exec(CreateTableIfNotExistsSearchWordsStmt); err != nil {
+		return fmt.Errorf("could not create 'search_words' table: %w", err)
+	}
+	if _, err := tx.Exec(CreateTableIfNotExistsSavedSearchesStmt); err != nil {
+		return fmt.Errorf("could not create 'saved_searches' table: %w", err)
+	}
+	if _, err := tx.Exec(CreateTableIfNotExistsDashboardsStmt); err != nil {
+		return fmt.Errorf("could not create 'dashboards' table: %w", err)
+	}
+	if _, err := tx.Exec(CreateTableIfNotExistsSessionsStmt); err != nil {
+		return fmt.Errorf("could not create 'sessions' table: %w", err)
 	}
 	err = tx.Commit()
 	if err != nil {
-		return fmt.Errorf("could not commit the transaction: %v", err)
+		return fmt.Errorf("could not commit the transaction: %w", err)
 	}
 	return nil
 }
 
+var (
+	// sharedDBMu는 sharedDB를 처음 열 때 동시에 여러번 열리지 않도록 한다.
+	sharedDBMu sync.Mutex
+	// sharedDB는 DB가 반환하는, 프로세스 전체에서 공유하는 DB 핸들러이다.
+	sharedDB *sql.DB
+)
+
 // DB는 로이의 DB 핸들러를 반환한다. 이 함수는 이미 로이 DB와 DB 유저가 생성되어 있다고 가정한다.
+// 핸들러는 처음 불릴 때 DBAddr로 한번 열린 뒤 모든 호출에서 공유되므로 닫지 말아야 한다.
+// 연결 풀의 설정은 처음 열 때의 DBMaxOpenConns, DBMaxIdleConns, DBConnMaxLifetime을 따른다.
 func DB() (*sql.DB, error) {
-	return sql.Open("postgres", "postgresql://roiuser@localhost:26257/roi?sslmode=disable")
+	sharedDBMu.Lock()
+	defer sharedDBMu.Unlock()
+	if sharedDB != nil {
+		return sharedDB, nil
+	}
+	db, err := sql.Open("postgres", DBAddr)
+	if err != nil {
+		return nil, err
+	}
+	db.SetMaxOpenConns(DBMaxOpenConns)
+	db.SetMaxIdleConns(DBMaxIdleConns)
+	db.SetConnMaxLifetime(DBConnMaxLifetime)
+	sharedDB = db
+	return sharedDB, nil
 }
 
 // dbIndices는 받아들인 문자열 슬라이스와 같은 길이의
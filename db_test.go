@@ -1,6 +1,7 @@
 package roi
 
 import (
+	"context"
 	"reflect"
 	"testing"
 )
@@ -30,3 +31,34 @@ func TestDBIndices(t *testing.T) {
 		}
 	}
 }
+
+func TestSharedDB(t *testing.T) {
+	a, err := DB()
+	if err != nil {
+		t.Fatalf("could not get db: %v", err)
+	}
+	b, err := DB()
+	if err != nil {
+		t.Fatalf("could not get db: %v", err)
+	}
+	if a != b {
+		t.Fatalf("DB should return shared handle")
+	}
+}
+
+func TestCanceledContext(t *testing.T) {
+	db, err := testDB()
+	if err != nil {
+		t.Fatalf("could not connect to database: %v", err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, err = ProjectExistContext(ctx, db, testProject.Project)
+	if err != context.Canceled {
+		t.Fatalf("query with canceled context: got %v, want %v", err, context.Canceled)
+	}
+	err = AddProjectContext(ctx, db, testProject)
+	if err == nil {
+		t.Fatalf("add with canceled context should fail")
+	}
+}
@@ -0,0 +1,681 @@
+package roi
+
+import (
+	"context"
+	"database/sql"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/360EntSecGroup-Skylar/excelize"
+)
+
+// DeliveryMode는 납품 파일을 납품 폴더로 옮기는 방법이다.
+type DeliveryMode string
+
+const (
+	DeliveryCopy     = DeliveryMode("copy")
+	DeliveryHardlink = DeliveryMode("hardlink")
+)
+
+var AllDeliveryModes = []DeliveryMode{
+	DeliveryCopy,
+	DeliveryHardlink,
+}
+
+// isValidDeliveryMode는 해당 납품 방법이 유효한지를 반환한다.
+func isValidDeliveryMode(m DeliveryMode) bool {
+	for _, dm := range AllDeliveryModes {
+		if m == dm {
+			return true
+		}
+	}
+	return false
+}
+
+// UIString은 UI안에서 사용하는 현지화된 문자열이다.
+func (m DeliveryMode) UIString() string {
+	switch m {
+	case DeliveryCopy:
+		return "복사"
+	case DeliveryHardlink:
+		return "하드링크"
+	}
+	return ""
+}
+
+// IsValidDeliveryName은 해당 이름이 납품의 이름으로 적절한지 여부를 반환한다.
+// 이름은 URL 경로에 사용되기 때문에 슬래시(/)를 포함할 수 없다.
+func IsValidDeliveryName(name string) bool {
+	if strings.TrimSpace(name) == "" {
+		return false
+	}
+	return !strings.Contains(name, "/")
+}
+
+// DeliveryRoots는 납품 폴더를 만들 수 있는 루트 디렉토리들이다.
+// 납품 폴더는 이 디렉토리 중 하나의 아래에 있어야 한다. 비어 있으면 납품할 수 없다.
+var DeliveryRoots []string
+
+// DefaultDeliveryNaming은 납품 파일 이름 템플릿이 정해지지 않았을 때 사용하는 템플릿이다.
+var DefaultDeliveryNaming = "{shot}/{shot}_{task}_{version}{frame}{ext}"
+
+// DeliveryItem은 납품된 하나의 파일이다.
+type DeliveryItem struct {
+	Shot    string
+	Task    string
+	Version int
+	// Src는 납품한 원본 파일의 경로이다.
+	Src string
+	// Dst는 납품 폴더 안에서의 파일 경로이다. 클라이언트의 이름 규칙을 따른다.
+	Dst string
+	// Size와 Checksum은 납품 폴더에 옮겨진 파일의 크기와 해시이다.
+	Size     int64
+	Checksum string
+}
+
+// Delivery는 클라이언트에게 한번에 보내는 버전 파일들의 묶음이다.
+type Delivery struct {
+	Project string
+	// Name은 프로젝트 내에서 고유한 납품 이름이다.
+	Name string
+	// Dir은 납품 파일과 목록(manifest)이 저장되는 폴더이다.
+	Dir string
+	// Naming은 납품 파일 이름을 만들 때 사용한 템플릿이다. deliveryFileName 참고.
+	Naming string
+	Mode   DeliveryMode
+	// Vendor가 빈 문자열이 아니라면 클라이언트 납품이 아니라 외주 업체로 보낸 패키지이다.
+	Vendor string
+	// Sender는 납품한 사용자의 아이디이다.
+	Sender  string
+	Created time.Time
+	// Items는 샷, 태스크 순서로 정렬되어 있다.
+	Items []*DeliveryItem
+}
+
+var CreateTableIfNotExistsDeliveriesStmt = `CREATE TABLE IF NOT EXISTS deliveries (
+	uniqid UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+	project STRING NOT NULL CHECK (length(project) > 0) CHECK (project NOT LIKE '% %'),
+	name STRING NOT NULL CHECK (length(name) > 0),
+	dir STRING NOT NULL CHECK (length(dir) > 0),
+	naming STRING NOT NULL CHECK (length(naming) > 0),
+	mode STRING NOT NULL,
+	vendor STRING NOT NULL,
+	sender STRING NOT NULL,
+	created TIMESTAMPTZ NOT NULL,
+	UNIQUE(project, name)
+)`
+
+var DeliveryTableKeys = []string{
+	"project",
+	"name",
+	"dir",
+	"naming",
+	"mode",
+	"vendor",
+	"sender",
+	"created",
+}
+
+var DeliveryTableIndices = dbIndices(DeliveryTableKeys)
+
+func (d *Delivery) dbValues() []interface{} {
+	if d == nil {
+		d = &Delivery{}
+	}
+	return []interface{}{
+		d.Project,
+		d.Name,
+		d.Dir,
+		d.Naming,
+		d.Mode,
+		d.Vendor,
+		d.Sender,
+		d.Created,
+	}
+}
+
+var CreateTableIfNotExistsDeliveryItemsStmt = `CREATE TABLE IF NOT EXISTS delivery_items (
+	uniqid UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+	project STRING NOT NULL CHECK (length(project) > 0) CHECK (project NOT LIKE '% %'),
+	delivery STRING NOT NULL CHECK (length(delivery) > 0),
+	shot STRING NOT NULL CHECK (length(shot) > 0) CHECK (shot NOT LIKE '% %'),
+	task STRING NOT NULL CHECK (length(task) > 0) CHECK (task NOT LIKE '% %'),
+	version INT NOT NULL,
+	src STRING NOT NULL,
+	dst STRING NOT NULL,
+	size INT NOT NULL,
+	checksum STRING NOT NULL,
+	UNIQUE(project, delivery, dst)
+)`
+
+var DeliveryItemTableKeys = []string{
+	"project",
+	"delivery",
+	"shot",
+	"task",
+	"version",
+	"src",
+	"dst",
+	"size",
+	"checksum",
+}
+
+var DeliveryItemTableIndices = dbIndices(DeliveryItemTableKeys)
+
+// deliveryFile은 버전에서 납품할 하나의 파일이다.
+type deliveryFile struct {
+	Src string
+	// Frame은 이미지 시퀀스의 프레임 번호를 원래 자리수에 맞춘 문자열이다.
+	// 시퀀스가 아니면 빈 문자열이다.
+	Frame string
+	// Base는 원본 파일 이름에서 프레임과 확장자를 뺀 부분이다.
+	Base string
+}
+
+// deliveryFiles는 버전의 결과물과 영상에서 납품할 파일들을 반환한다.
+// 이미지 시퀀스는 디스크 상의 각 프레임으로 펼친다.
+func deliveryFiles(v *Version) ([]deliveryFile, error) {
+	pths := append([]string{}, v.OutputFiles...)
+	if v.Mov != "" {
+		pths = append(pths, v.Mov)
+	}
+	files := make([]deliveryFile, 0, len(pths))
+	for _, pth := range pths {
+		if pth == "" {
+			continue
+		}
+		base := filepath.Base(pth)
+		ext := filepath.Ext(base)
+		if !IsImageSequence(pth) {
+			files = append(files, deliveryFile{Src: pth, Base: strings.TrimSuffix(base, ext)})
+			continue
+		}
+		loc := reImageSequence.FindStringSubmatchIndex(base)
+		pad := loc[1] - loc[0]
+		if base[loc[0]] == '%' {
+			pad = 0
+			if loc[2] >= 0 && loc[3] > loc[2] {
+				pad, _ = strconv.Atoi(base[loc[2]:loc[3]])
+			}
+		}
+		frames, err := ImageSequenceFrames(pth)
+		if err != nil {
+			return nil, err
+		}
+		if len(frames) == 0 {
+			return nil, errorf(ErrNotFound, "no frames found for %s", pth)
+		}
+		seqBase := strings.TrimRight(base[:loc[0]], "._")
+		for _, f := range frames {
+			files = append(files, deliveryFile{Src: f.Path, Frame: fmt.Sprintf("%0*d", pad, f.Frame), Base: seqBase})
+		}
+	}
+	return files, nil
+}
+
+// checkDeliveryNaming은 납품 파일 이름 템플릿이 적절한지 검사한다.
+// 템플릿은 납품 폴더에 대한 상대 경로여야 하며, 알 수 없는 토큰을 사용할 수 없다.
+func checkDeliveryNaming(tmpl string) error {
+	if tmpl == "" {
+		return errorf(ErrInvalid, "empty delivery naming template")
+	}
+	if filepath.IsAbs(tmpl) {
+		return errorf(ErrInvalid, "delivery naming template should be a relative path: %s", tmpl)
+	}
+	for _, e := range strings.Split(filepath.ToSlash(tmpl), "/") {
+		if e == ".." {
+			return errorf(ErrInvalid, "delivery naming template should not go out of the delivery directory: %s", tmpl)
+		}
+	}
+	known := PathTokens{}.values()
+	known["frame"] = ""
+	known["ext"] = ""
+	known["file"] = ""
+	for _, m := range rePathToken.FindAllStringSubmatch(tmpl, -1) {
+		if _, ok := known[m[1]]; !ok {
+			return errorf(ErrInvalid, "unknown token: %s", m[0])
+		}
+	}
+	return nil
+}
+
+// deliveryFileName은 납품 파일 이름 템플릿의 토큰을 값으로 바꾼 납품 폴더 안의 경로를 반환한다.
+//
+// 템플릿에는 경로 템플릿의 토큰(ProjectPaths 참고)과 함께 다음 토큰을 사용할 수 있다.
+// {frame}은 이미지 시퀀스의 프레임 번호 앞에 점을 붙인 값이며 시퀀스가 아니면 빈 문자열이다.
+// {ext}는 점을 포함한 원본 파일의 확장자이고, {file}은 원본 파일 이름에서 프레임과 확장자를 뺀 부분이다.
+//
+// 예)
+// 	{shot}/{shot}_{task}_{version}{frame}{ext} => CG_0010/CG_0010_comp_v003.1001.exr
+//
+func deliveryFileName(tmpl string, t PathTokens, f deliveryFile) (string, error) {
+	if err := checkDeliveryNaming(tmpl); err != nil {
+		return "", err
+	}
+	vals := t.values()
+	vals["frame"] = ""
+	if f.Frame != "" {
+		vals["frame"] = "." + f.Frame
+	}
+	vals["ext"] = filepath.Ext(f.Src)
+	vals["file"] = f.Base
+	var err error
+	name := rePathToken.ReplaceAllStringFunc(tmpl, func(tok string) string {
+		k := tok[1 : len(tok)-1]
+		v := vals[k]
+		if v == "" && k != "frame" && k != "ext" && err == nil {
+			err = errorf(ErrInvalid, "no value for token %s", tok)
+		}
+		return v
+	})
+	if err != nil {
+		return "", err
+	}
+	return filepath.ToSlash(filepath.Clean(name)), nil
+}
+
+// PlanDelivery는 샷들의 태스크 중 승인된(완료 상태인) 태스크의 마지막 버전 파일들을
+// 납품 항목으로 만들어 반환한다. 아직 승인된 태스크가 없는 샷은 건너뛴다.
+// 납품 폴더 안의 경로가 겹친다면 이름 템플릿이 부족한 것이므로 에러를 반환한다.
+func PlanDelivery(db *sql.DB, prj string, shots []string, naming string) ([]*DeliveryItem, error) {
+	return PlanDeliveryContext(context.Background(), db, prj, shots, naming)
+}
+
+// PlanDeliveryContext는 ctx를 받는 PlanDelivery이다.
+func PlanDeliveryContext(ctx context.Context, db *sql.DB, prj string, shots []string, naming string) ([]*DeliveryItem, error) {
+	if err := checkDeliveryNaming(naming); err != nil {
+		return nil, err
+	}
+	items := make([]*DeliveryItem, 0)
+	dsts := make(map[string]string)
+	done := make(map[string]bool)
+	for _, shot := range shots {
+		if done[shot] {
+			continue
+		}
+		done[shot] = true
+		tasks, err := ShotTasksContext(ctx, db, prj, shot)
+		if err != nil {
+			return nil, err
+		}
+		for _, t := range tasks {
+			if t.Status != TaskDone || t.LastOutputVersion <= 0 {
+				continue
+			}
+			v, err := GetVersionContext(ctx, db, prj, shot, t.Task, t.LastOutputVersion)
+			if err != nil {
+				return nil, err
+			}
+			if v == nil {
+				continue
+			}
+			files, err := deliveryFiles(v)
+			if err != nil {
+				return nil, err
+			}
+			for _, f := range files {
+				dst, err := deliveryFileName(naming, PathTokens{Project: prj, Shot: shot, Task: t.Task, Version: v.Version}, f)
+				if err != nil {
+					return nil, err
+				}
+				if src, ok := dsts[dst]; ok {
+					return nil, errorf(ErrConflict, "delivery file name conflicts: %s and %s are both named %s", src, f.Src, dst)
+				}
+				dsts[dst] = f.Src
+				items = append(items, &DeliveryItem{Shot: shot, Task: t.Task, Version: v.Version, Src: f.Src, Dst: dst})
+			}
+		}
+	}
+	return items, nil
+}
+
+// transferDeliveryFile은 원본 파일을 납품 방법에 따라 dst로 복사하거나 하드링크를 만든다.
+func transferDeliveryFile(mode DeliveryMode, src, dst string) error {
+	if err := os.MkdirAll(filepath.Dir(dst), 0755); err != nil {
+		return err
+	}
+	if mode == DeliveryHardlink {
+		return os.Link(src, dst)
+	}
+	r, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+	w, err := os.OpenFile(dst, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(w, r); err != nil {
+		w.Close()
+		return err
+	}
+	return w.Close()
+}
+
+// WriteDeliveryCSV는 납품 목록을 CSV 형식으로 w에 쓴다.
+func WriteDeliveryCSV(w io.Writer, d *Delivery) error {
+	cw := csv.NewWriter(w)
+	cw.Write([]string{"shot", "task", "version", "file", "source", "size", "checksum"})
+	for _, it := range d.Items {
+		cw.Write([]string{it.Shot, it.Task, strconv.Itoa(it.Version), it.Dst, it.Src, strconv.FormatInt(it.Size, 10), it.Checksum})
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+// WriteDeliveryXLSX는 납품 목록을 엑셀 형식으로 w에 쓴다.
+func WriteDeliveryXLSX(w io.Writer, d *Delivery) error {
+	xl := excelize.NewFile()
+	sheet := "manifest"
+	xl.SetSheetName("Sheet1", sheet)
+	title := []string{"shot", "task", "version", "file", "source", "size", "checksum"}
+	for j, t := range title {
+		xl.SetCellStr(sheet, excelize.ToAlphaString(j)+"1", t)
+	}
+	for i, it := range d.Items {
+		row := strconv.Itoa(i + 2)
+		vals := []interface{}{it.Shot, it.Task, it.Version, it.Dst, it.Src, it.Size, it.Checksum}
+		for j, v := range vals {
+			xl.SetCellValue(sheet, excelize.ToAlphaString(j)+row, v)
+		}
+	}
+	return xl.Write(w)
+}
+
+// writeDeliveryManifests는 납품 폴더에 manifest.csv와 manifest.xlsx를 쓴다.
+func writeDeliveryManifests(d *Delivery) error {
+	writers := map[string]func(io.Writer, *Delivery) error{
+		"manifest.csv":  WriteDeliveryCSV,
+		"manifest.xlsx": WriteDeliveryXLSX,
+	}
+	for name, write := range writers {
+		f, err := os.Create(filepath.Join(d.Dir, name))
+		if err != nil {
+			return err
+		}
+		if err := write(f, d); err != nil {
+			f.Close()
+			return err
+		}
+		if err := f.Close(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// AddDelivery는 납품 항목의 파일들을 납품 폴더로 옮기고, 목록 파일을 쓴 뒤 db에 납품을 기록한다.
+// 납품 폴더는 존재하지 않거나 비어 있어야 한다. 중간에 실패하면 납품 폴더에 쓴 파일들은 지워진다.
+func AddDelivery(db *sql.DB, d *Delivery) error {
+	return AddDeliveryContext(context.Background(), db, d)
+}
+
+// AddDeliveryContext는 ctx를 받는 AddDelivery이다.
+func AddDeliveryContext(ctx context.Context, db *sql.DB, d *Delivery) error {
+	if d == nil {
+		return errorf(ErrInvalid, "nil Delivery is invalid")
+	}
+	if d.Project == "" {
+		return errorf(ErrInvalid, "project not specified")
+	}
+	v := &validator{}
+	v.check(IsValidDeliveryName(d.Name), "name", "invalid delivery name: '%s'", d.Name)
+	if !filepath.IsAbs(d.Dir) {
+		v.check(false, "dir", "delivery directory should be an absolute path: %s", d.Dir)
+	} else {
+		v.check(inRoots(DeliveryRoots, d.Dir), "dir", "delivery directory is not in delivery roots: %s", d.Dir)
+	}
+	err := checkDeliveryNaming(d.Naming)
+	v.check(err == nil, "naming", "%v", err)
+	v.check(isValidDeliveryMode(d.Mode), "mode", "invalid delivery mode: %s", d.Mode)
+	if err := v.err(); err != nil {
+		return err
+	}
+	if len(d.Items) == 0 {
+		return errorf(ErrInvalid, "nothing to deliver")
+	}
+	exist, err := DeliveryExistContext(ctx, db, d.Project, d.Name)
+	if err != nil {
+		return err
+	}
+	if exist {
+		return errorf(ErrExists, "delivery already exist: %s/%s", d.Project, d.Name)
+	}
+	existDir := false
+	fis, err := ioutil.ReadDir(d.Dir)
+	if err == nil {
+		existDir = true
+		if len(fis) != 0 {
+			return errorf(ErrConflict, "delivery directory is not empty: %s", d.Dir)
+		}
+	} else if !os.IsNotExist(err) {
+		return err
+	}
+	if err := os.MkdirAll(d.Dir, 0755); err != nil {
+		return err
+	}
+	ok := false
+	defer func() {
+		if ok {
+			return
+		}
+		os.RemoveAll(d.Dir)
+		if existDir {
+			os.Mkdir(d.Dir, 0755)
+		}
+	}()
+	for _, it := range d.Items {
+		dst := filepath.Join(d.Dir, filepath.FromSlash(it.Dst))
+		if err := transferDeliveryFile(d.Mode, it.Src, dst); err != nil {
+			return fmt.Errorf("could not deliver %s: %w", it.Src, err)
+		}
+		fi, err := os.Stat(dst)
+		if err != nil {
+			return err
+		}
+		it.Size = fi.Size()
+		it.Checksum, err = FileChecksum(dst)
+		if err != nil {
+			return err
+		}
+	}
+	if err := writeDeliveryManifests(d); err != nil {
+		return fmt.Errorf("could not write delivery manifest: %w", err)
+	}
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("could not begin a transaction: %w", err)
+	}
+	defer tx.Rollback() // 트랜잭션이 완료되지 않았을 때만 실행됨
+	keystr := strings.Join(DeliveryTableKeys, ", ")
+	idxstr := strings.Join(DeliveryTableIndices, ", ")
+	stmt := fmt.Sprintf("INSERT INTO deliveries (%s) VALUES (%s)", keystr, idxstr)
+	if _, err := dbExec(ctx, tx, stmt, d.dbValues()...); err != nil {
+		return fmt.Errorf("could not insert delivery: %w", err)
+	}
+	keystr = strings.Join(DeliveryItemTableKeys, ", ")
+	idxstr = strings.Join(DeliveryItemTableIndices, ", ")
+	stmt = fmt.Sprintf("INSERT INTO delivery_items (%s) VALUES (%s)", keystr, idxstr)
+	for _, it := range d.Items {
+		if _, err := dbExec(ctx, tx, stmt, d.Project, d.Name, it.Shot, it.Task, it.Version, it.Src, it.Dst, it.Size, it.Checksum); err != nil {
+			return fmt.Errorf("could not insert delivery item: %w", err)
+		}
+	}
+	if d.Vendor != "" {
+		if err := markVendorTasksSent(ctx, tx, d.Project, d.Vendor, d.Items, d.Created); err != nil {
+			return err
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+	ok = true
+	return nil
+}
+
+// DeliveryExist는 db에 해당 납품이 존재하는지를 검사한다.
+func DeliveryExist(db *sql.DB, prj, name string) (bool, error) {
+	return DeliveryExistContext(context.Background(), db, prj, name)
+}
+
+// DeliveryExistContext는 ctx를 받는 DeliveryExist이다.
+func DeliveryExistContext(ctx context.Context, db *sql.DB, prj, name string) (bool, error) {
+	rows, err := dbQuery(ctx, db, "SELECT name FROM deliveries WHERE project=$1 AND name=$2 LIMIT 1", prj, name)
+	if err != nil {
+		return false, err
+	}
+	defer rows.Close()
+	return rows.Next(), rows.Err()
+}
+
+// deliveryFromRows는 테이블의 한 열에서 납품을 받아온다. 항목은 채우지 않는다.
+func deliveryFromRows(rows *sql.Rows) (*Delivery, error) {
+	d := &Delivery{}
+	if err := rows.Scan(&d.Project, &d.Name, &d.Dir, &d.Naming, &d.Mode, &d.Vendor, &d.Sender, &d.Created); err != nil {
+		return nil, err
+	}
+	return d, nil
+}
+
+// deliveryItems는 납품의 항목들 중 where 조건에 맞는 항목을 샷, 태스크, 파일 순서로 반환한다.
+func deliveryItems(ctx context.Context, db *sql.DB, where string, args ...interface{}) ([]*DeliveryItem, error) {
+	stmt := "SELECT shot, task, version, src, dst, size, checksum FROM delivery_items WHERE " + where + " ORDER BY shot, task, dst"
+	rows, err := dbQuery(ctx, db, stmt, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	items := make([]*DeliveryItem, 0)
+	for rows.Next() {
+		it := &DeliveryItem{}
+		if err := rows.Scan(&it.Shot, &it.Task, &it.Version, &it.Src, &it.Dst, &it.Size, &it.Checksum); err != nil {
+			return nil, err
+		}
+		items = append(items, it)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+// GetDelivery는 db에서 납품과 그 항목들을 불러온다.
+// 만일 그 이름의 납품이 없다면 nil이 반환된다.
+func GetDelivery(db *sql.DB, prj, name string) (*Delivery, error) {
+	return GetDeliveryContext(context.Background(), db, prj, name)
+}
+
+// GetDeliveryContext는 ctx를 받는 GetDelivery이다.
+func GetDeliveryContext(ctx context.Context, db *sql.DB, prj, name string) (*Delivery, error) {
+	keystr := strings.Join(DeliveryTableKeys, ", ")
+	stmt := fmt.Sprintf("SELECT %s FROM deliveries WHERE project=$1 AND name=$2 LIMIT 1", keystr)
+	rows, err := dbQuery(ctx, db, stmt, prj, name)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	if !rows.Next() {
+		return nil, rows.Err()
+	}
+	d, err := deliveryFromRows(rows)
+	if err != nil {
+		return nil, err
+	}
+	d.Items, err = deliveryItems(ctx, db, "project=$1 AND delivery=$2", prj, name)
+	if err != nil {
+		return nil, err
+	}
+	return d, nil
+}
+
+// ProjectDeliveries는 프로젝트의 납품들을 최근 순으로 반환한다.
+// 반환되는 납품의 항목은 채워지지 않는다. 항목이 필요하다면 GetDelivery를 사용해야 한다.
+func ProjectDeliveries(db *sql.DB, prj string) ([]*Delivery, error) {
+	return ProjectDeliveriesContext(context.Background(), db, prj)
+}
+
+// ProjectDeliveriesContext는 ctx를 받는 ProjectDeliveries이다.
+func ProjectDeliveriesContext(ctx context.Context, db *sql.DB, prj string) ([]*Delivery, error) {
+	keystr := strings.Join(DeliveryTableKeys, ", ")
+	stmt := fmt.Sprintf("SELECT %s FROM deliveries WHERE project=$1 ORDER BY created DESC, name", keystr)
+	rows, err := dbQuery(ctx, db, stmt, prj)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	ds := make([]*Delivery, 0)
+	for rows.Next() {
+		d, err := deliveryFromRows(rows)
+		if err != nil {
+			return nil, err
+		}
+		ds = append(ds, d)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return ds, nil
+}
+
+// LastShotDelivery는 샷이 마지막으로 포함된 클라이언트 납품을 반환한다. 외주 패키지는 제외된다.
+// 반환되는 납품의 항목에는 해당 샷의 항목만 들어있다.
+// 샷이 아직 납품된 적이 없다면 nil이 반환된다.
+func LastShotDelivery(db *sql.DB, prj, shot string) (*Delivery, error) {
+	return LastShotDeliveryContext(context.Background(), db, prj, shot)
+}
+
+// LastShotDeliveryContext는 ctx를 받는 LastShotDelivery이다.
+func LastShotDeliveryContext(ctx context.Context, db *sql.DB, prj, shot string) (*Delivery, error) {
+	keys := make([]string, len(DeliveryTableKeys))
+	for i, k := range DeliveryTableKeys {
+		keys[i] = "deliveries." + k
+	}
+	keystr := strings.Join(keys, ", ")
+	stmt := fmt.Sprintf(`SELECT %s FROM deliveries
+		WHERE deliveries.project=$1 AND deliveries.vendor='' AND EXISTS (
+			SELECT 1 FROM delivery_items
+			WHERE delivery_items.project = deliveries.project AND delivery_items.delivery = deliveries.name AND delivery_items.shot=$2
+		)
+		ORDER BY deliveries.created DESC LIMIT 1`, keystr)
+	rows, err := dbQuery(ctx, db, stmt, prj, shot)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	if !rows.Next() {
+		return nil, rows.Err()
+	}
+	d, err := deliveryFromRows(rows)
+	if err != nil {
+		return nil, err
+	}
+	d.Items, err = deliveryItems(ctx, db, "project=$1 AND delivery=$2 AND shot=$3", prj, d.Name, shot)
+	if err != nil {
+		return nil, err
+	}
+	return d, nil
+}
+
+// DeliveredVersions는 납품 항목들을 태스크별 버전으로 요약해 반환한다.
+// 한 버전의 여러 파일은 하나로 합쳐진다. 예) [CG_0010 comp v005, CG_0010 fx v003]
+func (d *Delivery) DeliveredVersions() []string {
+	vs := make([]string, 0)
+	has := make(map[string]bool)
+	for _, it := range d.Items {
+		v := fmt.Sprintf("%s %s v%03d", it.Shot, it.Task, it.Version)
+		if has[v] {
+			continue
+		}
+		has[v] = true
+		vs = append(vs, v)
+	}
+	return vs
+}
@@ -0,0 +1,206 @@
+package roi
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestDeliveryFileName(t *testing.T) {
+	tokens := PathTokens{Project: "TEST", Shot: "CG_0010", Task: "comp", Version: 3}
+	cases := []struct {
+		tmpl string
+		f    deliveryFile
+		want string
+		ok   bool
+	}{
+		{
+			tmpl: DefaultDeliveryNaming,
+			f:    deliveryFile{Src: "/show/TEST/CG_0010/comp.1001.exr", Frame: "1001", Base: "comp"},
+			want: "CG_0010/CG_0010_comp_v003.1001.exr",
+			ok:   true,
+		},
+		{
+			tmpl: DefaultDeliveryNaming,
+			f:    deliveryFile{Src: "/show/TEST/CG_0010/comp.mov", Base: "comp"},
+			want: "CG_0010/CG_0010_comp_v003.mov",
+			ok:   true,
+		},
+		{
+			tmpl: "{project}_{file}{ext}",
+			f:    deliveryFile{Src: "/show/TEST/CG_0010/comp.mov", Base: "comp"},
+			want: "TEST_comp.mov",
+			ok:   true,
+		},
+		{
+			tmpl: "{episode}/{shot}{ext}",
+			f:    deliveryFile{Src: "/show/TEST/CG_0010/comp.mov", Base: "comp"},
+			ok:   false,
+		},
+		{
+			tmpl: "../{shot}{ext}",
+			f:    deliveryFile{Src: "/show/TEST/CG_0010/comp.mov", Base: "comp"},
+			ok:   false,
+		},
+		{
+			tmpl: "/{shot}{ext}",
+			f:    deliveryFile{Src: "/show/TEST/CG_0010/comp.mov", Base: "comp"},
+			ok:   false,
+		},
+		{
+			tmpl: "{shot}_{client}{ext}",
+			f:    deliveryFile{Src: "/show/TEST/CG_0010/comp.mov", Base: "comp"},
+			ok:   false,
+		},
+	}
+	for _, c := range cases {
+		got, err := deliveryFileName(c.tmpl, tokens, c.f)
+		if (err == nil) != c.ok {
+			t.Fatalf("deliveryFileName(%q): got err %v, want ok %v", c.tmpl, err, c.ok)
+		}
+		if got != c.want {
+			t.Fatalf("deliveryFileName(%q): got %q, want %q", c.tmpl, got, c.want)
+		}
+	}
+}
+
+func TestDeliveryFiles(t *testing.T) {
+	dir, err := ioutil.TempDir("", "roi-delivery-")
+	if err != nil {
+		t.Fatalf("could not create temp dir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+	for _, f := range []string{"comp.1001.exr", "comp.1002.exr", "comp.mov"} {
+		if err := ioutil.WriteFile(filepath.Join(dir, f), []byte(f), 0644); err != nil {
+			t.Fatalf("could not write file: %v", err)
+		}
+	}
+	v := &Version{
+		OutputFiles: []string{filepath.Join(dir, "comp.%04d.exr")},
+		Mov:         filepath.Join(dir, "comp.mov"),
+	}
+	got, err := deliveryFiles(v)
+	if err != nil {
+		t.Fatalf("could not get delivery files: %v", err)
+	}
+	want := []deliveryFile{
+		{Src: filepath.Join(dir, "comp.1001.exr"), Frame: "1001", Base: "comp"},
+		{Src: filepath.Join(dir, "comp.1002.exr"), Frame: "1002", Base: "comp"},
+		{Src: filepath.Join(dir, "comp.mov"), Base: "comp"},
+	}
+	if len(got) != len(want) {
+		t.Fatalf("delivery files: got %v, want %v", got, want)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Fatalf("delivery files: got %v, want %v", got, want)
+		}
+	}
+}
+
+func TestDelivery(t *testing.T) {
+	db, err := testDB()
+	if err != nil {
+		t.Fatalf("could not connect to database: %v", err)
+	}
+	dir, err := ioutil.TempDir("", "roi-delivery-")
+	if err != nil {
+		t.Fatalf("could not create temp dir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+	deliveryRoots := DeliveryRoots
+	DeliveryRoots = []string{dir}
+	defer func() { DeliveryRoots = deliveryRoots }()
+	mov := filepath.Join(dir, "src", "fx_fire.mov")
+	if err := os.MkdirAll(filepath.Dir(mov), 0755); err != nil {
+		t.Fatalf("could not create source dir: %v", err)
+	}
+	if err := ioutil.WriteFile(mov, []byte("mov"), 0644); err != nil {
+		t.Fatalf("could not write source file: %v", err)
+	}
+
+	err = AddProject(db, testProject)
+	if err != nil {
+		t.Fatalf("could not add project: %v", err)
+	}
+	err = AddShot(db, testProject.Project, testShotA)
+	if err != nil {
+		t.Fatalf("could not add shot: %v", err)
+	}
+	err = AddTask(db, testProject.Project, testShotA.Shot, testTaskA)
+	if err != nil {
+		t.Fatalf("could not add task: %v", err)
+	}
+	v := &Version{Mov: mov, Created: time.Now()}
+	err = AddVersion(db, testProject.Project, testShotA.Shot, testTaskA.Task, v)
+	if err != nil {
+		t.Fatalf("could not add version: %v", err)
+	}
+	shots := []string{testShotA.Shot}
+	items, err := PlanDelivery(db, testProject.Project, shots, DefaultDeliveryNaming)
+	if err != nil {
+		t.Fatalf("could not plan delivery: %v", err)
+	}
+	if len(items) != 0 {
+		t.Fatalf("task not approved yet should not be delivered: %v", items)
+	}
+	err = UpdateTask(db, testProject.Project, testShotA.Shot, testTaskA.Task, UpdateTaskParam{Status: TaskDone, Assignee: testTaskA.Assignee})
+	if err != nil {
+		t.Fatalf("could not update task: %v", err)
+	}
+	items, err = PlanDelivery(db, testProject.Project, shots, DefaultDeliveryNaming)
+	if err != nil {
+		t.Fatalf("could not plan delivery: %v", err)
+	}
+	if len(items) != 1 || items[0].Dst != "CG_0010/CG_0010_fx_fire_v001.mov" {
+		t.Fatalf("unexpected delivery items: %v", items)
+	}
+	d := &Delivery{
+		Project: testProject.Project,
+		Name:    "20201019",
+		Dir:     filepath.Join(dir, "delivery", "20201019"),
+		Naming:  DefaultDeliveryNaming,
+		Mode:    DeliveryCopy,
+		Sender:  "supervisor",
+		Created: time.Now(),
+		Items:   items,
+	}
+	err = AddDelivery(db, d)
+	if err != nil {
+		t.Fatalf("could not add delivery: %v", err)
+	}
+	data, err := ioutil.ReadFile(filepath.Join(d.Dir, "CG_0010", "CG_0010_fx_fire_v001.mov"))
+	if err != nil {
+		t.Fatalf("could not read delivered file: %v", err)
+	}
+	if !bytes.Equal(data, []byte("mov")) {
+		t.Fatalf("delivered file content differs: %q", data)
+	}
+	for _, f := range []string{"manifest.csv", "manifest.xlsx"} {
+		if _, err := os.Stat(filepath.Join(d.Dir, f)); err != nil {
+			t.Fatalf("manifest not written: %v", err)
+		}
+	}
+	// 같은 이름으로 다시 납품할 수 없다.
+	err = AddDelivery(db, d)
+	if err == nil {
+		t.Fatalf("delivery with same name should not be added")
+	}
+	last, err := LastShotDelivery(db, testProject.Project, testShotA.Shot)
+	if err != nil {
+		t.Fatalf("could not get last shot delivery: %v", err)
+	}
+	if last == nil || last.Name != d.Name || len(last.Items) != 1 {
+		t.Fatalf("unexpected last shot delivery: %v", last)
+	}
+	if last.Items[0].Checksum == "" || last.Items[0].Size != 3 {
+		t.Fatalf("delivery item should have size and checksum: %v", last.Items[0])
+	}
+	err = DeleteProject(db, testProject.Project)
+	if err != nil {
+		t.Fatalf("could not delete project: %v", err)
+	}
+}
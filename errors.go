@@ -0,0 +1,53 @@
+package roi
+
+import (
+	"errors"
+	"fmt"
+)
+
+// 로이의 함수들이 반환하는 에러는 아래 에러 종류 중 하나로 분류된다.
+// 호출자는 errors.Is(err, roi.ErrNotFound)처럼 에러의 종류를 확인할 수 있다.
+// 어느 종류에도 속하지 않는 에러는 DB나 파일 시스템 등에서 생긴 내부 에러이다.
+//
+// Get으로 시작하는 함수들은 찾는 항목이 없을 때 에러 대신 nil을 반환한다.
+var (
+	// ErrNotFound는 찾거나 수정할 항목이 없다는 에러이다.
+	ErrNotFound = errors.New("not found")
+
+	// ErrExists는 추가할 항목이 이미 있다는 에러이다.
+	ErrExists = errors.New("already exists")
+
+	// ErrInvalid는 입력이 적절하지 않다는 에러이다.
+	// ValidationError도 이 종류에 속한다.
+	ErrInvalid = errors.New("invalid")
+
+	// ErrConflict는 입력은 적절하지만 현재 상태와 맞지 않아 처리할 수 없다는 에러이다.
+	// 예) 이미 발행된 리뷰 세션에 판정을 남기려 할 때
+	ErrConflict = errors.New("conflict")
+)
+
+// Error는 종류가 정해진 로이 에러이다.
+type Error struct {
+	// Kind는 ErrNotFound, ErrExists, ErrInvalid, ErrConflict 중 하나이다.
+	Kind error
+	Err  error
+}
+
+func (e *Error) Error() string {
+	return e.Err.Error()
+}
+
+// Is는 errors.Is가 에러의 종류를 찾을 수 있도록 한다.
+func (e *Error) Is(target error) bool {
+	return target == e.Kind
+}
+
+// Unwrap은 감싼 에러를 반환해 errors.Is와 errors.As가 그 에러도 찾을 수 있도록 한다.
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+// errorf는 kind 종류의 에러를 만든다. 포맷은 fmt.Errorf와 같다.
+func errorf(kind error, format string, a ...interface{}) error {
+	return &Error{Kind: kind, Err: fmt.Errorf(format, a...)}
+}
@@ -0,0 +1,87 @@
+package roi
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/lib/pq"
+)
+
+var errorKinds = []error{ErrNotFound, ErrExists, ErrInvalid, ErrConflict}
+
+// checkErrorKind는 err가 kind 종류의 에러이며 다른 종류에는 속하지 않는지 검사한다.
+// kind가 nil이면 err가 어느 종류에도 속하지 않아야 한다.
+func checkErrorKind(t *testing.T, err, kind error) {
+	t.Helper()
+	for _, k := range errorKinds {
+		if errors.Is(err, k) != (k == kind) {
+			t.Fatalf("%v: errors.Is(err, %v) should be %v", err, k, k == kind)
+		}
+	}
+}
+
+func TestErrorKind(t *testing.T) {
+	cause := errors.New("cause")
+	err := errorf(ErrNotFound, "shot not exist: %s", "TEST.CG_0010")
+	if err.Error() != "shot not exist: TEST.CG_0010" {
+		t.Fatalf("kind should not change the message: %v", err)
+	}
+	checkErrorKind(t, err, ErrNotFound)
+	// 감싼 에러에서도 종류를 알 수 있어야 한다.
+	checkErrorKind(t, fmt.Errorf("could not rename shot: %w", err), ErrNotFound)
+	// 종류를 가진 에러가 감싼 에러도 찾을 수 있어야 한다.
+	err = errorf(ErrInvalid, "invalid file in backup: %w", cause)
+	checkErrorKind(t, err, ErrInvalid)
+	if !errors.Is(err, cause) {
+		t.Fatalf("%v should wrap cause", err)
+	}
+	checkErrorKind(t, &ValidationError{Fields: []*FieldError{{Field: "shot", Msg: "invalid"}}}, ErrInvalid)
+	checkErrorKind(t, cause, nil)
+}
+
+func TestDBError(t *testing.T) {
+	cases := []struct {
+		code pq.ErrorCode
+		kind error
+	}{
+		{"23505", ErrExists},   // unique_violation
+		{"23503", ErrConflict}, // foreign_key_violation
+		{"40001", ErrConflict}, // serialization_failure
+		{"23514", ErrInvalid},  // check_violation
+		{"22001", ErrInvalid},  // string_data_right_truncation
+		{"53100", nil},         // disk_full
+	}
+	for _, c := range cases {
+		pqErr := &pq.Error{Code: c.code}
+		err := dbError(pqErr)
+		checkErrorKind(t, err, c.kind)
+		var e *pq.Error
+		if !errors.As(err, &e) || e != pqErr {
+			t.Fatalf("%s: db error should be kept", c.code)
+		}
+	}
+	if dbError(nil) != nil {
+		t.Fatalf("nil should stay nil")
+	}
+}
+
+func TestErrorKindFromDB(t *testing.T) {
+	db, err := testDB()
+	if err != nil {
+		t.Fatalf("could not connect to database: %v", err)
+	}
+	err = AddUser(db, "errkind", "errkind password")
+	if err != nil {
+		t.Fatalf("could not add user: %v", err)
+	}
+	defer DeleteUser(db, "errkind")
+	err = AddUser(db, "errkind", "errkind password")
+	checkErrorKind(t, err, ErrExists)
+	_, err = UserPasswordMatch(db, "errkind-not-exist", "password")
+	checkErrorKind(t, err, ErrNotFound)
+	err = AddUser(db, "1errkind", "errkind password")
+	checkErrorKind(t, err, ErrInvalid)
+	err = RenameShot(db, "errkind-not-exist", "CG_0010", "CG_0020")
+	checkErrorKind(t, err, ErrNotFound)
+}
@@ -1,5 +1,7 @@
 module github.com/studio2l/roi
 
+go 1.18
+
 require (
 	github.com/360EntSecGroup-Skylar/excelize v1.3.0
 	github.com/gorilla/securecookie v1.1.1
@@ -0,0 +1,525 @@
+package roi
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// 와치 폴더 인제스트는 아티스트가 정해진 폴더에 넣은 파일의 이름을 해석해
+// 해당 태스크의 버전으로 자동으로 등록한다.
+//
+// 파일 이름은 프로젝트의 인제스트 이름 템플릿(ProjectPaths.IngestNaming)에
+// [.<프레임>].<확장자> 가 붙은 형식을 따라야 한다.
+// 템플릿이 정해지지 않았다면 DefaultIngestNaming을 따른다.
+// 예) CG_0010_fx_v003.1001.exr, CG_0010_fx_fire_v003.mov
+//
+// 샷과 태스크 이름에 모두 언더바(_)가 쓰일 수 있기 때문에
+// 둘을 나누는 위치는 db에 실제로 존재하는 샷과 태스크로 정한다.
+//
+// 해석할 수 없거나 해당하는 샷, 태스크가 없는 파일은 격리 목록에 기록된다.
+// 격리 목록의 파일이 인제스트 폴더에서 사라지면 목록에서도 지워진다.
+
+// DefaultIngestNaming은 프로젝트의 인제스트 이름 템플릿이 정해지지 않았을 때 사용하는 템플릿이다.
+var DefaultIngestNaming = "{shot}_{task}_v{version}"
+
+// reIngestShotTask는 인제스트 이름 템플릿에서 샷과 태스크 사이의 구분자를 찾는다.
+var reIngestShotTask = regexp.MustCompile(`{shot}([^{}]+){task}`)
+
+// ingestNaming은 인제스트 이름 템플릿으로 만든 파일 이름 규칙이다.
+type ingestNaming struct {
+	re *regexp.Regexp
+	// sep는 파일 이름에서 샷과 태스크를 나누는 구분자이다.
+	sep string
+}
+
+// defaultIngestNaming은 DefaultIngestNaming으로 만든 파일 이름 규칙이다.
+var defaultIngestNaming = mustIngestNaming(DefaultIngestNaming, "")
+
+// mustIngestNaming은 newIngestNaming과 같지만 템플릿이 잘못되었으면 패닉을 일으킨다.
+func mustIngestNaming(tmpl, prj string) *ingestNaming {
+	n, err := newIngestNaming(tmpl, prj)
+	if err != nil {
+		panic(err)
+	}
+	return n
+}
+
+// newIngestNaming은 prj 프로젝트의 인제스트 이름 템플릿으로 파일 이름 규칙을 만든다.
+// 템플릿은 파일 이름에서 프레임과 확장자를 뺀 부분이며, 빈 템플릿은 DefaultIngestNaming이다.
+// {shot}<구분자>{task} 와 {version}이 한번씩 쓰여야 하며, {project}는 프로젝트 아이디로 바뀐다.
+func newIngestNaming(tmpl, prj string) (*ingestNaming, error) {
+	if tmpl == "" {
+		tmpl = DefaultIngestNaming
+	}
+	if strings.ContainsAny(tmpl, `/\`) {
+		return nil, errorf(ErrInvalid, "ingest naming template should be a file name: %s", tmpl)
+	}
+	st := reIngestShotTask.FindAllStringSubmatch(tmpl, -1)
+	if len(st) != 1 || strings.Count(tmpl, "{shot}") != 1 || strings.Count(tmpl, "{task}") != 1 {
+		return nil, errorf(ErrInvalid, "ingest naming template should have {shot} and {task} once with a separator between: %s", tmpl)
+	}
+	if strings.Count(tmpl, "{version}") != 1 {
+		return nil, errorf(ErrInvalid, "ingest naming template should have {version} once: %s", tmpl)
+	}
+	expr := "^"
+	i := 0
+	for _, m := range rePathToken.FindAllStringSubmatchIndex(tmpl, -1) {
+		expr += regexp.QuoteMeta(tmpl[i:m[0]])
+		i = m[1]
+		switch tok := tmpl[m[2]:m[3]]; tok {
+		case "project":
+			expr += regexp.QuoteMeta(prj)
+		case "shot":
+			expr += `(?P<name>[a-zA-Z][a-zA-Z0-9_]*`
+		case "task":
+			expr += `[a-zA-Z0-9_]+)`
+		case "version":
+			expr += `(?P<version>\d+)`
+		default:
+			return nil, errorf(ErrInvalid, "unknown token: {%s}", tok)
+		}
+	}
+	expr += regexp.QuoteMeta(tmpl[i:]) + `(?:[._](?P<frame>\d+))?\.[a-zA-Z0-9]+$`
+	re, err := regexp.Compile(expr)
+	if err != nil {
+		return nil, errorf(ErrInvalid, "invalid ingest naming template: %s", tmpl)
+	}
+	return &ingestNaming{re: re, sep: st[0][1]}, nil
+}
+
+// checkIngestNaming은 인제스트 이름 템플릿이 적절한지 검사한다. 빈 템플릿은 유효하다.
+func checkIngestNaming(tmpl string) error {
+	_, err := newIngestNaming(tmpl, "")
+	return err
+}
+
+// projectIngestNaming은 프로젝트의 인제스트 이름 템플릿으로 만든 파일 이름 규칙을 반환한다.
+func projectIngestNaming(ctx context.Context, db *sql.DB, prj string) (*ingestNaming, error) {
+	p, err := GetProjectPathsContext(ctx, db, prj)
+	if err != nil {
+		return nil, err
+	}
+	tmpl := ""
+	if p != nil {
+		tmpl = p.IngestNaming
+	}
+	return newIngestNaming(tmpl, prj)
+}
+
+// parse는 규칙에 맞는 파일 이름에서 <샷><구분자><태스크> 부분, 버전, 프레임을 얻는다.
+// 프레임이 없는 파일이면 frame은 빈 문자열이다. 규칙에 맞지 않으면 ok가 거짓이다.
+func (n *ingestNaming) parse(fname string) (name string, version int, frame string, ok bool) {
+	m := n.re.FindStringSubmatch(fname)
+	if m == nil {
+		return "", 0, "", false
+	}
+	v, err := strconv.Atoi(m[n.re.SubexpIndex("version")])
+	if err != nil || v <= 0 {
+		return "", 0, "", false
+	}
+	return m[n.re.SubexpIndex("name")], v, m[n.re.SubexpIndex("frame")], true
+}
+
+// ingestImageExts는 버전 이미지로 등록할 파일의 확장자이다.
+var ingestImageExts = map[string]bool{
+	"exr": true, "dpx": true, "tif": true, "tiff": true,
+	"jpg": true, "jpeg": true, "png": true,
+}
+
+// ingestMovExts는 버전 영상으로 등록할 파일의 확장자이다.
+var ingestMovExts = map[string]bool{
+	"mov": true, "mp4": true,
+}
+
+// IngestItem은 인제스트 폴더에서 찾은 하나의 파일 또는 이미지 시퀀스이다.
+type IngestItem struct {
+	// Path는 파일 경로이다. 이미지 시퀀스라면 CG_0010_fx_v003.####.exr 형식이다.
+	Path string
+	// Name은 파일 이름의 <샷><구분자><태스크> 부분이다.
+	Name    string
+	Version int
+	// Shot과 Task는 Name을 db의 샷과 태스크에 맞춰 나눈 것이다. 인제스트 된 항목에만 채워진다.
+	Shot string
+	Task string
+	// Frames는 이미지 시퀀스의 프레임 수이다. 하나의 파일이면 0이다.
+	Frames int
+	// ModTime은 파일들 중 가장 최근에 수정된 시간이다.
+	ModTime time.Time
+}
+
+// ParseIngestName은 DefaultIngestNaming 규칙에 맞는 파일 이름에서 <샷>_<태스크> 부분, 버전, 프레임을 얻는다.
+// 프레임이 없는 파일이면 frame은 빈 문자열이다. 규칙에 맞지 않으면 ok가 거짓이다.
+//
+// 예)
+//
+//	ParseIngestName("CG_0010_fx_v003.1001.exr") => "CG_0010_fx", 3, "1001", true
+func ParseIngestName(fname string) (name string, version int, frame string, ok bool) {
+	return defaultIngestNaming.parse(fname)
+}
+
+// splitShotTask는 <샷><구분자><태스크> 형식의 이름을 db에 존재하는 샷과 태스크로 나눈다.
+// 해당하는 태스크가 없다면 그 이유를 반환한다.
+func splitShotTask(ctx context.Context, db *sql.DB, prj, name, sep string) (*Task, string, error) {
+	shotFound := ""
+	for i := strings.Index(name, sep); i >= 0; {
+		shot, task := name[:i], name[i+len(sep):]
+		t, err := GetTaskContext(ctx, db, prj, shot, task)
+		if err != nil {
+			return nil, "", err
+		}
+		if t != nil {
+			return t, "", nil
+		}
+		if shotFound == "" {
+			exist, err := ShotExistContext(ctx, db, prj, shot)
+			if err != nil {
+				return nil, "", err
+			}
+			if exist {
+				shotFound = shot
+			}
+		}
+		j := strings.Index(name[i+len(sep):], sep)
+		if j < 0 {
+			break
+		}
+		i += j + len(sep)
+	}
+	if shotFound != "" {
+		return nil, fmt.Sprintf("task '%s' not exist in shot '%s'", strings.TrimPrefix(name, shotFound+sep), shotFound), nil
+	}
+	return nil, fmt.Sprintf("no shot matches '%s'", name), nil
+}
+
+// ScanIngestDir은 디렉토리 아래의 파일들을 DefaultIngestNaming 규칙에 따라 인제스트 항목으로 묶는다.
+// 같은 이름에 프레임만 다른 파일들은 하나의 이미지 시퀀스가 된다.
+// 규칙에 맞지 않는 파일은 unmatched로 반환된다. 숨김 파일은 무시한다.
+func ScanIngestDir(dir string) (items []*IngestItem, unmatched []string, err error) {
+	return scanIngestDir(dir, defaultIngestNaming)
+}
+
+// scanIngestDir은 n 규칙을 따르는 ScanIngestDir이다.
+func scanIngestDir(dir string, n *ingestNaming) (items []*IngestItem, unmatched []string, err error) {
+	seqs := make(map[string]*IngestItem)
+	items = make([]*IngestItem, 0)
+	unmatched = make([]string, 0)
+	err = filepath.Walk(dir, func(pth string, fi os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		name := fi.Name()
+		if strings.HasPrefix(name, ".") {
+			if fi.IsDir() && pth != dir {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if fi.IsDir() {
+			return nil
+		}
+		sname, version, frame, ok := n.parse(name)
+		if !ok {
+			unmatched = append(unmatched, pth)
+			return nil
+		}
+		if frame == "" {
+			items = append(items, &IngestItem{Path: pth, Name: sname, Version: version, ModTime: fi.ModTime()})
+			return nil
+		}
+		// 프레임 부분을 #으로 바꿔 시퀀스 경로를 만든다.
+		i := strings.LastIndex(name, frame)
+		seq := filepath.Join(filepath.Dir(pth), name[:i]+strings.Repeat("#", len(frame))+name[i+len(frame):])
+		it := seqs[seq]
+		if it == nil {
+			it = &IngestItem{Path: seq, Name: sname, Version: version}
+			seqs[seq] = it
+			items = append(items, it)
+		}
+		it.Frames++
+		if fi.ModTime().After(it.ModTime) {
+			it.ModTime = fi.ModTime()
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	sort.Slice(items, func(i, j int) bool {
+		return items[i].Path < items[j].Path
+	})
+	return items, unmatched, nil
+}
+
+// QuarantinedFile은 인제스트 할 수 없어 격리된 파일이다.
+type QuarantinedFile struct {
+	Project string
+	Path    string
+	Reason  string
+	Found   time.Time
+}
+
+var CreateTableIfNotExistsIngestQuarantineStmt = `CREATE TABLE IF NOT EXISTS ingest_quarantine (
+	uniqid UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+	project STRING NOT NULL CHECK (length(project) > 0) CHECK (project NOT LIKE '% %'),
+	path STRING NOT NULL CHECK (length(path) > 0),
+	reason STRING NOT NULL,
+	found TIMESTAMPTZ NOT NULL,
+	UNIQUE(project, path)
+)`
+
+// quarantine은 파일을 격리 목록에 기록한다. 이미 기록된 파일이면 이유만 갱신한다.
+func quarantine(ctx context.Context, db *sql.DB, prj, pth, reason string) error {
+	stmt := `INSERT INTO ingest_quarantine (project, path, reason, found) VALUES ($1, $2, $3, $4)
+		ON CONFLICT (project, path) DO UPDATE SET reason = excluded.reason`
+	if _, err := dbExec(ctx, db, stmt, prj, pth, reason, time.Now()); err != nil {
+		return fmt.Errorf("could not quarantine file: %w", err)
+	}
+	return nil
+}
+
+// DeleteQuarantinedFile은 파일을 격리 목록에서 지운다.
+// 파일이 목록에 없어도 에러를 내지 않는다.
+func DeleteQuarantinedFile(db *sql.DB, prj, pth string) error {
+	return DeleteQuarantinedFileContext(context.Background(), db, prj, pth)
+}
+
+// DeleteQuarantinedFileContext는 ctx를 받는 DeleteQuarantinedFile이다.
+func DeleteQuarantinedFileContext(ctx context.Context, db *sql.DB, prj, pth string) error {
+	if _, err := dbExec(ctx, db, "DELETE FROM ingest_quarantine WHERE project=$1 AND path=$2", prj, pth); err != nil {
+		return fmt.Errorf("could not delete data from 'ingest_quarantine' table: %w", err)
+	}
+	return nil
+}
+
+// pruneQuarantine은 dir 아래의 격리된 파일 중 이번 검사에서 찾지 못한,
+// 즉 지워지거나 옮겨진 파일을 격리 목록에서 지운다.
+func pruneQuarantine(ctx context.Context, db *sql.DB, prj, dir string, found map[string]bool) error {
+	qs, err := QuarantinedFilesContext(ctx, db, prj)
+	if err != nil {
+		return err
+	}
+	for _, q := range qs {
+		if found[q.Path] || !inDir(dir, q.Path) {
+			continue
+		}
+		if err := DeleteQuarantinedFileContext(ctx, db, prj, q.Path); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// QuarantinedFiles는 프로젝트의 격리된 파일들을 경로 순서로 반환한다.
+func QuarantinedFiles(db *sql.DB, prj string) ([]*QuarantinedFile, error) {
+	return QuarantinedFilesContext(context.Background(), db, prj)
+}
+
+// QuarantinedFilesContext는 ctx를 받는 QuarantinedFiles이다.
+func QuarantinedFilesContext(ctx context.Context, db *sql.DB, prj string) ([]*QuarantinedFile, error) {
+	rows, err := dbQuery(ctx, db, "SELECT project, path, reason, found FROM ingest_quarantine WHERE project=$1 ORDER BY path", prj)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	qs := make([]*QuarantinedFile, 0)
+	for rows.Next() {
+		q := &QuarantinedFile{}
+		if err := rows.Scan(&q.Project, &q.Path, &q.Reason, &q.Found); err != nil {
+			return nil, err
+		}
+		qs = append(qs, q)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return qs, nil
+}
+
+// ingestVersion은 같은 샷, 태스크, 버전의 인제스트 항목들로 버전을 만든다.
+func ingestVersion(prj, shot, task string, items []*IngestItem) *Version {
+	v := &Version{
+		Project:     prj,
+		Shot:        shot,
+		Task:        task,
+		OutputFiles: make([]string, 0),
+		Images:      make([]string, 0),
+	}
+	for _, it := range items {
+		if it.ModTime.After(v.Created) {
+			v.Created = it.ModTime
+		}
+		ext := strings.ToLower(strings.TrimPrefix(filepath.Ext(it.Path), "."))
+		switch {
+		case ingestMovExts[ext] && v.Mov == "":
+			v.Mov = it.Path
+		case ingestImageExts[ext]:
+			v.OutputFiles = append(v.OutputFiles, it.Path)
+			v.Images = append(v.Images, it.Path)
+		default:
+			v.OutputFiles = append(v.OutputFiles, it.Path)
+		}
+	}
+	return v
+}
+
+// Ingest는 디렉토리의 파일들을 프로젝트의 버전으로 등록하고, 등록된 항목을 반환한다.
+// 샷, 태스크, 버전이 같은 항목들(예를 들어 exr 시퀀스와 mov)은 하나의 버전으로 등록된다.
+//
+// 마지막 수정 후 settle 만큼의 시간이 지나지 않은 항목이 있는 버전은 아직 쓰여지고 있다고 보고 건너뛴다.
+// 파일 이름의 버전이 이미 등록되어 있고 그 버전이 해당 파일을 포함하면 이미 인제스트 된 것으로 보고 건너뛴다.
+// 그 외에 등록할 수 없는 항목은 격리 목록에 기록되며, 이후 등록에 성공하면 목록에서 지워진다.
+func Ingest(db *sql.DB, prj, dir string, settle time.Duration) ([]*IngestItem, error) {
+	return IngestContext(context.Background(), db, prj, dir, settle)
+}
+
+// IngestContext는 ctx를 받는 Ingest이다.
+func IngestContext(ctx context.Context, db *sql.DB, prj, dir string, settle time.Duration) ([]*IngestItem, error) {
+	return ingestDir(ctx, db, prj, dir, settle, "")
+}
+
+// ingestDir은 Ingest와 IngestVendorReturn의 실제 처리를 한다.
+// vendor가 빈 문자열이 아니라면 해당 외주 업체에 배정된 태스크의 파일만 등록한다.
+func ingestDir(ctx context.Context, db *sql.DB, prj, dir string, settle time.Duration, vendor string) ([]*IngestItem, error) {
+	n, err := projectIngestNaming(ctx, db, prj)
+	if err != nil {
+		return nil, err
+	}
+	items, unmatched, err := scanIngestDir(dir, n)
+	if err != nil {
+		return nil, err
+	}
+	found := make(map[string]bool)
+	for _, pth := range unmatched {
+		found[pth] = true
+	}
+	for _, it := range items {
+		found[it.Path] = true
+	}
+	if err := pruneQuarantine(ctx, db, prj, dir, found); err != nil {
+		return nil, err
+	}
+	for _, pth := range unmatched {
+		if err := quarantine(ctx, db, prj, pth, "file name does not match naming convention"); err != nil {
+			return nil, err
+		}
+	}
+	groups := make(map[string][]*IngestItem)
+	keys := make([]string, 0)
+	for _, it := range items {
+		k := fmt.Sprintf("%s_v%03d", it.Name, it.Version)
+		if groups[k] == nil {
+			keys = append(keys, k)
+		}
+		groups[k] = append(groups[k], it)
+	}
+	ingested := make([]*IngestItem, 0)
+	now := time.Now()
+	for _, k := range keys {
+		g := groups[k]
+		settled := true
+		for _, it := range g {
+			if now.Sub(it.ModTime) < settle {
+				settled = false
+			}
+		}
+		if !settled {
+			continue
+		}
+		reason, err := ingestItems(ctx, db, prj, vendor, n.sep, g)
+		if err != nil {
+			return nil, err
+		}
+		if reason == reasonAlreadyIngested {
+			continue
+		}
+		for _, it := range g {
+			if reason == "" {
+				err = DeleteQuarantinedFileContext(ctx, db, prj, it.Path)
+			} else {
+				err = quarantine(ctx, db, prj, it.Path, reason)
+			}
+			if err != nil {
+				return nil, err
+			}
+		}
+		if reason == "" {
+			ingested = append(ingested, g...)
+		}
+	}
+	return ingested, nil
+}
+
+// reasonAlreadyIngested는 ingestItems가 이미 인제스트 된 항목을 만났을 때 반환하는 이유이다.
+const reasonAlreadyIngested = "already ingested"
+
+// ingestItems는 같은 샷, 태스크, 버전의 인제스트 항목들을 하나의 버전으로 등록한다.
+// vendor가 빈 문자열이 아니라면 해당 외주 업체에 배정된 태스크일 때만 등록하고,
+// 등록된 버전을 외주 태스크의 마지막으로 받은 버전으로 기록한다.
+// sep는 항목 이름에서 샷과 태스크를 나누는 구분자이다.
+// 등록할 수 없는 이유가 있다면 그 이유를 반환한다.
+func ingestItems(ctx context.Context, db *sql.DB, prj, vendor, sep string, items []*IngestItem) (string, error) {
+	it := items[0]
+	t, reason, err := splitShotTask(ctx, db, prj, it.Name, sep)
+	if err != nil {
+		return "", err
+	}
+	if t == nil {
+		return reason, nil
+	}
+	if vendor != "" {
+		vt, err := GetVendorTaskContext(ctx, db, prj, t.Shot, t.Task)
+		if err != nil {
+			return "", err
+		}
+		if vt == nil || vt.Vendor != vendor {
+			return fmt.Sprintf("task '%s.%s' is not assigned to vendor '%s'", t.Shot, t.Task, vendor), nil
+		}
+	}
+	if it.Version <= t.LastOutputVersion {
+		old, err := GetVersionContext(ctx, db, prj, t.Shot, t.Task, it.Version)
+		if err != nil {
+			return "", err
+		}
+		if old != nil {
+			for _, f := range append(append([]string{old.Mov}, old.OutputFiles...), old.Images...) {
+				for _, it := range items {
+					if f == it.Path {
+						return reasonAlreadyIngested, nil
+					}
+				}
+			}
+		}
+		return fmt.Sprintf("version v%03d already exists", it.Version), nil
+	}
+	if it.Version != t.LastOutputVersion+1 {
+		return fmt.Sprintf("next version is v%03d", t.LastOutputVersion+1), nil
+	}
+	v := ingestVersion(prj, t.Shot, t.Task, items)
+	if err := AddExpectedVersionContext(ctx, db, prj, t.Shot, t.Task, it.Version, v); err != nil {
+		// 다른 곳에서 먼저 버전이 추가되었거나 항목이 적절하지 않을 때만 격리한다.
+		// 데이터베이스 에러 등은 인제스트 자체를 실패시켜야 한다.
+		if errors.Is(err, ErrExists) || errors.Is(err, ErrConflict) || errors.Is(err, ErrInvalid) {
+			return err.Error(), nil
+		}
+		return "", err
+	}
+	if vendor != "" {
+		if _, err := dbExec(ctx, db, "UPDATE vendor_tasks SET returned=$1, returned_version=$2 WHERE project=$3 AND shot=$4 AND task=$5", time.Now(), v.Version, prj, t.Shot, t.Task); err != nil {
+			return "", fmt.Errorf("could not update vendor task: %w", err)
+		}
+	}
+	for _, it := range items {
+		it.Shot = t.Shot
+		it.Task = t.Task
+	}
+	return "", nil
+}
@@ -0,0 +1,201 @@
+package roi
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestParseIngestName(t *testing.T) {
+	cases := []struct {
+		fname   string
+		name    string
+		version int
+		frame   string
+		ok      bool
+	}{
+		{fname: "CG_0010_fx_v003.1001.exr", name: "CG_0010_fx", version: 3, frame: "1001", ok: true},
+		{fname: "CG_0010_fx_fire_v012_0001.dpx", name: "CG_0010_fx_fire", version: 12, frame: "0001", ok: true},
+		{fname: "CG_0010_fx_v003.mov", name: "CG_0010_fx", version: 3, ok: true},
+		{fname: "CG_0010_fx.mov", ok: false},
+		{fname: "CG_0010_fx_v000.mov", ok: false},
+		{fname: "fx_v001", ok: false},
+	}
+	for _, c := range cases {
+		name, version, frame, ok := ParseIngestName(c.fname)
+		if ok != c.ok || name != c.name || version != c.version || frame != c.frame {
+			t.Fatalf("ParseIngestName(%q): got (%q, %d, %q, %v)", c.fname, name, version, frame, ok)
+		}
+	}
+}
+
+func TestIngestNaming(t *testing.T) {
+	cases := []struct {
+		tmpl    string
+		fname   string
+		name    string
+		sep     string
+		version int
+		frame   string
+		ok      bool
+	}{
+		{tmpl: "", fname: "CG_0010_fx_v003.1001.exr", name: "CG_0010_fx", sep: "_", version: 3, frame: "1001", ok: true},
+		{tmpl: "{shot}.{task}.v{version}", fname: "CG_0010.fx_fire.v012.0001.dpx", name: "CG_0010.fx_fire", sep: ".", version: 12, frame: "0001", ok: true},
+		{tmpl: "{shot}.{task}.v{version}", fname: "CG_0010_fx_fire_v012.mov", sep: ".", ok: false},
+		{tmpl: "{project}_{shot}-{task}_{version}", fname: "TEST_CG_0010-fx_003.mov", name: "CG_0010-fx", sep: "-", version: 3, ok: true},
+		{tmpl: "{project}_{shot}-{task}_{version}", fname: "OTHER_CG_0010-fx_003.mov", sep: "-", ok: false},
+	}
+	for _, c := range cases {
+		n, err := newIngestNaming(c.tmpl, "TEST")
+		if err != nil {
+			t.Fatalf("newIngestNaming(%q): %v", c.tmpl, err)
+		}
+		if n.sep != c.sep {
+			t.Fatalf("newIngestNaming(%q): separator: got %q, want %q", c.tmpl, n.sep, c.sep)
+		}
+		name, version, frame, ok := n.parse(c.fname)
+		if ok != c.ok || name != c.name || version != c.version || frame != c.frame {
+			t.Fatalf("%q.parse(%q): got (%q, %d, %q, %v)", c.tmpl, c.fname, name, version, frame, ok)
+		}
+	}
+	invalid := []string{
+		"{shot}{task}_v{version}",
+		"{shot}_{task}",
+		"{shot}_{task}_v{version}_{version}",
+		"{shot}_{shot}_{task}_v{version}",
+		"{task}_{shot}_v{version}",
+		"{shot}_{task}_{episode}_v{version}",
+		"{shot}/{task}_v{version}",
+	}
+	for _, tmpl := range invalid {
+		err := checkIngestNaming(tmpl)
+		checkErrorKind(t, err, ErrInvalid)
+	}
+}
+
+func TestScanIngestDir(t *testing.T) {
+	tmpd, err := ioutil.TempDir("", "roi-ingest-test-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmpd)
+	for _, f := range []string{
+		"CG_0010_fx_v003.1001.exr",
+		"CG_0010_fx_v003.1002.exr",
+		"CG_0010_fx_v003.mov",
+		"readme.txt",
+		".DS_Store",
+	} {
+		if err := ioutil.WriteFile(filepath.Join(tmpd, f), []byte{}, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	items, unmatched, err := ScanIngestDir(tmpd)
+	if err != nil {
+		t.Fatalf("could not scan ingest dir: %v", err)
+	}
+	if len(items) != 2 {
+		t.Fatalf("invalid number of ingest items: want 2, got %d", len(items))
+	}
+	seq := items[0]
+	if seq.Path != filepath.Join(tmpd, "CG_0010_fx_v003.####.exr") || seq.Frames != 2 {
+		t.Fatalf("unexpected image sequence item: %v", seq)
+	}
+	if len(unmatched) != 1 || unmatched[0] != filepath.Join(tmpd, "readme.txt") {
+		t.Fatalf("unexpected unmatched files: %v", unmatched)
+	}
+	v := ingestVersion("TEST", "CG_0010", "fx", items)
+	if v.Mov != items[1].Path || len(v.Images) != 1 || v.Images[0] != seq.Path {
+		t.Fatalf("unexpected ingest version: %v", v)
+	}
+}
+
+func TestIngest(t *testing.T) {
+	db, err := testDB()
+	if err != nil {
+		t.Fatalf("could not connect to database: %v", err)
+	}
+	tmpd, err := ioutil.TempDir("", "roi-ingest-test-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmpd)
+	for _, f := range []string{
+		testTaskA.Shot + "_" + testTaskA.Task + "_v001.mov",
+		testTaskA.Shot + "_lit_v001.mov",
+	} {
+		if err := ioutil.WriteFile(filepath.Join(tmpd, f), []byte{}, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	err = AddProject(db, testProject)
+	if err != nil {
+		t.Fatalf("could not add project: %v", err)
+	}
+	err = AddShot(db, testProject.Project, testShotA)
+	if err != nil {
+		t.Fatalf("could not add shot: %v", err)
+	}
+	err = AddTask(db, testProject.Project, testShotA.Shot, testTaskA)
+	if err != nil {
+		t.Fatalf("could not add task: %v", err)
+	}
+	// 방금 수정된 파일은 아직 쓰여지고 있을 수 있으므로 인제스트 되지 않아야 한다.
+	items, err := Ingest(db, testProject.Project, tmpd, time.Hour)
+	if err != nil {
+		t.Fatalf("could not ingest: %v", err)
+	}
+	if len(items) != 0 {
+		t.Fatalf("unsettled files should not be ingested: %v", items)
+	}
+	items, err = Ingest(db, testProject.Project, tmpd, 0)
+	if err != nil {
+		t.Fatalf("could not ingest: %v", err)
+	}
+	if len(items) != 1 || items[0].Task != testTaskA.Task {
+		t.Fatalf("unexpected ingested items: %v", items)
+	}
+	exist, err := VersionExist(db, testProject.Project, testShotA.Shot, testTaskA.Task, 1)
+	if err != nil {
+		t.Fatalf("could not check version exist: %v", err)
+	}
+	if !exist {
+		t.Fatalf("ingested version not exist")
+	}
+	qs, err := QuarantinedFiles(db, testProject.Project)
+	if err != nil {
+		t.Fatalf("could not get quarantined files: %v", err)
+	}
+	if len(qs) != 1 {
+		t.Fatalf("invalid number of quarantined files: want 1, got %d", len(qs))
+	}
+	// 인제스트 폴더에서 사라진 파일은 격리 목록에서도 지워져야 한다.
+	if err := os.Remove(qs[0].Path); err != nil {
+		t.Fatal(err)
+	}
+	_, err = Ingest(db, testProject.Project, tmpd, 0)
+	if err != nil {
+		t.Fatalf("could not ingest: %v", err)
+	}
+	qs, err = QuarantinedFiles(db, testProject.Project)
+	if err != nil {
+		t.Fatalf("could not get quarantined files: %v", err)
+	}
+	if len(qs) != 0 {
+		t.Fatalf("removed file should not be quarantined: %v", qs)
+	}
+	// 이미 인제스트 된 파일은 다시 인제스트 되지 않아야 한다.
+	items, err = Ingest(db, testProject.Project, tmpd, 0)
+	if err != nil {
+		t.Fatalf("could not ingest: %v", err)
+	}
+	if len(items) != 0 {
+		t.Fatalf("files should not be ingested twice: %v", items)
+	}
+	err = DeleteProject(db, testProject.Project)
+	if err != nil {
+		t.Fatalf("could not delete project: %v", err)
+	}
+}
@@ -0,0 +1,403 @@
+package roi
+
+import (
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+)
+
+// FileStatus는 버전에 등록된 파일의 무결성 상태이다.
+type FileStatus string
+
+const (
+	FileOK       = FileStatus("ok")
+	FileMissing  = FileStatus("missing")
+	FileModified = FileStatus("modified")
+)
+
+// UIString은 UI안에서 사용하는 현지화된 문자열이다.
+func (s FileStatus) UIString() string {
+	switch s {
+	case FileOK:
+		return "정상"
+	case FileMissing:
+		return "없음"
+	case FileModified:
+		return "변경됨"
+	}
+	return ""
+}
+
+// UIColor는 UI안에서 사용하는 색상이다.
+func (s FileStatus) UIColor() string {
+	switch s {
+	case FileOK:
+		return "green"
+	case FileMissing:
+		return "red"
+	case FileModified:
+		return "orange"
+	}
+	return ""
+}
+
+// VersionFile은 버전에 등록된 파일 하나의 등록 당시 정보와 마지막 검사 결과이다.
+type VersionFile struct {
+	Project string
+	Shot    string
+	Task    string
+	Version int
+
+	Path string
+	// Size, ModTime, Checksum은 버전이 등록될 때의 파일 정보이다.
+	// 등록할 때 파일이 없었다면 Checksum은 빈 문자열이다.
+	Size     int64
+	ModTime  time.Time
+	Checksum string
+
+	Status  FileStatus
+	Checked time.Time
+}
+
+func (f *VersionFile) dbValues() []interface{} {
+	if f == nil {
+		f = &VersionFile{}
+	}
+	return []interface{}{
+		f.Project,
+		f.Shot,
+		f.Task,
+		f.Version,
+		f.Path,
+		f.Size,
+		f.ModTime,
+		f.Checksum,
+		f.Status,
+		f.Checked,
+	}
+}
+
+var CreateTableIfNotExistsVersionFilesStmt = `CREATE TABLE IF NOT EXISTS version_files (
+	uniqid UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+	project STRING NOT NULL CHECK (length(project) > 0) CHECK (project NOT LIKE '% %'),
+	shot STRING NOT NULL CHECK (length(shot) > 0) CHECK (shot NOT LIKE '% %'),
+	task STRING NOT NULL CHECK (length(task) > 0) CHECK (task NOT LIKE '% %'),
+	version INT NOT NULL,
+	path STRING NOT NULL CHECK (length(path) > 0),
+	size INT NOT NULL,
+	mod_time TIMESTAMPTZ NOT NULL,
+	checksum STRING NOT NULL,
+	status STRING NOT NULL,
+	checked TIMESTAMPTZ NOT NULL,
+	UNIQUE(project, shot, task, version, path)
+)`
+
+var VersionFileTableKeys = []string{
+	"project",
+	"shot",
+	"task",
+	"version",
+	"path",
+	"size",
+	"mod_time",
+	"checksum",
+	"status",
+	"checked",
+}
+
+var VersionFileTableIndices = dbIndices(VersionFileTableKeys)
+
+// FileChecksum은 파일 내용의 sha256 해시를 16진수 문자열로 반환한다.
+func FileChecksum(pth string) (string, error) {
+	f, err := os.Open(pth)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// versionFilePaths는 버전에서 무결성을 검사할 파일 경로들을 반환한다.
+// 결과물과 이미지가 대상이며, 이미지 시퀀스는 각 프레임으로 펼친다.
+func versionFilePaths(v *Version) []string {
+	pths := make([]string, 0, len(v.OutputFiles)+len(v.Images))
+	has := make(map[string]bool)
+	for _, p := range append(append([]string{}, v.OutputFiles...), expandImages(v.Images)...) {
+		if p == "" || has[p] || IsImageSequence(p) {
+			continue
+		}
+		has[p] = true
+		pths = append(pths, p)
+	}
+	return pths
+}
+
+// statVersionFile은 디스크의 파일 정보로 VersionFile을 만든다.
+// 파일이 없다면 상태가 FileMissing인 VersionFile을 반환한다.
+func statVersionFile(v *Version, pth string, now time.Time) (*VersionFile, error) {
+	f := &VersionFile{
+		Project: v.Project,
+		Shot:    v.Shot,
+		Task:    v.Task,
+		Version: v.Version,
+		Path:    pth,
+		Status:  FileMissing,
+		Checked: now,
+	}
+	fi, err := os.Stat(pth)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return f, nil
+		}
+		return nil, err
+	}
+	sum, err := FileChecksum(pth)
+	if err != nil {
+		return nil, err
+	}
+	f.Size = fi.Size()
+	f.ModTime = fi.ModTime()
+	f.Checksum = sum
+	f.Status = FileOK
+	return f, nil
+}
+
+// statVersionFiles는 pths의 파일 정보로 VersionFile들을 만든다.
+// 해시 계산은 오래 걸릴 수 있으므로 트랜잭션을 시작하기 전에 호출해야 한다.
+func statVersionFiles(v *Version, pths []string) ([]*VersionFile, error) {
+	now := time.Now()
+	files := make([]*VersionFile, 0, len(pths))
+	for _, pth := range pths {
+		f, err := statVersionFile(v, pth, now)
+		if err != nil {
+			return nil, fmt.Errorf("could not stat version file: %w", err)
+		}
+		files = append(files, f)
+	}
+	return files, nil
+}
+
+// verifyChecksums는 checksums에 담긴 해시가 서버에서 읽은 버전 파일의 해시와 같은지 확인한다.
+// files는 statVersionFiles로 만든 버전 파일 정보이며, 여기에 없는 영상과 작업 파일은 새로 해시를 계산한다.
+func verifyChecksums(v *Version, files []*VersionFile, checksums map[string]string) error {
+	if len(checksums) == 0 {
+		return nil
+	}
+	recorded := make(map[string]*VersionFile)
+	for _, f := range files {
+		recorded[f.Path] = f
+	}
+	others := make(map[string]bool)
+	for _, p := range []string{v.Mov, v.WorkFile} {
+		if p != "" {
+			others[p] = true
+		}
+	}
+	for pth, want := range checksums {
+		var got string
+		if f, ok := recorded[pth]; ok {
+			if f.Status == FileMissing {
+				return errorf(ErrInvalid, "version file not found on server: %s", pth)
+			}
+			got = f.Checksum
+		} else if others[pth] {
+			sum, err := FileChecksum(pth)
+			if err != nil {
+				if os.IsNotExist(err) {
+					return errorf(ErrInvalid, "version file not found on server: %s", pth)
+				}
+				return err
+			}
+			got = sum
+		} else {
+			return errorf(ErrInvalid, "checksum of a file not in the version: %s", pth)
+		}
+		if got != want {
+			return errorf(ErrConflict, "checksum mismatch: %s", pth)
+		}
+	}
+	return nil
+}
+
+// insertVersionFiles는 트랜잭션 안에서 버전 파일 정보들을 기록한다.
+// 같은 경로의 정보가 이미 기록되어 있다면 원래의 기록을 유지한다.
+func insertVersionFiles(ctx context.Context, tx *sql.Tx, files []*VersionFile) error {
+	keystr := strings.Join(VersionFileTableKeys, ", ")
+	idxstr := strings.Join(VersionFileTableIndices, ", ")
+	stmt := fmt.Sprintf("INSERT INTO version_files (%s) VALUES (%s) ON CONFLICT (project, shot, task, version, path) DO NOTHING", keystr, idxstr)
+	for _, f := range files {
+		if _, err := dbExec(ctx, tx, stmt, f.dbValues()...); err != nil {
+			return fmt.Errorf("could not insert version file: %w", err)
+		}
+	}
+	return nil
+}
+
+// RecordVersionFiles는 버전의 결과물과 이미지 파일의 크기, 수정 시간, 해시를 새로 기록한다.
+// 이전에 기록된 정보는 지워지므로, 파일이 의도적으로 교체되었을 때만 호출해야 한다.
+// 버전을 추가하거나 수정할 때는 AddVersion과 UpdateVersion이 새로 등록된 경로의 파일만 기록한다.
+// 기록할 때 이미 없는 파일은 FileMissing 상태로 기록된다.
+func RecordVersionFiles(db *sql.DB, v *Version) error {
+	return RecordVersionFilesContext(context.Background(), db, v)
+}
+
+// RecordVersionFilesContext는 ctx를 받는 RecordVersionFiles이다.
+func RecordVersionFilesContext(ctx context.Context, db *sql.DB, v *Version) error {
+	if v == nil {
+		return errorf(ErrInvalid, "nil version")
+	}
+	files, err := statVersionFiles(v, versionFilePaths(v))
+	if err != nil {
+		return err
+	}
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("could not begin a transaction: %w", err)
+	}
+	defer tx.Rollback() // 트랜잭션이 완료되지 않았을 때만 실행됨
+	_, err = dbExec(ctx, tx, "DELETE FROM version_files WHERE project=$1 AND shot=$2 AND task=$3 AND version=$4", v.Project, v.Shot, v.Task, v.Version)
+	if err != nil {
+		return fmt.Errorf("could not delete data from 'version_files' table: %w", err)
+	}
+	if err := insertVersionFiles(ctx, tx, files); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// versionFileFromRows는 테이블의 한 열에서 버전 파일 정보를 받아온다.
+func versionFileFromRows(rows *sql.Rows) (*VersionFile, error) {
+	f := &VersionFile{}
+	err := rows.Scan(
+		&f.Project, &f.Shot, &f.Task, &f.Version, &f.Path,
+		&f.Size, &f.ModTime, &f.Checksum, &f.Status, &f.Checked,
+	)
+	if err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+// queryVersionFiles는 where 조건에 맞는 버전 파일들을 반환한다.
+func queryVersionFiles(ctx context.Context, db *sql.DB, where string, args ...interface{}) ([]*VersionFile, error) {
+	keystr := strings.Join(VersionFileTableKeys, ", ")
+	stmt := fmt.Sprintf("SELECT %s FROM version_files WHERE %s ORDER BY shot, task, version, path", keystr, where)
+	rows, err := dbQuery(ctx, db, stmt, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	files := make([]*VersionFile, 0)
+	for rows.Next() {
+		f, err := versionFileFromRows(rows)
+		if err != nil {
+			return nil, err
+		}
+		files = append(files, f)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return files, nil
+}
+
+// VersionFiles는 버전에 기록된 파일 정보들을 반환한다.
+func VersionFiles(db *sql.DB, prj, shot, task string, version int) ([]*VersionFile, error) {
+	return VersionFilesContext(context.Background(), db, prj, shot, task, version)
+}
+
+// VersionFilesContext는 ctx를 받는 VersionFiles이다.
+func VersionFilesContext(ctx context.Context, db *sql.DB, prj, shot, task string, version int) ([]*VersionFile, error) {
+	return queryVersionFiles(ctx, db, "project=$1 AND shot=$2 AND task=$3 AND version=$4", prj, shot, task, version)
+}
+
+// VersionIntegrity는 버전 파일들의 마지막 검사 결과를 하나의 상태로 요약한다.
+// 파일 중 하나라도 없다면 FileMissing, 수정되었다면 FileModified이다.
+// 기록된 파일이 없다면 빈 상태를 반환한다.
+func VersionIntegrity(files []*VersionFile) FileStatus {
+	if len(files) == 0 {
+		return ""
+	}
+	st := FileOK
+	for _, f := range files {
+		if f.Status == FileMissing {
+			return FileMissing
+		}
+		if f.Status == FileModified {
+			st = FileModified
+		}
+	}
+	return st
+}
+
+// checkVersionFile은 파일을 다시 검사해 상태를 반환한다.
+// 크기와 수정 시간이 같으면 해시를 다시 계산하지 않는다.
+func checkVersionFile(f *VersionFile) (FileStatus, error) {
+	fi, err := os.Stat(f.Path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return FileMissing, nil
+		}
+		return "", err
+	}
+	if f.Checksum == "" {
+		// 등록할 때 없던 파일이 나중에 생겼다. 등록된 내용과 같은지 알 수 없다.
+		return FileModified, nil
+	}
+	if fi.Size() == f.Size && fi.ModTime().Equal(f.ModTime) {
+		return FileOK, nil
+	}
+	if fi.Size() != f.Size {
+		return FileModified, nil
+	}
+	sum, err := FileChecksum(f.Path)
+	if err != nil {
+		return "", err
+	}
+	if sum != f.Checksum {
+		return FileModified, nil
+	}
+	return FileOK, nil
+}
+
+// VerifyVersionFiles는 프로젝트에 기록된 모든 버전 파일을 다시 검사해 상태를 갱신하고,
+// 없거나 수정된 파일들을 반환한다. prj가 빈 문자열이면 모든 프로젝트를 검사한다.
+func VerifyVersionFiles(db *sql.DB, prj string) ([]*VersionFile, error) {
+	return VerifyVersionFilesContext(context.Background(), db, prj)
+}
+
+// VerifyVersionFilesContext는 ctx를 받는 VerifyVersionFiles이다.
+func VerifyVersionFilesContext(ctx context.Context, db *sql.DB, prj string) ([]*VersionFile, error) {
+	files, err := queryVersionFiles(ctx, db, "($1 = '' OR project=$1)", prj)
+	if err != nil {
+		return nil, err
+	}
+	bad := make([]*VersionFile, 0)
+	for _, f := range files {
+		st, err := checkVersionFile(f)
+		if err != nil {
+			return nil, fmt.Errorf("could not check version file %s: %w", f.Path, err)
+		}
+		f.Status = st
+		f.Checked = time.Now()
+		_, err = dbExec(ctx, db, "UPDATE version_files SET (status, checked) = ($1, $2) WHERE project=$3 AND shot=$4 AND task=$5 AND version=$6 AND path=$7",
+			f.Status, f.Checked, f.Project, f.Shot, f.Task, f.Version, f.Path)
+		if err != nil {
+			return nil, fmt.Errorf("could not update version file status: %w", err)
+		}
+		if st != FileOK {
+			bad = append(bad, f)
+		}
+	}
+	return bad, nil
+}
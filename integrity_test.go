@@ -0,0 +1,239 @@
+package roi
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestCheckVersionFile(t *testing.T) {
+	tmpd, err := ioutil.TempDir("", "roi-integrity-test-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmpd)
+	pth := filepath.Join(tmpd, "CG_0010_fx.abc")
+	if err := ioutil.WriteFile(pth, []byte("roi"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	v := &Version{Project: "TEST", Shot: "CG_0010", Task: "fx", Version: 1, OutputFiles: []string{pth}}
+	if got := versionFilePaths(v); len(got) != 1 || got[0] != pth {
+		t.Fatalf("unexpected version file paths: %v", got)
+	}
+	f, err := statVersionFile(v, pth, time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+	st, err := checkVersionFile(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if st != FileOK {
+		t.Fatalf("want %s, got %s", FileOK, st)
+	}
+
+	// 크기가 같아도 내용이 바뀌면 수정된 것이다.
+	if err := ioutil.WriteFile(pth, []byte("ROI"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	os.Chtimes(pth, time.Now(), f.ModTime.Add(time.Second))
+	st, err = checkVersionFile(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if st != FileModified {
+		t.Fatalf("want %s, got %s", FileModified, st)
+	}
+
+	os.Remove(pth)
+	st, err = checkVersionFile(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if st != FileMissing {
+		t.Fatalf("want %s, got %s", FileMissing, st)
+	}
+
+	files := []*VersionFile{{Status: FileOK}, {Status: FileModified}}
+	if got := VersionIntegrity(files); got != FileModified {
+		t.Fatalf("want %s, got %s", FileModified, got)
+	}
+	files = append(files, &VersionFile{Status: FileMissing})
+	if got := VersionIntegrity(files); got != FileMissing {
+		t.Fatalf("want %s, got %s", FileMissing, got)
+	}
+}
+
+func TestVerifyChecksums(t *testing.T) {
+	tmpd, err := ioutil.TempDir("", "roi-integrity-test-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmpd)
+	abc := filepath.Join(tmpd, "CG_0010_fx.abc")
+	mov := filepath.Join(tmpd, "CG_0010_fx.mov")
+	for _, pth := range []string{abc, mov} {
+		if err := ioutil.WriteFile(pth, []byte(pth), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	v := &Version{Project: "TEST", Shot: "CG_0010", Task: "fx", OutputFiles: []string{abc}, Mov: mov}
+	files, err := statVersionFiles(v, versionFilePaths(v))
+	if err != nil {
+		t.Fatal(err)
+	}
+	abcSum, err := FileChecksum(abc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	movSum, err := FileChecksum(mov)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := verifyChecksums(v, files, nil); err != nil {
+		t.Fatalf("nil checksums should not be verified: %v", err)
+	}
+	if err := verifyChecksums(v, files, map[string]string{abc: abcSum, mov: movSum}); err != nil {
+		t.Fatalf("could not verify checksums: %v", err)
+	}
+	err = verifyChecksums(v, files, map[string]string{abc: movSum})
+	checkErrorKind(t, err, ErrConflict)
+	err = verifyChecksums(v, files, map[string]string{filepath.Join(tmpd, "other.abc"): abcSum})
+	checkErrorKind(t, err, ErrInvalid)
+	os.Remove(mov)
+	err = verifyChecksums(v, files, map[string]string{mov: movSum})
+	checkErrorKind(t, err, ErrInvalid)
+}
+
+func TestVerifyVersionFiles(t *testing.T) {
+	db, err := testDB()
+	if err != nil {
+		t.Fatalf("could not connect to database: %v", err)
+	}
+	tmpd, err := ioutil.TempDir("", "roi-integrity-test-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmpd)
+	pth := filepath.Join(tmpd, "CG_0010_fx.abc")
+	if err := ioutil.WriteFile(pth, []byte("roi"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	v := &Version{Project: "TEST", Shot: "CG_0010", Task: "fx", Version: 1, OutputFiles: []string{pth}}
+	err = RecordVersionFiles(db, v)
+	if err != nil {
+		t.Fatalf("could not record version files: %v", err)
+	}
+	bad, err := VerifyVersionFiles(db, v.Project)
+	if err != nil {
+		t.Fatalf("could not verify version files: %v", err)
+	}
+	if len(bad) != 0 {
+		t.Fatalf("unexpected bad version files: %v", bad)
+	}
+	os.Remove(pth)
+	bad, err = VerifyVersionFiles(db, v.Project)
+	if err != nil {
+		t.Fatalf("could not verify version files: %v", err)
+	}
+	if len(bad) != 1 || bad[0].Status != FileMissing {
+		t.Fatalf("removed file should be reported as missing: %v", bad)
+	}
+	files, err := VersionFiles(db, v.Project, v.Shot, v.Task, v.Version)
+	if err != nil {
+		t.Fatalf("could not get version files: %v", err)
+	}
+	if VersionIntegrity(files) != FileMissing {
+		t.Fatalf("version integrity should be missing")
+	}
+	err = DeleteVersion(db, v.Project, v.Shot, v.Task, v.Version)
+	if err != nil {
+		t.Fatalf("could not delete version: %v", err)
+	}
+	files, err = VersionFiles(db, v.Project, v.Shot, v.Task, v.Version)
+	if err != nil {
+		t.Fatalf("could not get version files: %v", err)
+	}
+	if len(files) != 0 {
+		t.Fatalf("version files exist after version deleted")
+	}
+}
+
+func TestUpdateVersionKeepsFileBaseline(t *testing.T) {
+	db, err := testDB()
+	if err != nil {
+		t.Fatalf("could not connect to database: %v", err)
+	}
+	err = AddProject(db, testProject)
+	if err != nil {
+		t.Fatalf("could not add project: %v", err)
+	}
+	err = AddShot(db, testProject.Project, testShotA)
+	if err != nil {
+		t.Fatalf("could not add shot: %v", err)
+	}
+	err = AddTask(db, testProject.Project, testShotA.Shot, testTaskA)
+	if err != nil {
+		t.Fatalf("could not add task: %v", err)
+	}
+	tmpd, err := ioutil.TempDir("", "roi-integrity-test-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmpd)
+	abc := filepath.Join(tmpd, "CG_0010_fx.abc")
+	vdb := filepath.Join(tmpd, "CG_0010_fx.vdb")
+	for _, pth := range []string{abc, vdb} {
+		if err := ioutil.WriteFile(pth, []byte("roi"), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	v := &Version{Project: testProject.Project, Shot: testShotA.Shot, Task: testTaskA.Task, OutputFiles: []string{abc}}
+	err = AddVersion(db, v.Project, v.Shot, v.Task, v)
+	if err != nil {
+		t.Fatalf("could not add version: %v", err)
+	}
+	files, err := VersionFiles(db, v.Project, v.Shot, v.Task, v.Version)
+	if err != nil {
+		t.Fatalf("could not get version files: %v", err)
+	}
+	if len(files) != 1 || files[0].Path != abc || files[0].Status != FileOK {
+		t.Fatalf("version files should be recorded when the version is added: %v", files)
+	}
+
+	// 덮어쓴 파일은 버전을 수정해도 수정된 파일로 남아야 한다.
+	if err := ioutil.WriteFile(abc, []byte("ROI"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	err = UpdateVersion(db, v.Project, v.Shot, v.Task, v.Version, UpdateVersionParam{OutputFiles: []string{abc, vdb}})
+	if err != nil {
+		t.Fatalf("could not update version: %v", err)
+	}
+	bad, err := VerifyVersionFiles(db, v.Project)
+	if err != nil {
+		t.Fatalf("could not verify version files: %v", err)
+	}
+	if len(bad) != 1 || bad[0].Path != abc || bad[0].Status != FileModified {
+		t.Fatalf("overwritten file should be reported as modified: %v", bad)
+	}
+
+	// 버전에서 빠진 경로의 기록은 지워져야 한다.
+	err = UpdateVersion(db, v.Project, v.Shot, v.Task, v.Version, UpdateVersionParam{OutputFiles: []string{vdb}})
+	if err != nil {
+		t.Fatalf("could not update version: %v", err)
+	}
+	files, err = VersionFiles(db, v.Project, v.Shot, v.Task, v.Version)
+	if err != nil {
+		t.Fatalf("could not get version files: %v", err)
+	}
+	if len(files) != 1 || files[0].Path != vdb {
+		t.Fatalf("only files in the version should be recorded: %v", files)
+	}
+
+	err = DeleteProject(db, testProject.Project)
+	if err != nil {
+		t.Fatalf("could not delete project: %v", err)
+	}
+}
@@ -0,0 +1,173 @@
+package roi
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// StorageRoots는 roi가 사용자에게 보여줄 수 있는 미디어 파일이 저장된 루트 디렉토리들이다.
+// 버전의 결과물, 이미지, 영상 파일은 이 디렉토리 아래에 있을 때만 웹으로 제공된다.
+// 비어 있으면 어떤 파일도 제공하지 않는다.
+var StorageRoots []string
+
+// ResolveMediaPath는 사용자가 요청한 미디어 파일 경로가 StorageRoots 중 하나의
+// 아래에 있는지 검사하고, 심볼릭 링크를 따라간 실제 경로를 반환한다.
+// 경로는 절대 경로여야 하며, .. 등을 이용해 루트 밖으로 나가는 경로는 허락되지 않는다.
+func ResolveMediaPath(pth string) (string, error) {
+	if !filepath.IsAbs(pth) {
+		return "", errorf(ErrInvalid, "media path should be an absolute path: %s", pth)
+	}
+	if filepath.Clean(pth) != pth {
+		return "", errorf(ErrInvalid, "media path should be a clean path: %s", pth)
+	}
+	rpth, err := filepath.EvalSymlinks(pth)
+	if err != nil {
+		return "", err
+	}
+	for _, root := range StorageRoots {
+		rroot, err := filepath.EvalSymlinks(root)
+		if err != nil {
+			// 마운트 되지 않은 루트가 있을 수 있다.
+			continue
+		}
+		if inDir(rroot, rpth) {
+			return rpth, nil
+		}
+	}
+	return "", errorf(ErrInvalid, "media path is not in storage roots: %s", pth)
+}
+
+// inDir은 pth가 dir 아래에 있는지를 검사한다. 두 경로 모두 절대 경로여야 한다.
+func inDir(dir, pth string) bool {
+	rel, err := filepath.Rel(dir, pth)
+	if err != nil {
+		return false
+	}
+	return rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator))
+}
+
+// inRoots는 경로가 roots 중 하나의 아래에 있는지를 검사한다.
+// 경로가 아직 없을 수 있으므로 존재하는 가장 가까운 상위 디렉토리의 심볼릭 링크를 따라가
+// 실제 위치도 루트 아래인지 확인한다.
+func inRoots(roots []string, pth string) bool {
+	if !filepath.IsAbs(pth) {
+		return false
+	}
+	pth = filepath.Clean(pth)
+	exist := pth
+	for {
+		if _, err := os.Lstat(exist); err == nil {
+			break
+		}
+		parent := filepath.Dir(exist)
+		if parent == exist {
+			return false
+		}
+		exist = parent
+	}
+	rexist, err := filepath.EvalSymlinks(exist)
+	if err != nil {
+		return false
+	}
+	for _, root := range roots {
+		if !filepath.IsAbs(root) {
+			continue
+		}
+		root = filepath.Clean(root)
+		if pth == root || !inDir(root, pth) {
+			continue
+		}
+		rroot, err := filepath.EvalSymlinks(root)
+		if err != nil {
+			// 마운트 되지 않은 루트가 있을 수 있다.
+			continue
+		}
+		if inDir(rroot, rexist) {
+			return true
+		}
+	}
+	return false
+}
+
+// reImageSequence는 이미지 시퀀스 파일 이름의 프레임 부분을 찾는다.
+// #### 또는 %04d, %d 형식을 지원한다.
+var reImageSequence = regexp.MustCompile(`#+|%0?(\d*)d`)
+
+// IsImageSequence는 경로가 #### 나 %04d 형식의 이미지 시퀀스 경로인지를 검사한다.
+func IsImageSequence(pth string) bool {
+	return reImageSequence.MatchString(filepath.Base(pth))
+}
+
+// SequenceFrame은 이미지 시퀀스의 한 프레임이다.
+type SequenceFrame struct {
+	Frame int
+	Path  string
+}
+
+// ImageSequenceFrames는 이미지 시퀀스 경로에 해당하는 디스크 상의 프레임들을
+// 프레임 번호 순서로 반환한다. 프레임 패턴은 파일 이름에만 쓸 수 있다.
+//
+// 예)
+// 	ImageSequenceFrames("/show/TEST/CG_0010/render/CG_0010.####.exr")
+// 	ImageSequenceFrames("/show/TEST/CG_0010/render/CG_0010.%04d.exr")
+//
+func ImageSequenceFrames(pth string) ([]SequenceFrame, error) {
+	dir, base := filepath.Split(pth)
+	loc := reImageSequence.FindStringIndex(base)
+	if loc == nil {
+		return nil, errorf(ErrInvalid, "not an image sequence: %s", pth)
+	}
+	re, err := regexp.Compile("^" + regexp.QuoteMeta(base[:loc[0]]) + `(\d+)` + regexp.QuoteMeta(base[loc[1]:]) + "$")
+	if err != nil {
+		return nil, err
+	}
+	fis, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	frames := make([]SequenceFrame, 0)
+	for _, fi := range fis {
+		if fi.IsDir() {
+			continue
+		}
+		m := re.FindStringSubmatch(fi.Name())
+		if m == nil {
+			continue
+		}
+		n, err := strconv.Atoi(m[1])
+		if err != nil {
+			continue
+		}
+		frames = append(frames, SequenceFrame{Frame: n, Path: filepath.Join(dir, fi.Name())})
+	}
+	sort.Slice(frames, func(i, j int) bool {
+		return frames[i].Frame < frames[j].Frame
+	})
+	return frames, nil
+}
+
+// expandImages는 이미지 경로 중 이미지 시퀀스를 디스크 상의 프레임 경로들로 바꾼다.
+// 시퀀스의 프레임을 찾을 수 없다면 그 경로는 그대로 둔다.
+func expandImages(images []string) []string {
+	expanded := make([]string, 0, len(images))
+	for _, img := range images {
+		if !IsImageSequence(img) {
+			expanded = append(expanded, img)
+			continue
+		}
+		frames, err := ImageSequenceFrames(img)
+		if err != nil || len(frames) == 0 {
+			expanded = append(expanded, img)
+			continue
+		}
+		for _, f := range frames {
+			expanded = append(expanded, f.Path)
+		}
+	}
+	return expanded
+}
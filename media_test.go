@@ -0,0 +1,131 @@
+package roi
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestResolveMediaPath(t *testing.T) {
+	tmpd, err := ioutil.TempDir("", "roi-media-test-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmpd)
+	root := filepath.Join(tmpd, "show")
+	secret := filepath.Join(tmpd, "secret")
+	for _, d := range []string{root, secret} {
+		if err := os.MkdirAll(d, 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	mov := filepath.Join(root, "CG_0010.mov")
+	passwd := filepath.Join(secret, "passwd")
+	for _, f := range []string{mov, passwd} {
+		if err := ioutil.WriteFile(f, []byte("data"), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	link := filepath.Join(root, "link")
+	if err := os.Symlink(passwd, link); err != nil {
+		t.Fatal(err)
+	}
+	orgRoots := StorageRoots
+	StorageRoots = []string{root}
+	defer func() { StorageRoots = orgRoots }()
+
+	if _, err := ResolveMediaPath(mov); err != nil {
+		t.Fatalf("should resolve media path in storage root: %v", err)
+	}
+	invalid := []string{
+		"CG_0010.mov",
+		root + "/../secret/passwd",
+		passwd,
+		link,
+	}
+	for _, pth := range invalid {
+		if _, err := ResolveMediaPath(pth); err == nil {
+			t.Fatalf("should not resolve media path: %s", pth)
+		}
+	}
+}
+
+func TestInRoots(t *testing.T) {
+	tmpd, err := ioutil.TempDir("", "roi-media-test-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmpd)
+	root := filepath.Join(tmpd, "delivery")
+	secret := filepath.Join(tmpd, "secret")
+	for _, d := range []string{root, secret} {
+		if err := os.MkdirAll(d, 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	link := filepath.Join(root, "link")
+	if err := os.Symlink(secret, link); err != nil {
+		t.Fatal(err)
+	}
+	roots := []string{root}
+	valid := []string{
+		filepath.Join(root, "20201019"),
+		filepath.Join(root, "client", "20201019"),
+	}
+	for _, pth := range valid {
+		if !inRoots(roots, pth) {
+			t.Fatalf("should be in roots: %s", pth)
+		}
+	}
+	invalid := []string{
+		"delivery/20201019",
+		root,
+		root + "/../secret/20201019",
+		filepath.Join(secret, "20201019"),
+		filepath.Join(link, "20201019"),
+	}
+	for _, pth := range invalid {
+		if inRoots(roots, pth) {
+			t.Fatalf("should not be in roots: %s", pth)
+		}
+	}
+	if inRoots(nil, filepath.Join(root, "20201019")) {
+		t.Fatalf("nothing should be in empty roots")
+	}
+}
+
+func TestImageSequenceFrames(t *testing.T) {
+	tmpd, err := ioutil.TempDir("", "roi-media-test-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmpd)
+	for _, f := range []string{"CG_0010.1002.exr", "CG_0010.1001.exr", "CG_0010.1010.exr", "CG_0010.exr", "CG_0020.1001.exr"} {
+		if err := ioutil.WriteFile(filepath.Join(tmpd, f), []byte{}, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	want := []SequenceFrame{
+		{Frame: 1001, Path: filepath.Join(tmpd, "CG_0010.1001.exr")},
+		{Frame: 1002, Path: filepath.Join(tmpd, "CG_0010.1002.exr")},
+		{Frame: 1010, Path: filepath.Join(tmpd, "CG_0010.1010.exr")},
+	}
+	for _, pat := range []string{"CG_0010.####.exr", "CG_0010.%04d.exr", "CG_0010.%d.exr"} {
+		pth := filepath.Join(tmpd, pat)
+		if !IsImageSequence(pth) {
+			t.Fatalf("should be an image sequence: %s", pth)
+		}
+		got, err := ImageSequenceFrames(pth)
+		if err != nil {
+			t.Fatalf("could not get image sequence frames: %v", err)
+		}
+		if !reflect.DeepEqual(got, want) {
+			t.Fatalf("%s: got %v, want %v", pat, got, want)
+		}
+	}
+	if IsImageSequence(filepath.Join(tmpd, "CG_0010.1001.exr")) {
+		t.Fatalf("single image should not be an image sequence")
+	}
+}
@@ -0,0 +1,112 @@
+package roi
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Notification은 사용자에게 전달할 알림이다.
+type Notification struct {
+	// User는 알림을 받을 사용자의 아이디이다.
+	User    string
+	Project string
+	Msg     string
+	// Link는 알림과 관련된 로이 페이지의 주소이다.
+	Link    string
+	Created time.Time
+}
+
+var CreateTableIfNotExistsNotificationsStmt = `CREATE TABLE IF NOT EXISTS notifications (
+	uniqid UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+	user_id STRING NOT NULL CHECK (length(user_id) > 0) CHECK (user_id NOT LIKE '% %'),
+	project STRING NOT NULL,
+	msg STRING NOT NULL,
+	link STRING NOT NULL,
+	created TIMESTAMPTZ NOT NULL,
+	INDEX (user_id)
+)`
+
+var NotificationTableKeys = []string{
+	"user_id",
+	"project",
+	"msg",
+	"link",
+	"created",
+}
+
+var NotificationTableIndices = dbIndices(NotificationTableKeys)
+
+func (n *Notification) dbValues() []interface{} {
+	if n == nil {
+		n = &Notification{}
+	}
+	return []interface{}{
+		n.User,
+		n.Project,
+		n.Msg,
+		n.Link,
+		n.Created,
+	}
+}
+
+// addNotification은 사용자에게 알림을 추가한다.
+// 알림은 알릴 일과 같은 트랜잭션 안에서 추가되어야 한다.
+func addNotification(ctx context.Context, tx *sql.Tx, n *Notification) error {
+	if n == nil {
+		return errorf(ErrInvalid, "nil notification")
+	}
+	if n.User == "" {
+		return errorf(ErrInvalid, "user not specified")
+	}
+	keystr := strings.Join(NotificationTableKeys, ", ")
+	idxstr := strings.Join(NotificationTableIndices, ", ")
+	stmt := fmt.Sprintf("INSERT INTO notifications (%s) VALUES (%s)", keystr, idxstr)
+	if _, err := dbExec(ctx, tx, stmt, n.dbValues()...); err != nil {
+		return fmt.Errorf("could not insert notification: %w", err)
+	}
+	return nil
+}
+
+// UserNotifications는 사용자의 알림을 최근 순서로 반환한다.
+func UserNotifications(db *sql.DB, user string) ([]*Notification, error) {
+	return UserNotificationsContext(context.Background(), db, user)
+}
+
+// UserNotificationsContext는 ctx를 받는 UserNotifications이다.
+func UserNotificationsContext(ctx context.Context, db *sql.DB, user string) ([]*Notification, error) {
+	keystr := strings.Join(NotificationTableKeys, ", ")
+	stmt := fmt.Sprintf("SELECT %s FROM notifications WHERE user_id=$1 ORDER BY created DESC", keystr)
+	rows, err := dbQuery(ctx, db, stmt, user)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	ns := make([]*Notification, 0)
+	for rows.Next() {
+		n := &Notification{}
+		if err := rows.Scan(&n.User, &n.Project, &n.Msg, &n.Link, &n.Created); err != nil {
+			return nil, err
+		}
+		ns = append(ns, n)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return ns, nil
+}
+
+// ClearNotifications는 사용자의 알림을 모두 지운다.
+func ClearNotifications(db *sql.DB, user string) error {
+	return ClearNotificationsContext(context.Background(), db, user)
+}
+
+// ClearNotificationsContext는 ctx를 받는 ClearNotifications이다.
+func ClearNotificationsContext(ctx context.Context, db *sql.DB, user string) error {
+	if _, err := dbExec(ctx, db, "DELETE FROM notifications WHERE user_id=$1", user); err != nil {
+		return fmt.Errorf("could not delete data from 'notifications' table: %w", err)
+	}
+	return nil
+}
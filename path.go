@@ -0,0 +1,396 @@
+package roi
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// PathKind는 프로젝트 경로 템플릿의 종류이다.
+type PathKind string
+
+const (
+	PathWork   = PathKind("work")
+	PathRender = PathKind("render")
+	PathMov    = PathKind("mov")
+	PathPlate  = PathKind("plate")
+)
+
+var AllPathKinds = []PathKind{
+	PathWork,
+	PathRender,
+	PathMov,
+	PathPlate,
+}
+
+// UIString은 UI안에서 사용하는 현지화된 문자열이다.
+func (k PathKind) UIString() string {
+	switch k {
+	case PathWork:
+		return "작업 파일"
+	case PathRender:
+		return "렌더"
+	case PathMov:
+		return "영상"
+	case PathPlate:
+		return "플레이트"
+	}
+	return ""
+}
+
+// isValidPathKind는 해당 경로 종류가 유효한지를 반환한다.
+func isValidPathKind(k PathKind) bool {
+	for _, pk := range AllPathKinds {
+		if k == pk {
+			return true
+		}
+	}
+	return false
+}
+
+// ProjectPaths는 프로젝트의 파일들이 디스크의 어디에 위치하는지를 나타내는 경로 템플릿이다.
+//
+// 템플릿에는 {project}, {episode}, {sequence}, {shot}, {task}, {version} 토큰을
+// 사용할 수 있으며, 경로를 풀 때 각각 해당하는 값으로 바뀐다.
+// 버전은 버전 페이지 아이디와 같이 v001 형식으로 바뀐다.
+//
+// 예)
+// 	/show/{project}/{shot}/{task}/work
+// 	/show/{project}/{shot}/{task}/render/{version}
+//
+type ProjectPaths struct {
+	Project string
+
+	Work   string
+	Render string
+	Mov    string
+	Plate  string
+
+	// CreateDirs가 참이면 샷이나 태스크가 추가될 때 템플릿에 따라 디렉토리를 만든다.
+	CreateDirs bool
+
+	// IngestNaming은 와치 폴더에서 인제스트할 파일 이름의 템플릿이다.
+	// 비어 있으면 DefaultIngestNaming을 사용한다. newIngestNaming 참고.
+	IngestNaming string
+}
+
+// Template은 해당 종류의 경로 템플릿을 반환한다.
+func (p *ProjectPaths) Template(kind PathKind) string {
+	switch kind {
+	case PathWork:
+		return p.Work
+	case PathRender:
+		return p.Render
+	case PathMov:
+		return p.Mov
+	case PathPlate:
+		return p.Plate
+	}
+	return ""
+}
+
+func (p *ProjectPaths) dbValues() []interface{} {
+	if p == nil {
+		p = &ProjectPaths{}
+	}
+	return []interface{}{
+		p.Project,
+		p.Work,
+		p.Render,
+		p.Mov,
+		p.Plate,
+		p.CreateDirs,
+		p.IngestNaming,
+	}
+}
+
+var CreateTableIfNotExistsProjectPathsStmt = `CREATE TABLE IF NOT EXISTS project_paths (
+	uniqid UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+	project STRING NOT NULL UNIQUE CHECK (length(project) > 0) CHECK (project NOT LIKE '% %'),
+	work STRING NOT NULL,
+	render STRING NOT NULL,
+	mov STRING NOT NULL,
+	plate STRING NOT NULL,
+	create_dirs BOOL NOT NULL,
+	ingest_naming STRING NOT NULL
+)`
+
+var ProjectPathsTableKeys = []string{
+	"project",
+	"work",
+	"render",
+	"mov",
+	"plate",
+	"create_dirs",
+	"ingest_naming",
+}
+
+var ProjectPathsTableIndices = dbIndices(ProjectPathsTableKeys)
+
+// SetProjectPaths는 프로젝트의 경로 템플릿을 db에 기록한다.
+// 이미 기록된 템플릿이 있다면 덮어쓴다.
+func SetProjectPaths(db *sql.DB, p *ProjectPaths) error {
+	return SetProjectPathsContext(context.Background(), db, p)
+}
+
+// SetProjectPathsContext는 ctx를 받는 SetProjectPaths이다.
+func SetProjectPathsContext(ctx context.Context, db *sql.DB, p *ProjectPaths) error {
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("could not begin a transaction: %w", err)
+	}
+	defer tx.Rollback() // 트랜잭션이 완료되지 않았을 때만 실행됨
+	if err := setProjectPaths(ctx, tx, p); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// setProjectPaths는 트랜잭션 안에서 프로젝트의 경로 템플릿을 기록한다.
+func setProjectPaths(ctx context.Context, tx *sql.Tx, p *ProjectPaths) error {
+	if p == nil {
+		return errorf(ErrInvalid, "nil project paths")
+	}
+	if !IsValidProject(p.Project) {
+		return errorf(ErrInvalid, "Project id is invalid: %s", p.Project)
+	}
+	v := &validator{}
+	for _, k := range AllPathKinds {
+		err := checkPathTemplate(p.Template(k))
+		v.check(err == nil, "path_"+string(k), "invalid path template: %v", err)
+	}
+	err := checkIngestNaming(p.IngestNaming)
+	v.check(err == nil, "ingest_naming", "%v", err)
+	if err := v.err(); err != nil {
+		return err
+	}
+	keystr := strings.Join(ProjectPathsTableKeys, ", ")
+	idxstr := strings.Join(ProjectPathsTableIndices, ", ")
+	stmt := fmt.Sprintf("UPSERT INTO project_paths (%s) VALUES (%s)", keystr, idxstr)
+	if _, err := dbExec(ctx, tx, stmt, p.dbValues()...); err != nil {
+		return err
+	}
+	return nil
+}
+
+// projectPathsFromRows는 테이블의 한 열에서 프로젝트 경로 템플릿을 받아온다.
+func projectPathsFromRows(rows *sql.Rows) (*ProjectPaths, error) {
+	p := &ProjectPaths{}
+	err := rows.Scan(&p.Project, &p.Work, &p.Render, &p.Mov, &p.Plate, &p.CreateDirs, &p.IngestNaming)
+	if err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+// GetProjectPaths는 db에서 프로젝트의 경로 템플릿을 불러온다.
+// 기록된 템플릿이 없다면 nil이 반환된다.
+func GetProjectPaths(db *sql.DB, prj string) (*ProjectPaths, error) {
+	return GetProjectPathsContext(context.Background(), db, prj)
+}
+
+// GetProjectPathsContext는 ctx를 받는 GetProjectPaths이다.
+func GetProjectPathsContext(ctx context.Context, db *sql.DB, prj string) (*ProjectPaths, error) {
+	keystr := strings.Join(ProjectPathsTableKeys, ", ")
+	stmt := fmt.Sprintf("SELECT %s FROM project_paths WHERE project=$1", keystr)
+	rows, err := dbQuery(ctx, db, stmt, prj)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	if !rows.Next() {
+		return nil, nil
+	}
+	return projectPathsFromRows(rows)
+}
+
+// PathTokens는 경로 템플릿의 토큰을 바꿀 값들이다.
+// Episode와 Sequence가 비어 있다면 샷 이름에서 얻는다.
+type PathTokens struct {
+	Project  string
+	Episode  string
+	Sequence string
+	Shot     string
+	Task     string
+	Version  int
+}
+
+// ShotEpisode는 샷 이름에서 에피소드 이름을 반환한다.
+// 에피소드는 세 부분 이상으로 이루어진 샷 이름의 첫번째 부분이다.
+// 에피소드가 없는 샷 이름이면 빈 문자열을 반환한다.
+//
+// 예)
+// 	ShotEpisode("EP01_SC01_0010") => "EP01"
+// 	ShotEpisode("CG_0010") => ""
+//
+func ShotEpisode(shot string) string {
+	ps := strings.Split(shot, "_")
+	if len(ps) < 3 {
+		return ""
+	}
+	return ps[0]
+}
+
+// values는 토큰 이름과 그 값을 반환한다. 값이 없는 토큰은 빈 문자열이다.
+func (t PathTokens) values() map[string]string {
+	ep := t.Episode
+	if ep == "" {
+		ep = ShotEpisode(t.Shot)
+	}
+	seq := t.Sequence
+	if seq == "" {
+		seq = ShotSequence(t.Shot)
+	}
+	ver := ""
+	if t.Version > 0 {
+		ver = fmt.Sprintf("v%03d", t.Version)
+	}
+	return map[string]string{
+		"project":  t.Project,
+		"episode":  ep,
+		"sequence": seq,
+		"shot":     t.Shot,
+		"task":     t.Task,
+		"version":  ver,
+	}
+}
+
+var rePathToken = regexp.MustCompile(`{([a-z]*)}`)
+
+// checkPathTemplate은 경로 템플릿이 알 수 없는 토큰을 사용하지 않는지 검사한다.
+// 빈 템플릿은 유효하다.
+func checkPathTemplate(tmpl string) error {
+	if tmpl == "" {
+		return nil
+	}
+	if !filepath.IsAbs(tmpl) {
+		return errorf(ErrInvalid, "path template should be an absolute path: %s", tmpl)
+	}
+	known := PathTokens{}.values()
+	for _, m := range rePathToken.FindAllStringSubmatch(tmpl, -1) {
+		if _, ok := known[m[1]]; !ok {
+			return errorf(ErrInvalid, "unknown token: %s", m[0])
+		}
+	}
+	return nil
+}
+
+// ResolvePathTemplate은 경로 템플릿의 토큰을 값으로 바꾼 경로를 반환한다.
+// 템플릿에 쓰인 토큰의 값이 없다면 에러를 반환한다.
+func ResolvePathTemplate(tmpl string, t PathTokens) (string, error) {
+	if err := checkPathTemplate(tmpl); err != nil {
+		return "", err
+	}
+	vals := t.values()
+	var err error
+	pth := rePathToken.ReplaceAllStringFunc(tmpl, func(tok string) string {
+		v := vals[tok[1:len(tok)-1]]
+		if v == "" && err == nil {
+			err = errorf(ErrInvalid, "no value for token %s", tok)
+		}
+		return v
+	})
+	if err != nil {
+		return "", err
+	}
+	return filepath.Clean(pth), nil
+}
+
+// ResolvePath는 db에 기록된 프로젝트의 경로 템플릿으로 해당 종류의 경로를 반환한다.
+// 필요하지 않은 값은 비워둘 수 있다. 예를 들어 플레이트 경로에는 보통 태스크와 버전이 필요 없다.
+func ResolvePath(db *sql.DB, kind PathKind, prj, shot, task string, version int) (string, error) {
+	return ResolvePathContext(context.Background(), db, kind, prj, shot, task, version)
+}
+
+// ResolvePathContext는 ctx를 받는 ResolvePath이다.
+func ResolvePathContext(ctx context.Context, db *sql.DB, kind PathKind, prj, shot, task string, version int) (string, error) {
+	if !isValidPathKind(kind) {
+		return "", errorf(ErrInvalid, "invalid path kind: %s", kind)
+	}
+	p, err := GetProjectPathsContext(ctx, db, prj)
+	if err != nil {
+		return "", err
+	}
+	if p == nil || p.Template(kind) == "" {
+		return "", errorf(ErrNotFound, "project '%s' does not have %s path template", prj, kind)
+	}
+	return ResolvePathTemplate(p.Template(kind), PathTokens{Project: prj, Shot: shot, Task: task, Version: version})
+}
+
+// pathTemplateDir은 경로 템플릿에서 주어진 토큰만으로 정할 수 있는 디렉토리를 반환한다.
+// 값이 없는 토큰이나 {version} 토큰이 쓰인 요소부터는 포함하지 않는다.
+// 마지막 요소에 점(.)이 있으면 파일로 보고 포함하지 않는다.
+//
+// 예) 태스크가 없을 때
+// 	/show/{project}/{shot}/{task}/work => /show/TEST/CG_0010
+//
+func pathTemplateDir(tmpl string, t PathTokens) string {
+	if tmpl == "" {
+		return ""
+	}
+	vals := t.values()
+	elems := strings.Split(filepath.Clean(tmpl), string(filepath.Separator))
+	if strings.Contains(elems[len(elems)-1], ".") {
+		elems = elems[:len(elems)-1]
+	}
+	dir := make([]string, 0, len(elems))
+	for _, e := range elems {
+		stop := false
+		e = rePathToken.ReplaceAllStringFunc(e, func(tok string) string {
+			name := tok[1 : len(tok)-1]
+			if name == "version" || vals[name] == "" {
+				stop = true
+			}
+			return vals[name]
+		})
+		if stop {
+			break
+		}
+		dir = append(dir, e)
+	}
+	return strings.Join(dir, string(filepath.Separator))
+}
+
+// createPathDirs는 프로젝트의 경로 템플릿이 디렉토리 생성을 원할 때,
+// 각 토큰만으로 정할 수 있는 디렉토리들을 만든다.
+// 추가가 취소되었을 때 디렉토리가 남지 않도록 샷이나 태스크를 추가한 트랜잭션이 커밋된 뒤에 호출한다.
+// 따라서 디렉토리를 만들지 못해도 이미 추가된 샷이나 태스크는 그대로 남는다.
+func createPathDirs(ctx context.Context, db *sql.DB, tokens ...PathTokens) error {
+	paths := make(map[string]*ProjectPaths)
+	for _, t := range tokens {
+		p, ok := paths[t.Project]
+		if !ok {
+			keystr := strings.Join(ProjectPathsTableKeys, ", ")
+			stmt := fmt.Sprintf("SELECT %s FROM project_paths WHERE project=$1", keystr)
+			rows, err := dbQuery(ctx, db, stmt, t.Project)
+			if err != nil {
+				return err
+			}
+			if rows.Next() {
+				p, err = projectPathsFromRows(rows)
+			}
+			rows.Close()
+			if err != nil {
+				return err
+			}
+			paths[t.Project] = p
+		}
+		if p == nil || !p.CreateDirs {
+			continue
+		}
+		for _, k := range AllPathKinds {
+			d := pathTemplateDir(p.Template(k), t)
+			if d == "" {
+				continue
+			}
+			if err := os.MkdirAll(d, 0755); err != nil {
+				return fmt.Errorf("could not create %s directory: %w", k, err)
+			}
+		}
+	}
+	return nil
+}
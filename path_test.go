@@ -0,0 +1,126 @@
+package roi
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestResolvePathTemplate(t *testing.T) {
+	tokens := PathTokens{Project: "TEST", Shot: "EP01_SC01_0010", Task: "fx", Version: 3}
+	cases := []struct {
+		tmpl    string
+		want    string
+		wantErr bool
+	}{
+		{tmpl: "/show/{project}/{shot}/{task}/work", want: "/show/TEST/EP01_SC01_0010/fx/work"},
+		{tmpl: "/show/{project}/{episode}/{sequence}/{shot}/render/{version}", want: "/show/TEST/EP01/EP01_SC01/EP01_SC01_0010/render/v003"},
+		{tmpl: "/show/{project}/{shot}/mov/{shot}_{task}_{version}.mov", want: "/show/TEST/EP01_SC01_0010/mov/EP01_SC01_0010_fx_v003.mov"},
+		{tmpl: "/show/{project}/{unknown}", wantErr: true},
+		{tmpl: "show/{project}", wantErr: true},
+	}
+	for _, c := range cases {
+		got, err := ResolvePathTemplate(c.tmpl, tokens)
+		if c.wantErr {
+			if err == nil {
+				t.Fatalf("%s: want error, got none", c.tmpl)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatalf("%s: %v", c.tmpl, err)
+		}
+		if got != c.want {
+			t.Fatalf("%s: got %s, want %s", c.tmpl, got, c.want)
+		}
+	}
+	_, err := ResolvePathTemplate("/show/{project}/{shot}/{task}", PathTokens{Project: "TEST", Shot: "CG_0010"})
+	if err == nil {
+		t.Fatalf("should not resolve path template without task")
+	}
+}
+
+func TestPathTemplateDir(t *testing.T) {
+	tokens := PathTokens{Project: "TEST", Shot: "CG_0010"}
+	cases := map[string]string{
+		"/show/{project}/{shot}/{task}/work":          "/show/TEST/CG_0010",
+		"/show/{project}/{shot}/plate":                "/show/TEST/CG_0010/plate",
+		"/show/{project}/{shot}/{shot}_plate.mov":     "/show/TEST/CG_0010",
+		"/show/{project}/{shot}/render/{version}/exr": "/show/TEST/CG_0010/render",
+		"/{task}/work": "",
+	}
+	for tmpl, want := range cases {
+		if got := pathTemplateDir(tmpl, tokens); got != want {
+			t.Fatalf("%s: got %s, want %s", tmpl, got, want)
+		}
+	}
+}
+
+func TestProjectPaths(t *testing.T) {
+	db, err := testDB()
+	if err != nil {
+		t.Fatalf("could not connect to database: %v", err)
+	}
+	tmpd, err := ioutil.TempDir("", "roi-path-test-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmpd)
+	err = AddProject(db, testProject)
+	if err != nil {
+		t.Fatalf("could not add project: %v", err)
+	}
+	p := &ProjectPaths{
+		Project:    testProject.Project,
+		Work:       filepath.Join(tmpd, "{project}/{shot}/{task}/work"),
+		Plate:      filepath.Join(tmpd, "{project}/{shot}/plate"),
+		CreateDirs: true,
+	}
+	err = SetProjectPaths(db, p)
+	if err != nil {
+		t.Fatalf("could not set project paths: %v", err)
+	}
+	got, err := GetProjectPaths(db, testProject.Project)
+	if err != nil {
+		t.Fatalf("could not get project paths: %v", err)
+	}
+	if !reflect.DeepEqual(got, p) {
+		t.Fatalf("got: %v, want: %v", got, p)
+	}
+	err = AddShot(db, testProject.Project, testShotA)
+	if err != nil {
+		t.Fatalf("could not add shot: %v", err)
+	}
+	plate := filepath.Join(tmpd, testProject.Project, testShotA.Shot, "plate")
+	if _, err := os.Stat(plate); err != nil {
+		t.Fatalf("plate directory not created: %v", err)
+	}
+	work, err := ResolvePath(db, PathWork, testProject.Project, testShotA.Shot, "fx", 0)
+	if err != nil {
+		t.Fatalf("could not resolve work path: %v", err)
+	}
+	if want := filepath.Join(tmpd, testProject.Project, testShotA.Shot, "fx", "work"); work != want {
+		t.Fatalf("work path: got %s, want %s", work, want)
+	}
+	_, err = ResolvePath(db, PathRender, testProject.Project, testShotA.Shot, "fx", 0)
+	if err == nil {
+		t.Fatalf("should not resolve path without template")
+	}
+	err = DeleteShot(db, testProject.Project, testShotA.Shot)
+	if err != nil {
+		t.Fatalf("could not delete shot: %v", err)
+	}
+	err = DeleteProject(db, testProject.Project)
+	if err != nil {
+		t.Fatalf("could not delete project: %v", err)
+	}
+	got, err = GetProjectPaths(db, testProject.Project)
+	if err != nil {
+		t.Fatalf("could not get project paths: %v", err)
+	}
+	if got != nil {
+		t.Fatalf("project paths exist after project deleted")
+	}
+}
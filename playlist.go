@@ -0,0 +1,401 @@
+package roi
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// IsValidPlaylistName은 해당 이름이 플레이리스트의 이름으로 적절한지 여부를 반환한다.
+// 이름은 URL 경로에 사용되기 때문에 슬래시(/)를 포함할 수 없다.
+func IsValidPlaylistName(name string) bool {
+	if strings.TrimSpace(name) == "" {
+		return false
+	}
+	return !strings.Contains(name, "/")
+}
+
+// PlaylistItem은 플레이리스트에 들어가는 하나의 버전이다.
+type PlaylistItem struct {
+	Shot    string
+	Task    string
+	Version int
+	// Note는 데일리 중에 이 버전에 대해 남기는 메모이다.
+	Note string
+}
+
+// Playlist는 데일리 등에서 차례로 볼 버전들의 목록이다.
+type Playlist struct {
+	Project string
+	// Name은 프로젝트 내에서 고유한 플레이리스트 이름이다.
+	Name string
+	// Date는 플레이리스트를 보는 날이다.
+	Date time.Time
+	// Items는 재생할 순서대로 정렬되어 있다.
+	Items []*PlaylistItem
+}
+
+var CreateTableIfNotExistsPlaylistsStmt = `CREATE TABLE IF NOT EXISTS playlists (
+	uniqid UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+	project STRING NOT NULL CHECK (length(project) > 0) CHECK (project NOT LIKE '% %'),
+	name STRING NOT NULL CHECK (length(name) > 0),
+	date TIMESTAMPTZ NOT NULL,
+	UNIQUE(project, name)
+)`
+
+var PlaylistTableKeys = []string{
+	"project",
+	"name",
+	"date",
+}
+
+var PlaylistTableIndices = dbIndices(PlaylistTableKeys)
+
+func (p *Playlist) dbValues() []interface{} {
+	if p == nil {
+		p = &Playlist{}
+	}
+	return []interface{}{
+		p.Project,
+		p.Name,
+		p.Date,
+	}
+}
+
+var CreateTableIfNotExistsPlaylistItemsStmt = `CREATE TABLE IF NOT EXISTS playlist_items (
+	uniqid UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+	project STRING NOT NULL CHECK (length(project) > 0) CHECK (project NOT LIKE '% %'),
+	playlist STRING NOT NULL CHECK (length(playlist) > 0),
+	idx INT NOT NULL,
+	shot STRING NOT NULL CHECK (length(shot) > 0) CHECK (shot NOT LIKE '% %'),
+	task STRING NOT NULL CHECK (length(task) > 0) CHECK (task NOT LIKE '% %'),
+	version INT NOT NULL,
+	note STRING NOT NULL,
+	UNIQUE(project, playlist, idx)
+)`
+
+var PlaylistItemTableKeys = []string{
+	"project",
+	"playlist",
+	"idx",
+	"shot",
+	"task",
+	"version",
+	"note",
+}
+
+var PlaylistItemTableIndices = dbIndices(PlaylistItemTableKeys)
+
+// checkPlaylistItems는 플레이리스트 항목들이 모두 버전을 가리키는지 검사한다.
+func checkPlaylistItems(items []*PlaylistItem) error {
+	for _, it := range items {
+		if it == nil {
+			return errorf(ErrInvalid, "nil PlaylistItem is invalid")
+		}
+		if it.Shot == "" || it.Task == "" || it.Version <= 0 {
+			return errorf(ErrInvalid, "invalid playlist item: %s.%s.v%03d", it.Shot, it.Task, it.Version)
+		}
+	}
+	return nil
+}
+
+// insertPlaylistItems는 플레이리스트 항목들을 start 순서부터 차례로 추가한다.
+func insertPlaylistItems(ctx context.Context, tx *sql.Tx, prj, name string, start int, items []*PlaylistItem) error {
+	keystr := strings.Join(PlaylistItemTableKeys, ", ")
+	idxstr := strings.Join(PlaylistItemTableIndices, ", ")
+	stmt := fmt.Sprintf("INSERT INTO playlist_items (%s) VALUES (%s)", keystr, idxstr)
+	for i, it := range items {
+		if _, err := dbExec(ctx, tx, stmt, prj, name, start+i, it.Shot, it.Task, it.Version, it.Note); err != nil {
+			return fmt.Errorf("could not insert playlist item: %w", err)
+		}
+	}
+	return nil
+}
+
+// AddPlaylist는 db에 플레이리스트와 그 항목들을 추가한다.
+func AddPlaylist(db *sql.DB, p *Playlist) error {
+	return AddPlaylistContext(context.Background(), db, p)
+}
+
+// AddPlaylistContext는 ctx를 받는 AddPlaylist이다.
+func AddPlaylistContext(ctx context.Context, db *sql.DB, p *Playlist) error {
+	if p == nil {
+		return errorf(ErrInvalid, "nil Playlist is invalid")
+	}
+	if p.Project == "" {
+		return errorf(ErrInvalid, "project not specified")
+	}
+	v := &validator{}
+	v.check(IsValidPlaylistName(p.Name), "name", "invalid playlist name: '%s'", p.Name)
+	if err := v.err(); err != nil {
+		return err
+	}
+	if err := checkPlaylistItems(p.Items); err != nil {
+		return err
+	}
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("could not begin a transaction: %w", err)
+	}
+	defer tx.Rollback() // 트랜잭션이 완료되지 않았을 때만 실행됨
+	keystr := strings.Join(PlaylistTableKeys, ", ")
+	idxstr := strings.Join(PlaylistTableIndices, ", ")
+	stmt := fmt.Sprintf("INSERT INTO playlists (%s) VALUES (%s)", keystr, idxstr)
+	if _, err := dbExec(ctx, tx, stmt, p.dbValues()...); err != nil {
+		return fmt.Errorf("could not insert playlist: %w", err)
+	}
+	if err := insertPlaylistItems(ctx, tx, p.Project, p.Name, 0, p.Items); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// UpdatePlaylistParam은 Playlist에서 일반적으로 업데이트 되어야 하는 멤버의 모음이다.
+// UpdatePlaylist에서 사용한다.
+type UpdatePlaylistParam struct {
+	Date  time.Time
+	Items []*PlaylistItem
+}
+
+// UpdatePlaylist는 db의 플레이리스트 날짜와 항목들을 업데이트 한다.
+// 기존 항목들은 모두 지워지고 upd.Items로 대체된다.
+func UpdatePlaylist(db *sql.DB, prj, name string, upd UpdatePlaylistParam) error {
+	return UpdatePlaylistContext(context.Background(), db, prj, name, upd)
+}
+
+// UpdatePlaylistContext는 ctx를 받는 UpdatePlaylist이다.
+func UpdatePlaylistContext(ctx context.Context, db *sql.DB, prj, name string, upd UpdatePlaylistParam) error {
+	if prj == "" {
+		return errorf(ErrInvalid, "project not specified")
+	}
+	if name == "" {
+		return errorf(ErrInvalid, "playlist name not specified")
+	}
+	if err := checkPlaylistItems(upd.Items); err != nil {
+		return err
+	}
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("could not begin a transaction: %w", err)
+	}
+	defer tx.Rollback() // 트랜잭션이 완료되지 않았을 때만 실행됨
+	if _, err := dbExec(ctx, tx, "UPDATE playlists SET date=$1 WHERE project=$2 AND name=$3", upd.Date, prj, name); err != nil {
+		return fmt.Errorf("could not update playlist: %w", err)
+	}
+	if _, err := dbExec(ctx, tx, "DELETE FROM playlist_items WHERE project=$1 AND playlist=$2", prj, name); err != nil {
+		return fmt.Errorf("could not delete data from 'playlist_items' table: %w", err)
+	}
+	if err := insertPlaylistItems(ctx, tx, prj, name, 0, upd.Items); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// AddPlaylistItems는 플레이리스트의 끝에 항목들을 추가한다.
+// 이미 플레이리스트에 있는 버전은 다시 추가하지 않는다.
+func AddPlaylistItems(db *sql.DB, prj, name string, items []*PlaylistItem) error {
+	return AddPlaylistItemsContext(context.Background(), db, prj, name, items)
+}
+
+// AddPlaylistItemsContext는 ctx를 받는 AddPlaylistItems이다.
+func AddPlaylistItemsContext(ctx context.Context, db *sql.DB, prj, name string, items []*PlaylistItem) error {
+	if err := checkPlaylistItems(items); err != nil {
+		return err
+	}
+	p, err := GetPlaylistContext(ctx, db, prj, name)
+	if err != nil {
+		return err
+	}
+	if p == nil {
+		return errorf(ErrNotFound, "playlist not exist: %s/%s", prj, name)
+	}
+	has := make(map[PlaylistItem]bool)
+	for _, it := range p.Items {
+		has[PlaylistItem{Shot: it.Shot, Task: it.Task, Version: it.Version}] = true
+	}
+	add := make([]*PlaylistItem, 0, len(items))
+	for _, it := range items {
+		k := PlaylistItem{Shot: it.Shot, Task: it.Task, Version: it.Version}
+		if has[k] {
+			continue
+		}
+		has[k] = true
+		add = append(add, it)
+	}
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("could not begin a transaction: %w", err)
+	}
+	defer tx.Rollback() // 트랜잭션이 완료되지 않았을 때만 실행됨
+	if err := insertPlaylistItems(ctx, tx, prj, name, len(p.Items), add); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// PlaylistExist는 db에 해당 플레이리스트가 존재하는지를 검사한다.
+func PlaylistExist(db *sql.DB, prj, name string) (bool, error) {
+	return PlaylistExistContext(context.Background(), db, prj, name)
+}
+
+// PlaylistExistContext는 ctx를 받는 PlaylistExist이다.
+func PlaylistExistContext(ctx context.Context, db *sql.DB, prj, name string) (bool, error) {
+	rows, err := dbQuery(ctx, db, "SELECT name FROM playlists WHERE project=$1 AND name=$2 LIMIT 1", prj, name)
+	if err != nil {
+		return false, err
+	}
+	defer rows.Close()
+	return rows.Next(), rows.Err()
+}
+
+// playlistFromRows는 테이블의 한 열에서 플레이리스트를 받아온다. 항목은 채우지 않는다.
+func playlistFromRows(rows *sql.Rows) (*Playlist, error) {
+	p := &Playlist{}
+	if err := rows.Scan(&p.Project, &p.Name, &p.Date); err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+// playlistItems는 플레이리스트의 항목들을 순서대로 반환한다.
+func playlistItems(ctx context.Context, db *sql.DB, prj, name string) ([]*PlaylistItem, error) {
+	rows, err := dbQuery(ctx, db, "SELECT shot, task, version, note FROM playlist_items WHERE project=$1 AND playlist=$2 ORDER BY idx", prj, name)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	items := make([]*PlaylistItem, 0)
+	for rows.Next() {
+		it := &PlaylistItem{}
+		if err := rows.Scan(&it.Shot, &it.Task, &it.Version, &it.Note); err != nil {
+			return nil, err
+		}
+		items = append(items, it)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+// GetPlaylist는 db에서 플레이리스트와 그 항목들을 불러온다.
+// 만일 그 이름의 플레이리스트가 없다면 nil이 반환된다.
+func GetPlaylist(db *sql.DB, prj, name string) (*Playlist, error) {
+	return GetPlaylistContext(context.Background(), db, prj, name)
+}
+
+// GetPlaylistContext는 ctx를 받는 GetPlaylist이다.
+func GetPlaylistContext(ctx context.Context, db *sql.DB, prj, name string) (*Playlist, error) {
+	keystr := strings.Join(PlaylistTableKeys, ", ")
+	stmt := fmt.Sprintf("SELECT %s FROM playlists WHERE project=$1 AND name=$2 LIMIT 1", keystr)
+	rows, err := dbQuery(ctx, db, stmt, prj, name)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	if !rows.Next() {
+		return nil, rows.Err()
+	}
+	p, err := playlistFromRows(rows)
+	if err != nil {
+		return nil, err
+	}
+	p.Items, err = playlistItems(ctx, db, prj, name)
+	if err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+// ProjectPlaylists는 프로젝트의 플레이리스트들을 최근 날짜 순으로 반환한다.
+// 반환되는 플레이리스트의 항목은 채워지지 않는다. 항목이 필요하다면 GetPlaylist를 사용해야 한다.
+func ProjectPlaylists(db *sql.DB, prj string) ([]*Playlist, error) {
+	return ProjectPlaylistsContext(context.Background(), db, prj)
+}
+
+// ProjectPlaylistsContext는 ctx를 받는 ProjectPlaylists이다.
+func ProjectPlaylistsContext(ctx context.Context, db *sql.DB, prj string) ([]*Playlist, error) {
+	keystr := strings.Join(PlaylistTableKeys, ", ")
+	stmt := fmt.Sprintf("SELECT %s FROM playlists WHERE project=$1 ORDER BY date DESC, name", keystr)
+	rows, err := dbQuery(ctx, db, stmt, prj)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	ps := make([]*Playlist, 0)
+	for rows.Next() {
+		p, err := playlistFromRows(rows)
+		if err != nil {
+			return nil, err
+		}
+		ps = append(ps, p)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return ps, nil
+}
+
+// DeletePlaylist는 db에서 플레이리스트와 그 항목, 리뷰 세션을 지운다.
+// 해당 플레이리스트가 없어도 에러를 내지 않기 때문에 검사를 원한다면 PlaylistExist를 사용해야 한다.
+func DeletePlaylist(db *sql.DB, prj, name string) error {
+	return DeletePlaylistContext(context.Background(), db, prj, name)
+}
+
+// DeletePlaylistContext는 ctx를 받는 DeletePlaylist이다.
+func DeletePlaylistContext(ctx context.Context, db *sql.DB, prj, name string) error {
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("could not begin a transaction: %w", err)
+	}
+	defer tx.Rollback() // 트랜잭션이 완료되지 않았을 때만 실행됨
+	if _, err := dbExec(ctx, tx, "DELETE FROM playlist_items WHERE project=$1 AND playlist=$2", prj, name); err != nil {
+		return fmt.Errorf("could not delete data from 'playlist_items' table: %w", err)
+	}
+	if _, err := dbExec(ctx, tx, "DELETE FROM playlists WHERE project=$1 AND name=$2", prj, name); err != nil {
+		return fmt.Errorf("could not delete data from 'playlists' table: %w", err)
+	}
+	if err := deleteReviewSession(ctx, tx, prj, name); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// AskConfirmVersions는 현재 컨펌요청 상태인 태스크의 마지막 버전 중
+// since 이후에 만들어진 버전들을 샷, 태스크 순서로 반환한다.
+// 데일리 플레이리스트를 만들 때 사용한다.
+func AskConfirmVersions(db *sql.DB, prj string, since time.Time) ([]*Version, error) {
+	return AskConfirmVersionsContext(context.Background(), db, prj, since)
+}
+
+// AskConfirmVersionsContext는 ctx를 받는 AskConfirmVersions이다.
+func AskConfirmVersionsContext(ctx context.Context, db *sql.DB, prj string, since time.Time) ([]*Version, error) {
+	keys := make([]string, len(VersionTableKeys))
+	for i, k := range VersionTableKeys {
+		keys[i] = "versions." + k
+	}
+	keystr := strings.Join(keys, ", ")
+	stmt := fmt.Sprintf(`SELECT %s FROM versions
+		JOIN tasks ON (versions.project = tasks.project AND versions.shot = tasks.shot AND versions.task = tasks.task)
+		WHERE versions.project=$1 AND tasks.status=$2 AND versions.version = tasks.last_output_version AND versions.created >= $3
+		ORDER BY versions.shot, versions.task`, keystr)
+	rows, err := dbQuery(ctx, db, stmt, prj, TaskAskConfirm, since)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	versions := make([]*Version, 0)
+	for rows.Next() {
+		v, err := versionFromRows(rows)
+		if err != nil {
+			return nil, err
+		}
+		versions = append(versions, v)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return versions, nil
+}
@@ -0,0 +1,198 @@
+package roi
+
+import (
+	"context"
+	"database/sql"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+)
+
+// PlaylistFPS는 플레이리스트를 EDL이나 OTIO로 내보낼 때 사용하는 초당 프레임 수이다.
+var PlaylistFPS = 24
+
+// PlaylistClip은 내보내기 위해 플레이리스트 항목에 버전의 영상과 샷 길이를 더한 것이다.
+type PlaylistClip struct {
+	PlaylistItem
+	// Mov는 버전의 영상 경로이다. 버전이나 영상이 없으면 빈 문자열이다.
+	Mov string
+	// Duration은 샷의 길이(프레임)이다. 샷 길이가 정해지지 않았다면 PlaylistFPS를 사용한다.
+	Duration int
+}
+
+// Name은 클립의 이름이다. 예) CG_0010.fx.v003
+func (c *PlaylistClip) Name() string {
+	return fmt.Sprintf("%s.%s.v%03d", c.Shot, c.Task, c.Version)
+}
+
+// PlaylistClips는 플레이리스트의 항목들을 순서대로 클립으로 만든다.
+func PlaylistClips(db *sql.DB, p *Playlist) ([]*PlaylistClip, error) {
+	return PlaylistClipsContext(context.Background(), db, p)
+}
+
+// PlaylistClipsContext는 ctx를 받는 PlaylistClips이다.
+func PlaylistClipsContext(ctx context.Context, db *sql.DB, p *Playlist) ([]*PlaylistClip, error) {
+	clips := make([]*PlaylistClip, 0, len(p.Items))
+	durs := make(map[string]int)
+	for _, it := range p.Items {
+		c := &PlaylistClip{PlaylistItem: *it}
+		v, err := GetVersionContext(ctx, db, p.Project, it.Shot, it.Task, it.Version)
+		if err != nil {
+			return nil, err
+		}
+		if v != nil {
+			c.Mov = v.Mov
+		}
+		dur, ok := durs[it.Shot]
+		if !ok {
+			s, err := GetShotContext(ctx, db, p.Project, it.Shot)
+			if err != nil {
+				return nil, err
+			}
+			if s != nil {
+				dur = s.Duration
+			}
+			durs[it.Shot] = dur
+		}
+		c.Duration = dur
+		if c.Duration <= 0 {
+			c.Duration = PlaylistFPS
+		}
+		clips = append(clips, c)
+	}
+	return clips, nil
+}
+
+// WritePlaylistCSV는 클립들을 CSV 형식으로 w에 쓴다.
+func WritePlaylistCSV(w io.Writer, clips []*PlaylistClip) error {
+	cw := csv.NewWriter(w)
+	cw.Write([]string{"shot", "task", "version", "mov", "duration", "note"})
+	for _, c := range clips {
+		cw.Write([]string{c.Shot, c.Task, strconv.Itoa(c.Version), c.Mov, strconv.Itoa(c.Duration), c.Note})
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+// timecode는 프레임 수를 HH:MM:SS:FF 형식의 논드롭 타임코드로 바꾼다.
+func timecode(frame, fps int) string {
+	f := frame % fps
+	s := frame / fps
+	return fmt.Sprintf("%02d:%02d:%02d:%02d", s/3600, s/60%60, s%60, f)
+}
+
+// WritePlaylistEDL은 클립들을 CMX3600 EDL 형식으로 w에 쓴다.
+// 각 클립은 영상의 처음부터 샷 길이만큼 쓰이며, 레코드 타임코드는 01:00:00:00에서 시작한다.
+// 노트는 코멘트로 들어간다.
+func WritePlaylistEDL(w io.Writer, title string, clips []*PlaylistClip) error {
+	fps := PlaylistFPS
+	if _, err := fmt.Fprintf(w, "TITLE: %s\nFCM: NON-DROP FRAME\n\n", title); err != nil {
+		return err
+	}
+	rec := 3600 * fps
+	for i, c := range clips {
+		_, err := fmt.Fprintf(w, "%03d  AX       V     C        %s %s %s %s\n",
+			i+1, timecode(0, fps), timecode(c.Duration, fps), timecode(rec, fps), timecode(rec+c.Duration, fps))
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(w, "* FROM CLIP NAME: %s\n", c.Name())
+		if c.Mov != "" {
+			fmt.Fprintf(w, "* SOURCE FILE: %s\n", c.Mov)
+		}
+		if c.Note != "" {
+			fmt.Fprintf(w, "* COMMENT: %s\n", c.Note)
+		}
+		fmt.Fprintln(w)
+		rec += c.Duration
+	}
+	return nil
+}
+
+// 아래는 OpenTimelineIO의 JSON 형식 중 플레이리스트에 필요한 부분이다.
+
+type otioRationalTime struct {
+	Schema string `json:"OTIO_SCHEMA"`
+	Rate   int    `json:"rate"`
+	Value  int    `json:"value"`
+}
+
+type otioTimeRange struct {
+	Schema    string           `json:"OTIO_SCHEMA"`
+	StartTime otioRationalTime `json:"start_time"`
+	Duration  otioRationalTime `json:"duration"`
+}
+
+type otioMediaReference struct {
+	Schema    string `json:"OTIO_SCHEMA"`
+	TargetURL string `json:"target_url,omitempty"`
+}
+
+type otioClip struct {
+	Schema         string                 `json:"OTIO_SCHEMA"`
+	Name           string                 `json:"name"`
+	Metadata       map[string]interface{} `json:"metadata"`
+	MediaReference otioMediaReference     `json:"media_reference"`
+	SourceRange    otioTimeRange          `json:"source_range"`
+}
+
+type otioTrack struct {
+	Schema   string      `json:"OTIO_SCHEMA"`
+	Name     string      `json:"name"`
+	Kind     string      `json:"kind"`
+	Children []*otioClip `json:"children"`
+}
+
+type otioStack struct {
+	Schema   string       `json:"OTIO_SCHEMA"`
+	Name     string       `json:"name"`
+	Children []*otioTrack `json:"children"`
+}
+
+type otioTimeline struct {
+	Schema string    `json:"OTIO_SCHEMA"`
+	Name   string    `json:"name"`
+	Tracks otioStack `json:"tracks"`
+}
+
+// WritePlaylistOTIO는 클립들을 하나의 비디오 트랙을 가진 OpenTimelineIO 타임라인 JSON으로 w에 쓴다.
+// 로이의 정보는 각 클립의 metadata.roi에 들어간다.
+func WritePlaylistOTIO(w io.Writer, prj, title string, clips []*PlaylistClip) error {
+	fps := PlaylistFPS
+	track := &otioTrack{Schema: "Track.1", Name: "V1", Kind: "Video", Children: make([]*otioClip, 0, len(clips))}
+	for _, c := range clips {
+		ref := otioMediaReference{Schema: "MissingReference.1"}
+		if c.Mov != "" {
+			ref = otioMediaReference{Schema: "ExternalReference.1", TargetURL: c.Mov}
+		}
+		track.Children = append(track.Children, &otioClip{
+			Schema: "Clip.1",
+			Name:   c.Name(),
+			Metadata: map[string]interface{}{
+				"roi": map[string]interface{}{
+					"project": prj,
+					"shot":    c.Shot,
+					"task":    c.Task,
+					"version": c.Version,
+					"note":    c.Note,
+				},
+			},
+			MediaReference: ref,
+			SourceRange: otioTimeRange{
+				Schema:    "TimeRange.1",
+				StartTime: otioRationalTime{Schema: "RationalTime.1", Rate: fps, Value: 0},
+				Duration:  otioRationalTime{Schema: "RationalTime.1", Rate: fps, Value: c.Duration},
+			},
+		})
+	}
+	tl := otioTimeline{
+		Schema: "Timeline.1",
+		Name:   title,
+		Tracks: otioStack{Schema: "Stack.1", Name: "tracks", Children: []*otioTrack{track}},
+	}
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "\t")
+	return enc.Encode(tl)
+}
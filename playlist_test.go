@@ -0,0 +1,183 @@
+package roi
+
+import (
+	"bytes"
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+var testClips = []*PlaylistClip{
+	{
+		PlaylistItem: PlaylistItem{Shot: "CG_0010", Task: "fx", Version: 3, Note: "불꽃을 더 크게"},
+		Mov:          "/show/TEST/CG_0010/fx/v003/CG_0010_fx_v003.mov",
+		Duration:     48,
+	},
+	{
+		PlaylistItem: PlaylistItem{Shot: "CG_0020", Task: "lit", Version: 1},
+		Duration:     30,
+	},
+}
+
+func TestTimecode(t *testing.T) {
+	cases := []struct {
+		frame int
+		want  string
+	}{
+		{frame: 0, want: "00:00:00:00"},
+		{frame: 23, want: "00:00:00:23"},
+		{frame: 24, want: "00:00:01:00"},
+		{frame: 3600*24 + 60*24 + 5, want: "01:01:00:05"},
+	}
+	for _, c := range cases {
+		got := timecode(c.frame, 24)
+		if got != c.want {
+			t.Fatalf("timecode(%d): got %s, want %s", c.frame, got, c.want)
+		}
+	}
+}
+
+func TestPlaylistExport(t *testing.T) {
+	buf := &bytes.Buffer{}
+	if err := WritePlaylistCSV(buf, testClips); err != nil {
+		t.Fatalf("could not write csv: %v", err)
+	}
+	want := "shot,task,version,mov,duration,note\n" +
+		"CG_0010,fx,3,/show/TEST/CG_0010/fx/v003/CG_0010_fx_v003.mov,48,불꽃을 더 크게\n" +
+		"CG_0020,lit,1,,30,\n"
+	if buf.String() != want {
+		t.Fatalf("csv: got %q, want %q", buf.String(), want)
+	}
+
+	buf.Reset()
+	if err := WritePlaylistEDL(buf, "dailies", testClips); err != nil {
+		t.Fatalf("could not write edl: %v", err)
+	}
+	edl := buf.String()
+	for _, line := range []string{
+		"TITLE: dailies",
+		"001  AX       V     C        00:00:00:00 00:00:02:00 01:00:00:00 01:00:02:00",
+		"002  AX       V     C        00:00:00:00 00:00:01:06 01:00:02:00 01:00:03:06",
+		"* FROM CLIP NAME: CG_0010.fx.v003",
+		"* COMMENT: 불꽃을 더 크게",
+	} {
+		if !strings.Contains(edl, line+"\n") {
+			t.Fatalf("edl does not have line %q:\n%s", line, edl)
+		}
+	}
+
+	buf.Reset()
+	if err := WritePlaylistOTIO(buf, "TEST", "dailies", testClips); err != nil {
+		t.Fatalf("could not write otio: %v", err)
+	}
+	var tl otioTimeline
+	if err := json.Unmarshal(buf.Bytes(), &tl); err != nil {
+		t.Fatalf("could not decode otio: %v", err)
+	}
+	clips := tl.Tracks.Children[0].Children
+	if len(clips) != 2 {
+		t.Fatalf("invalid number of otio clips: want 2, got %d", len(clips))
+	}
+	if clips[0].MediaReference.TargetURL != testClips[0].Mov || clips[0].SourceRange.Duration.Value != 48 {
+		t.Fatalf("unexpected otio clip: %v", clips[0])
+	}
+	if clips[1].MediaReference.Schema != "MissingReference.1" {
+		t.Fatalf("clip without mov should have missing reference: %v", clips[1])
+	}
+}
+
+func TestPlaylist(t *testing.T) {
+	db, err := testDB()
+	if err != nil {
+		t.Fatalf("could not connect to database: %v", err)
+	}
+	err = AddProject(db, testProject)
+	if err != nil {
+		t.Fatalf("could not add project: %v", err)
+	}
+	err = AddShot(db, testProject.Project, testShotA)
+	if err != nil {
+		t.Fatalf("could not add shot: %v", err)
+	}
+	err = AddTask(db, testProject.Project, testShotA.Shot, testTaskA)
+	if err != nil {
+		t.Fatalf("could not add task: %v", err)
+	}
+	v := &Version{Created: time.Now()}
+	err = AddVersion(db, testProject.Project, testShotA.Shot, testTaskA.Task, v)
+	if err != nil {
+		t.Fatalf("could not add version: %v", err)
+	}
+	err = UpdateTask(db, testProject.Project, testShotA.Shot, testTaskA.Task, UpdateTaskParam{Status: TaskAskConfirm})
+	if err != nil {
+		t.Fatalf("could not update task: %v", err)
+	}
+	vs, err := AskConfirmVersions(db, testProject.Project, time.Now().Add(-24*time.Hour))
+	if err != nil {
+		t.Fatalf("could not get ask-confirm versions: %v", err)
+	}
+	if len(vs) != 1 || vs[0].Version != v.Version {
+		t.Fatalf("unexpected ask-confirm versions: %v", vs)
+	}
+
+	p := &Playlist{
+		Project: testProject.Project,
+		Name:    "데일리",
+		Date:    time.Date(2019, 1, 1, 0, 0, 0, 0, time.UTC),
+		Items: []*PlaylistItem{
+			{Shot: testShotA.Shot, Task: testTaskA.Task, Version: v.Version},
+		},
+	}
+	err = AddPlaylist(db, p)
+	if err != nil {
+		t.Fatalf("could not add playlist: %v", err)
+	}
+	// 이미 있는 버전은 다시 추가되지 않아야 한다.
+	err = AddPlaylistItems(db, p.Project, p.Name, p.Items)
+	if err != nil {
+		t.Fatalf("could not add playlist items: %v", err)
+	}
+	got, err := GetPlaylist(db, p.Project, p.Name)
+	if err != nil {
+		t.Fatalf("could not get playlist: %v", err)
+	}
+	if !reflect.DeepEqual(got, p) {
+		t.Fatalf("got: %v, want: %v", got, p)
+	}
+	p.Items[0].Note = "좋아요"
+	err = UpdatePlaylist(db, p.Project, p.Name, UpdatePlaylistParam{Date: p.Date, Items: p.Items})
+	if err != nil {
+		t.Fatalf("could not update playlist: %v", err)
+	}
+	clips, err := PlaylistClips(db, p)
+	if err != nil {
+		t.Fatalf("could not get playlist clips: %v", err)
+	}
+	if len(clips) != 1 || clips[0].Note != "좋아요" {
+		t.Fatalf("unexpected playlist clips: %v", clips)
+	}
+	ps, err := ProjectPlaylists(db, p.Project)
+	if err != nil {
+		t.Fatalf("could not get project playlists: %v", err)
+	}
+	if len(ps) != 1 {
+		t.Fatalf("invalid number of playlists: want 1, got %d", len(ps))
+	}
+	err = DeletePlaylist(db, p.Project, p.Name)
+	if err != nil {
+		t.Fatalf("could not delete playlist: %v", err)
+	}
+	exist, err := PlaylistExist(db, p.Project, p.Name)
+	if err != nil {
+		t.Fatalf("could not check playlist exist: %v", err)
+	}
+	if exist {
+		t.Fatalf("deleted playlist exist")
+	}
+	err = DeleteProject(db, testProject.Project)
+	if err != nil {
+		t.Fatalf("could not delete project: %v", err)
+	}
+}
@@ -1,9 +1,11 @@
 package roi
 
 import (
+	"context"
 	"database/sql"
-	"errors"
 	"fmt"
+	"os"
+	"path/filepath"
 	"regexp"
 	"strings"
 	"time"
@@ -42,6 +44,14 @@ type Project struct {
 	DefaultTasks []string
 }
 
+// validate는 프로젝트의 필드들이 적절한지 검사한다.
+func (p *Project) validate() error {
+	v := &validator{}
+	v.check(IsValidProject(p.Project), "project", "invalid project id: '%s'", p.Project)
+	v.checkTasks("default_tasks", p.DefaultTasks)
+	return v.err()
+}
+
 func (p *Project) dbValues() []interface{} {
 	if p == nil {
 		p = &Project{}
@@ -119,16 +129,34 @@ var CreateTableIfNotExistsProjectsStmt = `CREATE TABLE IF NOT EXISTS projects (
 
 // AddProject는 db에 프로젝트를 추가한다.
 func AddProject(db *sql.DB, p *Project) error {
+	return AddProjectContext(context.Background(), db, p)
+}
+
+// AddProjectContext는 ctx를 받는 AddProject이다.
+func AddProjectContext(ctx context.Context, db *sql.DB, p *Project) error {
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("could not begin a transaction: %w", err)
+	}
+	defer tx.Rollback() // 트랜잭션이 완료되지 않았을 때만 실행됨
+	if err := addProject(ctx, tx, p); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// addProject는 트랜잭션 안에서 프로젝트를 추가한다.
+func addProject(ctx context.Context, tx *sql.Tx, p *Project) error {
 	if p == nil {
-		return errors.New("nil Project is invalid")
+		return errorf(ErrInvalid, "nil Project is invalid")
 	}
-	if !IsValidProject(p.Project) {
-		return fmt.Errorf("Project id is invalid: %s", p.Project)
+	if err := p.validate(); err != nil {
+		return err
 	}
 	keystr := strings.Join(ProjectTableKeys, ", ")
 	idxstr := strings.Join(ProjectTableIndices, ", ")
 	stmt := fmt.Sprintf("INSERT INTO projects (%s) VALUES (%s)", keystr, idxstr)
-	if _, err := db.Exec(stmt, p.dbValues()...); err != nil {
+	if _, err := dbExec(ctx, tx, stmt, p.dbValues()...); err != nil {
 		return err
 	}
 	return nil
@@ -155,6 +183,13 @@ type UpdateProjectParam struct {
 	DefaultTasks  []string
 }
 
+// validate는 업데이트할 필드들이 적절한지 검사한다.
+func (u UpdateProjectParam) validate() error {
+	v := &validator{}
+	v.checkTasks("default_tasks", u.DefaultTasks)
+	return v.err()
+}
+
 func (u UpdateProjectParam) keys() []string {
 	return []string{
 		"name",
@@ -176,10 +211,6 @@ func (u UpdateProjectParam) keys() []string {
 	}
 }
 
-func (u UpdateProjectParam) indices() []string {
-	return dbIndices(u.keys())
-}
-
 func (u UpdateProjectParam) values() []interface{} {
 	if u.DefaultTasks == nil {
 		u.DefaultTasks = []string{}
@@ -206,13 +237,19 @@ func (u UpdateProjectParam) values() []interface{} {
 
 // UpdateProject는 db의 프로젝트 정보를 수정한다.
 func UpdateProject(db *sql.DB, prj string, upd UpdateProjectParam) error {
+	return UpdateProjectContext(context.Background(), db, prj, upd)
+}
+
+// UpdateProjectContext는 ctx를 받는 UpdateProject이다.
+func UpdateProjectContext(ctx context.Context, db *sql.DB, prj string, upd UpdateProjectParam) error {
 	if !IsValidProject(prj) {
-		return fmt.Errorf("Project id is invalid: %s", prj)
+		return errorf(ErrInvalid, "Project id is invalid: %s", prj)
+	}
+	if err := upd.validate(); err != nil {
+		return err
 	}
-	keystr := strings.Join(upd.keys(), ", ")
-	idxstr := strings.Join(upd.indices(), ", ")
-	stmt := fmt.Sprintf("UPDATE projects SET (%s) = (%s) WHERE project='%s'", keystr, idxstr, prj)
-	if _, err := db.Exec(stmt, upd.values()...); err != nil {
+	q := updateQuery("projects", upd.keys(), upd.values()).where("project", prj)
+	if _, err := q.exec(ctx, db); err != nil {
 		return err
 	}
 	return nil
@@ -220,10 +257,16 @@ func UpdateProject(db *sql.DB, prj string, upd UpdateProjectParam) error {
 
 // ProjectExist는 db에 해당 프로젝트가 존재하는지를 검사한다.
 func ProjectExist(db *sql.DB, prj string) (bool, error) {
-	rows, err := db.Query("SELECT project FROM projects WHERE project=$1 LIMIT 1", prj)
+	return ProjectExistContext(context.Background(), db, prj)
+}
+
+// ProjectExistContext는 ctx를 받는 ProjectExist이다.
+func ProjectExistContext(ctx context.Context, db *sql.DB, prj string) (bool, error) {
+	rows, err := dbQuery(ctx, db, "SELECT project FROM projects WHERE project=$1 LIMIT 1", prj)
 	if err != nil {
 		return false, err
 	}
+	defer rows.Close()
 	return rows.Next(), nil
 }
 
@@ -245,12 +288,18 @@ func projectFromRows(rows *sql.Rows) (*Project, error) {
 // GetProject는 db에서 특정 프로젝트 정보를 부른다.
 // 해당 프로젝트가 없다면 nil이 반환된다.
 func GetProject(db *sql.DB, prj string) (*Project, error) {
+	return GetProjectContext(context.Background(), db, prj)
+}
+
+// GetProjectContext는 ctx를 받는 GetProject이다.
+func GetProjectContext(ctx context.Context, db *sql.DB, prj string) (*Project, error) {
 	keystr := strings.Join(ProjectTableKeys, ", ")
 	stmt := fmt.Sprintf("SELECT %s FROM projects WHERE project=$1", keystr)
-	rows, err := db.Query(stmt, prj)
+	rows, err := dbQuery(ctx, db, stmt, prj)
 	if err != nil {
 		return nil, err
 	}
+	defer rows.Close()
 	if !rows.Next() {
 		return nil, nil
 	}
@@ -261,15 +310,21 @@ func GetProject(db *sql.DB, prj string) (*Project, error) {
 	return p, nil
 }
 
-// AllProjects는 db에서 모든 프로젝트 정보를 가져온다.
+// AllProjects는 db에서 보관되지 않은 모든 프로젝트 정보를 가져온다.
 // 검색 중 문제가 있으면 nil, error를 반환한다.
 func AllProjects(db *sql.DB) ([]*Project, error) {
+	return AllProjectsContext(context.Background(), db)
+}
+
+// AllProjectsContext는 ctx를 받는 AllProjects이다.
+func AllProjectsContext(ctx context.Context, db *sql.DB) ([]*Project, error) {
 	fields := strings.Join(ProjectTableKeys, ", ")
-	stmt := fmt.Sprintf("SELECT %s FROM projects", fields)
-	rows, err := db.Query(stmt)
+	stmt := fmt.Sprintf("SELECT %s FROM projects WHERE project NOT IN (SELECT project FROM archived_projects)", fields)
+	rows, err := dbQuery(ctx, db, stmt)
 	if err != nil {
 		return nil, err
 	}
+	defer rows.Close()
 	prjs := make([]*Project, 0)
 	for rows.Next() {
 		p, err := projectFromRows(rows)
@@ -284,26 +339,170 @@ func AllProjects(db *sql.DB) ([]*Project, error) {
 	return prjs, nil
 }
 
+var CreateTableIfNotExistsProjectTagsStmt = `CREATE TABLE IF NOT EXISTS project_tags (
+	uniqid UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+	project STRING NOT NULL UNIQUE CHECK (length(project) > 0) CHECK (project NOT LIKE '% %'),
+	tags STRING[] NOT NULL
+)`
+
+// SetProjectTags는 프로젝트에서 샷에 사용할 태그 목록을 db에 기록한다.
+// 이미 기록된 목록이 있다면 덮어쓴다.
+func SetProjectTags(db *sql.DB, prj string, tags []string) error {
+	return SetProjectTagsContext(context.Background(), db, prj, tags)
+}
+
+// SetProjectTagsContext는 ctx를 받는 SetProjectTags이다.
+func SetProjectTagsContext(ctx context.Context, db *sql.DB, prj string, tags []string) error {
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("could not begin a transaction: %w", err)
+	}
+	defer tx.Rollback() // 트랜잭션이 완료되지 않았을 때만 실행됨
+	if err := setProjectTags(ctx, tx, prj, tags); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// setProjectTags는 트랜잭션 안에서 프로젝트의 태그 목록을 기록한다.
+func setProjectTags(ctx context.Context, tx *sql.Tx, prj string, tags []string) error {
+	if !IsValidProject(prj) {
+		return errorf(ErrInvalid, "Project id is invalid: %s", prj)
+	}
+	if tags == nil {
+		tags = []string{}
+	}
+	v := &validator{}
+	v.checkTags("tags", tags)
+	if err := v.err(); err != nil {
+		return err
+	}
+	if _, err := dbExec(ctx, tx, "UPSERT INTO project_tags (project, tags) VALUES ($1, $2)", prj, pq.Array(tags)); err != nil {
+		return err
+	}
+	return nil
+}
+
+// GetProjectTags는 db에서 프로젝트의 태그 목록을 불러온다.
+// 기록된 목록이 없다면 빈 슬라이스를 반환한다.
+func GetProjectTags(db *sql.DB, prj string) ([]string, error) {
+	return GetProjectTagsContext(context.Background(), db, prj)
+}
+
+// GetProjectTagsContext는 ctx를 받는 GetProjectTags이다.
+func GetProjectTagsContext(ctx context.Context, db *sql.DB, prj string) ([]string, error) {
+	rows, err := dbQuery(ctx, db, "SELECT tags FROM project_tags WHERE project=$1", prj)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	tags := []string{}
+	if !rows.Next() {
+		return tags, nil
+	}
+	if err := rows.Scan(pq.Array(&tags)); err != nil {
+		return nil, err
+	}
+	return tags, nil
+}
+
 // DeleteProject는 해당 프로젝트와 그 하위의 모든 데이터를 db에서 지운다.
 // 해당 프로젝트가 없어도 에러를 내지 않기 때문에 검사를 원한다면 ProjectExist를 사용해야 한다.
 // 만일 처리 중간에 에러가 나면 아무 데이터도 지우지 않고 에러를 반환한다.
 func DeleteProject(db *sql.DB, prj string) error {
-	tx, err := db.Begin()
+	return DeleteProjectContext(context.Background(), db, prj)
+}
+
+// DeleteProjectContext는 ctx를 받는 DeleteProject이다.
+func DeleteProjectContext(ctx context.Context, db *sql.DB, prj string) error {
+	tx, err := db.BeginTx(ctx, nil)
 	if err != nil {
-		return fmt.Errorf("could not begin a transaction: %v", err)
+		return fmt.Errorf("could not begin a transaction: %w", err)
 	}
 	defer tx.Rollback() // 트랜잭션이 완료되지 않았을 때만 실행됨
-	if _, err := tx.Exec("DELETE FROM projects WHERE project=$1", prj); err != nil {
-		return fmt.Errorf("could not delete data from 'projects' table: %v", err)
+	if err := deleteProject(ctx, tx, prj); err != nil {
+		return err
+	}
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+	// 썸네일 등 프로젝트의 사용자 데이터 파일도 지운다.
+	for _, kind := range archiveUserDataKinds {
+		if err := os.RemoveAll(filepath.Join(UserDataDir, kind, prj)); err != nil {
+			return fmt.Errorf("could not delete %s files: %w", kind, err)
+		}
+	}
+	return nil
+}
+
+// deleteProject는 트랜잭션 안에서 해당 프로젝트와 그 하위의 모든 데이터를 db에서 지운다.
+// 사용자 데이터 파일은 지우지 않는다.
+func deleteProject(ctx context.Context, tx *sql.Tx, prj string) error {
+	if _, err := dbExec(ctx, tx, "DELETE FROM projects WHERE project=$1", prj); err != nil {
+		return fmt.Errorf("could not delete data from 'projects' table: %w", err)
 	}
-	if _, err := tx.Exec("DELETE FROM shots WHERE project=$1", prj); err != nil {
-		return fmt.Errorf("could not delete data from 'shots' table: %v", err)
+	if _, err := dbExec(ctx, tx, "DELETE FROM shots WHERE project=$1", prj); err != nil {
+		return fmt.Errorf("could not delete data from 'shots' table: %w", err)
 	}
-	if _, err := tx.Exec("DELETE FROM tasks WHERE project=$1", prj); err != nil {
-		return fmt.Errorf("could not delete data from 'tasks' table: %v", err)
+	if _, err := dbExec(ctx, tx, "DELETE FROM tasks WHERE project=$1", prj); err != nil {
+		return fmt.Errorf("could not delete data from 'tasks' table: %w", err)
 	}
-	if _, err := tx.Exec("DELETE FROM versions WHERE project=$1", prj); err != nil {
-		return fmt.Errorf("could not delete data from 'versions' table: %v", err)
+	if _, err := dbExec(ctx, tx, "DELETE FROM version_files WHERE project=$1", prj); err != nil {
+		return fmt.Errorf("could not delete data from 'version_files' table: %w", err)
 	}
-	return tx.Commit()
+	if _, err := dbExec(ctx, tx, "DELETE FROM versions WHERE project=$1", prj); err != nil {
+		return fmt.Errorf("could not delete data from 'versions' table: %w", err)
+	}
+	if _, err := dbExec(ctx, tx, "DELETE FROM project_paths WHERE project=$1", prj); err != nil {
+		return fmt.Errorf("could not delete data from 'project_paths' table: %w", err)
+	}
+	if _, err := dbExec(ctx, tx, "DELETE FROM project_tags WHERE project=$1", prj); err != nil {
+		return fmt.Errorf("could not delete data from 'project_tags' table: %w", err)
+	}
+	if _, err := dbExec(ctx, tx, "DELETE FROM ingest_quarantine WHERE project=$1", prj); err != nil {
+		return fmt.Errorf("could not delete data from 'ingest_quarantine' table: %w", err)
+	}
+	if _, err := dbExec(ctx, tx, "DELETE FROM playlist_items WHERE project=$1", prj); err != nil {
+		return fmt.Errorf("could not delete data from 'playlist_items' table: %w", err)
+	}
+	if _, err := dbExec(ctx, tx, "DELETE FROM playlists WHERE project=$1", prj); err != nil {
+		return fmt.Errorf("could not delete data from 'playlists' table: %w", err)
+	}
+	if _, err := dbExec(ctx, tx, "DELETE FROM review_session_items WHERE project=$1", prj); err != nil {
+		return fmt.Errorf("could not delete data from 'review_session_items' table: %w", err)
+	}
+	if _, err := dbExec(ctx, tx, "DELETE FROM review_sessions WHERE project=$1", prj); err != nil {
+		return fmt.Errorf("could not delete data from 'review_sessions' table: %w", err)
+	}
+	if _, err := dbExec(ctx, tx, "DELETE FROM reviews WHERE project_id=$1", prj); err != nil {
+		return fmt.Errorf("could not delete data from 'reviews' table: %w", err)
+	}
+	if _, err := dbExec(ctx, tx, "DELETE FROM annotations WHERE project=$1", prj); err != nil {
+		return fmt.Errorf("could not delete data from 'annotations' table: %w", err)
+	}
+	if _, err := dbExec(ctx, tx, "DELETE FROM delivery_items WHERE project=$1", prj); err != nil {
+		return fmt.Errorf("could not delete data from 'delivery_items' table: %w", err)
+	}
+	if _, err := dbExec(ctx, tx, "DELETE FROM deliveries WHERE project=$1", prj); err != nil {
+		return fmt.Errorf("could not delete data from 'deliveries' table: %w", err)
+	}
+	if _, err := dbExec(ctx, tx, "DELETE FROM vendor_tasks WHERE project=$1", prj); err != nil {
+		return fmt.Errorf("could not delete data from 'vendor_tasks' table: %w", err)
+	}
+	if _, err := dbExec(ctx, tx, "DELETE FROM notifications WHERE project=$1", prj); err != nil {
+		return fmt.Errorf("could not delete data from 'notifications' table: %w", err)
+	}
+	if _, err := dbExec(ctx, tx, "DELETE FROM search_words WHERE project=$1", prj); err != nil {
+		return fmt.Errorf("could not delete data from 'search_words' table: %w", err)
+	}
+	if _, err := dbExec(ctx, tx, "DELETE FROM archived_projects WHERE project=$1", prj); err != nil {
+		return fmt.Errorf("could not delete data from 'archived_projects' table: %w", err)
+	}
+	if _, err := dbExec(ctx, tx, "DELETE FROM trash WHERE project=$1", prj); err != nil {
+		return fmt.Errorf("could not delete data from 'trash' table: %w", err)
+	}
+	if _, err := dbExec(ctx, tx, "DELETE FROM shot_aliases WHERE project=$1", prj); err != nil {
+		return fmt.Errorf("could not delete data from 'shot_aliases' table: %w", err)
+	}
+	return nil
 }
@@ -0,0 +1,439 @@
+package roi
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+var reValidProjectTemplate = regexp.MustCompile(`^[a-zA-Z0-9_-]+$`)
+
+// IsValidProjectTemplate은 해당 이름이 프로젝트 템플릿 이름으로 적절한지 여부를 반환한다.
+func IsValidProjectTemplate(name string) bool {
+	return reValidProjectTemplate.MatchString(name)
+}
+
+// ProjectTemplate은 새 프로젝트를 만들 때 그대로 가져다 쓸 수 있는 프로젝트 설정의 모음이다.
+// 프로젝트 정보 중 작품마다 달라지는 클라이언트, 인력, 일정은 포함하지 않는다.
+type ProjectTemplate struct {
+	Template    string
+	Description string
+
+	OutputSize string
+	ViewLUT    string
+	// DefaultTasks는 샷에 기본으로 만들어질 태스크들이며 순서가 곧 작업 순서이다.
+	DefaultTasks []string
+	// Tags는 샷에 사용할 태그 목록이다.
+	Tags []string
+
+	// 경로 템플릿
+	PathWork   string
+	PathRender string
+	PathMov    string
+	PathPlate  string
+	CreateDirs bool
+	// IngestNaming은 인제스트할 파일 이름의 템플릿이다. ProjectPaths 참고.
+	IngestNaming string
+}
+
+func (t *ProjectTemplate) dbValues() []interface{} {
+	if t == nil {
+		t = &ProjectTemplate{}
+	}
+	if t.DefaultTasks == nil {
+		t.DefaultTasks = []string{}
+	}
+	if t.Tags == nil {
+		t.Tags = []string{}
+	}
+	return []interface{}{
+		t.Template,
+		t.Description,
+		t.OutputSize,
+		t.ViewLUT,
+		pq.Array(t.DefaultTasks),
+		pq.Array(t.Tags),
+		t.PathWork,
+		t.PathRender,
+		t.PathMov,
+		t.PathPlate,
+		t.CreateDirs,
+		t.IngestNaming,
+	}
+}
+
+var CreateTableIfNotExistsProjectTemplatesStmt = `CREATE TABLE IF NOT EXISTS project_templates (
+	uniqid UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+	template STRING NOT NULL UNIQUE CHECK (length(template) > 0) CHECK (template NOT LIKE '% %'),
+	description STRING NOT NULL,
+	output_size STRING NOT NULL,
+	view_lut STRING NOT NULL,
+	default_tasks STRING[] NOT NULL,
+	tags STRING[] NOT NULL,
+	path_work STRING NOT NULL,
+	path_render STRING NOT NULL,
+	path_mov STRING NOT NULL,
+	path_plate STRING NOT NULL,
+	create_dirs BOOL NOT NULL,
+	ingest_naming STRING NOT NULL
+)`
+
+var ProjectTemplateTableKeys = []string{
+	"template",
+	"description",
+	"output_size",
+	"view_lut",
+	"default_tasks",
+	"tags",
+	"path_work",
+	"path_render",
+	"path_mov",
+	"path_plate",
+	"create_dirs",
+	"ingest_naming",
+}
+
+var ProjectTemplateTableIndices = dbIndices(ProjectTemplateTableKeys)
+
+// Paths는 템플릿의 경로 템플릿을 해당 프로젝트의 경로 템플릿으로 반환한다.
+func (t *ProjectTemplate) Paths(prj string) *ProjectPaths {
+	return &ProjectPaths{
+		Project:      prj,
+		Work:         t.PathWork,
+		Render:       t.PathRender,
+		Mov:          t.PathMov,
+		Plate:        t.PathPlate,
+		CreateDirs:   t.CreateDirs,
+		IngestNaming: t.IngestNaming,
+	}
+}
+
+// check는 템플릿이 db에 기록되거나 프로젝트에 적용될 수 있는지 검사한다.
+func (t *ProjectTemplate) check() error {
+	v := &validator{}
+	v.check(IsValidProjectTemplate(t.Template), "template", "invalid project template name: '%s'", t.Template)
+	v.checkTasks("default_tasks", t.DefaultTasks)
+	v.checkTags("tags", t.Tags)
+	for _, k := range AllPathKinds {
+		err := checkPathTemplate(t.Paths("").Template(k))
+		v.check(err == nil, "path_"+string(k), "invalid path template: %v", err)
+	}
+	err := checkIngestNaming(t.IngestNaming)
+	v.check(err == nil, "ingest_naming", "%v", err)
+	return v.err()
+}
+
+// AddProjectTemplate은 db에 프로젝트 템플릿을 추가한다.
+// 같은 이름의 템플릿이 있다면 덮어쓴다.
+func AddProjectTemplate(db *sql.DB, t *ProjectTemplate) error {
+	return AddProjectTemplateContext(context.Background(), db, t)
+}
+
+// AddProjectTemplateContext는 ctx를 받는 AddProjectTemplate이다.
+func AddProjectTemplateContext(ctx context.Context, db *sql.DB, t *ProjectTemplate) error {
+	if t == nil {
+		return errorf(ErrInvalid, "nil ProjectTemplate is invalid")
+	}
+	if err := t.check(); err != nil {
+		return err
+	}
+	keystr := strings.Join(ProjectTemplateTableKeys, ", ")
+	idxstr := strings.Join(ProjectTemplateTableIndices, ", ")
+	stmt := fmt.Sprintf("UPSERT INTO project_templates (%s) VALUES (%s)", keystr, idxstr)
+	if _, err := dbExec(ctx, db, stmt, t.dbValues()...); err != nil {
+		return err
+	}
+	return nil
+}
+
+// projectTemplateFromRows는 테이블의 한 열에서 프로젝트 템플릿을 받아온다.
+func projectTemplateFromRows(rows *sql.Rows) (*ProjectTemplate, error) {
+	t := &ProjectTemplate{}
+	err := rows.Scan(
+		&t.Template, &t.Description, &t.OutputSize, &t.ViewLUT,
+		pq.Array(&t.DefaultTasks), pq.Array(&t.Tags),
+		&t.PathWork, &t.PathRender, &t.PathMov, &t.PathPlate, &t.CreateDirs, &t.IngestNaming,
+	)
+	if err != nil {
+		return nil, err
+	}
+	return t, nil
+}
+
+// GetProjectTemplate은 db에서 프로젝트 템플릿을 불러온다.
+// 해당 템플릿이 없다면 nil이 반환된다.
+func GetProjectTemplate(db *sql.DB, name string) (*ProjectTemplate, error) {
+	return GetProjectTemplateContext(context.Background(), db, name)
+}
+
+// GetProjectTemplateContext는 ctx를 받는 GetProjectTemplate이다.
+func GetProjectTemplateContext(ctx context.Context, db *sql.DB, name string) (*ProjectTemplate, error) {
+	keystr := strings.Join(ProjectTemplateTableKeys, ", ")
+	stmt := fmt.Sprintf("SELECT %s FROM project_templates WHERE template=$1", keystr)
+	rows, err := dbQuery(ctx, db, stmt, name)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	if !rows.Next() {
+		return nil, nil
+	}
+	return projectTemplateFromRows(rows)
+}
+
+// AllProjectTemplates는 db의 모든 프로젝트 템플릿을 이름 순서로 반환한다.
+func AllProjectTemplates(db *sql.DB) ([]*ProjectTemplate, error) {
+	return AllProjectTemplatesContext(context.Background(), db)
+}
+
+// AllProjectTemplatesContext는 ctx를 받는 AllProjectTemplates이다.
+func AllProjectTemplatesContext(ctx context.Context, db *sql.DB) ([]*ProjectTemplate, error) {
+	keystr := strings.Join(ProjectTemplateTableKeys, ", ")
+	stmt := fmt.Sprintf("SELECT %s FROM project_templates ORDER BY template", keystr)
+	rows, err := dbQuery(ctx, db, stmt)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	ts := make([]*ProjectTemplate, 0)
+	for rows.Next() {
+		t, err := projectTemplateFromRows(rows)
+		if err != nil {
+			return nil, err
+		}
+		ts = append(ts, t)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return ts, nil
+}
+
+// DeleteProjectTemplate은 db에서 프로젝트 템플릿을 지운다.
+// 이미 만들어진 프로젝트에는 영향을 주지 않는다.
+func DeleteProjectTemplate(db *sql.DB, name string) error {
+	return DeleteProjectTemplateContext(context.Background(), db, name)
+}
+
+// DeleteProjectTemplateContext는 ctx를 받는 DeleteProjectTemplate이다.
+func DeleteProjectTemplateContext(ctx context.Context, db *sql.DB, name string) error {
+	if _, err := dbExec(ctx, db, "DELETE FROM project_templates WHERE template=$1", name); err != nil {
+		return fmt.Errorf("could not delete data from 'project_templates' table: %w", err)
+	}
+	return nil
+}
+
+// ProjectTemplateFromProject는 기존 프로젝트의 설정, 기본 태스크, 태그 목록, 경로 템플릿으로
+// name 이름의 프로젝트 템플릿을 만든다. 만든 템플릿을 db에 기록하지는 않는다.
+// 해당 프로젝트가 없다면 에러를 반환한다.
+func ProjectTemplateFromProject(db *sql.DB, prj, name string) (*ProjectTemplate, error) {
+	return ProjectTemplateFromProjectContext(context.Background(), db, prj, name)
+}
+
+// ProjectTemplateFromProjectContext는 ctx를 받는 ProjectTemplateFromProject이다.
+func ProjectTemplateFromProjectContext(ctx context.Context, db *sql.DB, prj, name string) (*ProjectTemplate, error) {
+	p, err := GetProjectContext(ctx, db, prj)
+	if err != nil {
+		return nil, err
+	}
+	if p == nil {
+		return nil, errorf(ErrNotFound, "project not exist: %s", prj)
+	}
+	tags, err := GetProjectTagsContext(ctx, db, prj)
+	if err != nil {
+		return nil, err
+	}
+	paths, err := GetProjectPathsContext(ctx, db, prj)
+	if err != nil {
+		return nil, err
+	}
+	if paths == nil {
+		paths = &ProjectPaths{}
+	}
+	t := &ProjectTemplate{
+		Template:     name,
+		OutputSize:   p.OutputSize,
+		ViewLUT:      p.ViewLUT,
+		DefaultTasks: p.DefaultTasks,
+		Tags:         tags,
+		PathWork:     paths.Work,
+		PathRender:   paths.Render,
+		PathMov:      paths.Mov,
+		PathPlate:    paths.Plate,
+		CreateDirs:   paths.CreateDirs,
+		IngestNaming: paths.IngestNaming,
+	}
+	return t, nil
+}
+
+// AddProjectFromTemplate은 템플릿의 설정을 적용한 프로젝트를 db에 추가한다.
+// 프로젝트의 아웃풋 사이즈, 뷰 LUT, 기본 태스크 중 비어있는 것은 템플릿의 값으로 채워지며,
+// 태그 목록과 경로 템플릿은 템플릿의 것을 그대로 사용한다.
+// 만일 처리 중간에 에러가 나면 프로젝트를 추가하지 않고 에러를 반환한다.
+func AddProjectFromTemplate(db *sql.DB, p *Project, t *ProjectTemplate) error {
+	return AddProjectFromTemplateContext(context.Background(), db, p, t)
+}
+
+// AddProjectFromTemplateContext는 ctx를 받는 AddProjectFromTemplate이다.
+func AddProjectFromTemplateContext(ctx context.Context, db *sql.DB, p *Project, t *ProjectTemplate) error {
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("could not begin a transaction: %w", err)
+	}
+	defer tx.Rollback() // 트랜잭션이 완료되지 않았을 때만 실행됨
+	if err := addProjectFromTemplate(ctx, tx, p, t); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// addProjectFromTemplate은 트랜잭션 안에서 템플릿의 설정을 적용한 프로젝트를 추가한다.
+func addProjectFromTemplate(ctx context.Context, tx *sql.Tx, p *Project, t *ProjectTemplate) error {
+	if p == nil {
+		return errorf(ErrInvalid, "nil Project is invalid")
+	}
+	if t == nil {
+		return errorf(ErrInvalid, "nil ProjectTemplate is invalid")
+	}
+	if err := t.check(); err != nil {
+		return err
+	}
+	if p.OutputSize == "" {
+		p.OutputSize = t.OutputSize
+	}
+	if p.ViewLUT == "" {
+		p.ViewLUT = t.ViewLUT
+	}
+	if len(p.DefaultTasks) == 0 {
+		p.DefaultTasks = append([]string{}, t.DefaultTasks...)
+	}
+	if err := addProject(ctx, tx, p); err != nil {
+		return err
+	}
+	if err := setProjectTags(ctx, tx, p.Project, t.Tags); err != nil {
+		return err
+	}
+	if err := setProjectPaths(ctx, tx, t.Paths(p.Project)); err != nil {
+		return err
+	}
+	return nil
+}
+
+// CloneProject는 기존 src 프로젝트의 설정으로 새 프로젝트 p를 db에 추가한다.
+// withShots가 참이면 src의 샷과 태스크도 복사한다. 복사된 샷과 태스크는 처음 상태로 돌아가며,
+// 버전과 리뷰 등 작업 결과물은 복사되지 않는다.
+// 만일 처리 중간에 에러가 나면 아무것도 추가하지 않고 에러를 반환한다.
+func CloneProject(db *sql.DB, src string, p *Project, withShots bool) error {
+	return CloneProjectContext(context.Background(), db, src, p, withShots)
+}
+
+// CloneProjectContext는 ctx를 받는 CloneProject이다.
+func CloneProjectContext(ctx context.Context, db *sql.DB, src string, p *Project, withShots bool) error {
+	t, err := ProjectTemplateFromProjectContext(ctx, db, src, "")
+	if err != nil {
+		return err
+	}
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("could not begin a transaction: %w", err)
+	}
+	defer tx.Rollback() // 트랜잭션이 완료되지 않았을 때만 실행됨
+	if err := addProjectFromTemplate(ctx, tx, p, t); err != nil {
+		return err
+	}
+	var dirs []PathTokens
+	if withShots {
+		dirs, err = cloneShots(ctx, tx, src, p.Project)
+		if err != nil {
+			return err
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+	return createPathDirs(ctx, db, dirs...)
+}
+
+// cloneShots는 트랜잭션 안에서 src 프로젝트의 샷과 태스크를 dst 프로젝트로 복사하고,
+// 트랜잭션이 커밋된 뒤 경로 디렉토리를 만들 샷과 태스크의 토큰을 반환한다.
+// 샷 정보와 작업할 태스크 목록, 담당자는 유지하지만 상태와 일정은 처음으로 돌아간다.
+func cloneShots(ctx context.Context, tx *sql.Tx, src, dst string) ([]PathTokens, error) {
+	keystr := strings.Join(ShotTableKeys, ", ")
+	stmt := fmt.Sprintf("SELECT %s FROM shots WHERE project=$1", keystr)
+	rows, err := dbQuery(ctx, tx, stmt, src)
+	if err != nil {
+		return nil, err
+	}
+	shots := make([]*Shot, 0)
+	for rows.Next() {
+		s, err := shotFromRows(rows)
+		if err != nil {
+			rows.Close()
+			return nil, err
+		}
+		shots = append(shots, s)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	keystr = strings.Join(TaskTableKeys, ", ")
+	stmt = fmt.Sprintf("SELECT %s FROM tasks WHERE project=$1", keystr)
+	rows, err = dbQuery(ctx, tx, stmt, src)
+	if err != nil {
+		return nil, err
+	}
+	tasks := make([]*Task, 0)
+	for rows.Next() {
+		t, err := taskFromRows(rows)
+		if err != nil {
+			rows.Close()
+			return nil, err
+		}
+		tasks = append(tasks, t)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	keystr = strings.Join(ShotTableKeys, ", ")
+	idxstr := strings.Join(ShotTableIndices, ", ")
+	dirs := make([]PathTokens, 0, len(shots)+len(tasks))
+	shotStmt := fmt.Sprintf("INSERT INTO shots (%s) VALUES (%s)", keystr, idxstr)
+	for _, s := range shots {
+		s.Project = dst
+		s.Status = ShotWaiting
+		s.StartDate = time.Time{}
+		s.EndDate = time.Time{}
+		s.DueDate = time.Time{}
+		if _, err := dbExec(ctx, tx, shotStmt, s.dbValues()...); err != nil {
+			return nil, fmt.Errorf("could not clone shot %s: %w", s.Shot, err)
+		}
+		if err := indexSearchWords(ctx, tx, dst, SearchShot, s.Shot, shotSearchFields(s.Shot, s.Description, s.CGDescription, s.Tags)); err != nil {
+			return nil, err
+		}
+		dirs = append(dirs, PathTokens{Project: dst, Shot: s.Shot})
+	}
+	keystr = strings.Join(TaskTableKeys, ", ")
+	idxstr = strings.Join(TaskTableIndices, ", ")
+	taskStmt := fmt.Sprintf("INSERT INTO tasks (%s) VALUES (%s)", keystr, idxstr)
+	for _, t := range tasks {
+		t.Project = dst
+		t.Status = TaskNotSet
+		t.LastOutputVersion = 0
+		t.StartDate = time.Time{}
+		t.EndDate = time.Time{}
+		t.DueDate = time.Time{}
+		if _, err := dbExec(ctx, tx, taskStmt, t.dbValues()...); err != nil {
+			return nil, fmt.Errorf("could not clone task %s.%s: %w", t.Shot, t.Task, err)
+		}
+		dirs = append(dirs, PathTokens{Project: dst, Shot: t.Shot, Task: t.Task})
+	}
+	return dirs, nil
+}
@@ -0,0 +1,136 @@
+package roi
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestIsValidProjectTemplate(t *testing.T) {
+	cases := []struct {
+		name string
+		want bool
+	}{
+		{"feature", true},
+		{"feature_4k-aces", true},
+		{"", false},
+		{"feature film", false},
+		{"feature/4k", false},
+	}
+	for _, c := range cases {
+		got := IsValidProjectTemplate(c.name)
+		if got != c.want {
+			t.Fatalf("IsValidProjectTemplate(%q): got %v, want %v", c.name, got, c.want)
+		}
+	}
+}
+
+func TestProjectTemplate(t *testing.T) {
+	db, err := testDB()
+	if err != nil {
+		t.Fatalf("could not connect to database: %v", err)
+	}
+	src := *testProject
+	src.DefaultTasks = []string{"mm", "fx", "comp"}
+	err = AddProject(db, &src)
+	if err != nil {
+		t.Fatalf("could not add project: %v", err)
+	}
+	paths := &ProjectPaths{
+		Project: src.Project,
+		Work:    "/show/{project}/{shot}/{task}/work",
+		Plate:   "/show/{project}/{shot}/plate",
+	}
+	err = SetProjectPaths(db, paths)
+	if err != nil {
+		t.Fatalf("could not set project paths: %v", err)
+	}
+	tags := []string{"rain", "night"}
+	err = SetProjectTags(db, src.Project, tags)
+	if err != nil {
+		t.Fatalf("could not set project tags: %v", err)
+	}
+	err = AddShot(db, src.Project, testShotA)
+	if err != nil {
+		t.Fatalf("could not add shot: %v", err)
+	}
+	err = AddTask(db, src.Project, testShotA.Shot, testTaskA)
+	if err != nil {
+		t.Fatalf("could not add task: %v", err)
+	}
+
+	tmpl, err := ProjectTemplateFromProject(db, src.Project, "feature")
+	if err != nil {
+		t.Fatalf("could not make project template: %v", err)
+	}
+	err = AddProjectTemplate(db, tmpl)
+	if err != nil {
+		t.Fatalf("could not add project template: %v", err)
+	}
+	got, err := GetProjectTemplate(db, "feature")
+	if err != nil {
+		t.Fatalf("could not get project template: %v", err)
+	}
+	if !reflect.DeepEqual(got, tmpl) {
+		t.Fatalf("got: %v, want: %v", got, tmpl)
+	}
+
+	// 템플릿으로 만든 프로젝트는 설정을 가져오지만 샷은 가져오지 않는다.
+	fromTmpl := &Project{Project: "TESTTMPL", Status: "waiting"}
+	err = AddProjectFromTemplate(db, fromTmpl, got)
+	if err != nil {
+		t.Fatalf("could not add project from template: %v", err)
+	}
+	p, err := GetProject(db, fromTmpl.Project)
+	if err != nil {
+		t.Fatalf("could not get project: %v", err)
+	}
+	if p.OutputSize != src.OutputSize || p.ViewLUT != src.ViewLUT || !reflect.DeepEqual(p.DefaultTasks, src.DefaultTasks) {
+		t.Fatalf("project settings not applied from template: %v", p)
+	}
+	gotTags, err := GetProjectTags(db, fromTmpl.Project)
+	if err != nil {
+		t.Fatalf("could not get project tags: %v", err)
+	}
+	if !reflect.DeepEqual(gotTags, tags) {
+		t.Fatalf("project tags: got %v, want %v", gotTags, tags)
+	}
+	gotPaths, err := GetProjectPaths(db, fromTmpl.Project)
+	if err != nil {
+		t.Fatalf("could not get project paths: %v", err)
+	}
+	if gotPaths == nil || gotPaths.Work != paths.Work || gotPaths.Plate != paths.Plate {
+		t.Fatalf("project paths not applied from template: %v", gotPaths)
+	}
+	exist, err := ShotExist(db, fromTmpl.Project, testShotA.Shot)
+	if err != nil {
+		t.Fatalf("could not check shot exist: %v", err)
+	}
+	if exist {
+		t.Fatalf("shot should not be copied from template")
+	}
+
+	// 샷과 함께 복사한 프로젝트의 태스크는 처음 상태여야 한다.
+	clone := &Project{Project: "TESTCLONE", Status: "waiting"}
+	err = CloneProject(db, src.Project, clone, true)
+	if err != nil {
+		t.Fatalf("could not clone project: %v", err)
+	}
+	task, err := GetTask(db, clone.Project, testShotA.Shot, testTaskA.Task)
+	if err != nil {
+		t.Fatalf("could not get cloned task: %v", err)
+	}
+	if task == nil || task.Status != TaskNotSet || task.LastOutputVersion != 0 || task.Assignee != testTaskA.Assignee {
+		t.Fatalf("unexpected cloned task: %v", task)
+	}
+
+	err = DeleteProjectTemplate(db, "feature")
+	if err != nil {
+		t.Fatalf("could not delete project template: %v", err)
+	}
+	for _, prj := range []string{src.Project, fromTmpl.Project, clone.Project} {
+		err = DeleteProject(db, prj)
+		if err != nil {
+			t.Fatalf("could not delete project: %v", err)
+		}
+	}
+}
@@ -0,0 +1,257 @@
+package roi
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/lib/pq"
+)
+
+// 로이의 모든 SQL 구문은 이 파일의 dbQuery, dbQueryRow, dbExec를 통해 실행된다.
+// 이 함수들은 실행 전에 checkStmt로 구문을 검사해 사용자 입력이 구문에 직접 섞이는 것을 막는다.
+// 값이 들어가는 구문은 되도록 sqlQuery 빌더로 만들어, 값이 항상 $N 자리표시자로 전달되게 한다.
+
+// sqlQueryer는 *sql.DB와 *sql.Tx 모두에서 구문으로 열들을 읽기 위한 인터페이스이다.
+type sqlQueryer interface {
+	QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error)
+}
+
+// sqlRowQueryer는 *sql.DB와 *sql.Tx 모두에서 구문으로 한 열을 읽기 위한 인터페이스이다.
+type sqlRowQueryer interface {
+	QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row
+}
+
+// sqlExecer는 *sql.DB와 *sql.Tx 모두에서 구문을 실행하기 위한 인터페이스이다.
+type sqlExecer interface {
+	ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error)
+}
+
+// rePlaceholder는 구문 안의 $N 자리표시자를 찾는다.
+var rePlaceholder = regexp.MustCompile(`\$([0-9]+)`)
+
+// checkStmt는 구문이 값을 자리표시자로만 받는지 검사한다.
+// 빈 문자열 리터럴을 제외한 문자열 리터럴, 주석, 여러 구문이 들어 있거나
+// 자리표시자의 수와 인자의 수가 다르면 에러를 반환한다.
+func checkStmt(stmt string, args []interface{}) error {
+	if strings.Contains(strings.Replace(stmt, "''", "", -1), "'") {
+		return fmt.Errorf("string literal in sql statement: %s", stmt)
+	}
+	if strings.Contains(stmt, "--") || strings.Contains(stmt, "/*") {
+		return fmt.Errorf("comment in sql statement: %s", stmt)
+	}
+	if strings.Contains(stmt, ";") {
+		return fmt.Errorf("multiple sql statements: %s", stmt)
+	}
+	n := 0
+	for _, m := range rePlaceholder.FindAllStringSubmatch(stmt, -1) {
+		i, err := strconv.Atoi(m[1])
+		if err != nil {
+			return fmt.Errorf("invalid placeholder in sql statement: %s", stmt)
+		}
+		if i > n {
+			n = i
+		}
+	}
+	if n != len(args) {
+		return fmt.Errorf("sql statement needs %d args, got %d: %s", n, len(args), stmt)
+	}
+	return nil
+}
+
+// dbQuery는 구문을 검사한 뒤 q에서 실행해 열들을 반환한다.
+func dbQuery(ctx context.Context, q sqlQueryer, stmt string, args ...interface{}) (*sql.Rows, error) {
+	if err := checkStmt(stmt, args); err != nil {
+		return nil, err
+	}
+	rows, err := q.QueryContext(ctx, stmt, args...)
+	return rows, dbError(err)
+}
+
+// sqlRow는 dbQueryRow가 반환하는 한 열이다.
+type sqlRow struct {
+	row *sql.Row
+	// err는 구문 검사에서 난 에러이다.
+	err error
+}
+
+// Scan은 열의 값들을 dest에 읽는다. 구문 검사에서 에러가 났다면 그 에러를 반환한다.
+func (r *sqlRow) Scan(dest ...interface{}) error {
+	if r.err != nil {
+		return r.err
+	}
+	return dbError(r.row.Scan(dest...))
+}
+
+// dbQueryRow는 구문을 검사한 뒤 q에서 실행해 한 열을 반환한다.
+// 구문 검사에서 난 에러는 Scan을 할 때 반환된다.
+func dbQueryRow(ctx context.Context, q sqlRowQueryer, stmt string, args ...interface{}) *sqlRow {
+	if err := checkStmt(stmt, args); err != nil {
+		return &sqlRow{err: err}
+	}
+	return &sqlRow{row: q.QueryRowContext(ctx, stmt, args...)}
+}
+
+// dbExec는 구문을 검사한 뒤 e에서 실행한다.
+func dbExec(ctx context.Context, e sqlExecer, stmt string, args ...interface{}) (sql.Result, error) {
+	if err := checkStmt(stmt, args); err != nil {
+		return nil, err
+	}
+	res, err := e.ExecContext(ctx, stmt, args...)
+	return res, dbError(err)
+}
+
+// dbError는 DB가 반환한 에러 중 사용자의 입력 때문에 생긴 에러를
+// 알맞은 종류의 로이 에러로 감싼다. 그 외의 에러는 그대로 반환한다.
+func dbError(err error) error {
+	e, ok := err.(*pq.Error)
+	if !ok {
+		return err
+	}
+	switch {
+	case e.Code.Name() == "unique_violation":
+		return &Error{Kind: ErrExists, Err: err}
+	case e.Code.Name() == "foreign_key_violation", e.Code.Name() == "serialization_failure":
+		return &Error{Kind: ErrConflict, Err: err}
+	case e.Code.Name() == "check_violation", e.Code.Class().Name() == "data_exception":
+		return &Error{Kind: ErrInvalid, Err: err}
+	}
+	return err
+}
+
+// reIdentifier는 구문에 그대로 들어가는 테이블이나 열 이름으로 적절한지 검사한다.
+var reIdentifier = regexp.MustCompile(`^[a-z_][a-z0-9_]*(\.[a-z_][a-z0-9_]*)?$`)
+
+// mustIdentifier는 name이 테이블이나 열 이름으로 적절하지 않으면 패닉한다.
+// 이름은 코드에 적힌 값만 받아야 하므로, 적절하지 않다면 프로그래머의 실수이다.
+func mustIdentifier(name string) string {
+	if !reIdentifier.MatchString(name) {
+		panic(fmt.Sprintf("invalid sql identifier: %q", name))
+	}
+	return name
+}
+
+// sqlQuery는 테이블 하나에 대한 SELECT, INSERT, UPDATE, DELETE 구문을 만든다.
+// 테이블과 열 이름은 식별자인지 검사하며, 값은 모두 $N 자리표시자로 구문에 넣는다.
+//
+// 예)
+//
+//	q := selectQuery("users", "id", "name").where("id", id)
+//	rows, err := q.query(ctx, db)
+type sqlQuery struct {
+	head  string
+	conds []string
+	tail  string
+	args  []interface{}
+}
+
+// placeholder는 v를 인자에 추가하고 그 자리표시자를 반환한다.
+func (q *sqlQuery) placeholder(v interface{}) string {
+	q.args = append(q.args, v)
+	return "$" + strconv.Itoa(len(q.args))
+}
+
+// selectQuery는 테이블에서 열들을 읽는 구문을 만든다.
+func selectQuery(table string, cols ...string) *sqlQuery {
+	for _, c := range cols {
+		mustIdentifier(c)
+	}
+	return &sqlQuery{head: fmt.Sprintf("SELECT %s FROM %s", strings.Join(cols, ", "), mustIdentifier(table))}
+}
+
+// insertQuery는 테이블에 열 하나를 넣는 구문을 만든다.
+func insertQuery(table string, cols []string, vals []interface{}) *sqlQuery {
+	if len(cols) != len(vals) {
+		panic(fmt.Sprintf("insert into %s: %d columns, %d values", table, len(cols), len(vals)))
+	}
+	q := &sqlQuery{}
+	idxs := make([]string, len(cols))
+	for i, c := range cols {
+		mustIdentifier(c)
+		idxs[i] = q.placeholder(vals[i])
+	}
+	q.head = fmt.Sprintf("INSERT INTO %s (%s) VALUES (%s)", mustIdentifier(table), strings.Join(cols, ", "), strings.Join(idxs, ", "))
+	return q
+}
+
+// updateQuery는 테이블의 열들을 수정하는 구문을 만든다.
+func updateQuery(table string, cols []string, vals []interface{}) *sqlQuery {
+	if len(cols) != len(vals) {
+		panic(fmt.Sprintf("update %s: %d columns, %d values", table, len(cols), len(vals)))
+	}
+	q := &sqlQuery{}
+	sets := make([]string, len(cols))
+	for i, c := range cols {
+		sets[i] = mustIdentifier(c) + "=" + q.placeholder(vals[i])
+	}
+	q.head = fmt.Sprintf("UPDATE %s SET %s", mustIdentifier(table), strings.Join(sets, ", "))
+	return q
+}
+
+// deleteQuery는 테이블에서 열들을 지우는 구문을 만든다.
+func deleteQuery(table string) *sqlQuery {
+	return &sqlQuery{head: "DELETE FROM " + mustIdentifier(table)}
+}
+
+// where는 col 열의 값이 v와 같다는 조건을 AND로 추가한다.
+func (q *sqlQuery) where(col string, v interface{}) *sqlQuery {
+	q.conds = append(q.conds, mustIdentifier(col)+"="+q.placeholder(v))
+	return q
+}
+
+// whereCond는 조건 구문을 AND로 추가한다. 조건 안의 ?는 차례대로 args의 자리표시자로 바뀐다.
+// 조건은 코드에 적힌 구문이어야 하며 사용자 입력은 args로만 전달해야 한다.
+func (q *sqlQuery) whereCond(cond string, args ...interface{}) *sqlQuery {
+	parts := strings.Split(cond, "?")
+	if len(parts)-1 != len(args) {
+		panic(fmt.Sprintf("condition %q needs %d args, got %d", cond, len(parts)-1, len(args)))
+	}
+	b := &strings.Builder{}
+	for i, p := range parts {
+		b.WriteString(p)
+		if i < len(args) {
+			b.WriteString(q.placeholder(args[i]))
+		}
+	}
+	q.conds = append(q.conds, b.String())
+	return q
+}
+
+// orderBy는 열들로 결과를 정렬하게 한다.
+func (q *sqlQuery) orderBy(cols ...string) *sqlQuery {
+	for _, c := range cols {
+		mustIdentifier(c)
+	}
+	q.tail += " ORDER BY " + strings.Join(cols, ", ")
+	return q
+}
+
+// limit은 결과의 수를 n개로 제한한다.
+func (q *sqlQuery) limit(n int) *sqlQuery {
+	q.tail += " LIMIT " + q.placeholder(n)
+	return q
+}
+
+// build는 구문과 그 인자들을 반환한다.
+func (q *sqlQuery) build() (string, []interface{}) {
+	stmt := q.head
+	if len(q.conds) != 0 {
+		stmt += " WHERE " + strings.Join(q.conds, " AND ")
+	}
+	return stmt + q.tail, q.args
+}
+
+// query는 구문을 실행해 열들을 반환한다.
+func (q *sqlQuery) query(ctx context.Context, db sqlQueryer) (*sql.Rows, error) {
+	stmt, args := q.build()
+	return dbQuery(ctx, db, stmt, args...)
+}
+
+// exec는 구문을 실행한다.
+func (q *sqlQuery) exec(ctx context.Context, db sqlExecer) (sql.Result, error) {
+	stmt, args := q.build()
+	return dbExec(ctx, db, stmt, args...)
+}
@@ -0,0 +1,224 @@
+package roi
+
+import (
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// hostileInputs는 구문에 그대로 들어가면 SQL 인젝션을 일으키는 입력들이다.
+var hostileInputs = []string{
+	"' OR '1'='1",
+	"'; DROP TABLE users; --",
+	"x' UNION SELECT hashed_password FROM users --",
+	"$1",
+	"kybin\\'",
+	"/* comment */",
+}
+
+func TestCheckStmt(t *testing.T) {
+	cases := []struct {
+		stmt string
+		args []interface{}
+		ok   bool
+	}{
+		{"SELECT id FROM users WHERE id=$1", []interface{}{"kybin"}, true},
+		{"SELECT id FROM saved_searches WHERE ($1 = '' OR project=$1)", []interface{}{"TEST"}, true},
+		{"SELECT id FROM users WHERE id='kybin'", nil, false},
+		{"SELECT id FROM users WHERE id=$1 -- comment", []interface{}{"kybin"}, false},
+		{"SELECT id FROM users /* comment */", nil, false},
+		{"SELECT id FROM users; DROP TABLE users", nil, false},
+		{"SELECT id FROM users WHERE id=$1 AND name=$2", []interface{}{"kybin"}, false},
+		{"SELECT id FROM users", []interface{}{"kybin"}, false},
+	}
+	for _, c := range cases {
+		err := checkStmt(c.stmt, c.args)
+		if (err == nil) != c.ok {
+			t.Fatalf("checkStmt(%q): got err %v, want ok %v", c.stmt, err, c.ok)
+		}
+	}
+}
+
+func TestSQLQuery(t *testing.T) {
+	cases := []struct {
+		q    *sqlQuery
+		stmt string
+		args []interface{}
+	}{
+		{
+			selectQuery("users", "id", "name").where("id", "kybin").limit(1),
+			"SELECT id, name FROM users WHERE id=$1 LIMIT $2",
+			[]interface{}{"kybin", 1},
+		},
+		{
+			selectQuery("tasks", "task").where("project", "TEST").whereCond("(status=? OR assignee=?)", "done", "kybin").orderBy("shot", "task"),
+			"SELECT task FROM tasks WHERE project=$1 AND (status=$2 OR assignee=$3) ORDER BY shot, task",
+			[]interface{}{"TEST", "done", "kybin"},
+		},
+		{
+			insertQuery("vendors", []string{"vendor", "name"}, []interface{}{"vfx", "VFX"}),
+			"INSERT INTO vendors (vendor, name) VALUES ($1, $2)",
+			[]interface{}{"vfx", "VFX"},
+		},
+		{
+			updateQuery("users", []string{"name", "team"}, []interface{}{"kim", "rnd"}).where("id", "kybin"),
+			"UPDATE users SET name=$1, team=$2 WHERE id=$3",
+			[]interface{}{"kim", "rnd", "kybin"},
+		},
+		{
+			deleteQuery("users").where("id", "kybin"),
+			"DELETE FROM users WHERE id=$1",
+			[]interface{}{"kybin"},
+		},
+	}
+	for _, c := range cases {
+		stmt, args := c.q.build()
+		if stmt != c.stmt {
+			t.Fatalf("got %q, want %q", stmt, c.stmt)
+		}
+		if !reflect.DeepEqual(args, c.args) {
+			t.Fatalf("%s: got args %v, want %v", stmt, args, c.args)
+		}
+		if err := checkStmt(stmt, args); err != nil {
+			t.Fatalf("built statement should pass check: %v", err)
+		}
+	}
+}
+
+func TestSQLQueryIdentifier(t *testing.T) {
+	for _, name := range append(hostileInputs, "", "Users", "users.id.x") {
+		func() {
+			defer func() {
+				if recover() == nil {
+					t.Fatalf("identifier %q should panic", name)
+				}
+			}()
+			selectQuery("users", name)
+		}()
+	}
+}
+
+// FuzzSQLQuery는 어떤 값을 넣어도 값이 구문에 섞이지 않고 인자로만 전달되는지 검사한다.
+func FuzzSQLQuery(f *testing.F) {
+	for _, s := range hostileInputs {
+		f.Add(s)
+	}
+	f.Fuzz(func(t *testing.T, v string) {
+		q := updateQuery("users", []string{"name"}, []interface{}{v}).where("id", v).whereCond("team=?", v)
+		stmt, args := q.build()
+		if stmt != "UPDATE users SET name=$1 WHERE id=$2 AND team=$3" {
+			t.Fatalf("value leaked into statement: %q", stmt)
+		}
+		for _, a := range args {
+			if a != v {
+				t.Fatalf("got arg %q, want %q", a, v)
+			}
+		}
+		if err := checkStmt(stmt, args); err != nil {
+			t.Fatal(err)
+		}
+	})
+}
+
+// FuzzUserID는 공개 함수들이 받은 사용자 아이디로 다른 사용자를 건드리지 않는지 검사한다.
+func FuzzUserID(f *testing.F) {
+	for _, s := range hostileInputs {
+		f.Add(s)
+	}
+	db, err := testDB()
+	if err != nil {
+		f.Fatalf("could not connect to database: %v", err)
+	}
+	victim := "fuzzvictim"
+	err = AddUser(db, victim, "victim password")
+	if err != nil {
+		f.Fatalf("could not add user: %v", err)
+	}
+	defer DeleteUser(db, victim)
+	f.Fuzz(func(t *testing.T, id string) {
+		if id == victim {
+			return
+		}
+		exist, err := UserExist(db, id)
+		if err != nil {
+			t.Fatalf("could not check user exist: %v", err)
+		}
+		if exist {
+			t.Fatalf("user %q should not exist", id)
+		}
+		u, err := GetUser(db, id)
+		if err != nil {
+			t.Fatalf("could not get user: %v", err)
+		}
+		if u != nil {
+			t.Fatalf("got user %q by %q", u.ID, id)
+		}
+		match, err := UserPasswordMatch(db, id, "victim password")
+		if err == nil && match {
+			t.Fatalf("password of %q should not match", id)
+		}
+		if _, err := UserTasks(db, id); err != nil {
+			t.Fatalf("could not get user tasks: %v", err)
+		}
+		UpdateUser(db, id, UpdateUserParam{Name: "hacked"})
+		UpdateUserPassword(db, id, "hacked")
+		DeleteUser(db, id)
+
+		v, err := GetUser(db, victim)
+		if err != nil {
+			t.Fatalf("could not get user: %v", err)
+		}
+		if v == nil || v.Name == "hacked" {
+			t.Fatalf("user %q was modified by %q: %v", victim, id, v)
+		}
+		match, err = UserPasswordMatch(db, victim, "victim password")
+		if err != nil || !match {
+			t.Fatalf("password of %q was modified by %q", victim, id)
+		}
+	})
+}
+
+// TestQueryLayer는 패키지의 모든 구문이 query.go를 거쳐 실행되는지 검사한다.
+// DB를 처음 만드는 initDB만 예외이다.
+func TestQueryLayer(t *testing.T) {
+	direct := map[string]bool{
+		"Query": true, "QueryContext": true,
+		"QueryRow": true, "QueryRowContext": true,
+		"Exec": true, "ExecContext": true,
+	}
+	files, err := filepath.Glob("*.go")
+	if err != nil {
+		t.Fatal(err)
+	}
+	fset := token.NewFileSet()
+	for _, file := range files {
+		if file == "query.go" || strings.HasSuffix(file, "_test.go") {
+			continue
+		}
+		f, err := parser.ParseFile(fset, file, nil, 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, d := range f.Decls {
+			fn, ok := d.(*ast.FuncDecl)
+			if !ok || (file == "db.go" && fn.Name.Name == "initDB") {
+				continue
+			}
+			ast.Inspect(fn, func(n ast.Node) bool {
+				call, ok := n.(*ast.CallExpr)
+				if !ok {
+					return true
+				}
+				sel, ok := call.Fun.(*ast.SelectorExpr)
+				if ok && direct[sel.Sel.Name] {
+					t.Errorf("%s: %s called directly, use dbQuery, dbQueryRow or dbExec", fset.Position(call.Pos()), sel.Sel.Name)
+				}
+				return true
+			})
+		}
+	}
+}
@@ -1,6 +1,12 @@
 package roi
 
-import "time"
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+	"time"
+)
 
 type Review struct {
 	// ID는 리뷰의 아이디이다. 프로젝트 내에서 고유해야 한다.
@@ -17,3 +23,162 @@ type Review struct {
 	Msg      string    // 리뷰 내용. 텍스트거나 HTML일 수도 있다.
 	Time     time.Time // 생성, 수정된 시간
 }
+
+var CreateTableIfNotExistsReviewsStmt = `CREATE TABLE IF NOT EXISTS reviews (
+	uniqid UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+	id STRING NOT NULL CHECK (length(id) > 0),
+	project_id STRING NOT NULL CHECK (length(project_id) > 0) CHECK (project_id NOT LIKE '% %'),
+	output_id STRING NOT NULL CHECK (length(output_id) > 0),
+	user_id STRING NOT NULL,
+	num INT NOT NULL,
+	msg STRING NOT NULL,
+	time TIMESTAMPTZ NOT NULL,
+	UNIQUE(project_id, id)
+)`
+
+var ReviewTableKeys = []string{
+	"id",
+	"project_id",
+	"output_id",
+	"user_id",
+	"num",
+	"msg",
+	"time",
+}
+
+var ReviewTableIndices = dbIndices(ReviewTableKeys)
+
+func (r *Review) dbValues() []interface{} {
+	if r == nil {
+		r = &Review{}
+	}
+	return []interface{}{
+		r.ID,
+		r.ProjectID,
+		r.OutputID,
+		r.UserID,
+		r.Num,
+		r.Msg,
+		r.Time,
+	}
+}
+
+// addReview는 버전에 리뷰를 추가한다. 리뷰 번호와 아이디는 버전의 마지막 리뷰 다음으로 정해진다.
+// 리뷰는 보통 태스크 상태 변경과 함께 일어나므로 트랜잭션 안에서 호출된다.
+func addReview(ctx context.Context, tx *sql.Tx, r *Review) error {
+	if r == nil {
+		return errorf(ErrInvalid, "nil review")
+	}
+	if r.ProjectID == "" {
+		return errorf(ErrInvalid, "project not specified")
+	}
+	if r.OutputID == "" {
+		return errorf(ErrInvalid, "version not specified")
+	}
+	var last int
+	err := dbQueryRow(ctx, tx, "SELECT COALESCE(MAX(num), 0) FROM reviews WHERE project_id=$1 AND output_id=$2", r.ProjectID, r.OutputID).Scan(&last)
+	if err != nil {
+		return fmt.Errorf("could not get last review num: %w", err)
+	}
+	r.Num = last + 1
+	r.ID = fmt.Sprintf("%s.r%d", r.OutputID, r.Num)
+	keystr := strings.Join(ReviewTableKeys, ", ")
+	idxstr := strings.Join(ReviewTableIndices, ", ")
+	stmt := fmt.Sprintf("INSERT INTO reviews (%s) VALUES (%s)", keystr, idxstr)
+	if _, err := dbExec(ctx, tx, stmt, r.dbValues()...); err != nil {
+		return fmt.Errorf("could not insert review: %w", err)
+	}
+	return IndexReview(ctx, tx, r)
+}
+
+// AddReview는 버전에 리뷰를 추가한다. 리뷰 번호와 아이디는 추가될 때 정해진다.
+func AddReview(db *sql.DB, r *Review) error {
+	return AddReviewContext(context.Background(), db, r)
+}
+
+// AddReviewContext는 ctx를 받는 AddReview이다.
+func AddReviewContext(ctx context.Context, db *sql.DB, r *Review) error {
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("could not begin a transaction: %w", err)
+	}
+	defer tx.Rollback() // 트랜잭션이 완료되지 않았을 때만 실행됨
+	if err := addReview(ctx, tx, r); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// reviewFromRows는 테이블의 한 열에서 리뷰를 받아온다.
+// Reviewer는 채우지 않는다. 필요하다면 UserID로 GetUser를 사용해야 한다.
+func reviewFromRows(rows *sql.Rows) (*Review, error) {
+	r := &Review{}
+	err := rows.Scan(&r.ID, &r.ProjectID, &r.OutputID, &r.UserID, &r.Num, &r.Msg, &r.Time)
+	if err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// VersionReviews는 버전의 리뷰들을 리뷰 번호 순서로 반환한다.
+func VersionReviews(db *sql.DB, prj, shot, task string, version int) ([]*Review, error) {
+	return VersionReviewsContext(context.Background(), db, prj, shot, task, version)
+}
+
+// VersionReviewsContext는 ctx를 받는 VersionReviews이다.
+func VersionReviewsContext(ctx context.Context, db *sql.DB, prj, shot, task string, version int) ([]*Review, error) {
+	keystr := strings.Join(ReviewTableKeys, ", ")
+	stmt := fmt.Sprintf("SELECT %s FROM reviews WHERE project_id=$1 AND output_id=$2 ORDER BY num", keystr)
+	rows, err := dbQuery(ctx, db, stmt, prj, versionSearchTarget(shot, task, version))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	reviews := make([]*Review, 0)
+	for rows.Next() {
+		r, err := reviewFromRows(rows)
+		if err != nil {
+			return nil, err
+		}
+		reviews = append(reviews, r)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return reviews, nil
+}
+
+// projectReviews는 프로젝트의 모든 리뷰를 반환한다. 검색 단어를 다시 기록할 때 사용한다.
+func projectReviews(ctx context.Context, db *sql.DB, prj string) ([]*Review, error) {
+	rows, err := selectQuery("reviews", ReviewTableKeys...).where("project_id", prj).orderBy("id").query(ctx, db)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	reviews := make([]*Review, 0)
+	for rows.Next() {
+		r, err := reviewFromRows(rows)
+		if err != nil {
+			return nil, err
+		}
+		reviews = append(reviews, r)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return reviews, nil
+}
+
+// deleteReviewsWithPrefix는 아이디가 prefix로 시작하는 리뷰들과 그 그림 정보를 지운다.
+// 샷, 태스크, 버전이 지워질 때 그 하위의 리뷰를 지우기 위해 사용한다.
+func deleteReviewsWithPrefix(ctx context.Context, tx *sql.Tx, prj, prefix string) error {
+	_, err := dbExec(ctx, tx, "DELETE FROM reviews WHERE project_id=$1 AND id LIKE $2", prj, escapeLike(prefix)+"%")
+	if err != nil {
+		return fmt.Errorf("could not delete data from 'reviews' table: %w", err)
+	}
+	_, err = dbExec(ctx, tx, "DELETE FROM annotations WHERE project=$1 AND review_id LIKE $2", prj, escapeLike(prefix)+"%")
+	if err != nil {
+		return fmt.Errorf("could not delete data from 'annotations' table: %w", err)
+	}
+	return nil
+}
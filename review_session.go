@@ -0,0 +1,401 @@
+package roi
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// ReviewVerdict는 리뷰 세션에서 한 버전에 내려진 판정이다.
+type ReviewVerdict string
+
+const (
+	VerdictNone    = ReviewVerdict("")
+	VerdictApprove = ReviewVerdict("approve")
+	VerdictRetake  = ReviewVerdict("retake")
+	VerdictComment = ReviewVerdict("comment")
+)
+
+var AllReviewVerdicts = []ReviewVerdict{
+	VerdictApprove,
+	VerdictRetake,
+	VerdictComment,
+}
+
+// isValidReviewVerdict는 해당 판정이 유효한지를 반환한다. 판정하지 않은 상태도 유효하다.
+func isValidReviewVerdict(v ReviewVerdict) bool {
+	if v == VerdictNone {
+		return true
+	}
+	for _, rv := range AllReviewVerdicts {
+		if v == rv {
+			return true
+		}
+	}
+	return false
+}
+
+// UIString은 UI안에서 사용하는 현지화된 문자열이다.
+func (v ReviewVerdict) UIString() string {
+	switch v {
+	case VerdictNone:
+		return "-"
+	case VerdictApprove:
+		return "승인"
+	case VerdictRetake:
+		return "리테이크"
+	case VerdictComment:
+		return "코멘트"
+	}
+	return ""
+}
+
+// UIColor는 UI안에서 사용하는 색상이다.
+func (v ReviewVerdict) UIColor() string {
+	switch v {
+	case VerdictApprove:
+		return "green"
+	case VerdictRetake:
+		return "red"
+	case VerdictComment:
+		return "blue"
+	}
+	return "grey"
+}
+
+// TaskStatus는 판정이 발행될 때 태스크가 바뀔 상태이다.
+// 태스크 상태를 바꾸지 않는 판정이면 빈 문자열을 반환한다.
+func (v ReviewVerdict) TaskStatus() TaskStatus {
+	switch v {
+	case VerdictApprove:
+		return TaskDone
+	case VerdictRetake:
+		return TaskRetake
+	}
+	return ""
+}
+
+// ReviewSession은 플레이리스트를 차례로 보며 버전마다 판정을 내리는 리뷰 세션이다.
+// 한 플레이리스트에는 하나의 리뷰 세션만 있을 수 있다.
+// 판정은 세션이 발행(Publish)될 때 리뷰와 태스크 상태로 한번에 반영된다.
+type ReviewSession struct {
+	Project  string
+	Playlist string
+	// Reviewer는 세션을 진행하는 사용자의 아이디이다.
+	Reviewer string
+	Started  time.Time
+	// Published는 세션이 발행된 시간이다. 아직 발행되지 않았다면 zero time이다.
+	Published time.Time
+}
+
+// ReviewSessionItem은 리뷰 세션에서 한 버전에 대한 판정과 노트이다.
+type ReviewSessionItem struct {
+	Shot    string
+	Task    string
+	Version int
+	Verdict ReviewVerdict
+	Note    string
+}
+
+var CreateTableIfNotExistsReviewSessionsStmt = `CREATE TABLE IF NOT EXISTS review_sessions (
+	uniqid UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+	project STRING NOT NULL CHECK (length(project) > 0) CHECK (project NOT LIKE '% %'),
+	playlist STRING NOT NULL CHECK (length(playlist) > 0),
+	reviewer STRING NOT NULL CHECK (length(reviewer) > 0),
+	started TIMESTAMPTZ NOT NULL,
+	published TIMESTAMPTZ NOT NULL,
+	UNIQUE(project, playlist)
+)`
+
+var ReviewSessionTableKeys = []string{
+	"project",
+	"playlist",
+	"reviewer",
+	"started",
+	"published",
+}
+
+var ReviewSessionTableIndices = dbIndices(ReviewSessionTableKeys)
+
+func (s *ReviewSession) dbValues() []interface{} {
+	if s == nil {
+		s = &ReviewSession{}
+	}
+	return []interface{}{
+		s.Project,
+		s.Playlist,
+		s.Reviewer,
+		s.Started,
+		s.Published,
+	}
+}
+
+var CreateTableIfNotExistsReviewSessionItemsStmt = `CREATE TABLE IF NOT EXISTS review_session_items (
+	uniqid UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+	project STRING NOT NULL CHECK (length(project) > 0) CHECK (project NOT LIKE '% %'),
+	playlist STRING NOT NULL CHECK (length(playlist) > 0),
+	shot STRING NOT NULL CHECK (length(shot) > 0) CHECK (shot NOT LIKE '% %'),
+	task STRING NOT NULL CHECK (length(task) > 0) CHECK (task NOT LIKE '% %'),
+	version INT NOT NULL,
+	verdict STRING NOT NULL,
+	note STRING NOT NULL,
+	UNIQUE(project, playlist, shot, task, version)
+)`
+
+var ReviewSessionItemTableKeys = []string{
+	"project",
+	"playlist",
+	"shot",
+	"task",
+	"version",
+	"verdict",
+	"note",
+}
+
+var ReviewSessionItemTableIndices = dbIndices(ReviewSessionItemTableKeys)
+
+// StartReviewSession은 플레이리스트의 리뷰 세션을 시작한다.
+// 이미 시작된 세션이 있다면 새로 만들지 않고 그 세션을 반환한다.
+func StartReviewSession(db *sql.DB, prj, playlist, reviewer string) (*ReviewSession, error) {
+	return StartReviewSessionContext(context.Background(), db, prj, playlist, reviewer)
+}
+
+// StartReviewSessionContext는 ctx를 받는 StartReviewSession이다.
+func StartReviewSessionContext(ctx context.Context, db *sql.DB, prj, playlist, reviewer string) (*ReviewSession, error) {
+	if reviewer == "" {
+		return nil, errorf(ErrInvalid, "reviewer not specified")
+	}
+	s, err := GetReviewSessionContext(ctx, db, prj, playlist)
+	if err != nil {
+		return nil, err
+	}
+	if s != nil {
+		return s, nil
+	}
+	exist, err := PlaylistExistContext(ctx, db, prj, playlist)
+	if err != nil {
+		return nil, err
+	}
+	if !exist {
+		return nil, errorf(ErrNotFound, "playlist not exist: %s/%s", prj, playlist)
+	}
+	s = &ReviewSession{
+		Project:  prj,
+		Playlist: playlist,
+		Reviewer: reviewer,
+		Started:  time.Now(),
+	}
+	keystr := strings.Join(ReviewSessionTableKeys, ", ")
+	idxstr := strings.Join(ReviewSessionTableIndices, ", ")
+	stmt := fmt.Sprintf("INSERT INTO review_sessions (%s) VALUES (%s)", keystr, idxstr)
+	if _, err := dbExec(ctx, db, stmt, s.dbValues()...); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// GetReviewSession은 db에서 플레이리스트의 리뷰 세션을 불러온다.
+// 세션이 시작되지 않았다면 nil이 반환된다.
+func GetReviewSession(db *sql.DB, prj, playlist string) (*ReviewSession, error) {
+	return GetReviewSessionContext(context.Background(), db, prj, playlist)
+}
+
+// GetReviewSessionContext는 ctx를 받는 GetReviewSession이다.
+func GetReviewSessionContext(ctx context.Context, db *sql.DB, prj, playlist string) (*ReviewSession, error) {
+	keystr := strings.Join(ReviewSessionTableKeys, ", ")
+	stmt := fmt.Sprintf("SELECT %s FROM review_sessions WHERE project=$1 AND playlist=$2 LIMIT 1", keystr)
+	rows, err := dbQuery(ctx, db, stmt, prj, playlist)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	if !rows.Next() {
+		return nil, rows.Err()
+	}
+	s := &ReviewSession{}
+	if err := rows.Scan(&s.Project, &s.Playlist, &s.Reviewer, &s.Started, &s.Published); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// ReviewSessionItems는 리뷰 세션에서 판정이나 노트가 기록된 항목들을 반환한다.
+func ReviewSessionItems(db *sql.DB, prj, playlist string) ([]*ReviewSessionItem, error) {
+	return ReviewSessionItemsContext(context.Background(), db, prj, playlist)
+}
+
+// ReviewSessionItemsContext는 ctx를 받는 ReviewSessionItems이다.
+func ReviewSessionItemsContext(ctx context.Context, db *sql.DB, prj, playlist string) ([]*ReviewSessionItem, error) {
+	rows, err := dbQuery(ctx, db, "SELECT shot, task, version, verdict, note FROM review_session_items WHERE project=$1 AND playlist=$2", prj, playlist)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	items := make([]*ReviewSessionItem, 0)
+	for rows.Next() {
+		it := &ReviewSessionItem{}
+		if err := rows.Scan(&it.Shot, &it.Task, &it.Version, &it.Verdict, &it.Note); err != nil {
+			return nil, err
+		}
+		items = append(items, it)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+// SetReviewVerdict는 리뷰 세션에 한 버전의 판정과 노트를 기록한다.
+// 이미 기록된 판정이 있다면 덮어쓴다. 발행된 세션에는 기록할 수 없다.
+func SetReviewVerdict(db *sql.DB, prj, playlist string, it *ReviewSessionItem) error {
+	return SetReviewVerdictContext(context.Background(), db, prj, playlist, it)
+}
+
+// SetReviewVerdictContext는 ctx를 받는 SetReviewVerdict이다.
+func SetReviewVerdictContext(ctx context.Context, db *sql.DB, prj, playlist string, it *ReviewSessionItem) error {
+	if it == nil {
+		return errorf(ErrInvalid, "nil review session item")
+	}
+	if it.Shot == "" || it.Task == "" || it.Version <= 0 {
+		return errorf(ErrInvalid, "invalid review session item: %s.%s.v%03d", it.Shot, it.Task, it.Version)
+	}
+	if !isValidReviewVerdict(it.Verdict) {
+		return errorf(ErrInvalid, "invalid review verdict: '%s'", it.Verdict)
+	}
+	s, err := GetReviewSessionContext(ctx, db, prj, playlist)
+	if err != nil {
+		return err
+	}
+	if s == nil {
+		return errorf(ErrNotFound, "review session not started: %s/%s", prj, playlist)
+	}
+	if !s.Published.IsZero() {
+		return errorf(ErrConflict, "review session already published: %s/%s", prj, playlist)
+	}
+	keystr := strings.Join(ReviewSessionItemTableKeys, ", ")
+	idxstr := strings.Join(ReviewSessionItemTableIndices, ", ")
+	stmt := fmt.Sprintf("UPSERT INTO review_session_items (%s) VALUES (%s)", keystr, idxstr)
+	if _, err := dbExec(ctx, db, stmt, prj, playlist, it.Shot, it.Task, it.Version, it.Verdict, it.Note); err != nil {
+		return err
+	}
+	return nil
+}
+
+// reviewMsg는 판정과 노트로 리뷰 메시지를 만든다.
+func reviewMsg(it *ReviewSessionItem) string {
+	if it.Verdict == VerdictComment {
+		return it.Note
+	}
+	msg := "[" + it.Verdict.UIString() + "]"
+	if it.Note != "" {
+		msg += " " + it.Note
+	}
+	return msg
+}
+
+// PublishReviewSession은 리뷰 세션의 판정들을 한 트랜잭션 안에서 반영한다.
+// 판정이 내려진 각 버전에 노트가 리뷰로 추가되고, 승인과 리테이크 판정은 태스크 상태를
+// 각각 완료와 리테이크로 바꾸며, 태스크 담당자에게 알림을 보낸다.
+// 중간에 에러가 나면 아무것도 반영되지 않는다. 이미 발행된 세션은 다시 발행할 수 없다.
+func PublishReviewSession(db *sql.DB, prj, playlist string) error {
+	return PublishReviewSessionContext(context.Background(), db, prj, playlist)
+}
+
+// PublishReviewSessionContext는 ctx를 받는 PublishReviewSession이다.
+func PublishReviewSessionContext(ctx context.Context, db *sql.DB, prj, playlist string) error {
+	s, err := GetReviewSessionContext(ctx, db, prj, playlist)
+	if err != nil {
+		return err
+	}
+	if s == nil {
+		return errorf(ErrNotFound, "review session not started: %s/%s", prj, playlist)
+	}
+	if !s.Published.IsZero() {
+		return errorf(ErrConflict, "review session already published: %s/%s", prj, playlist)
+	}
+	items, err := ReviewSessionItemsContext(ctx, db, prj, playlist)
+	if err != nil {
+		return err
+	}
+	now := time.Now()
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("could not begin a transaction: %w", err)
+	}
+	defer tx.Rollback() // 트랜잭션이 완료되지 않았을 때만 실행됨
+	// 다른 곳에서 동시에 발행하는 것을 막는다.
+	res, err := dbExec(ctx, tx, "UPDATE review_sessions SET published=$1 WHERE project=$2 AND playlist=$3 AND published=$4", now, prj, playlist, time.Time{})
+	if err != nil {
+		return fmt.Errorf("could not update review session: %w", err)
+	}
+	if n, err := res.RowsAffected(); err != nil || n != 1 {
+		return errorf(ErrConflict, "review session already published: %s/%s", prj, playlist)
+	}
+	taskKeystr := strings.Join(TaskTableKeys, ", ")
+	taskStmt := fmt.Sprintf("SELECT %s FROM tasks WHERE project=$1 AND shot=$2 AND task=$3 LIMIT 1", taskKeystr)
+	for _, it := range items {
+		if it.Verdict == VerdictNone {
+			continue
+		}
+		target := versionSearchTarget(it.Shot, it.Task, it.Version)
+		r := &Review{
+			ProjectID: prj,
+			OutputID:  target,
+			UserID:    s.Reviewer,
+			Msg:       reviewMsg(it),
+			Time:      now,
+		}
+		if err := addReview(ctx, tx, r); err != nil {
+			return err
+		}
+		rows, err := dbQuery(ctx, tx, taskStmt, prj, it.Shot, it.Task)
+		if err != nil {
+			return err
+		}
+		if !rows.Next() {
+			rows.Close()
+			return errorf(ErrNotFound, "task not exist: %s.%s.%s", prj, it.Shot, it.Task)
+		}
+		t, err := taskFromRows(rows)
+		rows.Close()
+		if err != nil {
+			return err
+		}
+		if st := it.Verdict.TaskStatus(); st != "" {
+			upd := UpdateTaskParam{
+				Status:   st,
+				Assignee: t.Assignee,
+				DueDate:  t.DueDate,
+			}
+			if err := updateTask(ctx, tx, prj, it.Shot, it.Task, upd); err != nil {
+				return fmt.Errorf("could not update task: %w", err)
+			}
+		}
+		if t.Assignee != "" {
+			n := &Notification{
+				User:    t.Assignee,
+				Project: prj,
+				Msg:     target + ": " + r.Msg,
+				Link:    fmt.Sprintf("/version/%s/%s/%s/%d", prj, it.Shot, it.Task, it.Version),
+				Created: now,
+			}
+			if err := addNotification(ctx, tx, n); err != nil {
+				return err
+			}
+		}
+	}
+	return tx.Commit()
+}
+
+// deleteReviewSession은 플레이리스트의 리뷰 세션과 그 판정들을 지운다.
+func deleteReviewSession(ctx context.Context, tx *sql.Tx, prj, playlist string) error {
+	if _, err := dbExec(ctx, tx, "DELETE FROM review_session_items WHERE project=$1 AND playlist=$2", prj, playlist); err != nil {
+		return fmt.Errorf("could not delete data from 'review_session_items' table: %w", err)
+	}
+	if _, err := dbExec(ctx, tx, "DELETE FROM review_sessions WHERE project=$1 AND playlist=$2", prj, playlist); err != nil {
+		return fmt.Errorf("could not delete data from 'review_sessions' table: %w", err)
+	}
+	return nil
+}
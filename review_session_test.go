@@ -0,0 +1,110 @@
+package roi
+
+import (
+	"testing"
+	"time"
+)
+
+func TestReviewMsg(t *testing.T) {
+	cases := []struct {
+		item *ReviewSessionItem
+		want string
+	}{
+		{item: &ReviewSessionItem{Verdict: VerdictApprove}, want: "[승인]"},
+		{item: &ReviewSessionItem{Verdict: VerdictRetake, Note: "연기가 너무 빠름"}, want: "[리테이크] 연기가 너무 빠름"},
+		{item: &ReviewSessionItem{Verdict: VerdictComment, Note: "좋아요"}, want: "좋아요"},
+	}
+	for _, c := range cases {
+		got := reviewMsg(c.item)
+		if got != c.want {
+			t.Fatalf("reviewMsg(%v): got %q, want %q", c.item, got, c.want)
+		}
+	}
+}
+
+func TestReviewSession(t *testing.T) {
+	db, err := testDB()
+	if err != nil {
+		t.Fatalf("could not connect to database: %v", err)
+	}
+	err = AddProject(db, testProject)
+	if err != nil {
+		t.Fatalf("could not add project: %v", err)
+	}
+	err = AddShot(db, testProject.Project, testShotA)
+	if err != nil {
+		t.Fatalf("could not add shot: %v", err)
+	}
+	err = AddTask(db, testProject.Project, testShotA.Shot, testTaskA)
+	if err != nil {
+		t.Fatalf("could not add task: %v", err)
+	}
+	v := &Version{Created: time.Now()}
+	err = AddVersion(db, testProject.Project, testShotA.Shot, testTaskA.Task, v)
+	if err != nil {
+		t.Fatalf("could not add version: %v", err)
+	}
+	p := &Playlist{
+		Project: testProject.Project,
+		Name:    "데일리",
+		Date:    time.Now(),
+		Items: []*PlaylistItem{
+			{Shot: testShotA.Shot, Task: testTaskA.Task, Version: v.Version},
+		},
+	}
+	err = AddPlaylist(db, p)
+	if err != nil {
+		t.Fatalf("could not add playlist: %v", err)
+	}
+	_, err = StartReviewSession(db, p.Project, p.Name, "supervisor")
+	if err != nil {
+		t.Fatalf("could not start review session: %v", err)
+	}
+	it := &ReviewSessionItem{Shot: testShotA.Shot, Task: testTaskA.Task, Version: v.Version, Verdict: VerdictRetake, Note: "연기가 너무 빠름"}
+	err = SetReviewVerdict(db, p.Project, p.Name, it)
+	if err != nil {
+		t.Fatalf("could not set review verdict: %v", err)
+	}
+	err = PublishReviewSession(db, p.Project, p.Name)
+	if err != nil {
+		t.Fatalf("could not publish review session: %v", err)
+	}
+	// 발행된 세션은 다시 발행할 수 없다.
+	err = PublishReviewSession(db, p.Project, p.Name)
+	if err == nil {
+		t.Fatalf("published review session should not be published again")
+	}
+	task, err := GetTask(db, testProject.Project, testShotA.Shot, testTaskA.Task)
+	if err != nil {
+		t.Fatalf("could not get task: %v", err)
+	}
+	if task.Status != TaskRetake {
+		t.Fatalf("task status should be %s, got %s", TaskRetake, task.Status)
+	}
+	reviews, err := VersionReviews(db, testProject.Project, testShotA.Shot, testTaskA.Task, v.Version)
+	if err != nil {
+		t.Fatalf("could not get version reviews: %v", err)
+	}
+	if len(reviews) != 1 || reviews[0].Msg != reviewMsg(it) || reviews[0].ID != "CG_0010.fx_fire.v001.r1" {
+		t.Fatalf("unexpected version reviews: %v", reviews)
+	}
+	ns, err := UserNotifications(db, testTaskA.Assignee)
+	if err != nil {
+		t.Fatalf("could not get notifications: %v", err)
+	}
+	if len(ns) != 1 {
+		t.Fatalf("invalid number of notifications: want 1, got %d", len(ns))
+	}
+	err = ClearNotifications(db, testTaskA.Assignee)
+	if err != nil {
+		t.Fatalf("could not clear notifications: %v", err)
+	}
+	err = DeletePlaylist(db, p.Project, p.Name)
+	if err != nil {
+		t.Fatalf("could not delete playlist: %v", err)
+	}
+	err = DeleteProject(db, testProject.Project)
+	if err != nil {
+		t.Fatalf("could not delete project: %v", err)
+	}
+}
@@ -0,0 +1,351 @@
+package roi
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+// IsValidSavedSearchName은 해당 이름이 저장된 검색의 이름으로 적절한지 여부를 반환한다.
+// 이름은 URL 경로에 사용되기 때문에 슬래시(/)를 포함할 수 없다.
+func IsValidSavedSearchName(name string) bool {
+	if strings.TrimSpace(name) == "" {
+		return false
+	}
+	return !strings.Contains(name, "/")
+}
+
+// AssigneeMe는 검색의 담당자 조건으로 쓰이면 검색하는 사용자로 바뀐다.
+// 사용자 아이디는 영문자로 시작하므로 실제 사용자와 겹치지 않는다.
+// 예) 담당자가 AssigneeMe인 저장된 검색은 여는 사람마다 자신의 태스크를 보여준다.
+const AssigneeMe = "@me"
+
+// ResolveAssignee는 검색의 담당자 조건이 AssigneeMe라면 검색하는 사용자 user로 바꾼다.
+// 그 외의 담당자는 그대로 반환한다.
+func ResolveAssignee(assignee, user string) string {
+	if assignee == AssigneeMe {
+		return user
+	}
+	return assignee
+}
+
+// SavedSearch는 사용자가 이름을 붙여 저장한 샷 검색 조건이다.
+// 조건의 각 필드는 SearchShotsDueWithin의 인수와 같은 의미를 가진다.
+// 저장된 시점이 아니라 검색하는 시점과 사용자를 기준으로 하도록
+// 마감일은 오늘부터의 날 수로, 담당자는 AssigneeMe로 저장할 수 있다.
+type SavedSearch struct {
+	// User는 검색을 저장한 사용자의 아이디이다.
+	User string
+	// Name은 사용자 내에서 고유한 검색 이름이다.
+	Name string
+	// Project는 검색할 프로젝트이다.
+	Project string
+	// Shared가 true이면 같은 프로젝트의 다른 사용자도 이 검색을 사용할 수 있다.
+	Shared bool
+
+	Shot       string
+	Tag        string
+	Status     string
+	Assignee   string
+	TaskStatus string
+	// TaskDueDays는 검색하는 날부터 며칠 안에 마감인 태스크를 찾을지를 나타낸다.
+	// 0이면 마감일로 거르지 않는다.
+	TaskDueDays int
+}
+
+// ID는 저장된 검색을 로이 내에서 구분하는 아이디이다.
+// 예) kybin/retakes
+func (s *SavedSearch) ID() string {
+	return s.User + "/" + s.Name
+}
+
+// Query는 /search/ 페이지에서 같은 검색을 하기 위한 URL 질의 문자열을 반환한다.
+func (s *SavedSearch) Query() string {
+	v := url.Values{}
+	if s.Shot != "" {
+		v.Set("shot", s.Shot)
+	}
+	if s.Tag != "" {
+		v.Set("tag", s.Tag)
+	}
+	if s.Status != "" {
+		v.Set("status", s.Status)
+	}
+	if s.Assignee != "" {
+		v.Set("assignee", s.Assignee)
+	}
+	if s.TaskStatus != "" {
+		v.Set("task_status", s.TaskStatus)
+	}
+	if s.TaskDueDays != 0 {
+		v.Set("task_due_days", strconv.Itoa(s.TaskDueDays))
+	}
+	return v.Encode()
+}
+
+// SplitSavedSearchID는 저장된 검색의 아이디를 사용자와 이름으로 나눈다.
+// 아이디가 적절하지 않다면 빈 문자열들을 반환한다.
+func SplitSavedSearchID(id string) (string, string) {
+	ids := strings.SplitN(id, "/", 2)
+	if len(ids) != 2 || ids[0] == "" || ids[1] == "" {
+		return "", ""
+	}
+	return ids[0], ids[1]
+}
+
+var CreateTableIfNotExistsSavedSearchesStmt = `CREATE TABLE IF NOT EXISTS saved_searches (
+	uniqid UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+	user_id STRING NOT NULL CHECK (length(user_id) > 0) CHECK (user_id NOT LIKE '% %'),
+	name STRING NOT NULL CHECK (length(name) > 0),
+	project STRING NOT NULL CHECK (length(project) > 0) CHECK (project NOT LIKE '% %'),
+	shared BOOL NOT NULL,
+	shot STRING NOT NULL,
+	tag STRING NOT NULL,
+	status STRING NOT NULL,
+	assignee STRING NOT NULL,
+	task_status STRING NOT NULL,
+	task_due_days INT NOT NULL CHECK (task_due_days >= 0),
+	UNIQUE(user_id, name)
+)`
+
+var SavedSearchTableKeys = []string{
+	"user_id",
+	"name",
+	"project",
+	"shared",
+	"shot",
+	"tag",
+	"status",
+	"assignee",
+	"task_status",
+	"task_due_days",
+}
+
+var SavedSearchTableIndices = dbIndices(SavedSearchTableKeys)
+
+func (s *SavedSearch) dbValues() []interface{} {
+	if s == nil {
+		s = &SavedSearch{}
+	}
+	return []interface{}{
+		s.User,
+		s.Name,
+		s.Project,
+		s.Shared,
+		s.Shot,
+		s.Tag,
+		s.Status,
+		s.Assignee,
+		s.TaskStatus,
+		s.TaskDueDays,
+	}
+}
+
+// AddSavedSearch는 db에 사용자의 검색 조건을 저장한다.
+func AddSavedSearch(db *sql.DB, s *SavedSearch) error {
+	return AddSavedSearchContext(context.Background(), db, s)
+}
+
+// AddSavedSearchContext는 ctx를 받는 AddSavedSearch이다.
+func AddSavedSearchContext(ctx context.Context, db *sql.DB, s *SavedSearch) error {
+	if s == nil {
+		return errorf(ErrInvalid, "nil SavedSearch is invalid")
+	}
+	if s.User == "" {
+		return errorf(ErrInvalid, "user not specified")
+	}
+	v := &validator{}
+	v.check(IsValidSavedSearchName(s.Name), "name", "invalid saved search name: '%s'", s.Name)
+	v.check(s.TaskDueDays >= 0, "task_due_days", "task due days should not be negative: %d", s.TaskDueDays)
+	if err := v.err(); err != nil {
+		return err
+	}
+	if s.Project == "" {
+		return errorf(ErrInvalid, "project not specified")
+	}
+	keystr := strings.Join(SavedSearchTableKeys, ", ")
+	idxstr := strings.Join(SavedSearchTableIndices, ", ")
+	stmt := fmt.Sprintf("INSERT INTO saved_searches (%s) VALUES (%s)", keystr, idxstr)
+	if _, err := dbExec(ctx, db, stmt, s.dbValues()...); err != nil {
+		return err
+	}
+	return nil
+}
+
+// UpdateSavedSearchParam은 SavedSearch에서 일반적으로 업데이트 되어야 하는 멤버의 모음이다.
+// UpdateSavedSearch에서 사용한다.
+type UpdateSavedSearchParam struct {
+	Project     string
+	Shared      bool
+	Shot        string
+	Tag         string
+	Status      string
+	Assignee    string
+	TaskStatus  string
+	TaskDueDays int
+}
+
+func (u UpdateSavedSearchParam) keys() []string {
+	return []string{
+		"project",
+		"shared",
+		"shot",
+		"tag",
+		"status",
+		"assignee",
+		"task_status",
+		"task_due_days",
+	}
+}
+
+func (u UpdateSavedSearchParam) values() []interface{} {
+	return []interface{}{
+		u.Project,
+		u.Shared,
+		u.Shot,
+		u.Tag,
+		u.Status,
+		u.Assignee,
+		u.TaskStatus,
+		u.TaskDueDays,
+	}
+}
+
+// UpdateSavedSearch는 db에 저장된 사용자의 검색 조건을 수정한다.
+func UpdateSavedSearch(db *sql.DB, user, name string, upd UpdateSavedSearchParam) error {
+	return UpdateSavedSearchContext(context.Background(), db, user, name, upd)
+}
+
+// UpdateSavedSearchContext는 ctx를 받는 UpdateSavedSearch이다.
+func UpdateSavedSearchContext(ctx context.Context, db *sql.DB, user, name string, upd UpdateSavedSearchParam) error {
+	if user == "" {
+		return errorf(ErrInvalid, "user not specified")
+	}
+	if name == "" {
+		return errorf(ErrInvalid, "saved search name not specified")
+	}
+	if upd.Project == "" {
+		return errorf(ErrInvalid, "project not specified")
+	}
+	if upd.TaskDueDays < 0 {
+		return errorf(ErrInvalid, "task due days should not be negative: %d", upd.TaskDueDays)
+	}
+	q := updateQuery("saved_searches", upd.keys(), upd.values()).where("user_id", user).where("name", name)
+	if _, err := q.exec(ctx, db); err != nil {
+		return err
+	}
+	return nil
+}
+
+// SavedSearchExist는 db에 해당 사용자의 검색이 저장되어 있는지를 검사한다.
+func SavedSearchExist(db *sql.DB, user, name string) (bool, error) {
+	return SavedSearchExistContext(context.Background(), db, user, name)
+}
+
+// SavedSearchExistContext는 ctx를 받는 SavedSearchExist이다.
+func SavedSearchExistContext(ctx context.Context, db *sql.DB, user, name string) (bool, error) {
+	stmt := "SELECT name FROM saved_searches WHERE user_id=$1 AND name=$2 LIMIT 1"
+	rows, err := dbQuery(ctx, db, stmt, user, name)
+	if err != nil {
+		return false, err
+	}
+	defer rows.Close()
+	return rows.Next(), rows.Err()
+}
+
+// savedSearchFromRows는 테이블의 한 열에서 저장된 검색을 받아온다.
+func savedSearchFromRows(rows *sql.Rows) (*SavedSearch, error) {
+	s := &SavedSearch{}
+	err := rows.Scan(
+		&s.User, &s.Name, &s.Project, &s.Shared,
+		&s.Shot, &s.Tag, &s.Status, &s.Assignee, &s.TaskStatus, &s.TaskDueDays,
+	)
+	if err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// GetSavedSearch는 db에서 해당 사용자의 저장된 검색을 찾는다.
+// 만일 그 이름의 검색이 없다면 nil이 반환된다.
+func GetSavedSearch(db *sql.DB, user, name string) (*SavedSearch, error) {
+	return GetSavedSearchContext(context.Background(), db, user, name)
+}
+
+// GetSavedSearchContext는 ctx를 받는 GetSavedSearch이다.
+func GetSavedSearchContext(ctx context.Context, db *sql.DB, user, name string) (*SavedSearch, error) {
+	keystr := strings.Join(SavedSearchTableKeys, ", ")
+	stmt := fmt.Sprintf("SELECT %s FROM saved_searches WHERE user_id=$1 AND name=$2 LIMIT 1", keystr)
+	rows, err := dbQuery(ctx, db, stmt, user, name)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	if !rows.Next() {
+		return nil, rows.Err()
+	}
+	return savedSearchFromRows(rows)
+}
+
+// UserSavedSearches는 사용자가 사용할 수 있는 저장된 검색을 모두 반환한다.
+// 여기에는 사용자 자신이 저장한 검색과 다른 사용자가 공유한 검색이 포함된다.
+// prj가 빈 문자열이 아니라면 해당 프로젝트의 검색만 반환한다.
+func UserSavedSearches(db *sql.DB, user, prj string) ([]*SavedSearch, error) {
+	return UserSavedSearchesContext(context.Background(), db, user, prj)
+}
+
+// UserSavedSearchesContext는 ctx를 받는 UserSavedSearches이다.
+func UserSavedSearchesContext(ctx context.Context, db *sql.DB, user, prj string) ([]*SavedSearch, error) {
+	keystr := strings.Join(SavedSearchTableKeys, ", ")
+	stmt := fmt.Sprintf("SELECT %s FROM saved_searches WHERE (user_id=$1 OR shared) AND ($2 = '' OR project=$2) ORDER BY user_id <> $1, user_id, name", keystr)
+	rows, err := dbQuery(ctx, db, stmt, user, prj)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	ss := make([]*SavedSearch, 0)
+	for rows.Next() {
+		s, err := savedSearchFromRows(rows)
+		if err != nil {
+			return nil, err
+		}
+		ss = append(ss, s)
+	}
+	if rows.Err() != nil {
+		return nil, rows.Err()
+	}
+	return ss, nil
+}
+
+// SavedSearchShots는 저장된 검색 조건으로 샷을 검색해 반환한다.
+// user는 검색하는 사용자로, 담당자 조건이 AssigneeMe일 때 그 사용자로 바뀐다.
+// 마감일 조건은 검색하는 날을 기준으로 한다.
+func SavedSearchShots(db *sql.DB, s *SavedSearch, user string) ([]*Shot, error) {
+	return SavedSearchShotsContext(context.Background(), db, s, user)
+}
+
+// SavedSearchShotsContext는 ctx를 받는 SavedSearchShots이다.
+func SavedSearchShotsContext(ctx context.Context, db *sql.DB, s *SavedSearch, user string) ([]*Shot, error) {
+	if s == nil {
+		return nil, errorf(ErrInvalid, "nil SavedSearch is invalid")
+	}
+	assignee := ResolveAssignee(s.Assignee, user)
+	return SearchShotsDueWithinContext(ctx, db, s.Project, s.Shot, s.Tag, s.Status, assignee, s.TaskStatus, s.TaskDueDays)
+}
+
+// DeleteSavedSearch는 db에서 해당 사용자의 저장된 검색을 지운다.
+// 해당 검색이 없어도 에러를 내지 않기 때문에 검사를 원한다면 SavedSearchExist를 사용해야 한다.
+func DeleteSavedSearch(db *sql.DB, user, name string) error {
+	return DeleteSavedSearchContext(context.Background(), db, user, name)
+}
+
+// DeleteSavedSearchContext는 ctx를 받는 DeleteSavedSearch이다.
+func DeleteSavedSearchContext(ctx context.Context, db *sql.DB, user, name string) error {
+	if _, err := dbExec(ctx, db, "DELETE FROM saved_searches WHERE user_id=$1 AND name=$2", user, name); err != nil {
+		return fmt.Errorf("could not delete data from 'saved_searches' table: %w", err)
+	}
+	return nil
+}
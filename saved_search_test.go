@@ -0,0 +1,140 @@
+package roi
+
+import (
+	"reflect"
+	"testing"
+)
+
+var testSavedSearch = &SavedSearch{
+	User:        "kybin",
+	Name:        "내 리테이크",
+	Project:     testProject.Project,
+	Shared:      true,
+	Assignee:    AssigneeMe,
+	TaskStatus:  string(TaskRetake),
+	TaskDueDays: 7,
+}
+
+func TestSavedSearchQuery(t *testing.T) {
+	got := testSavedSearch.Query()
+	want := "assignee=%40me&task_due_days=7&task_status=retake"
+	if got != want {
+		t.Fatalf("got: %v, want: %v", got, want)
+	}
+	user, name := SplitSavedSearchID(testSavedSearch.ID())
+	if user != testSavedSearch.User || name != testSavedSearch.Name {
+		t.Fatalf("could not split saved search id: %s", testSavedSearch.ID())
+	}
+}
+
+func TestResolveAssignee(t *testing.T) {
+	if got := ResolveAssignee(AssigneeMe, "kybin"); got != "kybin" {
+		t.Fatalf("%s should be resolved to the searching user: got %s", AssigneeMe, got)
+	}
+	if got := ResolveAssignee("admin", "kybin"); got != "admin" {
+		t.Fatalf("other assignee should not be changed: got %s", got)
+	}
+}
+
+func TestSavedSearch(t *testing.T) {
+	db, err := testDB()
+	if err != nil {
+		t.Fatalf("could not connect to database: %v", err)
+	}
+	err = AddProject(db, testProject)
+	if err != nil {
+		t.Fatalf("could not add project: %v", err)
+	}
+	err = AddShot(db, testProject.Project, testShotA)
+	if err != nil {
+		t.Fatalf("could not add shot: %v", err)
+	}
+	err = AddSavedSearch(db, testSavedSearch)
+	if err != nil {
+		t.Fatalf("could not add saved search: %v", err)
+	}
+	exist, err := SavedSearchExist(db, testSavedSearch.User, testSavedSearch.Name)
+	if err != nil {
+		t.Fatalf("could not check saved search exist: %v", err)
+	}
+	if !exist {
+		t.Fatalf("added saved search not exist")
+	}
+	got, err := GetSavedSearch(db, testSavedSearch.User, testSavedSearch.Name)
+	if err != nil {
+		t.Fatalf("could not get saved search: %v", err)
+	}
+	if !reflect.DeepEqual(got, testSavedSearch) {
+		t.Fatalf("got: %v, want: %v", got, testSavedSearch)
+	}
+	// 공유된 검색은 다른 사용자도 볼 수 있어야 한다.
+	ss, err := UserSavedSearches(db, "other", testProject.Project)
+	if err != nil {
+		t.Fatalf("could not get user saved searches: %v", err)
+	}
+	if len(ss) != 1 {
+		t.Fatalf("invalid number of shared saved searches: want 1, got %d", len(ss))
+	}
+	err = UpdateSavedSearch(db, testSavedSearch.User, testSavedSearch.Name, UpdateSavedSearchParam{Project: testProject.Project})
+	if err != nil {
+		t.Fatalf("could not clear(update) saved search: %v", err)
+	}
+	ss, err = UserSavedSearches(db, "other", testProject.Project)
+	if err != nil {
+		t.Fatalf("could not get user saved searches: %v", err)
+	}
+	if len(ss) != 0 {
+		t.Fatalf("invalid number of shared saved searches: want 0, got %d", len(ss))
+	}
+	shots, err := SavedSearchShots(db, &SavedSearch{Project: testProject.Project}, "kybin")
+	if err != nil {
+		t.Fatalf("could not search shots with saved search: %v", err)
+	}
+	if len(shots) != 1 {
+		t.Fatalf("invalid number of shots: want 1, got %d", len(shots))
+	}
+
+	d := &Dashboard{
+		User:     testSavedSearch.User,
+		Name:     "아침",
+		Searches: []string{testSavedSearch.ID()},
+	}
+	err = AddDashboard(db, d)
+	if err != nil {
+		t.Fatalf("could not add dashboard: %v", err)
+	}
+	gotd, err := GetDashboard(db, d.User, d.Name)
+	if err != nil {
+		t.Fatalf("could not get dashboard: %v", err)
+	}
+	if !reflect.DeepEqual(gotd, d) {
+		t.Fatalf("got: %v, want: %v", gotd, d)
+	}
+	err = UpdateDashboard(db, d.User, d.Name, nil)
+	if err != nil {
+		t.Fatalf("could not clear(update) dashboard: %v", err)
+	}
+	err = DeleteDashboard(db, d.User, d.Name)
+	if err != nil {
+		t.Fatalf("could not delete dashboard: %v", err)
+	}
+	err = DeleteSavedSearch(db, testSavedSearch.User, testSavedSearch.Name)
+	if err != nil {
+		t.Fatalf("could not delete saved search: %v", err)
+	}
+	exist, err = SavedSearchExist(db, testSavedSearch.User, testSavedSearch.Name)
+	if err != nil {
+		t.Fatalf("could not check saved search exist: %v", err)
+	}
+	if exist {
+		t.Fatalf("deleted saved search exist")
+	}
+	err = DeleteShot(db, testProject.Project, testShotA.Shot)
+	if err != nil {
+		t.Fatalf("could not delete shot: %v", err)
+	}
+	err = DeleteProject(db, testProject.Project)
+	if err != nil {
+		t.Fatalf("could not delete project: %v", err)
+	}
+}
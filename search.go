@@ -0,0 +1,348 @@
+package roi
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/lib/pq"
+)
+
+// 전체 텍스트 검색은 search_words 테이블에 저장된 역색인(inverted index)을 이용한다.
+// 각 항목의 텍스트는 추가, 수정될 때 단어로 나뉘어 이 테이블에 함께 기록되며,
+// 검색시에는 단어 테이블만 살펴보기 때문에 행이 많아져도 빠르게 검색할 수 있다.
+
+// SearchKind는 전체 텍스트 검색에서 찾아진 항목의 종류이다.
+type SearchKind string
+
+const (
+	SearchShot    = SearchKind("shot")
+	SearchVersion = SearchKind("version")
+	SearchReview  = SearchKind("review")
+)
+
+// UIString은 UI안에서 사용하는 현지화된 문자열이다.
+func (k SearchKind) UIString() string {
+	switch k {
+	case SearchShot:
+		return "샷"
+	case SearchVersion:
+		return "버전"
+	case SearchReview:
+		return "리뷰"
+	}
+	return ""
+}
+
+// searchFieldWeight는 필드에서 찾아진 단어가 검색 순위에 미치는 가중치이다.
+// 여기에 없는 필드의 가중치는 1이다.
+var searchFieldWeight = map[string]int{
+	"shot":           4,
+	"tags":           3,
+	"cg_description": 2,
+	"description":    2,
+}
+
+var CreateTableIfNotExistsSearchWordsStmt = `CREATE TABLE IF NOT EXISTS search_words (
+	uniqid UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+	project STRING NOT NULL CHECK (length(project) > 0) CHECK (project NOT LIKE '% %'),
+	kind STRING NOT NULL CHECK (length(kind) > 0),
+	target STRING NOT NULL CHECK (length(target) > 0),
+	field STRING NOT NULL,
+	word STRING NOT NULL CHECK (length(word) > 0),
+	INDEX (word),
+	INDEX (project, kind, target)
+)`
+
+// searchWords는 텍스트를 검색에 사용할 단어들로 나눈다.
+// 단어는 문자와 숫자로만 이루어지며 소문자로 바뀐다. 중복된 단어는 하나만 반환한다.
+//
+// 예)
+// 	searchWords("CG_0010 로이의 방") => []string{"cg", "0010", "로이의", "방"}
+//
+func searchWords(text string) []string {
+	fs := strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+	words := make([]string, 0, len(fs))
+	has := make(map[string]bool)
+	for _, f := range fs {
+		if has[f] {
+			continue
+		}
+		has[f] = true
+		words = append(words, f)
+	}
+	return words
+}
+
+// indexSearchWords는 한 항목의 검색 단어를 새로 기록한다.
+// fields는 필드 이름과 그 필드의 텍스트이다. 기존에 기록된 단어는 지워진다.
+// 단어들은 하나의 INSERT 구문으로 한번에 기록된다.
+func indexSearchWords(ctx context.Context, tx *sql.Tx, prj string, kind SearchKind, target string, fields map[string]string) error {
+	if err := unindexSearchWords(ctx, tx, prj, kind, target); err != nil {
+		return err
+	}
+	// 같은 입력에 같은 구문이 만들어지도록 필드 이름 순서로 기록한다.
+	names := make([]string, 0, len(fields))
+	for f := range fields {
+		names = append(names, f)
+	}
+	sort.Strings(names)
+	q := &sqlQuery{}
+	vals := make([]string, 0)
+	for _, f := range names {
+		for _, w := range searchWords(fields[f]) {
+			vals = append(vals, fmt.Sprintf("(%s, %s, %s, %s, %s)", q.placeholder(prj), q.placeholder(kind), q.placeholder(target), q.placeholder(f), q.placeholder(w)))
+		}
+	}
+	if len(vals) == 0 {
+		return nil
+	}
+	stmt := "INSERT INTO search_words (project, kind, target, field, word) VALUES " + strings.Join(vals, ", ")
+	if _, err := dbExec(ctx, tx, stmt, q.args...); err != nil {
+		return fmt.Errorf("could not index search words: %w", err)
+	}
+	return nil
+}
+
+// unindexSearchWords는 한 항목의 검색 단어를 지운다.
+// target이 빈 문자열이면 해당 프로젝트의 그 종류의 단어를 모두 지운다.
+func unindexSearchWords(ctx context.Context, tx *sql.Tx, prj string, kind SearchKind, target string) error {
+	var err error
+	if target == "" {
+		_, err = dbExec(ctx, tx, "DELETE FROM search_words WHERE project=$1 AND kind=$2", prj, kind)
+	} else {
+		_, err = dbExec(ctx, tx, "DELETE FROM search_words WHERE project=$1 AND kind=$2 AND target=$3", prj, kind, target)
+	}
+	if err != nil {
+		return fmt.Errorf("could not delete data from 'search_words' table: %w", err)
+	}
+	return nil
+}
+
+// unindexSearchWordsWithPrefix는 target이 prefix로 시작하는 항목의 검색 단어를 지운다.
+// 샷이나 태스크가 지워질 때 그 하위 버전의 단어를 지우기 위해 사용한다.
+func unindexSearchWordsWithPrefix(ctx context.Context, tx *sql.Tx, prj string, kind SearchKind, prefix string) error {
+	_, err := dbExec(ctx, tx, "DELETE FROM search_words WHERE project=$1 AND kind=$2 AND target LIKE $3", prj, kind, escapeLike(prefix)+"%")
+	if err != nil {
+		return fmt.Errorf("could not delete data from 'search_words' table: %w", err)
+	}
+	return nil
+}
+
+// escapeLike는 LIKE 구문에서 특별한 의미를 가진 문자를 이스케이프 한다.
+func escapeLike(s string) string {
+	r := strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`)
+	return r.Replace(s)
+}
+
+// shotSearchFields는 샷에서 검색될 필드와 그 텍스트를 반환한다.
+func shotSearchFields(shot, desc, cgDesc string, tags []string) map[string]string {
+	return map[string]string{
+		"shot":           shot,
+		"description":    desc,
+		"cg_description": cgDesc,
+		"tags":           strings.Join(tags, " "),
+	}
+}
+
+// versionSearchTarget은 버전의 검색 항목 이름이다.
+// 예) CG_0010.fx.v001
+func versionSearchTarget(shot, task string, version int) string {
+	return fmt.Sprintf("%s.%s.v%03d", shot, task, version)
+}
+
+// versionSearchFields는 버전에서 검색될 필드와 그 텍스트를 반환한다.
+func versionSearchFields(outputFiles, images []string, mov, workFile string) map[string]string {
+	return map[string]string{
+		"output_files": strings.Join(outputFiles, " "),
+		"images":       strings.Join(images, " "),
+		"mov":          mov,
+		"work_file":    workFile,
+	}
+}
+
+// IndexReview는 리뷰 메시지를 전체 텍스트 검색에 기록한다.
+// 리뷰가 추가되거나 수정될 때 같은 트랜잭션 안에서 호출되어야 한다.
+func IndexReview(ctx context.Context, tx *sql.Tx, r *Review) error {
+	if r == nil {
+		return errorf(ErrInvalid, "nil review")
+	}
+	return indexSearchWords(ctx, tx, r.ProjectID, SearchReview, r.ID, map[string]string{"msg": r.Msg})
+}
+
+// SearchResult는 전체 텍스트 검색에서 찾아진 하나의 항목이다.
+type SearchResult struct {
+	Project string
+	Kind    SearchKind
+	// Target은 찾아진 항목의 프로젝트 내 아이디이다.
+	// 샷이면 샷 이름, 버전이면 CG_0010.fx.v001 형식,
+	// 리뷰면 Review.ID 형식이다.
+	Target string
+	// Fields는 검색어가 찾아진 필드들이다.
+	Fields []string
+	// Score는 검색 순위를 정하는 점수이다. 높을수록 위에 보인다.
+	Score int
+}
+
+// URL은 이 항목의 정보를 볼 수 있는 로이 페이지의 주소이다.
+func (r *SearchResult) URL() string {
+	switch r.Kind {
+	case SearchShot:
+		return "/search/" + r.Project + "?shot=" + r.Target
+	case SearchVersion, SearchReview:
+		// CG_0010.fx.v001(.r1)
+		ts := strings.Split(r.Target, ".")
+		if len(ts) < 3 || !strings.HasPrefix(ts[2], "v") {
+			return ""
+		}
+		v, err := strconv.Atoi(ts[2][1:])
+		if err != nil {
+			return ""
+		}
+		return fmt.Sprintf("/version/%s/%s/%s/%d", r.Project, ts[0], ts[1], v)
+	}
+	return ""
+}
+
+// FullTextSearch는 샷 설명, CG 설명, 태그, 버전 파일 경로, 리뷰 메시지에서
+// 검색어를 찾아 점수가 높은 순서로 반환한다.
+// 검색어의 각 단어는 기록된 단어의 앞부분과 일치하면 찾아지며,
+// 단어 전체가 일치하거나 더 많은 단어가 일치할수록 높은 점수를 받는다.
+// prj가 빈 문자열이면 보관되지 않은 모든 프로젝트에서 검색한다.
+func FullTextSearch(db *sql.DB, query, prj string, limit int) ([]*SearchResult, error) {
+	return FullTextSearchContext(context.Background(), db, query, prj, limit)
+}
+
+// FullTextSearchContext는 ctx를 받는 FullTextSearch이다.
+func FullTextSearchContext(ctx context.Context, db *sql.DB, query, prj string, limit int) ([]*SearchResult, error) {
+	words := searchWords(query)
+	if len(words) == 0 {
+		return []*SearchResult{}, nil
+	}
+	stmt, args := fullTextSearchQuery(words, prj, limit)
+	rows, err := dbQuery(ctx, db, stmt, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	results := make([]*SearchResult, 0)
+	for rows.Next() {
+		r := &SearchResult{}
+		var kind string
+		if err := rows.Scan(&r.Project, &kind, &r.Target, pq.Array(&r.Fields), &r.Score); err != nil {
+			return nil, err
+		}
+		r.Kind = SearchKind(kind)
+		sort.Strings(r.Fields)
+		results = append(results, r)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return results, nil
+}
+
+// fullTextSearchQuery는 검색어 단어들로 찾아진 항목을 점수가 높은 순서로 읽는 구문과 그 인자를 만든다.
+// 단어마다 그 단어로 시작하는 기록된 단어를 찾고, 단어 전체가 일치하면 2점, 아니면 1점에
+// 필드의 가중치를 곱해 항목별로 더한다. 검색어의 모든 단어가 찾아진 항목만 반환하며,
+// limit이 0보다 크면 그 수만큼만 반환한다.
+func fullTextSearchQuery(words []string, prj string, limit int) (string, []interface{}) {
+	q := &sqlQuery{}
+	pprj := q.placeholder(prj)
+	matches := make([]string, len(words))
+	for i, w := range words {
+		matches[i] = fmt.Sprintf("SELECT project, kind, target, field, %d AS qword, CASE WHEN word=%s THEN 2 ELSE 1 END AS score FROM search_words WHERE word LIKE %s AND (%s = '' OR project=%s)", i, q.placeholder(w), q.placeholder(escapeLike(w)+"%"), pprj, pprj)
+	}
+	// 같은 입력에 같은 구문이 만들어지도록 필드 이름 순서로 가중치를 넣는다.
+	fields := make([]string, 0, len(searchFieldWeight))
+	for f := range searchFieldWeight {
+		fields = append(fields, f)
+	}
+	sort.Strings(fields)
+	weight := "CASE field"
+	for _, f := range fields {
+		weight += fmt.Sprintf(" WHEN %s THEN %s", q.placeholder(f), q.placeholder(searchFieldWeight[f]))
+	}
+	weight += " ELSE 1 END"
+	stmt := fmt.Sprintf("SELECT project, kind, target, array_agg(DISTINCT field), SUM(score * %s)::INT AS total FROM (%s) AS m", weight, strings.Join(matches, " UNION ALL "))
+	stmt += " WHERE project NOT IN (SELECT project FROM archived_projects)"
+	stmt += " GROUP BY project, kind, target HAVING COUNT(DISTINCT qword)=" + q.placeholder(len(words))
+	stmt += " ORDER BY total DESC, project, target"
+	if limit > 0 {
+		stmt += " LIMIT " + q.placeholder(limit)
+	}
+	return stmt, q.args
+}
+
+// ReindexSearch는 db에 저장된 모든 샷, 버전, 리뷰의 검색 단어를 다시 기록한다.
+// 검색 단어 기록 기능이 추가되기 전에 만들어진 데이터를 검색할 수 있게 하거나
+// 단어 테이블이 손상되었을 때 사용한다.
+func ReindexSearch(db *sql.DB) error {
+	return ReindexSearchContext(context.Background(), db)
+}
+
+// ReindexSearchContext는 ctx를 받는 ReindexSearch이다.
+func ReindexSearchContext(ctx context.Context, db *sql.DB) error {
+	prjs, err := AllProjectsContext(ctx, db)
+	if err != nil {
+		return err
+	}
+	for _, p := range prjs {
+		shots, err := SearchShotsContext(ctx, db, p.Project, "", "", "", "", "", time.Time{})
+		if err != nil {
+			return err
+		}
+		reviews, err := projectReviews(ctx, db, p.Project)
+		if err != nil {
+			return err
+		}
+		tx, err := db.BeginTx(ctx, nil)
+		if err != nil {
+			return fmt.Errorf("could not begin a transaction: %w", err)
+		}
+		// 지워진 항목의 단어가 남아 있을 수 있으므로 프로젝트의 단어를 모두 지우고 다시 기록한다.
+		for _, kind := range []SearchKind{SearchShot, SearchVersion, SearchReview} {
+			if err := unindexSearchWords(ctx, tx, p.Project, kind, ""); err != nil {
+				tx.Rollback()
+				return err
+			}
+		}
+		for _, s := range shots {
+			err := indexSearchWords(ctx, tx, p.Project, SearchShot, s.Shot, shotSearchFields(s.Shot, s.Description, s.CGDescription, s.Tags))
+			if err != nil {
+				tx.Rollback()
+				return err
+			}
+			vs, err := ShotVersionsContext(ctx, db, p.Project, s.Shot)
+			if err != nil {
+				tx.Rollback()
+				return err
+			}
+			for _, v := range vs {
+				target := versionSearchTarget(v.Shot, v.Task, v.Version)
+				err := indexSearchWords(ctx, tx, p.Project, SearchVersion, target, versionSearchFields(v.OutputFiles, v.Images, v.Mov, v.WorkFile))
+				if err != nil {
+					tx.Rollback()
+					return err
+				}
+			}
+		}
+		for _, r := range reviews {
+			if err := IndexReview(ctx, tx, r); err != nil {
+				tx.Rollback()
+				return err
+			}
+		}
+		if err := tx.Commit(); err != nil {
+			return fmt.Errorf("could not commit the transaction: %w", err)
+		}
+	}
+	return nil
+}
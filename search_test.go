@@ -0,0 +1,124 @@
+package roi
+
+import (
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestSearchWords(t *testing.T) {
+	cases := []struct {
+		text string
+		want []string
+	}{
+		{
+			text: "",
+			want: []string{},
+		},
+		{
+			text: "CG_0010 로이의 방, 로이의 창문",
+			want: []string{"cg", "0010", "로이의", "방", "창문"},
+		},
+		{
+			text: "/project/test/FOO_0010/render/test.v001.0001.jpg",
+			want: []string{"project", "test", "foo", "0010", "render", "v001", "0001", "jpg"},
+		},
+	}
+	for _, c := range cases {
+		got := searchWords(c.text)
+		if !reflect.DeepEqual(got, c.want) {
+			t.Fatalf("searchWords(%q): got %v, want %v", c.text, got, c.want)
+		}
+	}
+}
+
+func TestSearchResultURL(t *testing.T) {
+	cases := []struct {
+		r    *SearchResult
+		want string
+	}{
+		{
+			r:    &SearchResult{Project: "TEST", Kind: SearchShot, Target: "CG_0010"},
+			want: "/search/TEST?shot=CG_0010",
+		},
+		{
+			r:    &SearchResult{Project: "TEST", Kind: SearchVersion, Target: "CG_0010.fx.v012"},
+			want: "/version/TEST/CG_0010/fx/12",
+		},
+		{
+			r:    &SearchResult{Project: "TEST", Kind: SearchReview, Target: "CG_0010.fx.v001.r1"},
+			want: "/version/TEST/CG_0010/fx/1",
+		},
+	}
+	for _, c := range cases {
+		got := c.r.URL()
+		if got != c.want {
+			t.Fatalf("%v: got %v, want %v", c.r, got, c.want)
+		}
+	}
+}
+
+func TestFullTextSearchQuery(t *testing.T) {
+	stmt, args := fullTextSearchQuery([]string{"로이의", "창문"}, "", 10)
+	if err := checkStmt(stmt, args); err != nil {
+		t.Fatalf("invalid search query: %v", err)
+	}
+	if !strings.HasSuffix(stmt, "LIMIT $"+strconv.Itoa(len(args))) || args[len(args)-1] != 10 {
+		t.Fatalf("search query should be limited in sql: %s", stmt)
+	}
+	stmt, args = fullTextSearchQuery([]string{"창문"}, "TEST", 0)
+	if err := checkStmt(stmt, args); err != nil {
+		t.Fatalf("invalid search query: %v", err)
+	}
+	if strings.Contains(stmt, "LIMIT") {
+		t.Fatalf("search query should not be limited when limit is 0: %s", stmt)
+	}
+}
+
+func TestFullTextSearch(t *testing.T) {
+	db, err := testDB()
+	if err != nil {
+		t.Fatalf("could not connect to database: %v", err)
+	}
+	err = AddProject(db, testProject)
+	if err != nil {
+		t.Fatalf("could not add project: %v", err)
+	}
+	for _, s := range testShots {
+		err = AddShot(db, testProject.Project, s)
+		if err != nil {
+			t.Fatalf("could not add shot: %v", err)
+		}
+	}
+	got, err := FullTextSearch(db, "창문", "", 0)
+	if err != nil {
+		t.Fatalf("could not search: %v", err)
+	}
+	if len(got) != 2 {
+		t.Fatalf("invalid number of search results: want 2, got %d", len(got))
+	}
+	// 모든 단어가 찾아져야 결과에 포함된다.
+	got, err = FullTextSearch(db, "가로등 레트로", testProject.Project, 0)
+	if err != nil {
+		t.Fatalf("could not search: %v", err)
+	}
+	if len(got) != 1 || got[0].Target != testShotC.Shot {
+		t.Fatalf("want only %s, got %v", testShotC.Shot, got)
+	}
+	err = ReindexSearch(db)
+	if err != nil {
+		t.Fatalf("could not reindex: %v", err)
+	}
+	err = DeleteProject(db, testProject.Project)
+	if err != nil {
+		t.Fatalf("could not delete project: %v", err)
+	}
+	got, err = FullTextSearch(db, "창문", "", 0)
+	if err != nil {
+		t.Fatalf("could not search: %v", err)
+	}
+	if len(got) != 0 {
+		t.Fatalf("search words of deleted project remain: %v", got)
+	}
+}
@@ -0,0 +1,252 @@
+package roi
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Session은 로그인한 사용자의 세션이다.
+// 세션은 DB에 저장되어 서버에서 만료시키거나 지울 수 있으며,
+// 사용자의 브라우저에는 세션을 찾기 위한 토큰만 저장된다.
+type Session struct {
+	// ID는 세션 토큰의 sha256 해시이다.
+	// DB가 유출되어도 세션을 가로챌 수 없도록 토큰 자체는 저장하지 않는다.
+	ID   string
+	User string
+	// CSRFToken은 이 세션에서 보내는 폼에 함께 담겨
+	// 폼이 로이가 보인 페이지에서 왔음을 확인하는데 쓰인다.
+	CSRFToken string
+	// UserAgent와 Addr은 사용자가 자신의 세션들을 구별할 수 있도록 로그인할 때 기록한다.
+	UserAgent string
+	Addr      string
+	Created   time.Time
+	LastSeen  time.Time
+	Expires   time.Time
+}
+
+var CreateTableIfNotExistsSessionsStmt = `CREATE TABLE IF NOT EXISTS sessions (
+	id STRING PRIMARY KEY,
+	user_id STRING NOT NULL CHECK (length(user_id) > 0) CHECK (user_id NOT LIKE '% %'),
+	csrf_token STRING NOT NULL CHECK (length(csrf_token) > 0),
+	user_agent STRING NOT NULL,
+	addr STRING NOT NULL,
+	created TIMESTAMPTZ NOT NULL,
+	last_seen TIMESTAMPTZ NOT NULL,
+	expires TIMESTAMPTZ NOT NULL,
+	INDEX (user_id)
+)`
+
+var SessionTableKeys = []string{
+	"id",
+	"user_id",
+	"csrf_token",
+	"user_agent",
+	"addr",
+	"created",
+	"last_seen",
+	"expires",
+}
+
+func (s *Session) dbValues() []interface{} {
+	if s == nil {
+		s = &Session{}
+	}
+	return []interface{}{
+		s.ID,
+		s.User,
+		s.CSRFToken,
+		s.UserAgent,
+		s.Addr,
+		s.Created,
+		s.LastSeen,
+		s.Expires,
+	}
+}
+
+// sessionFromRows는 SessionTableKeys 순서로 읽은 열에서 세션을 만든다.
+func sessionFromRows(rows *sql.Rows) (*Session, error) {
+	s := &Session{}
+	err := rows.Scan(&s.ID, &s.User, &s.CSRFToken, &s.UserAgent, &s.Addr, &s.Created, &s.LastSeen, &s.Expires)
+	if err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// randomToken은 추측할 수 없는 임의의 토큰을 만든다.
+func randomToken() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("could not generate random token: %w", err)
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// sessionID는 세션 토큰으로 DB에 저장되는 세션 아이디를 만든다.
+func sessionID(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// AddSession은 사용자의 세션을 추가하고 브라우저에 저장할 세션 토큰을 반환한다.
+// s의 User와 Expires는 반드시 지정되어야 하며, ID와 CSRFToken은 이 함수가 채운다.
+// Created와 LastSeen이 지정되지 않았다면 현재 시간으로 채운다.
+func AddSession(db *sql.DB, s *Session) (string, error) {
+	return AddSessionContext(context.Background(), db, s)
+}
+
+// AddSessionContext는 ctx를 받는 AddSession이다.
+func AddSessionContext(ctx context.Context, db *sql.DB, s *Session) (string, error) {
+	if s == nil {
+		return "", errorf(ErrInvalid, "nil Session is invalid")
+	}
+	v := &validator{}
+	v.check(s.User != "", "user", "user not specified")
+	v.check(!s.Expires.IsZero(), "expires", "session expiry not specified")
+	if err := v.err(); err != nil {
+		return "", err
+	}
+	exist, err := UserExistContext(ctx, db, s.User)
+	if err != nil {
+		return "", err
+	}
+	if !exist {
+		return "", errorf(ErrNotFound, "user not exist: %s", s.User)
+	}
+	token, err := randomToken()
+	if err != nil {
+		return "", err
+	}
+	csrf, err := randomToken()
+	if err != nil {
+		return "", err
+	}
+	s.ID = sessionID(token)
+	s.CSRFToken = csrf
+	now := time.Now()
+	if s.Created.IsZero() {
+		s.Created = now
+	}
+	if s.LastSeen.IsZero() {
+		s.LastSeen = now
+	}
+	if _, err := insertQuery("sessions", SessionTableKeys, s.dbValues()).exec(ctx, db); err != nil {
+		return "", fmt.Errorf("could not insert session: %w", err)
+	}
+	return token, nil
+}
+
+// GetSession은 세션 토큰으로 세션을 찾는다.
+// 해당 세션이 없거나 만료되었다면 nil을 반환한다.
+func GetSession(db *sql.DB, token string) (*Session, error) {
+	return GetSessionContext(context.Background(), db, token)
+}
+
+// GetSessionContext는 ctx를 받는 GetSession이다.
+func GetSessionContext(ctx context.Context, db *sql.DB, token string) (*Session, error) {
+	if token == "" {
+		return nil, nil
+	}
+	rows, err := selectQuery("sessions", SessionTableKeys...).where("id", sessionID(token)).whereCond("expires > ?", time.Now()).limit(1).query(ctx, db)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	if !rows.Next() {
+		return nil, rows.Err()
+	}
+	return sessionFromRows(rows)
+}
+
+// UserSessions는 사용자의 만료되지 않은 세션들을 최근에 쓰인 순서로 반환한다.
+func UserSessions(db *sql.DB, user string) ([]*Session, error) {
+	return UserSessionsContext(context.Background(), db, user)
+}
+
+// UserSessionsContext는 ctx를 받는 UserSessions이다.
+func UserSessionsContext(ctx context.Context, db *sql.DB, user string) ([]*Session, error) {
+	keystr := strings.Join(SessionTableKeys, ", ")
+	stmt := fmt.Sprintf("SELECT %s FROM sessions WHERE user_id=$1 AND expires > $2 ORDER BY last_seen DESC", keystr)
+	rows, err := dbQuery(ctx, db, stmt, user, time.Now())
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	ss := make([]*Session, 0)
+	for rows.Next() {
+		s, err := sessionFromRows(rows)
+		if err != nil {
+			return nil, err
+		}
+		ss = append(ss, s)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return ss, nil
+}
+
+// TouchSession은 세션이 t에 마지막으로 쓰였다고 기록한다.
+func TouchSession(db *sql.DB, id string, t time.Time) error {
+	return TouchSessionContext(context.Background(), db, id, t)
+}
+
+// TouchSessionContext는 ctx를 받는 TouchSession이다.
+func TouchSessionContext(ctx context.Context, db *sql.DB, id string, t time.Time) error {
+	if _, err := updateQuery("sessions", []string{"last_seen"}, []interface{}{t}).where("id", id).exec(ctx, db); err != nil {
+		return fmt.Errorf("could not update session: %w", err)
+	}
+	return nil
+}
+
+// DeleteSession은 세션을 지운다. 지운 세션의 토큰은 더 이상 쓸 수 없다.
+func DeleteSession(db *sql.DB, id string) error {
+	return DeleteSessionContext(context.Background(), db, id)
+}
+
+// DeleteSessionContext는 ctx를 받는 DeleteSession이다.
+func DeleteSessionContext(ctx context.Context, db *sql.DB, id string) error {
+	if _, err := deleteQuery("sessions").where("id", id).exec(ctx, db); err != nil {
+		return fmt.Errorf("could not delete data from 'sessions' table: %w", err)
+	}
+	return nil
+}
+
+// DeleteUserSessions는 사용자의 모든 세션을 지워, 모든 곳에서 로그아웃 시킨다.
+func DeleteUserSessions(db *sql.DB, user string) error {
+	return DeleteUserSessionsContext(context.Background(), db, user)
+}
+
+// DeleteUserSessionsContext는 ctx를 받는 DeleteUserSessions이다.
+func DeleteUserSessionsContext(ctx context.Context, db *sql.DB, user string) error {
+	if _, err := deleteQuery("sessions").where("user_id", user).exec(ctx, db); err != nil {
+		return fmt.Errorf("could not delete data from 'sessions' table: %w", err)
+	}
+	return nil
+}
+
+// DeleteExpiredSessions는 만료되었거나 idleBefore 이후로 쓰이지 않은 세션들을 지우고
+// 지운 세션의 수를 반환한다.
+func DeleteExpiredSessions(db *sql.DB, idleBefore time.Time) (int, error) {
+	return DeleteExpiredSessionsContext(context.Background(), db, idleBefore)
+}
+
+// DeleteExpiredSessionsContext는 ctx를 받는 DeleteExpiredSessions이다.
+func DeleteExpiredSessionsContext(ctx context.Context, db *sql.DB, idleBefore time.Time) (int, error) {
+	res, err := deleteQuery("sessions").whereCond("(expires <= ? OR last_seen < ?)", time.Now(), idleBefore).exec(ctx, db)
+	if err != nil {
+		return 0, fmt.Errorf("could not delete data from 'sessions' table: %w", err)
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return 0, err
+	}
+	return int(n), nil
+}
@@ -0,0 +1,95 @@
+package roi
+
+import (
+	"testing"
+	"time"
+)
+
+func TestSession(t *testing.T) {
+	db, err := testDB()
+	if err != nil {
+		t.Fatalf("could not connect to database: %v", err)
+	}
+	user := "sessionuser"
+	err = AddUser(db, user, "session password")
+	if err != nil {
+		t.Fatalf("could not add user: %v", err)
+	}
+	defer DeleteUser(db, user)
+
+	_, err = AddSession(db, &Session{User: "sessionnobody", Expires: time.Now().Add(time.Hour)})
+	checkErrorKind(t, err, ErrNotFound)
+	_, err = AddSession(db, &Session{User: user})
+	checkErrorKind(t, err, ErrInvalid)
+
+	s := &Session{User: user, UserAgent: "roi-test", Addr: "127.0.0.1", Expires: time.Now().Add(time.Hour)}
+	token, err := AddSession(db, s)
+	if err != nil {
+		t.Fatalf("could not add session: %v", err)
+	}
+	if token == "" || s.ID == token || s.CSRFToken == "" || s.CSRFToken == token {
+		t.Fatalf("session should have distinct token, id and csrf token: %q, %q, %q", token, s.ID, s.CSRFToken)
+	}
+	got, err := GetSession(db, token)
+	if err != nil {
+		t.Fatalf("could not get session: %v", err)
+	}
+	if got == nil || got.ID != s.ID || got.User != user || got.CSRFToken != s.CSRFToken {
+		t.Fatalf("got %v, want %v", got, s)
+	}
+	// 세션 아이디로는 세션을 찾을 수 없어야 한다.
+	got, err = GetSession(db, s.ID)
+	if err != nil {
+		t.Fatalf("could not get session: %v", err)
+	}
+	if got != nil {
+		t.Fatalf("session should not be found by its id")
+	}
+
+	expired := &Session{User: user, Expires: time.Now().Add(-time.Minute)}
+	expiredToken, err := AddSession(db, expired)
+	if err != nil {
+		t.Fatalf("could not add session: %v", err)
+	}
+	got, err = GetSession(db, expiredToken)
+	if err != nil {
+		t.Fatalf("could not get session: %v", err)
+	}
+	if got != nil {
+		t.Fatalf("expired session should not be found")
+	}
+	idle := &Session{User: user, LastSeen: time.Now().Add(-48 * time.Hour), Expires: time.Now().Add(time.Hour)}
+	if _, err := AddSession(db, idle); err != nil {
+		t.Fatalf("could not add session: %v", err)
+	}
+	ss, err := UserSessions(db, user)
+	if err != nil {
+		t.Fatalf("could not get user sessions: %v", err)
+	}
+	if len(ss) != 2 || ss[0].ID != s.ID || ss[1].ID != idle.ID {
+		t.Fatalf("user sessions should be ordered by last seen, without expired one: %v", ss)
+	}
+	n, err := DeleteExpiredSessions(db, time.Now().Add(-24*time.Hour))
+	if err != nil {
+		t.Fatalf("could not delete expired sessions: %v", err)
+	}
+	if n != 2 {
+		t.Fatalf("deleted %d sessions, want 2", n)
+	}
+
+	err = TouchSession(db, s.ID, time.Now())
+	if err != nil {
+		t.Fatalf("could not touch session: %v", err)
+	}
+	err = DeleteUserSessions(db, user)
+	if err != nil {
+		t.Fatalf("could not delete user sessions: %v", err)
+	}
+	got, err = GetSession(db, token)
+	if err != nil {
+		t.Fatalf("could not get session: %v", err)
+	}
+	if got != nil {
+		t.Fatalf("session should be deleted")
+	}
+}
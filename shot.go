@@ -1,8 +1,8 @@
 package roi
 
 import (
+	"context"
 	"database/sql"
-	"errors"
 	"fmt"
 	"regexp"
 	"sort"
@@ -109,6 +109,16 @@ type Shot struct {
 	DueDate   time.Time
 }
 
+// validate는 샷의 필드들이 적절한지 검사한다.
+func (s *Shot) validate() error {
+	v := &validator{}
+	v.check(IsValidShot(s.Shot), "shot", "invalid shot id: '%s'", s.Shot)
+	v.check(isValidShotStatus(s.Status), "status", "invalid shot status: '%s'", s.Status)
+	v.checkTags("tags", s.Tags)
+	v.checkTasks("working_tasks", s.WorkingTasks)
+	return v.err()
+}
+
 func (s *Shot) dbValues() []interface{} {
 	if s == nil {
 		s = &Shot{}
@@ -177,11 +187,16 @@ var ShotTableIndices = dbIndices(ShotTableKeys)
 
 // AddShot은 db의 특정 프로젝트에 샷을 하나 추가한다.
 func AddShot(db *sql.DB, prj string, s *Shot) error {
+	return AddShotContext(context.Background(), db, prj, s)
+}
+
+// AddShotContext는 ctx를 받는 AddShot이다.
+func AddShotContext(ctx context.Context, db *sql.DB, prj string, s *Shot) error {
 	if prj == "" {
-		return fmt.Errorf("project code not specified")
+		return errorf(ErrInvalid, "project code not specified")
 	}
 	if s == nil {
-		return errors.New("nil Shot is invalid")
+		return errorf(ErrInvalid, "nil Shot is invalid")
 	}
 	if s.Tags == nil {
 		s.Tags = make([]string, 0)
@@ -189,13 +204,33 @@ func AddShot(db *sql.DB, prj string, s *Shot) error {
 	if s.WorkingTasks == nil {
 		s.WorkingTasks = make([]string, 0)
 	}
-	if !isValidShotStatus(s.Status) {
-		return fmt.Errorf("invalid shot status: '%s'", s.Status)
+	if err := s.validate(); err != nil {
+		return err
+	}
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("could not begin a transaction: %w", err)
+	}
+	defer tx.Rollback() // 트랜잭션이 완료되지 않았을 때만 실행됨
+	if err := addShot(ctx, tx, prj, s); err != nil {
+		return err
+	}
+	if err := tx.Commit(); err != nil {
+		return err
 	}
+	return createPathDirs(ctx, db, PathTokens{Project: prj, Shot: s.Shot})
+}
+
+// addShot은 트랜잭션 안에서 샷을 추가하고 검색 단어를 기록한다.
+// 경로 디렉토리는 트랜잭션이 커밋된 뒤에 호출한 쪽에서 만들어야 한다.
+func addShot(ctx context.Context, tx *sql.Tx, prj string, s *Shot) error {
 	keys := strings.Join(ShotTableKeys, ", ")
 	idxs := strings.Join(ShotTableIndices, ", ")
 	stmt := fmt.Sprintf("INSERT INTO shots (%s) VALUES (%s)", keys, idxs)
-	if _, err := db.Exec(stmt, s.dbValues()...); err != nil {
+	if _, err := dbExec(ctx, tx, stmt, s.dbValues()...); err != nil {
+		return err
+	}
+	if err := indexSearchWords(ctx, tx, prj, SearchShot, s.Shot, shotSearchFields(s.Shot, s.Description, s.CGDescription, s.Tags)); err != nil {
 		return err
 	}
 	return nil
@@ -203,11 +238,17 @@ func AddShot(db *sql.DB, prj string, s *Shot) error {
 
 // ShotExist는 db에 해당 샷이 존재하는지를 검사한다.
 func ShotExist(db *sql.DB, prj, shot string) (bool, error) {
+	return ShotExistContext(context.Background(), db, prj, shot)
+}
+
+// ShotExistContext는 ctx를 받는 ShotExist이다.
+func ShotExistContext(ctx context.Context, db *sql.DB, prj, shot string) (bool, error) {
 	stmt := "SELECT shot FROM shots WHERE project=$1 AND shot=$2 LIMIT 1"
-	rows, err := db.Query(stmt, prj, shot)
+	rows, err := dbQuery(ctx, db, stmt, prj, shot)
 	if err != nil {
 		return false, err
 	}
+	defer rows.Close()
 	return rows.Next(), nil
 }
 
@@ -229,12 +270,18 @@ func shotFromRows(rows *sql.Rows) (*Shot, error) {
 // GetShot은 db의 특정 프로젝트에서 샷 이름으로 해당 샷을 찾는다.
 // 만일 그 이름의 샷이 없다면 nil이 반환된다.
 func GetShot(db *sql.DB, prj string, shot string) (*Shot, error) {
+	return GetShotContext(context.Background(), db, prj, shot)
+}
+
+// GetShotContext는 ctx를 받는 GetShot이다.
+func GetShotContext(ctx context.Context, db *sql.DB, prj string, shot string) (*Shot, error) {
 	keystr := strings.Join(ShotTableKeys, ", ")
 	stmt := fmt.Sprintf("SELECT %s FROM shots WHERE project=$1 AND shot=$2 LIMIT 1", keystr)
-	rows, err := db.Query(stmt, prj, shot)
+	rows, err := dbQuery(ctx, db, stmt, prj, shot)
 	if err != nil {
 		return nil, err
 	}
+	defer rows.Close()
 	ok := rows.Next()
 	if !ok {
 		return nil, nil
@@ -243,7 +290,49 @@ func GetShot(db *sql.DB, prj string, shot string) (*Shot, error) {
 }
 
 // SearchShots는 db의 특정 프로젝트에서 검색 조건에 맞는 샷 리스트를 반환한다.
+// task_due_date가 주어지면 그 날 마감인 태스크를 가진 샷을 찾는다.
 func SearchShots(db *sql.DB, prj, shot, tag, status, assignee, task_status string, task_due_date time.Time) ([]*Shot, error) {
+	return SearchShotsContext(context.Background(), db, prj, shot, tag, status, assignee, task_status, task_due_date)
+}
+
+// SearchShotsContext는 ctx를 받는 SearchShots이다.
+func SearchShotsContext(ctx context.Context, db *sql.DB, prj, shot, tag, status, assignee, task_status string, task_due_date time.Time) ([]*Shot, error) {
+	var dueTo time.Time
+	if !task_due_date.IsZero() {
+		dueTo = task_due_date.AddDate(0, 0, 1)
+	}
+	return searchShots(ctx, db, prj, shot, tag, status, assignee, task_status, task_due_date, dueTo)
+}
+
+// SearchShotsDueWithin은 태스크 마감일 대신 오늘부터 days일 안에 마감인 태스크를 가진 샷을 찾는 SearchShots이다.
+// days가 1이면 오늘 마감인 태스크만, 7이면 오늘부터 일주일 안에 마감인 태스크를 찾는다.
+// days가 0이면 마감일로 샷을 거르지 않는다.
+func SearchShotsDueWithin(db *sql.DB, prj, shot, tag, status, assignee, task_status string, days int) ([]*Shot, error) {
+	return SearchShotsDueWithinContext(context.Background(), db, prj, shot, tag, status, assignee, task_status, days)
+}
+
+// SearchShotsDueWithinContext는 ctx를 받는 SearchShotsDueWithin이다.
+func SearchShotsDueWithinContext(ctx context.Context, db *sql.DB, prj, shot, tag, status, assignee, task_status string, days int) ([]*Shot, error) {
+	if days < 0 {
+		return nil, errorf(ErrInvalid, "task due days should not be negative: %d", days)
+	}
+	from, to := taskDueRange(days, time.Now())
+	return searchShots(ctx, db, prj, shot, tag, status, assignee, task_status, from, to)
+}
+
+// taskDueRange는 now가 속한 날부터 days일 동안의 마감일 범위를 반환한다.
+// from은 범위에 포함되고 to는 포함되지 않는다. days가 0이면 빈 시간들을 반환한다.
+func taskDueRange(days int, now time.Time) (time.Time, time.Time) {
+	if days == 0 {
+		return time.Time{}, time.Time{}
+	}
+	from := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, now.Location())
+	return from, from.AddDate(0, 0, days)
+}
+
+// searchShots는 검색 조건에 맞는 샷을 찾는다.
+// dueFrom, dueTo가 주어지면 마감일이 dueFrom 이후이며 dueTo 이전인 태스크를 가진 샷만 찾는다.
+func searchShots(ctx context.Context, db *sql.DB, prj, shot, tag, status, assignee, task_status string, dueFrom, dueTo time.Time) ([]*Shot, error) {
 	keystr := ""
 	for i, k := range ShotTableKeys {
 		if i != 0 {
@@ -275,7 +364,7 @@ func SearchShots(db *sql.DB, prj, shot, tag, status, assignee, task_status strin
 		vals = append(vals, status)
 		i++
 	}
-	if assignee != "" || task_status != "" || !task_due_date.IsZero() {
+	if assignee != "" || task_status != "" || !dueFrom.IsZero() || !dueTo.IsZero() {
 		stmt += " JOIN tasks ON (tasks.project = shots.project AND tasks.shot = shots.shot)"
 	}
 	if assignee != "" {
@@ -288,16 +377,21 @@ func SearchShots(db *sql.DB, prj, shot, tag, status, assignee, task_status strin
 		vals = append(vals, task_status)
 		i++
 	}
-	if !task_due_date.IsZero() {
-		where = append(where, fmt.Sprintf("tasks.due_date=$%d", i))
-		vals = append(vals, task_due_date)
+	if !dueFrom.IsZero() {
+		where = append(where, fmt.Sprintf("tasks.due_date>=$%d", i))
+		vals = append(vals, dueFrom)
+		i++
+	}
+	if !dueTo.IsZero() {
+		where = append(where, fmt.Sprintf("tasks.due_date<$%d", i))
+		vals = append(vals, dueTo)
 		i++
 	}
 	wherestr := strings.Join(where, " AND ")
 	if wherestr != "" {
 		stmt += " WHERE " + wherestr
 	}
-	rows, err := db.Query(stmt, vals...)
+	rows, err := dbQuery(ctx, db, stmt, vals...)
 	if err != nil {
 		return nil, err
 	}
@@ -340,6 +434,15 @@ type UpdateShotParam struct {
 	DueDate       time.Time
 }
 
+// validate는 업데이트할 필드들이 적절한지 검사한다.
+func (u UpdateShotParam) validate() error {
+	v := &validator{}
+	v.check(isValidShotStatus(u.Status), "status", "invalid shot status: '%s'", u.Status)
+	v.checkTags("tags", u.Tags)
+	v.checkTasks("working_tasks", u.WorkingTasks)
+	return v.err()
+}
+
 func (u UpdateShotParam) keys() []string {
 	return []string{
 		"status",
@@ -355,10 +458,6 @@ func (u UpdateShotParam) keys() []string {
 	}
 }
 
-func (u UpdateShotParam) indices() []string {
-	return dbIndices(u.keys())
-}
-
 func (u UpdateShotParam) values() []interface{} {
 	if u.Tags == nil {
 		u.Tags = make([]string, 0)
@@ -382,41 +481,88 @@ func (u UpdateShotParam) values() []interface{} {
 
 // UpdateShot은 db에서 해당 샷을 수정한다.
 func UpdateShot(db *sql.DB, prj, shot string, upd UpdateShotParam) error {
+	return UpdateShotContext(context.Background(), db, prj, shot, upd)
+}
+
+// UpdateShotContext는 ctx를 받는 UpdateShot이다.
+func UpdateShotContext(ctx context.Context, db *sql.DB, prj, shot string, upd UpdateShotParam) error {
 	if prj == "" {
-		return fmt.Errorf("project code not specified")
+		return errorf(ErrInvalid, "project code not specified")
 	}
 	if shot == "" {
-		return errors.New("shot id empty")
+		return errorf(ErrInvalid, "shot id empty")
+	}
+	if err := upd.validate(); err != nil {
+		return err
 	}
-	if !isValidShotStatus(upd.Status) {
-		return fmt.Errorf("invalid shot status: '%s'", upd.Status)
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("could not begin a transaction: %w", err)
 	}
-	keystr := strings.Join(upd.keys(), ", ")
-	idxstr := strings.Join(upd.indices(), ", ")
-	stmt := fmt.Sprintf("UPDATE shots SET (%s) = (%s) WHERE project='%s' AND shot='%s'", keystr, idxstr, prj, shot)
-	if _, err := db.Exec(stmt, upd.values()...); err != nil {
+	defer tx.Rollback() // 트랜잭션이 완료되지 않았을 때만 실행됨
+	q := updateQuery("shots", upd.keys(), upd.values()).where("project", prj).where("shot", shot)
+	if _, err := q.exec(ctx, tx); err != nil {
 		return err
 	}
-	return nil
+	if err := indexSearchWords(ctx, tx, prj, SearchShot, shot, shotSearchFields(shot, upd.Description, upd.CGDescription, upd.Tags)); err != nil {
+		return err
+	}
+	return tx.Commit()
 }
 
 // DeleteShot은 해당 샷과 그 하위의 모든 데이터를 db에서 지운다.
 // 해당 샷이 없어도 에러를 내지 않기 때문에 검사를 원한다면 ShotExist를 사용해야 한다.
 // 만일 처리 중간에 에러가 나면 아무 데이터도 지우지 않고 에러를 반환한다.
+//
+// 사용자가 지우는 샷은 휴지통에서 되살릴 수 있도록 TrashShot으로 지워야 한다.
 func DeleteShot(db *sql.DB, prj, shot string) error {
-	tx, err := db.Begin()
+	return DeleteShotContext(context.Background(), db, prj, shot)
+}
+
+// DeleteShotContext는 ctx를 받는 DeleteShot이다.
+func DeleteShotContext(ctx context.Context, db *sql.DB, prj, shot string) error {
+	tx, err := db.BeginTx(ctx, nil)
 	if err != nil {
-		return fmt.Errorf("could not begin a transaction: %v", err)
+		return fmt.Errorf("could not begin a transaction: %w", err)
 	}
 	defer tx.Rollback() // 트랜잭션이 완료되지 않았을 때만 실행됨
-	if _, err := tx.Exec("DELETE FROM shots WHERE project=$1 AND shot=$2", prj, shot); err != nil {
-		return fmt.Errorf("could not delete data from 'shots' table: %v", err)
+	if err := deleteShot(ctx, tx, prj, shot); err != nil {
+		return err
 	}
-	if _, err := tx.Exec("DELETE FROM tasks WHERE project=$1 AND shot=$2", prj, shot); err != nil {
-		return fmt.Errorf("could not delete data from 'tasks' table: %v", err)
+	return tx.Commit()
+}
+
+// deleteShot은 트랜잭션 안에서 해당 샷과 그 하위의 모든 데이터를 지운다.
+func deleteShot(ctx context.Context, tx *sql.Tx, prj, shot string) error {
+	if _, err := dbExec(ctx, tx, "DELETE FROM shots WHERE project=$1 AND shot=$2", prj, shot); err != nil {
+		return fmt.Errorf("could not delete data from 'shots' table: %w", err)
 	}
-	if _, err := tx.Exec("DELETE FROM versions WHERE project=$1 AND shot=$2", prj, shot); err != nil {
-		return fmt.Errorf("could not delete data from 'versions' table: %v", err)
+	if _, err := dbExec(ctx, tx, "DELETE FROM tasks WHERE project=$1 AND shot=$2", prj, shot); err != nil {
+		return fmt.Errorf("could not delete data from 'tasks' table: %w", err)
 	}
-	return tx.Commit()
+	if _, err := dbExec(ctx, tx, "DELETE FROM version_files WHERE project=$1 AND shot=$2", prj, shot); err != nil {
+		return fmt.Errorf("could not delete data from 'version_files' table: %w", err)
+	}
+	if _, err := dbExec(ctx, tx, "DELETE FROM vendor_tasks WHERE project=$1 AND shot=$2", prj, shot); err != nil {
+		return fmt.Errorf("could not delete data from 'vendor_tasks' table: %w", err)
+	}
+	if _, err := dbExec(ctx, tx, "DELETE FROM versions WHERE project=$1 AND shot=$2", prj, shot); err != nil {
+		return fmt.Errorf("could not delete data from 'versions' table: %w", err)
+	}
+	if err := unindexSearchWords(ctx, tx, prj, SearchShot, shot); err != nil {
+		return err
+	}
+	if err := unindexSearchWordsWithPrefix(ctx, tx, prj, SearchVersion, shot+"."); err != nil {
+		return err
+	}
+	if err := unindexSearchWordsWithPrefix(ctx, tx, prj, SearchReview, shot+"."); err != nil {
+		return err
+	}
+	if err := deleteReviewsWithPrefix(ctx, tx, prj, shot+"."); err != nil {
+		return err
+	}
+	if _, err := dbExec(ctx, tx, "DELETE FROM shot_aliases WHERE project=$1 AND shot=$2", prj, shot); err != nil {
+		return fmt.Errorf("could not delete data from 'shot_aliases' table: %w", err)
+	}
+	return nil
 }
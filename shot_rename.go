@@ -0,0 +1,652 @@
+package roi
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// 샷 이름은 태스크, 버전, 리뷰 아이디와 썸네일 경로에 포함되어 있기 때문에
+// 샷의 이름을 바꾸거나 샷을 합칠 때는 이들을 모두 함께 옮겨야 한다.
+// 이름이 바뀌거나 합쳐져 사라진 샷의 예전 이름은 별칭으로 기록되어, 예전 이름으로도 샷을 찾을 수 있다.
+
+var CreateTableIfNotExistsShotAliasesStmt = `CREATE TABLE IF NOT EXISTS shot_aliases (
+	uniqid UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+	project STRING NOT NULL CHECK (length(project) > 0) CHECK (project NOT LIKE '% %'),
+	alias STRING NOT NULL CHECK (length(alias) > 0) CHECK (alias NOT LIKE '% %'),
+	shot STRING NOT NULL CHECK (length(shot) > 0) CHECK (shot NOT LIKE '% %'),
+	created TIMESTAMPTZ NOT NULL,
+	UNIQUE(project, alias)
+)`
+
+// ShotAlias는 이름이 바뀌거나 다른 샷에 합쳐진 샷의 예전 이름이다.
+type ShotAlias struct {
+	Project string
+	// Alias는 샷의 예전 이름이다.
+	Alias string
+	// Shot은 현재 샷의 이름이다.
+	Shot    string
+	Created time.Time
+}
+
+// addShotAlias는 트랜잭션 안에서 alias를 shot의 별칭으로 기록한다.
+// alias를 가리키던 별칭들도 shot을 가리키도록 바꾸며, shot 이름의 별칭은 지운다.
+func addShotAlias(ctx context.Context, tx *sql.Tx, prj, alias, shot string) error {
+	if _, err := dbExec(ctx, tx, "UPDATE shot_aliases SET shot=$1 WHERE project=$2 AND shot=$3", shot, prj, alias); err != nil {
+		return fmt.Errorf("could not update 'shot_aliases' table: %w", err)
+	}
+	if _, err := dbExec(ctx, tx, "DELETE FROM shot_aliases WHERE project=$1 AND alias=$2", prj, shot); err != nil {
+		return fmt.Errorf("could not delete data from 'shot_aliases' table: %w", err)
+	}
+	stmt := `INSERT INTO shot_aliases (project, alias, shot, created) VALUES ($1, $2, $3, $4)
+		ON CONFLICT (project, alias) DO UPDATE SET shot = excluded.shot, created = excluded.created`
+	if _, err := dbExec(ctx, tx, stmt, prj, alias, shot, time.Now()); err != nil {
+		return fmt.Errorf("could not insert data into 'shot_aliases' table: %w", err)
+	}
+	return nil
+}
+
+// ResolveShotAlias는 예전 샷 이름이 현재 가리키는 샷 이름을 반환한다.
+// 해당 이름의 별칭이 없다면 빈 문자열을 반환한다.
+func ResolveShotAlias(db *sql.DB, prj, alias string) (string, error) {
+	return ResolveShotAliasContext(context.Background(), db, prj, alias)
+}
+
+// ResolveShotAliasContext는 ctx를 받는 ResolveShotAlias이다.
+func ResolveShotAliasContext(ctx context.Context, db *sql.DB, prj, alias string) (string, error) {
+	rows, err := dbQuery(ctx, db, "SELECT shot FROM shot_aliases WHERE project=$1 AND alias=$2", prj, alias)
+	if err != nil {
+		return "", err
+	}
+	defer rows.Close()
+	if !rows.Next() {
+		return "", rows.Err()
+	}
+	var shot string
+	if err := rows.Scan(&shot); err != nil {
+		return "", err
+	}
+	return shot, nil
+}
+
+// ShotAliases는 샷을 가리키는 별칭들을 기록된 순서로 반환한다.
+func ShotAliases(db *sql.DB, prj, shot string) ([]*ShotAlias, error) {
+	return ShotAliasesContext(context.Background(), db, prj, shot)
+}
+
+// ShotAliasesContext는 ctx를 받는 ShotAliases이다.
+func ShotAliasesContext(ctx context.Context, db *sql.DB, prj, shot string) ([]*ShotAlias, error) {
+	rows, err := dbQuery(ctx, db, "SELECT project, alias, shot, created FROM shot_aliases WHERE project=$1 AND shot=$2 ORDER BY created", prj, shot)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	as := make([]*ShotAlias, 0)
+	for rows.Next() {
+		a := &ShotAlias{}
+		if err := rows.Scan(&a.Project, &a.Alias, &a.Shot, &a.Created); err != nil {
+			return nil, err
+		}
+		as = append(as, a)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return as, nil
+}
+
+// movedTarget은 from 샷의 버전 아이디(CG_0010.fx.v001)나 리뷰 아이디(CG_0010.fx.v001.r1)를
+// to 샷으로 옮기고 버전 번호에 offset을 더한 아이디를 반환한다.
+func movedTarget(id, from, to string, offset int) (string, error) {
+	ids := strings.Split(id, ".")
+	if len(ids) != 3 && len(ids) != 4 {
+		return "", errorf(ErrInvalid, "invalid target: %s", id)
+	}
+	if ids[0] != from {
+		return "", errorf(ErrInvalid, "target not in shot %s: %s", from, id)
+	}
+	if !strings.HasPrefix(ids[2], "v") {
+		return "", errorf(ErrInvalid, "invalid version in target: %s", id)
+	}
+	v, err := strconv.Atoi(ids[2][1:])
+	if err != nil {
+		return "", errorf(ErrInvalid, "invalid version in target: %s", id)
+	}
+	moved := versionSearchTarget(to, ids[1], v+offset)
+	if len(ids) == 4 {
+		moved += "." + ids[3]
+	}
+	return moved, nil
+}
+
+// versionTables는 샷, 태스크, 버전으로 버전을 가리키는 테이블들이다.
+var versionTables = []string{
+	"versions",
+	"version_files",
+	"playlist_items",
+	"review_session_items",
+	"delivery_items",
+}
+
+// moveVersionRows는 트랜잭션 안에서 from 샷의 버전들과 그 리뷰, 그림, 검색 단어를
+// to 샷으로 옮기고 버전 번호에 offset을 더한다. task가 빈 문자열이 아니면 그 태스크의 버전만 옮긴다.
+// 태스크는 옮기지 않는다.
+func moveVersionRows(ctx context.Context, tx *sql.Tx, prj, from, to, task string, offset int) error {
+	where := "project=$3 AND shot=$4"
+	args := []interface{}{to, offset, prj, from}
+	prefix := from + "."
+	if task != "" {
+		where += " AND task=$5"
+		args = append(args, task)
+		prefix += task + "."
+	}
+	for _, t := range versionTables {
+		stmt := fmt.Sprintf("UPDATE %s SET shot=$1, version=version+$2 WHERE %s", t, where)
+		if _, err := dbExec(ctx, tx, stmt, args...); err != nil {
+			return fmt.Errorf("could not update '%s' table: %w", t, err)
+		}
+	}
+	retargets := []struct {
+		table  string
+		prjCol string
+		col    string
+	}{
+		{"reviews", "project_id", "id"},
+		{"reviews", "project_id", "output_id"},
+		{"annotations", "project", "review_id"},
+		{"search_words", "project", "target"},
+	}
+	for _, r := range retargets {
+		stmt := fmt.Sprintf("SELECT DISTINCT %s FROM %s WHERE %s=$1 AND %s LIKE $2", r.col, r.table, r.prjCol, r.col)
+		rows, err := dbQuery(ctx, tx, stmt, prj, escapeLike(prefix)+"%")
+		if err != nil {
+			return err
+		}
+		ids := make([]string, 0)
+		for rows.Next() {
+			var id string
+			if err := rows.Scan(&id); err != nil {
+				rows.Close()
+				return err
+			}
+			ids = append(ids, id)
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return err
+		}
+		stmt = fmt.Sprintf("UPDATE %s SET %s=$1 WHERE %s=$2 AND %s=$3", r.table, r.col, r.prjCol, r.col)
+		for _, id := range ids {
+			moved, err := movedTarget(id, from, to, offset)
+			if err != nil {
+				return err
+			}
+			if _, err := dbExec(ctx, tx, stmt, moved, prj, id); err != nil {
+				return fmt.Errorf("could not update '%s' table: %w", r.table, err)
+			}
+		}
+	}
+	return nil
+}
+
+// fileMove는 옮겨야 할 사용자 데이터 파일이다.
+type fileMove struct {
+	src string
+	dst string
+}
+
+// versionDataMoves는 from 샷의 버전 썸네일과 리뷰 그림 파일을 to 샷으로 옮기고
+// 버전 번호에 offset을 더하기 위해 옮겨야 할 파일들을 반환한다.
+// task가 빈 문자열이 아니면 그 태스크의 파일만 옮긴다.
+func versionDataMoves(prj, from, to, task string, offset int) ([]fileMove, error) {
+	moves := make([]fileMove, 0)
+	for _, kind := range []string{"version-thumbnail", "annotation"} {
+		root := filepath.Join(UserDataDir, kind, prj, from)
+		if task != "" {
+			root = filepath.Join(root, task)
+		}
+		err := filepath.Walk(root, func(pth string, fi os.FileInfo, err error) error {
+			if err != nil {
+				if pth == root && os.IsNotExist(err) {
+					return filepath.SkipDir
+				}
+				return err
+			}
+			if fi.IsDir() {
+				return nil
+			}
+			rel, err := filepath.Rel(filepath.Join(UserDataDir, kind, prj, from), pth)
+			if err != nil {
+				return err
+			}
+			// rel은 <태스크>/v001/<파일> 형식이다.
+			parts := strings.Split(filepath.ToSlash(rel), "/")
+			if len(parts) != 3 || !strings.HasPrefix(parts[1], "v") {
+				return nil
+			}
+			v, err := strconv.Atoi(parts[1][1:])
+			if err != nil {
+				return nil
+			}
+			name := parts[2]
+			if kind == "annotation" {
+				id, err := movedTarget(strings.TrimSuffix(name, ".png"), from, to, offset)
+				if err != nil {
+					return nil
+				}
+				name = id + ".png"
+			}
+			dst := filepath.Join(UserDataDir, kind, prj, to, parts[0], fmt.Sprintf("v%03d", v+offset), name)
+			moves = append(moves, fileMove{src: pth, dst: dst})
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	return moves, nil
+}
+
+// thumbnailMoves는 from 샷의 썸네일을 to 샷으로 옮기기 위해 옮겨야 할 파일들을 반환한다.
+func thumbnailMoves(prj, from, to string) ([]fileMove, error) {
+	moves := make([]fileMove, 0)
+	for _, sz := range ThumbnailSizes {
+		src := ThumbnailFile(prj, from, sz.Name)
+		if _, err := os.Stat(src); err != nil {
+			if os.IsNotExist(err) {
+				continue
+			}
+			return nil, err
+		}
+		moves = append(moves, fileMove{src: src, dst: ThumbnailFile(prj, to, sz.Name)})
+	}
+	if _, err := os.Stat(legacyThumbnailFile(prj, from)); err == nil {
+		moves = append(moves, fileMove{src: legacyThumbnailFile(prj, from), dst: legacyThumbnailFile(prj, to)})
+	}
+	return moves, nil
+}
+
+// applyFileMoves는 파일들을 옮긴다. 중간에 에러가 나면 이미 옮긴 파일을 되돌린 뒤 에러를 반환한다.
+func applyFileMoves(moves []fileMove) error {
+	for i, m := range moves {
+		err := os.MkdirAll(filepath.Dir(m.dst), 0755)
+		if err == nil {
+			err = os.Rename(m.src, m.dst)
+		}
+		if err != nil {
+			revertFileMoves(moves[:i])
+			return err
+		}
+	}
+	return nil
+}
+
+// revertFileMoves는 applyFileMoves로 옮긴 파일들을 원래 위치로 되돌린다.
+func revertFileMoves(moves []fileMove) {
+	for i := len(moves) - 1; i >= 0; i-- {
+		os.Rename(moves[i].dst, moves[i].src)
+	}
+}
+
+// removeShotUserData는 더 이상 존재하지 않는 샷의 사용자 데이터 디렉토리를 지운다.
+func removeShotUserData(prj, shot string) error {
+	if err := DeleteThumbnail(prj, shot); err != nil {
+		return err
+	}
+	for _, kind := range []string{"version-thumbnail", "annotation"} {
+		if err := os.RemoveAll(filepath.Join(UserDataDir, kind, prj, shot)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// RenameShot은 샷의 이름을 바꾼다. 샷의 태스크, 버전, 리뷰와 썸네일도 새 이름으로 옮겨지며,
+// 예전 이름은 별칭으로 기록되어 ResolveShotAlias로 찾을 수 있다.
+// 휴지통에 있는 예전 샷의 태스크나 버전은 옮겨지지 않는다.
+// 만일 처리 중간에 에러가 나면 db와 파일은 바뀌지 않고 에러를 반환한다.
+func RenameShot(db *sql.DB, prj, shot, newShot string) error {
+	return RenameShotContext(context.Background(), db, prj, shot, newShot)
+}
+
+// RenameShotContext는 ctx를 받는 RenameShot이다.
+func RenameShotContext(ctx context.Context, db *sql.DB, prj, shot, newShot string) error {
+	if !IsValidShot(newShot) {
+		return errorf(ErrInvalid, "invalid shot id: %s", newShot)
+	}
+	s, err := GetShotContext(ctx, db, prj, shot)
+	if err != nil {
+		return err
+	}
+	if s == nil {
+		return errorf(ErrNotFound, "shot not exist: %s.%s", prj, shot)
+	}
+	exist, err := ShotExistContext(ctx, db, prj, newShot)
+	if err != nil {
+		return err
+	}
+	if exist {
+		return errorf(ErrExists, "shot already exist: %s.%s", prj, newShot)
+	}
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("could not begin a transaction: %w", err)
+	}
+	defer tx.Rollback() // 트랜잭션이 완료되지 않았을 때만 실행됨
+	if err := renameShot(ctx, tx, prj, s, newShot); err != nil {
+		return err
+	}
+	moves, err := thumbnailMoves(prj, shot, newShot)
+	if err != nil {
+		return err
+	}
+	vmoves, err := versionDataMoves(prj, shot, newShot, "", 0)
+	if err != nil {
+		return err
+	}
+	moves = append(moves, vmoves...)
+	if err := applyFileMoves(moves); err != nil {
+		return fmt.Errorf("could not move user data: %w", err)
+	}
+	if err := tx.Commit(); err != nil {
+		revertFileMoves(moves)
+		return err
+	}
+	if err := createPathDirs(ctx, db, PathTokens{Project: prj, Shot: newShot}); err != nil {
+		return err
+	}
+	return removeShotUserData(prj, shot)
+}
+
+// renameShot은 트랜잭션 안에서 샷과 그 하위의 열들을 새 이름으로 옮기고 예전 이름을 별칭으로 기록한다.
+func renameShot(ctx context.Context, tx *sql.Tx, prj string, s *Shot, newShot string) error {
+	for _, t := range []string{"shots", "tasks", "vendor_tasks"} {
+		stmt := fmt.Sprintf("UPDATE %s SET shot=$1 WHERE project=$2 AND shot=$3", t)
+		if _, err := dbExec(ctx, tx, stmt, newShot, prj, s.Shot); err != nil {
+			return fmt.Errorf("could not update '%s' table: %w", t, err)
+		}
+	}
+	if err := moveVersionRows(ctx, tx, prj, s.Shot, newShot, "", 0); err != nil {
+		return err
+	}
+	if err := unindexSearchWords(ctx, tx, prj, SearchShot, s.Shot); err != nil {
+		return err
+	}
+	if err := indexSearchWords(ctx, tx, prj, SearchShot, newShot, shotSearchFields(newShot, s.Description, s.CGDescription, s.Tags)); err != nil {
+		return err
+	}
+	return addShotAlias(ctx, tx, prj, s.Shot, newShot)
+}
+
+// SplitShot은 샷을 나누어 새 샷을 만든다. 새 샷은 원래 샷의 정보와 tasks 태스크들을 복사해 가지며,
+// tasks가 비어 있으면 원래 샷의 모든 작업 태스크를 복사한다. 버전은 원래 샷에 남으므로
+// 복사된 태스크는 버전 없이 시작하며, 외주 배정도 복사되지 않는다.
+func SplitShot(db *sql.DB, prj, shot, newShot string, tasks []string) error {
+	return SplitShotContext(context.Background(), db, prj, shot, newShot, tasks)
+}
+
+// SplitShotContext는 ctx를 받는 SplitShot이다.
+func SplitShotContext(ctx context.Context, db *sql.DB, prj, shot, newShot string, tasks []string) error {
+	if !IsValidShot(newShot) {
+		return errorf(ErrInvalid, "invalid shot id: %s", newShot)
+	}
+	s, err := GetShotContext(ctx, db, prj, shot)
+	if err != nil {
+		return err
+	}
+	if s == nil {
+		return errorf(ErrNotFound, "shot not exist: %s.%s", prj, shot)
+	}
+	exist, err := ShotExistContext(ctx, db, prj, newShot)
+	if err != nil {
+		return err
+	}
+	if exist {
+		return errorf(ErrExists, "shot already exist: %s.%s", prj, newShot)
+	}
+	if len(tasks) == 0 {
+		tasks = s.WorkingTasks
+	}
+	ts, err := ShotTasksContext(ctx, db, prj, shot)
+	if err != nil {
+		return err
+	}
+	shotTask := make(map[string]*Task)
+	for _, t := range ts {
+		shotTask[t.Task] = t
+	}
+	for _, task := range tasks {
+		if shotTask[task] == nil {
+			return errorf(ErrNotFound, "task not exist: %s.%s.%s", prj, shot, task)
+		}
+	}
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("could not begin a transaction: %w", err)
+	}
+	defer tx.Rollback() // 트랜잭션이 완료되지 않았을 때만 실행됨
+	ns := *s
+	ns.Shot = newShot
+	ns.WorkingTasks = tasks
+	if err := addShot(ctx, tx, prj, &ns); err != nil {
+		return err
+	}
+	keystr := strings.Join(TaskTableKeys, ", ")
+	idxstr := strings.Join(TaskTableIndices, ", ")
+	stmt := fmt.Sprintf("INSERT INTO tasks (%s) VALUES (%s)", keystr, idxstr)
+	dirs := []PathTokens{{Project: prj, Shot: newShot}}
+	for _, task := range tasks {
+		t := *shotTask[task]
+		t.Shot = newShot
+		t.LastOutputVersion = 0
+		if _, err := dbExec(ctx, tx, stmt, t.dbValues()...); err != nil {
+			return fmt.Errorf("could not copy task %s: %w", task, err)
+		}
+		dirs = append(dirs, PathTokens{Project: prj, Shot: newShot, Task: task})
+	}
+	copied, err := copyThumbnail(prj, shot, newShot)
+	if err != nil {
+		return fmt.Errorf("could not copy thumbnail: %w", err)
+	}
+	if err := tx.Commit(); err != nil {
+		if copied {
+			DeleteThumbnail(prj, newShot)
+		}
+		return err
+	}
+	return createPathDirs(ctx, db, dirs...)
+}
+
+// copyThumbnail은 from 샷의 썸네일을 to 샷으로 복사하고, 복사한 썸네일이 있는지를 반환한다.
+func copyThumbnail(prj, from, to string) (bool, error) {
+	moves, err := thumbnailMoves(prj, from, to)
+	if err != nil {
+		return false, err
+	}
+	for _, m := range moves {
+		if err := copyFile(m.src, m.dst); err != nil {
+			DeleteThumbnail(prj, to)
+			return false, err
+		}
+	}
+	return len(moves) != 0, nil
+}
+
+// copyFile은 src 파일을 dst로 복사한다. dst의 상위 디렉토리가 없으면 만든다.
+func copyFile(src, dst string) error {
+	if err := os.MkdirAll(filepath.Dir(dst), 0755); err != nil {
+		return err
+	}
+	r, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+	w, err := os.Create(dst)
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(w, r)
+	if cerr := w.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
+
+// MergeShot은 src 샷을 dst 샷에 합친다. src의 태스크와 버전, 리뷰는 dst로 옮겨지며,
+// dst에 이미 같은 태스크가 있다면 src의 버전은 dst 태스크의 마지막 버전 뒤로 번호가 바뀌어 옮겨진다.
+// src의 태그와 작업 태스크는 dst에 더해지고, src 샷은 지워진 뒤 dst의 별칭으로 기록된다.
+// 만일 처리 중간에 에러가 나면 db와 파일은 바뀌지 않고 에러를 반환한다.
+func MergeShot(db *sql.DB, prj, src, dst string) error {
+	return MergeShotContext(context.Background(), db, prj, src, dst)
+}
+
+// MergeShotContext는 ctx를 받는 MergeShot이다.
+func MergeShotContext(ctx context.Context, db *sql.DB, prj, src, dst string) error {
+	if src == dst {
+		return errorf(ErrInvalid, "could not merge shot into itself: %s", src)
+	}
+	srcShot, err := GetShotContext(ctx, db, prj, src)
+	if err != nil {
+		return err
+	}
+	if srcShot == nil {
+		return errorf(ErrNotFound, "shot not exist: %s.%s", prj, src)
+	}
+	dstShot, err := GetShotContext(ctx, db, prj, dst)
+	if err != nil {
+		return err
+	}
+	if dstShot == nil {
+		return errorf(ErrNotFound, "shot not exist: %s.%s", prj, dst)
+	}
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("could not begin a transaction: %w", err)
+	}
+	defer tx.Rollback() // 트랜잭션이 완료되지 않았을 때만 실행됨
+	moves, err := mergeShot(ctx, tx, prj, srcShot, dstShot)
+	if err != nil {
+		return err
+	}
+	if err := applyFileMoves(moves); err != nil {
+		return fmt.Errorf("could not move user data: %w", err)
+	}
+	if err := tx.Commit(); err != nil {
+		revertFileMoves(moves)
+		return err
+	}
+	return removeShotUserData(prj, src)
+}
+
+// mergeShot은 트랜잭션 안에서 src 샷을 dst 샷에 합치고, 옮겨야 할 사용자 데이터 파일들을 반환한다.
+func mergeShot(ctx context.Context, tx *sql.Tx, prj string, src, dst *Shot) ([]fileMove, error) {
+	keystr := strings.Join(TaskTableKeys, ", ")
+	stmt := fmt.Sprintf("SELECT %s FROM tasks WHERE project=$1 AND shot=$2", keystr)
+	rows, err := dbQuery(ctx, tx, stmt, prj, src.Shot)
+	if err != nil {
+		return nil, err
+	}
+	tasks := make([]*Task, 0)
+	for rows.Next() {
+		t, err := taskFromRows(rows)
+		if err != nil {
+			rows.Close()
+			return nil, err
+		}
+		tasks = append(tasks, t)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	moves := make([]fileMove, 0)
+	for _, t := range tasks {
+		var dstLast int
+		err := dbQueryRow(ctx, tx, "SELECT last_output_version FROM tasks WHERE project=$1 AND shot=$2 AND task=$3", prj, dst.Shot, t.Task).Scan(&dstLast)
+		if err != nil && err != sql.ErrNoRows {
+			return nil, err
+		}
+		dstHas := err == nil
+		offset := 0
+		if dstHas {
+			if err := dbQueryRow(ctx, tx, "SELECT COALESCE(MAX(version), 0) FROM versions WHERE project=$1 AND shot=$2 AND task=$3", prj, dst.Shot, t.Task).Scan(&offset); err != nil {
+				return nil, err
+			}
+			// 휴지통에 있는 버전의 번호와도 겹치지 않도록 마지막 버전 번호도 고려한다.
+			if dstLast > offset {
+				offset = dstLast
+			}
+		}
+		if err := moveVersionRows(ctx, tx, prj, src.Shot, dst.Shot, t.Task, offset); err != nil {
+			return nil, err
+		}
+		if dstHas {
+			if t.LastOutputVersion != 0 && t.LastOutputVersion+offset > dstLast {
+				if _, err := dbExec(ctx, tx, "UPDATE tasks SET last_output_version=$1 WHERE project=$2 AND shot=$3 AND task=$4", t.LastOutputVersion+offset, prj, dst.Shot, t.Task); err != nil {
+					return nil, fmt.Errorf("could not update 'tasks' table: %w", err)
+				}
+			}
+			// dst 태스크의 외주 배정이 있다면 그것을 유지한다.
+			stmt := `UPDATE vendor_tasks SET shot=$1, returned_version=CASE WHEN returned_version > 0 THEN returned_version+$5 ELSE 0 END
+				WHERE project=$2 AND shot=$3 AND task=$4 AND NOT EXISTS (SELECT 1 FROM vendor_tasks WHERE project=$2 AND shot=$1 AND task=$4)`
+			if _, err := dbExec(ctx, tx, stmt, dst.Shot, prj, src.Shot, t.Task, offset); err != nil {
+				return nil, fmt.Errorf("could not update 'vendor_tasks' table: %w", err)
+			}
+		} else {
+			for _, table := range []string{"tasks", "vendor_tasks"} {
+				stmt := fmt.Sprintf("UPDATE %s SET shot=$1 WHERE project=$2 AND shot=$3 AND task=$4", table)
+				if _, err := dbExec(ctx, tx, stmt, dst.Shot, prj, src.Shot, t.Task); err != nil {
+					return nil, fmt.Errorf("could not update '%s' table: %w", table, err)
+				}
+			}
+		}
+		m, err := versionDataMoves(prj, src.Shot, dst.Shot, t.Task, offset)
+		if err != nil {
+			return nil, err
+		}
+		moves = append(moves, m...)
+	}
+	tags := mergeStrings(dst.Tags, src.Tags)
+	working := mergeStrings(dst.WorkingTasks, src.WorkingTasks)
+	if _, err := dbExec(ctx, tx, "UPDATE shots SET tags=$1, working_tasks=$2 WHERE project=$3 AND shot=$4", pq.Array(tags), pq.Array(working), prj, dst.Shot); err != nil {
+		return nil, fmt.Errorf("could not update 'shots' table: %w", err)
+	}
+	if err := unindexSearchWords(ctx, tx, prj, SearchShot, dst.Shot); err != nil {
+		return nil, err
+	}
+	if err := indexSearchWords(ctx, tx, prj, SearchShot, dst.Shot, shotSearchFields(dst.Shot, dst.Description, dst.CGDescription, tags)); err != nil {
+		return nil, err
+	}
+	if err := addShotAlias(ctx, tx, prj, src.Shot, dst.Shot); err != nil {
+		return nil, err
+	}
+	// 옮겨지지 않고 남은 src의 데이터를 지운다.
+	// src를 가리키던 별칭은 addShotAlias에서 이미 dst를 가리키도록 바뀌었다.
+	if err := deleteShot(ctx, tx, prj, src.Shot); err != nil {
+		return nil, err
+	}
+	return moves, nil
+}
+
+// mergeStrings는 a 뒤에 a에 없는 b의 문자열들을 순서대로 더한 새 슬라이스를 반환한다.
+func mergeStrings(a, b []string) []string {
+	merged := make([]string, 0, len(a)+len(b))
+	has := make(map[string]bool)
+	for _, s := range append(append([]string{}, a...), b...) {
+		if has[s] {
+			continue
+		}
+		has[s] = true
+		merged = append(merged, s)
+	}
+	return merged
+}
@@ -0,0 +1,201 @@
+package roi
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestMovedTarget(t *testing.T) {
+	cases := []struct {
+		id      string
+		offset  int
+		want    string
+		wantErr bool
+	}{
+		{"CG_0010.fx.v001", 0, "CG_0015.fx.v001", false},
+		{"CG_0010.fx.v001.r2", 0, "CG_0015.fx.v001.r2", false},
+		{"CG_0010.fx.v003", 4, "CG_0015.fx.v007", false},
+		{"CG_0010.fx.v003.r1", 4, "CG_0015.fx.v007.r1", false},
+		{"CG_0020.fx.v001", 0, "", true},
+		{"CG_0010.fx", 0, "", true},
+		{"CG_0010.fx.001", 0, "", true},
+	}
+	for _, c := range cases {
+		got, err := movedTarget(c.id, "CG_0010", "CG_0015", c.offset)
+		if c.wantErr {
+			if err == nil {
+				t.Fatalf("movedTarget(%q, %d): want error, got %q", c.id, c.offset, got)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatalf("movedTarget(%q, %d): %v", c.id, c.offset, err)
+		}
+		if got != c.want {
+			t.Fatalf("movedTarget(%q, %d): got %q, want %q", c.id, c.offset, got, c.want)
+		}
+	}
+}
+
+func TestMergeStrings(t *testing.T) {
+	got := mergeStrings([]string{"fx", "comp"}, []string{"mm", "fx", "lit"})
+	want := []string{"fx", "comp", "mm", "lit"}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("got %v, want %v", got, want)
+	}
+}
+
+func TestRenameShot(t *testing.T) {
+	db, err := testDB()
+	if err != nil {
+		t.Fatalf("could not connect to database: %v", err)
+	}
+	dir, err := ioutil.TempDir("", "roi-rename-")
+	if err != nil {
+		t.Fatalf("could not create temp dir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+	userDataDir := UserDataDir
+	UserDataDir = dir
+	defer func() { UserDataDir = userDataDir }()
+
+	prj := testProject.Project
+	err = AddProject(db, testProject)
+	if err != nil {
+		t.Fatalf("could not add project: %v", err)
+	}
+	err = AddShot(db, prj, testShotA)
+	if err != nil {
+		t.Fatalf("could not add shot: %v", err)
+	}
+	err = AddTask(db, prj, testShotA.Shot, testTaskA)
+	if err != nil {
+		t.Fatalf("could not add task: %v", err)
+	}
+	v := &Version{Created: time.Now()}
+	err = AddVersion(db, prj, testShotA.Shot, testTaskA.Task, v)
+	if err != nil {
+		t.Fatalf("could not add version: %v", err)
+	}
+	r := &Review{
+		ProjectID: prj,
+		OutputID:  versionSearchTarget(testShotA.Shot, testTaskA.Task, v.Version),
+		UserID:    "supervisor",
+		Msg:       "불꽃을 더 크게",
+		Time:      time.Now(),
+	}
+	err = AddReview(db, r)
+	if err != nil {
+		t.Fatalf("could not add review: %v", err)
+	}
+	thumb := ThumbnailFile(prj, testShotA.Shot, "small")
+	if err := os.MkdirAll(filepath.Dir(thumb), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(thumb, []byte("png"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	err = RenameShot(db, prj, testShotA.Shot, "CG_0015")
+	if err != nil {
+		t.Fatalf("could not rename shot: %v", err)
+	}
+	exist, err := ShotExist(db, prj, testShotA.Shot)
+	if err != nil {
+		t.Fatalf("could not check shot exist: %v", err)
+	}
+	if exist {
+		t.Fatalf("renamed shot should not exist with old name")
+	}
+	exist, err = VersionExist(db, prj, "CG_0015", testTaskA.Task, v.Version)
+	if err != nil {
+		t.Fatalf("could not check version exist: %v", err)
+	}
+	if !exist {
+		t.Fatalf("version should be moved to renamed shot")
+	}
+	reviews, err := VersionReviews(db, prj, "CG_0015", testTaskA.Task, v.Version)
+	if err != nil {
+		t.Fatalf("could not get reviews: %v", err)
+	}
+	if len(reviews) != 1 || reviews[0].ID != "CG_0015.fx_fire.v001.r1" {
+		t.Fatalf("unexpected reviews of renamed shot: %v", reviews)
+	}
+	if _, err := os.Stat(ThumbnailFile(prj, "CG_0015", "small")); err != nil {
+		t.Fatalf("thumbnail should be moved to renamed shot: %v", err)
+	}
+	cur, err := ResolveShotAlias(db, prj, testShotA.Shot)
+	if err != nil {
+		t.Fatalf("could not resolve shot alias: %v", err)
+	}
+	if cur != "CG_0015" {
+		t.Fatalf("shot alias: got %q, want %q", cur, "CG_0015")
+	}
+
+	// 나누어진 샷은 태스크를 가지지만 버전은 가지지 않는다.
+	err = SplitShot(db, prj, "CG_0015", "CG_0016", nil)
+	if err != nil {
+		t.Fatalf("could not split shot: %v", err)
+	}
+	task, err := GetTask(db, prj, "CG_0016", testTaskA.Task)
+	if err != nil {
+		t.Fatalf("could not get split task: %v", err)
+	}
+	if task == nil || task.Assignee != testTaskA.Assignee || task.LastOutputVersion != 0 {
+		t.Fatalf("unexpected split task: %v", task)
+	}
+	v2 := &Version{Created: time.Now()}
+	err = AddVersion(db, prj, "CG_0016", testTaskA.Task, v2)
+	if err != nil {
+		t.Fatalf("could not add version: %v", err)
+	}
+
+	// 합쳐진 샷의 버전은 합친 샷의 마지막 버전 뒤로 옮겨진다.
+	err = MergeShot(db, prj, "CG_0016", "CG_0015")
+	if err != nil {
+		t.Fatalf("could not merge shot: %v", err)
+	}
+	exist, err = VersionExist(db, prj, "CG_0015", testTaskA.Task, 2)
+	if err != nil {
+		t.Fatalf("could not check version exist: %v", err)
+	}
+	if !exist {
+		t.Fatalf("merged version should be renumbered after last version")
+	}
+	cur, err = ResolveShotAlias(db, prj, "CG_0016")
+	if err != nil {
+		t.Fatalf("could not resolve shot alias: %v", err)
+	}
+	if cur != "CG_0015" {
+		t.Fatalf("shot alias: got %q, want %q", cur, "CG_0015")
+	}
+
+	// 다시 예전 이름으로 바꾸면 그 이름의 별칭은 지워진다.
+	err = RenameShot(db, prj, "CG_0015", testShotA.Shot)
+	if err != nil {
+		t.Fatalf("could not rename shot: %v", err)
+	}
+	cur, err = ResolveShotAlias(db, prj, testShotA.Shot)
+	if err != nil {
+		t.Fatalf("could not resolve shot alias: %v", err)
+	}
+	if cur != "" {
+		t.Fatalf("existing shot name should not be an alias: %q", cur)
+	}
+	aliases, err := ShotAliases(db, prj, testShotA.Shot)
+	if err != nil {
+		t.Fatalf("could not get shot aliases: %v", err)
+	}
+	if len(aliases) != 2 {
+		t.Fatalf("shot aliases: got %d, want 2", len(aliases))
+	}
+
+	err = DeleteProject(db, prj)
+	if err != nil {
+		t.Fatalf("could not delete project: %v", err)
+	}
+}
@@ -126,3 +126,15 @@ func TestShot(t *testing.T) {
 		t.Fatalf("could not delete project: %s", err)
 	}
 }
+
+func TestTaskDueRange(t *testing.T) {
+	now := time.Date(2020, 10, 19, 15, 30, 0, 0, time.UTC)
+	from, to := taskDueRange(7, now)
+	if !from.Equal(time.Date(2020, 10, 19, 0, 0, 0, 0, time.UTC)) || !to.Equal(time.Date(2020, 10, 26, 0, 0, 0, 0, time.UTC)) {
+		t.Fatalf("invalid task due range: %v - %v", from, to)
+	}
+	from, to = taskDueRange(0, now)
+	if !from.IsZero() || !to.IsZero() {
+		t.Fatalf("task due range should be empty when days is 0: %v - %v", from, to)
+	}
+}
@@ -1,6 +1,7 @@
 package roi
 
 import (
+	"context"
 	"database/sql"
 	"fmt"
 	"strings"
@@ -80,6 +81,15 @@ type Task struct {
 	DueDate           time.Time
 }
 
+// validate는 태스크의 필드들이 적절한지 검사한다.
+func (t *Task) validate() error {
+	v := &validator{}
+	v.check(IsValidTask(t.Task), "task", "invalid task name: '%s'", t.Task)
+	v.check(isValidTaskStatus(t.Status), "status", "invalid task status: '%s'", t.Status)
+	v.check(t.Assignee == "" || IsValidUser(t.Assignee), "assignee", "invalid assignee: '%s'", t.Assignee)
+	return v.err()
+}
+
 func (t *Task) dbValues() []interface{} {
 	if t == nil {
 		t = &Task{}
@@ -127,28 +137,38 @@ var TaskTableIndices = dbIndices(TaskTableKeys)
 
 // AddTask는 db의 특정 프로젝트, 특정 샷에 태스크를 추가한다.
 func AddTask(db *sql.DB, prj, shot string, t *Task) error {
+	return AddTaskContext(context.Background(), db, prj, shot, t)
+}
+
+// AddTaskContext는 ctx를 받는 AddTask이다.
+func AddTaskContext(ctx context.Context, db *sql.DB, prj, shot string, t *Task) error {
 	if prj == "" {
-		return fmt.Errorf("project not specified")
+		return errorf(ErrInvalid, "project not specified")
 	}
 	if shot == "" {
-		return fmt.Errorf("shot not specified")
+		return errorf(ErrInvalid, "shot not specified")
 	}
 	if t == nil {
-		return fmt.Errorf("nil task")
+		return errorf(ErrInvalid, "nil task")
 	}
-	if t.Task == "" {
-		return fmt.Errorf("task name not specified")
+	if err := t.validate(); err != nil {
+		return err
 	}
-	if !isValidTaskStatus(t.Status) {
-		return fmt.Errorf("invalid task status: '%s'", t.Status)
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("could not begin a transaction: %w", err)
 	}
+	defer tx.Rollback() // 트랜잭션이 완료되지 않았을 때만 실행됨
 	keystr := strings.Join(TaskTableKeys, ", ")
 	idxstr := strings.Join(TaskTableIndices, ", ")
 	stmt := fmt.Sprintf("INSERT INTO tasks (%s) VALUES (%s)", keystr, idxstr)
-	if _, err := db.Exec(stmt, t.dbValues()...); err != nil {
+	if _, err := dbExec(ctx, tx, stmt, t.dbValues()...); err != nil {
 		return err
 	}
-	return nil
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+	return createPathDirs(ctx, db, PathTokens{Project: prj, Shot: shot, Task: t.Task})
 }
 
 // UpdateTaskParam은 Task에서 일반적으로 업데이트 되어야 하는 멤버의 모음이다.
@@ -159,6 +179,14 @@ type UpdateTaskParam struct {
 	DueDate  time.Time
 }
 
+// validate는 업데이트할 필드들이 적절한지 검사한다.
+func (u UpdateTaskParam) validate() error {
+	v := &validator{}
+	v.check(isValidTaskStatus(u.Status), "status", "invalid task status: '%s'", u.Status)
+	v.check(u.Assignee == "" || IsValidUser(u.Assignee), "assignee", "invalid assignee: '%s'", u.Assignee)
+	return v.err()
+}
+
 func (u UpdateTaskParam) keys() []string {
 	return []string{
 		"status",
@@ -167,10 +195,6 @@ func (u UpdateTaskParam) keys() []string {
 	}
 }
 
-func (u UpdateTaskParam) indices() []string {
-	return dbIndices(u.keys())
-}
-
 func (u UpdateTaskParam) values() []interface{} {
 	return []interface{}{
 		u.Status,
@@ -181,22 +205,39 @@ func (u UpdateTaskParam) values() []interface{} {
 
 // UpdateTask는 db의 특정 태스크를 업데이트 한다.
 func UpdateTask(db *sql.DB, prj, shot, task string, upd UpdateTaskParam) error {
+	return UpdateTaskContext(context.Background(), db, prj, shot, task, upd)
+}
+
+// UpdateTaskContext는 ctx를 받는 UpdateTask이다.
+func UpdateTaskContext(ctx context.Context, db *sql.DB, prj, shot, task string, upd UpdateTaskParam) error {
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("could not begin a transaction: %w", err)
+	}
+	defer tx.Rollback() // 트랜잭션이 완료되지 않았을 때만 실행됨
+	if err := updateTask(ctx, tx, prj, shot, task, upd); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// updateTask는 트랜잭션 안에서 특정 태스크를 업데이트 한다.
+// 리뷰 세션 발행처럼 여러 태스크를 한번에 업데이트 할 때 사용한다.
+func updateTask(ctx context.Context, tx *sql.Tx, prj, shot, task string, upd UpdateTaskParam) error {
 	if prj == "" {
-		return fmt.Errorf("project not specified")
+		return errorf(ErrInvalid, "project not specified")
 	}
 	if shot == "" {
-		return fmt.Errorf("shot not specified")
+		return errorf(ErrInvalid, "shot not specified")
 	}
 	if task == "" {
-		return fmt.Errorf("task name not specified")
+		return errorf(ErrInvalid, "task name not specified")
 	}
-	if !isValidTaskStatus(upd.Status) {
-		return fmt.Errorf("invalid task status: '%s'", upd.Status)
+	if err := upd.validate(); err != nil {
+		return err
 	}
-	keystr := strings.Join(upd.keys(), ", ")
-	idxstr := strings.Join(upd.indices(), ", ")
-	stmt := fmt.Sprintf("UPDATE tasks SET (%s) = (%s) WHERE project='%s' AND shot='%s' AND task='%s'", keystr, idxstr, prj, shot, task)
-	if _, err := db.Exec(stmt, upd.values()...); err != nil {
+	q := updateQuery("tasks", upd.keys(), upd.values()).where("project", prj).where("shot", shot).where("task", task)
+	if _, err := q.exec(ctx, tx); err != nil {
 		return err
 	}
 	return nil
@@ -204,11 +245,17 @@ func UpdateTask(db *sql.DB, prj, shot, task string, upd UpdateTaskParam) error {
 
 // TaskExist는 db에 해당 태스크가 존재하는지를 검사한다.
 func TaskExist(db *sql.DB, prj, shot, task string) (bool, error) {
+	return TaskExistContext(context.Background(), db, prj, shot, task)
+}
+
+// TaskExistContext는 ctx를 받는 TaskExist이다.
+func TaskExistContext(ctx context.Context, db *sql.DB, prj, shot, task string) (bool, error) {
 	stmt := "SELECT task FROM tasks WHERE project=$1 AND shot=$2 AND task=$3 LIMIT 1"
-	rows, err := db.Query(stmt, prj, shot, task)
+	rows, err := dbQuery(ctx, db, stmt, prj, shot, task)
 	if err != nil {
 		return false, err
 	}
+	defer rows.Close()
 	return rows.Next(), nil
 }
 
@@ -229,12 +276,18 @@ func taskFromRows(rows *sql.Rows) (*Task, error) {
 // GetTask는 db의 특정 프로젝트에서 해당 태스크를 찾는다.
 // 만일 그 이름의 태스크가 없다면 nil이 반환된다.
 func GetTask(db *sql.DB, prj, shot, task string) (*Task, error) {
+	return GetTaskContext(context.Background(), db, prj, shot, task)
+}
+
+// GetTaskContext는 ctx를 받는 GetTask이다.
+func GetTaskContext(ctx context.Context, db *sql.DB, prj, shot, task string) (*Task, error) {
 	keystr := strings.Join(TaskTableKeys, ", ")
 	stmt := fmt.Sprintf("SELECT %s FROM tasks WHERE project=$1 AND shot=$2 AND task=$3 LIMIT 1", keystr)
-	rows, err := db.Query(stmt, prj, shot, task)
+	rows, err := dbQuery(ctx, db, stmt, prj, shot, task)
 	if err != nil {
 		return nil, err
 	}
+	defer rows.Close()
 	ok := rows.Next()
 	if !ok {
 		return nil, nil
@@ -244,12 +297,18 @@ func GetTask(db *sql.DB, prj, shot, task string) (*Task, error) {
 
 // ShotTasks는 db의 특정 프로젝트 특정 샷의 태스크 전체를 반환한다.
 func ShotTasks(db *sql.DB, prj, shot string) ([]*Task, error) {
+	return ShotTasksContext(context.Background(), db, prj, shot)
+}
+
+// ShotTasksContext는 ctx를 받는 ShotTasks이다.
+func ShotTasksContext(ctx context.Context, db *sql.DB, prj, shot string) ([]*Task, error) {
 	keystr := strings.Join(TaskTableKeys, ", ")
 	stmt := fmt.Sprintf("SELECT %s FROM tasks WHERE project=$1 AND shot=$2", keystr)
-	rows, err := db.Query(stmt, prj, shot)
+	rows, err := dbQuery(ctx, db, stmt, prj, shot)
 	if err != nil {
 		return nil, err
 	}
+	defer rows.Close()
 	tasks := make([]*Task, 0)
 	for rows.Next() {
 		t, err := taskFromRows(rows)
@@ -263,6 +322,11 @@ func ShotTasks(db *sql.DB, prj, shot string) ([]*Task, error) {
 
 // UserTasks는 해당 유저의 모든 태스크를 db에서 검색해 반환한다.
 func UserTasks(db *sql.DB, user string) ([]*Task, error) {
+	return UserTasksContext(context.Background(), db, user)
+}
+
+// UserTasksContext는 ctx를 받는 UserTasks이다.
+func UserTasksContext(ctx context.Context, db *sql.DB, user string) ([]*Task, error) {
 	// 샷의 working_tasks에 속하지 않은 태스크는 보이지 않는다.
 	keystr := ""
 	for i, k := range TaskTableKeys {
@@ -271,11 +335,12 @@ func UserTasks(db *sql.DB, user string) ([]*Task, error) {
 		}
 		keystr += "tasks." + k
 	}
-	stmt := fmt.Sprintf("SELECT %s FROM tasks JOIN shots ON (tasks.project = shots.project AND tasks.shot = shots.shot)  WHERE tasks.assignee='%s' AND tasks.task = ANY(shots.working_tasks)", keystr, user)
-	rows, err := db.Query(stmt)
+	stmt := fmt.Sprintf("SELECT %s FROM tasks JOIN shots ON (tasks.project = shots.project AND tasks.shot = shots.shot)  WHERE tasks.assignee=$1 AND tasks.task = ANY(shots.working_tasks)", keystr)
+	rows, err := dbQuery(ctx, db, stmt, user)
 	if err != nil {
 		return nil, err
 	}
+	defer rows.Close()
 	tasks := make([]*Task, 0)
 	for rows.Next() {
 		t, err := taskFromRows(rows)
@@ -290,17 +355,47 @@ func UserTasks(db *sql.DB, user string) ([]*Task, error) {
 // DeleteTask는 해당 태스크와 그 하위의 모든 데이터를 db에서 지운다.
 // 해당 태스크가 없어도 에러를 내지 않기 때문에 검사를 원한다면 TaskExist를 사용해야 한다.
 // 만일 처리 중간에 에러가 나면 아무 데이터도 지우지 않고 에러를 반환한다.
+//
+// 사용자가 지우는 태스크는 휴지통에서 되살릴 수 있도록 TrashTask로 지워야 한다.
 func DeleteTask(db *sql.DB, prj, shot, task string) error {
-	tx, err := db.Begin()
+	return DeleteTaskContext(context.Background(), db, prj, shot, task)
+}
+
+// DeleteTaskContext는 ctx를 받는 DeleteTask이다.
+func DeleteTaskContext(ctx context.Context, db *sql.DB, prj, shot, task string) error {
+	tx, err := db.BeginTx(ctx, nil)
 	if err != nil {
-		return fmt.Errorf("could not begin a transaction: %v", err)
+		return fmt.Errorf("could not begin a transaction: %w", err)
 	}
 	defer tx.Rollback() // 트랜잭션이 완료되지 않았을 때만 실행됨
-	if _, err := tx.Exec("DELETE FROM tasks WHERE project=$1 AND shot=$2 AND task=$3", prj, shot, task); err != nil {
-		return fmt.Errorf("could not delete data from 'tasks' table: %v", err)
-	}
-	if _, err := tx.Exec("DELETE FROM versions WHERE project=$1 AND shot=$2 AND task=$3", prj, shot, task); err != nil {
-		return fmt.Errorf("could not delete data from 'versions' table: %v", err)
+	if err := deleteTask(ctx, tx, prj, shot, task); err != nil {
+		return err
 	}
 	return tx.Commit()
 }
+
+// deleteTask는 트랜잭션 안에서 해당 태스크와 그 하위의 모든 데이터를 지운다.
+func deleteTask(ctx context.Context, tx *sql.Tx, prj, shot, task string) error {
+	if _, err := dbExec(ctx, tx, "DELETE FROM tasks WHERE project=$1 AND shot=$2 AND task=$3", prj, shot, task); err != nil {
+		return fmt.Errorf("could not delete data from 'tasks' table: %w", err)
+	}
+	if _, err := dbExec(ctx, tx, "DELETE FROM version_files WHERE project=$1 AND shot=$2 AND task=$3", prj, shot, task); err != nil {
+		return fmt.Errorf("could not delete data from 'version_files' table: %w", err)
+	}
+	if _, err := dbExec(ctx, tx, "DELETE FROM vendor_tasks WHERE project=$1 AND shot=$2 AND task=$3", prj, shot, task); err != nil {
+		return fmt.Errorf("could not delete data from 'vendor_tasks' table: %w", err)
+	}
+	if _, err := dbExec(ctx, tx, "DELETE FROM versions WHERE project=$1 AND shot=$2 AND task=$3", prj, shot, task); err != nil {
+		return fmt.Errorf("could not delete data from 'versions' table: %w", err)
+	}
+	if err := unindexSearchWordsWithPrefix(ctx, tx, prj, SearchVersion, shot+"."+task+"."); err != nil {
+		return err
+	}
+	if err := unindexSearchWordsWithPrefix(ctx, tx, prj, SearchReview, shot+"."+task+"."); err != nil {
+		return err
+	}
+	if err := deleteReviewsWithPrefix(ctx, tx, prj, shot+"."+task+"."); err != nil {
+		return err
+	}
+	return nil
+}
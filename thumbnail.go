@@ -3,50 +3,331 @@ package roi
 import (
 	"fmt"
 	"image"
+	"image/color"
+	"image/draw"
+	_ "image/gif"
+	_ "image/jpeg"
 	"image/png"
+	"io/ioutil"
 	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
 )
 
+// UserDataDir은 로이가 썸네일 등 사용자 데이터를 파일로 저장하는 디렉토리이다.
+var UserDataDir = "roi-userdata"
+
+// ThumbnailSize는 썸네일 하나의 크기 정보이다.
+type ThumbnailSize struct {
+	// Name은 썸네일 크기의 이름이며, 썸네일 파일 이름으로도 쓰인다.
+	Name   string
+	Width  int
+	Height int
+	// Crop이 true이면 원본 이미지의 가운데를 Width:Height 비율로 잘라 정확히 그 크기로 만든다.
+	// false이면 원본 비율을 유지하며 Width, Height 안에 들어가도록 줄인다.
+	Crop bool
+}
+
+var (
+	// ThumbnailGrid는 검색 페이지의 샷 목록에서 사용하는 크기이다.
+	ThumbnailGrid = ThumbnailSize{Name: "grid", Width: 288, Height: 162, Crop: true}
+	// ThumbnailCard는 카드나 샷 페이지처럼 조금 더 크게 보일 때 사용하는 크기이다.
+	ThumbnailCard = ThumbnailSize{Name: "card", Width: 640, Height: 360, Crop: true}
+	// ThumbnailFull은 원본 비율을 그대로 유지하는 큰 썸네일이다.
+	ThumbnailFull = ThumbnailSize{Name: "full", Width: 1920, Height: 1080, Crop: false}
+)
+
+// ThumbnailSizes는 썸네일을 등록할 때 생성되는 모든 크기이다.
+var ThumbnailSizes = []ThumbnailSize{
+	ThumbnailGrid,
+	ThumbnailCard,
+	ThumbnailFull,
+}
+
+// maxThumbnailPixels는 썸네일 원본으로 받아들이는 이미지의 최대 픽셀 수이다.
+// 지나치게 큰 이미지로 인해 서버의 메모리가 부족해지는 것을 막는다.
+// 원본은 읽을 때와 줄일 때 각각 RGBA로 메모리에 올라가므로, 한 장에 최대 320MB 정도를 쓴다.
+// 8K(7680x4320) 이미지도 받을 수 있는 크기이다.
+const maxThumbnailPixels = 40 * 1000 * 1000
+
+// ThumbnailConverters는 go에서 직접 읽을 수 없는 이미지(tiff, exr 등)를
+// png로 변환하기 위해 차례로 시도하는 외부 명령이다.
+// {src}, {dst}는 각각 원본 파일과 변환될 png 파일 경로로 바뀐다.
+var ThumbnailConverters = [][]string{
+	{"oiiotool", "{src}", "--ch", "R,G,B", "-o", "{dst}"},
+	{"convert", "{src}[0]", "-flatten", "{dst}"},
+}
+
+// thumbnailDir은 특정 샷의 썸네일이 저장되는 디렉토리이다.
+func thumbnailDir(prj, shot string) string {
+	return filepath.Join(UserDataDir, "thumbnail", prj, shot)
+}
+
+// ThumbnailFile은 특정 샷의 해당 크기 썸네일 파일 경로를 반환한다.
+// 파일이 실제로 존재하는지는 검사하지 않는다.
+func ThumbnailFile(prj, shot, size string) string {
+	return filepath.Join(thumbnailDir(prj, shot), size+".png")
+}
+
+// legacyThumbnailFile은 여러 크기의 썸네일을 지원하기 전에 쓰이던 썸네일 파일 경로이다.
+func legacyThumbnailFile(prj, shot string) string {
+	return filepath.Join(UserDataDir, "thumbnail", prj, shot+".png")
+}
+
+// ShotThumbnailSizes는 특정 샷에 존재하는 썸네일 크기의 이름을 ThumbnailSizes 순서로 반환한다.
+func ShotThumbnailSizes(prj, shot string) ([]string, error) {
+	sizes := make([]string, 0, len(ThumbnailSizes))
+	for _, sz := range ThumbnailSizes {
+		_, err := os.Stat(ThumbnailFile(prj, shot, sz.Name))
+		if err != nil {
+			if os.IsNotExist(err) {
+				continue
+			}
+			return nil, err
+		}
+		sizes = append(sizes, sz.Name)
+	}
+	return sizes, nil
+}
+
+// ThumbnailURLPath는 특정 샷의 해당 크기 썸네일을 /thumbnail/ 아래에서 찾을 수 있는 경로를 반환한다.
+// 그 크기의 썸네일이 없다면 다른 크기의 썸네일을, 그것도 없다면 예전 방식의 썸네일을 찾는다.
+// 샷에 썸네일이 전혀 없다면 빈 문자열을 반환한다.
+func ThumbnailURLPath(prj, shot, size string) string {
+	sizes, err := ShotThumbnailSizes(prj, shot)
+	if err == nil && len(sizes) != 0 {
+		pick := sizes[len(sizes)-1]
+		for _, s := range sizes {
+			if s == size {
+				pick = s
+				break
+			}
+		}
+		return prj + "/" + shot + "/" + pick + ".png"
+	}
+	if _, err := os.Stat(legacyThumbnailFile(prj, shot)); err == nil {
+		return prj + "/" + shot + ".png"
+	}
+	return ""
+}
+
 // AddThumbnail은 특정 샷의 썸네일을 등록한다.
-// 썸네일은 roi안에 파일로 저장된다.
+// 썸네일은 ThumbnailSizes의 모든 크기의 png 파일로 roi안에 저장되며,
+// 기존에 등록된 썸네일은 덮어쓴다.
+//
+// jpeg, png, gif는 직접 읽고, 그 외의 형식(tiff, exr 등)은 ThumbnailConverters를
+// 이용해 png로 변환한 후 읽는다.
 func AddThumbnail(prj, shot, thumbf string) error {
 	// wrap은 AddThumbnail에서 에러가 났을 때 에러 내용에 기본적인 정보를 추가한다.
 	wrap := func(err error) error {
-		return fmt.Errorf("AddThumbnail: %s", err)
+		return fmt.Errorf("AddThumbnail: %w", err)
 	}
-
-	fi, err := os.Stat(thumbf)
-	if err != nil {
-		return wrap(err)
+	if !IsValidProject(prj) {
+		return wrap(errorf(ErrInvalid, "invalid project id: %s", prj))
 	}
-	maxKB := int64(200)
-	if fi.Size() > (maxKB << 10) {
-		return wrap(fmt.Errorf("file size is bigger than %dKB: %s", maxKB, thumbf))
+	if !IsValidShot(shot) {
+		return wrap(errorf(ErrInvalid, "invalid shot id: %s", shot))
 	}
-	from, err := os.Open(thumbf)
-	if err != nil {
-		return wrap(err)
-	}
-	defer from.Close()
-	// thumbf가 지원하는 이미지 파일이 맞는지 확인한다.
-	img, _, err := image.Decode(from)
+	img, err := decodeThumbnailSource(thumbf)
 	if err != nil {
 		return wrap(err)
 	}
 	// 이미지를 png 이미지로 변경한다.
 	// 파일을 부를때 일일이 파일 확장자를 검사하지 않기 위함이다.
-	if err := os.MkdirAll(fmt.Sprintf("roi-userdata/thumbnail/%s", prj), 0755); err != nil {
-		if !os.IsExist(err) {
+	if err := os.MkdirAll(thumbnailDir(prj, shot), 0755); err != nil {
+		return wrap(err)
+	}
+	for _, sz := range ThumbnailSizes {
+		if err := writePNG(ThumbnailFile(prj, shot, sz.Name), fitImage(img, sz)); err != nil {
 			return wrap(err)
 		}
 	}
-	to, err := os.Create(fmt.Sprintf("roi-userdata/thumbnail/%s/%s.png", prj, shot))
-	if err != nil {
+	// 예전 방식의 썸네일이 새 썸네일 대신 보이지 않도록 지운다.
+	if err := os.Remove(legacyThumbnailFile(prj, shot)); err != nil && !os.IsNotExist(err) {
 		return wrap(err)
 	}
-	defer to.Close()
-	if err := png.Encode(to, img); err != nil {
-		return wrap(err)
+	return nil
+}
+
+// DeleteThumbnail은 특정 샷의 모든 크기의 썸네일을 지운다.
+// 썸네일이 없어도 에러를 내지 않는다.
+func DeleteThumbnail(prj, shot string) error {
+	if err := os.RemoveAll(thumbnailDir(prj, shot)); err != nil {
+		return err
+	}
+	if err := os.Remove(legacyThumbnailFile(prj, shot)); err != nil && !os.IsNotExist(err) {
+		return err
 	}
 	return nil
 }
+
+// decodeThumbnailSource는 썸네일 원본 파일을 읽어 이미지로 반환한다.
+func decodeThumbnailSource(f string) (image.Image, error) {
+	switch strings.ToLower(filepath.Ext(f)) {
+	case ".jpg", ".jpeg", ".png", ".gif":
+		return decodeImageFile(f)
+	}
+	tmpd, err := ioutil.TempDir("", "roi-thumbnail-")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(tmpd)
+	pngf := filepath.Join(tmpd, "thumbnail.png")
+	if err := convertToPNG(f, pngf); err != nil {
+		return nil, err
+	}
+	return decodeImageFile(pngf)
+}
+
+// decodeImageFile은 go에서 지원하는 형식의 이미지 파일을 읽는다.
+// 이미지가 maxThumbnailPixels보다 크다면 헤더만 읽은 뒤 이미지 전체를 읽지 않고 에러를 반환한다.
+func decodeImageFile(f string) (image.Image, error) {
+	fd, err := os.Open(f)
+	if err != nil {
+		return nil, err
+	}
+	defer fd.Close()
+	cfg, _, err := image.DecodeConfig(fd)
+	if err != nil {
+		return nil, err
+	}
+	if int64(cfg.Width)*int64(cfg.Height) > maxThumbnailPixels {
+		return nil, errorf(ErrInvalid, "image is too big: %dx%d", cfg.Width, cfg.Height)
+	}
+	if _, err := fd.Seek(0, 0); err != nil {
+		return nil, err
+	}
+	img, _, err := image.Decode(fd)
+	if err != nil {
+		return nil, err
+	}
+	return img, nil
+}
+
+// convertToPNG는 ThumbnailConverters를 차례로 시도해 src 이미지를 dst png 파일로 변환한다.
+func convertToPNG(src, dst string) error {
+	tried := make([]string, 0)
+	for _, c := range ThumbnailConverters {
+		if _, err := exec.LookPath(c[0]); err != nil {
+			continue
+		}
+		args := make([]string, len(c)-1)
+		for i, a := range c[1:] {
+			a = strings.Replace(a, "{src}", src, -1)
+			a = strings.Replace(a, "{dst}", dst, -1)
+			args[i] = a
+		}
+		out, err := exec.Command(c[0], args...).CombinedOutput()
+		if err == nil {
+			return nil
+		}
+		tried = append(tried, fmt.Sprintf("%s: %v: %s", c[0], err, strings.TrimSpace(string(out))))
+	}
+	if len(tried) == 0 {
+		return errorf(ErrInvalid, "unsupported image format and no converter found: %s", src)
+	}
+	return fmt.Errorf("could not convert %s: %s", src, strings.Join(tried, "; "))
+}
+
+// writePNG는 이미지를 png 파일로 저장한다.
+// 저장 중 에러가 나도 기존 파일이 깨지지 않도록 임시 파일에 저장한 후 옮긴다.
+func writePNG(f string, img image.Image) error {
+	tmp := f + ".tmp"
+	to, err := os.Create(tmp)
+	if err != nil {
+		return err
+	}
+	if err := png.Encode(to, img); err != nil {
+		to.Close()
+		os.Remove(tmp)
+		return err
+	}
+	if err := to.Close(); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	return os.Rename(tmp, f)
+}
+
+// fitImage는 이미지를 썸네일 크기에 맞춘다. ThumbnailSize.Crop 참고.
+// 이미지가 이미 그 크기보다 작다면 크기를 키우지 않는다.
+func fitImage(img image.Image, sz ThumbnailSize) image.Image {
+	b := img.Bounds()
+	w, h := b.Dx(), b.Dy()
+	if w == 0 || h == 0 {
+		return img
+	}
+	if sz.Crop {
+		// 원본에서 썸네일 비율과 같은 가운데 영역을 고른다.
+		cw, ch := w, w*sz.Height/sz.Width
+		if ch > h {
+			cw, ch = h*sz.Width/sz.Height, h
+		}
+		if cw < 1 {
+			cw = 1
+		}
+		if ch < 1 {
+			ch = 1
+		}
+		x := b.Min.X + (w-cw)/2
+		y := b.Min.Y + (h-ch)/2
+		crop := image.Rect(x, y, x+cw, y+ch)
+		tw, th := sz.Width, sz.Height
+		if cw < tw {
+			tw, th = cw, ch
+		}
+		return resizeImage(img, crop, tw, th)
+	}
+	tw, th := w, h
+	if tw > sz.Width {
+		tw, th = sz.Width, h*sz.Width/w
+	}
+	if th > sz.Height {
+		tw, th = tw*sz.Height/th, sz.Height
+	}
+	if tw < 1 {
+		tw = 1
+	}
+	if th < 1 {
+		th = 1
+	}
+	return resizeImage(img, b, tw, th)
+}
+
+// resizeImage는 이미지의 r 영역을 w x h 크기로 바꾼다.
+// 줄일 때는 대상 픽셀이 덮는 원본 픽셀들의 평균을 사용해 계단 현상을 줄인다.
+func resizeImage(img image.Image, r image.Rectangle, w, h int) *image.RGBA {
+	src := image.NewRGBA(image.Rect(0, 0, r.Dx(), r.Dy()))
+	draw.Draw(src, src.Bounds(), img, r.Min, draw.Src)
+	dst := image.NewRGBA(image.Rect(0, 0, w, h))
+	sw, sh := r.Dx(), r.Dy()
+	for y := 0; y < h; y++ {
+		y0 := y * sh / h
+		y1 := (y + 1) * sh / h
+		if y1 <= y0 {
+			y1 = y0 + 1
+		}
+		for x := 0; x < w; x++ {
+			x0 := x * sw / w
+			x1 := (x + 1) * sw / w
+			if x1 <= x0 {
+				x1 = x0 + 1
+			}
+			var rs, gs, bs, as, n uint32
+			for sy := y0; sy < y1; sy++ {
+				i := src.PixOffset(x0, sy)
+				for sx := x0; sx < x1; sx++ {
+					rs += uint32(src.Pix[i])
+					gs += uint32(src.Pix[i+1])
+					bs += uint32(src.Pix[i+2])
+					as += uint32(src.Pix[i+3])
+					n++
+					i += 4
+				}
+			}
+			dst.SetRGBA(x, y, color.RGBA{uint8(rs / n), uint8(gs / n), uint8(bs / n), uint8(as / n)})
+		}
+	}
+	return dst
+}
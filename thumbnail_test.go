@@ -0,0 +1,120 @@
+package roi
+
+import (
+	"bytes"
+	"encoding/binary"
+	"hash/crc32"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestFitImage(t *testing.T) {
+	cases := []struct {
+		w, h int
+		sz   ThumbnailSize
+		want image.Point
+	}{
+		{w: 4096, h: 2160, sz: ThumbnailGrid, want: image.Pt(288, 162)},
+		{w: 1000, h: 1000, sz: ThumbnailCard, want: image.Pt(640, 360)},
+		{w: 100, h: 100, sz: ThumbnailGrid, want: image.Pt(100, 56)},
+		{w: 4096, h: 2160, sz: ThumbnailFull, want: image.Pt(1920, 1012)},
+		{w: 1000, h: 3000, sz: ThumbnailFull, want: image.Pt(360, 1080)},
+		{w: 800, h: 600, sz: ThumbnailFull, want: image.Pt(800, 600)},
+	}
+	for _, c := range cases {
+		img := image.NewRGBA(image.Rect(0, 0, c.w, c.h))
+		got := fitImage(img, c.sz).Bounds().Size()
+		if got != c.want {
+			t.Fatalf("fitImage(%dx%d, %s): got %v, want %v", c.w, c.h, c.sz.Name, got, c.want)
+		}
+	}
+}
+
+func TestAddThumbnail(t *testing.T) {
+	tmpd, err := ioutil.TempDir("", "roi-thumbnail-test-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmpd)
+	orgDir := UserDataDir
+	UserDataDir = filepath.Join(tmpd, "roi-userdata")
+	defer func() { UserDataDir = orgDir }()
+
+	src := filepath.Join(tmpd, "src.jpg")
+	img := image.NewRGBA(image.Rect(0, 0, 2048, 858))
+	for i := range img.Pix {
+		img.Pix[i] = 128
+	}
+	img.Set(0, 0, color.White)
+	f, err := os.Create(src)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := jpeg.Encode(f, img, nil); err != nil {
+		t.Fatal(err)
+	}
+	f.Close()
+
+	if ThumbnailURLPath("TEST", "CG_0010", "grid") != "" {
+		t.Fatalf("thumbnail should not exist yet")
+	}
+	err = AddThumbnail("TEST", "CG_0010", src)
+	if err != nil {
+		t.Fatalf("could not add thumbnail: %v", err)
+	}
+	sizes, err := ShotThumbnailSizes("TEST", "CG_0010")
+	if err != nil {
+		t.Fatalf("could not get thumbnail sizes: %v", err)
+	}
+	want := []string{"grid", "card", "full"}
+	if !reflect.DeepEqual(sizes, want) {
+		t.Fatalf("got %v, want %v", sizes, want)
+	}
+	if got := ThumbnailURLPath("TEST", "CG_0010", "card"); got != "TEST/CG_0010/card.png" {
+		t.Fatalf("unexpected thumbnail url path: %s", got)
+	}
+	err = AddThumbnail("TEST", "../CG_0010", src)
+	if err == nil {
+		t.Fatalf("should not add thumbnail with invalid shot id")
+	}
+	err = DeleteThumbnail("TEST", "CG_0010")
+	if err != nil {
+		t.Fatalf("could not delete thumbnail: %v", err)
+	}
+	if ThumbnailURLPath("TEST", "CG_0010", "grid") != "" {
+		t.Fatalf("thumbnail exist after delete")
+	}
+}
+
+func TestDecodeImageFileTooBig(t *testing.T) {
+	tmpd, err := ioutil.TempDir("", "roi-thumbnail-test-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmpd)
+	// 이미지 데이터 없이 크기만 큰 png 헤더를 만든다.
+	// 전체를 읽으려 했다면 크기 에러가 아닌 다른 에러가 난다.
+	ihdr := make([]byte, 17)
+	copy(ihdr, "IHDR")
+	binary.BigEndian.PutUint32(ihdr[4:], 10000)
+	binary.BigEndian.PutUint32(ihdr[8:], 10000)
+	ihdr[12] = 8 // 비트 깊이
+	ihdr[13] = 6 // RGBA
+	b := &bytes.Buffer{}
+	b.WriteString("\x89PNG\r\n\x1a\n")
+	binary.Write(b, binary.BigEndian, uint32(len(ihdr)-4))
+	b.Write(ihdr)
+	binary.Write(b, binary.BigEndian, crc32.ChecksumIEEE(ihdr))
+	f := filepath.Join(tmpd, "big.png")
+	if err := ioutil.WriteFile(f, b.Bytes(), 0644); err != nil {
+		t.Fatal(err)
+	}
+	_, err = decodeImageFile(f)
+	checkErrorKind(t, err, ErrInvalid)
+}
@@ -0,0 +1,480 @@
+package roi
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// 사용자가 지운 샷, 태스크, 버전은 바로 사라지지 않고 휴지통으로 옮겨진다.
+// 휴지통으로 옮길 때는 해당 항목과 그 하위의 모든 열을 trash 테이블에 기록한 뒤
+// 원래 테이블에서 지우기 때문에, 모든 조회와 검색에서 따로 처리하지 않아도 지워진 항목이 보이지 않는다.
+// 휴지통의 항목은 RestoreTrash로 되살리거나 PurgeTrash로 완전히 지울 수 있다.
+//
+// 버전 번호는 태스크의 last_output_version으로 예약된다. 버전을 휴지통으로 옮겨도
+// 이 값은 줄지 않으므로, 그 뒤에 추가된 버전은 휴지통의 버전과 다른 번호를 받는다.
+// 되살린 버전이 이 값보다 크다면 되살릴 때 이 값을 올려 이후에도 번호가 겹치지 않게 한다.
+
+// TrashKind는 휴지통에 들어간 항목의 종류이다.
+type TrashKind string
+
+const (
+	TrashedShot    = TrashKind("shot")
+	TrashedTask    = TrashKind("task")
+	TrashedVersion = TrashKind("version")
+)
+
+// UIString은 UI안에서 사용하는 현지화된 문자열이다.
+func (k TrashKind) UIString() string {
+	switch k {
+	case TrashedShot:
+		return "샷"
+	case TrashedTask:
+		return "태스크"
+	case TrashedVersion:
+		return "버전"
+	}
+	return ""
+}
+
+var CreateTableIfNotExistsTrashStmt = `CREATE TABLE IF NOT EXISTS trash (
+	uniqid UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+	project STRING NOT NULL CHECK (length(project) > 0) CHECK (project NOT LIKE '% %'),
+	kind STRING NOT NULL CHECK (length(kind) > 0),
+	shot STRING NOT NULL CHECK (length(shot) > 0),
+	task STRING NOT NULL,
+	version INT NOT NULL,
+	deleted_at TIMESTAMPTZ NOT NULL,
+	deleted_by STRING NOT NULL,
+	data STRING NOT NULL,
+	INDEX (project, deleted_at)
+)`
+
+// TrashItem은 휴지통에 들어간 샷, 태스크, 또는 버전이다.
+type TrashItem struct {
+	// ID는 휴지통 항목을 구분하는 아이디이다.
+	ID      string
+	Project string
+	Kind    TrashKind
+	Shot    string
+	// Task는 Kind가 TrashedShot일 때 빈 문자열이다.
+	Task string
+	// Version은 Kind가 TrashedVersion이 아닐 때 0이다.
+	Version   int
+	DeletedAt time.Time
+	DeletedBy string
+}
+
+// Target은 휴지통 항목을 사람이 알아볼 수 있게 나타낸 문자열이다.
+func (t *TrashItem) Target() string {
+	switch t.Kind {
+	case TrashedTask:
+		return t.Shot + "." + t.Task
+	case TrashedVersion:
+		return versionSearchTarget(t.Shot, t.Task, t.Version)
+	}
+	return t.Shot
+}
+
+// trashTable은 휴지통 항목에 포함되는 한 테이블의 열들을 고르는 조건이다.
+type trashTable struct {
+	name  string
+	where string
+	args  []interface{}
+}
+
+// trashTables는 휴지통 항목에 포함되어야 할 테이블과 조건들을 반환한다.
+// 여기에 포함되는 열들은 deleteShot, deleteTask, deleteVersion이 지우는 열들과 같아야 한다.
+func trashTables(prj string, kind TrashKind, shot, task string, version int) []trashTable {
+	switch kind {
+	case TrashedShot:
+		sub := escapeLike(shot+".") + "%"
+		return []trashTable{
+			{"shots", "project=$1 AND shot=$2", []interface{}{prj, shot}},
+			{"tasks", "project=$1 AND shot=$2", []interface{}{prj, shot}},
+			{"versions", "project=$1 AND shot=$2", []interface{}{prj, shot}},
+			{"version_files", "project=$1 AND shot=$2", []interface{}{prj, shot}},
+			{"vendor_tasks", "project=$1 AND shot=$2", []interface{}{prj, shot}},
+			{"search_words", "project=$1 AND ((kind=$2 AND target=$3) OR (kind IN ($4, $5) AND target LIKE $6))", []interface{}{prj, SearchShot, shot, SearchVersion, SearchReview, sub}},
+			{"reviews", "project_id=$1 AND id LIKE $2", []interface{}{prj, sub}},
+			{"annotations", "project=$1 AND review_id LIKE $2", []interface{}{prj, sub}},
+			{"shot_aliases", "project=$1 AND shot=$2", []interface{}{prj, shot}},
+		}
+	case TrashedTask:
+		sub := escapeLike(shot+"."+task+".") + "%"
+		return []trashTable{
+			{"tasks", "project=$1 AND shot=$2 AND task=$3", []interface{}{prj, shot, task}},
+			{"versions", "project=$1 AND shot=$2 AND task=$3", []interface{}{prj, shot, task}},
+			{"version_files", "project=$1 AND shot=$2 AND task=$3", []interface{}{prj, shot, task}},
+			{"vendor_tasks", "project=$1 AND shot=$2 AND task=$3", []interface{}{prj, shot, task}},
+			{"search_words", "project=$1 AND kind IN ($2, $3) AND target LIKE $4", []interface{}{prj, SearchVersion, SearchReview, sub}},
+			{"reviews", "project_id=$1 AND id LIKE $2", []interface{}{prj, sub}},
+			{"annotations", "project=$1 AND review_id LIKE $2", []interface{}{prj, sub}},
+		}
+	case TrashedVersion:
+		target := versionSearchTarget(shot, task, version)
+		sub := escapeLike(target+".") + "%"
+		return []trashTable{
+			{"versions", "project=$1 AND shot=$2 AND task=$3 AND version=$4", []interface{}{prj, shot, task, version}},
+			{"version_files", "project=$1 AND shot=$2 AND task=$3 AND version=$4", []interface{}{prj, shot, task, version}},
+			{"search_words", "project=$1 AND ((kind=$2 AND target=$3) OR (kind=$4 AND target LIKE $5))", []interface{}{prj, SearchVersion, target, SearchReview, sub}},
+			{"reviews", "project_id=$1 AND id LIKE $2", []interface{}{prj, sub}},
+			{"annotations", "project=$1 AND review_id LIKE $2", []interface{}{prj, sub}},
+		}
+	}
+	return nil
+}
+
+// trash는 트랜잭션 안에서 항목과 그 하위의 열들을 휴지통에 기록한 뒤 원래 테이블에서 지운다.
+func trash(ctx context.Context, tx *sql.Tx, prj string, kind TrashKind, shot, task string, version int, user string) error {
+	tables := make([]*archivedRows, 0)
+	for _, t := range trashTables(prj, kind, shot, task, version) {
+		rows, err := dumpArchiveTable(ctx, tx, t.name, t.where, t.args...)
+		if err != nil {
+			return err
+		}
+		tables = append(tables, rows)
+	}
+	data, err := json.Marshal(tables)
+	if err != nil {
+		return fmt.Errorf("could not encode trash data: %w", err)
+	}
+	stmt := "INSERT INTO trash (project, kind, shot, task, version, deleted_at, deleted_by, data) VALUES ($1, $2, $3, $4, $5, $6, $7, $8)"
+	if _, err := dbExec(ctx, tx, stmt, prj, string(kind), shot, task, version, time.Now(), user, string(data)); err != nil {
+		return fmt.Errorf("could not insert data into 'trash' table: %w", err)
+	}
+	switch kind {
+	case TrashedShot:
+		return deleteShot(ctx, tx, prj, shot)
+	case TrashedTask:
+		return deleteTask(ctx, tx, prj, shot, task)
+	case TrashedVersion:
+		return deleteVersion(ctx, tx, prj, shot, task, version)
+	}
+	return errorf(ErrInvalid, "unknown trash kind: %s", kind)
+}
+
+// TrashShot은 샷과 그 하위의 태스크, 버전, 리뷰를 휴지통으로 옮긴다.
+// user는 샷을 지운 사용자이다.
+func TrashShot(db *sql.DB, prj, shot, user string) error {
+	return TrashShotContext(context.Background(), db, prj, shot, user)
+}
+
+// TrashShotContext는 ctx를 받는 TrashShot이다.
+func TrashShotContext(ctx context.Context, db *sql.DB, prj, shot, user string) error {
+	exist, err := ShotExistContext(ctx, db, prj, shot)
+	if err != nil {
+		return err
+	}
+	if !exist {
+		return errorf(ErrNotFound, "shot not exist: %s.%s", prj, shot)
+	}
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("could not begin a transaction: %w", err)
+	}
+	defer tx.Rollback() // 트랜잭션이 완료되지 않았을 때만 실행됨
+	if err := trash(ctx, tx, prj, TrashedShot, shot, "", 0, user); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// TrashTask는 태스크와 그 하위의 버전, 리뷰를 휴지통으로 옮긴다.
+// user는 태스크를 지운 사용자이다.
+func TrashTask(db *sql.DB, prj, shot, task, user string) error {
+	return TrashTaskContext(context.Background(), db, prj, shot, task, user)
+}
+
+// TrashTaskContext는 ctx를 받는 TrashTask이다.
+func TrashTaskContext(ctx context.Context, db *sql.DB, prj, shot, task, user string) error {
+	exist, err := TaskExistContext(ctx, db, prj, shot, task)
+	if err != nil {
+		return err
+	}
+	if !exist {
+		return errorf(ErrNotFound, "task not exist: %s.%s.%s", prj, shot, task)
+	}
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("could not begin a transaction: %w", err)
+	}
+	defer tx.Rollback() // 트랜잭션이 완료되지 않았을 때만 실행됨
+	if err := trash(ctx, tx, prj, TrashedTask, shot, task, 0, user); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// TrashVersion은 버전과 그 리뷰를 휴지통으로 옮긴다.
+// user는 버전을 지운 사용자이다.
+func TrashVersion(db *sql.DB, prj, shot, task string, version int, user string) error {
+	return TrashVersionContext(context.Background(), db, prj, shot, task, version, user)
+}
+
+// TrashVersionContext는 ctx를 받는 TrashVersion이다.
+func TrashVersionContext(ctx context.Context, db *sql.DB, prj, shot, task string, version int, user string) error {
+	exist, err := VersionExistContext(ctx, db, prj, shot, task, version)
+	if err != nil {
+		return err
+	}
+	if !exist {
+		return errorf(ErrNotFound, "version not exist: %s.%s.%s.v%03d", prj, shot, task, version)
+	}
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("could not begin a transaction: %w", err)
+	}
+	defer tx.Rollback() // 트랜잭션이 완료되지 않았을 때만 실행됨
+	if err := trash(ctx, tx, prj, TrashedVersion, shot, task, version, user); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// trashItemFromRows는 테이블 열에서 휴지통 항목을 읽는다.
+func trashItemFromRows(rows *sql.Rows) (*TrashItem, error) {
+	t := &TrashItem{}
+	var kind string
+	if err := rows.Scan(&t.ID, &t.Project, &kind, &t.Shot, &t.Task, &t.Version, &t.DeletedAt, &t.DeletedBy); err != nil {
+		return nil, err
+	}
+	t.Kind = TrashKind(kind)
+	return t, nil
+}
+
+// ProjectTrash는 프로젝트 휴지통의 항목들을 최근에 지워진 순서로 반환한다.
+func ProjectTrash(db *sql.DB, prj string) ([]*TrashItem, error) {
+	return ProjectTrashContext(context.Background(), db, prj)
+}
+
+// ProjectTrashContext는 ctx를 받는 ProjectTrash이다.
+func ProjectTrashContext(ctx context.Context, db *sql.DB, prj string) ([]*TrashItem, error) {
+	rows, err := dbQuery(ctx, db, "SELECT uniqid, project, kind, shot, task, version, deleted_at, deleted_by FROM trash WHERE project=$1 ORDER BY deleted_at DESC", prj)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	items := make([]*TrashItem, 0)
+	for rows.Next() {
+		t, err := trashItemFromRows(rows)
+		if err != nil {
+			return nil, err
+		}
+		items = append(items, t)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+// GetTrashItem은 휴지통에서 해당 아이디의 항목을 반환한다.
+// 항목이 없다면 nil과 nil을 반환한다.
+func GetTrashItem(db *sql.DB, id string) (*TrashItem, error) {
+	return GetTrashItemContext(context.Background(), db, id)
+}
+
+// GetTrashItemContext는 ctx를 받는 GetTrashItem이다.
+func GetTrashItemContext(ctx context.Context, db *sql.DB, id string) (*TrashItem, error) {
+	rows, err := dbQuery(ctx, db, "SELECT uniqid, project, kind, shot, task, version, deleted_at, deleted_by FROM trash WHERE uniqid=$1", id)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	if !rows.Next() {
+		return nil, rows.Err()
+	}
+	return trashItemFromRows(rows)
+}
+
+// RestoreTrash는 휴지통의 항목을 원래 자리로 되살린다.
+// 같은 이름의 항목이 이미 있거나, 상위 샷 또는 태스크가 없다면 에러를 반환한다.
+func RestoreTrash(db *sql.DB, id string) error {
+	return RestoreTrashContext(context.Background(), db, id)
+}
+
+// RestoreTrashContext는 ctx를 받는 RestoreTrash이다.
+func RestoreTrashContext(ctx context.Context, db *sql.DB, id string) error {
+	t, err := GetTrashItemContext(ctx, db, id)
+	if err != nil {
+		return err
+	}
+	if t == nil {
+		return errorf(ErrNotFound, "trash item not exist: %s", id)
+	}
+	switch t.Kind {
+	case TrashedShot:
+		exist, err := ShotExistContext(ctx, db, t.Project, t.Shot)
+		if err != nil {
+			return err
+		}
+		if exist {
+			return errorf(ErrExists, "shot already exist: %s.%s", t.Project, t.Shot)
+		}
+	case TrashedTask:
+		exist, err := ShotExistContext(ctx, db, t.Project, t.Shot)
+		if err != nil {
+			return err
+		}
+		if !exist {
+			return errorf(ErrNotFound, "shot not exist: %s.%s", t.Project, t.Shot)
+		}
+		exist, err = TaskExistContext(ctx, db, t.Project, t.Shot, t.Task)
+		if err != nil {
+			return err
+		}
+		if exist {
+			return errorf(ErrExists, "task already exist: %s.%s.%s", t.Project, t.Shot, t.Task)
+		}
+	case TrashedVersion:
+		exist, err := TaskExistContext(ctx, db, t.Project, t.Shot, t.Task)
+		if err != nil {
+			return err
+		}
+		if !exist {
+			return errorf(ErrNotFound, "task not exist: %s.%s.%s", t.Project, t.Shot, t.Task)
+		}
+		exist, err = VersionExistContext(ctx, db, t.Project, t.Shot, t.Task, t.Version)
+		if err != nil {
+			return err
+		}
+		if exist {
+			return errorf(ErrExists, "version already exist: %s.%s.%s.v%03d", t.Project, t.Shot, t.Task, t.Version)
+		}
+	default:
+		return errorf(ErrInvalid, "unknown trash kind: %s", t.Kind)
+	}
+	var data string
+	if err := dbQueryRow(ctx, db, "SELECT data FROM trash WHERE uniqid=$1", id).Scan(&data); err != nil {
+		return err
+	}
+	dec := json.NewDecoder(strings.NewReader(data))
+	dec.UseNumber()
+	tables := make([]*archivedRows, 0)
+	if err := dec.Decode(&tables); err != nil {
+		return fmt.Errorf("could not decode trash data: %w", err)
+	}
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("could not begin a transaction: %w", err)
+	}
+	defer tx.Rollback() // 트랜잭션이 완료되지 않았을 때만 실행됨
+	for _, rows := range tables {
+		if err := restoreArchivedRows(ctx, tx, t.Project, rows); err != nil {
+			return err
+		}
+	}
+	if t.Kind == TrashedVersion {
+		stmt := "UPDATE tasks SET last_output_version=$1 WHERE project=$2 AND shot=$3 AND task=$4 AND last_output_version < $1"
+		if _, err := dbExec(ctx, tx, stmt, t.Version, t.Project, t.Shot, t.Task); err != nil {
+			return fmt.Errorf("could not update last version num of task: %w", err)
+		}
+	}
+	if _, err := dbExec(ctx, tx, "DELETE FROM trash WHERE uniqid=$1", id); err != nil {
+		return fmt.Errorf("could not delete data from 'trash' table: %w", err)
+	}
+	return tx.Commit()
+}
+
+// PurgeTrash는 휴지통의 항목을 완전히 지운다. 항목의 썸네일과 리뷰 그림도 함께 지운다.
+// 지운 항목은 다시 되살릴 수 없다.
+func PurgeTrash(db *sql.DB, id string) error {
+	return PurgeTrashContext(context.Background(), db, id)
+}
+
+// PurgeTrashContext는 ctx를 받는 PurgeTrash이다.
+func PurgeTrashContext(ctx context.Context, db *sql.DB, id string) error {
+	t, err := GetTrashItemContext(ctx, db, id)
+	if err != nil {
+		return err
+	}
+	if t == nil {
+		return errorf(ErrNotFound, "trash item not exist: %s", id)
+	}
+	if _, err := dbExec(ctx, db, "DELETE FROM trash WHERE uniqid=$1", id); err != nil {
+		return fmt.Errorf("could not delete data from 'trash' table: %w", err)
+	}
+	return purgeTrashUserData(ctx, db, t)
+}
+
+// purgeTrashUserData는 휴지통 항목에 딸린 사용자 데이터 파일들을 지운다.
+// 같은 이름의 항목이 다시 만들어졌다면 그 파일은 새 항목의 것이므로 남겨둔다.
+func purgeTrashUserData(ctx context.Context, db *sql.DB, t *TrashItem) error {
+	var exist bool
+	var err error
+	var dirs []string
+	switch t.Kind {
+	case TrashedShot:
+		exist, err = ShotExistContext(ctx, db, t.Project, t.Shot)
+		dirs = []string{
+			thumbnailDir(t.Project, t.Shot),
+			filepath.Join(UserDataDir, "version-thumbnail", t.Project, t.Shot),
+			filepath.Join(UserDataDir, "annotation", t.Project, t.Shot),
+		}
+	case TrashedTask:
+		exist, err = TaskExistContext(ctx, db, t.Project, t.Shot, t.Task)
+		dirs = []string{
+			filepath.Join(UserDataDir, "version-thumbnail", t.Project, t.Shot, t.Task),
+			filepath.Join(UserDataDir, "annotation", t.Project, t.Shot, t.Task),
+		}
+	case TrashedVersion:
+		exist, err = VersionExistContext(ctx, db, t.Project, t.Shot, t.Task, t.Version)
+		dirs = []string{
+			versionThumbnailDir(t.Project, t.Shot, t.Task, t.Version),
+			filepath.Join(UserDataDir, "annotation", t.Project, t.Shot, t.Task, fmt.Sprintf("v%03d", t.Version)),
+		}
+	}
+	if err != nil {
+		return err
+	}
+	if exist {
+		return nil
+	}
+	for _, d := range dirs {
+		if err := os.RemoveAll(d); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// PurgeExpiredTrash는 before 전에 휴지통에 들어간 모든 항목을 완전히 지우고
+// 지운 항목의 수를 반환한다.
+func PurgeExpiredTrash(db *sql.DB, before time.Time) (int, error) {
+	return PurgeExpiredTrashContext(context.Background(), db, before)
+}
+
+// PurgeExpiredTrashContext는 ctx를 받는 PurgeExpiredTrash이다.
+func PurgeExpiredTrashContext(ctx context.Context, db *sql.DB, before time.Time) (int, error) {
+	rows, err := dbQuery(ctx, db, "SELECT uniqid FROM trash WHERE deleted_at < $1", before)
+	if err != nil {
+		return 0, err
+	}
+	ids := make([]string, 0)
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			rows.Close()
+			return 0, err
+		}
+		ids = append(ids, id)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, err
+	}
+	n := 0
+	for _, id := range ids {
+		if err := PurgeTrashContext(ctx, db, id); err != nil {
+			return n, err
+		}
+		n++
+	}
+	return n, nil
+}
@@ -0,0 +1,181 @@
+package roi
+
+import (
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestTrashItemTarget(t *testing.T) {
+	cases := []struct {
+		item *TrashItem
+		want string
+	}{
+		{&TrashItem{Kind: TrashedShot, Shot: "CG_0010"}, "CG_0010"},
+		{&TrashItem{Kind: TrashedTask, Shot: "CG_0010", Task: "fx_fire"}, "CG_0010.fx_fire"},
+		{&TrashItem{Kind: TrashedVersion, Shot: "CG_0010", Task: "fx_fire", Version: 3}, "CG_0010.fx_fire.v003"},
+	}
+	for _, c := range cases {
+		got := c.item.Target()
+		if got != c.want {
+			t.Fatalf("Target(%v): got %s, want %s", c.item, got, c.want)
+		}
+	}
+}
+
+func TestTrashTables(t *testing.T) {
+	for _, kind := range []TrashKind{TrashedShot, TrashedTask, TrashedVersion} {
+		tables := trashTables("TEST", kind, "CG_0010", "fx_fire", 3)
+		if len(tables) == 0 {
+			t.Fatalf("%s: no trash tables", kind)
+		}
+		for _, tb := range tables {
+			stmt := fmt.Sprintf("SELECT * FROM %s WHERE %s", tb.name, tb.where)
+			if err := checkStmt(stmt, tb.args); err != nil {
+				t.Fatalf("%s: %v", kind, err)
+			}
+		}
+	}
+}
+
+func TestTrash(t *testing.T) {
+	db, err := testDB()
+	if err != nil {
+		t.Fatalf("could not connect to database: %v", err)
+	}
+	err = AddProject(db, testProject)
+	if err != nil {
+		t.Fatalf("could not add project: %v", err)
+	}
+	err = AddShot(db, testProject.Project, testShotA)
+	if err != nil {
+		t.Fatalf("could not add shot: %v", err)
+	}
+	err = AddTask(db, testProject.Project, testShotA.Shot, testTaskA)
+	if err != nil {
+		t.Fatalf("could not add task: %v", err)
+	}
+
+	err = TrashShot(db, testProject.Project, testShotA.Shot, "kybin")
+	if err != nil {
+		t.Fatalf("could not move shot to trash: %v", err)
+	}
+	shot, err := GetShot(db, testProject.Project, testShotA.Shot)
+	if err != nil {
+		t.Fatalf("could not get shot: %v", err)
+	}
+	if shot != nil {
+		t.Fatalf("trashed shot should not be found: %v", shot)
+	}
+	found, err := FullTextSearch(db, testShotA.Shot, testProject.Project, 0)
+	if err != nil {
+		t.Fatalf("could not search: %v", err)
+	}
+	if len(found) != 0 {
+		t.Fatalf("trashed shot should be hidden from search: %v", found)
+	}
+	items, err := ProjectTrash(db, testProject.Project)
+	if err != nil {
+		t.Fatalf("could not get project trash: %v", err)
+	}
+	if len(items) != 1 {
+		t.Fatalf("project trash: got %d items, want 1", len(items))
+	}
+	item := items[0]
+	if item.Kind != TrashedShot || item.Shot != testShotA.Shot || item.DeletedBy != "kybin" {
+		t.Fatalf("unexpected trash item: %v", item)
+	}
+
+	err = RestoreTrash(db, item.ID)
+	if err != nil {
+		t.Fatalf("could not restore trash item: %v", err)
+	}
+	task, err := GetTask(db, testProject.Project, testShotA.Shot, testTaskA.Task)
+	if err != nil {
+		t.Fatalf("could not get restored task: %v", err)
+	}
+	if task == nil || task.Assignee != testTaskA.Assignee {
+		t.Fatalf("unexpected restored task: %v", task)
+	}
+	items, err = ProjectTrash(db, testProject.Project)
+	if err != nil {
+		t.Fatalf("could not get project trash: %v", err)
+	}
+	if len(items) != 0 {
+		t.Fatalf("restored item should be removed from trash: %v", items)
+	}
+
+	err = TrashTask(db, testProject.Project, testShotA.Shot, testTaskA.Task, "kybin")
+	if err != nil {
+		t.Fatalf("could not move task to trash: %v", err)
+	}
+	n, err := PurgeExpiredTrash(db, time.Now().Add(-time.Hour))
+	if err != nil {
+		t.Fatalf("could not purge expired trash: %v", err)
+	}
+	if n != 0 {
+		t.Fatalf("fresh trash item should not be purged: %d purged", n)
+	}
+	n, err = PurgeExpiredTrash(db, time.Now().Add(time.Hour))
+	if err != nil {
+		t.Fatalf("could not purge expired trash: %v", err)
+	}
+	if n != 1 {
+		t.Fatalf("expired trash: got %d purged, want 1", n)
+	}
+	exist, err := TaskExist(db, testProject.Project, testShotA.Shot, testTaskA.Task)
+	if err != nil {
+		t.Fatalf("could not check task exist: %v", err)
+	}
+	if exist {
+		t.Fatalf("purged task should not exist")
+	}
+
+	// 휴지통의 버전 번호는 예약되어 있어 그 뒤에 추가된 버전과 겹치지 않아야 한다.
+	err = AddTask(db, testProject.Project, testShotA.Shot, testTaskA)
+	if err != nil {
+		t.Fatalf("could not add task: %v", err)
+	}
+	for i := 0; i < 2; i++ {
+		v := *testVersionA
+		err = AddVersion(db, testProject.Project, testShotA.Shot, testTaskA.Task, &v)
+		if err != nil {
+			t.Fatalf("could not add version: %v", err)
+		}
+	}
+	err = TrashVersion(db, testProject.Project, testShotA.Shot, testTaskA.Task, 2, "kybin")
+	if err != nil {
+		t.Fatalf("could not move version to trash: %v", err)
+	}
+	v := *testVersionA
+	err = AddVersion(db, testProject.Project, testShotA.Shot, testTaskA.Task, &v)
+	if err != nil {
+		t.Fatalf("could not add version after trashing one: %v", err)
+	}
+	if v.Version != 3 {
+		t.Fatalf("version number of trashed version should not be reused: got v%03d", v.Version)
+	}
+	items, err = ProjectTrash(db, testProject.Project)
+	if err != nil {
+		t.Fatalf("could not get project trash: %v", err)
+	}
+	if len(items) != 1 || items[0].Kind != TrashedVersion || items[0].Version != 2 {
+		t.Fatalf("unexpected trash items: %v", items)
+	}
+	err = RestoreTrash(db, items[0].ID)
+	if err != nil {
+		t.Fatalf("could not restore trashed version: %v", err)
+	}
+	vs, err := TaskVersions(db, testProject.Project, testShotA.Shot, testTaskA.Task)
+	if err != nil {
+		t.Fatalf("could not get task versions: %v", err)
+	}
+	if len(vs) != 3 {
+		t.Fatalf("task versions after restore: got %d, want 3", len(vs))
+	}
+
+	err = DeleteProject(db, testProject.Project)
+	if err != nil {
+		t.Fatalf("could not delete project: %v", err)
+	}
+}
@@ -1,10 +1,10 @@
 package roi
 
 import (
+	"context"
 	"database/sql"
-	"errors"
 	"fmt"
-	"strings"
+	"regexp"
 
 	"golang.org/x/crypto/bcrypt"
 )
@@ -82,13 +82,24 @@ var UserTableIndicesWithHashedPassword = append(
 
 // AddUser는 db에 한 명의 사용자를 추가한다.
 func AddUser(db *sql.DB, id, pw string) error {
+	return AddUserContext(context.Background(), db, id, pw)
+}
+
+// AddUserContext는 ctx를 받는 AddUser이다.
+func AddUserContext(ctx context.Context, db *sql.DB, id, pw string) error {
+	v := &validator{}
+	v.check(IsValidUser(id), "id", "invalid user id: '%s'", id)
+	v.check(pw != "", "password", "password not specified")
+	if err := v.err(); err != nil {
+		return err
+	}
 	// 이 이름을 가진 사용자가 이미 있는지 검사한다.
-	exist, err := UserExist(db, id)
+	exist, err := UserExistContext(ctx, db, id)
 	if err != nil {
 		return err
 	}
 	if exist {
-		return fmt.Errorf("user already exists: %s", id)
+		return errorf(ErrExists, "user already exists: %s", id)
 	}
 	// 패스워드 해시
 	hashed, err := bcrypt.GenerateFromPassword([]byte(pw), bcrypt.DefaultCost)
@@ -97,11 +108,9 @@ func AddUser(db *sql.DB, id, pw string) error {
 	}
 	hashed_password := string(hashed)
 	// 사용자 생성
-	keystr := strings.Join(UserTableKeysWithHashedPassword, ", ")
-	idxstr := strings.Join(UserTableIndicesWithHashedPassword, ", ")
-	stmt := fmt.Sprintf("INSERT INTO users (%s) VALUES (%s)", keystr, idxstr)
 	u := &User{ID: id}
-	if _, err := db.Exec(stmt, u.dbValuesWithHashedPassword(hashed_password)...); err != nil {
+	q := insertQuery("users", UserTableKeysWithHashedPassword, u.dbValuesWithHashedPassword(hashed_password))
+	if _, err := q.exec(ctx, db); err != nil {
 		return err
 	}
 	return nil
@@ -109,23 +118,32 @@ func AddUser(db *sql.DB, id, pw string) error {
 
 // UserExist는 db에서 사용자가 존재하는지 검사한다.
 func UserExist(db *sql.DB, id string) (bool, error) {
-	stmt := fmt.Sprintf("SELECT id FROM users WHERE id='%s'", id)
-	rows, err := db.Query(stmt)
+	return UserExistContext(context.Background(), db, id)
+}
+
+// UserExistContext는 ctx를 받는 UserExist이다.
+func UserExistContext(ctx context.Context, db *sql.DB, id string) (bool, error) {
+	rows, err := selectQuery("users", "id").where("id", id).limit(1).query(ctx, db)
 	if err != nil {
 		return false, err
 	}
+	defer rows.Close()
 	return rows.Next(), rows.Err()
 }
 
 // GetUser는 db에서 사용자를 검색한다.
 // 해당 유저를 찾지 못하면 nil이 반환된다.
 func GetUser(db *sql.DB, id string) (*User, error) {
-	keystr := strings.Join(UserTableKeys, ", ")
-	stmt := fmt.Sprintf("SELECT %s FROM users WHERE id='%s'", keystr, id)
-	rows, err := db.Query(stmt)
+	return GetUserContext(context.Background(), db, id)
+}
+
+// GetUserContext는 ctx를 받는 GetUser이다.
+func GetUserContext(ctx context.Context, db *sql.DB, id string) (*User, error) {
+	rows, err := selectQuery("users", UserTableKeys...).where("id", id).query(ctx, db)
 	if err != nil {
 		return nil, err
 	}
+	defer rows.Close()
 	ok := rows.Next()
 	if !ok {
 		return nil, nil
@@ -140,14 +158,19 @@ func GetUser(db *sql.DB, id string) (*User, error) {
 // UserPasswordMatch는 db에 저장된 사용자의 비밀번호와 입력된 비밀번호가 같은지를 비교한다.
 // 해당 사용자가 없거나, 불러오는데 에러가 나면 false와 에러를 반환한다.
 func UserPasswordMatch(db *sql.DB, id, pw string) (bool, error) {
-	stmt := fmt.Sprintf("SELECT hashed_password FROM users WHERE id='%s'", id)
-	rows, err := db.Query(stmt)
+	return UserPasswordMatchContext(context.Background(), db, id, pw)
+}
+
+// UserPasswordMatchContext는 ctx를 받는 UserPasswordMatch이다.
+func UserPasswordMatchContext(ctx context.Context, db *sql.DB, id, pw string) (bool, error) {
+	rows, err := selectQuery("users", "hashed_password").where("id", id).query(ctx, db)
 	if err != nil {
 		return false, err
 	}
+	defer rows.Close()
 	ok := rows.Next()
 	if !ok {
-		return false, fmt.Errorf("user '%s' not exists", id)
+		return false, errorf(ErrNotFound, "user '%s' not exists", id)
 	}
 	var hashed_password string
 	rows.Scan(&hashed_password)
@@ -158,6 +181,8 @@ func UserPasswordMatch(db *sql.DB, id, pw string) (bool, error) {
 	return true, nil
 }
 
+var reValidEmail = regexp.MustCompile(`^[^@\s]+@[^@\s]+$`)
+
 // UpdateUserParam은 User에서 일반적으로 업데이트 되어야 하는 멤버의 모음이다.
 // UpdateUser에서 사용한다.
 type UpdateUserParam struct {
@@ -170,6 +195,13 @@ type UpdateUserParam struct {
 	EntryDate   string
 }
 
+// validate는 업데이트할 필드들이 적절한지 검사한다.
+func (u UpdateUserParam) validate() error {
+	v := &validator{}
+	v.check(u.Email == "" || reValidEmail.MatchString(u.Email), "email", "invalid email: '%s'", u.Email)
+	return v.err()
+}
+
 func (u UpdateUserParam) keys() []string {
 	return []string{
 		"kor_name",
@@ -182,10 +214,6 @@ func (u UpdateUserParam) keys() []string {
 	}
 }
 
-func (u UpdateUserParam) indices() []string {
-	return dbIndices(u.keys())
-}
-
 func (u UpdateUserParam) values() []interface{} {
 	return []interface{}{
 		u.KorName,
@@ -200,38 +228,69 @@ func (u UpdateUserParam) values() []interface{} {
 
 // UpdateUser는 db에 비밀번호를 제외한 사용자 필드를 업데이트 한다.
 func UpdateUser(db *sql.DB, id string, u UpdateUserParam) error {
+	return UpdateUserContext(context.Background(), db, id, u)
+}
+
+// UpdateUserContext는 ctx를 받는 UpdateUser이다.
+func UpdateUserContext(ctx context.Context, db *sql.DB, id string, u UpdateUserParam) error {
 	if id == "" {
-		return errors.New("empty id")
+		return errorf(ErrInvalid, "empty id")
+	}
+	if err := u.validate(); err != nil {
+		return err
 	}
-	keystr := strings.Join(u.keys(), ", ")
-	idxstr := strings.Join(u.indices(), ", ")
-	stmt := fmt.Sprintf("UPDATE users SET (%s) = (%s) WHERE id='%s'", keystr, idxstr, id)
-	if _, err := db.Exec(stmt, u.values()...); err != nil {
+	if _, err := updateQuery("users", u.keys(), u.values()).where("id", id).exec(ctx, db); err != nil {
 		return err
 	}
 	return nil
 }
 
 // UpdateUserPassword는 db에 저장된 사용자 패스워드를 수정한다.
+// 예전 패스워드로 만들어진 사용자의 모든 세션과 api 토큰도 함께 지운다.
 func UpdateUserPassword(db *sql.DB, id, pw string) error {
+	return UpdateUserPasswordContext(context.Background(), db, id, pw)
+}
+
+// UpdateUserPasswordContext는 ctx를 받는 UpdateUserPassword이다.
+func UpdateUserPasswordContext(ctx context.Context, db *sql.DB, id, pw string) error {
 	hashed, err := bcrypt.GenerateFromPassword([]byte(pw), bcrypt.DefaultCost)
 	if err != nil {
-		return fmt.Errorf("could not generate hash from password: %v", err)
+		return fmt.Errorf("could not generate hash from password: %w", err)
 	}
 	hashed_password := string(hashed)
-	stmt := fmt.Sprintf("UPDATE users SET hashed_password=$1 WHERE id='%s'", id)
-	if _, err := db.Exec(stmt, hashed_password); err != nil {
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("could not begin a transaction: %w", err)
+	}
+	defer tx.Rollback() // 트랜잭션이 완료되지 않았을 때만 실행됨
+	q := updateQuery("users", []string{"hashed_password"}, []interface{}{hashed_password}).where("id", id)
+	if _, err := q.exec(ctx, tx); err != nil {
 		return err
 	}
-	return nil
+	if _, err := deleteQuery("sessions").where("user_id", id).exec(ctx, tx); err != nil {
+		return fmt.Errorf("could not delete data from 'sessions' table: %w", err)
+	}
+	return tx.Commit()
 }
 
-// DeleteUser는 해당 id의 사용자를 지운다.
+// DeleteUser는 해당 id의 사용자와 그 사용자의 세션들을 지운다.
 // 만일 해당 아이디의 사용자가 없다면 에러를 낸다.
 func DeleteUser(db *sql.DB, id string) error {
-	stmt := fmt.Sprintf("DELETE FROM users WHERE id='%s'", id)
-	if _, err := db.Exec(stmt); err != nil {
+	return DeleteUserContext(context.Background(), db, id)
+}
+
+// DeleteUserContext는 ctx를 받는 DeleteUser이다.
+func DeleteUserContext(ctx context.Context, db *sql.DB, id string) error {
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("could not begin a transaction: %w", err)
+	}
+	defer tx.Rollback() // 트랜잭션이 완료되지 않았을 때만 실행됨
+	if _, err := deleteQuery("sessions").where("user_id", id).exec(ctx, tx); err != nil {
+		return fmt.Errorf("could not delete data from 'sessions' table: %w", err)
+	}
+	if _, err := deleteQuery("users").where("id", id).exec(ctx, tx); err != nil {
 		return err
 	}
-	return nil
+	return tx.Commit()
 }
@@ -3,6 +3,7 @@ package roi
 import (
 	"reflect"
 	"testing"
+	"time"
 )
 
 func TestUser(t *testing.T) {
@@ -53,11 +54,22 @@ func TestUser(t *testing.T) {
 	if !reflect.DeepEqual(got, u) {
 		t.Fatalf("user not match: got: %v, want: %v", got, u)
 	}
+	_, err = AddSession(db, &Session{User: u.ID, Expires: time.Now().Add(time.Hour)})
+	if err != nil {
+		t.Fatalf("could not add session: %v", err)
+	}
 	new_password := "this is not my password neither"
 	err = UpdateUserPassword(db, u.ID, new_password)
 	if err != nil {
 		t.Fatalf("could not update user password: %v", err)
 	}
+	ss, err := UserSessions(db, u.ID)
+	if err != nil {
+		t.Fatalf("could not get user sessions: %v", err)
+	}
+	if len(ss) != 0 {
+		t.Fatalf("sessions should be deleted when password changed: %v", ss)
+	}
 	ok, err := UserPasswordMatch(db, u.ID, new_password)
 	if err != nil {
 		t.Fatalf("could not check user password match: %v", err)
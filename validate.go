@@ -0,0 +1,133 @@
+package roi
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// FieldError는 입력의 한 필드가 적절하지 않다는 에러이다.
+type FieldError struct {
+	// Field는 폼과 API에서 쓰는 필드 이름이다. 예) shot, working_tasks
+	Field string
+	Msg   string
+}
+
+func (e *FieldError) Error() string {
+	return e.Field + ": " + e.Msg
+}
+
+// ValidationError는 입력을 검증하며 찾은 필드 에러들이다.
+// 로이의 Add, Update 함수들은 입력이 적절하지 않을 때 DB를 건드리지 않고 이 에러를 반환한다.
+type ValidationError struct {
+	Fields []*FieldError
+}
+
+func (e *ValidationError) Error() string {
+	msgs := make([]string, len(e.Fields))
+	for i, f := range e.Fields {
+		msgs[i] = f.Error()
+	}
+	return "invalid input: " + strings.Join(msgs, "; ")
+}
+
+// Is는 ValidationError가 ErrInvalid 종류의 에러임을 알린다.
+func (e *ValidationError) Is(target error) bool {
+	return target == ErrInvalid
+}
+
+// FieldErrors는 err가 ValidationError라면 필드 이름별 에러 메시지를, 아니라면 nil을 반환한다.
+// 한 필드에 에러가 여럿이면 처음 것을 사용한다.
+func FieldErrors(err error) map[string]string {
+	var verr *ValidationError
+	if !errors.As(err, &verr) {
+		return nil
+	}
+	m := make(map[string]string)
+	for _, f := range verr.Fields {
+		if _, ok := m[f.Field]; !ok {
+			m[f.Field] = f.Msg
+		}
+	}
+	return m
+}
+
+// validator는 필드들을 검사하며 에러를 모은다.
+type validator struct {
+	errs []*FieldError
+}
+
+// check는 ok가 거짓이면 필드 에러를 추가한다.
+func (v *validator) check(ok bool, field, format string, a ...interface{}) {
+	if !ok {
+		v.errs = append(v.errs, &FieldError{Field: field, Msg: fmt.Sprintf(format, a...)})
+	}
+}
+
+// checkTags는 태그들이 모두 적절한지 검사한다.
+func (v *validator) checkTags(field string, tags []string) {
+	for _, t := range tags {
+		if !IsValidTag(t) {
+			v.check(false, field, "invalid tag: '%s'", t)
+			return
+		}
+	}
+}
+
+// checkTasks는 태스크 이름들이 모두 적절하고 겹치지 않는지 검사한다.
+func (v *validator) checkTasks(field string, tasks []string) {
+	has := make(map[string]bool)
+	for _, t := range tasks {
+		if !IsValidTask(t) {
+			v.check(false, field, "invalid task name: '%s'", t)
+			return
+		}
+		if has[t] {
+			v.check(false, field, "duplicated task: '%s'", t)
+			return
+		}
+		has[t] = true
+	}
+}
+
+// checkPaths는 경로 목록에 빈 경로가 없는지 검사한다.
+func (v *validator) checkPaths(field string, paths []string) {
+	for _, p := range paths {
+		if strings.TrimSpace(p) == "" {
+			v.check(false, field, "empty path")
+			return
+		}
+	}
+}
+
+// err는 모은 에러가 있다면 ValidationError를, 없다면 nil을 반환한다.
+func (v *validator) err() error {
+	if len(v.errs) == 0 {
+		return nil
+	}
+	return &ValidationError{Fields: v.errs}
+}
+
+var reValidTask = regexp.MustCompile(`^[a-zA-Z][a-zA-Z0-9]*(_[a-zA-Z0-9]+)?$`)
+
+// IsValidTask는 해당 이름이 태스크 이름으로 적절한지 여부를 반환한다.
+// 태스크 이름은 타입 또는 타입_요소로 구성되며, 영문자와 숫자만 사용한다.
+// 예) fx, fx_fire
+func IsValidTask(name string) bool {
+	return reValidTask.MatchString(name)
+}
+
+var reValidUser = regexp.MustCompile(`^[a-zA-Z][a-zA-Z0-9_.-]*$`)
+
+// IsValidUser는 해당 아이디가 사용자 아이디로 적절한지 여부를 반환한다.
+// 아이디는 영문자로 시작하며 영문자와 숫자, 언더바(_), 점(.), 대시(-)만 사용한다.
+func IsValidUser(id string) bool {
+	return reValidUser.MatchString(id)
+}
+
+// IsValidTag는 해당 문자열이 태그로 적절한지 여부를 반환한다.
+// 태그 목록은 쉼표로 나뉘어 입력되므로 태그에는 쉼표와 공백이 들어갈 수 없다.
+func IsValidTag(tag string) bool {
+	return tag != "" && !strings.ContainsAny(tag, ", \t\n")
+}
@@ -0,0 +1,100 @@
+package roi
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+)
+
+func TestIsValidTask(t *testing.T) {
+	cases := []struct {
+		name string
+		want bool
+	}{
+		{"fx", true},
+		{"fx_fire", true},
+		{"comp2", true},
+		{"", false},
+		{"_fx", false},
+		{"fx_", false},
+		{"fx_fire_big", false},
+		{"fx fire", false},
+		{"2d", false},
+	}
+	for _, c := range cases {
+		got := IsValidTask(c.name)
+		if got != c.want {
+			t.Fatalf("IsValidTask(%q): got %v, want %v", c.name, got, c.want)
+		}
+	}
+}
+
+func TestIsValidUser(t *testing.T) {
+	cases := []struct {
+		id   string
+		want bool
+	}{
+		{"kybin", true},
+		{"kim.yongbin", true},
+		{"kim_yb-2", true},
+		{"", false},
+		{"1kybin", false},
+		{"kim yongbin", false},
+		{"' OR '1'='1", false},
+	}
+	for _, c := range cases {
+		got := IsValidUser(c.id)
+		if got != c.want {
+			t.Fatalf("IsValidUser(%q): got %v, want %v", c.id, got, c.want)
+		}
+	}
+}
+
+func TestIsValidTag(t *testing.T) {
+	cases := []struct {
+		tag  string
+		want bool
+	}{
+		{"로이", true},
+		{"night", true},
+		{"", false},
+		{"rain,night", false},
+		{"rain night", false},
+	}
+	for _, c := range cases {
+		got := IsValidTag(c.tag)
+		if got != c.want {
+			t.Fatalf("IsValidTag(%q): got %v, want %v", c.tag, got, c.want)
+		}
+	}
+}
+
+func TestShotValidate(t *testing.T) {
+	s := &Shot{
+		Shot:         "CG 0010",
+		Status:       ShotWaiting,
+		Tags:         []string{"로이", ""},
+		WorkingTasks: []string{"fx", "fx"},
+	}
+	err := s.validate()
+	want := map[string]string{
+		"shot":          "invalid shot id: 'CG 0010'",
+		"tags":          "invalid tag: ''",
+		"working_tasks": "duplicated task: 'fx'",
+	}
+	got := FieldErrors(err)
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("got %v, want %v", got, want)
+	}
+	// 감싼 에러에서도 필드 에러를 찾을 수 있어야 한다.
+	got = FieldErrors(fmt.Errorf("could not add shot: %w", err))
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("wrapped: got %v, want %v", got, want)
+	}
+	if FieldErrors(testShotA.validate()) != nil {
+		t.Fatalf("testShotA should be valid")
+	}
+	if FieldErrors(fmt.Errorf("not a validation error")) != nil {
+		t.Fatalf("other errors should not have field errors")
+	}
+}
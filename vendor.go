@@ -0,0 +1,608 @@
+package roi
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+)
+
+var reValidVendor = regexp.MustCompile(`^[a-zA-Z][a-zA-Z0-9_-]*$`)
+
+// IsValidVendor는 해당 아이디가 외주 업체 아이디로 적절한지 여부를 반환한다.
+func IsValidVendor(id string) bool {
+	return reValidVendor.MatchString(id)
+}
+
+// Vendor는 태스크 일부를 맡기는 외주 업체이다.
+// 외주 업체의 아티스트는 로이의 사용자가 아니기 때문에 Task.Assignee 대신 VendorTask로 배정한다.
+type Vendor struct {
+	Vendor  string // 업체 아이디
+	Name    string // 업체 이름
+	Contact string // 담당자 이름, 이메일, 전화번호 등의 연락처
+	Notes   string
+}
+
+var CreateTableIfNotExistsVendorsStmt = `CREATE TABLE IF NOT EXISTS vendors (
+	uniqid UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+	vendor STRING NOT NULL UNIQUE CHECK (length(vendor) > 0) CHECK (vendor NOT LIKE '% %'),
+	name STRING NOT NULL,
+	contact STRING NOT NULL,
+	notes STRING NOT NULL
+)`
+
+var VendorTableKeys = []string{
+	"vendor",
+	"name",
+	"contact",
+	"notes",
+}
+
+var VendorTableIndices = dbIndices(VendorTableKeys)
+
+func (v *Vendor) dbValues() []interface{} {
+	if v == nil {
+		v = &Vendor{}
+	}
+	return []interface{}{
+		v.Vendor,
+		v.Name,
+		v.Contact,
+		v.Notes,
+	}
+}
+
+// AddVendor는 db에 외주 업체를 추가한다.
+func AddVendor(db *sql.DB, v *Vendor) error {
+	return AddVendorContext(context.Background(), db, v)
+}
+
+// AddVendorContext는 ctx를 받는 AddVendor이다.
+func AddVendorContext(ctx context.Context, db *sql.DB, v *Vendor) error {
+	if v == nil {
+		return errorf(ErrInvalid, "nil Vendor is invalid")
+	}
+	vd := &validator{}
+	vd.check(IsValidVendor(v.Vendor), "vendor", "invalid vendor id: '%s'", v.Vendor)
+	if err := vd.err(); err != nil {
+		return err
+	}
+	keystr := strings.Join(VendorTableKeys, ", ")
+	idxstr := strings.Join(VendorTableIndices, ", ")
+	stmt := fmt.Sprintf("INSERT INTO vendors (%s) VALUES (%s)", keystr, idxstr)
+	if _, err := dbExec(ctx, db, stmt, v.dbValues()...); err != nil {
+		return fmt.Errorf("could not insert vendor: %w", err)
+	}
+	return nil
+}
+
+// UpdateVendorParam은 Vendor에서 일반적으로 업데이트 되어야 하는 멤버의 모음이다.
+// UpdateVendor에서 사용한다.
+type UpdateVendorParam struct {
+	Name    string
+	Contact string
+	Notes   string
+}
+
+func (u UpdateVendorParam) keys() []string {
+	return []string{
+		"name",
+		"contact",
+		"notes",
+	}
+}
+
+func (u UpdateVendorParam) values() []interface{} {
+	return []interface{}{
+		u.Name,
+		u.Contact,
+		u.Notes,
+	}
+}
+
+// UpdateVendor는 db의 외주 업체 정보를 업데이트 한다.
+func UpdateVendor(db *sql.DB, vendor string, upd UpdateVendorParam) error {
+	return UpdateVendorContext(context.Background(), db, vendor, upd)
+}
+
+// UpdateVendorContext는 ctx를 받는 UpdateVendor이다.
+func UpdateVendorContext(ctx context.Context, db *sql.DB, vendor string, upd UpdateVendorParam) error {
+	if vendor == "" {
+		return errorf(ErrInvalid, "vendor not specified")
+	}
+	q := updateQuery("vendors", upd.keys(), upd.values()).where("vendor", vendor)
+	if _, err := q.exec(ctx, db); err != nil {
+		return err
+	}
+	return nil
+}
+
+// VendorExist는 db에 해당 외주 업체가 존재하는지를 검사한다.
+func VendorExist(db *sql.DB, vendor string) (bool, error) {
+	return VendorExistContext(context.Background(), db, vendor)
+}
+
+// VendorExistContext는 ctx를 받는 VendorExist이다.
+func VendorExistContext(ctx context.Context, db *sql.DB, vendor string) (bool, error) {
+	rows, err := dbQuery(ctx, db, "SELECT vendor FROM vendors WHERE vendor=$1 LIMIT 1", vendor)
+	if err != nil {
+		return false, err
+	}
+	defer rows.Close()
+	return rows.Next(), rows.Err()
+}
+
+// vendorFromRows는 테이블의 한 열에서 외주 업체를 받아온다.
+func vendorFromRows(rows *sql.Rows) (*Vendor, error) {
+	v := &Vendor{}
+	if err := rows.Scan(&v.Vendor, &v.Name, &v.Contact, &v.Notes); err != nil {
+		return nil, err
+	}
+	return v, nil
+}
+
+// GetVendor는 db에서 외주 업체를 불러온다.
+// 해당 외주 업체가 없다면 nil이 반환된다.
+func GetVendor(db *sql.DB, vendor string) (*Vendor, error) {
+	return GetVendorContext(context.Background(), db, vendor)
+}
+
+// GetVendorContext는 ctx를 받는 GetVendor이다.
+func GetVendorContext(ctx context.Context, db *sql.DB, vendor string) (*Vendor, error) {
+	keystr := strings.Join(VendorTableKeys, ", ")
+	stmt := fmt.Sprintf("SELECT %s FROM vendors WHERE vendor=$1 LIMIT 1", keystr)
+	rows, err := dbQuery(ctx, db, stmt, vendor)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	if !rows.Next() {
+		return nil, rows.Err()
+	}
+	return vendorFromRows(rows)
+}
+
+// AllVendors는 db의 모든 외주 업체를 아이디 순서로 반환한다.
+func AllVendors(db *sql.DB) ([]*Vendor, error) {
+	return AllVendorsContext(context.Background(), db)
+}
+
+// AllVendorsContext는 ctx를 받는 AllVendors이다.
+func AllVendorsContext(ctx context.Context, db *sql.DB) ([]*Vendor, error) {
+	keystr := strings.Join(VendorTableKeys, ", ")
+	stmt := fmt.Sprintf("SELECT %s FROM vendors ORDER BY vendor", keystr)
+	rows, err := dbQuery(ctx, db, stmt)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	vs := make([]*Vendor, 0)
+	for rows.Next() {
+		v, err := vendorFromRows(rows)
+		if err != nil {
+			return nil, err
+		}
+		vs = append(vs, v)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return vs, nil
+}
+
+// DeleteVendor는 db에서 외주 업체를 지운다.
+// 업체에 배정된 태스크가 남아 있다면 지우지 않고 에러를 반환한다.
+func DeleteVendor(db *sql.DB, vendor string) error {
+	return DeleteVendorContext(context.Background(), db, vendor)
+}
+
+// DeleteVendorContext는 ctx를 받는 DeleteVendor이다.
+func DeleteVendorContext(ctx context.Context, db *sql.DB, vendor string) error {
+	rows, err := dbQuery(ctx, db, "SELECT vendor FROM vendor_tasks WHERE vendor=$1 LIMIT 1", vendor)
+	if err != nil {
+		return err
+	}
+	assigned := rows.Next()
+	rows.Close()
+	if assigned {
+		return errorf(ErrConflict, "vendor '%s' still has assigned tasks", vendor)
+	}
+	if _, err := dbExec(ctx, db, "DELETE FROM vendors WHERE vendor=$1", vendor); err != nil {
+		return fmt.Errorf("could not delete data from 'vendors' table: %w", err)
+	}
+	return nil
+}
+
+// VendorTask는 외주 업체에 배정된 태스크이다.
+type VendorTask struct {
+	Project string
+	Shot    string
+	Task    string
+	Vendor  string
+	// Artist는 외주 업체 쪽에서 작업하는 아티스트의 이름이다. 비워둘 수 있다.
+	Artist string
+	// DueDate는 외주 업체와 약속한 마감일이다. 태스크 자체의 마감일과 다를 수 있다.
+	DueDate time.Time
+	// Cost는 이 태스크에 대해 외주 업체에 지불할 금액이다.
+	Cost int64
+	// Sent는 외주 업체로 마지막 패키지를 보낸 시간이다.
+	Sent time.Time
+	// Returned와 ReturnedVersion은 외주 업체에서 마지막으로 받은 버전과 그 시간이다.
+	Returned        time.Time
+	ReturnedVersion int
+
+	// Status는 태스크의 현재 상태이다. db에서 읽을 때 tasks 테이블에서 채워진다.
+	Status TaskStatus
+}
+
+var CreateTableIfNotExistsVendorTasksStmt = `CREATE TABLE IF NOT EXISTS vendor_tasks (
+	uniqid UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+	project STRING NOT NULL CHECK (length(project) > 0) CHECK (project NOT LIKE '% %'),
+	shot STRING NOT NULL CHECK (length(shot) > 0) CHECK (shot NOT LIKE '% %'),
+	task STRING NOT NULL CHECK (length(task) > 0) CHECK (task NOT LIKE '% %'),
+	vendor STRING NOT NULL CHECK (length(vendor) > 0) CHECK (vendor NOT LIKE '% %'),
+	artist STRING NOT NULL,
+	due_date TIMESTAMPTZ NOT NULL,
+	cost INT NOT NULL,
+	sent TIMESTAMPTZ NOT NULL,
+	returned TIMESTAMPTZ NOT NULL,
+	returned_version INT NOT NULL,
+	UNIQUE(project, shot, task)
+)`
+
+var VendorTaskTableKeys = []string{
+	"project",
+	"shot",
+	"task",
+	"vendor",
+	"artist",
+	"due_date",
+	"cost",
+	"sent",
+	"returned",
+	"returned_version",
+}
+
+var VendorTaskTableIndices = dbIndices(VendorTaskTableKeys)
+
+func (t *VendorTask) dbValues() []interface{} {
+	if t == nil {
+		t = &VendorTask{}
+	}
+	return []interface{}{
+		t.Project,
+		t.Shot,
+		t.Task,
+		t.Vendor,
+		t.Artist,
+		t.DueDate,
+		t.Cost,
+		t.Sent,
+		t.Returned,
+		t.ReturnedVersion,
+	}
+}
+
+// IsOpen은 외주 태스크가 아직 끝나지 않았는지를 반환한다.
+func (t *VendorTask) IsOpen() bool {
+	return t.Status != TaskDone && t.Status != TaskOmit
+}
+
+// IsOverdue는 외주 태스크가 끝나지 않은 채 업체 마감일이 지났는지를 반환한다.
+func (t *VendorTask) IsOverdue(now time.Time) bool {
+	return t.IsOpen() && !t.DueDate.IsZero() && t.DueDate.Before(now)
+}
+
+// AssignVendorTask는 태스크를 외주 업체에 배정한다.
+// 이미 배정된 태스크라면 업체, 아티스트, 마감일, 비용을 바꾼다.
+// 패키지를 보내거나 받은 기록은 업체가 바뀌면 지워진다.
+func AssignVendorTask(db *sql.DB, t *VendorTask) error {
+	return AssignVendorTaskContext(context.Background(), db, t)
+}
+
+// AssignVendorTaskContext는 ctx를 받는 AssignVendorTask이다.
+func AssignVendorTaskContext(ctx context.Context, db *sql.DB, t *VendorTask) error {
+	if t == nil {
+		return errorf(ErrInvalid, "nil VendorTask is invalid")
+	}
+	if t.Cost < 0 {
+		return errorf(ErrInvalid, "vendor cost should not be negative: %d", t.Cost)
+	}
+	exist, err := TaskExistContext(ctx, db, t.Project, t.Shot, t.Task)
+	if err != nil {
+		return err
+	}
+	if !exist {
+		return errorf(ErrNotFound, "task not exist: %s.%s.%s", t.Project, t.Shot, t.Task)
+	}
+	exist, err = VendorExistContext(ctx, db, t.Vendor)
+	if err != nil {
+		return err
+	}
+	if !exist {
+		return errorf(ErrNotFound, "vendor not exist: %s", t.Vendor)
+	}
+	keystr := strings.Join(VendorTaskTableKeys, ", ")
+	idxstr := strings.Join(VendorTaskTableIndices, ", ")
+	stmt := fmt.Sprintf(`INSERT INTO vendor_tasks (%s) VALUES (%s)
+		ON CONFLICT (project, shot, task) DO UPDATE SET
+			sent = CASE WHEN vendor_tasks.vendor = excluded.vendor THEN vendor_tasks.sent ELSE excluded.sent END,
+			returned = CASE WHEN vendor_tasks.vendor = excluded.vendor THEN vendor_tasks.returned ELSE excluded.returned END,
+			returned_version = CASE WHEN vendor_tasks.vendor = excluded.vendor THEN vendor_tasks.returned_version ELSE excluded.returned_version END,
+			vendor = excluded.vendor, artist = excluded.artist, due_date = excluded.due_date, cost = excluded.cost`, keystr, idxstr)
+	vt := *t
+	vt.Sent = time.Time{}
+	vt.Returned = time.Time{}
+	vt.ReturnedVersion = 0
+	if _, err := dbExec(ctx, db, stmt, vt.dbValues()...); err != nil {
+		return fmt.Errorf("could not assign vendor task: %w", err)
+	}
+	return nil
+}
+
+// UnassignVendorTask는 태스크의 외주 배정을 취소한다.
+// 배정되지 않은 태스크여도 에러를 내지 않는다.
+func UnassignVendorTask(db *sql.DB, prj, shot, task string) error {
+	return UnassignVendorTaskContext(context.Background(), db, prj, shot, task)
+}
+
+// UnassignVendorTaskContext는 ctx를 받는 UnassignVendorTask이다.
+func UnassignVendorTaskContext(ctx context.Context, db *sql.DB, prj, shot, task string) error {
+	if _, err := dbExec(ctx, db, "DELETE FROM vendor_tasks WHERE project=$1 AND shot=$2 AND task=$3", prj, shot, task); err != nil {
+		return fmt.Errorf("could not delete data from 'vendor_tasks' table: %w", err)
+	}
+	return nil
+}
+
+// vendorTaskFromRows는 테이블의 한 열에서 외주 태스크와 태스크 상태를 받아온다.
+func vendorTaskFromRows(rows *sql.Rows) (*VendorTask, error) {
+	t := &VendorTask{}
+	err := rows.Scan(
+		&t.Project, &t.Shot, &t.Task, &t.Vendor, &t.Artist, &t.DueDate, &t.Cost,
+		&t.Sent, &t.Returned, &t.ReturnedVersion, &t.Status,
+	)
+	if err != nil {
+		return nil, err
+	}
+	return t, nil
+}
+
+// queryVendorTasks는 where 조건에 맞는 외주 태스크들을 업체, 샷, 태스크 순서로 반환한다.
+func queryVendorTasks(ctx context.Context, db *sql.DB, where string, args ...interface{}) ([]*VendorTask, error) {
+	keys := make([]string, len(VendorTaskTableKeys))
+	for i, k := range VendorTaskTableKeys {
+		keys[i] = "vendor_tasks." + k
+	}
+	keystr := strings.Join(keys, ", ")
+	stmt := fmt.Sprintf(`SELECT %s, tasks.status FROM vendor_tasks
+		JOIN tasks ON (vendor_tasks.project = tasks.project AND vendor_tasks.shot = tasks.shot AND vendor_tasks.task = tasks.task)
+		WHERE %s
+		ORDER BY vendor_tasks.vendor, vendor_tasks.shot, vendor_tasks.task`, keystr, where)
+	rows, err := dbQuery(ctx, db, stmt, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	ts := make([]*VendorTask, 0)
+	for rows.Next() {
+		t, err := vendorTaskFromRows(rows)
+		if err != nil {
+			return nil, err
+		}
+		ts = append(ts, t)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return ts, nil
+}
+
+// GetVendorTask는 태스크의 외주 배정 정보를 반환한다.
+// 외주 업체에 배정되지 않은 태스크라면 nil이 반환된다.
+func GetVendorTask(db *sql.DB, prj, shot, task string) (*VendorTask, error) {
+	return GetVendorTaskContext(context.Background(), db, prj, shot, task)
+}
+
+// GetVendorTaskContext는 ctx를 받는 GetVendorTask이다.
+func GetVendorTaskContext(ctx context.Context, db *sql.DB, prj, shot, task string) (*VendorTask, error) {
+	ts, err := queryVendorTasks(ctx, db, "vendor_tasks.project=$1 AND vendor_tasks.shot=$2 AND vendor_tasks.task=$3", prj, shot, task)
+	if err != nil {
+		return nil, err
+	}
+	if len(ts) == 0 {
+		return nil, nil
+	}
+	return ts[0], nil
+}
+
+// ShotVendorTasks는 샷의 태스크 중 외주 업체에 배정된 태스크들을 태스크 이름을 키로 하는 맵으로 반환한다.
+func ShotVendorTasks(db *sql.DB, prj, shot string) (map[string]*VendorTask, error) {
+	return ShotVendorTasksContext(context.Background(), db, prj, shot)
+}
+
+// ShotVendorTasksContext는 ctx를 받는 ShotVendorTasks이다.
+func ShotVendorTasksContext(ctx context.Context, db *sql.DB, prj, shot string) (map[string]*VendorTask, error) {
+	ts, err := queryVendorTasks(ctx, db, "vendor_tasks.project=$1 AND vendor_tasks.shot=$2", prj, shot)
+	if err != nil {
+		return nil, err
+	}
+	tm := make(map[string]*VendorTask)
+	for _, t := range ts {
+		tm[t.Task] = t
+	}
+	return tm, nil
+}
+
+// ProjectVendorTasks는 프로젝트에서 외주 업체에 배정된 태스크들을 반환한다.
+// vendor가 빈 문자열이 아니라면 해당 업체의 태스크만 반환한다.
+func ProjectVendorTasks(db *sql.DB, prj, vendor string) ([]*VendorTask, error) {
+	return ProjectVendorTasksContext(context.Background(), db, prj, vendor)
+}
+
+// ProjectVendorTasksContext는 ctx를 받는 ProjectVendorTasks이다.
+func ProjectVendorTasksContext(ctx context.Context, db *sql.DB, prj, vendor string) ([]*VendorTask, error) {
+	return queryVendorTasks(ctx, db, "vendor_tasks.project=$1 AND ($2 = '' OR vendor_tasks.vendor=$2)", prj, vendor)
+}
+
+// VendorWorkload는 한 프로젝트에서 외주 업체가 맡은 작업량의 요약이다.
+type VendorWorkload struct {
+	Vendor string
+	// Tasks는 배정된 태스크 수, Open은 그 중 끝나지 않은 태스크 수이다.
+	Tasks int
+	Open  int
+	// Overdue는 끝나지 않은 채 업체 마감일이 지난 태스크 수이다.
+	Overdue int
+	// Returned는 업체에서 한번이라도 버전을 받은 태스크 수이다.
+	Returned int
+	// Cost는 배정된 태스크 비용의 합이다.
+	Cost int64
+}
+
+// vendorWorkloads는 외주 태스크들을 업체별 작업량으로 요약해 업체 아이디 순서로 반환한다.
+func vendorWorkloads(ts []*VendorTask, now time.Time) []*VendorWorkload {
+	wm := make(map[string]*VendorWorkload)
+	for _, t := range ts {
+		w := wm[t.Vendor]
+		if w == nil {
+			w = &VendorWorkload{Vendor: t.Vendor}
+			wm[t.Vendor] = w
+		}
+		w.Tasks++
+		if t.IsOpen() {
+			w.Open++
+		}
+		if t.IsOverdue(now) {
+			w.Overdue++
+		}
+		if t.ReturnedVersion > 0 {
+			w.Returned++
+		}
+		w.Cost += t.Cost
+	}
+	ws := make([]*VendorWorkload, 0, len(wm))
+	for _, w := range wm {
+		ws = append(ws, w)
+	}
+	sort.Slice(ws, func(i, j int) bool {
+		return ws[i].Vendor < ws[j].Vendor
+	})
+	return ws
+}
+
+// ProjectVendorWorkloads는 프로젝트의 외주 업체별 작업량을 반환한다.
+// now는 마감일이 지났는지 판단하는 기준 시간이다.
+func ProjectVendorWorkloads(db *sql.DB, prj string, now time.Time) ([]*VendorWorkload, error) {
+	return ProjectVendorWorkloadsContext(context.Background(), db, prj, now)
+}
+
+// ProjectVendorWorkloadsContext는 ctx를 받는 ProjectVendorWorkloads이다.
+func ProjectVendorWorkloadsContext(ctx context.Context, db *sql.DB, prj string, now time.Time) ([]*VendorWorkload, error) {
+	ts, err := ProjectVendorTasksContext(ctx, db, prj, "")
+	if err != nil {
+		return nil, err
+	}
+	return vendorWorkloads(ts, now), nil
+}
+
+// DefaultVendorPackageNaming은 외주 패키지 파일 이름 템플릿이 정해지지 않았을 때 사용하는 템플릿이다.
+var DefaultVendorPackageNaming = "{shot}/plate/{file}{ext}"
+
+// PlanVendorPackage는 외주 업체에 배정되어 아직 끝나지 않은 태스크들의 플레이트 파일을
+// 업체에 보낼 패키지 항목으로 만들어 반환한다.
+// 플레이트 파일은 프로젝트의 플레이트 경로 템플릿으로 찾으며, 폴더 바로 아래의 파일들만 포함한다.
+// 항목의 버전은 0이다.
+func PlanVendorPackage(db *sql.DB, prj, vendor, naming string) ([]*DeliveryItem, error) {
+	return PlanVendorPackageContext(context.Background(), db, prj, vendor, naming)
+}
+
+// PlanVendorPackageContext는 ctx를 받는 PlanVendorPackage이다.
+func PlanVendorPackageContext(ctx context.Context, db *sql.DB, prj, vendor, naming string) ([]*DeliveryItem, error) {
+	if err := checkDeliveryNaming(naming); err != nil {
+		return nil, err
+	}
+	ts, err := ProjectVendorTasksContext(ctx, db, prj, vendor)
+	if err != nil {
+		return nil, err
+	}
+	items := make([]*DeliveryItem, 0)
+	dsts := make(map[string]string)
+	plates := make(map[string][]string)
+	for _, t := range ts {
+		if !t.IsOpen() {
+			continue
+		}
+		srcs, ok := plates[t.Shot]
+		if !ok {
+			dir, err := ResolvePathContext(ctx, db, PathPlate, prj, t.Shot, "", 0)
+			if err != nil {
+				return nil, err
+			}
+			fis, err := ioutil.ReadDir(dir)
+			if err != nil {
+				return nil, fmt.Errorf("could not read plate directory of %s: %w", t.Shot, err)
+			}
+			srcs = make([]string, 0, len(fis))
+			for _, fi := range fis {
+				if fi.IsDir() || strings.HasPrefix(fi.Name(), ".") {
+					continue
+				}
+				srcs = append(srcs, filepath.Join(dir, fi.Name()))
+			}
+			plates[t.Shot] = srcs
+		}
+		for _, src := range srcs {
+			base := filepath.Base(src)
+			f := deliveryFile{Src: src, Base: strings.TrimSuffix(base, filepath.Ext(base))}
+			dst, err := deliveryFileName(naming, PathTokens{Project: prj, Shot: t.Shot, Task: t.Task}, f)
+			if err != nil {
+				return nil, err
+			}
+			if s, ok := dsts[dst]; ok {
+				if s == src {
+					// 같은 샷의 여러 태스크가 배정되었다면 플레이트는 한번만 보낸다.
+					continue
+				}
+				return nil, errorf(ErrConflict, "vendor package file name conflicts: %s and %s are both named %s", s, src, dst)
+			}
+			dsts[dst] = src
+			items = append(items, &DeliveryItem{Shot: t.Shot, Task: t.Task, Src: src, Dst: dst})
+		}
+	}
+	return items, nil
+}
+
+// markVendorTasksSent는 외주 패키지에 포함된 샷들에서 업체에 배정된 태스크들의 패키지 보낸 시간을 기록한다.
+// 플레이트는 샷마다 한번만 보내므로 태스크가 아닌 샷 단위로 기록한다.
+func markVendorTasksSent(ctx context.Context, tx *sql.Tx, prj, vendor string, items []*DeliveryItem, sent time.Time) error {
+	done := make(map[string]bool)
+	for _, it := range items {
+		if done[it.Shot] {
+			continue
+		}
+		done[it.Shot] = true
+		if _, err := dbExec(ctx, tx, "UPDATE vendor_tasks SET sent=$1 WHERE project=$2 AND shot=$3 AND vendor=$4", sent, prj, it.Shot, vendor); err != nil {
+			return fmt.Errorf("could not update vendor task: %w", err)
+		}
+	}
+	return nil
+}
+
+// IngestVendorReturn은 외주 업체에서 받은 폴더의 파일들을 버전으로 등록하고, 등록된 항목을 반환한다.
+// 파일 이름 규칙과 처리 방법은 Ingest와 같지만, 해당 업체에 배정된 태스크의 파일만 등록하며
+// 나머지는 격리 목록에 기록한다. 등록된 버전은 외주 태스크의 마지막으로 받은 버전으로 기록된다.
+func IngestVendorReturn(db *sql.DB, prj, vendor, dir string) ([]*IngestItem, error) {
+	return IngestVendorReturnContext(context.Background(), db, prj, vendor, dir)
+}
+
+// IngestVendorReturnContext는 ctx를 받는 IngestVendorReturn이다.
+func IngestVendorReturnContext(ctx context.Context, db *sql.DB, prj, vendor, dir string) ([]*IngestItem, error) {
+	if vendor == "" {
+		return nil, errorf(ErrInvalid, "vendor not specified")
+	}
+	return ingestDir(ctx, db, prj, dir, 0, vendor)
+}
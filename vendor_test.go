@@ -0,0 +1,168 @@
+package roi
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+var testVendor = &Vendor{
+	Vendor:  "outsource_a",
+	Name:    "아웃소스 A",
+	Contact: "a@outsource.com",
+	Notes:   "합성 전문",
+}
+
+func TestIsValidVendor(t *testing.T) {
+	cases := []struct {
+		id   string
+		want bool
+	}{
+		{"outsource_a", true},
+		{"vendor-2", true},
+		{"A", true},
+		{"", false},
+		{"2vendor", false},
+		{"out source", false},
+		{"out.source", false},
+	}
+	for _, c := range cases {
+		got := IsValidVendor(c.id)
+		if got != c.want {
+			t.Fatalf("IsValidVendor(%q): got %v, want %v", c.id, got, c.want)
+		}
+	}
+}
+
+func TestVendorWorkloads(t *testing.T) {
+	now := time.Date(2020, 10, 19, 0, 0, 0, 0, time.UTC)
+	yesterday := now.AddDate(0, 0, -1)
+	tomorrow := now.AddDate(0, 0, 1)
+	ts := []*VendorTask{
+		{Vendor: "b", Shot: "CG_0010", Task: "comp", DueDate: yesterday, Cost: 100, Status: TaskInProgress},
+		{Vendor: "a", Shot: "CG_0010", Task: "fx", DueDate: yesterday, Cost: 50, Status: TaskDone, ReturnedVersion: 2},
+		{Vendor: "a", Shot: "CG_0020", Task: "fx", DueDate: tomorrow, Cost: 70, Status: TaskInProgress, ReturnedVersion: 1},
+		{Vendor: "a", Shot: "CG_0030", Task: "fx", Cost: 30, Status: TaskNotSet},
+	}
+	got := vendorWorkloads(ts, now)
+	want := []*VendorWorkload{
+		{Vendor: "a", Tasks: 3, Open: 2, Overdue: 0, Returned: 2, Cost: 150},
+		{Vendor: "b", Tasks: 1, Open: 1, Overdue: 1, Returned: 0, Cost: 100},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("vendorWorkloads: got %v, want %v", got, want)
+	}
+}
+
+func TestVendor(t *testing.T) {
+	db, err := testDB()
+	if err != nil {
+		t.Fatalf("could not connect to database: %v", err)
+	}
+	dir, err := ioutil.TempDir("", "roi-vendor-")
+	if err != nil {
+		t.Fatalf("could not create temp dir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	err = AddVendor(db, testVendor)
+	if err != nil {
+		t.Fatalf("could not add vendor: %v", err)
+	}
+	got, err := GetVendor(db, testVendor.Vendor)
+	if err != nil {
+		t.Fatalf("could not get vendor: %v", err)
+	}
+	if !reflect.DeepEqual(got, testVendor) {
+		t.Fatalf("got: %v, want: %v", got, testVendor)
+	}
+	err = UpdateVendor(db, testVendor.Vendor, UpdateVendorParam{Name: "Outsource A", Contact: testVendor.Contact})
+	if err != nil {
+		t.Fatalf("could not update vendor: %v", err)
+	}
+	got, err = GetVendor(db, testVendor.Vendor)
+	if err != nil {
+		t.Fatalf("could not get vendor: %v", err)
+	}
+	if got.Name != "Outsource A" || got.Notes != "" {
+		t.Fatalf("vendor not updated: %v", got)
+	}
+
+	err = AddProject(db, testProject)
+	if err != nil {
+		t.Fatalf("could not add project: %v", err)
+	}
+	err = AddShot(db, testProject.Project, testShotA)
+	if err != nil {
+		t.Fatalf("could not add shot: %v", err)
+	}
+	err = AddTask(db, testProject.Project, testShotA.Shot, testTaskA)
+	if err != nil {
+		t.Fatalf("could not add task: %v", err)
+	}
+	vt := &VendorTask{
+		Project: testProject.Project,
+		Shot:    testShotA.Shot,
+		Task:    testTaskA.Task,
+		Vendor:  testVendor.Vendor,
+		Artist:  "john",
+		DueDate: time.Now().AddDate(0, 0, -1),
+		Cost:    1000,
+	}
+	err = AssignVendorTask(db, vt)
+	if err != nil {
+		t.Fatalf("could not assign vendor task: %v", err)
+	}
+	err = DeleteVendor(db, testVendor.Vendor)
+	if err == nil {
+		t.Fatalf("vendor with assigned tasks should not be deleted")
+	}
+	ws, err := ProjectVendorWorkloads(db, testProject.Project, time.Now())
+	if err != nil {
+		t.Fatalf("could not get vendor workloads: %v", err)
+	}
+	want := []*VendorWorkload{{Vendor: testVendor.Vendor, Tasks: 1, Open: 1, Overdue: 1, Cost: 1000}}
+	if !reflect.DeepEqual(ws, want) {
+		t.Fatalf("vendor workloads: got %v, want %v", ws, want)
+	}
+
+	// 업체에서 받은 폴더에는 배정된 태스크의 파일과 배정되지 않은 태스크의 파일이 섞여 있을 수 있다.
+	for _, f := range []string{
+		testShotA.Shot + "_" + testTaskA.Task + "_v001.mov",
+		testShotA.Shot + "_lit_v001.mov",
+	} {
+		if err := ioutil.WriteFile(filepath.Join(dir, f), []byte{}, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	items, err := IngestVendorReturn(db, testProject.Project, testVendor.Vendor, dir)
+	if err != nil {
+		t.Fatalf("could not ingest vendor return: %v", err)
+	}
+	if len(items) != 1 || items[0].Task != testTaskA.Task {
+		t.Fatalf("unexpected ingested items: %v", items)
+	}
+	rt, err := GetVendorTask(db, testProject.Project, testShotA.Shot, testTaskA.Task)
+	if err != nil {
+		t.Fatalf("could not get vendor task: %v", err)
+	}
+	if rt == nil || rt.ReturnedVersion != 1 || rt.Returned.IsZero() {
+		t.Fatalf("returned version not recorded: %v", rt)
+	}
+
+	err = UnassignVendorTask(db, testProject.Project, testShotA.Shot, testTaskA.Task)
+	if err != nil {
+		t.Fatalf("could not unassign vendor task: %v", err)
+	}
+	err = DeleteVendor(db, testVendor.Vendor)
+	if err != nil {
+		t.Fatalf("could not delete vendor: %v", err)
+	}
+	err = DeleteProject(db, testProject.Project)
+	if err != nil {
+		t.Fatalf("could not delete project: %v", err)
+	}
+}
@@ -1,6 +1,7 @@
 package roi
 
 import (
+	"context"
 	"database/sql"
 	"fmt"
 	"strings"
@@ -51,6 +52,14 @@ var VersionTableKeys = []string{
 
 var VersionTableIndices = dbIndices(VersionTableKeys)
 
+// validate는 버전의 필드들이 적절한지 검사한다.
+func (v *Version) validate() error {
+	vd := &validator{}
+	vd.checkPaths("output_files", v.OutputFiles)
+	vd.checkPaths("images", v.Images)
+	return vd.err()
+}
+
 func (v *Version) dbValues() []interface{} {
 	if v == nil {
 		v = &Version{}
@@ -75,33 +84,81 @@ func (v *Version) dbValues() []interface{} {
 }
 
 // AddVersion은 db의 특정 프로젝트, 특정 샷에 태스크를 추가한다.
+// 버전의 결과물과 이미지 파일의 정보도 같은 트랜잭션 안에서 기록한다.
 func AddVersion(db *sql.DB, prj, shot, task string, v *Version) error {
+	return AddVersionContext(context.Background(), db, prj, shot, task, v)
+}
+
+// AddVersionContext는 ctx를 받는 AddVersion이다.
+func AddVersionContext(ctx context.Context, db *sql.DB, prj, shot, task string, v *Version) error {
+	return AddExpectedVersionContext(ctx, db, prj, shot, task, 0, v)
+}
+
+// AddExpectedVersion은 AddVersion과 같지만, 추가될 버전 번호가 expected가 아니면
+// 버전을 추가하지 않고 에러를 반환한다. expected가 0이면 검사하지 않는다.
+// 미리 NextVersion으로 버전 번호를 얻어 파일을 준비한 뒤 버전을 추가할 때,
+// 그 사이에 다른 버전이 추가되는 것을 막기 위해 사용한다.
+func AddExpectedVersion(db *sql.DB, prj, shot, task string, expected int, v *Version) error {
+	return AddExpectedVersionContext(context.Background(), db, prj, shot, task, expected, v)
+}
+
+// AddExpectedVersionContext는 ctx를 받는 AddExpectedVersion이다.
+func AddExpectedVersionContext(ctx context.Context, db *sql.DB, prj, shot, task string, expected int, v *Version) error {
+	return addVersion(ctx, db, prj, shot, task, expected, v, nil)
+}
+
+// AddVerifiedVersion은 AddExpectedVersion과 같지만, 서버에서 읽은 버전 파일의 해시가
+// checksums와 다르면 버전을 추가하지 않고 에러를 반환한다.
+// checksums는 버전에 등록될 파일 경로별로 FileChecksum이 반환하는 형식의 해시를 담는다.
+// 버전을 등록하는 곳에서 계산한 해시를 넘겨, 서버가 같은 파일을 보고 있는지 확인하는데 사용한다.
+func AddVerifiedVersion(db *sql.DB, prj, shot, task string, expected int, v *Version, checksums map[string]string) error {
+	return AddVerifiedVersionContext(context.Background(), db, prj, shot, task, expected, v, checksums)
+}
+
+// AddVerifiedVersionContext는 ctx를 받는 AddVerifiedVersion이다.
+func AddVerifiedVersionContext(ctx context.Context, db *sql.DB, prj, shot, task string, expected int, v *Version, checksums map[string]string) error {
+	return addVersion(ctx, db, prj, shot, task, expected, v, checksums)
+}
+
+// addVersion은 버전을 추가한다. checksums가 nil이 아니면 버전 파일의 해시를 확인한다.
+func addVersion(ctx context.Context, db *sql.DB, prj, shot, task string, expected int, v *Version, checksums map[string]string) error {
 	if prj == "" {
-		return fmt.Errorf("project not specified")
+		return errorf(ErrInvalid, "project not specified")
 	}
 	if shot == "" {
-		return fmt.Errorf("shot not specified")
+		return errorf(ErrInvalid, "shot not specified")
 	}
 	if task == "" {
-		return fmt.Errorf("task not specified")
+		return errorf(ErrInvalid, "task not specified")
 	}
 	if v == nil {
-		return fmt.Errorf("nil output")
+		return errorf(ErrInvalid, "nil output")
 	}
 	if v.Version != 0 {
 		// 버전은 DB 확인 후 추가된다.
-		return fmt.Errorf("version num should not be specified when adding")
+		return errorf(ErrInvalid, "version num should not be specified when adding")
 	}
-	tx, err := db.Begin()
+	if err := v.validate(); err != nil {
+		return err
+	}
+	files, err := statVersionFiles(v, versionFilePaths(v))
 	if err != nil {
-		return fmt.Errorf("could not begin a transaction: %v", err)
+		return err
+	}
+	if err := verifyChecksums(v, files, checksums); err != nil {
+		return err
+	}
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("could not begin a transaction: %w", err)
 	}
 	defer tx.Rollback() // 트랜잭션이 완료되지 않았을 때만 실행됨
-	stmt := fmt.Sprintf("SELECT last_output_version FROM tasks WHERE project='%s' AND shot='%s' AND task='%s'", prj, shot, task)
-	rows, err := tx.Query(stmt)
+	q := selectQuery("tasks", "last_output_version").where("project", prj).where("shot", shot).where("task", task)
+	rows, err := q.query(ctx, tx)
 	if err != nil {
-		return fmt.Errorf("could not get last version num of task: %v", err)
+		return fmt.Errorf("could not get last version num of task: %w", err)
 	}
+	defer rows.Close()
 	exist := rows.Next()
 	if rows.Err() != nil {
 		return fmt.Errorf("rows.Next error: %v", rows.Err())
@@ -110,27 +167,54 @@ func AddVersion(db *sql.DB, prj, shot, task string, v *Version) error {
 	if exist {
 		err := rows.Scan(&lastv)
 		if err != nil {
-			return fmt.Errorf("rows.Scan error: %v", err)
+			return fmt.Errorf("rows.Scan error: %w", err)
 		}
 	}
 	rows.Close()
+	if expected != 0 && expected != lastv+1 {
+		return errorf(ErrConflict, "next version of task is v%03d, not v%03d", lastv+1, expected)
+	}
 	v.Version = lastv + 1
-	keystr := strings.Join(VersionTableKeys, ", ")
-	idxstr := strings.Join(VersionTableIndices, ", ")
-	stmt = fmt.Sprintf("INSERT INTO versions (%s) VALUES (%s)", keystr, idxstr)
-	if _, err := tx.Exec(stmt, v.dbValues()...); err != nil {
-		return fmt.Errorf("could not insert versions: %v", err)
+	if _, err := insertQuery("versions", VersionTableKeys, v.dbValues()).exec(ctx, tx); err != nil {
+		return fmt.Errorf("could not insert versions: %w", err)
+	}
+	if _, err := dbExec(ctx, tx, "UPDATE tasks SET status=$1, last_output_version=$2 WHERE project=$3 AND shot=$4 AND task=$5", TaskInProgress, v.Version, prj, shot, task); err != nil {
+		return fmt.Errorf("could not update last version num of task: %w", err)
+	}
+	for _, f := range files {
+		f.Version = v.Version
 	}
-	if _, err := tx.Exec("UPDATE tasks SET status=$1, last_output_version=$2 WHERE project=$3 AND shot=$4 AND task=$5", TaskInProgress, v.Version, prj, shot, task); err != nil {
-		return fmt.Errorf("could not update last version num of task: %v", err)
+	if err := insertVersionFiles(ctx, tx, files); err != nil {
+		return err
+	}
+	target := versionSearchTarget(shot, task, v.Version)
+	if err := indexSearchWords(ctx, tx, prj, SearchVersion, target, versionSearchFields(v.OutputFiles, v.Images, v.Mov, v.WorkFile)); err != nil {
+		return err
 	}
 	err = tx.Commit()
 	if err != nil {
-		return fmt.Errorf("could not commit the transaction: %v", err)
+		return fmt.Errorf("could not commit the transaction: %w", err)
 	}
 	return nil
 }
 
+// NextVersion은 해당 태스크에 다음으로 추가될 버전 번호를 반환한다.
+func NextVersion(db *sql.DB, prj, shot, task string) (int, error) {
+	return NextVersionContext(context.Background(), db, prj, shot, task)
+}
+
+// NextVersionContext는 ctx를 받는 NextVersion이다.
+func NextVersionContext(ctx context.Context, db *sql.DB, prj, shot, task string) (int, error) {
+	t, err := GetTaskContext(ctx, db, prj, shot, task)
+	if err != nil {
+		return 0, err
+	}
+	if t == nil {
+		return 0, errorf(ErrNotFound, "task not exist: %s.%s.%s", prj, shot, task)
+	}
+	return t.LastOutputVersion + 1, nil
+}
+
 // UpdateVersionParam은 Version에서 일반적으로 업데이트 되어야 하는 멤버의 모음이다.
 // UpdateVersion에서 사용한다.
 type UpdateVersionParam struct {
@@ -141,6 +225,14 @@ type UpdateVersionParam struct {
 	Created     time.Time
 }
 
+// validate는 업데이트할 필드들이 적절한지 검사한다.
+func (u UpdateVersionParam) validate() error {
+	v := &validator{}
+	v.checkPaths("output_files", u.OutputFiles)
+	v.checkPaths("images", u.Images)
+	return v.err()
+}
+
 func (u UpdateVersionParam) keys() []string {
 	return []string{
 		"output_files",
@@ -151,10 +243,6 @@ func (u UpdateVersionParam) keys() []string {
 	}
 }
 
-func (u UpdateVersionParam) indices() []string {
-	return dbIndices(u.keys())
-}
-
 func (u UpdateVersionParam) values() []interface{} {
 	if u.OutputFiles == nil {
 		u.OutputFiles = make([]string, 0)
@@ -172,40 +260,97 @@ func (u UpdateVersionParam) values() []interface{} {
 }
 
 // UpdateVersion은 db의 특정 태스크를 업데이트 한다.
+// 새로 등록된 경로의 파일 정보를 기록하며, 이미 기록된 파일의 정보는 바꾸지 않는다.
 func UpdateVersion(db *sql.DB, prj, shot, task string, version int, upd UpdateVersionParam) error {
+	return UpdateVersionContext(context.Background(), db, prj, shot, task, version, upd)
+}
+
+// UpdateVersionContext는 ctx를 받는 UpdateVersion이다.
+func UpdateVersionContext(ctx context.Context, db *sql.DB, prj, shot, task string, version int, upd UpdateVersionParam) error {
 	if prj == "" {
-		return fmt.Errorf("project not specified")
+		return errorf(ErrInvalid, "project not specified")
 	}
 	if shot == "" {
-		return fmt.Errorf("shot not specified")
+		return errorf(ErrInvalid, "shot not specified")
 	}
 	if task == "" {
-		return fmt.Errorf("task name not specified")
+		return errorf(ErrInvalid, "task name not specified")
 	}
 	if version == 0 {
 		// 버전 0은 존재하지 않는다.
-		return fmt.Errorf("version num not specified")
+		return errorf(ErrInvalid, "version num not specified")
 	}
-	keystr := strings.Join(upd.keys(), ", ")
-	idxstr := strings.Join(upd.indices(), ", ")
-	stmt := fmt.Sprintf("UPDATE versions SET (%s) = (%s) WHERE project='%s' AND shot='%s' AND task='%s' AND version='%d'", keystr, idxstr, prj, shot, task, version)
-	if _, err := db.Exec(stmt, upd.values()...); err != nil {
+	if err := upd.validate(); err != nil {
 		return err
 	}
-	return nil
+	// 이미 기록된 파일은 기록 당시의 정보를 유지해야 수정된 파일을 찾을 수 있다.
+	// 새로 등록된 경로의 파일만 기록하고, 빠진 경로의 기록은 지운다.
+	recorded, err := VersionFilesContext(ctx, db, prj, shot, task, version)
+	if err != nil {
+		return err
+	}
+	isRecorded := make(map[string]bool)
+	for _, f := range recorded {
+		isRecorded[f.Path] = true
+	}
+	nv := &Version{Project: prj, Shot: shot, Task: task, Version: version, OutputFiles: upd.OutputFiles, Images: upd.Images}
+	pths := versionFilePaths(nv)
+	inVersion := make(map[string]bool)
+	added := make([]string, 0)
+	for _, pth := range pths {
+		inVersion[pth] = true
+		if !isRecorded[pth] {
+			added = append(added, pth)
+		}
+	}
+	files, err := statVersionFiles(nv, added)
+	if err != nil {
+		return err
+	}
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("could not begin a transaction: %w", err)
+	}
+	defer tx.Rollback() // 트랜잭션이 완료되지 않았을 때만 실행됨
+	q := updateQuery("versions", upd.keys(), upd.values()).where("project", prj).where("shot", shot).where("task", task).where("version", version)
+	if _, err := q.exec(ctx, tx); err != nil {
+		return err
+	}
+	for _, f := range recorded {
+		if inVersion[f.Path] {
+			continue
+		}
+		if _, err := deleteQuery("version_files").where("project", prj).where("shot", shot).where("task", task).where("version", version).where("path", f.Path).exec(ctx, tx); err != nil {
+			return fmt.Errorf("could not delete data from 'version_files' table: %w", err)
+		}
+	}
+	if err := insertVersionFiles(ctx, tx, files); err != nil {
+		return err
+	}
+	target := versionSearchTarget(shot, task, version)
+	if err := indexSearchWords(ctx, tx, prj, SearchVersion, target, versionSearchFields(upd.OutputFiles, upd.Images, upd.Mov, upd.WorkFile)); err != nil {
+		return err
+	}
+	return tx.Commit()
 }
 
 // VersionExist는 db에 해당 태스크가 존재하는지를 검사한다.
 func VersionExist(db *sql.DB, prj, shot, task string, version int) (bool, error) {
+	return VersionExistContext(context.Background(), db, prj, shot, task, version)
+}
+
+// VersionExistContext는 ctx를 받는 VersionExist이다.
+func VersionExistContext(ctx context.Context, db *sql.DB, prj, shot, task string, version int) (bool, error) {
 	if version == 0 {
 		// 버전 0은 존재하지 않는다.
-		return false, fmt.Errorf("output version not specified")
+		return false, errorf(ErrInvalid, "output version not specified")
 	}
 	stmt := "SELECT version FROM versions WHERE project=$1 AND shot=$2 AND task=$3 AND version=$4 LIMIT 1"
-	rows, err := db.Query(stmt, prj, shot, task, version)
+	rows, err := dbQuery(ctx, db, stmt, prj, shot, task, version)
 	if err != nil {
 		return false, err
 	}
+	defer rows.Close()
 	return rows.Next(), nil
 }
 
@@ -225,12 +370,18 @@ func versionFromRows(rows *sql.Rows) (*Version, error) {
 // GetVersion은 db의 특정 태스크의 해당 아웃풋을 찾는다.
 // 만일 그 버전의 아웃풋이 없다면 nil이 반환된다.
 func GetVersion(db *sql.DB, prj, shot, task string, version int) (*Version, error) {
+	return GetVersionContext(context.Background(), db, prj, shot, task, version)
+}
+
+// GetVersionContext는 ctx를 받는 GetVersion이다.
+func GetVersionContext(ctx context.Context, db *sql.DB, prj, shot, task string, version int) (*Version, error) {
 	keystr := strings.Join(VersionTableKeys, ", ")
 	stmt := fmt.Sprintf("SELECT %s FROM versions WHERE project=$1 AND shot=$2 AND task=$3 AND version=$4 LIMIT 1", keystr)
-	rows, err := db.Query(stmt, prj, shot, task, version)
+	rows, err := dbQuery(ctx, db, stmt, prj, shot, task, version)
 	if err != nil {
 		return nil, err
 	}
+	defer rows.Close()
 	ok := rows.Next()
 	if !ok {
 		return nil, nil
@@ -240,12 +391,18 @@ func GetVersion(db *sql.DB, prj, shot, task string, version int) (*Version, erro
 
 // TaskVersions는 db에서 특정 태스크의 버전 전체를 검색해 반환한다.
 func TaskVersions(db *sql.DB, prj, shot, task string) ([]*Version, error) {
+	return TaskVersionsContext(context.Background(), db, prj, shot, task)
+}
+
+// TaskVersionsContext는 ctx를 받는 TaskVersions이다.
+func TaskVersionsContext(ctx context.Context, db *sql.DB, prj, shot, task string) ([]*Version, error) {
 	keystr := strings.Join(VersionTableKeys, ", ")
 	stmt := fmt.Sprintf("SELECT %s FROM versions WHERE project=$1 AND shot=$2 AND task=$3", keystr)
-	rows, err := db.Query(stmt, prj, shot, task)
+	rows, err := dbQuery(ctx, db, stmt, prj, shot, task)
 	if err != nil {
 		return nil, err
 	}
+	defer rows.Close()
 	versions := make([]*Version, 0)
 	for rows.Next() {
 		v, err := versionFromRows(rows)
@@ -259,12 +416,18 @@ func TaskVersions(db *sql.DB, prj, shot, task string) ([]*Version, error) {
 
 // ShotVersions는 db에서 특정 샷의 버전 전체를 검색해 반환한다.
 func ShotVersions(db *sql.DB, prj, shot string) ([]*Version, error) {
+	return ShotVersionsContext(context.Background(), db, prj, shot)
+}
+
+// ShotVersionsContext는 ctx를 받는 ShotVersions이다.
+func ShotVersionsContext(ctx context.Context, db *sql.DB, prj, shot string) ([]*Version, error) {
 	keystr := strings.Join(VersionTableKeys, ", ")
 	stmt := fmt.Sprintf("SELECT %s FROM versions WHERE project=$1 AND shot=$2", keystr)
-	rows, err := db.Query(stmt, prj, shot)
+	rows, err := dbQuery(ctx, db, stmt, prj, shot)
 	if err != nil {
 		return nil, err
 	}
+	defer rows.Close()
 	versions := make([]*Version, 0)
 	for rows.Next() {
 		v, err := versionFromRows(rows)
@@ -279,14 +442,42 @@ func ShotVersions(db *sql.DB, prj, shot string) ([]*Version, error) {
 // DeleteVersion은 해당 버전과 그 하위의 모든 데이터를 db에서 지운다.
 // 해당 버전이 없어도 에러를 내지 않기 때문에 검사를 원한다면 VersionExist를 사용해야 한다.
 // 만일 처리 중간에 에러가 나면 아무 데이터도 지우지 않고 에러를 반환한다.
+//
+// 사용자가 지우는 버전은 휴지통에서 되살릴 수 있도록 TrashVersion으로 지워야 한다.
 func DeleteVersion(db *sql.DB, prj, shot, task string, version int) error {
-	tx, err := db.Begin()
+	return DeleteVersionContext(context.Background(), db, prj, shot, task, version)
+}
+
+// DeleteVersionContext는 ctx를 받는 DeleteVersion이다.
+func DeleteVersionContext(ctx context.Context, db *sql.DB, prj, shot, task string, version int) error {
+	tx, err := db.BeginTx(ctx, nil)
 	if err != nil {
-		return fmt.Errorf("could not begin a transaction: %v", err)
+		return fmt.Errorf("could not begin a transaction: %w", err)
 	}
 	defer tx.Rollback() // 트랜잭션이 완료되지 않았을 때만 실행됨
-	if _, err := tx.Exec("DELETE FROM versions WHERE project=$1 AND shot=$2 AND task=$3 AND version=$4", prj, shot, task, version); err != nil {
-		return fmt.Errorf("could not delete data from 'versions' table: %v", err)
+	if err := deleteVersion(ctx, tx, prj, shot, task, version); err != nil {
+		return err
 	}
 	return tx.Commit()
 }
+
+// deleteVersion은 트랜잭션 안에서 해당 버전과 그 하위의 모든 데이터를 지운다.
+func deleteVersion(ctx context.Context, tx *sql.Tx, prj, shot, task string, version int) error {
+	if _, err := dbExec(ctx, tx, "DELETE FROM version_files WHERE project=$1 AND shot=$2 AND task=$3 AND version=$4", prj, shot, task, version); err != nil {
+		return fmt.Errorf("could not delete data from 'version_files' table: %w", err)
+	}
+	if _, err := dbExec(ctx, tx, "DELETE FROM versions WHERE project=$1 AND shot=$2 AND task=$3 AND version=$4", prj, shot, task, version); err != nil {
+		return fmt.Errorf("could not delete data from 'versions' table: %w", err)
+	}
+	target := versionSearchTarget(shot, task, version)
+	if err := unindexSearchWords(ctx, tx, prj, SearchVersion, target); err != nil {
+		return err
+	}
+	if err := unindexSearchWordsWithPrefix(ctx, tx, prj, SearchReview, target+"."); err != nil {
+		return err
+	}
+	if err := deleteReviewsWithPrefix(ctx, tx, prj, target+"."); err != nil {
+		return err
+	}
+	return nil
+}
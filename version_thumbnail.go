@@ -0,0 +1,130 @@
+package roi
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// VersionThumbnailSize는 버전 썸네일의 크기이다. 버전 이미지의 비율은 유지된다.
+var VersionThumbnailSize = ThumbnailSize{Name: "version", Width: 480, Height: 270, Crop: false}
+
+// VersionThumbnail은 버전 이미지 중 하나로 만든 썸네일이다.
+type VersionThumbnail struct {
+	// Name은 썸네일이 버전 이미지의 어느 위치에서 만들어졌는지를 나타낸다.
+	// first, middle, last 중 하나이다.
+	Name string
+	// Source는 썸네일을 만든 원본 이미지 경로이다.
+	Source string
+	// File은 roi 안에 저장된 썸네일 파일 경로이다.
+	File string
+	// URLPath는 /version-thumbnail/ 아래에서 썸네일을 찾을 수 있는 경로이다.
+	URLPath string
+}
+
+// versionThumbnailDir은 특정 버전의 썸네일이 저장되는 디렉토리이다.
+func versionThumbnailDir(prj, shot, task string, version int) string {
+	return filepath.Join(UserDataDir, "version-thumbnail", prj, shot, task, fmt.Sprintf("v%03d", version))
+}
+
+// versionThumbnailSources는 버전 이미지 중 썸네일을 만들 이미지를 고른다.
+// 처음, 가운데, 마지막 이미지를 고르며, 이미지가 적으면 겹치는 것은 제외한다.
+func versionThumbnailSources(images []string) []VersionThumbnail {
+	n := len(images)
+	if n == 0 {
+		return []VersionThumbnail{}
+	}
+	ths := []VersionThumbnail{{Name: "first", Source: images[0]}}
+	if n >= 3 {
+		ths = append(ths, VersionThumbnail{Name: "middle", Source: images[n/2]})
+	}
+	if n >= 2 {
+		ths = append(ths, VersionThumbnail{Name: "last", Source: images[n-1]})
+	}
+	return ths
+}
+
+// VersionThumbnails는 버전의 첫번째, 가운데, 마지막 이미지로 만든 썸네일을 반환한다.
+// 이미지 시퀀스 경로는 디스크 상의 프레임들로 펼친 뒤 고른다.
+// 썸네일은 roi 안에 캐시되며, 없거나 원본 이미지가 더 최근에 수정되었다면 새로 만든다.
+// 원본 이미지를 찾을 수 없을 때는 캐시된 썸네일이 있으면 그것을 사용하고,
+// 없으면 해당 썸네일을 결과에서 제외한다.
+// 원본 이미지가 StorageRoots 밖에 있거나 읽을 수 없는 등의 이유로 만들지 못한 썸네일도 결과에서 제외되며,
+// 이때는 만들 수 있었던 썸네일들과 함께 처음 난 에러를 반환한다.
+func VersionThumbnails(v *Version) ([]VersionThumbnail, error) {
+	if v == nil {
+		return nil, errorf(ErrInvalid, "nil version")
+	}
+	ths := make([]VersionThumbnail, 0, 3)
+	var firstErr error
+	for _, th := range versionThumbnailSources(expandImages(v.Images)) {
+		ok, err := makeVersionThumbnail(v, &th)
+		if err != nil {
+			if firstErr == nil {
+				firstErr = err
+			}
+			continue
+		}
+		if ok {
+			ths = append(ths, th)
+		}
+	}
+	return ths, firstErr
+}
+
+// makeVersionThumbnail은 th의 원본 이미지로 버전 썸네일을 만들고 th의 File과 URLPath를 채운다.
+// 원본 이미지가 캐시된 썸네일보다 최근에 수정되지 않았다면 캐시된 썸네일을 사용한다.
+// 원본 이미지와 캐시된 썸네일이 모두 없다면 false를 반환한다.
+// 원본 이미지가 StorageRoots 아래에 있지 않다면 읽지 않고 에러를 반환한다.
+func makeVersionThumbnail(v *Version, th *VersionThumbnail) (bool, error) {
+	dir := versionThumbnailDir(v.Project, v.Shot, v.Task, v.Version)
+	th.File = filepath.Join(dir, th.Name+".png")
+	th.URLPath = fmt.Sprintf("%s/%s/%s/v%03d/%s.png", v.Project, v.Shot, v.Task, v.Version, th.Name)
+	cached, cerr := os.Stat(th.File)
+	// 버전 이미지 경로는 사용자가 입력한 것이므로 StorageRoots 밖의 파일을 읽거나
+	// 외부 변환 명령에 넘기지 않도록 먼저 검사한다.
+	srcf, err := ResolveMediaPath(th.Source)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return cerr == nil, nil
+		}
+		return false, fmt.Errorf("could not use version image %s: %w", th.Source, err)
+	}
+	src, serr := os.Stat(srcf)
+	if serr != nil {
+		return cerr == nil, nil
+	}
+	if cerr == nil && !src.ModTime().After(cached.ModTime()) {
+		return true, nil
+	}
+	img, err := decodeThumbnailSource(srcf)
+	if err != nil {
+		return false, fmt.Errorf("could not read version image %s: %w", th.Source, err)
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return false, err
+	}
+	if err := writePNG(th.File, fitImage(img, VersionThumbnailSize)); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// VersionThumbnailURLPath는 이미 만들어진 버전 썸네일 중 버전을 대표하는 썸네일의
+// /version-thumbnail/ 아래 경로를 반환한다. 썸네일이 없다면 빈 문자열을 반환한다.
+// VersionThumbnails와 달리 썸네일을 새로 만들지 않기 때문에 목록 페이지에서 사용하기 좋다.
+func VersionThumbnailURLPath(prj, shot, task string, version int) string {
+	dir := versionThumbnailDir(prj, shot, task, version)
+	for _, name := range []string{"middle", "first", "last"} {
+		if _, err := os.Stat(filepath.Join(dir, name+".png")); err == nil {
+			return fmt.Sprintf("%s/%s/%s/v%03d/%s.png", prj, shot, task, version, name)
+		}
+	}
+	return ""
+}
+
+// DeleteVersionThumbnails는 버전의 캐시된 썸네일을 지운다.
+// 썸네일이 없어도 에러를 내지 않는다.
+func DeleteVersionThumbnails(prj, shot, task string, version int) error {
+	return os.RemoveAll(versionThumbnailDir(prj, shot, task, version))
+}
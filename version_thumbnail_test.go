@@ -0,0 +1,143 @@
+package roi
+
+import (
+	"image"
+	"image/png"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestShotSequence(t *testing.T) {
+	cases := map[string]string{
+		"CG_0010":        "CG",
+		"EP01_SC01_0010": "EP01_SC01",
+		"CG0010":         "",
+	}
+	for shot, want := range cases {
+		if got := ShotSequence(shot); got != want {
+			t.Fatalf("ShotSequence(%q): got %q, want %q", shot, got, want)
+		}
+	}
+}
+
+func TestVersionThumbnails(t *testing.T) {
+	tmpd, err := ioutil.TempDir("", "roi-version-thumbnail-test-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmpd)
+	orgDir := UserDataDir
+	UserDataDir = filepath.Join(tmpd, "roi-userdata")
+	defer func() { UserDataDir = orgDir }()
+	orgRoots := StorageRoots
+	StorageRoots = []string{tmpd}
+	defer func() { StorageRoots = orgRoots }()
+
+	images := make([]string, 0)
+	for _, name := range []string{"a.0001.png", "a.0002.png", "a.0003.png", "a.0004.png"} {
+		src := filepath.Join(tmpd, name)
+		f, err := os.Create(src)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := png.Encode(f, image.NewRGBA(image.Rect(0, 0, 1920, 1080))); err != nil {
+			t.Fatal(err)
+		}
+		f.Close()
+		images = append(images, src)
+	}
+	v := &Version{Project: "TEST", Shot: "CG_0010", Task: "fx", Version: 1, Images: images}
+	if VersionThumbnailURLPath("TEST", "CG_0010", "fx", 1) != "" {
+		t.Fatalf("version thumbnail should not exist yet")
+	}
+	ths, err := VersionThumbnails(v)
+	if err != nil {
+		t.Fatalf("could not make version thumbnails: %v", err)
+	}
+	if len(ths) != 3 {
+		t.Fatalf("invalid number of version thumbnails: want 3, got %d", len(ths))
+	}
+	if ths[1].Name != "middle" || ths[1].Source != images[2] {
+		t.Fatalf("unexpected middle thumbnail: %v", ths[1])
+	}
+	if got := VersionThumbnailURLPath("TEST", "CG_0010", "fx", 1); got != "TEST/CG_0010/fx/v001/middle.png" {
+		t.Fatalf("unexpected version thumbnail url path: %s", got)
+	}
+
+	// 원본 이미지가 없어도 캐시된 썸네일은 사용할 수 있어야 한다.
+	for _, img := range images {
+		os.Remove(img)
+	}
+	ths, err = VersionThumbnails(v)
+	if err != nil {
+		t.Fatalf("could not get cached version thumbnails: %v", err)
+	}
+	if len(ths) != 3 {
+		t.Fatalf("invalid number of cached version thumbnails: want 3, got %d", len(ths))
+	}
+
+	c := &ContactSheet{
+		Project: "TEST",
+		Tasks:   []string{"fx", "comp"},
+		Rows: []*ContactSheetRow{
+			{Shot: "CG_0010", Tiles: []*ContactSheetTile{{Shot: "CG_0010", Task: "fx", Version: 1, Thumbnail: &ths[1]}, nil}},
+		},
+	}
+	img, err := c.Image()
+	if err != nil {
+		t.Fatalf("could not make contact sheet image: %v", err)
+	}
+	want := image.Pt(2*(VersionThumbnailSize.Width+contactSheetGap)+contactSheetGap, VersionThumbnailSize.Height+2*contactSheetGap)
+	if got := img.Bounds().Size(); got != want {
+		t.Fatalf("contact sheet size: got %v, want %v", got, want)
+	}
+
+	err = DeleteVersionThumbnails("TEST", "CG_0010", "fx", 1)
+	if err != nil {
+		t.Fatalf("could not delete version thumbnails: %v", err)
+	}
+	if VersionThumbnailURLPath("TEST", "CG_0010", "fx", 1) != "" {
+		t.Fatalf("version thumbnail exist after delete")
+	}
+
+	// 읽을 수 없는 이미지가 있어도 나머지 썸네일은 만들어야 한다.
+	images = images[:0]
+	for _, name := range []string{"b.0001.png", "b.0002.png", "b.0003.png"} {
+		src := filepath.Join(tmpd, name)
+		f, err := os.Create(src)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if name == "b.0002.png" {
+			_, err = f.Write([]byte("not a png"))
+		} else {
+			err = png.Encode(f, image.NewRGBA(image.Rect(0, 0, 1920, 1080)))
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		f.Close()
+		images = append(images, src)
+	}
+	v = &Version{Project: "TEST", Shot: "CG_0010", Task: "fx", Version: 2, Images: images}
+	ths, err = VersionThumbnails(v)
+	if err == nil {
+		t.Fatalf("unreadable image should be reported")
+	}
+	if len(ths) != 2 || ths[0].Name != "first" || ths[1].Name != "last" {
+		t.Fatalf("thumbnails of readable images should be made: %v", ths)
+	}
+
+	// 스토리지 루트 밖의 이미지로는 썸네일을 만들지 않는다.
+	StorageRoots = []string{filepath.Join(tmpd, "show")}
+	v = &Version{Project: "TEST", Shot: "CG_0010", Task: "fx", Version: 3, Images: images[:1]}
+	ths, err = VersionThumbnails(v)
+	if err == nil {
+		t.Fatalf("image outside of storage roots should be reported")
+	}
+	if len(ths) != 0 {
+		t.Fatalf("thumbnail should not be made from image outside of storage roots: %v", ths)
+	}
+}